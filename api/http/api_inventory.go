@@ -15,9 +15,17 @@
 package http
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -25,6 +33,7 @@ import (
 	"github.com/ant0ine/go-json-rest/rest"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/pkg/errors"
+	"github.com/ugorji/go/codec"
 
 	"github.com/mendersoftware/go-lib-micro/accesslog"
 	"github.com/mendersoftware/go-lib-micro/identity"
@@ -42,15 +51,18 @@ import (
 )
 
 const (
-	uriDevices       = "/api/0.1.0/devices"
-	uriDevice        = "/api/0.1.0/devices/#id"
-	uriDeviceTags    = "/api/0.1.0/devices/#id/tags"
-	uriDeviceGroups  = "/api/0.1.0/devices/#id/group"
-	uriDeviceGroup   = "/api/0.1.0/devices/#id/group/#name"
-	uriAttributes    = "/api/0.1.0/attributes"
-	uriGroups        = "/api/0.1.0/groups"
-	uriGroupsName    = "/api/0.1.0/groups/#name"
-	uriGroupsDevices = "/api/0.1.0/groups/#name/devices"
+	uriDevices        = "/api/0.1.0/devices"
+	uriDevice         = "/api/0.1.0/devices/#id"
+	uriDevicesAnyTag  = "/api/0.1.0/devices/by-any-tag"
+	uriDevicesGroups  = "/api/0.1.0/devices/groups/distinct"
+	uriDeviceTags     = "/api/0.1.0/devices/#id/tags"
+	uriDeviceGroups   = "/api/0.1.0/devices/#id/group"
+	uriDeviceGroup    = "/api/0.1.0/devices/#id/group/#name"
+	uriDeviceSiblings = "/api/0.1.0/devices/#id/group/siblings"
+	uriAttributes     = "/api/0.1.0/attributes"
+	uriGroups         = "/api/0.1.0/groups"
+	uriGroupsName     = "/api/0.1.0/groups/#name"
+	uriGroupsDevices  = "/api/0.1.0/groups/#name/devices"
 
 	apiUrlInternalV1         = "/api/internal/v1/inventory"
 	uriInternalAlive         = apiUrlInternalV1 + "/alive"
@@ -65,18 +77,88 @@ const (
 	urlInternalReindex   = apiUrlInternalV1 + "/tenants/#tenant_id/devices/#device_id/reindex"
 	apiUrlManagementV2   = "/api/management/v2/inventory"
 	urlFiltersAttributes = apiUrlManagementV2 + "/filters/attributes"
+	urlFiltersDescribed  = apiUrlManagementV2 + "/filters/attributes/described"
+	urlFiltersTopValues  = apiUrlManagementV2 + "/filters/attributes/#scope/#name/top-values"
+	urlAttrCardinality   = apiUrlManagementV2 + "/filters/attributes/#scope/#name/cardinality"
 	urlFiltersSearch     = apiUrlManagementV2 + "/filters/search"
+	urlFiltersCount      = apiUrlManagementV2 + "/filters/count"
+	urlFiltersCoverage   = apiUrlManagementV2 + "/filters/coverage"
+	urlFiltersScopes     = apiUrlManagementV2 + "/filters/scopes"
+	urlDeviceAttributes  = apiUrlManagementV2 + "/devices/#id/attributes"
+	urlDevicesStale      = apiUrlManagementV2 + "/devices/stale"
+	urlDevicesByGroup    = apiUrlManagementV2 + "/devices/by-group"
+	urlOnboardingStats   = apiUrlManagementV2 + "/devices/onboarding-stats"
+	urlAlertsSummary     = apiUrlManagementV2 + "/devices/alerts-summary"
+	urlDevicesCompare    = apiUrlManagementV2 + "/devices/compare"
+	urlDevicesBatch      = apiUrlManagementV2 + "/devices/batch"
+	urlGroupSchema       = apiUrlManagementV2 + "/groups/#name/schema"
+	urlSavedFilters      = apiUrlManagementV2 + "/filters"
+	urlSavedFilter       = apiUrlManagementV2 + "/filters/#id"
+	urlSavedFilterDevs   = apiUrlManagementV2 + "/filters/#id/devices"
 
 	apiUrlInternalV2         = "/api/internal/v2/inventory"
 	urlInternalFiltersSearch = apiUrlInternalV2 + "/tenants/#tenant_id/filters/search"
 
+	urlInternalDuplicateAttributes = apiUrlInternalV1 +
+		"/tenants/#tenant_id/diagnostics/duplicate-attributes"
+	urlInternalRepairAttributes = apiUrlInternalV1 +
+		"/tenants/#tenant_id/devices/#device_id/attributes/repair"
+	urlInternalVerifyAttributes = apiUrlInternalV1 +
+		"/tenants/#tenant_id/devices/#device_id/attributes/verify"
+	urlInternalAttributesChurn = apiUrlInternalV1 +
+		"/tenants/#tenant_id/attributes/churn"
+	urlInternalDevicesAttributeCounts = apiUrlInternalV1 +
+		"/tenants/#tenant_id/devices/attribute-counts"
+	urlInternalDevicesByAttribute = apiUrlInternalV1 +
+		"/tenants/#tenant_id/devices/by-attribute"
+	urlInternalDevicesAttributeDrift = apiUrlInternalV1 +
+		"/tenants/#tenant_id/devices/attribute-drift"
+	urlInternalFeatureFlags    = apiUrlInternalV1 + "/tenants/#tenant_id/features"
+	urlInternalDevicesStatuses = apiUrlInternalV1 +
+		"/tenants/#tenant_id/devices/statuses"
+	urlInternalFiltersSearchExplain = apiUrlInternalV1 +
+		"/tenants/#tenant_id/filters/search/explain"
+	urlInternalDeviceAttributes = apiUrlInternalV1 +
+		"/tenants/#tenant_id/devices/#device_id/attributes"
+	urlInternalToggleAttribute = apiUrlInternalV1 +
+		"/tenants/#tenant_id/devices/#device_id/attributes/#scope/#name/toggle"
+	urlInternalDevicesStaleScope = apiUrlInternalV1 +
+		"/tenants/#tenant_id/devices/stale/#scope"
+	urlInternalDevicesUpdatedScope = apiUrlInternalV1 +
+		"/tenants/#tenant_id/devices/updated/#scope"
+	urlInternalDevicesByAttributeSet = apiUrlInternalV1 +
+		"/tenants/#tenant_id/devices/by-attribute-set"
+	urlInternalAttributesPresence = apiUrlInternalV1 +
+		"/tenants/#tenant_id/devices/attributes-presence"
+	urlInternalDevicesSample  = apiUrlInternalV1 + "/tenants/#tenant_id/devices/sample"
+	urlInternalMoveAttributes = apiUrlInternalV1 +
+		"/tenants/#tenant_id/devices/#device_id/attributes/move"
+
 	hdrTotalCount = "X-Total-Count"
+	hdrResultETag = "X-Result-ETag"
+	// hdrTotalCountEstimated is set when the total count is estimated
+	hdrTotalCountEstimated = "X-Total-Count-Estimated"
+	// hdrPageReduced is set to the number of devices of the page when
+	// the page was reduced to fit the maximum response size
+	hdrPageReduced = "X-Page-Reduced"
+	// hdrPageLinksCapped is set to the maximum linked page when the prev
+	// or next Link header was left out for pointing past it
+	hdrPageLinksCapped = "X-Page-Links-Capped"
 )
 
 const (
 	queryParamGroup          = "group"
 	queryParamSort           = "sort"
 	queryParamHasGroup       = "has_group"
+	queryParamOlderThan      = "older_than"
+	queryParamSince          = "since"
+	queryParamDryRun         = "dry_run"
+	queryParamFresh          = "fresh"
+	queryParamExpand         = "expand"
+	queryParamPerGroup       = "per_group"
+	queryParamLimit          = "limit"
+	queryParamAttribute      = "attribute"
+	queryParamAllAttributes  = "all_attributes"
 	queryParamValueSeparator = ":"
 	queryParamScopeSeparator = "/"
 	sortOrderAsc             = "asc"
@@ -89,11 +171,46 @@ const (
 	DefaultTimeout = time.Second * 10
 )
 
+const (
+	// devicesByGroupUngrouped is the key of the devices without a group
+	// in the devices by group listing
+	devicesByGroupUngrouped = "ungrouped"
+
+	devicesByGroupPerGroupDefault = 20
+	devicesByGroupPerGroupMax     = 100
+	devicesByGroupLimitDefault    = 500
+	devicesByGroupLimitMax        = 1000
+)
+
+const (
+	// devicesBatchMax is the maximum number of device IDs of a single
+	// request at the devices batch endpoint
+	devicesBatchMax = 500
+)
+
+const (
+	topAttributeValuesLimitDefault = 10
+	topAttributeValuesLimitMax     = 100
+)
+
 const (
 	checkInTimeParamName  = "check_in_time"
 	checkInTimeParamScope = "system"
 )
 
+const (
+	contentTypeMsgpack  = "application/msgpack"
+	contentTypeXMsgpack = "application/x-msgpack"
+)
+
+var msgpackHandle = &codec.MsgpackHandle{WriteExt: true}
+
+// model of the expanded response at the internal devices/:id/groups endpoint
+type InventoryApiDeviceGroupsExpanded struct {
+	model.DeviceGroups
+	Identity model.DeviceAttributes `json:"identity"`
+}
+
 // model of device's group name response at /devices/:id/group endpoint
 type InventoryApiGroup struct {
 	Group model.GroupName `json:"group"`
@@ -103,14 +220,299 @@ func (g InventoryApiGroup) Validate() error {
 	return g.Group.Validate()
 }
 
+// model of the distinct groups response at /devices/groups/distinct endpoint
+type InventoryApiDistinctGroups struct {
+	Groups    []model.GroupName `json:"groups"`
+	Ungrouped bool              `json:"ungrouped"`
+}
+
+// model of the request at the internal /devices/by-attribute endpoint
+type InventoryApiAttributeValues struct {
+	Scope  string        `json:"scope"`
+	Name   string        `json:"name"`
+	Values []interface{} `json:"values"`
+}
+
+func (a InventoryApiAttributeValues) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.Scope, validation.Required),
+		validation.Field(&a.Name, validation.Required),
+		validation.Field(&a.Values, validation.Required,
+			validation.Each(validation.By(func(value interface{}) error {
+				switch value.(type) {
+				case string, float64:
+					return nil
+				default:
+					return errors.New("supported types are string and float64")
+				}
+			}))),
+	)
+}
+
+// model of the request at the internal /devices/attribute-drift endpoint
+type InventoryApiAttributeValue struct {
+	Scope string      `json:"scope"`
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+func (a InventoryApiAttributeValue) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.Scope, validation.Required),
+		validation.Field(&a.Name, validation.Required),
+		validation.Field(&a.Value, validation.NotNil,
+			validation.By(func(value interface{}) error {
+				switch value.(type) {
+				case nil, string, float64:
+					return nil
+				default:
+					return errors.New("supported types are string and float64")
+				}
+			})),
+	)
+}
+
+// model of the request at the internal /devices/by-attribute-set endpoint
+type InventoryApiAttributeSet struct {
+	Scope      string                 `json:"scope"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+func (a InventoryApiAttributeSet) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.Scope, validation.Required),
+		validation.Field(&a.Attributes, validation.Required,
+			validation.Each(validation.By(func(value interface{}) error {
+				switch value.(type) {
+				case string, float64:
+					return nil
+				default:
+					return errors.New("supported types are string and float64")
+				}
+			}))),
+	)
+}
+
+// model of the request at the internal /devices/sample endpoint
+type InventoryApiSampleRequest struct {
+	Size    int                     `json:"size"`
+	Filters []model.FilterPredicate `json:"filters"`
+}
+
+func (s InventoryApiSampleRequest) Validate() error {
+	return validation.ValidateStruct(&s,
+		validation.Field(&s.Size, validation.Required,
+			validation.Min(1), validation.Max(utils.PerPageMax)),
+		validation.Field(&s.Filters),
+	)
+}
+
+// model of the request at the internal /devices/attributes-presence endpoint
+type InventoryApiAttributesPresenceRequest struct {
+	DeviceIDs  []model.DeviceID        `json:"device_ids"`
+	Attributes []model.SelectAttribute `json:"attributes"`
+}
+
+func (a InventoryApiAttributesPresenceRequest) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.DeviceIDs, validation.Required,
+			validation.Each(validation.Required)),
+		validation.Field(&a.Attributes, validation.Required,
+			validation.Each(validation.By(func(value interface{}) error {
+				attr := value.(model.SelectAttribute)
+				return validation.ValidateStruct(&attr,
+					validation.Field(&attr.Scope, validation.Required),
+					validation.Field(&attr.Attribute, validation.Required),
+				)
+			}))),
+	)
+}
+
+// model of the response at the internal /devices/attributes-presence
+// endpoint; the presence flags of each device follow the order of the
+// attributes
+type InventoryApiAttributesPresence struct {
+	Attributes []model.SelectAttribute   `json:"attributes"`
+	Devices    map[model.DeviceID][]bool `json:"devices"`
+}
+
+// model of the request at the internal attribute toggle endpoint
+type InventoryApiToggleAttribute struct {
+	Default bool `json:"default"`
+}
+
+// model of the response at the filters count endpoint
+type InventoryApiDevicesCount struct {
+	Count int `json:"count"`
+}
+
+// model of the request at the devices compare endpoint
+type InventoryApiCompareDevices struct {
+	Base  string `json:"base"`
+	Other string `json:"other"`
+}
+
+func (a InventoryApiCompareDevices) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.Base, validation.Required),
+		validation.Field(&a.Other, validation.Required),
+	)
+}
+
+// model of the request at the internal attributes move endpoint
+type InventoryApiMoveAttributes struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Policy string `json:"policy"`
+}
+
+func (a InventoryApiMoveAttributes) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.From, validation.Required,
+			validation.NotIn(model.AttrScopeSystem)),
+		validation.Field(&a.To, validation.Required,
+			validation.NotIn(model.AttrScopeSystem, a.From)),
+		validation.Field(&a.Policy,
+			validation.In(model.MergePolicyOverwrite, model.MergePolicyKeep)),
+	)
+}
+
+// Config holds the configurable behavior of the inventory API handlers.
+type Config struct {
+	// AddDeviceRejectUnknownFields makes the internal add-device
+	// handler reject device payloads with unknown top-level fields
+	// instead of ignoring them.
+	AddDeviceRejectUnknownFields bool
+
+	// ScopeAliases maps alternative attribute scope names used by
+	// external callers to the canonical scope names, e.g.
+	// "inv" -> "inventory".
+	ScopeAliases map[string]string
+
+	// ProtectedScopes lists the attribute scopes which are maintained by
+	// the internal services and are read-only for the public APIs.
+	ProtectedScopes []string
+
+	// MaxBulkDeviceIDs limits the number of device IDs accepted by the
+	// bulk device operations; zero means no limit.
+	MaxBulkDeviceIDs int
+
+	// MaxPageOffset limits the number of devices skipped by the pages of
+	// the device listing and search; zero means no limit.
+	MaxPageOffset int
+
+	// MaxLinkPage leaves the prev and next Link headers pointing past
+	// this page out of the device listing and search responses, to
+	// discourage deep pagination; zero means no limit.
+	MaxLinkPage int
+
+	// SearchCountLimit is the number of matching devices up to which the
+	// searches tolerating an estimated total count count them; zero
+	// means the count is always exact.
+	SearchCountLimit int
+
+	// NullAttributeValueRemoves makes the device attributes and tags
+	// update handlers remove the attributes with a null value instead
+	// of rejecting the request.
+	NullAttributeValueRemoves bool
+
+	// AddDeviceCreateOnly makes the internal add-device handler fail
+	// with 409 Conflict if the device exists instead of merging the
+	// attributes into the existing device.
+	AddDeviceCreateOnly bool
+
+	// AddDeviceLocationBaseURL is the base of the absolute URL of the
+	// Location header of the add-device responses; the header is the
+	// relative device URL if empty.
+	AddDeviceLocationBaseURL string
+
+	// DefaultFilterScope is the attribute scope of the legacy API filter
+	// and sort parameters not prefixed with a scope; defaults to inventory.
+	DefaultFilterScope string
+
+	// RedactedAttributes lists the names of the attributes whose values
+	// are hidden in the logs.
+	RedactedAttributes []string
+
+	// ReindexServiceScopes maps the names of the services allowed to
+	// request the reindexing of the device data to the attribute scope
+	// of the alert attributes they write.
+	ReindexServiceScopes map[string]string
+
+	// EnableSearchExplain enables the internal endpoint returning the
+	// query plan of the devices search.
+	EnableSearchExplain bool
+
+	// TrimGroupNames trims the leading and trailing whitespace of the
+	// group names of the requests before validating them.
+	TrimGroupNames bool
+
+	// SearchRequireFilters makes the devices search reject the requests
+	// without filters instead of matching all the devices.
+	SearchRequireFilters bool
+
+	// SearchRequireTenant makes the devices search and count reject the
+	// requests whose identity lacks a tenant instead of searching the
+	// default database, for the multi-tenant deployments.
+	SearchRequireTenant bool
+
+	// SearchIndexedFiltersOnly makes the devices search reject the
+	// filters on the attributes which are not indexed, i.e. neither the
+	// device ID nor listed in IndexedAttributes.
+	SearchIndexedFiltersOnly bool
+
+	// IndexedAttributes lists the attributes, as <scope>/<name>, whose
+	// values are indexed.
+	IndexedAttributes []string
+
+	// DefaultProjection lists the attributes, as <scope>/<name>, which the
+	// devices of the management device listing and searches are limited
+	// to when the request doesn't select attributes; empty means all the
+	// attributes.
+	DefaultProjection []string
+
+	// LenientSortOrder makes the legacy device listing sort ascending on
+	// an unknown sort order instead of rejecting the request.
+	LenientSortOrder bool
+
+	// MaxResponseBytes limits the size of the JSON encoded pages of the
+	// device listing and search by reducing the number of devices of the
+	// page; zero means no limit.
+	MaxResponseBytes int
+}
+
+// NewConfig returns the default API handlers configuration.
+func NewConfig() *Config {
+	return &Config{
+		ProtectedScopes: []string{
+			model.AttrScopeIdentity,
+			model.AttrScopeSystem,
+		},
+		DefaultFilterScope: model.AttrScopeInventory,
+		ReindexServiceScopes: map[string]string{
+			"devicemonitor": model.AttrScopeMonitor,
+		},
+	}
+}
+
 type inventoryHandlers struct {
 	inventory inventory.InventoryApp
+	config    Config
+	redactor  utils.AttributesRedactor
+
+	defaultProjection []model.SelectAttribute
 }
 
-// return an ApiHandler for device admission app
-func NewInventoryApiHandlers(i inventory.InventoryApp) ApiHandler {
+// return an ApiHandler for device admission app; a nil config selects the
+// defaults
+func NewInventoryApiHandlers(i inventory.InventoryApp, config *Config) ApiHandler {
+	if config == nil {
+		config = NewConfig()
+	}
 	return &inventoryHandlers{
 		inventory: i,
+		config:    *config,
+		redactor:  utils.NewAttributesRedactor(config.RedactedAttributes),
 	}
 }
 
@@ -128,6 +530,12 @@ func (i *inventoryHandlers) Build() (http.Handler, error) {
 	// {"Error": "msg"}
 	rest.ErrorFieldName = "error"
 
+	projection, err := parseDefaultProjection(i.config.DefaultProjection)
+	if err != nil {
+		return nil, err
+	}
+	i.defaultProjection = projection
+
 	api := rest.NewApi()
 
 	api.Use(
@@ -153,6 +561,27 @@ func (i *inventoryHandlers) Build() (http.Handler, error) {
 
 		rest.Patch(urlInternalAttributes, i.PatchDeviceAttributesInternalHandler),
 		rest.Post(urlInternalReindex, i.ReindexDeviceDataHandler),
+		rest.Get(urlInternalDuplicateAttributes, i.GetDuplicateAttributesInternalHandler),
+		rest.Post(urlInternalRepairAttributes, i.RepairDuplicateAttributesInternalHandler),
+		rest.Get(urlInternalVerifyAttributes, i.VerifyDeviceAttributesInternalHandler),
+		rest.Get(urlInternalAttributesChurn, i.GetAttributesChurnInternalHandler),
+		rest.Post(urlInternalDevicesAttributeCounts, i.GetDevicesAttributesCountInternalHandler),
+		rest.Post(urlInternalDevicesStatuses, i.GetDevicesStatusesInternalHandler),
+		rest.Post(urlInternalDevicesByAttribute, i.FindDevicesByAttributeInternalHandler),
+		rest.Post(urlInternalDevicesByAttributeSet, i.FindDevicesByAttributeSetInternalHandler),
+		rest.Post(urlInternalDevicesAttributeDrift,
+			i.FindDevicesWithAttributeDriftInternalHandler),
+		rest.Post(urlInternalAttributesPresence, i.GetAttributesPresenceInternalHandler),
+		rest.Post(urlInternalDevicesSample, i.SampleDevicesInternalHandler),
+		rest.Get(urlInternalFeatureFlags, i.GetFeatureFlagsInternalHandler),
+		rest.Put(urlInternalFeatureFlags, i.SetFeatureFlagsInternalHandler),
+		rest.Post(urlInternalFiltersSearchExplain, i.InternalFiltersSearchExplainHandler),
+		rest.Put(urlInternalDeviceAttributes, i.ReplaceAllDeviceAttributesInternalHandler),
+		rest.Post(urlInternalToggleAttribute, i.ToggleDeviceAttributeInternalHandler),
+		rest.Post(urlInternalMoveAttributes, i.MoveDeviceAttributesInternalHandler),
+		rest.Get(urlInternalDevicesStaleScope, i.GetDevicesWithStaleScopeInternalHandler),
+		rest.Get(urlInternalDevicesUpdatedScope,
+			i.GetDevicesUpdatedByScopeSinceInternalHandler),
 
 		rest.Post(uriInternalTenants, i.CreateTenantHandler),
 		rest.Post(uriInternalDevices, i.AddDeviceHandler),
@@ -165,6 +594,7 @@ func (i *inventoryHandlers) Build() (http.Handler, error) {
 	publicRoutes := AutogenOptionsRoutes([]*rest.Route{
 		rest.Get(uriDevices, i.GetDevicesHandler),
 		rest.Get(uriDevice, i.GetDeviceHandler),
+		rest.Post(uriDevicesAnyTag, i.GetDevicesByAnyTagHandler),
 		rest.Delete(uriDevice, i.DeleteDeviceInventoryHandler),
 		rest.Delete(uriDeviceGroup, i.DeleteDeviceGroupHandler),
 		rest.Delete(uriGroupsName, i.DeleteGroupHandler),
@@ -177,11 +607,33 @@ func (i *inventoryHandlers) Build() (http.Handler, error) {
 		rest.Patch(uriDeviceTags, i.UpdateDeviceTagsHandler),
 
 		rest.Get(uriDeviceGroups, i.GetDeviceGroupHandler),
+		rest.Get(uriDeviceSiblings, i.GetGroupSiblingsHandler),
+		rest.Post(uriDevicesGroups, i.GetDevicesDistinctGroupsHandler),
 		rest.Get(uriGroups, i.GetGroupsHandler),
 		rest.Get(uriGroupsDevices, i.GetDevicesByGroupHandler),
 
 		rest.Get(urlFiltersAttributes, i.FiltersAttributesHandler),
+		rest.Get(urlFiltersDescribed, i.FiltersDescribedAttributesHandler),
+		rest.Get(urlGroupSchema, i.GetGroupSchemaHandler),
+		rest.Get(urlFiltersTopValues, i.FiltersTopAttributeValuesHandler),
+		rest.Get(urlAttrCardinality, i.FiltersAttributeCardinalityHandler),
+		rest.Get(urlFiltersCoverage, i.FiltersCoverageHandler),
+		rest.Get(urlFiltersScopes, i.FiltersScopesHandler),
 		rest.Post(urlFiltersSearch, i.FiltersSearchHandler),
+		rest.Post(urlFiltersCount, i.FiltersCountHandler),
+		rest.Post(urlSavedFilters, i.CreateSavedFilterHandler),
+		rest.Get(urlSavedFilters, i.ListSavedFiltersHandler),
+		rest.Get(urlSavedFilter, i.GetSavedFilterHandler),
+		rest.Put(urlSavedFilter, i.UpdateSavedFilterHandler),
+		rest.Delete(urlSavedFilter, i.DeleteSavedFilterHandler),
+		rest.Get(urlSavedFilterDevs, i.GetSavedFilterDevicesHandler),
+		rest.Get(urlDeviceAttributes, i.GetDeviceAttributesHandler),
+		rest.Get(urlDevicesStale, i.GetStaleDevicesHandler),
+		rest.Get(urlDevicesByGroup, i.GetDevicesPartitionedByGroupHandler),
+		rest.Post(urlOnboardingStats, i.GetOnboardingStatsHandler),
+		rest.Post(urlDevicesCompare, i.CompareDevicesHandler),
+		rest.Post(urlDevicesBatch, i.GetDevicesBatchHandler),
+		rest.Get(urlAlertsSummary, i.GetAlertsSummaryHandler),
 	}, AllowHeaderOptionsGenerator)
 	publicRoutes = wrapRoutes(&identity.IdentityMiddleware{
 		UpdateLogger: true,
@@ -218,11 +670,59 @@ func (i *inventoryHandlers) HealthCheckHandler(w rest.ResponseWriter, r *rest.Re
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// resolveDefaultScope returns the canonical name of the scope of the
+// legacy API parameters not prefixed with a scope
+func resolveDefaultScope(aliases map[string]string, defaultScope string) string {
+	if defaultScope == "" {
+		return model.AttrScopeInventory
+	}
+	return resolveScope(aliases, defaultScope)
+}
+
+// parseSelectAttributes parses the legacy API attribute parameters
+// selecting the returned attributes; an attribute without a scope prefix
+// belongs to defaultScope, or to the inventory scope if defaultScope is
+// empty.
+func parseSelectAttributes(
+	r *rest.Request,
+	scopeAliases map[string]string,
+	defaultScope string,
+) []model.SelectAttribute {
+	defaultScope = resolveDefaultScope(scopeAliases, defaultScope)
+	var attributes []model.SelectAttribute
+	for _, name := range r.URL.Query()[queryParamAttribute] {
+		if name == "" {
+			continue
+		}
+		attribute := model.SelectAttribute{
+			Scope:     defaultScope,
+			Attribute: name,
+		}
+		attrNameWithScope := strings.SplitN(name, queryParamScopeSeparator, 2)
+		if len(attrNameWithScope) == 2 {
+			attribute.Scope = resolveScope(scopeAliases, attrNameWithScope[0])
+			attribute.Attribute = attrNameWithScope[1]
+		}
+		attributes = append(attributes, attribute)
+	}
+	return attributes
+}
+
+// parseSortParam parses the legacy API sort parameter; an attribute
+// without a scope prefix belongs to defaultScope, or to the inventory
+// scope if defaultScope is empty. An unknown sort order is rejected,
+// unless lenientOrder is set, in which case the sort is ascending.
+//
 // `sort` paramater value is an attribute name with optional direction (desc or asc)
 // separated by colon (:)
 //
 // eg. `sort=attr_name1` or `sort=attr_name1:asc`
-func parseSortParam(r *rest.Request) (*store.Sort, error) {
+func parseSortParam(
+	r *rest.Request,
+	scopeAliases map[string]string,
+	defaultScope string,
+	lenientOrder bool,
+) (*store.Sort, error) {
 	sortStr, err := utils.ParseQueryParmStr(r, queryParamSort, false, nil)
 	if err != nil {
 		return nil, err
@@ -238,17 +738,20 @@ func parseSortParam(r *rest.Request) (*store.Sort, error) {
 	)
 	var scope, attrName string
 	if len(attrNameWithScope) == 1 {
-		scope = model.AttrScopeInventory
+		scope = resolveDefaultScope(scopeAliases, defaultScope)
 		attrName = attrNameWithScope[0]
 	} else {
-		scope = attrNameWithScope[0]
+		scope = resolveScope(scopeAliases, attrNameWithScope[0])
 		attrName = attrNameWithScope[1]
 	}
 	sort := store.Sort{AttrName: attrName, AttrScope: scope}
 	if len(sortValArray) == 2 {
 		sortOrder := sortValArray[sortOrderIdx]
 		if sortOrder != sortOrderAsc && sortOrder != sortOrderDesc {
-			return nil, errors.New("invalid sort order")
+			if !lenientOrder {
+				return nil, errors.New("invalid sort order")
+			}
+			sortOrder = sortOrderAsc
 		}
 		sort.Ascending = sortOrder == sortOrderAsc
 	}
@@ -260,14 +763,23 @@ func parseSortParam(r *rest.Request) (*store.Sort, error) {
 // Equality operator default value is `eq`
 //
 // eg. `attr_name1=value1` or `attr_name1=eq:value1`
-func parseFilterParams(r *rest.Request) ([]store.Filter, error) {
-	knownParams := []string{
+//
+// Attributes without a scope prefix (`scope/attr_name1`) belong to
+// defaultScope, or to the inventory scope if defaultScope is empty.
+func parseFilterParams(
+	r *rest.Request,
+	scopeAliases map[string]string,
+	defaultScope string,
+	extraParams ...string,
+) ([]store.Filter, error) {
+	defaultScope = resolveDefaultScope(scopeAliases, defaultScope)
+	knownParams := append([]string{
 		utils.PageName,
 		utils.PerPageName,
 		queryParamSort,
 		queryParamHasGroup,
 		queryParamGroup,
-	}
+	}, extraParams...)
 	filters := make([]store.Filter, 0)
 	var filter store.Filter
 	for name := range r.URL.Query() {
@@ -282,10 +794,10 @@ func parseFilterParams(r *rest.Request) ([]store.Filter, error) {
 		attrNameWithScope := strings.SplitN(name, queryParamScopeSeparator, 2)
 		var scope, attrName string
 		if len(attrNameWithScope) == 1 {
-			scope = model.AttrScopeInventory
+			scope = defaultScope
 			attrName = attrNameWithScope[0]
 		} else {
-			scope = attrNameWithScope[0]
+			scope = resolveScope(scopeAliases, attrNameWithScope[0])
 			attrName = attrNameWithScope[1]
 		}
 		filter = store.Filter{AttrName: attrName, AttrScope: scope}
@@ -342,6 +854,11 @@ func (i *inventoryHandlers) GetDevicesHandler(w rest.ResponseWriter, r *rest.Req
 		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
+	err = checkPageOffset(int(page), int(perPage), i.config.MaxPageOffset)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
 
 	hasGroup, err := utils.ParseQueryParmBool(r, queryParamHasGroup, false, nil)
 	if err != nil {
@@ -350,29 +867,41 @@ func (i *inventoryHandlers) GetDevicesHandler(w rest.ResponseWriter, r *rest.Req
 	}
 
 	groupName, err := utils.ParseQueryParmStr(r, "group", false, nil)
+	groupName = string(i.groupName(groupName))
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	sort, err := parseSortParam(r,
+		i.config.ScopeAliases,
+		i.config.DefaultFilterScope,
+		i.config.LenientSortOrder,
+	)
 	if err != nil {
 		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
 
-	sort, err := parseSortParam(r)
+	filters, err := parseFilterParams(r, i.config.ScopeAliases, i.config.DefaultFilterScope)
 	if err != nil {
 		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
 
-	filters, err := parseFilterParams(r)
+	attributes, err := i.projectAttributes(r, nil)
 	if err != nil {
 		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
 
 	ld := store.ListQuery{Skip: int((page - 1) * perPage),
-		Limit:     int(perPage),
-		Filters:   filters,
-		Sort:      sort,
-		HasGroup:  hasGroup,
-		GroupName: groupName}
+		Limit:      int(perPage),
+		Filters:    filters,
+		Sort:       sort,
+		HasGroup:   hasGroup,
+		GroupName:  groupName,
+		Attributes: attributes}
 
 	devs, totalCount, err := i.inventory.ListDevices(ctx, ld)
 
@@ -382,268 +911,393 @@ func (i *inventoryHandlers) GetDevicesHandler(w rest.ResponseWriter, r *rest.Req
 	}
 
 	hasNext := totalCount > int(page*perPage)
-	links := utils.MakePageLinkHdrs(r, page, perPage, hasNext)
-	for _, l := range links {
-		w.Header().Add("Link", l)
-	}
+	devs = i.addDevicesPageLinks(w, r, page, perPage, hasNext, devs)
 	// the response writer will ensure the header name is in Kebab-Pascal-Case
 	w.Header().Add(hdrTotalCount, strconv.Itoa(totalCount))
+	if ld.Unfiltered() {
+		w.Header().Add(hdrTotalCountEstimated, "true")
+	}
 	_ = w.WriteJson(devs)
 }
 
-func (i *inventoryHandlers) GetDeviceHandler(w rest.ResponseWriter, r *rest.Request) {
+// GetDevicesPartitionedByGroupHandler returns the IDs of the devices
+// matching the filters partitioned by group
+func (i *inventoryHandlers) GetDevicesPartitionedByGroupHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
 	ctx := r.Context()
 
 	l := log.FromContext(ctx)
 
-	deviceID := r.PathParam("id")
+	perGroup, err := utils.ParseQueryParmUInt(r, queryParamPerGroup, false,
+		1, devicesByGroupPerGroupMax, devicesByGroupPerGroupDefault)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
 
-	dev, err := i.inventory.GetDevice(ctx, model.DeviceID(deviceID))
+	limit, err := utils.ParseQueryParmUInt(r, queryParamLimit, false,
+		1, devicesByGroupLimitMax, devicesByGroupLimitDefault)
 	if err != nil {
-		u.RestErrWithLogInternal(w, r, l, err)
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
-	if dev == nil {
-		u.RestErrWithLog(w, r, l, store.ErrDevNotFound, http.StatusNotFound)
+
+	hasGroup, err := utils.ParseQueryParmBool(r, queryParamHasGroup, false, nil)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
-	if dev.TagsEtag != "" {
-		w.Header().Set("ETag", dev.TagsEtag)
+
+	groupName, err := utils.ParseQueryParmStr(r, queryParamGroup, false, nil)
+	groupName = string(i.groupName(groupName))
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	filters, err := parseFilterParams(r, i.config.ScopeAliases, i.config.DefaultFilterScope,
+		queryParamPerGroup, queryParamLimit)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	q := store.ListQuery{
+		Limit:     int(limit),
+		Filters:   filters,
+		HasGroup:  hasGroup,
+		GroupName: groupName,
+	}
+	groups, err := i.inventory.ListDevicesPartitionedByGroup(ctx, q, int(perGroup))
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
 	}
 
-	_ = w.WriteJson(dev)
+	res := make(map[string][]model.DeviceID, len(groups))
+	for group, devices := range groups {
+		if group == "" {
+			res[devicesByGroupUngrouped] = devices
+		} else {
+			res[string(group)] = devices
+		}
+	}
+	_ = w.WriteJson(res)
 }
 
-func (i *inventoryHandlers) DeleteDeviceInventoryHandler(w rest.ResponseWriter, r *rest.Request) {
+// CompareDevicesHandler returns the difference between the attributes of
+// two devices, e.g. a misbehaving device and a known-good one
+func (i *inventoryHandlers) CompareDevicesHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 
 	l := log.FromContext(ctx)
 
-	deviceID := r.PathParam("id")
+	var req InventoryApiCompareDevices
+	if err := r.DecodeJsonPayload(&req); err != nil {
+		u.RestErrWithLog(w, r, l,
+			errors.Wrap(err, "failed to decode request body"),
+			http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
 
-	err := i.inventory.ReplaceAttributes(ctx, model.DeviceID(deviceID),
-		model.DeviceAttributes{}, model.AttrScopeInventory, "")
-	if err != nil && err != store.ErrDevNotFound {
+	diff, err := i.inventory.CompareDevices(ctx,
+		model.DeviceID(req.Base), model.DeviceID(req.Other))
+	if errors.Cause(err) == store.ErrDevNotFound {
+		u.RestErrWithLog(w, r, l, err, http.StatusNotFound)
+		return
+	} else if err != nil {
 		u.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	_ = w.WriteJson(diff)
 }
 
-func (i *inventoryHandlers) DeleteDeviceHandler(w rest.ResponseWriter, r *rest.Request) {
+// GetDevicesBatchHandler returns the devices with the IDs given in the
+// payload in the order of the IDs; unknown IDs are left out
+func (i *inventoryHandlers) GetDevicesBatchHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
-	tenantId := r.PathParam("tenant_id")
-	if tenantId != "" {
-		id := &midentity.Identity{
-			Tenant: tenantId,
-		}
-		ctx = midentity.WithContext(ctx, id)
-	}
 
 	l := log.FromContext(ctx)
 
-	deviceID := r.PathParam("device_id")
+	var deviceIDs []model.DeviceID
+	if err := r.DecodeJsonPayload(&deviceIDs); err != nil {
+		u.RestErrWithLog(w, r, l,
+			errors.Wrap(err, "invalid payload schema"),
+			http.StatusBadRequest,
+		)
+		return
+	} else if len(deviceIDs) == 0 {
+		u.RestErrWithLog(w, r, l,
+			errors.New("no device IDs present in payload"),
+			http.StatusBadRequest,
+		)
+		return
+	} else if len(deviceIDs) > devicesBatchMax {
+		u.RestErrWithLog(w, r, l,
+			errors.Errorf("too many device IDs: the limit is %d", devicesBatchMax),
+			http.StatusBadRequest,
+		)
+		return
+	} else if err := i.checkBulkDeviceIDs(len(deviceIDs)); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	} else if err := checkEmptyDeviceIDs(deviceIDs); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
 
-	err := i.inventory.DeleteDevice(ctx, model.DeviceID(deviceID))
-	if err != nil && err != store.ErrDevNotFound {
+	devices, err := i.inventory.GetDevicesByIDs(ctx, deviceIDs)
+	if err != nil {
 		u.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	_ = writeResponse(w, r, devices)
 }
 
-func (i *inventoryHandlers) AddDeviceHandler(w rest.ResponseWriter, r *rest.Request) {
+func (i *inventoryHandlers) GetOnboardingStatsHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
 	ctx := r.Context()
-	tenantId := r.PathParam("tenant_id")
-	if tenantId != "" {
-		id := &midentity.Identity{
-			Tenant: tenantId,
-		}
-		ctx = midentity.WithContext(ctx, id)
-	}
 
 	l := log.FromContext(ctx)
 
-	dev, err := parseDevice(r)
-	if err != nil {
-		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+	var params model.OnboardingStatsParams
+	if err := r.DecodeJsonPayload(&params); err != nil {
+		u.RestErrWithLog(w, r, l,
+			errors.Wrap(err, "failed to decode request body"),
+			http.StatusBadRequest)
 		return
 	}
-
-	err = dev.Attributes.Validate()
-	if err != nil {
+	if err := params.Validate(); err != nil {
 		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
 
-	err = i.inventory.AddDevice(ctx, dev)
+	stats, err := i.inventory.GetOnboardingStats(ctx, params)
 	if err != nil {
 		u.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
 
-	w.Header().Add("Location", "devices/"+dev.ID.String())
-	w.WriteHeader(http.StatusCreated)
+	_ = w.WriteJson(stats)
 }
 
-func (i *inventoryHandlers) UpdateDeviceAttributesHandler(w rest.ResponseWriter, r *rest.Request) {
+// GetAlertsSummaryHandler returns the number of devices with and without
+// alerts, as reported by the devicemonitor service
+func (i *inventoryHandlers) GetAlertsSummaryHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
 	ctx := r.Context()
+
 	l := log.FromContext(ctx)
-	var idata *identity.Identity
-	if idata = identity.FromContext(ctx); idata == nil || !idata.IsDevice {
-		u.RestErrWithLog(w, r, l, errors.New("unauthorized"), http.StatusUnauthorized)
-		return
+
+	scope, ok := i.config.ReindexServiceScopes["devicemonitor"]
+	if !ok {
+		scope = model.AttrScopeMonitor
 	}
-	deviceID := model.DeviceID(idata.Subject)
-	//extract attributes from body
-	attrs, err := parseAttributes(r)
+	summary, err := i.inventory.GetAlertsSummary(ctx, scope)
 	if err != nil {
-		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		u.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
-	i.updateDeviceAttributes(w, r, ctx, attrs, deviceID, model.AttrScopeInventory, "")
+
+	_ = w.WriteJson(summary)
 }
 
-func (i *inventoryHandlers) UpdateDeviceTagsHandler(w rest.ResponseWriter, r *rest.Request) {
+// GetDevicesByAnyTagHandler returns the devices having at least one of the
+// tags listed in the request body
+func (i *inventoryHandlers) GetDevicesByAnyTagHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
+
 	l := log.FromContext(ctx)
 
-	// get device ID from uri
-	deviceID := model.DeviceID(r.PathParam("id"))
-	if len(deviceID) < 1 {
-		u.RestErrWithLog(w, r, l, errors.New("device id cannot be empty"), http.StatusBadRequest)
+	page, perPage, err := utils.ParsePagination(r)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
 
-	ifMatchHeader := r.Header.Get("If-Match")
-
-	// extract attributes from body
-	attrs, err := parseAttributes(r)
+	var tags []string
+	if err := r.DecodeJsonPayload(&tags); err != nil {
+		u.RestErrWithLog(w, r, l,
+			errors.Wrap(err, "failed to decode request body"),
+			http.StatusBadRequest)
+		return
+	}
+	err = validation.Validate(tags,
+		validation.Required,
+		validation.Each(validation.Required, validation.Length(1, 1024)),
+	)
 	if err != nil {
 		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
 
-	// set scope and timestamp for tags attributes
-	now := time.Now()
-	for i := range attrs {
-		attrs[i].Scope = model.AttrScopeTags
-		if attrs[i].Timestamp == nil {
-			attrs[i].Timestamp = &now
-		}
+	ld := store.ListQuery{
+		Skip:    int((page - 1) * perPage),
+		Limit:   int(perPage),
+		AnyTags: tags,
 	}
 
-	i.updateDeviceAttributes(w, r, ctx, attrs, deviceID, model.AttrScopeTags, ifMatchHeader)
+	devs, totalCount, err := i.inventory.ListDevices(ctx, ld)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	hasNext := totalCount > int(page*perPage)
+	i.addPageLinks(w, r, page, perPage, hasNext)
+	w.Header().Add(hdrTotalCount, strconv.Itoa(totalCount))
+	_ = w.WriteJson(devs)
 }
 
-func (i *inventoryHandlers) updateDeviceAttributes(
-	w rest.ResponseWriter,
-	r *rest.Request,
-	ctx context.Context,
-	attrs model.DeviceAttributes,
-	deviceID model.DeviceID,
-	scope string,
-	etag string,
-) {
+func (i *inventoryHandlers) GetDeviceHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
 	l := log.FromContext(ctx)
-	var err error
 
-	// upsert or replace the attributes
-	if r.Method == http.MethodPatch {
-		err = i.inventory.UpsertAttributesWithUpdated(ctx, deviceID, attrs, scope, etag)
-	} else if r.Method == http.MethodPut {
-		err = i.inventory.ReplaceAttributes(ctx, deviceID, attrs, scope, etag)
-	} else {
-		u.RestErrWithLog(w, r, l, errors.New("method not alllowed"), http.StatusMethodNotAllowed)
+	deviceID := r.PathParam("id")
+
+	dev, err := i.inventory.GetDevice(ctx, model.DeviceID(deviceID))
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
-
-	cause := errors.Cause(err)
-	switch cause {
-	case store.ErrNoAttrName:
-	case inventory.ErrTooManyAttributes:
-		u.RestErrWithLog(w, r, l, cause, http.StatusBadRequest)
+	if dev == nil {
+		u.RestErrWithLog(w, r, l, store.ErrDevNotFound, http.StatusNotFound)
 		return
-	case inventory.ErrETagDoesntMatch:
-		u.RestErrWithInfoMsg(w, r, l, cause, http.StatusPreconditionFailed, cause.Error())
+	}
+	if dev.TagsEtag != "" {
+		w.Header().Set("ETag", dev.TagsEtag)
+	}
+
+	_ = writeResponse(w, r, dev)
+}
+
+// GetDeviceAttributesHandler returns a page of the device's attributes
+// sorted by scope and name
+func (i *inventoryHandlers) GetDeviceAttributesHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	page, perPage, err := utils.ParsePagination(r)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
+
+	deviceID := r.PathParam("id")
+
+	dev, err := i.inventory.GetDevice(ctx, model.DeviceID(deviceID))
 	if err != nil {
 		u.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
+	if dev == nil {
+		u.RestErrWithLog(w, r, l, store.ErrDevNotFound, http.StatusNotFound)
+		return
+	}
 
-	w.WriteHeader(http.StatusOK)
+	attrs := make(model.DeviceAttributes, len(dev.Attributes))
+	copy(attrs, dev.Attributes)
+	sort.SliceStable(attrs, func(a, b int) bool {
+		if attrs[a].Scope != attrs[b].Scope {
+			return attrs[a].Scope < attrs[b].Scope
+		}
+		return attrs[a].Name < attrs[b].Name
+	})
+
+	totalCount := len(attrs)
+	start := int((page - 1) * perPage)
+	if start > totalCount {
+		start = totalCount
+	}
+	end := start + int(perPage)
+	if end > totalCount {
+		end = totalCount
+	}
+
+	hasNext := totalCount > end
+	i.addPageLinks(w, r, page, perPage, hasNext)
+	w.Header().Add(hdrTotalCount, strconv.Itoa(totalCount))
+	_ = w.WriteJson(attrs[start:end])
 }
 
-func (i *inventoryHandlers) PatchDeviceAttributesInternalHandler(
-	w rest.ResponseWriter,
-	r *rest.Request,
-) {
+// GetStaleDevicesHandler returns a page of the devices which were not
+// updated within the `older_than` duration, sorted oldest-first
+func (i *inventoryHandlers) GetStaleDevicesHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
-	tenantId := r.PathParam("tenant_id")
-	ctx = getTenantContext(ctx, tenantId)
 
 	l := log.FromContext(ctx)
 
-	deviceId := r.PathParam("device_id")
-	if len(deviceId) < 1 {
-		u.RestErrWithLog(w, r, l, errors.New("device id cannot be empty"), http.StatusBadRequest)
+	page, perPage, err := utils.ParsePagination(r)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
-	//extract attributes from body
-	attrs, err := parseAttributes(r)
+
+	olderThanStr, err := utils.ParseQueryParmStr(r, queryParamOlderThan, true, nil)
 	if err != nil {
 		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
-	for i := range attrs {
-		attrs[i].Scope = r.PathParam("scope")
-		if attrs[i].Name == checkInTimeParamName && attrs[i].Scope == checkInTimeParamScope {
-			t, err := time.Parse(time.RFC3339, fmt.Sprintf("%v", attrs[i].Value))
-			if err != nil {
-				u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
-				return
-			}
-			attrs[i].Value = t
-		}
+	olderThan, err := time.ParseDuration(olderThanStr)
+	if err != nil || olderThan <= 0 {
+		u.RestErrWithLog(w, r, l,
+			errors.New(utils.MsgQueryParmInvalid(queryParamOlderThan)),
+			http.StatusBadRequest)
+		return
 	}
 
-	//upsert the attributes
-	err = i.inventory.UpsertAttributes(ctx, model.DeviceID(deviceId), attrs)
-	cause := errors.Cause(err)
-	switch cause {
-	case store.ErrNoAttrName:
-		u.RestErrWithLog(w, r, l, cause, http.StatusBadRequest)
-		return
+	searchParams := model.SearchParams{
+		Page:    int(page),
+		PerPage: int(perPage),
+		Filters: []model.FilterPredicate{{
+			Scope:     model.AttrScopeSystem,
+			Attribute: model.AttrNameUpdated,
+			Type:      "$lt",
+			Value:     time.Now().Add(-olderThan),
+		}},
+		Sort: []model.SortCriteria{{
+			Scope:     model.AttrScopeSystem,
+			Attribute: model.AttrNameUpdated,
+			Order:     sortOrderAsc,
+		}},
 	}
+
+	devs, totalCount, err := i.inventory.SearchDevices(ctx, searchParams)
 	if err != nil {
 		u.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	hasNext := totalCount > int(page*perPage)
+	i.addPageLinks(w, r, page, perPage, hasNext)
+	w.Header().Add(hdrTotalCount, strconv.Itoa(totalCount))
+	_ = w.WriteJson(devs)
 }
 
-func (i *inventoryHandlers) DeleteDeviceGroupHandler(w rest.ResponseWriter, r *rest.Request) {
+func (i *inventoryHandlers) DeleteDeviceInventoryHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 
 	l := log.FromContext(ctx)
 
 	deviceID := r.PathParam("id")
-	groupName := r.PathParam("name")
 
-	err := i.inventory.UnsetDeviceGroup(ctx, model.DeviceID(deviceID), model.GroupName(groupName))
-	if err != nil {
-		cause := errors.Cause(err)
-		if cause != nil {
-			if cause.Error() == store.ErrDevNotFound.Error() {
-				u.RestErrWithLog(w, r, l, err, http.StatusNotFound)
-				return
-			}
-		}
+	err := i.inventory.ReplaceAttributes(ctx, model.DeviceID(deviceID),
+		model.DeviceAttributes{}, model.AttrScopeInventory, "")
+	if err != nil && errors.Cause(err) != store.ErrDevNotFound {
 		u.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
@@ -651,535 +1305,2487 @@ func (i *inventoryHandlers) DeleteDeviceGroupHandler(w rest.ResponseWriter, r *r
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (i *inventoryHandlers) AddDeviceToGroupHandler(w rest.ResponseWriter, r *rest.Request) {
+func (i *inventoryHandlers) DeleteDeviceHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
+	tenantId := r.PathParam("tenant_id")
+	if tenantId != "" {
+		id := &midentity.Identity{
+			Tenant: tenantId,
+		}
+		ctx = midentity.WithContext(ctx, id)
+	}
 
 	l := log.FromContext(ctx)
 
-	devId := r.PathParam("id")
-
-	var group InventoryApiGroup
-	err := r.DecodeJsonPayload(&group)
-	if err != nil {
-		u.RestErrWithLog(
-			w, r, l, errors.Wrap(err, "failed to decode device group data"),
-			http.StatusBadRequest)
-		return
-	}
-
-	if err = group.Validate(); err != nil {
-		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
-		return
-	}
+	deviceID := r.PathParam("device_id")
 
-	err = i.inventory.UpdateDeviceGroup(ctx, model.DeviceID(devId), model.GroupName(group.Group))
-	if err != nil {
-		if cause := errors.Cause(err); cause != nil && cause == store.ErrDevNotFound {
-			u.RestErrWithLog(w, r, l, err, http.StatusNotFound)
-			return
-		}
+	err := i.inventory.DeleteDevice(ctx, model.DeviceID(deviceID))
+	if err != nil && errors.Cause(err) != store.ErrDevNotFound {
 		u.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (i *inventoryHandlers) GetDevicesByGroupHandler(w rest.ResponseWriter, r *rest.Request) {
+func (i *inventoryHandlers) AddDeviceHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
+	tenantId := r.PathParam("tenant_id")
+	if tenantId != "" {
+		id := &midentity.Identity{
+			Tenant: tenantId,
+		}
+		ctx = midentity.WithContext(ctx, id)
+	}
 
 	l := log.FromContext(ctx)
 
-	group := r.PathParam("name")
+	fresh, err := utils.ParseQueryParmBool(r, queryParamFresh, false, nil)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
 
-	page, perPage, err := utils.ParsePagination(r)
+	dev, err := parseDevice(r, i.config.AddDeviceRejectUnknownFields)
 	if err != nil {
 		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
+	resolveAttributesScope(i.config.ScopeAliases, dev.Attributes)
 
-	//get one extra device to see if there's a 'next' page
-	ids, totalCount, err := i.inventory.ListDevicesByGroup(
-		ctx,
-		model.GroupName(group),
-		int((page-1)*perPage),
-		int(perPage),
-	)
+	err = dev.Attributes.Validate()
 	if err != nil {
-		if err == store.ErrGroupNotFound {
-			u.RestErrWithLog(w, r, l, err, http.StatusNotFound)
-		} else {
-			u.RestErrWithLogInternal(w, r, l, err)
-		}
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
 
-	hasNext := totalCount > int(page*perPage)
+	createOnly, err := i.featureEnabled(ctx,
+		model.FeatureAddDeviceCreateOnly, i.config.AddDeviceCreateOnly)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
 
-	links := utils.MakePageLinkHdrs(r, page, perPage, hasNext)
-	for _, l := range links {
-		w.Header().Add("Link", l)
+	l.Debugf("adding device %s: %s", dev.ID, i.redactor.Format(dev.Attributes))
+	switch {
+	case createOnly:
+		err = i.inventory.CreateDevice(ctx, dev)
+	case fresh != nil && *fresh:
+		err = i.inventory.ReplaceDevice(ctx, dev)
+	default:
+		err = i.inventory.AddDevice(ctx, dev)
 	}
-	// the response writer will ensure the header name is in Kebab-Pascal-Case
-	w.Header().Add(hdrTotalCount, strconv.Itoa(totalCount))
-	_ = w.WriteJson(ids)
+	if errors.Cause(err) == store.ErrDevExists {
+		u.RestErrWithLog(w, r, l, store.ErrDevExists, http.StatusConflict)
+		return
+	} else if errors.Cause(err) == store.ErrAttributeTypeConflict {
+		u.RestErrWithLog(w, r, l, err, http.StatusUnprocessableEntity)
+		return
+	} else if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	w.Header().Add("Location", i.deviceLocation(dev.ID))
+	w.WriteHeader(http.StatusCreated)
 }
 
-func (i *inventoryHandlers) AppendDevicesToGroup(w rest.ResponseWriter, r *rest.Request) {
-	var deviceIDs []model.DeviceID
+// deviceLocation returns the Location header of the created device
+func (i *inventoryHandlers) deviceLocation(id model.DeviceID) string {
+	location := "devices/" + id.String()
+	if base := i.config.AddDeviceLocationBaseURL; base != "" {
+		location = strings.TrimSuffix(base, "/") + "/" + location
+	}
+	return location
+}
+
+func (i *inventoryHandlers) UpdateDeviceAttributesHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 	l := log.FromContext(ctx)
-	groupName := model.GroupName(r.PathParam("name"))
-	if err := groupName.Validate(); err != nil {
-		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+	var idata *identity.Identity
+	if idata = identity.FromContext(ctx); idata == nil || !idata.IsDevice {
+		u.RestErrWithLog(w, r, l, errors.New("unauthorized"), http.StatusUnauthorized)
 		return
 	}
-
-	if err := r.DecodeJsonPayload(&deviceIDs); err != nil {
-		u.RestErrWithLog(w, r, l,
-			errors.Wrap(err, "invalid payload schema"),
-			http.StatusBadRequest,
-		)
-		return
-	} else if len(deviceIDs) == 0 {
-		u.RestErrWithLog(w, r, l,
-			errors.New("no device IDs present in payload"),
-			http.StatusBadRequest,
-		)
+	deviceID := model.DeviceID(idata.Subject)
+	//extract attributes from body
+	nullRemoves, err := i.featureEnabled(ctx,
+		model.FeatureNullAttributeValueRemoves, i.config.NullAttributeValueRemoves)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
-	updated, err := i.inventory.UpdateDevicesGroup(
-		ctx, deviceIDs, groupName,
-	)
+	attrs, err := parseAttributes(r, i.config.ScopeAliases, nullRemoves)
 	if err != nil {
-		u.RestErrWithLogInternal(w, r, l, err)
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
-	_ = w.WriteJson(updated)
+	i.updateDeviceAttributes(w, r, ctx, attrs, deviceID, model.AttrScopeInventory, "")
 }
 
-func (i *inventoryHandlers) DeleteGroupHandler(w rest.ResponseWriter, r *rest.Request) {
+func (i *inventoryHandlers) UpdateDeviceTagsHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 	l := log.FromContext(ctx)
 
-	groupName := model.GroupName(r.PathParam("name"))
-	if err := groupName.Validate(); err != nil {
-		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+	// get device ID from uri
+	deviceID := model.DeviceID(r.PathParam("id"))
+	if len(deviceID) < 1 {
+		u.RestErrWithLog(w, r, l, errors.New("device id cannot be empty"), http.StatusBadRequest)
 		return
 	}
 
-	updated, err := i.inventory.DeleteGroup(ctx, groupName)
+	ifMatchHeader := r.Header.Get("If-Match")
+
+	// extract attributes from body
+	nullRemoves, err := i.featureEnabled(ctx,
+		model.FeatureNullAttributeValueRemoves, i.config.NullAttributeValueRemoves)
 	if err != nil {
 		u.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	_ = w.WriteJson(updated)
-}
-
-func (i *inventoryHandlers) ClearDevicesGroupHandler(w rest.ResponseWriter, r *rest.Request) {
-	var deviceIDs []model.DeviceID
-	ctx := r.Context()
-	l := log.FromContext(ctx)
-
-	groupName := model.GroupName(r.PathParam("name"))
-	if err := groupName.Validate(); err != nil {
+	attrs, err := parseAttributes(r, i.config.ScopeAliases, nullRemoves)
+	if err != nil {
 		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
 
-	if err := r.DecodeJsonPayload(&deviceIDs); err != nil {
-		u.RestErrWithLog(w, r, l,
+	// set scope and timestamp for tags attributes
+	now := time.Now()
+	for i := range attrs {
+		attrs[i].Scope = model.AttrScopeTags
+		if attrs[i].Timestamp == nil {
+			attrs[i].Timestamp = &now
+		}
+	}
+
+	i.updateDeviceAttributes(w, r, ctx, attrs, deviceID, model.AttrScopeTags, ifMatchHeader)
+}
+
+func (i *inventoryHandlers) updateDeviceAttributes(
+	w rest.ResponseWriter,
+	r *rest.Request,
+	ctx context.Context,
+	attrs model.DeviceAttributes,
+	deviceID model.DeviceID,
+	scope string,
+	etag string,
+) {
+	l := log.FromContext(ctx)
+	var err error
+
+	if err = i.checkScopesWritable(scope, attrs); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusForbidden)
+		return
+	}
+
+	l.Debugf("updating the attributes of device %s: %s",
+		deviceID, i.redactor.Format(attrs))
+
+	// upsert or replace the attributes
+	if r.Method == http.MethodPatch {
+		err = i.inventory.UpsertAttributesWithUpdated(ctx, deviceID, attrs, scope, etag)
+	} else if r.Method == http.MethodPut {
+		err = i.inventory.ReplaceAttributes(ctx, deviceID, attrs, scope, etag)
+	} else {
+		u.RestErrWithLog(w, r, l, errors.New("method not alllowed"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	cause := errors.Cause(err)
+	switch cause {
+	case store.ErrNoAttrName:
+	case inventory.ErrTooManyAttributes:
+		u.RestErrWithLog(w, r, l, cause, http.StatusBadRequest)
+		return
+	case inventory.ErrETagDoesntMatch:
+		u.RestErrWithInfoMsg(w, r, l, cause, http.StatusPreconditionFailed, cause.Error())
+		return
+	case store.ErrAttributeTypeConflict:
+		u.RestErrWithLog(w, r, l, err, http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// groupName returns the group name of the request, trimmed of the leading
+// and trailing whitespace if configured
+func (i *inventoryHandlers) groupName(name string) model.GroupName {
+	if i.config.TrimGroupNames {
+		name = strings.TrimSpace(name)
+	}
+	return model.GroupName(name)
+}
+
+// pathGroupName returns the group name of the request path, see groupName;
+// the path parameters are not unescaped by the router, so the whitespace
+// is unescaped before being trimmed
+func (i *inventoryHandlers) pathGroupName(r *rest.Request) model.GroupName {
+	name := r.PathParam("name")
+	if i.config.TrimGroupNames {
+		if unescaped, err := url.PathUnescape(name); err == nil {
+			name = unescaped
+		}
+	}
+	return i.groupName(name)
+}
+
+// featureEnabled returns whether the feature is enabled for the tenant in
+// the context, or def if the tenant did not set the feature flag
+func (i *inventoryHandlers) featureEnabled(
+	ctx context.Context,
+	name string,
+	def bool,
+) (bool, error) {
+	flags, err := i.inventory.GetFeatureFlags(ctx)
+	if err != nil {
+		return false, err
+	}
+	return flags.Enabled(name, def), nil
+}
+
+// checkScopesWritable returns an error if the scope or any of the
+// attributes' scopes is protected from writes through the public APIs
+func (i *inventoryHandlers) checkScopesWritable(
+	scope string,
+	attrs model.DeviceAttributes,
+) error {
+	if utils.ContainsString(scope, i.config.ProtectedScopes) {
+		return errors.Errorf("attribute scope %s is read-only", scope)
+	}
+	for _, attr := range attrs {
+		if utils.ContainsString(attr.Scope, i.config.ProtectedScopes) {
+			return errors.Errorf("attribute scope %s is read-only", attr.Scope)
+		}
+	}
+	return nil
+}
+
+func (i *inventoryHandlers) PatchDeviceAttributesInternalHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	ctx := r.Context()
+	tenantId := r.PathParam("tenant_id")
+	ctx = getTenantContext(ctx, tenantId)
+
+	l := log.FromContext(ctx)
+
+	deviceId := r.PathParam("device_id")
+	if len(deviceId) < 1 {
+		u.RestErrWithLog(w, r, l, errors.New("device id cannot be empty"), http.StatusBadRequest)
+		return
+	}
+	//extract attributes from body
+	attrs, err := parseAttributes(r, i.config.ScopeAliases, false)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	scope := resolveScope(i.config.ScopeAliases, r.PathParam("scope"))
+	for i := range attrs {
+		attrs[i].Scope = scope
+		if attrs[i].Name == checkInTimeParamName && attrs[i].Scope == checkInTimeParamScope {
+			t, err := time.Parse(time.RFC3339, fmt.Sprintf("%v", attrs[i].Value))
+			if err != nil {
+				u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+				return
+			}
+			attrs[i].Value = t
+		}
+	}
+
+	//upsert the attributes
+	l.Debugf("updating the attributes of device %s: %s",
+		deviceId, i.redactor.Format(attrs))
+	err = i.inventory.UpsertAttributes(ctx, model.DeviceID(deviceId), attrs)
+	cause := errors.Cause(err)
+	switch cause {
+	case store.ErrNoAttrName:
+		u.RestErrWithLog(w, r, l, cause, http.StatusBadRequest)
+		return
+	case store.ErrAttributeTypeConflict:
+		u.RestErrWithLog(w, r, l, err, http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// ReplaceAllDeviceAttributesInternalHandler replaces the attributes of the
+// device in all the scopes but the system one, e.g. to resync the device
+// from a source of truth
+func (i *inventoryHandlers) ReplaceAllDeviceAttributesInternalHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	ctx := r.Context()
+	tenantId := r.PathParam("tenant_id")
+	ctx = getTenantContext(ctx, tenantId)
+
+	l := log.FromContext(ctx)
+
+	deviceId := r.PathParam("device_id")
+	if len(deviceId) < 1 {
+		u.RestErrWithLog(w, r, l, errors.New("device id cannot be empty"), http.StatusBadRequest)
+		return
+	}
+	attrs, err := parseAttributes(r, i.config.ScopeAliases, false)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	for _, attr := range attrs {
+		if attr.Scope == model.AttrScopeSystem {
+			u.RestErrWithLog(w, r, l,
+				errors.New("the attributes of the system scope cannot be replaced"),
+				http.StatusBadRequest)
+			return
+		}
+	}
+
+	l.Debugf("replacing all the attributes of device %s: %s",
+		deviceId, i.redactor.Format(attrs))
+	err = i.inventory.ReplaceAllAttributes(ctx, model.DeviceID(deviceId), attrs)
+	cause := errors.Cause(err)
+	switch cause {
+	case store.ErrDevNotFound:
+		u.RestErrWithLog(w, r, l, cause, http.StatusNotFound)
+		return
+	case store.ErrNoAttrName, inventory.ErrTooManyAttributes:
+		u.RestErrWithLog(w, r, l, cause, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ToggleDeviceAttributeInternalHandler flips the boolean attribute of the
+// device, or sets it to the default value from the request if absent
+func (i *inventoryHandlers) ToggleDeviceAttributeInternalHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	ctx := r.Context()
+	ctx = getTenantContext(ctx, r.PathParam("tenant_id"))
+
+	l := log.FromContext(ctx)
+
+	deviceId := r.PathParam("device_id")
+	scope := resolveScope(i.config.ScopeAliases, r.PathParam("scope"))
+	name := r.PathParam("name")
+	if scope == model.AttrScopeSystem {
+		u.RestErrWithLog(w, r, l,
+			errors.New("the attributes of the system scope cannot be toggled"),
+			http.StatusBadRequest)
+		return
+	}
+
+	var req InventoryApiToggleAttribute
+	err := r.DecodeJsonPayload(&req)
+	if err != nil && err != rest.ErrJsonPayloadEmpty {
+		u.RestErrWithLog(w, r, l,
+			errors.Wrap(err, "failed to decode request body"),
+			http.StatusBadRequest)
+		return
+	}
+
+	value, err := i.inventory.ToggleAttribute(
+		ctx, model.DeviceID(deviceId), scope, name, req.Default,
+	)
+	cause := errors.Cause(err)
+	switch cause {
+	case store.ErrDevNotFound:
+		u.RestErrWithLog(w, r, l, cause, http.StatusNotFound)
+		return
+	case store.ErrNoAttrName:
+		u.RestErrWithLog(w, r, l, cause, http.StatusBadRequest)
+		return
+	case store.ErrAttributeTypeConflict:
+		u.RestErrWithLog(w, r, l, err, http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	_ = w.WriteJson(model.DeviceAttribute{
+		Scope: scope,
+		Name:  name,
+		Value: value,
+	})
+}
+
+// MoveDeviceAttributesInternalHandler moves all the attributes of the
+// device from one scope to another, e.g. when a service takes over the
+// attributes reported by another one
+func (i *inventoryHandlers) MoveDeviceAttributesInternalHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	ctx := r.Context()
+	ctx = getTenantContext(ctx, r.PathParam("tenant_id"))
+
+	l := log.FromContext(ctx)
+
+	var req InventoryApiMoveAttributes
+	if err := r.DecodeJsonPayload(&req); err != nil {
+		u.RestErrWithLog(w, r, l,
+			errors.Wrap(err, "failed to decode request body"),
+			http.StatusBadRequest)
+		return
+	}
+	req.From = resolveScope(i.config.ScopeAliases, req.From)
+	req.To = resolveScope(i.config.ScopeAliases, req.To)
+	if req.Policy == "" {
+		req.Policy = model.MergePolicyOverwrite
+	}
+	if err := req.Validate(); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	err := i.inventory.MoveAttributesBetweenScopes(ctx,
+		model.DeviceID(r.PathParam("device_id")), req.From, req.To, req.Policy)
+	if cause := errors.Cause(err); cause == store.ErrDevNotFound {
+		u.RestErrWithLog(w, r, l, cause, http.StatusNotFound)
+		return
+	} else if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetDevicesWithStaleScopeInternalHandler returns the devices whose
+// attributes of the scope were not updated within the `older_than`
+// duration, e.g. to find the devices where a reporting service stopped
+func (i *inventoryHandlers) GetDevicesWithStaleScopeInternalHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	ctx := r.Context()
+	ctx = getTenantContext(ctx, r.PathParam("tenant_id"))
+
+	l := log.FromContext(ctx)
+
+	scope := resolveScope(i.config.ScopeAliases, r.PathParam("scope"))
+	olderThanStr, err := utils.ParseQueryParmStr(r, queryParamOlderThan, true, nil)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	olderThan, err := time.ParseDuration(olderThanStr)
+	if err != nil || olderThan <= 0 {
+		u.RestErrWithLog(w, r, l,
+			errors.New(utils.MsgQueryParmInvalid(queryParamOlderThan)),
+			http.StatusBadRequest)
+		return
+	}
+
+	devices, err := i.inventory.GetDevicesWithStaleScope(ctx, scope, olderThan)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	_ = w.WriteJson(devices)
+}
+
+// GetDevicesUpdatedByScopeSinceInternalHandler returns the devices whose
+// attributes of the scope were updated after the `since` time, e.g. to sync
+// an integration with the writes of a single reporting service
+func (i *inventoryHandlers) GetDevicesUpdatedByScopeSinceInternalHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	ctx := r.Context()
+	ctx = getTenantContext(ctx, r.PathParam("tenant_id"))
+
+	l := log.FromContext(ctx)
+
+	scope := resolveScope(i.config.ScopeAliases, r.PathParam("scope"))
+	sinceStr, err := utils.ParseQueryParmStr(r, queryParamSince, true, nil)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	since, err := time.Parse(time.RFC3339, sinceStr)
+	if err != nil {
+		u.RestErrWithLog(w, r, l,
+			errors.New(utils.MsgQueryParmInvalid(queryParamSince)),
+			http.StatusBadRequest)
+		return
+	}
+
+	devices, err := i.inventory.GetDevicesUpdatedByScopeSince(ctx, scope, since)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	_ = w.WriteJson(devices)
+}
+
+func (i *inventoryHandlers) DeleteDeviceGroupHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	deviceID := r.PathParam("id")
+	groupName := i.pathGroupName(r)
+
+	err := i.inventory.UnsetDeviceGroup(ctx, model.DeviceID(deviceID), groupName)
+	if err != nil {
+		cause := errors.Cause(err)
+		if cause != nil {
+			if cause.Error() == store.ErrDevNotFound.Error() {
+				u.RestErrWithLog(w, r, l, err, http.StatusNotFound)
+				return
+			}
+		}
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (i *inventoryHandlers) AddDeviceToGroupHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	devId := r.PathParam("id")
+
+	var group InventoryApiGroup
+	err := r.DecodeJsonPayload(&group)
+	if err != nil {
+		u.RestErrWithLog(
+			w, r, l, errors.Wrap(err, "failed to decode device group data"),
+			http.StatusBadRequest)
+		return
+	}
+
+	group.Group = i.groupName(string(group.Group))
+	if err = group.Validate(); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	err = i.inventory.UpdateDeviceGroup(ctx, model.DeviceID(devId), group.Group)
+	if err != nil {
+		if cause := errors.Cause(err); cause != nil && cause == store.ErrDevNotFound {
+			u.RestErrWithLog(w, r, l, err, http.StatusNotFound)
+			return
+		}
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (i *inventoryHandlers) GetDevicesByGroupHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	group := i.pathGroupName(r)
+
+	page, perPage, err := utils.ParsePagination(r)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	attributes := parseSelectAttributes(r, i.config.ScopeAliases, i.config.DefaultFilterScope)
+
+	// the devices are listed with the selected attributes, their IDs
+	// otherwise
+	var (
+		res        interface{}
+		totalCount int
+	)
+	if len(attributes) > 0 {
+		var devices []model.Device
+		devices, totalCount, err = i.inventory.ListDevicesByGroupWithAttributes(
+			ctx,
+			group,
+			int((page-1)*perPage),
+			int(perPage),
+			attributes,
+		)
+		res = devices
+	} else {
+		var ids []model.DeviceID
+		ids, totalCount, err = i.inventory.ListDevicesByGroup(
+			ctx,
+			group,
+			int((page-1)*perPage),
+			int(perPage),
+		)
+		res = ids
+	}
+	if err != nil {
+		if errors.Cause(err) == store.ErrGroupNotFound {
+			u.RestErrWithLog(w, r, l, err, http.StatusNotFound)
+		} else {
+			u.RestErrWithLogInternal(w, r, l, err)
+		}
+		return
+	}
+
+	hasNext := totalCount > int(page*perPage)
+
+	i.addPageLinks(w, r, page, perPage, hasNext)
+	// the response writer will ensure the header name is in Kebab-Pascal-Case
+	w.Header().Add(hdrTotalCount, strconv.Itoa(totalCount))
+	_ = w.WriteJson(res)
+}
+
+func (i *inventoryHandlers) AppendDevicesToGroup(w rest.ResponseWriter, r *rest.Request) {
+	var deviceIDs []model.DeviceID
+	ctx := r.Context()
+	l := log.FromContext(ctx)
+	groupName := i.pathGroupName(r)
+	if err := groupName.Validate(); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := r.DecodeJsonPayload(&deviceIDs); err != nil {
+		u.RestErrWithLog(w, r, l,
+			errors.Wrap(err, "invalid payload schema"),
+			http.StatusBadRequest,
+		)
+		return
+	} else if len(deviceIDs) == 0 {
+		u.RestErrWithLog(w, r, l,
+			errors.New("no device IDs present in payload"),
+			http.StatusBadRequest,
+		)
+		return
+	} else if err := i.checkBulkDeviceIDs(len(deviceIDs)); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	} else if err := checkEmptyDeviceIDs(deviceIDs); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	updated, err := i.inventory.UpdateDevicesGroup(
+		ctx, deviceIDs, groupName,
+	)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+	_ = w.WriteJson(updated)
+}
+
+func (i *inventoryHandlers) DeleteGroupHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := log.FromContext(ctx)
+
+	groupName := i.pathGroupName(r)
+	if err := groupName.Validate(); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	updated, err := i.inventory.DeleteGroup(ctx, groupName)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_ = w.WriteJson(updated)
+}
+
+func (i *inventoryHandlers) ClearDevicesGroupHandler(w rest.ResponseWriter, r *rest.Request) {
+	var deviceIDs []model.DeviceID
+	ctx := r.Context()
+	l := log.FromContext(ctx)
+
+	groupName := i.pathGroupName(r)
+	if err := groupName.Validate(); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := r.DecodeJsonPayload(&deviceIDs); err != nil {
+		u.RestErrWithLog(w, r, l,
 			errors.Wrap(err, "invalid payload schema"),
 			http.StatusBadRequest,
 		)
 		return
-	} else if len(deviceIDs) == 0 {
+	} else if len(deviceIDs) == 0 {
+		u.RestErrWithLog(w, r, l,
+			errors.New("no device IDs present in payload"),
+			http.StatusBadRequest,
+		)
+		return
+	} else if err := i.checkBulkDeviceIDs(len(deviceIDs)); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	} else if err := checkEmptyDeviceIDs(deviceIDs); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	dryRun, err := utils.ParseQueryParmBool(r, queryParamDryRun, false, nil)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	var updated *model.UpdateResult
+	if dryRun != nil && *dryRun {
+		updated, err = i.inventory.UnsetDevicesGroupDryRun(ctx, deviceIDs, groupName)
+	} else {
+		updated, err = i.inventory.UnsetDevicesGroup(ctx, deviceIDs, groupName)
+	}
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_ = w.WriteJson(updated)
+}
+
+// acceptsMsgpack returns true if the client prefers a MessagePack
+// response over a JSON one in the Accept header; the most specific media
+// range matching JSON decides its quality, and ties are won by MessagePack
+func acceptsMsgpack(r *rest.Request) bool {
+	msgpackQ := 0.0
+	jsonQ := map[string]float64{}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(accept)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case contentTypeMsgpack, contentTypeXMsgpack:
+			if q > msgpackQ {
+				msgpackQ = q
+			}
+		case "application/json", "application/*", "*/*":
+			jsonQ[mediaType] = q
+		}
+	}
+	if msgpackQ <= 0 {
+		return false
+	}
+	for _, mediaType := range []string{"application/json", "application/*", "*/*"} {
+		if q, ok := jsonQ[mediaType]; ok {
+			return msgpackQ >= q
+		}
+	}
+	return true
+}
+
+// writeResponse writes v MessagePack encoded if the client accepts it,
+// and JSON encoded otherwise
+func writeResponse(w rest.ResponseWriter, r *rest.Request, v interface{}) error {
+	if !acceptsMsgpack(r) {
+		return w.WriteJson(v)
+	}
+	// encode the JSON representation of v, so that both encodings carry
+	// the same fields, including those added by custom JSON marshalers
+	j, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(j, &doc); err != nil {
+		return err
+	}
+	var b []byte
+	if err := codec.NewEncoderBytes(&b, msgpackHandle).Encode(doc); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", contentTypeMsgpack)
+	w.WriteHeader(http.StatusOK)
+	_, err = w.(http.ResponseWriter).Write(b)
+	return err
+}
+
+// limitPageSize returns the longest leading part of the page of devices,
+// of at least one device, whose JSON encoding fits the maximum response
+// size; the X-Page-Reduced header is set to its length if the page was
+// reduced
+func (i *inventoryHandlers) limitPageSize(
+	w rest.ResponseWriter,
+	devs []model.Device,
+) []model.Device {
+	if i.config.MaxResponseBytes <= 0 {
+		return devs
+	}
+	// the size of the enclosing brackets and the separating commas
+	size := 1
+	for n, dev := range devs {
+		b, err := json.Marshal(dev)
+		if err != nil {
+			return devs
+		}
+		size += len(b) + 1
+		if size > i.config.MaxResponseBytes && n > 0 {
+			w.Header().Set(hdrPageReduced, strconv.Itoa(n))
+			return devs[:n]
+		}
+	}
+	return devs
+}
+
+// makeResultETag returns the entity tag of a page of devices, which
+// changes whenever a device of the page is added, removed or updated
+func makeResultETag(devs []model.Device) string {
+	h := sha256.New()
+	for _, dev := range devs {
+		var updated string
+		if dev.UpdatedTs != nil {
+			updated = dev.UpdatedTs.UTC().Format(time.RFC3339Nano)
+		}
+		fmt.Fprintf(h, "%s\x00%s\x00", dev.ID, updated)
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
+
+// checkBulkDeviceIDs returns an error if a bulk operation on count
+// devices exceeds the configured limit
+func (i *inventoryHandlers) checkBulkDeviceIDs(count int) error {
+	limit := i.config.MaxBulkDeviceIDs
+	if limit > 0 && count > limit {
+		return errors.Errorf("too many device IDs: the limit is %d", limit)
+	}
+	return nil
+}
+
+// addPageLinks adds the Link headers of the page to the response, leaving
+// out the prev and next links past the configured maximum linked page
+func (i *inventoryHandlers) addPageLinks(
+	w rest.ResponseWriter,
+	r *rest.Request,
+	page, perPage uint64,
+	hasNext bool,
+) {
+	var maxPage uint64
+	if i.config.MaxLinkPage > 0 {
+		maxPage = uint64(i.config.MaxLinkPage)
+	}
+	links := utils.MakePageLinkHdrsCapped(r, page, perPage, hasNext, maxPage)
+	for _, l := range links {
+		w.Header().Add("Link", l)
+	}
+	if maxPage > 0 && ((hasNext && page+1 > maxPage) || (page > 1 && page-1 > maxPage)) {
+		w.Header().Set(hdrPageLinksCapped, strconv.FormatUint(maxPage, 10))
+	}
+}
+
+// addDevicesPageLinks limits the size of the page of devices and adds
+// its Link headers to the response. If the page is reduced, the next link
+// points to the page starting right after the last returned device, with
+// the largest page size up to the number of returned devices which makes
+// it start there, so that following it skips no device.
+func (i *inventoryHandlers) addDevicesPageLinks(
+	w rest.ResponseWriter,
+	r *rest.Request,
+	page, perPage uint64,
+	hasNext bool,
+	devs []model.Device,
+) []model.Device {
+	returned := len(devs)
+	devs = i.limitPageSize(w, devs)
+	if len(devs) == returned {
+		i.addPageLinks(w, r, page, perPage, hasNext)
+		return devs
+	}
+
+	i.addPageLinks(w, r, page, perPage, false)
+	offset := (page-1)*perPage + uint64(len(devs))
+	nextPerPage := uint64(len(devs))
+	for offset%nextPerPage != 0 {
+		nextPerPage--
+	}
+	nextPage := offset/nextPerPage + 1
+	if i.config.MaxLinkPage > 0 && nextPage > uint64(i.config.MaxLinkPage) {
+		w.Header().Set(hdrPageLinksCapped, strconv.Itoa(i.config.MaxLinkPage))
+		return devs
+	}
+	pathitems := strings.Split(r.URL.Path, "/")
+	w.Header().Add("Link", utils.MakeLink(utils.LinkNext,
+		pathitems[len(pathitems)-1], r.URL.Query(), nextPage, nextPerPage))
+	return devs
+}
+
+// limitSearchCount caps the total count of the search to the configured
+// limit when the request tolerates an estimated count
+func (i *inventoryHandlers) limitSearchCount(searchParams *model.SearchParams) {
+	if searchParams.EstimateCount && i.config.SearchCountLimit > 0 {
+		searchParams.CountLimit = i.config.SearchCountLimit
+	}
+}
+
+// parseDefaultProjection returns the attributes of the configured default
+// projection given as <scope>/<name>
+func parseDefaultProjection(attributes []string) ([]model.SelectAttribute, error) {
+	var projection []model.SelectAttribute
+	for _, attr := range attributes {
+		scope, name, found := strings.Cut(attr, "/")
+		if !found || scope == "" || name == "" {
+			return nil, errors.Errorf(
+				"invalid default projection attribute %q: expected <scope>/<name>", attr)
+		}
+		projection = append(projection, model.SelectAttribute{
+			Scope:     scope,
+			Attribute: name,
+		})
+	}
+	return projection, nil
+}
+
+// projectAttributes returns the attributes which the devices of the
+// response are limited to: the selected ones if any, otherwise the default
+// projection unless the request asks for all the attributes
+func (i *inventoryHandlers) projectAttributes(
+	r *rest.Request,
+	selected []model.SelectAttribute,
+) ([]model.SelectAttribute, error) {
+	if len(selected) > 0 || len(i.defaultProjection) == 0 {
+		return selected, nil
+	}
+	all, err := utils.ParseQueryParmBool(r, queryParamAllAttributes, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	if all != nil && *all {
+		return nil, nil
+	}
+	return i.defaultProjection, nil
+}
+
+// checkEmptyDeviceIDs returns an error naming the position of the first
+// empty device ID of a bulk operation
+func checkEmptyDeviceIDs(ids []model.DeviceID) error {
+	for pos, id := range ids {
+		if id == "" {
+			return errors.Errorf("device ID at position %d is empty", pos)
+		}
+	}
+	return nil
+}
+
+// checkPageOffset returns an error if the page skips more devices than
+// maxOffset; zero means no limit
+func checkPageOffset(page, perPage, maxOffset int) error {
+	offset := (page - 1) * perPage
+	if maxOffset > 0 && offset > maxOffset {
+		return errors.Errorf(
+			"page offset %d exceeds the limit of %d: use keyset pagination "+
+				"instead, sorting the devices and filtering on the values "+
+				"past the last device of the previous page",
+			offset, maxOffset)
+	}
+	return nil
+}
+
+func parseDevice(r *rest.Request, strict bool) (*model.Device, error) {
+	var err error
+	dev := model.Device{}
+
+	//decode body
+	if strict {
+		// created_ts is part of the JSON representation of a device,
+		// accept it back but ignore it like the lenient decoding does
+		err = decodeJsonPayloadStrict(r, &struct {
+			*model.Device
+			CreatedTs interface{} `json:"created_ts"`
+		}{Device: &dev})
+	} else {
+		err = r.DecodeJsonPayload(&dev)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode request body")
+	}
+
+	if err := dev.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &dev, nil
+}
+
+// checkSearchTenant returns an error if the search requires a tenant and
+// the identity of the request lacks one
+func (i *inventoryHandlers) checkSearchTenant(ctx context.Context) error {
+	if !i.config.SearchRequireTenant {
+		return nil
+	}
+	if id := identity.FromContext(ctx); id == nil || id.Tenant == "" {
+		return errors.New("tenant required")
+	}
+	return nil
+}
+
+// checkFiltersIndexed returns an error naming the indexed attributes if
+// the search indexed filters only mode is enabled and any of the filters
+// is on an attribute which is not indexed
+func (i *inventoryHandlers) checkFiltersIndexed(filters []model.FilterPredicate) error {
+	if !i.config.SearchIndexedFiltersOnly {
+		return nil
+	}
+	indexed := append(
+		[]string{model.AttrScopeIdentity + "/" + model.AttrNameID},
+		i.config.IndexedAttributes...,
+	)
+	for _, filter := range filters {
+		key := filter.Scope + "/" + filter.Attribute
+		found := false
+		for _, attr := range indexed {
+			if attr == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.Errorf(
+				"attribute %s is not indexed; filter on an indexed attribute: %s",
+				key, strings.Join(indexed, ", "))
+		}
+	}
+	return nil
+}
+
+// resolveScope returns the canonical name of the scope if it is an alias
+func resolveScope(aliases map[string]string, scope string) string {
+	if canonical, ok := aliases[scope]; ok {
+		return canonical
+	}
+	return scope
+}
+
+func resolveAttributesScope(aliases map[string]string, attrs model.DeviceAttributes) {
+	for i := range attrs {
+		attrs[i].Scope = resolveScope(aliases, attrs[i].Scope)
+	}
+}
+
+// decodeJsonPayloadStrict works like rest.Request.DecodeJsonPayload but
+// rejects payloads containing unknown fields.
+func decodeJsonPayloadStrict(r *rest.Request, v interface{}) error {
+	content, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return err
+	}
+	if len(content) == 0 {
+		return rest.ErrJsonPayloadEmpty
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+func parseAttributes(
+	r *rest.Request,
+	scopeAliases map[string]string,
+	nullable bool,
+) (model.DeviceAttributes, error) {
+	var attrs model.DeviceAttributes
+
+	err := r.DecodeJsonPayload(&attrs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode request body")
+	}
+	resolveAttributesScope(scopeAliases, attrs)
+
+	if nullable {
+		err = attrs.ValidateNullable()
+	} else {
+		err = attrs.Validate()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return attrs, nil
+}
+
+func (i *inventoryHandlers) GetGroupsHandler(w rest.ResponseWriter, r *rest.Request) {
+	var fltr []model.FilterPredicate
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	query := r.URL.Query()
+	status := query.Get("status")
+	if status != "" {
+		fltr = []model.FilterPredicate{{
+			Attribute: "status",
+			Scope:     "identity",
+			Type:      "$eq",
+			Value:     status,
+		}}
+	}
+
+	// the groups are paged only on request, all of them are listed
+	// otherwise
+	var (
+		page, perPage uint64
+		skip, limit   int
+		err           error
+	)
+	paged := query.Has(utils.PageName) || query.Has(utils.PerPageName)
+	if paged {
+		page, perPage, err = utils.ParsePagination(r)
+		if err != nil {
+			u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+			return
+		}
+		skip = int((page - 1) * perPage)
+		limit = int(perPage)
+	}
+
+	groups, totalCount, err := i.inventory.ListGroups(ctx, fltr, skip, limit)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	if groups == nil {
+		groups = []model.GroupName{}
+	}
+
+	if paged {
+		hasNext := totalCount > int(page*perPage)
+		i.addPageLinks(w, r, page, perPage, hasNext)
+	}
+	w.Header().Add(hdrTotalCount, strconv.Itoa(totalCount))
+	_ = w.WriteJson(groups)
+}
+
+func (i *inventoryHandlers) GetDeviceGroupHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	deviceID := r.PathParam("id")
+
+	group, err := i.inventory.GetDeviceGroup(ctx, model.DeviceID(deviceID))
+	if err != nil {
+		if errors.Cause(err) == store.ErrDevNotFound {
+			u.RestErrWithLog(w, r, l, store.ErrDevNotFound, http.StatusNotFound)
+		} else {
+			u.RestErrWithLogInternal(w, r, l, err)
+		}
+		return
+	}
+
+	ret := map[string]*model.GroupName{"group": nil}
+
+	if group != "" {
+		ret["group"] = &group
+	}
+
+	_ = w.WriteJson(ret)
+}
+
+// GetGroupSiblingsHandler returns the other devices of the group of the
+// device, empty if the device has no group
+func (i *inventoryHandlers) GetGroupSiblingsHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	deviceID := r.PathParam("id")
+
+	devices, err := i.inventory.GetGroupSiblings(ctx, model.DeviceID(deviceID))
+	if err != nil {
+		if errors.Cause(err) == store.ErrDevNotFound {
+			u.RestErrWithLog(w, r, l, store.ErrDevNotFound, http.StatusNotFound)
+		} else {
+			u.RestErrWithLogInternal(w, r, l, err)
+		}
+		return
+	}
+
+	_ = w.WriteJson(devices)
+}
+
+type newTenantRequest struct {
+	TenantID string `json:"tenant_id" valid:"required"`
+}
+
+func (t newTenantRequest) Validate() error {
+	return validation.ValidateStruct(&t,
+		validation.Field(&t.TenantID, validation.Required),
+	)
+}
+
+// GetDevicesDistinctGroupsHandler returns the distinct groups of the
+// devices listed in the request body
+func (i *inventoryHandlers) GetDevicesDistinctGroupsHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	var ids []model.DeviceID
+	if err := r.DecodeJsonPayload(&ids); err != nil {
+		u.RestErrWithLog(w, r, l,
+			errors.Wrap(err, "failed to decode request body"),
+			http.StatusBadRequest)
+		return
+	}
+	err := validation.Validate(ids,
+		validation.Required,
+		validation.Each(validation.Required),
+	)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	if err := i.checkBulkDeviceIDs(len(ids)); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	groups, err := i.inventory.GetDevicesDistinctGroups(ctx, ids)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	res := InventoryApiDistinctGroups{Groups: []model.GroupName{}}
+	for _, group := range groups {
+		if group == "" {
+			res.Ungrouped = true
+		} else {
+			res.Groups = append(res.Groups, group)
+		}
+	}
+	_ = w.WriteJson(res)
+}
+
+func (i *inventoryHandlers) CreateTenantHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	var newTenant newTenantRequest
+
+	if err := r.DecodeJsonPayload(&newTenant); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := newTenant.Validate(); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	err := i.inventory.CreateTenant(ctx, model.NewTenant{
+		ID: newTenant.TenantID,
+	})
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (i *inventoryHandlers) FiltersAttributesHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	// query the database
+	attributes, err := i.inventory.GetFiltersAttributes(ctx)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	// in case of nil make sure we return empty list
+	if attributes == nil {
+		attributes = []model.FilterAttribute{}
+	}
+
+	_ = w.WriteJson(attributes)
+}
+
+// FiltersDescribedAttributesHandler lists the attributes having a
+// description set on at least one device
+func (i *inventoryHandlers) FiltersDescribedAttributesHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	attributes, err := i.inventory.GetDescribedAttributes(ctx)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	// in case of nil make sure we return empty list
+	if attributes == nil {
+		attributes = []model.DescribedAttribute{}
+	}
+
+	_ = w.WriteJson(attributes)
+}
+
+// GetGroupSchemaHandler lists the attributes set on the devices of the
+// group with the types of their values
+func (i *inventoryHandlers) GetGroupSchemaHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	groupName := i.pathGroupName(r)
+	if err := groupName.Validate(); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	attributes, err := i.inventory.GetGroupSchema(ctx, groupName)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	// in case of nil make sure we return empty list
+	if attributes == nil {
+		attributes = []model.SchemaAttribute{}
+	}
+
+	_ = w.WriteJson(attributes)
+}
+
+// FiltersTopAttributeValuesHandler returns the most frequent values of the
+// attribute with the number of devices having each value
+func (i *inventoryHandlers) FiltersTopAttributeValuesHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	scope := resolveScope(i.config.ScopeAliases, r.PathParam("scope"))
+	name := r.PathParam("name")
+
+	limit, err := utils.ParseQueryParmUInt(r, queryParamLimit, false,
+		1, topAttributeValuesLimitMax, topAttributeValuesLimitDefault)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	values, err := i.inventory.TopAttributeValues(ctx, scope, name, int(limit))
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	// in case of nil make sure we return empty list
+	if values == nil {
+		values = []model.AttributeValueCount{}
+	}
+
+	_ = w.WriteJson(values)
+}
+
+// FiltersAttributeCardinalityHandler returns the number of distinct values
+// of the attribute, e.g. to pick the attributes to index
+func (i *inventoryHandlers) FiltersAttributeCardinalityHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	scope := resolveScope(i.config.ScopeAliases, r.PathParam("scope"))
+	name := r.PathParam("name")
+
+	cardinality, err := i.inventory.AttributeCardinality(ctx, scope, name)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	_ = w.WriteJson(model.AttributeCardinality{
+		Name:        name,
+		Scope:       scope,
+		Cardinality: cardinality,
+	})
+}
+
+// FiltersCoverageHandler returns, for each attribute, the percentage of
+// the devices having it, e.g. to spot the devices missing some data
+func (i *inventoryHandlers) FiltersCoverageHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	coverage, err := i.inventory.GetAttributesCoverage(ctx)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	// in case of nil make sure we return empty list
+	if coverage == nil {
+		coverage = []model.AttributeCoverage{}
+	}
+
+	_ = w.WriteJson(coverage)
+}
+
+// FiltersScopesHandler returns the distinct scopes of the attributes of
+// the devices, e.g. to group the attributes by scope in the UI
+func (i *inventoryHandlers) FiltersScopesHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	scopes, err := i.inventory.GetAttributeScopes(ctx)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	// in case of nil make sure we return empty list
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	_ = w.WriteJson(scopes)
+}
+
+func (i *inventoryHandlers) FiltersSearchHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if err := i.checkSearchTenant(ctx); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusUnauthorized)
+		return
+	}
+
+	//extract attributes from body
+	searchParams, err := parseSearchParams(r, i.config.ScopeAliases, i.config.MaxPageOffset)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	if i.config.SearchRequireFilters && len(searchParams.Filters) == 0 {
+		u.RestErrWithLog(w, r, l,
+			errors.New("at least one filter is required"),
+			http.StatusBadRequest)
+		return
+	}
+	if err := i.checkFiltersIndexed(searchParams.Filters); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	searchParams.Attributes, err = i.projectAttributes(r, searchParams.Attributes)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	i.limitSearchCount(searchParams)
+
+	// query the database
+	devs, totalCount, err := i.inventory.SearchDevices(ctx, *searchParams)
+	if err != nil {
+		if strings.Contains(err.Error(), "BadValue") ||
+			errors.Cause(err) == store.ErrRegexNonString {
+			u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		} else {
+			u.RestErrWithLogInternal(w, r, l, err)
+		}
+		return
+	}
+
+	// the response writer will ensure the header name is in Kebab-Pascal-Case
+	w.Header().Add(hdrTotalCount, strconv.Itoa(totalCount))
+	if searchParams.EstimateCount {
+		estimated := searchParams.CountLimit > 0 && totalCount >= searchParams.CountLimit
+		w.Header().Add(hdrTotalCountEstimated, strconv.FormatBool(estimated))
+	}
+	devs = i.limitPageSize(w, devs)
+	w.Header().Set(hdrResultETag, makeResultETag(devs))
+	_ = writeResponse(w, r, devs)
+}
+
+// FiltersCountHandler returns the number of devices matching the filters
+// of the search, validated as the search validates them
+func (i *inventoryHandlers) FiltersCountHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if err := i.checkSearchTenant(ctx); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusUnauthorized)
+		return
+	}
+
+	searchParams, err := parseSearchParams(r, i.config.ScopeAliases, i.config.MaxPageOffset)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	if i.config.SearchRequireFilters && len(searchParams.Filters) == 0 {
+		u.RestErrWithLog(w, r, l,
+			errors.New("at least one filter is required"),
+			http.StatusBadRequest)
+		return
+	}
+	if err := i.checkFiltersIndexed(searchParams.Filters); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	count, err := i.inventory.CountDevices(ctx, *searchParams)
+	if err != nil {
+		if strings.Contains(err.Error(), "BadValue") ||
+			errors.Cause(err) == store.ErrRegexNonString {
+			u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		} else {
+			u.RestErrWithLogInternal(w, r, l, err)
+		}
+		return
+	}
+
+	_ = w.WriteJson(InventoryApiDevicesCount{Count: count})
+}
+
+// resolveFiltersScopes resolves the aliases of the attribute scopes of the
+// filter predicates in place
+func resolveFiltersScopes(scopeAliases map[string]string, filters []model.FilterPredicate) {
+	for i := range filters {
+		predicate := &filters[i]
+		predicate.Scope = resolveScope(scopeAliases, predicate.Scope)
+		if predicate.Ref != nil {
+			predicate.Ref.Scope = resolveScope(scopeAliases, predicate.Ref.Scope)
+		}
+	}
+}
+
+// parseSavedFilter parses the saved filter of the request body, resolving
+// the aliases of the attribute scopes of the predicates
+func parseSavedFilter(
+	r *rest.Request,
+	scopeAliases map[string]string,
+) (*model.SavedFilter, error) {
+	var filter model.SavedFilter
+	if err := r.DecodeJsonPayload(&filter); err != nil {
+		return nil, errors.Wrap(err, "failed to decode request body")
+	}
+	resolveFiltersScopes(scopeAliases, filter.Filters)
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	return &filter, nil
+}
+
+func (i *inventoryHandlers) CreateSavedFilterHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	filter, err := parseSavedFilter(r, i.config.ScopeAliases)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := i.inventory.CreateSavedFilter(ctx, filter); err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	w.Header().Add("Location", strings.Replace(urlSavedFilter, "#id", filter.ID, 1))
+	w.WriteHeader(http.StatusCreated)
+	_ = w.WriteJson(filter)
+}
+
+func (i *inventoryHandlers) ListSavedFiltersHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	filters, err := i.inventory.ListSavedFilters(ctx)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	_ = w.WriteJson(filters)
+}
+
+func (i *inventoryHandlers) GetSavedFilterHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	filter, err := i.inventory.GetSavedFilter(ctx, r.PathParam("id"))
+	if errors.Cause(err) == store.ErrFilterNotFound {
+		u.RestErrWithLog(w, r, l, store.ErrFilterNotFound, http.StatusNotFound)
+		return
+	} else if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	_ = w.WriteJson(filter)
+}
+
+func (i *inventoryHandlers) UpdateSavedFilterHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	filter, err := parseSavedFilter(r, i.config.ScopeAliases)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	filter.ID = r.PathParam("id")
+
+	err = i.inventory.UpdateSavedFilter(ctx, filter)
+	if errors.Cause(err) == store.ErrFilterNotFound {
+		u.RestErrWithLog(w, r, l, store.ErrFilterNotFound, http.StatusNotFound)
+		return
+	} else if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (i *inventoryHandlers) DeleteSavedFilterHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	err := i.inventory.DeleteSavedFilter(ctx, r.PathParam("id"))
+	if errors.Cause(err) == store.ErrFilterNotFound {
+		u.RestErrWithLog(w, r, l, store.ErrFilterNotFound, http.StatusNotFound)
+		return
+	} else if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSavedFilterDevicesHandler returns a page of the devices matching the
+// predicates of the saved filter
+func (i *inventoryHandlers) GetSavedFilterDevicesHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	page, perPage, err := utils.ParsePagination(r)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	err = checkPageOffset(int(page), int(perPage), i.config.MaxPageOffset)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	filter, err := i.inventory.GetSavedFilter(ctx, r.PathParam("id"))
+	if errors.Cause(err) == store.ErrFilterNotFound {
+		u.RestErrWithLog(w, r, l, store.ErrFilterNotFound, http.StatusNotFound)
+		return
+	} else if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+	if err := i.checkFiltersIndexed(filter.Filters); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	attributes, err := i.projectAttributes(r, nil)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	devs, totalCount, err := i.inventory.SearchDevices(ctx, model.SearchParams{
+		Page:       int(page),
+		PerPage:    int(perPage),
+		Filters:    filter.Filters,
+		Attributes: attributes,
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "BadValue") ||
+			errors.Cause(err) == store.ErrRegexNonString {
+			u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		} else {
+			u.RestErrWithLogInternal(w, r, l, err)
+		}
+		return
+	}
+
+	hasNext := totalCount > int(page*perPage)
+	devs = i.addDevicesPageLinks(w, r, page, perPage, hasNext, devs)
+	w.Header().Add(hdrTotalCount, strconv.Itoa(totalCount))
+	w.Header().Set(hdrResultETag, makeResultETag(devs))
+	_ = w.WriteJson(devs)
+}
+
+func (i *inventoryHandlers) InternalFiltersSearchHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	tenantId := r.PathParam("tenant_id")
+	if tenantId != "" {
+		ctx = getTenantContext(ctx, tenantId)
+	}
+
+	//extract attributes from body
+	searchParams, err := parseSearchParams(r, i.config.ScopeAliases, i.config.MaxPageOffset)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	i.limitSearchCount(searchParams)
+
+	// query the database
+	devs, totalCount, err := i.inventory.SearchDevices(ctx, *searchParams)
+	if err != nil {
+		if strings.Contains(err.Error(), "BadValue") ||
+			errors.Cause(err) == store.ErrRegexNonString {
+			u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		} else {
+			u.RestErrWithLogInternal(w, r, l, err)
+		}
+		return
+	}
+
+	// the response writer will ensure the header name is in Kebab-Pascal-Case
+	w.Header().Add(hdrTotalCount, strconv.Itoa(totalCount))
+	if searchParams.EstimateCount {
+		estimated := searchParams.CountLimit > 0 && totalCount >= searchParams.CountLimit
+		w.Header().Add(hdrTotalCountEstimated, strconv.FormatBool(estimated))
+	}
+	devs = i.limitPageSize(w, devs)
+	w.Header().Set(hdrResultETag, makeResultETag(devs))
+	_ = w.WriteJson(devs)
+}
+
+// InternalFiltersSearchExplainHandler returns the query plan of the devices
+// search, if enabled
+func (i *inventoryHandlers) InternalFiltersSearchExplainHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	ctx := r.Context()
+	ctx = getTenantContext(ctx, r.PathParam("tenant_id"))
+
+	l := log.FromContext(ctx)
+
+	if !i.config.EnableSearchExplain {
+		u.RestErrWithLog(w, r, l,
+			errors.New("the search explain endpoint is disabled"),
+			http.StatusForbidden)
+		return
+	}
+
+	searchParams, err := parseSearchParams(r, i.config.ScopeAliases, i.config.MaxPageOffset)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	plan, err := i.inventory.ExplainSearchDevices(ctx, *searchParams)
+	if err != nil {
+		if strings.Contains(err.Error(), "BadValue") {
+			u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		} else {
+			u.RestErrWithLogInternal(w, r, l, err)
+		}
+		return
+	}
+
+	_ = w.WriteJson(plan)
+}
+
+func getTenantContext(ctx context.Context, tenantId string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if tenantId == "" {
+		return ctx
+	}
+	id := &midentity.Identity{
+		Tenant: tenantId,
+	}
+
+	ctx = midentity.WithContext(ctx, id)
+
+	return ctx
+}
+
+func (i *inventoryHandlers) InternalDevicesStatusHandler(w rest.ResponseWriter, r *rest.Request) {
+	const (
+		StatusDecommissioned = "decommissioned"
+		StatusAccepted       = "accepted"
+		StatusRejected       = "rejected"
+		StatusPreauthorized  = "preauthorized"
+		StatusPending        = "pending"
+		StatusNoAuth         = "noauth"
+	)
+	var (
+		devices []model.DeviceUpdate
+		result  *model.UpdateResult
+	)
+
+	ctx := r.Context()
+	l := log.FromContext(ctx)
+
+	tenantID := r.PathParam("tenant_id")
+	ctx = getTenantContext(ctx, tenantID)
+
+	status := r.PathParam("status")
+
+	err := r.DecodeJsonPayload(&devices)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, errors.Wrap(err, "cant parse devices"), http.StatusBadRequest)
+		return
+	}
+	if err = i.checkBulkDeviceIDs(len(devices)); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	if err = checkEmptyDeviceIDs(getIdsFromDevices(devices)); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	switch status {
+	case StatusAccepted, StatusPreauthorized,
+		StatusPending, StatusRejected,
+		StatusNoAuth:
+		// Update statuses
+		attrs := model.DeviceAttributes{{
+			Name:  "status",
+			Scope: model.AttrScopeIdentity,
+			Value: status,
+		}}
+		result, err = i.inventory.UpsertDevicesStatuses(ctx, devices, attrs)
+	case StatusDecommissioned:
+		// Delete Inventory
+		result, err = i.inventory.DeleteDevices(ctx, getIdsFromDevices(devices))
+	default:
+		// Unrecognized status
 		u.RestErrWithLog(w, r, l,
-			errors.New("no device IDs present in payload"),
-			http.StatusBadRequest,
+			errors.Errorf("unrecognized status: %s", status),
+			http.StatusNotFound,
 		)
 		return
 	}
-
-	updated, err := i.inventory.UnsetDevicesGroup(ctx, deviceIDs, groupName)
-	if err != nil {
+	if errors.Cause(err) == store.ErrWriteConflict {
+		u.RestErrWithLog(w, r, l, err, http.StatusConflict)
+		return
+	} else if err != nil {
 		u.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
+
 	w.WriteHeader(http.StatusOK)
-	_ = w.WriteJson(updated)
+	_ = w.WriteJson(result)
 }
 
-func parseDevice(r *rest.Request) (*model.Device, error) {
-	dev := model.Device{}
+func (i *inventoryHandlers) GetDeviceGroupsInternalHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
 
-	//decode body
-	err := r.DecodeJsonPayload(&dev)
+	l := log.FromContext(ctx)
+
+	tenantId := r.PathParam("tenant_id")
+	ctx = getTenantContext(ctx, tenantId)
+
+	expand, err := utils.ParseQueryParmBool(r, queryParamExpand, false, nil)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to decode request body")
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
 	}
 
-	if err := dev.Validate(); err != nil {
-		return nil, err
+	deviceID := r.PathParam("device_id")
+	if expand != nil && *expand {
+		i.getDeviceGroupsExpanded(w, r, ctx, model.DeviceID(deviceID))
+		return
 	}
 
-	return &dev, nil
+	group, err := i.inventory.GetDeviceGroup(ctx, model.DeviceID(deviceID))
+	if err != nil {
+		if errors.Cause(err) == store.ErrDevNotFound {
+			u.RestErrWithLog(w, r, l, store.ErrDevNotFound, http.StatusNotFound)
+		} else {
+			u.RestErrWithLogInternal(w, r, l, err)
+		}
+		return
+	}
+
+	res := model.DeviceGroups{}
+	if group != "" {
+		res.Groups = append(res.Groups, string(group))
+	}
+
+	_ = w.WriteJson(res)
 }
 
-func parseAttributes(r *rest.Request) (model.DeviceAttributes, error) {
-	var attrs model.DeviceAttributes
+// getDeviceGroupsExpanded writes the groups of the device along with its
+// identity attributes
+func (i *inventoryHandlers) getDeviceGroupsExpanded(
+	w rest.ResponseWriter,
+	r *rest.Request,
+	ctx context.Context,
+	id model.DeviceID,
+) {
+	l := log.FromContext(ctx)
 
-	err := r.DecodeJsonPayload(&attrs)
+	dev, err := i.inventory.GetDevice(ctx, id)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to decode request body")
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+	if dev == nil {
+		u.RestErrWithLog(w, r, l, store.ErrDevNotFound, http.StatusNotFound)
+		return
 	}
 
-	err = attrs.Validate()
-	if err != nil {
-		return nil, err
+	res := InventoryApiDeviceGroupsExpanded{
+		Identity: model.DeviceAttributes{},
+	}
+	if dev.Group != "" {
+		res.Groups = append(res.Groups, string(dev.Group))
+	}
+	for _, attr := range dev.Attributes {
+		if attr.Scope == model.AttrScopeIdentity {
+			res.Identity = append(res.Identity, attr)
+		}
 	}
 
-	return attrs, nil
+	_ = w.WriteJson(res)
 }
 
-func (i *inventoryHandlers) GetGroupsHandler(w rest.ResponseWriter, r *rest.Request) {
-	var fltr []model.FilterPredicate
+func (i *inventoryHandlers) ReindexDeviceDataHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
+	tenantId := r.PathParam("tenant_id")
+	ctx = getTenantContext(ctx, tenantId)
 
 	l := log.FromContext(ctx)
 
-	query := r.URL.Query()
-	status := query.Get("status")
-	if status != "" {
-		fltr = []model.FilterPredicate{{
-			Attribute: "status",
-			Scope:     "identity",
-			Type:      "$eq",
-			Value:     status,
-		}}
+	deviceId := r.PathParam("device_id")
+	if len(deviceId) < 1 {
+		u.RestErrWithLog(w, r, l, errors.New("device id cannot be empty"), http.StatusBadRequest)
+		return
+	}
+
+	serviceName, err := utils.ParseQueryParmStr(r, "service", false, nil)
+	// inventory service accepts only reindex requests from the services
+	// with a configured attribute scope
+	scope, ok := i.config.ReindexServiceScopes[serviceName]
+	if err != nil || !ok {
+		u.RestErrWithLog(w, r, l, errors.New("unsupported service"), http.StatusBadRequest)
+		return
 	}
 
-	groups, err := i.inventory.ListGroups(ctx, fltr)
+	// check devicemonitor alerts
+	alertsCount, err := i.inventory.CheckAlerts(ctx, deviceId)
 	if err != nil {
 		u.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
 
-	if groups == nil {
-		groups = []model.GroupName{}
+	alertsPresent := false
+	if alertsCount > 0 {
+		alertsPresent = true
+	}
+	attrs := model.DeviceAttributes{
+		model.DeviceAttribute{
+			Name:  model.AttrNameNumberOfAlerts,
+			Scope: scope,
+			Value: alertsCount,
+		},
+		model.DeviceAttribute{
+			Name:  model.AttrNameAlerts,
+			Scope: scope,
+			Value: alertsPresent,
+		},
 	}
 
-	_ = w.WriteJson(groups)
+	// upsert the alert attributes
+	err = i.inventory.UpsertAttributes(ctx, model.DeviceID(deviceId), attrs)
+	cause := errors.Cause(err)
+	switch cause {
+	case store.ErrNoAttrName:
+		u.RestErrWithLog(w, r, l, cause, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
 }
 
-func (i *inventoryHandlers) GetDeviceGroupHandler(w rest.ResponseWriter, r *rest.Request) {
+// GetDuplicateAttributesInternalHandler lists the devices having more than
+// one attribute entry with the same scope and name
+func (i *inventoryHandlers) GetDuplicateAttributesInternalHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
 	ctx := r.Context()
+	ctx = getTenantContext(ctx, r.PathParam("tenant_id"))
 
 	l := log.FromContext(ctx)
 
-	deviceID := r.PathParam("id")
+	page, perPage, err := utils.ParsePagination(r)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
 
-	group, err := i.inventory.GetDeviceGroup(ctx, model.DeviceID(deviceID))
+	// fetch one more device to know whether there is a next page
+	devices, err := i.inventory.FindDevicesWithDuplicateAttributes(ctx,
+		int((page-1)*perPage), int(perPage+1))
 	if err != nil {
-		if err == store.ErrDevNotFound {
-			u.RestErrWithLog(w, r, l, store.ErrDevNotFound, http.StatusNotFound)
-		} else {
-			u.RestErrWithLogInternal(w, r, l, err)
-		}
+		u.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
 
-	ret := map[string]*model.GroupName{"group": nil}
+	hasNext := len(devices) > int(perPage)
+	if hasNext {
+		devices = devices[:perPage]
+	}
+	i.addPageLinks(w, r, page, perPage, hasNext)
+	_ = w.WriteJson(devices)
+}
 
-	if group != "" {
-		ret["group"] = &group
+// RepairDuplicateAttributesInternalHandler removes the duplicate attribute
+// entries of the device
+func (i *inventoryHandlers) RepairDuplicateAttributesInternalHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	ctx := r.Context()
+	ctx = getTenantContext(ctx, r.PathParam("tenant_id"))
+
+	l := log.FromContext(ctx)
+
+	deviceID := model.DeviceID(r.PathParam("device_id"))
+	removed, err := i.inventory.RepairDuplicateAttributes(ctx, deviceID)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
 	}
 
-	_ = w.WriteJson(ret)
+	_ = w.WriteJson(map[string]int{"removed": removed})
 }
 
-type newTenantRequest struct {
-	TenantID string `json:"tenant_id" valid:"required"`
+// VerifyDeviceAttributesInternalHandler reports the integrity problems of
+// the stored attributes of the device
+func (i *inventoryHandlers) VerifyDeviceAttributesInternalHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	ctx := r.Context()
+	ctx = getTenantContext(ctx, r.PathParam("tenant_id"))
+
+	l := log.FromContext(ctx)
+
+	deviceID := model.DeviceID(r.PathParam("device_id"))
+	report, err := i.inventory.VerifyDeviceAttributes(ctx, deviceID)
+	if errors.Cause(err) == store.ErrDevNotFound {
+		u.RestErrWithLog(w, r, l, store.ErrDevNotFound, http.StatusNotFound)
+		return
+	} else if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	_ = w.WriteJson(report)
+}
+
+// GetAttributesChurnInternalHandler lists the number of value changes of
+// the attributes, most frequently changed first
+func (i *inventoryHandlers) GetAttributesChurnInternalHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	ctx := r.Context()
+	ctx = getTenantContext(ctx, r.PathParam("tenant_id"))
+
+	l := log.FromContext(ctx)
+
+	churn, err := i.inventory.GetAttributesChurn(ctx)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	_ = w.WriteJson(churn)
 }
 
-func (t newTenantRequest) Validate() error {
-	return validation.ValidateStruct(&t,
-		validation.Field(&t.TenantID, validation.Required),
-	)
+func (i *inventoryHandlers) GetDevicesAttributesCountInternalHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	ctx := r.Context()
+	ctx = getTenantContext(ctx, r.PathParam("tenant_id"))
+
+	l := log.FromContext(ctx)
+
+	var ids []model.DeviceID
+	if err := r.DecodeJsonPayload(&ids); err != nil {
+		u.RestErrWithLog(w, r, l,
+			errors.Wrap(err, "failed to decode request body"),
+			http.StatusBadRequest)
+		return
+	}
+	err := validation.Validate(ids,
+		validation.Required,
+		validation.Each(validation.Required),
+	)
+	if err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	if err := i.checkBulkDeviceIDs(len(ids)); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	counts, err := i.inventory.GetDevicesAttributesCount(ctx, ids)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	_ = w.WriteJson(counts)
 }
 
-func (i *inventoryHandlers) CreateTenantHandler(w rest.ResponseWriter, r *rest.Request) {
+// GetAttributesPresenceInternalHandler returns which of the given devices
+// have which of the given attributes, e.g. to compare the devices
+func (i *inventoryHandlers) GetAttributesPresenceInternalHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
 	ctx := r.Context()
+	ctx = getTenantContext(ctx, r.PathParam("tenant_id"))
 
 	l := log.FromContext(ctx)
 
-	var newTenant newTenantRequest
-
-	if err := r.DecodeJsonPayload(&newTenant); err != nil {
+	var req InventoryApiAttributesPresenceRequest
+	if err := r.DecodeJsonPayload(&req); err != nil {
+		u.RestErrWithLog(w, r, l,
+			errors.Wrap(err, "failed to decode request body"),
+			http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
 		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
-
-	if err := newTenant.Validate(); err != nil {
+	if err := i.checkBulkDeviceIDs(len(req.DeviceIDs)); err != nil {
 		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
+	for j := range req.Attributes {
+		req.Attributes[j].Scope = resolveScope(i.config.ScopeAliases, req.Attributes[j].Scope)
+	}
 
-	err := i.inventory.CreateTenant(ctx, model.NewTenant{
-		ID: newTenant.TenantID,
-	})
+	presence, err := i.inventory.GetAttributesPresence(ctx, req.DeviceIDs, req.Attributes)
 	if err != nil {
 		u.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	_ = w.WriteJson(InventoryApiAttributesPresence{
+		Attributes: req.Attributes,
+		Devices:    presence,
+	})
 }
 
-func (i *inventoryHandlers) FiltersAttributesHandler(w rest.ResponseWriter, r *rest.Request) {
+func (i *inventoryHandlers) GetDevicesStatusesInternalHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
 	ctx := r.Context()
+	ctx = getTenantContext(ctx, r.PathParam("tenant_id"))
 
 	l := log.FromContext(ctx)
 
-	// query the database
-	attributes, err := i.inventory.GetFiltersAttributes(ctx)
+	var ids []model.DeviceID
+	if err := r.DecodeJsonPayload(&ids); err != nil {
+		u.RestErrWithLog(w, r, l,
+			errors.Wrap(err, "failed to decode request body"),
+			http.StatusBadRequest)
+		return
+	}
+	err := validation.Validate(ids,
+		validation.Required,
+		validation.Each(validation.Required),
+	)
 	if err != nil {
-		u.RestErrWithLogInternal(w, r, l, err)
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	if err := i.checkBulkDeviceIDs(len(ids)); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
 
-	// in case of nil make sure we return empty list
-	if attributes == nil {
-		attributes = []model.FilterAttribute{}
+	statuses, err := i.inventory.GetDevicesStatuses(ctx, ids)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
 	}
 
-	_ = w.WriteJson(attributes)
+	_ = w.WriteJson(statuses)
 }
 
-func (i *inventoryHandlers) FiltersSearchHandler(w rest.ResponseWriter, r *rest.Request) {
+func (i *inventoryHandlers) FindDevicesByAttributeInternalHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
 	ctx := r.Context()
+	ctx = getTenantContext(ctx, r.PathParam("tenant_id"))
 
 	l := log.FromContext(ctx)
 
-	//extract attributes from body
-	searchParams, err := parseSearchParams(r)
-	if err != nil {
+	var req InventoryApiAttributeValues
+	if err := r.DecodeJsonPayload(&req); err != nil {
+		u.RestErrWithLog(w, r, l,
+			errors.Wrap(err, "failed to decode request body"),
+			http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
 		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
+	scope := resolveScope(i.config.ScopeAliases, req.Scope)
 
-	// query the database
-	devs, totalCount, err := i.inventory.SearchDevices(ctx, *searchParams)
+	devices, err := i.inventory.FindDevicesByAttributeValues(ctx, scope, req.Name, req.Values)
 	if err != nil {
-		if strings.Contains(err.Error(), "BadValue") {
-			u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
-		} else {
-			u.RestErrWithLogInternal(w, r, l, err)
-		}
+		u.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
 
-	// the response writer will ensure the header name is in Kebab-Pascal-Case
-	w.Header().Add(hdrTotalCount, strconv.Itoa(totalCount))
-	_ = w.WriteJson(devs)
+	_ = w.WriteJson(devices)
 }
 
-func (i *inventoryHandlers) InternalFiltersSearchHandler(w rest.ResponseWriter, r *rest.Request) {
+// FindDevicesWithAttributeDriftInternalHandler returns the devices whose
+// attribute differs from the known value, e.g. to detect the devices which
+// drifted from the expected configuration
+func (i *inventoryHandlers) FindDevicesWithAttributeDriftInternalHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
 	ctx := r.Context()
+	ctx = getTenantContext(ctx, r.PathParam("tenant_id"))
 
 	l := log.FromContext(ctx)
 
-	tenantId := r.PathParam("tenant_id")
-	if tenantId != "" {
-		ctx = getTenantContext(ctx, tenantId)
+	var req InventoryApiAttributeValue
+	if err := r.DecodeJsonPayload(&req); err != nil {
+		u.RestErrWithLog(w, r, l,
+			errors.Wrap(err, "failed to decode request body"),
+			http.StatusBadRequest)
+		return
 	}
-
-	//extract attributes from body
-	searchParams, err := parseSearchParams(r)
-	if err != nil {
+	if err := req.Validate(); err != nil {
 		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
+	scope := resolveScope(i.config.ScopeAliases, req.Scope)
 
-	// query the database
-	devs, totalCount, err := i.inventory.SearchDevices(ctx, *searchParams)
+	devices, err := i.inventory.FindDevicesWithAttributeDrift(ctx, scope, req.Name, req.Value)
 	if err != nil {
-		if strings.Contains(err.Error(), "BadValue") {
-			u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
-		} else {
-			u.RestErrWithLogInternal(w, r, l, err)
-		}
+		u.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
 
-	// the response writer will ensure the header name is in Kebab-Pascal-Case
-	w.Header().Add(hdrTotalCount, strconv.Itoa(totalCount))
-	_ = w.WriteJson(devs)
+	_ = w.WriteJson(devices)
 }
 
-func getTenantContext(ctx context.Context, tenantId string) context.Context {
-	if ctx == nil {
-		ctx = context.Background()
+// FindDevicesByAttributeSetInternalHandler returns the devices whose
+// attributes of the scope are exactly the given ones, e.g. to find the
+// duplicates of a device when importing devices
+func (i *inventoryHandlers) FindDevicesByAttributeSetInternalHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	ctx := r.Context()
+	ctx = getTenantContext(ctx, r.PathParam("tenant_id"))
+
+	l := log.FromContext(ctx)
+
+	var req InventoryApiAttributeSet
+	if err := r.DecodeJsonPayload(&req); err != nil {
+		u.RestErrWithLog(w, r, l,
+			errors.Wrap(err, "failed to decode request body"),
+			http.StatusBadRequest)
+		return
 	}
-	if tenantId == "" {
-		return ctx
+	if err := req.Validate(); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		return
 	}
-	id := &midentity.Identity{
-		Tenant: tenantId,
+	scope := resolveScope(i.config.ScopeAliases, req.Scope)
+
+	attrs := make(model.DeviceAttributes, 0, len(req.Attributes))
+	for name, value := range req.Attributes {
+		attrs = append(attrs, model.DeviceAttribute{
+			Name:  name,
+			Value: value,
+			Scope: scope,
+		})
 	}
+	sort.Slice(attrs, func(i, j int) bool {
+		return attrs[i].Name < attrs[j].Name
+	})
 
-	ctx = midentity.WithContext(ctx, id)
+	devices, err := i.inventory.FindDevicesByAttributeSet(ctx, scope, attrs)
+	if err != nil {
+		u.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
 
-	return ctx
+	_ = w.WriteJson(devices)
 }
 
-func (i *inventoryHandlers) InternalDevicesStatusHandler(w rest.ResponseWriter, r *rest.Request) {
-	const (
-		StatusDecommissioned = "decommissioned"
-		StatusAccepted       = "accepted"
-		StatusRejected       = "rejected"
-		StatusPreauthorized  = "preauthorized"
-		StatusPending        = "pending"
-		StatusNoAuth         = "noauth"
-	)
-	var (
-		devices []model.DeviceUpdate
-		result  *model.UpdateResult
-	)
-
+// SampleDevicesInternalHandler returns up to the requested number of
+// devices picked at random among the devices matching the filters
+func (i *inventoryHandlers) SampleDevicesInternalHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
 	ctx := r.Context()
-	l := log.FromContext(ctx)
-
-	tenantID := r.PathParam("tenant_id")
-	ctx = getTenantContext(ctx, tenantID)
-
-	status := r.PathParam("status")
+	ctx = getTenantContext(ctx, r.PathParam("tenant_id"))
 
-	err := r.DecodeJsonPayload(&devices)
-	if err != nil {
-		u.RestErrWithLog(w, r, l, errors.Wrap(err, "cant parse devices"), http.StatusBadRequest)
-		return
-	}
+	l := log.FromContext(ctx)
 
-	switch status {
-	case StatusAccepted, StatusPreauthorized,
-		StatusPending, StatusRejected,
-		StatusNoAuth:
-		// Update statuses
-		attrs := model.DeviceAttributes{{
-			Name:  "status",
-			Scope: model.AttrScopeIdentity,
-			Value: status,
-		}}
-		result, err = i.inventory.UpsertDevicesStatuses(ctx, devices, attrs)
-	case StatusDecommissioned:
-		// Delete Inventory
-		result, err = i.inventory.DeleteDevices(ctx, getIdsFromDevices(devices))
-	default:
-		// Unrecognized status
+	var req InventoryApiSampleRequest
+	if err := r.DecodeJsonPayload(&req); err != nil {
 		u.RestErrWithLog(w, r, l,
-			errors.Errorf("unrecognized status: %s", status),
-			http.StatusNotFound,
-		)
+			errors.Wrap(err, "failed to decode request body"),
+			http.StatusBadRequest)
 		return
 	}
-	if err == store.ErrWriteConflict {
-		u.RestErrWithLog(w, r, l, err, http.StatusConflict)
+	if err := req.Validate(); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
-	} else if err != nil {
+	}
+	resolveFiltersScopes(i.config.ScopeAliases, req.Filters)
+
+	devices, err := i.inventory.SampleDevices(ctx, req.Size, req.Filters)
+	if err != nil {
 		u.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	_ = w.WriteJson(result)
+	_ = w.WriteJson(devices)
 }
 
-func (i *inventoryHandlers) GetDeviceGroupsInternalHandler(w rest.ResponseWriter, r *rest.Request) {
+func (i *inventoryHandlers) GetFeatureFlagsInternalHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
 	ctx := r.Context()
+	ctx = getTenantContext(ctx, r.PathParam("tenant_id"))
 
 	l := log.FromContext(ctx)
 
-	tenantId := r.PathParam("tenant_id")
-	ctx = getTenantContext(ctx, tenantId)
-
-	deviceID := r.PathParam("device_id")
-	group, err := i.inventory.GetDeviceGroup(ctx, model.DeviceID(deviceID))
+	flags, err := i.inventory.GetFeatureFlags(ctx)
 	if err != nil {
-		if err == store.ErrDevNotFound {
-			u.RestErrWithLog(w, r, l, store.ErrDevNotFound, http.StatusNotFound)
-		} else {
-			u.RestErrWithLogInternal(w, r, l, err)
-		}
+		u.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
-
-	res := model.DeviceGroups{}
-	if group != "" {
-		res.Groups = append(res.Groups, string(group))
+	if flags == nil {
+		flags = model.FeatureFlags{}
 	}
 
-	_ = w.WriteJson(res)
+	_ = w.WriteJson(flags)
 }
 
-func (i *inventoryHandlers) ReindexDeviceDataHandler(w rest.ResponseWriter, r *rest.Request) {
+func (i *inventoryHandlers) SetFeatureFlagsInternalHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
 	ctx := r.Context()
-	tenantId := r.PathParam("tenant_id")
-	ctx = getTenantContext(ctx, tenantId)
+	ctx = getTenantContext(ctx, r.PathParam("tenant_id"))
 
 	l := log.FromContext(ctx)
 
-	deviceId := r.PathParam("device_id")
-	if len(deviceId) < 1 {
-		u.RestErrWithLog(w, r, l, errors.New("device id cannot be empty"), http.StatusBadRequest)
-		return
-	}
-
-	serviceName, err := utils.ParseQueryParmStr(r, "service", false, nil)
-	// inventory service accepts only reindex requests from devicemonitor
-	if err != nil || serviceName != "devicemonitor" {
-		u.RestErrWithLog(w, r, l, errors.New("unsupported service"), http.StatusBadRequest)
+	var flags model.FeatureFlags
+	if err := r.DecodeJsonPayload(&flags); err != nil {
+		u.RestErrWithLog(w, r, l,
+			errors.Wrap(err, "failed to decode request body"),
+			http.StatusBadRequest)
 		return
 	}
-
-	// check devicemonitor alerts
-	alertsCount, err := i.inventory.CheckAlerts(ctx, deviceId)
-	if err != nil {
-		u.RestErrWithLogInternal(w, r, l, err)
+	if err := flags.Validate(); err != nil {
+		u.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 		return
 	}
 
-	alertsPresent := false
-	if alertsCount > 0 {
-		alertsPresent = true
-	}
-	attrs := model.DeviceAttributes{
-		model.DeviceAttribute{
-			Name:  model.AttrNameNumberOfAlerts,
-			Scope: model.AttrScopeMonitor,
-			Value: alertsCount,
-		},
-		model.DeviceAttribute{
-			Name:  model.AttrNameAlerts,
-			Scope: model.AttrScopeMonitor,
-			Value: alertsPresent,
-		},
-	}
-
-	// upsert monitor attributes
-	err = i.inventory.UpsertAttributes(ctx, model.DeviceID(deviceId), attrs)
-	cause := errors.Cause(err)
-	switch cause {
-	case store.ErrNoAttrName:
-		u.RestErrWithLog(w, r, l, cause, http.StatusBadRequest)
-		return
-	}
-	if err != nil {
+	if err := i.inventory.SetFeatureFlags(ctx, flags); err != nil {
 		u.RestErrWithLogInternal(w, r, l, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func getIdsFromDevices(devices []model.DeviceUpdate) []model.DeviceID {
@@ -1190,13 +3796,37 @@ func getIdsFromDevices(devices []model.DeviceUpdate) []model.DeviceID {
 	return ids
 }
 
-func parseSearchParams(r *rest.Request) (*model.SearchParams, error) {
+func parseSearchParams(
+	r *rest.Request,
+	scopeAliases map[string]string,
+	maxOffset int,
+) (*model.SearchParams, error) {
 	var searchParams model.SearchParams
 
 	if err := r.DecodeJsonPayload(&searchParams); err != nil {
 		return nil, errors.Wrap(err, "failed to decode request body")
 	}
 
+	for i := range searchParams.Filters {
+		filter := &searchParams.Filters[i]
+		filter.Scope = resolveScope(scopeAliases, filter.Scope)
+		if filter.Ref != nil {
+			filter.Ref.Scope = resolveScope(scopeAliases, filter.Ref.Scope)
+		}
+	}
+	for i := range searchParams.Sort {
+		searchParams.Sort[i].Scope = resolveScope(scopeAliases, searchParams.Sort[i].Scope)
+	}
+	for i := range searchParams.Attributes {
+		searchParams.Attributes[i].Scope = resolveScope(
+			scopeAliases,
+			searchParams.Attributes[i].Scope,
+		)
+	}
+	for i := range searchParams.Score {
+		searchParams.Score[i].Scope = resolveScope(scopeAliases, searchParams.Score[i].Scope)
+	}
+
 	if searchParams.Page < 1 {
 		searchParams.Page = utils.PageDefault
 	}
@@ -1207,6 +3837,10 @@ func parseSearchParams(r *rest.Request) (*model.SearchParams, error) {
 	if err := searchParams.Validate(); err != nil {
 		return nil, err
 	}
+	err := checkPageOffset(searchParams.Page, searchParams.PerPage, maxOffset)
+	if err != nil {
+		return nil, err
+	}
 
 	return &searchParams, nil
 }
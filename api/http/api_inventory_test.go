@@ -18,8 +18,10 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"testing"
@@ -28,9 +30,14 @@ import (
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/ant0ine/go-json-rest/rest/test"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/ugorji/go/codec"
 
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
 	"github.com/mendersoftware/go-lib-micro/mongo/oid"
 	"github.com/mendersoftware/go-lib-micro/requestid"
 	"github.com/mendersoftware/go-lib-micro/rest_utils"
@@ -89,7 +96,22 @@ func runTestRequest(t *testing.T, handler http.Handler, req *http.Request, resp
 }
 
 func makeMockApiHandler(t *testing.T, i inventory.InventoryApp) http.Handler {
-	handlers := NewInventoryApiHandlers(i)
+	return makeMockApiHandlerWithConfig(t, i, nil)
+}
+
+func makeMockApiHandlerWithConfig(
+	t *testing.T,
+	i inventory.InventoryApp,
+	config *Config,
+) http.Handler {
+	// the handlers consulting the per-tenant feature flags see no flags
+	// set, unless the test case sets them
+	if inv, ok := i.(*minventory.InventoryApp); ok {
+		inv.On("GetFeatureFlags", mock.Anything).
+			Return(model.FeatureFlags{}, nil).
+			Maybe()
+	}
+	handlers := NewInventoryApiHandlers(i, config)
 	assert.NotNil(t, handlers)
 
 	handler, err := handlers.Build()
@@ -120,6 +142,10 @@ func floatPtr(f float64) *float64 {
 	return &ret
 }
 
+func boolPtr(b bool) *bool {
+	return &b
+}
+
 func timePtr(f string) *time.Time {
 	ret, _ := time.Parse("2006-01-02T15:04:05Z", f)
 	return &ret
@@ -189,9 +215,11 @@ func TestApiParseFilterParams(t *testing.T) {
 	t.Parallel()
 
 	testCases := map[string]struct {
-		inReq   *http.Request
-		filters []store.Filter
-		err     error
+		inReq        *http.Request
+		scopeAliases map[string]string
+		defaultScope string
+		filters      []store.Filter
+		err          error
 	}{
 
 		"eq - short form(implicit)": {
@@ -296,12 +324,61 @@ func TestApiParseFilterParams(t *testing.T) {
 				},
 			},
 		},
+		"eq - short form(implicit), configured default scope": {
+			inReq:        test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices?page=1&per_page=5&attr_name1=A0001", nil),
+			defaultScope: model.AttrScopeIdentity,
+			filters: []store.Filter{
+				{
+					AttrName:  "attr_name1",
+					AttrScope: model.AttrScopeIdentity,
+					Value:     "A0001",
+					Operator:  store.Eq,
+				},
+			},
+		},
+		"eq - with scope, configured default scope": {
+			inReq:        test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices?page=1&per_page=5&inventory/attr_name1=A0001", nil),
+			defaultScope: model.AttrScopeIdentity,
+			filters: []store.Filter{
+				{
+					AttrName:  "attr_name1",
+					AttrScope: model.AttrScopeInventory,
+					Value:     "A0001",
+					Operator:  store.Eq,
+				},
+			},
+		},
+		"eq - short form(implicit), configured default scope alias": {
+			inReq:        test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices?page=1&per_page=5&attr_name1=A0001", nil),
+			scopeAliases: map[string]string{"id": model.AttrScopeIdentity},
+			defaultScope: "id",
+			filters: []store.Filter{
+				{
+					AttrName:  "attr_name1",
+					AttrScope: model.AttrScopeIdentity,
+					Value:     "A0001",
+					Operator:  store.Eq,
+				},
+			},
+		},
+		"eq - scope alias": {
+			inReq:        test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices?page=1&per_page=5&inv/attr_name1=A0001", nil),
+			scopeAliases: map[string]string{"inv": model.AttrScopeInventory},
+			filters: []store.Filter{
+				{
+					AttrName:  "attr_name1",
+					AttrScope: model.AttrScopeInventory,
+					Value:     "A0001",
+					Operator:  store.Eq,
+				},
+			},
+		},
 	}
 
 	for name, testCase := range testCases {
 		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
 			req := rest.Request{Request: testCase.inReq}
-			filters, err := parseFilterParams(&req)
+			filters, err := parseFilterParams(&req, testCase.scopeAliases, testCase.defaultScope)
 			if testCase.err != nil {
 				assert.Error(t, testCase.err, err.Error())
 			} else {
@@ -315,6 +392,92 @@ func TestApiParseFilterParams(t *testing.T) {
 	}
 }
 
+func TestApiParseSortParam(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		query        string
+		scopeAliases map[string]string
+		defaultScope string
+		lenientOrder bool
+		sort         *store.Sort
+		err          error
+	}{
+		"no sort": {
+			query: "page=1",
+		},
+		"unscoped": {
+			query: "sort=attr_name1:asc",
+			sort: &store.Sort{
+				AttrName:  "attr_name1",
+				AttrScope: model.AttrScopeInventory,
+				Ascending: true,
+			},
+		},
+		"unscoped, configured default scope": {
+			query:        "sort=attr_name1:desc",
+			defaultScope: model.AttrScopeIdentity,
+			sort: &store.Sort{
+				AttrName:  "attr_name1",
+				AttrScope: model.AttrScopeIdentity,
+			},
+		},
+		"unscoped, configured default scope alias": {
+			query:        "sort=attr_name1",
+			scopeAliases: map[string]string{"id": model.AttrScopeIdentity},
+			defaultScope: "id",
+			sort: &store.Sort{
+				AttrName:  "attr_name1",
+				AttrScope: model.AttrScopeIdentity,
+			},
+		},
+		"scoped, configured default scope": {
+			query:        "sort=tags/attr_name1:asc",
+			defaultScope: model.AttrScopeIdentity,
+			sort: &store.Sort{
+				AttrName:  "attr_name1",
+				AttrScope: model.AttrScopeTags,
+				Ascending: true,
+			},
+		},
+		"invalid order": {
+			query: "sort=attr_name1:gte",
+			err:   errors.New("invalid sort order"),
+		},
+		"invalid order, lenient": {
+			query:        "sort=attr_name1:gte",
+			lenientOrder: true,
+			sort: &store.Sort{
+				AttrName:  "attr_name1",
+				AttrScope: model.AttrScopeInventory,
+				Ascending: true,
+			},
+		},
+		"desc, lenient": {
+			query:        "sort=attr_name1:desc",
+			lenientOrder: true,
+			sort: &store.Sort{
+				AttrName:  "attr_name1",
+				AttrScope: model.AttrScopeInventory,
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req := rest.Request{Request: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/0.1.0/devices?"+tc.query, nil)}
+			sort, err := parseSortParam(&req, tc.scopeAliases, tc.defaultScope, tc.lenientOrder)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.sort, sort)
+			}
+		})
+	}
+}
+
 func TestApiInventoryGetDevices(t *testing.T) {
 	t.Parallel()
 	rest.ErrorFieldName = "error"
@@ -510,160 +673,644 @@ func TestApiInventoryGetDevices(t *testing.T) {
 	}
 }
 
-func TestApiInventoryAddDevice(t *testing.T) {
+func TestApiInventoryGetDevicesEstimatedCount(t *testing.T) {
 	t.Parallel()
-	rest.ErrorFieldName = "error"
 
 	testCases := map[string]struct {
-		JSONResponseParams
+		url       string
+		estimated bool
+	}{
+		"unfiltered": {
+			url:       "http://1.2.3.4/api/0.1.0/devices?page=1&per_page=5",
+			estimated: true,
+		},
+		"filtered by group": {
+			url: "http://1.2.3.4/api/0.1.0/devices?page=1&per_page=5&group=foo",
+		},
+		"filtered by attribute": {
+			url: "http://1.2.3.4/api/0.1.0/devices?page=1&per_page=5&mac=foo",
+		},
+	}
 
-		inReq *http.Request
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
 
-		inventoryErr error
+			inv.On("ListDevices",
+				contextMatcher(),
+				mock.MatchedBy(func(q store.ListQuery) bool {
+					return q.Unfiltered() == tc.estimated
+				}),
+			).Return(mockListDevices(5), 100, nil)
 
-		deviceAttributes model.DeviceAttributes
+			apih := makeMockApiHandler(t, &inv)
+
+			req := test.MakeSimpleRequest("GET", tc.url, nil)
+			recorded := test.RunRequest(t, apih, req)
+			recorded.CodeIs(http.StatusOK)
+			recorded.HeaderIs(hdrTotalCount, "100")
+			if tc.estimated {
+				recorded.HeaderIs(hdrTotalCountEstimated, "true")
+			} else {
+				assert.Empty(t, recorded.Recorder.Header().Get(hdrTotalCountEstimated))
+			}
+		})
+	}
+}
+
+func TestApiInventoryMaxResponseBytes(t *testing.T) {
+	t.Parallel()
+
+	// devices of about 1kB each once JSON encoded
+	devs := make([]model.Device, 4)
+	for i := range devs {
+		devs[i] = model.Device{
+			ID: model.DeviceID(strconv.Itoa(i)),
+			Attributes: model.DeviceAttributes{{
+				Name:  "description",
+				Value: strings.Repeat("x", 1000),
+				Scope: model.AttrScopeInventory,
+			}},
+		}
+	}
+
+	testCases := map[string]struct {
+		maxBytes int
+		method   string
+		url      string
+
+		outDevices int
+		outHeader  string
 	}{
-		"empty body": {
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
-				nil),
-			inventoryErr: nil,
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("failed to decode request body: JSON payload is empty"),
+		"search, no limit": {
+			method:     "POST",
+			url:        "http://1.2.3.4/api/management/v2/inventory/filters/search",
+			outDevices: 4,
+		},
+		"search, page fits": {
+			maxBytes:   1 << 20,
+			method:     "POST",
+			url:        "http://1.2.3.4/api/management/v2/inventory/filters/search",
+			outDevices: 4,
+		},
+		"search, page reduced": {
+			maxBytes:   2500,
+			method:     "POST",
+			url:        "http://1.2.3.4/api/management/v2/inventory/filters/search",
+			outDevices: 2,
+			outHeader:  "2",
+		},
+		"search, single device over the limit": {
+			maxBytes:   100,
+			method:     "POST",
+			url:        "http://1.2.3.4/api/management/v2/inventory/filters/search",
+			outDevices: 1,
+			outHeader:  "1",
+		},
+		"internal search, page reduced": {
+			maxBytes:   2500,
+			method:     "POST",
+			url:        "http://1.2.3.4/api/internal/v2/inventory/tenants/foo/filters/search",
+			outDevices: 2,
+			outHeader:  "2",
+		},
+		"legacy listing, page reduced": {
+			maxBytes:   3500,
+			method:     "GET",
+			url:        "http://1.2.3.4/api/0.1.0/devices?page=1&per_page=4",
+			outDevices: 3,
+			outHeader:  "3",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			var body interface{}
+			if tc.method == "POST" {
+				inv.On("SearchDevices", mock.Anything,
+					mock.AnythingOfType("model.SearchParams"),
+				).Return(devs, 10, nil)
+				body = model.SearchParams{}
+			} else {
+				inv.On("ListDevices", contextMatcher(),
+					mock.AnythingOfType("store.ListQuery"),
+				).Return(devs, 10, nil)
+			}
+
+			config := NewConfig()
+			config.MaxResponseBytes = tc.maxBytes
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+			req := test.MakeSimpleRequest(tc.method, tc.url, body)
+			recorded := test.RunRequest(t, apih, req)
+			recorded.CodeIs(http.StatusOK)
+			recorded.HeaderIs(hdrTotalCount, "10")
+			assert.Equal(t, tc.outHeader,
+				recorded.Recorder.Header().Get(hdrPageReduced))
+
+			var res []model.Device
+			err := json.Unmarshal(recorded.Recorder.Body.Bytes(), &res)
+			assert.NoError(t, err)
+			assert.Len(t, res, tc.outDevices)
+			if tc.maxBytes > 0 && tc.outDevices > 1 {
+				assert.LessOrEqual(t, recorded.Recorder.Body.Len(), tc.maxBytes)
+			}
+		})
+	}
+}
+
+func TestApiInventoryMaxResponseBytesPageLinks(t *testing.T) {
+	t.Parallel()
+
+	// devices of varying sizes, between about 200B and 1kB once JSON
+	// encoded
+	devs := make([]model.Device, 17)
+	for i := range devs {
+		devs[i] = model.Device{
+			ID: model.DeviceID(fmt.Sprintf("%02d", i)),
+			Attributes: model.DeviceAttributes{{
+				Name:  "description",
+				Value: strings.Repeat("x", 200*(i%5+1)),
+				Scope: model.AttrScopeInventory,
+			}},
+		}
+	}
+
+	inv := minventory.InventoryApp{}
+	inv.On("ListDevices", contextMatcher(),
+		mock.AnythingOfType("store.ListQuery"),
+	).Return(
+		func(_ context.Context, q store.ListQuery) []model.Device {
+			if q.Skip >= len(devs) {
+				return []model.Device{}
+			}
+			end := q.Skip + q.Limit
+			if end > len(devs) {
+				end = len(devs)
+			}
+			return devs[q.Skip:end]
+		},
+		len(devs),
+		nil,
+	)
+
+	config := NewConfig()
+	config.MaxResponseBytes = 2500
+	apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+	nextLink := regexp.MustCompile(`^<([^>]*)>; rel="next"$`)
+	seen := map[model.DeviceID]int{}
+	url := "http://1.2.3.4/api/0.1.0/devices?page=1&per_page=5"
+	for pages := 0; url != ""; pages++ {
+		if !assert.Less(t, pages, len(devs), "too many pages") {
+			return
+		}
+
+		recorded := test.RunRequest(t, apih, test.MakeSimpleRequest("GET", url, nil))
+		recorded.CodeIs(http.StatusOK)
+		var res []model.Device
+		err := json.Unmarshal(recorded.Recorder.Body.Bytes(), &res)
+		if !assert.NoError(t, err) {
+			return
+		}
+		for _, dev := range res {
+			seen[dev.ID]++
+		}
+
+		url = ""
+		for _, link := range recorded.Recorder.Header()["Link"] {
+			if m := nextLink.FindStringSubmatch(link); m != nil {
+				url = "http://1.2.3.4/api/0.1.0/" + m[1]
+			}
+		}
+	}
+
+	assert.Len(t, seen, len(devs))
+	for id, count := range seen {
+		assert.Equal(t, 1, count, "device %s returned %d times", id, count)
+	}
+}
+
+func TestApiInventoryMaxPageOffset(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const (
+		urlList   = "http://1.2.3.4/api/0.1.0/devices"
+		urlSearch = "http://1.2.3.4/api/management/v2/inventory/filters/search"
+	)
+
+	testCases := map[string]struct {
+		inReq  *http.Request
+		method string
+
+		resp JSONResponseParams
+	}{
+		"list, at the limit": {
+			inReq:  test.MakeSimpleRequest("GET", urlList+"?page=5&per_page=5", nil),
+			method: "ListDevices",
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: mockListDevices(1),
 			},
 		},
-		"garbled body": {
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
-				"foo bar"),
-			inventoryErr: nil,
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("failed to decode request body: json: cannot unmarshal string into Go value of type model.Device"),
+		"list, past the limit": {
+			inReq: test.MakeSimpleRequest("GET", urlList+"?page=6&per_page=5", nil),
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError("page offset 25 exceeds the limit of 20: " +
+					"use keyset pagination instead, sorting the devices and " +
+					"filtering on the values past the last device of the previous page"),
 			},
 		},
-		"body formatted ok, all fields present": {
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
-				map[string]interface{}{
-					"id": "id-0001",
-					"attributes": []map[string]interface{}{
-						{"name": "a1", "value": "00:00:00:01", "description": "ddd"},
-						{"name": "a2", "value": 123.2, "description": "ddd"},
-						{"name": "a3", "value": []interface{}{"00:00:00:01", "00"}, "description": "ddd"},
-					},
-				},
-			),
-			inventoryErr: nil,
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusCreated,
-				OutputBodyObject: nil,
-				OutputHeaders:    map[string][]string{"Location": {"devices/id-0001"}},
+		"search, at the limit": {
+			inReq: test.MakeSimpleRequest("POST", urlSearch,
+				model.SearchParams{Page: 3, PerPage: 10}),
+			method: "SearchDevices",
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: mockListDevices(1),
 			},
-			deviceAttributes: model.DeviceAttributes{
-				{Name: "a1", Value: "00:00:00:01", Description: strPtr("ddd"), Scope: model.AttrScopeInventory},
-				{Name: "a2", Value: 123.2, Description: strPtr("ddd"), Scope: model.AttrScopeInventory},
-				{Name: "a3", Value: []interface{}{"00:00:00:01", "00"}, Description: strPtr("ddd"), Scope: model.AttrScopeInventory},
+		},
+		"search, past the limit": {
+			inReq: test.MakeSimpleRequest("POST", urlSearch,
+				model.SearchParams{Page: 4, PerPage: 10}),
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError("page offset 30 exceeds the limit of 20: " +
+					"use keyset pagination instead, sorting the devices and " +
+					"filtering on the values past the last device of the previous page"),
 			},
 		},
-		"body formatted ok, all fields present, attributes with scope": {
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
-				map[string]interface{}{
-					"id": "id-0001",
-					"attributes": []map[string]interface{}{
-						{"name": "a1", "value": "00:00:00:01", "description": "ddd", "scope": model.AttrScopeInventory},
-						{"name": "a2", "value": 123.2, "description": "ddd", "scope": model.AttrScopeInventory},
-						{"name": "a3", "value": []interface{}{"00:00:00:01", "00"}, "description": "ddd", "scope": model.AttrScopeInventory},
-					},
-				},
-			),
-			inventoryErr: nil,
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusCreated,
-				OutputBodyObject: nil,
-				OutputHeaders:    map[string][]string{"Location": {"devices/id-0001"}},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.method != "" {
+				inv.On(tc.method, contextMatcher(), mock.Anything).
+					Return(mockListDevices(1), 21, nil)
+			}
+
+			config := NewConfig()
+			config.MaxPageOffset = 20
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+			runTestRequest(t, apih, tc.inReq, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryMaxLinkPage(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const (
+		urlList   = "http://1.2.3.4/api/0.1.0/devices"
+		urlFilter = "http://1.2.3.4/api/management/v2/inventory/filters/1/devices"
+	)
+
+	testCases := map[string]struct {
+		inReq  *http.Request
+		method string
+
+		links  []string
+		capped string
+	}{
+		"list, within the cap": {
+			inReq:  test.MakeSimpleRequest("GET", urlList+"?page=2&per_page=5", nil),
+			method: "ListDevices",
+			links: []string{
+				fmt.Sprintf(utils.LinkTmpl, "devices", "page=1&per_page=5", "prev"),
+				fmt.Sprintf(utils.LinkTmpl, "devices", "page=3&per_page=5", "next"),
+				fmt.Sprintf(utils.LinkTmpl, "devices", "page=1&per_page=5", "first"),
 			},
-			deviceAttributes: model.DeviceAttributes{
-				{Name: "a1", Value: "00:00:00:01", Description: strPtr("ddd"), Scope: model.AttrScopeInventory},
-				{Name: "a2", Value: 123.2, Description: strPtr("ddd"), Scope: model.AttrScopeInventory},
-				{Name: "a3", Value: []interface{}{"00:00:00:01", "00"}, Description: strPtr("ddd"), Scope: model.AttrScopeInventory},
+		},
+		"list, at the cap": {
+			inReq:  test.MakeSimpleRequest("GET", urlList+"?page=3&per_page=5", nil),
+			method: "ListDevices",
+			links: []string{
+				fmt.Sprintf(utils.LinkTmpl, "devices", "page=2&per_page=5", "prev"),
+				fmt.Sprintf(utils.LinkTmpl, "devices", "page=1&per_page=5", "first"),
 			},
+			capped: "3",
 		},
-		"body formatted ok, wrong attributes type": {
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
-				map[string]interface{}{
-					"id":         "id-0001",
-					"attributes": 123,
-				},
-			),
-			inventoryErr: nil,
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("failed to decode request body: json: cannot unmarshal number into Go struct field Device.attributes of type []model.DeviceAttribute"),
+		"list, past the cap": {
+			inReq:  test.MakeSimpleRequest("GET", urlList+"?page=5&per_page=5", nil),
+			method: "ListDevices",
+			links: []string{
+				fmt.Sprintf(utils.LinkTmpl, "devices", "page=1&per_page=5", "first"),
 			},
+			capped: "3",
 		},
-		"body formatted ok, 'id' missing": {
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
-				map[string]interface{}{},
-			),
-			inventoryErr: nil,
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("id: cannot be blank."),
+		"saved filter, within the cap": {
+			inReq:  test.MakeSimpleRequest("GET", urlFilter+"?page=2&per_page=5", nil),
+			method: "SearchDevices",
+			links: []string{
+				fmt.Sprintf(utils.LinkTmpl, "devices", "page=1&per_page=5", "prev"),
+				fmt.Sprintf(utils.LinkTmpl, "devices", "page=3&per_page=5", "next"),
+				fmt.Sprintf(utils.LinkTmpl, "devices", "page=1&per_page=5", "first"),
 			},
 		},
-		"body formatted ok, incorrect attribute value": {
+		"saved filter, past the cap": {
+			inReq:  test.MakeSimpleRequest("GET", urlFilter+"?page=5&per_page=5", nil),
+			method: "SearchDevices",
+			links: []string{
+				fmt.Sprintf(utils.LinkTmpl, "devices", "page=1&per_page=5", "first"),
+			},
+			capped: "3",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.method == "SearchDevices" {
+				inv.On("GetSavedFilter", contextMatcher(), "1").
+					Return(&model.SavedFilter{ID: "1", Name: "foo"}, nil)
+			}
+			inv.On(tc.method, contextMatcher(), mock.Anything).
+				Return(mockListDevices(5), 50, nil)
+
+			config := NewConfig()
+			config.MaxLinkPage = 3
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+			tc.inReq.Header.Add(requestid.RequestIdHeader, "test")
+			recorded := test.RunRequest(t, apih, tc.inReq)
+			recorded.CodeIs(http.StatusOK)
+			assert.Equal(t, tc.links, recorded.Recorder.Header()["Link"])
+			assert.Equal(t, tc.capped,
+				recorded.Recorder.Header().Get(hdrPageLinksCapped))
+		})
+	}
+}
+
+func TestApiInventoryDefaultProjection(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const (
+		urlList   = "http://1.2.3.4/api/0.1.0/devices"
+		urlSearch = "http://1.2.3.4/api/management/v2/inventory/filters/search"
+		urlFilter = "http://1.2.3.4/api/management/v2/inventory/filters/1/devices"
+	)
+
+	projection := []model.SelectAttribute{
+		{Scope: model.AttrScopeIdentity, Attribute: "mac"},
+		{Scope: model.AttrScopeInventory, Attribute: "device_type"},
+	}
+	selected := []model.SelectAttribute{
+		{Scope: model.AttrScopeInventory, Attribute: "kernel"},
+	}
+
+	testCases := map[string]struct {
+		inReq  *http.Request
+		method string
+
+		attributes []model.SelectAttribute
+		status     int
+	}{
+		"list, default projection": {
+			inReq:      test.MakeSimpleRequest("GET", urlList, nil),
+			method:     "ListDevices",
+			attributes: projection,
+			status:     http.StatusOK,
+		},
+		"list, all attributes": {
+			inReq:  test.MakeSimpleRequest("GET", urlList+"?all_attributes=true", nil),
+			method: "ListDevices",
+			status: http.StatusOK,
+		},
+		"search, default projection": {
+			inReq:      test.MakeSimpleRequest("POST", urlSearch, map[string]interface{}{}),
+			method:     "SearchDevices",
+			attributes: projection,
+			status:     http.StatusOK,
+		},
+		"search, selected attributes": {
+			inReq: test.MakeSimpleRequest("POST", urlSearch, map[string]interface{}{
+				"attributes": selected,
+			}),
+			method:     "SearchDevices",
+			attributes: selected,
+			status:     http.StatusOK,
+		},
+		"search, all attributes": {
+			inReq: test.MakeSimpleRequest("POST", urlSearch+"?all_attributes=true",
+				map[string]interface{}{}),
+			method: "SearchDevices",
+			status: http.StatusOK,
+		},
+		"saved filter, default projection": {
+			inReq:      test.MakeSimpleRequest("GET", urlFilter, nil),
+			method:     "SearchDevices",
+			attributes: projection,
+			status:     http.StatusOK,
+		},
+		"ko, invalid all attributes": {
+			inReq:  test.MakeSimpleRequest("GET", urlList+"?all_attributes=foo", nil),
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			switch tc.method {
+			case "ListDevices":
+				inv.On("ListDevices", contextMatcher(),
+					mock.MatchedBy(func(q store.ListQuery) bool {
+						return assert.ObjectsAreEqual(tc.attributes, q.Attributes)
+					}),
+				).Return(mockListDevices(1), 1, nil)
+			case "SearchDevices":
+				inv.On("GetSavedFilter", contextMatcher(), "1").
+					Return(&model.SavedFilter{ID: "1", Name: "foo"}, nil).
+					Maybe()
+				inv.On("SearchDevices", contextMatcher(),
+					mock.MatchedBy(func(p model.SearchParams) bool {
+						return assert.ObjectsAreEqual(tc.attributes, p.Attributes)
+					}),
+				).Return(mockListDevices(1), 1, nil)
+			}
+
+			config := NewConfig()
+			config.DefaultProjection = []string{"identity/mac", "inventory/device_type"}
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+			tc.inReq.Header.Add(requestid.RequestIdHeader, "test")
+			recorded := test.RunRequest(t, apih, tc.inReq)
+			recorded.CodeIs(tc.status)
+		})
+	}
+}
+
+func TestApiInventoryDefaultProjectionInvalid(t *testing.T) {
+	t.Parallel()
+
+	config := NewConfig()
+	config.DefaultProjection = []string{"mac"}
+	handlers := NewInventoryApiHandlers(&minventory.InventoryApp{}, config)
+
+	_, err := handlers.Build()
+	assert.EqualError(t, err,
+		`invalid default projection attribute "mac": expected <scope>/<name>`)
+}
+
+func TestApiInventorySearchCountLimit(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const (
+		urlSearch   = "http://1.2.3.4/api/management/v2/inventory/filters/search"
+		urlInternal = "http://1.2.3.4/api/internal/v2/inventory/tenants/foo/filters/search"
+	)
+
+	testCases := map[string]struct {
+		inReq *http.Request
+
+		countLimit int
+		totalCount int
+
+		estimated string
+	}{
+		"estimated, limit reached": {
+			inReq: test.MakeSimpleRequest("POST", urlSearch,
+				map[string]interface{}{"estimate_count": true}),
+			countLimit: 100,
+			totalCount: 100,
+			estimated:  "true",
+		},
+		"estimated, below the limit": {
+			inReq: test.MakeSimpleRequest("POST", urlSearch,
+				map[string]interface{}{"estimate_count": true}),
+			countLimit: 100,
+			totalCount: 42,
+			estimated:  "false",
+		},
+		"estimated, internal": {
+			inReq: test.MakeSimpleRequest("POST", urlInternal,
+				map[string]interface{}{"estimate_count": true}),
+			countLimit: 100,
+			totalCount: 100,
+			estimated:  "true",
+		},
+		"exact": {
+			inReq:      test.MakeSimpleRequest("POST", urlSearch, map[string]interface{}{}),
+			totalCount: 1000,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			inv.On("SearchDevices", mock.Anything,
+				mock.MatchedBy(func(params model.SearchParams) bool {
+					return params.CountLimit == tc.countLimit
+				}),
+			).Return(mockListDevices(5), tc.totalCount, nil)
+
+			config := NewConfig()
+			config.SearchCountLimit = 100
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+			tc.inReq.Header.Add(requestid.RequestIdHeader, "test")
+			recorded := test.RunRequest(t, apih, tc.inReq)
+			recorded.CodeIs(http.StatusOK)
+			assert.Equal(t, strconv.Itoa(tc.totalCount),
+				recorded.Recorder.Header().Get(hdrTotalCount))
+			assert.Equal(t, tc.estimated,
+				recorded.Recorder.Header().Get(hdrTotalCountEstimated))
+		})
+	}
+}
+
+func TestApiInventoryGetDevicesByAnyTag(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	testCases := map[string]struct {
+		inReq      *http.Request
+		query      *store.ListQuery
+		devices    []model.Device
+		totalCount int
+		err        error
+		resp       JSONResponseParams
+	}{
+		"ok": {
 			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
-				map[string]interface{}{
-					"id": "id-0001",
-					"attributes": []map[string]interface{}{
-						{"name": "asd", "value": []interface{}{"asd", 123}},
-						{"name": "asd2", "value": []interface{}{123, "asd"}},
+				"http://1.2.3.4/api/0.1.0/devices/by-any-tag?page=1&per_page=2",
+				[]string{"env", "owner"}),
+			query: &store.ListQuery{
+				Skip:    0,
+				Limit:   2,
+				AnyTags: []string{"env", "owner"},
+			},
+			devices:    mockListDevices(2),
+			totalCount: 3,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: mockListDevices(2),
+				OutputHeaders: map[string][]string{
+					"Link": {
+						fmt.Sprintf(utils.LinkTmpl, "by-any-tag", "page=2&per_page=2", "next"),
+						fmt.Sprintf(utils.LinkTmpl, "by-any-tag", "page=1&per_page=2", "first"),
 					},
+					hdrTotalCount: {"3"},
 				},
-			),
-			inventoryErr: nil,
-			JSONResponseParams: JSONResponseParams{
+			},
+		},
+		"error, empty body": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/0.1.0/devices/by-any-tag",
+				nil),
+			resp: JSONResponseParams{
 				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("attributes: (value: array values must be of consistent type: string or float64.)."),
+				OutputBodyObject: RestError("failed to decode request body: JSON payload is empty"),
 			},
 		},
-		"body formatted ok, attribute name missing": {
+		"error, no tags": {
 			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
-				map[string]interface{}{
-					"id": "id-0001",
-					"attributes": []map[string]interface{}{
-						{"value": "23"},
-					},
-				},
-			),
-			inventoryErr: nil,
-			JSONResponseParams: JSONResponseParams{
+				"http://1.2.3.4/api/0.1.0/devices/by-any-tag",
+				[]string{}),
+			resp: JSONResponseParams{
 				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("attributes: (name: cannot be blank.)."),
+				OutputBodyObject: RestError("cannot be blank"),
 			},
 		},
-		"body formatted ok, inv error": {
+		"error, blank tag": {
 			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
-				map[string]interface{}{
-					"id": "id-0001",
-					"attributes": []map[string]interface{}{
-						{
-							"name":  "name1",
-							"value": "value4",
-						},
-					},
-				},
-			),
-			inventoryErr: errors.New("internal error"),
-			JSONResponseParams: JSONResponseParams{
+				"http://1.2.3.4/api/0.1.0/devices/by-any-tag",
+				[]string{"env", ""}),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("1: cannot be blank."),
+			},
+		},
+		"error, internal": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/0.1.0/devices/by-any-tag",
+				[]string{"env"}),
+			query: &store.ListQuery{
+				Skip:    0,
+				Limit:   utils.PerPageDefault,
+				AnyTags: []string{"env"},
+			},
+			err: errors.New("internal error"),
+			resp: JSONResponseParams{
 				OutputStatus:     http.StatusInternalServerError,
 				OutputBodyObject: RestError("internal error"),
 			},
@@ -671,964 +1318,607 @@ func TestApiInventoryAddDevice(t *testing.T) {
 	}
 
 	for name, tc := range testCases {
-		t.Logf("test case: %s", name)
-		inv := minventory.InventoryApp{}
-
-		ctx := contextMatcher()
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
 
-		inv.On("AddDevice",
-			ctx,
-			mock.MatchedBy(
-				func(dev *model.Device) bool {
-					if tc.deviceAttributes != nil {
-						if !reflect.DeepEqual(tc.deviceAttributes, dev.Attributes) {
-							assert.FailNow(t, "", "attributes not equal: %v \n%v\n", tc.deviceAttributes, dev.Attributes)
-						}
-					}
-					return true
-				},
-			),
-		).Return(tc.inventoryErr)
+			if tc.query != nil {
+				inv.On("ListDevices", contextMatcher(), *tc.query).
+					Return(tc.devices, tc.totalCount, tc.err)
+			}
 
-		apih := makeMockApiHandler(t, &inv)
+			apih := makeMockApiHandler(t, &inv)
 
-		runTestRequest(t, apih, tc.inReq, tc.JSONResponseParams)
+			runTestRequest(t, apih, tc.inReq, tc.resp)
+		})
 	}
 }
 
-func TestApiInventoryUpdateDeviceTags(t *testing.T) {
+func TestApiInventoryGetDevicesPartitionedByGroup(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const url = "http://1.2.3.4/api/management/v2/inventory/devices/by-group"
 
 	testCases := map[string]struct {
-		inReq         *http.Request
-		inHdrs        map[string]string
-		deviceID      model.DeviceID
-		attrsToUpsert model.DeviceAttributes
-		scope         string
-		etag          string
-		inventoryErr  error
-		resp          JSONResponseParams
+		url      string
+		query    *store.ListQuery
+		perGroup int
+		groups   map[model.GroupName][]model.DeviceID
+		err      error
+		resp     JSONResponseParams
 	}{
-		"Replace tags, PUT, failed ETag": {
-			inReq: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/0.1.0/devices/:id/tags",
-				[]model.DeviceAttribute{
-					{
-						Name:  "tag_1",
-						Value: "value_1",
-					},
-					{
-						Name:  "tag_2",
-						Value: "value_2",
-					},
-				},
-			),
-			deviceID: "ad22a170-37b5-4c8b-9eab-612bad1eac19",
-			inHdrs: map[string]string{
-				"If-Match": "f7238315-062d-4440-875a-676006f84c34",
+		"ok": {
+			url: url,
+			query: &store.ListQuery{
+				Limit:   devicesByGroupLimitDefault,
+				Filters: []store.Filter{},
 			},
-			attrsToUpsert: model.DeviceAttributes{
-				{Name: "tag_1", Value: "value_1", Scope: model.AttrScopeTags},
-				{Name: "tag_2", Value: "value_2", Scope: model.AttrScopeTags},
+			perGroup: devicesByGroupPerGroupDefault,
+			groups: map[model.GroupName][]model.DeviceID{
+				"foo": {"1", "3"},
+				"bar": {"2"},
+				"":    {"4", "5"},
 			},
-			scope:        model.AttrScopeTags,
-			inventoryErr: inventory.ErrETagDoesntMatch,
-			etag:         "f7238315-062d-4440-875a-676006f84c34",
 			resp: JSONResponseParams{
-				OutputStatus:     http.StatusPreconditionFailed,
-				OutputBodyObject: RestError("ETag does not match"),
+				OutputStatus: http.StatusOK,
+				OutputBodyObject: map[string][]string{
+					"foo":       {"1", "3"},
+					"bar":       {"2"},
+					"ungrouped": {"4", "5"},
+				},
 			},
 		},
-		"ok, replace tags, PUT, with ETag": {
-			inReq: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/0.1.0/devices/:id/tags",
-				[]model.DeviceAttribute{
-					{
-						Name:  "tag_1",
-						Value: "value_1",
-					},
-					{
-						Name:  "tag_2",
-						Value: "value_2",
-					},
-				},
-			),
-			deviceID: "ad22a170-37b5-4c8b-9eab-612bad1eac19",
-			inHdrs: map[string]string{
-				"If-Match": "f7238315-062d-4440-875a-676006f84c34",
+		"ok, filtered and capped": {
+			url: url + "?per_group=2&limit=10&inventory/device_type=rpi3&has_group=true",
+			query: &store.ListQuery{
+				Limit: 10,
+				Filters: []store.Filter{{
+					AttrName:  "device_type",
+					AttrScope: model.AttrScopeInventory,
+					Value:     "rpi3",
+					Operator:  store.Eq,
+				}},
+				HasGroup: boolPtr(true),
 			},
-			attrsToUpsert: model.DeviceAttributes{
-				{Name: "tag_1", Value: "value_1", Scope: model.AttrScopeTags},
-				{Name: "tag_2", Value: "value_2", Scope: model.AttrScopeTags},
+			perGroup: 2,
+			groups: map[model.GroupName][]model.DeviceID{
+				"foo": {"1", "3"},
 			},
-			scope:        model.AttrScopeTags,
-			inventoryErr: nil,
-			etag:         "f7238315-062d-4440-875a-676006f84c34",
 			resp: JSONResponseParams{
 				OutputStatus: http.StatusOK,
+				OutputBodyObject: map[string][]string{
+					"foo": {"1", "3"},
+				},
 			},
 		},
-		"ok, replace tags, PUT, without ETag": {
-			inReq: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/0.1.0/devices/:id/tags",
-				[]model.DeviceAttribute{
-					{
-						Name:  "tag_1",
-						Value: "value_1",
-					},
-					{
-						Name:  "tag_2",
-						Value: "value_2",
-					},
-				},
-			),
-			deviceID: "ad22a170-37b5-4c8b-9eab-612bad1eac19",
-			attrsToUpsert: model.DeviceAttributes{
-				{Name: "tag_1", Value: "value_1", Scope: model.AttrScopeTags},
-				{Name: "tag_2", Value: "value_2", Scope: model.AttrScopeTags},
+		"ok, no devices": {
+			url: url,
+			query: &store.ListQuery{
+				Limit:   devicesByGroupLimitDefault,
+				Filters: []store.Filter{},
 			},
-			scope:        model.AttrScopeTags,
-			inventoryErr: nil,
-			etag:         "",
+			perGroup: devicesByGroupPerGroupDefault,
+			groups:   map[model.GroupName][]model.DeviceID{},
 			resp: JSONResponseParams{
-				OutputStatus: http.StatusOK,
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: map[string][]string{},
 			},
 		},
-		"Upsert tags, PATCH, failed ETag": {
-			inReq: test.MakeSimpleRequest("PATCH",
-				"http://1.2.3.4/api/0.1.0/devices/:id/tags",
-				[]model.DeviceAttribute{
-					{
-						Name:  "tag_1",
-						Value: "value_1",
-					},
-					{
-						Name:  "tag_2",
-						Value: "value_2",
-					},
-				},
-			),
-			deviceID: "ad22a170-37b5-4c8b-9eab-612bad1eac19",
-			inHdrs: map[string]string{
-				"If-Match": "f7238315-062d-4440-875a-676006f84c34",
-			},
-			attrsToUpsert: model.DeviceAttributes{
-				{Name: "tag_1", Value: "value_1", Scope: model.AttrScopeTags},
-				{Name: "tag_2", Value: "value_2", Scope: model.AttrScopeTags},
-			},
-			scope:        model.AttrScopeTags,
-			inventoryErr: inventory.ErrETagDoesntMatch,
-			etag:         "f7238315-062d-4440-875a-676006f84c34",
-			resp: JSONResponseParams{
-				OutputStatus:     http.StatusPreconditionFailed,
-				OutputBodyObject: RestError("ETag does not match"),
+		"error, per group out of bounds": {
+			url: url + "?per_group=1000",
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError(utils.MsgQueryParmLimit(queryParamPerGroup)),
 			},
 		},
-		"ok, upsert tags, PATCH, with ETag": {
-			inReq: test.MakeSimpleRequest("PATCH",
-				"http://1.2.3.4/api/0.1.0/devices/:id/tags",
-				[]model.DeviceAttribute{
-					{
-						Name:  "tag_1",
-						Value: "value_1",
-					},
-					{
-						Name:  "tag_2",
-						Value: "value_2",
-					},
-				},
-			),
-			deviceID: "ad22a170-37b5-4c8b-9eab-612bad1eac19",
-			inHdrs: map[string]string{
-				"If-Match": "f7238315-062d-4440-875a-676006f84c34",
-			},
-			attrsToUpsert: model.DeviceAttributes{
-				{Name: "tag_1", Value: "value_1", Scope: model.AttrScopeTags},
-				{Name: "tag_2", Value: "value_2", Scope: model.AttrScopeTags},
-			},
-			scope:        model.AttrScopeTags,
-			inventoryErr: nil,
-			etag:         "f7238315-062d-4440-875a-676006f84c34",
+		"error, invalid limit": {
+			url: url + "?limit=foo",
 			resp: JSONResponseParams{
-				OutputStatus: http.StatusOK,
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError(utils.MsgQueryParmInvalid(queryParamLimit)),
 			},
 		},
-		"ok, upsert tags, PATCH, without ETag": {
-			inReq: test.MakeSimpleRequest("PATCH",
-				"http://1.2.3.4/api/0.1.0/devices/:id/tags",
-				[]model.DeviceAttribute{
-					{
-						Name:  "tag_1",
-						Value: "value_1",
-					},
-					{
-						Name:  "tag_2",
-						Value: "value_2",
-					},
-				},
-			),
-			deviceID: "ad22a170-37b5-4c8b-9eab-612bad1eac19",
-			attrsToUpsert: model.DeviceAttributes{
-				{Name: "tag_1", Value: "value_1", Scope: model.AttrScopeTags},
-				{Name: "tag_2", Value: "value_2", Scope: model.AttrScopeTags},
+		"error, internal": {
+			url: url,
+			query: &store.ListQuery{
+				Limit:   devicesByGroupLimitDefault,
+				Filters: []store.Filter{},
 			},
-			scope:        model.AttrScopeTags,
-			inventoryErr: nil,
-			etag:         "",
+			perGroup: devicesByGroupPerGroupDefault,
+			err:      errors.New("internal error"),
 			resp: JSONResponseParams{
-				OutputStatus: http.StatusOK,
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
 			},
 		},
 	}
 
 	for name, tc := range testCases {
-		t.Logf("test case: %s", name)
-		inv := minventory.InventoryApp{}
-		ctx := contextMatcher()
-
-		if tc.inReq.Method == http.MethodPatch {
-			inv.On("UpsertAttributesWithUpdated",
-				ctx,
-				tc.deviceID,
-				mock.MatchedBy(
-					func(attrs model.DeviceAttributes) bool {
-						if tc.attrsToUpsert != nil {
-							for k, _ := range tc.attrsToUpsert {
-								assert.Equal(t, tc.attrsToUpsert[k].Name, attrs[k].Name)
-								assert.Equal(t, tc.attrsToUpsert[k].Value, attrs[k].Value)
-								assert.Equal(t, tc.attrsToUpsert[k].Description, attrs[k].Description)
-								assert.Equal(t, tc.attrsToUpsert[k].Scope, attrs[k].Scope)
-							}
-						}
-						return true
-					},
-				),
-				tc.scope,
-				tc.etag,
-			).Return(tc.inventoryErr)
-		} else {
-			inv.On("ReplaceAttributes",
-				ctx,
-				tc.deviceID,
-				mock.MatchedBy(
-					func(attrs model.DeviceAttributes) bool {
-						if tc.attrsToUpsert != nil {
-							for k, _ := range tc.attrsToUpsert {
-								assert.Equal(t, tc.attrsToUpsert[k].Name, attrs[k].Name)
-								assert.Equal(t, tc.attrsToUpsert[k].Value, attrs[k].Value)
-								assert.Equal(t, tc.attrsToUpsert[k].Description, attrs[k].Description)
-								assert.Equal(t, tc.attrsToUpsert[k].Scope, attrs[k].Scope)
-							}
-						}
-						return true
-					},
-				),
-				tc.scope,
-				tc.etag,
-			).Return(tc.inventoryErr)
-		}
-
-		apih := makeMockApiHandler(t, &inv)
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
 
-		if tc.inHdrs != nil {
-			for k, v := range tc.inHdrs {
-				tc.inReq.Header.Set(k, v)
+			if tc.query != nil {
+				inv.On("ListDevicesPartitionedByGroup",
+					contextMatcher(), *tc.query, tc.perGroup).
+					Return(tc.groups, tc.err)
 			}
-		}
 
-		tc.inReq.URL.Path = strings.Replace(tc.inReq.URL.Path, ":id", tc.deviceID.String(), -1)
-
-		runTestRequest(t, apih, tc.inReq, tc.resp)
+			apih := makeMockApiHandler(t, &inv)
 
+			req := test.MakeSimpleRequest("GET", tc.url, nil)
+			runTestRequest(t, apih, req, tc.resp)
+		})
 	}
 }
 
-func TestApiInventoryUpsertAttributes(t *testing.T) {
+func TestApiInventoryGetDevicesDistinctGroups(t *testing.T) {
 	t.Parallel()
-
 	rest.ErrorFieldName = "error"
 
 	testCases := map[string]struct {
 		inReq  *http.Request
-		inHdrs map[string]string
-
-		scope string
-		etag  string
-
-		inventoryErr error
-
-		resp             JSONResponseParams
-		deviceAttributes model.DeviceAttributes
+		ids    []model.DeviceID
+		groups []model.GroupName
+		err    error
+		config *Config
+		resp   JSONResponseParams
 	}{
-		"no auth": {
-			inReq: test.MakeSimpleRequest("PATCH",
-				"http://1.2.3.4/api/0.1.0/attributes",
-				nil),
-			inventoryErr: nil,
+		"ok": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/0.1.0/devices/groups/distinct",
+				[]string{"1", "2", "3"}),
+			ids:    []model.DeviceID{"1", "2", "3"},
+			groups: []model.GroupName{"bar", "foo"},
 			resp: JSONResponseParams{
-				OutputStatus:     http.StatusUnauthorized,
-				OutputBodyObject: RestError("unauthorized"),
+				OutputStatus: http.StatusOK,
+				OutputBodyObject: InventoryApiDistinctGroups{
+					Groups: []model.GroupName{"bar", "foo"},
+				},
 			},
-			scope: model.AttrScopeInventory,
 		},
-
-		"invalid auth": {
-			inReq: test.MakeSimpleRequest("PATCH",
-				"http://1.2.3.4/api/0.1.0/attributes",
-				nil),
-			inHdrs: map[string]string{
-				"Authorization:": "foobar",
+		"ok, some devices ungrouped": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/0.1.0/devices/groups/distinct",
+				[]string{"1", "2", "3"}),
+			ids:    []model.DeviceID{"1", "2", "3"},
+			groups: []model.GroupName{"", "foo"},
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+				OutputBodyObject: InventoryApiDistinctGroups{
+					Groups:    []model.GroupName{"foo"},
+					Ungrouped: true,
+				},
 			},
-			inventoryErr: nil,
+		},
+		"ok, all devices ungrouped": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/0.1.0/devices/groups/distinct",
+				[]string{"1", "2"}),
+			ids:    []model.DeviceID{"1", "2"},
+			groups: []model.GroupName{""},
 			resp: JSONResponseParams{
-				OutputStatus:     http.StatusUnauthorized,
-				OutputBodyObject: RestError("unauthorized"),
+				OutputStatus: http.StatusOK,
+				OutputBodyObject: InventoryApiDistinctGroups{
+					Groups:    []model.GroupName{},
+					Ungrouped: true,
+				},
 			},
-			scope: model.AttrScopeInventory,
 		},
-
-		"empty body": {
-			inReq: test.MakeSimpleRequest("PATCH",
-				"http://1.2.3.4/api/0.1.0/attributes",
+		"error, empty body": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/0.1.0/devices/groups/distinct",
 				nil),
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
-			},
-			inventoryErr: nil,
 			resp: JSONResponseParams{
 				OutputStatus:     http.StatusBadRequest,
 				OutputBodyObject: RestError("failed to decode request body: JSON payload is empty"),
 			},
-			scope: model.AttrScopeInventory,
 		},
-
-		"garbled body": {
-			inReq: test.MakeSimpleRequest("PATCH",
-				"http://1.2.3.4/api/0.1.0/attributes",
-				`{"foo": "bar"}`),
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
-			},
-			inventoryErr: nil,
+		"error, no devices": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/0.1.0/devices/groups/distinct",
+				[]string{}),
 			resp: JSONResponseParams{
 				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("failed to decode request body: json: cannot unmarshal string into Go value of type []model.DeviceAttribute"),
+				OutputBodyObject: RestError("cannot be blank"),
 			},
-			scope: model.AttrScopeInventory,
 		},
-
-		"body formatted ok, attribute name missing": {
-			inReq: test.MakeSimpleRequest("PATCH",
-				"http://1.2.3.4/api/0.1.0/attributes",
-				[]model.DeviceAttribute{
-					{
-						Name:        "name1",
-						Value:       "value1",
-						Description: strPtr("descr1"),
-					},
-					{
-						Value:       2,
-						Description: strPtr("descr2"),
-					},
-				},
-			),
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
-			},
-			inventoryErr: nil,
+		"error, blank device ID": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/0.1.0/devices/groups/distinct",
+				[]string{"1", ""}),
 			resp: JSONResponseParams{
 				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("name: cannot be blank."),
+				OutputBodyObject: RestError("1: cannot be blank."),
 			},
-			scope: model.AttrScopeInventory,
 		},
-
-		"body formatted ok, attribute value missing": {
-			inReq: test.MakeSimpleRequest("PATCH",
-				"http://1.2.3.4/api/0.1.0/attributes",
-				[]model.DeviceAttribute{
-					{
-						Name:        "name1",
-						Description: strPtr("descr1"),
-					},
-				},
-			),
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
-			},
-			inventoryErr: nil,
+		"error, too many devices": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/0.1.0/devices/groups/distinct",
+				[]string{"1", "2", "3"}),
+			config: &Config{MaxBulkDeviceIDs: 2},
 			resp: JSONResponseParams{
 				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("value: supported types are string, float64, and arrays thereof."),
+				OutputBodyObject: RestError("too many device IDs: the limit is 2"),
 			},
-			scope: model.AttrScopeInventory,
 		},
-
-		"body formatted ok, attributes ok (all fields)": {
-			inReq: test.MakeSimpleRequest("PATCH",
-				"http://1.2.3.4/api/0.1.0/attributes",
-				[]model.DeviceAttribute{
-					{
-						Name:        "name1",
-						Value:       "value1",
-						Description: strPtr("descr1"),
-					},
-					{
-						Name:        "name2",
-						Value:       2,
-						Description: strPtr("descr2"),
-					},
-				},
-			),
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
-			},
-			inventoryErr: nil,
+		"error, internal": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/0.1.0/devices/groups/distinct",
+				[]string{"1"}),
+			ids: []model.DeviceID{"1"},
+			err: errors.New("internal error"),
 			resp: JSONResponseParams{
-				OutputStatus:     http.StatusOK,
-				OutputBodyObject: nil,
-			},
-			deviceAttributes: model.DeviceAttributes{
-				{Name: "name1", Value: "value1", Description: strPtr("descr1"), Scope: model.AttrScopeInventory},
-				{Name: "name2", Value: float64(2), Description: strPtr("descr2"), Scope: model.AttrScopeInventory},
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
 			},
-			scope: model.AttrScopeInventory,
 		},
+	}
 
-		"body formatted ok, attributes ok (all fields), with scope": {
-			inReq: test.MakeSimpleRequest("PATCH",
-				"http://1.2.3.4/api/0.1.0/attributes",
-				[]model.DeviceAttribute{
-					{
-						Name:        "name1",
-						Value:       "value1",
-						Description: strPtr("descr1"),
-						Scope:       model.AttrScopeInventory,
-					},
-					{
-						Name:        "name2",
-						Value:       2,
-						Description: strPtr("descr2"),
-						Scope:       model.AttrScopeInventory,
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.ids != nil {
+				inv.On("GetDevicesDistinctGroups", contextMatcher(), tc.ids).
+					Return(tc.groups, tc.err)
+			}
+
+			apih := makeMockApiHandlerWithConfig(t, &inv, tc.config)
+
+			runTestRequest(t, apih, tc.inReq, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryAddDevice(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	testCases := map[string]struct {
+		JSONResponseParams
+
+		inReq *http.Request
+
+		inventoryErr error
+
+		config *Config
+		method string
+
+		deviceAttributes model.DeviceAttributes
+	}{
+		"empty body": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
+				nil),
+			inventoryErr: nil,
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("failed to decode request body: JSON payload is empty"),
+			},
+		},
+		"garbled body": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
+				"foo bar"),
+			inventoryErr: nil,
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("failed to decode request body: json: cannot unmarshal string into Go value of type model.Device"),
+			},
+		},
+		"body formatted ok, all fields present": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
+				map[string]interface{}{
+					"id": "id-0001",
+					"attributes": []map[string]interface{}{
+						{"name": "a1", "value": "00:00:00:01", "description": "ddd"},
+						{"name": "a2", "value": 123.2, "description": "ddd"},
+						{"name": "a3", "value": []interface{}{"00:00:00:01", "00"}, "description": "ddd"},
 					},
 				},
 			),
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
-			},
 			inventoryErr: nil,
-			resp: JSONResponseParams{
-				OutputStatus:     http.StatusOK,
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusCreated,
 				OutputBodyObject: nil,
+				OutputHeaders:    map[string][]string{"Location": {"devices/id-0001"}},
 			},
 			deviceAttributes: model.DeviceAttributes{
-				{Name: "name1", Value: "value1", Description: strPtr("descr1"), Scope: model.AttrScopeInventory},
-				{Name: "name2", Value: float64(2), Description: strPtr("descr2"), Scope: model.AttrScopeInventory},
+				{Name: "a1", Value: "00:00:00:01", Description: strPtr("ddd"), Scope: model.AttrScopeInventory},
+				{Name: "a2", Value: 123.2, Description: strPtr("ddd"), Scope: model.AttrScopeInventory},
+				{Name: "a3", Value: []interface{}{"00:00:00:01", "00"}, Description: strPtr("ddd"), Scope: model.AttrScopeInventory},
 			},
-			scope: model.AttrScopeInventory,
 		},
-
-		"body formatted ok, attributes ok (all fields, arrays)": {
-			inReq: test.MakeSimpleRequest("PATCH",
-				"http://1.2.3.4/api/0.1.0/attributes",
-				[]model.DeviceAttribute{
-					{
-						Name:        "name1",
-						Value:       []interface{}{"foo", "bar"},
-						Description: strPtr("descr1"),
-					},
-					{
-						Name:        "name2",
-						Value:       []interface{}{1, 2, 3},
-						Description: strPtr("descr2"),
+		"body formatted ok, all fields present, attributes with scope": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
+				map[string]interface{}{
+					"id": "id-0001",
+					"attributes": []map[string]interface{}{
+						{"name": "a1", "value": "00:00:00:01", "description": "ddd", "scope": model.AttrScopeInventory},
+						{"name": "a2", "value": 123.2, "description": "ddd", "scope": model.AttrScopeInventory},
+						{"name": "a3", "value": []interface{}{"00:00:00:01", "00"}, "description": "ddd", "scope": model.AttrScopeInventory},
 					},
 				},
 			),
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
-			},
 			inventoryErr: nil,
-			resp: JSONResponseParams{
-				OutputStatus:     http.StatusOK,
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusCreated,
 				OutputBodyObject: nil,
+				OutputHeaders:    map[string][]string{"Location": {"devices/id-0001"}},
+			},
+			deviceAttributes: model.DeviceAttributes{
+				{Name: "a1", Value: "00:00:00:01", Description: strPtr("ddd"), Scope: model.AttrScopeInventory},
+				{Name: "a2", Value: 123.2, Description: strPtr("ddd"), Scope: model.AttrScopeInventory},
+				{Name: "a3", Value: []interface{}{"00:00:00:01", "00"}, Description: strPtr("ddd"), Scope: model.AttrScopeInventory},
 			},
-			scope: model.AttrScopeInventory,
 		},
-
-		"body formatted ok, attributes ok (values only)": {
-			inReq: test.MakeSimpleRequest("PATCH",
-				"http://1.2.3.4/api/0.1.0/attributes",
-				[]model.DeviceAttribute{
-					{
-						Name:  "name1",
-						Value: "value1",
-					},
-					{
-						Name:  "name2",
-						Value: 2,
-					},
+		"body formatted ok, wrong attributes type": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
+				map[string]interface{}{
+					"id":         "id-0001",
+					"attributes": 123,
 				},
 			),
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			inventoryErr: nil,
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("failed to decode request body: json: cannot unmarshal number into Go struct field Device.attributes of type []model.DeviceAttribute"),
 			},
+		},
+		"body formatted ok, unknown field, strict": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
+				map[string]interface{}{
+					"id":  "id-0001",
+					"foo": "bar",
+				},
+			),
+			config:       &Config{AddDeviceRejectUnknownFields: true},
 			inventoryErr: nil,
-			resp: JSONResponseParams{
-				OutputStatus:     http.StatusOK,
-				OutputBodyObject: nil,
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("failed to decode request body: json: unknown field \"foo\""),
 			},
-			scope: model.AttrScopeInventory,
 		},
-
-		"body formatted ok, attributes ok, but values are empty": {
-			inReq: test.MakeSimpleRequest("PATCH",
-				"http://1.2.3.4/api/0.1.0/attributes",
-				[]model.DeviceAttribute{
-					{
-						Name:  "name1",
-						Value: "",
-					},
-					{
-						Name:  "name2",
-						Value: "",
+		"body formatted ok, created_ts, strict": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
+				map[string]interface{}{
+					"id":         "id-0001",
+					"created_ts": "2023-01-01T00:00:00Z",
+					"updated_ts": "2023-01-01T00:00:00Z",
+					"attributes": []map[string]interface{}{
+						{"name": "a1", "value": "00:00:00:01"},
 					},
 				},
 			),
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
-			},
+			config:       &Config{AddDeviceRejectUnknownFields: true},
 			inventoryErr: nil,
-			resp: JSONResponseParams{
-				OutputStatus:     http.StatusOK,
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusCreated,
 				OutputBodyObject: nil,
+				OutputHeaders:    map[string][]string{"Location": {"devices/id-0001"}},
+			},
+			deviceAttributes: model.DeviceAttributes{
+				{Name: "a1", Value: "00:00:00:01", Scope: model.AttrScopeInventory},
 			},
-			scope: model.AttrScopeInventory,
 		},
-
-		"body formatted ok, attributes ok (all fields), inventory err": {
-			inReq: test.MakeSimpleRequest("PATCH",
-				"http://1.2.3.4/api/0.1.0/attributes",
-				[]model.DeviceAttribute{
-					{
-						Name:        "name1",
-						Value:       "value1",
-						Description: strPtr("descr1"),
-					},
-					{
-						Name:        "name2",
-						Value:       2,
-						Description: strPtr("descr2"),
+		"body formatted ok, unknown field, ignored": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
+				map[string]interface{}{
+					"id":  "id-0001",
+					"foo": "bar",
+					"attributes": []map[string]interface{}{
+						{"name": "a1", "value": "00:00:00:01"},
 					},
 				},
 			),
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			inventoryErr: nil,
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusCreated,
+				OutputBodyObject: nil,
+				OutputHeaders:    map[string][]string{"Location": {"devices/id-0001"}},
 			},
-			inventoryErr: errors.New("internal error"),
-			resp: JSONResponseParams{
-				OutputStatus:     http.StatusInternalServerError,
-				OutputBodyObject: RestError("internal error"),
+			deviceAttributes: model.DeviceAttributes{
+				{Name: "a1", Value: "00:00:00:01", Scope: model.AttrScopeInventory},
 			},
-			scope: model.AttrScopeInventory,
 		},
-
-		"body formatted ok, attributes ok (values only), PUT": {
-			inReq: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/0.1.0/attributes",
-				[]model.DeviceAttribute{
-					{
-						Name:  "name1",
-						Value: "value1",
-					},
-					{
-						Name:  "name2",
-						Value: 2,
+		"body formatted ok, 'id' missing": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
+				map[string]interface{}{},
+			),
+			inventoryErr: nil,
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("id: cannot be blank."),
+			},
+		},
+		"body formatted ok, incorrect attribute value": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
+				map[string]interface{}{
+					"id": "id-0001",
+					"attributes": []map[string]interface{}{
+						{"name": "asd", "value": []interface{}{"asd", 123}},
+						{"name": "asd2", "value": []interface{}{123, "asd"}},
 					},
 				},
 			),
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
-			},
 			inventoryErr: nil,
-			resp: JSONResponseParams{
-				OutputStatus:     http.StatusOK,
-				OutputBodyObject: nil,
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("attributes: (value: array values must be of consistent type: string or float64.)."),
 			},
-			scope: model.AttrScopeInventory,
 		},
-	}
-
-	for name, tc := range testCases {
-		t.Run(name, func(t *testing.T) {
-			inv := minventory.InventoryApp{}
-
-			ctx := contextMatcher()
-
-			if tc.inReq.Method == http.MethodPatch {
-				inv.On("UpsertAttributesWithUpdated",
-					ctx,
-					mock.AnythingOfType("model.DeviceID"),
-					mock.MatchedBy(
-						func(attrs model.DeviceAttributes) bool {
-							if tc.deviceAttributes != nil {
-								if !reflect.DeepEqual(tc.deviceAttributes, attrs) {
-									assert.FailNow(t, "", "attributes not equal: %v \n%v\n", tc.deviceAttributes, attrs)
-								}
-							}
-							return true
-						},
-					),
-					tc.scope,
-					tc.etag,
-				).Return(tc.inventoryErr)
-			} else {
-				inv.On("ReplaceAttributes",
-					ctx,
-					mock.AnythingOfType("model.DeviceID"),
-					mock.MatchedBy(
-						func(attrs model.DeviceAttributes) bool {
-							if tc.deviceAttributes != nil {
-								if !reflect.DeepEqual(tc.deviceAttributes, attrs) {
-									assert.FailNow(t, "", "attributes not equal: %v \n%v\n", tc.deviceAttributes, attrs)
-								}
-							}
-							return true
-						},
-					),
-					tc.scope,
-					tc.etag,
-				).Return(tc.inventoryErr)
-			}
-
-			apih := makeMockApiHandler(t, &inv)
-
-			rest.ErrorFieldName = "error"
-
-			for k, v := range tc.inHdrs {
-				tc.inReq.Header.Set(k, v)
-			}
-
-			runTestRequest(t, apih, tc.inReq, tc.resp)
-		})
-	}
-}
-
-func makeDeviceAuthHeader(claim string) string {
-	return fmt.Sprintf("Bearer base.%s.sign",
-		base64.RawURLEncoding.EncodeToString([]byte(claim)))
-}
-
-func strPtr(s string) *string {
-	return &s
-}
-
-func TestApiInventoryUpsertAttributesInternal(t *testing.T) {
-	t.Parallel()
-
-	rest.ErrorFieldName = "error"
-
-	testCases := map[string]struct {
-		tenantId string
-		deviceId string
-		scope    string
-		inReq    *http.Request
-		inHdrs   map[string]string
-		payload  interface{}
-
-		inventoryErr error
-
-		resp             JSONResponseParams
-		deviceAttributes model.DeviceAttributes
-	}{
-		"empty body": {
-			tenantId: "3456355",
-			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
-			scope:    "inventory",
-
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
-			},
+		"body formatted ok, attribute name missing": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
+				map[string]interface{}{
+					"id": "id-0001",
+					"attributes": []map[string]interface{}{
+						{"value": "23"},
+					},
+				},
+			),
 			inventoryErr: nil,
-			resp: JSONResponseParams{
+			JSONResponseParams: JSONResponseParams{
 				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("failed to decode request body: JSON payload is empty"),
+				OutputBodyObject: RestError("attributes: (name: cannot be blank.)."),
 			},
 		},
-
-		"missing device id": {
-			tenantId: "3456355",
-			scope:    "inventory",
-			payload: []model.DeviceAttribute{
-				{
-					Name:        "name1",
-					Value:       []interface{}{"foo", "bar"},
-					Description: strPtr("descr1"),
+		"body formatted ok, inv error": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
+				map[string]interface{}{
+					"id": "id-0001",
+					"attributes": []map[string]interface{}{
+						{
+							"name":  "name1",
+							"value": "value4",
+						},
+					},
 				},
-				{
-					Name:        "name2",
-					Value:       []interface{}{1, 2, 3},
-					Description: strPtr("descr2"),
+			),
+			inventoryErr: errors.New("internal error"),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+		"create only, ok": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
+				map[string]interface{}{
+					"id": "id-0001",
+					"attributes": []map[string]interface{}{
+						{"name": "a1", "value": "00:00:00:01"},
+					},
 				},
+			),
+			config: &Config{AddDeviceCreateOnly: true},
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusCreated,
+				OutputBodyObject: nil,
+				OutputHeaders:    map[string][]string{"Location": {"devices/id-0001"}},
 			},
-
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			deviceAttributes: model.DeviceAttributes{
+				{Name: "a1", Value: "00:00:00:01", Scope: model.AttrScopeInventory},
 			},
-			inventoryErr: nil,
-			resp: JSONResponseParams{
-				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("device id cannot be empty"),
+		},
+		"create only, device exists": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
+				map[string]interface{}{
+					"id": "id-0001",
+					"attributes": []map[string]interface{}{
+						{"name": "a1", "value": "00:00:00:01"},
+					},
+				},
+			),
+			config:       &Config{AddDeviceCreateOnly: true},
+			inventoryErr: errors.Wrap(store.ErrDevExists, "failed to add device"),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusConflict,
+				OutputBodyObject: RestError("device already exists"),
 			},
 		},
-
-		"garbled body": {
-			tenantId: "3456355",
-			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
-			scope:    "inventory",
-
-			payload: `{"foo": "bar"}`,
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+		"merge by default, device exists": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
+				map[string]interface{}{
+					"id": "id-0001",
+					"attributes": []map[string]interface{}{
+						{"name": "a1", "value": "00:00:00:02"},
+					},
+				},
+			),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusCreated,
+				OutputBodyObject: nil,
+				OutputHeaders:    map[string][]string{"Location": {"devices/id-0001"}},
 			},
-			inventoryErr: nil,
-			resp: JSONResponseParams{
-				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("failed to decode request body: json: cannot unmarshal string into Go value of type []model.DeviceAttribute"),
+			deviceAttributes: model.DeviceAttributes{
+				{Name: "a1", Value: "00:00:00:02", Scope: model.AttrScopeInventory},
 			},
 		},
-
-		"body formatted ok, attribute name missing": {
-			tenantId: "3456355",
-			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
-			scope:    "inventory",
-
-			payload: []model.DeviceAttribute{
-				{
-					Name:        "name1",
-					Value:       "value1",
-					Description: strPtr("descr1"),
-				},
-				{
-					Value:       2,
-					Description: strPtr("descr2"),
+		"fresh, ok": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices?fresh=true",
+				map[string]interface{}{
+					"id": "id-0001",
+					"attributes": []map[string]interface{}{
+						{"name": "a1", "value": "00:00:00:02"},
+					},
 				},
+			),
+			method: "ReplaceDevice",
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusCreated,
+				OutputBodyObject: nil,
+				OutputHeaders:    map[string][]string{"Location": {"devices/id-0001"}},
 			},
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			deviceAttributes: model.DeviceAttributes{
+				{Name: "a1", Value: "00:00:00:02", Scope: model.AttrScopeInventory},
 			},
-			inventoryErr: nil,
-			resp: JSONResponseParams{
+		},
+		"fresh, create only": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices?fresh=true",
+				map[string]interface{}{
+					"id": "id-0001",
+					"attributes": []map[string]interface{}{
+						{"name": "a1", "value": "00:00:00:01"},
+					},
+				},
+			),
+			config:       &Config{AddDeviceCreateOnly: true},
+			inventoryErr: errors.Wrap(store.ErrDevExists, "failed to add device"),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusConflict,
+				OutputBodyObject: RestError("device already exists"),
+			},
+		},
+		"fresh, invalid": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices?fresh=maybe",
+				map[string]interface{}{
+					"id": "id-0001",
+				},
+			),
+			JSONResponseParams: JSONResponseParams{
 				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("name: cannot be blank."),
+				OutputBodyObject: RestError(utils.MsgQueryParmInvalid("fresh")),
 			},
 		},
+	}
 
-		"body formatted ok, attribute value missing": {
-			tenantId: "3456355",
-			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
-			scope:    "inventory",
-
-			payload: []model.DeviceAttribute{
-				{
-					Name:        "name1",
-					Description: strPtr("descr1"),
-				},
-			},
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
-			},
-			inventoryErr: nil,
-			resp: JSONResponseParams{
-				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("value: supported types are string, float64, and arrays thereof."),
-			},
-		},
-
-		"body formatted ok, attributes ok (all fields)": {
-			tenantId: "3456355",
-			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
-			scope:    "inventory",
-
-			payload: []model.DeviceAttribute{
-				{
-					Name:        "name1",
-					Value:       "value1",
-					Description: strPtr("descr1"),
-				},
-				{
-					Name:        "name2",
-					Value:       2,
-					Description: strPtr("descr2"),
-				},
-			},
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
-			},
-			inventoryErr: nil,
-			resp: JSONResponseParams{
-				OutputStatus:     http.StatusOK,
-				OutputBodyObject: nil,
-			},
-			deviceAttributes: model.DeviceAttributes{
-				{Name: "name1", Value: "value1", Description: strPtr("descr1"), Scope: model.AttrScopeInventory},
-				{Name: "name2", Value: float64(2), Description: strPtr("descr2"), Scope: model.AttrScopeInventory},
-			},
-		},
-
-		"body formatted ok, attributes ok (all fields), with scope": {
-			tenantId: "3456355",
-			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
-			scope:    "inventory",
-
-			payload: []model.DeviceAttribute{
-				{
-					Name:        "name1",
-					Value:       "value1",
-					Description: strPtr("descr1"),
-					Scope:       model.AttrScopeInventory,
-				},
-				{
-					Name:        "name2",
-					Value:       2,
-					Description: strPtr("descr2"),
-					Scope:       model.AttrScopeInventory,
-				},
-			},
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
-			},
-			inventoryErr: nil,
-			resp: JSONResponseParams{
-				OutputStatus:     http.StatusOK,
-				OutputBodyObject: nil,
-			},
-			deviceAttributes: model.DeviceAttributes{
-				{Name: "name1", Value: "value1", Description: strPtr("descr1"), Scope: model.AttrScopeInventory},
-				{Name: "name2", Value: float64(2), Description: strPtr("descr2"), Scope: model.AttrScopeInventory},
-			},
-		},
-
-		"body formatted ok, attributes ok (all fields, arrays)": {
-			tenantId: "3456355",
-			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
-			scope:    "inventory",
-
-			payload: []model.DeviceAttribute{
-				{
-					Name:        "name1",
-					Value:       []interface{}{"foo", "bar"},
-					Description: strPtr("descr1"),
-				},
-				{
-					Name:        "name2",
-					Value:       []interface{}{1, 2, 3},
-					Description: strPtr("descr2"),
-				},
-			},
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
-			},
-			inventoryErr: nil,
-			resp: JSONResponseParams{
-				OutputStatus:     http.StatusOK,
-				OutputBodyObject: nil,
-			},
-		},
-
-		"body formatted ok, attributes ok (values only)": {
-			tenantId: "3456355",
-			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
-			scope:    "inventory",
-
-			payload: []model.DeviceAttribute{
-				{
-					Name:  "name1",
-					Value: "value1",
-				},
-				{
-					Name:  "name2",
-					Value: 2,
-				},
-			},
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
-			},
-			inventoryErr: nil,
-			resp: JSONResponseParams{
-				OutputStatus:     http.StatusOK,
-				OutputBodyObject: nil,
-			},
-		},
-
-		"body formatted ok, attributes ok, but values are empty": {
-			tenantId: "3456355",
-			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
-			scope:    "inventory",
-
-			payload: []model.DeviceAttribute{
-				{
-					Name:  "name1",
-					Value: "",
-				},
-				{
-					Name:  "name2",
-					Value: "",
-				},
-			},
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
-			},
-			inventoryErr: nil,
-			resp: JSONResponseParams{
-				OutputStatus:     http.StatusOK,
-				OutputBodyObject: nil,
-			},
-		},
-
-		"body formatted ok, attributes ok (all fields), inventory err": {
-			tenantId: "3456355",
-			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
-			scope:    "inventory",
-
-			payload: []model.DeviceAttribute{
-				{
-					Name:        "name1",
-					Value:       "value1",
-					Description: strPtr("descr1"),
-				},
-				{
-					Name:        "name2",
-					Value:       2,
-					Description: strPtr("descr2"),
-				},
-			},
-			inHdrs: map[string]string{
-				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
-			},
-			inventoryErr: errors.New("internal error"),
-			resp: JSONResponseParams{
-				OutputStatus:     http.StatusInternalServerError,
-				OutputBodyObject: RestError("internal error"),
-			},
-		},
-	}
-
-	for name, tc := range testCases {
-		t.Logf("test case: %s", name)
-		tc.inReq = test.MakeSimpleRequest("PATCH",
-			"http://1.2.3.4/api/internal/v1/inventory/tenants/"+tc.tenantId+"/device/"+tc.deviceId+"/attribute/scope/"+tc.scope,
-			tc.payload)
-		inv := minventory.InventoryApp{}
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+		inv := minventory.InventoryApp{}
 
 		ctx := contextMatcher()
 
-		inv.On("UpsertAttributes",
+		method := tc.method
+		if tc.config != nil && tc.config.AddDeviceCreateOnly {
+			method = "CreateDevice"
+		} else if method == "" {
+			method = "AddDevice"
+		}
+		inv.On(method,
 			ctx,
-			mock.AnythingOfType("model.DeviceID"),
 			mock.MatchedBy(
-				func(attrs model.DeviceAttributes) bool {
+				func(dev *model.Device) bool {
 					if tc.deviceAttributes != nil {
-						if !reflect.DeepEqual(tc.deviceAttributes, attrs) {
-							assert.FailNow(t, "", "attributes not equal: %v \n%v\n", tc.deviceAttributes, attrs)
+						if !reflect.DeepEqual(tc.deviceAttributes, dev.Attributes) {
+							assert.FailNow(t, "", "attributes not equal: %v \n%v\n", tc.deviceAttributes, dev.Attributes)
 						}
 					}
 					return true
@@ -1636,825 +1926,2973 @@ func TestApiInventoryUpsertAttributesInternal(t *testing.T) {
 			),
 		).Return(tc.inventoryErr)
 
-		apih := makeMockApiHandler(t, &inv)
-
-		rest.ErrorFieldName = "error"
-
-		for k, v := range tc.inHdrs {
-			tc.inReq.Header.Set(k, v)
-		}
+		apih := makeMockApiHandlerWithConfig(t, &inv, tc.config)
 
-		runTestRequest(t, apih, tc.inReq, tc.resp)
+		runTestRequest(t, apih, tc.inReq, tc.JSONResponseParams)
 	}
 }
 
-func TestApiInventoryDeleteDeviceGroup(t *testing.T) {
+func TestApiInventoryAddDeviceLocation(t *testing.T) {
+	t.Parallel()
 	rest.ErrorFieldName = "error"
 
-	tcases := map[string]struct {
-		JSONResponseParams
-
-		inReq *http.Request
-
-		inventoryErr error
+	testCases := map[string]struct {
+		config   *Config
+		location string
 	}{
-		"ok": {
-			inReq: test.MakeSimpleRequest("DELETE",
-				"http://1.2.3.4/api/0.1.0/devices/123/group/g1", nil),
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusNoContent,
-				OutputBodyObject: nil,
-			},
-		},
-		"device group not found (or device's group is other than requested)": {
-			inReq: test.MakeSimpleRequest("DELETE",
-				"http://1.2.3.4/api/0.1.0/devices/123/group/g1", nil),
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusNotFound,
-				OutputBodyObject: RestError(store.ErrDevNotFound.Error()),
-			},
-			inventoryErr: store.ErrDevNotFound,
+		"relative by default": {
+			location: "devices/id-0001",
 		},
-		"internal error": {
-			inReq: test.MakeSimpleRequest("DELETE",
-				"http://1.2.3.4/api/0.1.0/devices/123/group/g1", nil),
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusInternalServerError,
-				OutputBodyObject: RestError("internal error"),
+		"absolute with base URL": {
+			config: &Config{
+				AddDeviceLocationBaseURL: "https://inventory.example.com/api/internal/v1/inventory/",
 			},
-			inventoryErr: errors.New("internal error"),
+			location: "https://inventory.example.com/api/internal/v1/inventory/devices/id-0001",
 		},
 	}
 
-	for name, tc := range tcases {
-		t.Logf("test case: %s", name)
-		inv := minventory.InventoryApp{}
-
-		ctx := contextMatcher()
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
 
-		inv.On("UnsetDeviceGroup",
-			ctx,
-			mock.AnythingOfType("model.DeviceID"),
-			mock.AnythingOfType("model.GroupName")).Return(tc.inventoryErr)
+			inv.On("AddDevice", contextMatcher(), mock.AnythingOfType("*model.Device")).
+				Return(nil)
 
-		apih := makeMockApiHandler(t, &inv)
+			apih := makeMockApiHandlerWithConfig(t, &inv, tc.config)
 
-		runTestRequest(t, apih, tc.inReq, tc.JSONResponseParams)
+			req := test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices",
+				map[string]interface{}{"id": "id-0001"},
+			)
+			recorded := test.RunRequest(t, apih, req)
+			recorded.CodeIs(http.StatusCreated)
+			recorded.HeaderIs("Location", tc.location)
+		})
 	}
 }
 
-func TestApiInventoryAddDeviceToGroup(t *testing.T) {
-	rest.ErrorFieldName = "error"
+func TestApiInventoryUpdateDeviceTags(t *testing.T) {
 
-	tcases := map[string]struct {
-		JSONResponseParams
-
-		inReq *http.Request
-
-		inventoryErr error
+	testCases := map[string]struct {
+		inReq         *http.Request
+		inHdrs        map[string]string
+		deviceID      model.DeviceID
+		attrsToUpsert model.DeviceAttributes
+		scope         string
+		etag          string
+		inventoryErr  error
+		resp          JSONResponseParams
 	}{
-		"ok": {
+		"Replace tags, PUT, failed ETag": {
 			inReq: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/0.1.0/devices/123/group",
-				InventoryApiGroup{"_a-b-c_"}),
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusNoContent,
-				OutputBodyObject: nil,
+				"http://1.2.3.4/api/0.1.0/devices/:id/tags",
+				[]model.DeviceAttribute{
+					{
+						Name:  "tag_1",
+						Value: "value_1",
+					},
+					{
+						Name:  "tag_2",
+						Value: "value_2",
+					},
+				},
+			),
+			deviceID: "ad22a170-37b5-4c8b-9eab-612bad1eac19",
+			inHdrs: map[string]string{
+				"If-Match": "f7238315-062d-4440-875a-676006f84c34",
 			},
-		},
-		"device not found": {
-			inReq: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/0.1.0/devices/123/group",
-				InventoryApiGroup{"abc"}),
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusNotFound,
-				OutputBodyObject: RestError(store.ErrDevNotFound.Error()),
+			attrsToUpsert: model.DeviceAttributes{
+				{Name: "tag_1", Value: "value_1", Scope: model.AttrScopeTags},
+				{Name: "tag_2", Value: "value_2", Scope: model.AttrScopeTags},
+			},
+			scope:        model.AttrScopeTags,
+			inventoryErr: inventory.ErrETagDoesntMatch,
+			etag:         "f7238315-062d-4440-875a-676006f84c34",
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusPreconditionFailed,
+				OutputBodyObject: RestError("ETag does not match"),
 			},
-			inventoryErr: store.ErrDevNotFound,
 		},
-		"empty group name": {
+		"ok, replace tags, PUT, with ETag": {
 			inReq: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/0.1.0/devices/123/group",
-				InventoryApiGroup{}),
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("Group name cannot be blank"),
+				"http://1.2.3.4/api/0.1.0/devices/:id/tags",
+				[]model.DeviceAttribute{
+					{
+						Name:  "tag_1",
+						Value: "value_1",
+					},
+					{
+						Name:  "tag_2",
+						Value: "value_2",
+					},
+				},
+			),
+			deviceID: "ad22a170-37b5-4c8b-9eab-612bad1eac19",
+			inHdrs: map[string]string{
+				"If-Match": "f7238315-062d-4440-875a-676006f84c34",
+			},
+			attrsToUpsert: model.DeviceAttributes{
+				{Name: "tag_1", Value: "value_1", Scope: model.AttrScopeTags},
+				{Name: "tag_2", Value: "value_2", Scope: model.AttrScopeTags},
 			},
+			scope:        model.AttrScopeTags,
 			inventoryErr: nil,
+			etag:         "f7238315-062d-4440-875a-676006f84c34",
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+			},
 		},
-		"unsupported characters in group name": {
+		"ok, replace tags, PUT, without ETag": {
 			inReq: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/0.1.0/devices/123/group",
-				InventoryApiGroup{"__+X@#$  ;"}),
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("Group name can only contain: upper/lowercase alphanum, -(dash), _(underscore)"),
+				"http://1.2.3.4/api/0.1.0/devices/:id/tags",
+				[]model.DeviceAttribute{
+					{
+						Name:  "tag_1",
+						Value: "value_1",
+					},
+					{
+						Name:  "tag_2",
+						Value: "value_2",
+					},
+				},
+			),
+			deviceID: "ad22a170-37b5-4c8b-9eab-612bad1eac19",
+			attrsToUpsert: model.DeviceAttributes{
+				{Name: "tag_1", Value: "value_1", Scope: model.AttrScopeTags},
+				{Name: "tag_2", Value: "value_2", Scope: model.AttrScopeTags},
 			},
+			scope:        model.AttrScopeTags,
 			inventoryErr: nil,
+			etag:         "",
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+			},
 		},
-		"non-ASCII characters in group name": {
-			inReq: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/0.1.0/devices/123/group",
-				InventoryApiGroup{"ęą"}),
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("Group name can only contain: upper/lowercase alphanum, -(dash), _(underscore)"),
+		"Upsert tags, PATCH, failed ETag": {
+			inReq: test.MakeSimpleRequest("PATCH",
+				"http://1.2.3.4/api/0.1.0/devices/:id/tags",
+				[]model.DeviceAttribute{
+					{
+						Name:  "tag_1",
+						Value: "value_1",
+					},
+					{
+						Name:  "tag_2",
+						Value: "value_2",
+					},
+				},
+			),
+			deviceID: "ad22a170-37b5-4c8b-9eab-612bad1eac19",
+			inHdrs: map[string]string{
+				"If-Match": "f7238315-062d-4440-875a-676006f84c34",
+			},
+			attrsToUpsert: model.DeviceAttributes{
+				{Name: "tag_1", Value: "value_1", Scope: model.AttrScopeTags},
+				{Name: "tag_2", Value: "value_2", Scope: model.AttrScopeTags},
+			},
+			scope:        model.AttrScopeTags,
+			inventoryErr: inventory.ErrETagDoesntMatch,
+			etag:         "f7238315-062d-4440-875a-676006f84c34",
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusPreconditionFailed,
+				OutputBodyObject: RestError("ETag does not match"),
 			},
-			inventoryErr: nil,
 		},
-		"empty body": {
-			inReq: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/0.1.0/devices/123/group", nil),
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("failed to decode device group data: JSON payload is empty"),
+		"ok, upsert tags, PATCH, with ETag": {
+			inReq: test.MakeSimpleRequest("PATCH",
+				"http://1.2.3.4/api/0.1.0/devices/:id/tags",
+				[]model.DeviceAttribute{
+					{
+						Name:  "tag_1",
+						Value: "value_1",
+					},
+					{
+						Name:  "tag_2",
+						Value: "value_2",
+					},
+				},
+			),
+			deviceID: "ad22a170-37b5-4c8b-9eab-612bad1eac19",
+			inHdrs: map[string]string{
+				"If-Match": "f7238315-062d-4440-875a-676006f84c34",
+			},
+			attrsToUpsert: model.DeviceAttributes{
+				{Name: "tag_1", Value: "value_1", Scope: model.AttrScopeTags},
+				{Name: "tag_2", Value: "value_2", Scope: model.AttrScopeTags},
 			},
+			scope:        model.AttrScopeTags,
 			inventoryErr: nil,
+			etag:         "f7238315-062d-4440-875a-676006f84c34",
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+			},
 		},
-		"internal error": {
-			inReq: test.MakeSimpleRequest("PUT",
-				"http://1.2.3.4/api/0.1.0/devices/123/group",
-				InventoryApiGroup{"abc"}),
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusInternalServerError,
-				OutputBodyObject: RestError("internal error"),
+		"ok, upsert tags, PATCH, without ETag": {
+			inReq: test.MakeSimpleRequest("PATCH",
+				"http://1.2.3.4/api/0.1.0/devices/:id/tags",
+				[]model.DeviceAttribute{
+					{
+						Name:  "tag_1",
+						Value: "value_1",
+					},
+					{
+						Name:  "tag_2",
+						Value: "value_2",
+					},
+				},
+			),
+			deviceID: "ad22a170-37b5-4c8b-9eab-612bad1eac19",
+			attrsToUpsert: model.DeviceAttributes{
+				{Name: "tag_1", Value: "value_1", Scope: model.AttrScopeTags},
+				{Name: "tag_2", Value: "value_2", Scope: model.AttrScopeTags},
+			},
+			scope:        model.AttrScopeTags,
+			inventoryErr: nil,
+			etag:         "",
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
 			},
-			inventoryErr: errors.New("internal error"),
 		},
 	}
 
-	for name, tc := range tcases {
+	for name, tc := range testCases {
 		t.Logf("test case: %s", name)
 		inv := minventory.InventoryApp{}
-
 		ctx := contextMatcher()
 
-		inv.On("UpdateDeviceGroup",
-			ctx,
-			mock.AnythingOfType("model.DeviceID"),
-			mock.AnythingOfType("model.GroupName")).Return(tc.inventoryErr)
-
-		apih := makeMockApiHandler(t, &inv)
-
-		runTestRequest(t, apih, tc.inReq, tc.JSONResponseParams)
-	}
-}
-
-func TestApiListGroups(t *testing.T) {
-	rest.ErrorFieldName = "error"
-
-	tcases := map[string]struct {
-		JSONResponseParams
-
-		inReq        *http.Request
-		outputGroups []model.GroupName
-
-		inventoryErr error
-	}{
-		"some groups": {
-			inReq:        test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups", nil),
-			outputGroups: []model.GroupName{"foo", "bar"},
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusOK,
-				OutputBodyObject: []string{"foo", "bar"},
-			},
-		},
-		"no groups": {
-			inReq: test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups?status=rejected", nil),
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusOK,
-				OutputBodyObject: []string{},
-			},
-		},
-		"error": {
-			inReq: test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups", nil),
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusInternalServerError,
-				OutputBodyObject: RestError("internal error"),
-			},
-			inventoryErr: errors.New("internal error"),
-		},
-	}
+		if tc.inReq.Method == http.MethodPatch {
+			inv.On("UpsertAttributesWithUpdated",
+				ctx,
+				tc.deviceID,
+				mock.MatchedBy(
+					func(attrs model.DeviceAttributes) bool {
+						if tc.attrsToUpsert != nil {
+							for k, _ := range tc.attrsToUpsert {
+								assert.Equal(t, tc.attrsToUpsert[k].Name, attrs[k].Name)
+								assert.Equal(t, tc.attrsToUpsert[k].Value, attrs[k].Value)
+								assert.Equal(t, tc.attrsToUpsert[k].Description, attrs[k].Description)
+								assert.Equal(t, tc.attrsToUpsert[k].Scope, attrs[k].Scope)
+							}
+						}
+						return true
+					},
+				),
+				tc.scope,
+				tc.etag,
+			).Return(tc.inventoryErr)
+		} else {
+			inv.On("ReplaceAttributes",
+				ctx,
+				tc.deviceID,
+				mock.MatchedBy(
+					func(attrs model.DeviceAttributes) bool {
+						if tc.attrsToUpsert != nil {
+							for k, _ := range tc.attrsToUpsert {
+								assert.Equal(t, tc.attrsToUpsert[k].Name, attrs[k].Name)
+								assert.Equal(t, tc.attrsToUpsert[k].Value, attrs[k].Value)
+								assert.Equal(t, tc.attrsToUpsert[k].Description, attrs[k].Description)
+								assert.Equal(t, tc.attrsToUpsert[k].Scope, attrs[k].Scope)
+							}
+						}
+						return true
+					},
+				),
+				tc.scope,
+				tc.etag,
+			).Return(tc.inventoryErr)
+		}
 
-	for name, tc := range tcases {
-		t.Run(name, func(t *testing.T) {
-			var filters []model.FilterPredicate
-			if status := tc.inReq.URL.Query().
-				Get("status"); status != "" {
-				filters = []model.FilterPredicate{{
-					Scope:     model.AttrScopeIdentity,
-					Attribute: "status",
-					Type:      "$eq",
-					Value:     status,
-				}}
+		apih := makeMockApiHandler(t, &inv)
+
+		if tc.inHdrs != nil {
+			for k, v := range tc.inHdrs {
+				tc.inReq.Header.Set(k, v)
 			}
-			inv := minventory.InventoryApp{}
-			ctx := contextMatcher()
+		}
 
-			inv.On("ListGroups", ctx, filters).
-				Return(tc.outputGroups, tc.inventoryErr)
+		tc.inReq.URL.Path = strings.Replace(tc.inReq.URL.Path, ":id", tc.deviceID.String(), -1)
 
-			apih := makeMockApiHandler(t, &inv)
+		runTestRequest(t, apih, tc.inReq, tc.resp)
 
-			runTestRequest(t, apih, tc.inReq, tc.JSONResponseParams)
-		})
 	}
 }
 
-func TestApiGetDevice(t *testing.T) {
+func TestApiInventoryUpsertAttributes(t *testing.T) {
+	t.Parallel()
+
 	rest.ErrorFieldName = "error"
 
-	tcases := map[string]struct {
-		JSONResponseParams
+	testCases := map[string]struct {
+		inReq  *http.Request
+		inHdrs map[string]string
+
+		scope string
+		etag  string
 
-		inReq        *http.Request
-		inDevId      model.DeviceID
-		outputDevice *model.Device
 		inventoryErr error
+
+		resp             JSONResponseParams
+		deviceAttributes model.DeviceAttributes
 	}{
-		"no device": {
-			inDevId:      model.DeviceID("1"),
-			inReq:        test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/1", nil),
-			outputDevice: nil,
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusNotFound,
-				OutputBodyObject: RestError(store.ErrDevNotFound.Error()),
+		"no auth": {
+			inReq: test.MakeSimpleRequest("PATCH",
+				"http://1.2.3.4/api/0.1.0/attributes",
+				nil),
+			inventoryErr: nil,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusUnauthorized,
+				OutputBodyObject: RestError("unauthorized"),
 			},
+			scope: model.AttrScopeInventory,
 		},
-		"some device": {
-			inDevId: model.DeviceID("2"),
-			inReq:   test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/2", nil),
-			outputDevice: &model.Device{
-				ID:    model.DeviceID("2"),
-				Group: model.GroupName("foo"),
+
+		"invalid auth": {
+			inReq: test.MakeSimpleRequest("PATCH",
+				"http://1.2.3.4/api/0.1.0/attributes",
+				nil),
+			inHdrs: map[string]string{
+				"Authorization:": "foobar",
 			},
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus: http.StatusOK,
-				OutputBodyObject: model.Device{
-					ID:    model.DeviceID("2"),
-					Group: model.GroupName("foo"),
-				},
+			inventoryErr: nil,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusUnauthorized,
+				OutputBodyObject: RestError("unauthorized"),
 			},
+			scope: model.AttrScopeInventory,
 		},
-		"error": {
-			inDevId: model.DeviceID("3"),
-			inReq:   test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/3", nil),
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusInternalServerError,
-				OutputBodyObject: RestError("internal error"),
+
+		"empty body": {
+			inReq: test.MakeSimpleRequest("PATCH",
+				"http://1.2.3.4/api/0.1.0/attributes",
+				nil),
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
 			},
-			inventoryErr: errors.New("internal error"),
+			inventoryErr: nil,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("failed to decode request body: JSON payload is empty"),
+			},
+			scope: model.AttrScopeInventory,
 		},
-	}
-
-	for name, tc := range tcases {
-		t.Logf("test case: %s", name)
-		inv := minventory.InventoryApp{}
-
-		ctx := contextMatcher()
-
-		inv.On("GetDevice", ctx, tc.inDevId).Return(tc.outputDevice, tc.inventoryErr)
 
-		apih := makeMockApiHandler(t, &inv)
-
-		runTestRequest(t, apih, tc.inReq, tc.JSONResponseParams)
-	}
-}
-
-func TestApiInventoryGetDevicesByGroup(t *testing.T) {
-	t.Parallel()
-	rest.ErrorFieldName = "error"
-
-	testCases := map[string]struct {
-		listDevicesNum   int
-		listDevicesErr   error
-		listDevicesTotal int
-		inReq            *http.Request
-		resp             JSONResponseParams
-	}{
-		"valid pagination, no next page": {
-			listDevicesNum:   5,
-			listDevicesErr:   nil,
-			listDevicesTotal: 20,
-			inReq:            test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups/foo/devices?page=4&per_page=5", nil),
+		"garbled body": {
+			inReq: test.MakeSimpleRequest("PATCH",
+				"http://1.2.3.4/api/0.1.0/attributes",
+				`{"foo": "bar"}`),
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			},
+			inventoryErr: nil,
 			resp: JSONResponseParams{
-				OutputStatus:     200,
-				OutputBodyObject: mockListDeviceIDs(5),
-				OutputHeaders: map[string][]string{
-					"Link": {
-						fmt.Sprintf(utils.LinkTmpl, "devices", "page=3&per_page=5", "prev"),
-						fmt.Sprintf(utils.LinkTmpl, "devices", "page=1&per_page=5", "first"),
-					},
-					hdrTotalCount: {"20"},
-				},
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("failed to decode request body: json: cannot unmarshal string into Go value of type []model.DeviceAttribute"),
 			},
+			scope: model.AttrScopeInventory,
 		},
-		"valid pagination, with next page": {
-			listDevicesNum:   5,
-			listDevicesErr:   nil,
-			listDevicesTotal: 21,
-			inReq:            test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups/foo/devices?page=4&per_page=5", nil),
-			resp: JSONResponseParams{
-				OutputStatus:     200,
-				OutputBodyObject: mockListDeviceIDs(5),
-				OutputHeaders: map[string][]string{
-					"Link": {
-						fmt.Sprintf(utils.LinkTmpl, "devices", "page=3&per_page=5", "prev"),
-						fmt.Sprintf(utils.LinkTmpl, "devices", "page=1&per_page=5", "first"),
+
+		"body formatted ok, attribute name missing": {
+			inReq: test.MakeSimpleRequest("PATCH",
+				"http://1.2.3.4/api/0.1.0/attributes",
+				[]model.DeviceAttribute{
+					{
+						Name:        "name1",
+						Value:       "value1",
+						Description: strPtr("descr1"),
+					},
+					{
+						Value:       2,
+						Description: strPtr("descr2"),
 					},
-					hdrTotalCount: {"21"},
 				},
+			),
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
 			},
-		},
-		"invalid pagination - page format": {
-			listDevicesNum:   5,
-			listDevicesErr:   nil,
-			listDevicesTotal: 5,
-			inReq:            test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups/foo/devices?page=foo&per_page=5", nil),
-			resp: JSONResponseParams{
-				OutputStatus:     400,
-				OutputBodyObject: RestError(utils.MsgQueryParmInvalid("page")),
-				OutputHeaders:    nil,
-			},
-		},
-		"invalid pagination - per_page format": {
-			listDevicesNum:   5,
-			listDevicesErr:   nil,
-			listDevicesTotal: 5,
-			inReq:            test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups/foo/devices?page=1&per_page=foo", nil),
+			inventoryErr: nil,
 			resp: JSONResponseParams{
-				OutputStatus:     400,
-				OutputBodyObject: RestError(utils.MsgQueryParmInvalid("per_page")),
-				OutputHeaders:    nil,
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("name: cannot be blank."),
 			},
+			scope: model.AttrScopeInventory,
 		},
-		"invalid pagination - bounds": {
-			listDevicesNum:   5,
-			listDevicesErr:   nil,
-			listDevicesTotal: 5,
-			inReq:            test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups/foo/devices?page=0&per_page=5", nil),
+
+		"body formatted ok, attribute value missing": {
+			inReq: test.MakeSimpleRequest("PATCH",
+				"http://1.2.3.4/api/0.1.0/attributes",
+				[]model.DeviceAttribute{
+					{
+						Name:        "name1",
+						Description: strPtr("descr1"),
+					},
+				},
+			),
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			},
+			inventoryErr: nil,
 			resp: JSONResponseParams{
-				OutputStatus:     400,
-				OutputBodyObject: RestError(utils.MsgQueryParmLimit("page")),
-				OutputHeaders:    nil,
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("value: supported types are string, float64, and arrays thereof."),
 			},
+			scope: model.AttrScopeInventory,
 		},
-		"inv.ListDevicesByGroup error - group not found": {
-			listDevicesNum:   5,
-			listDevicesErr:   store.ErrGroupNotFound,
-			listDevicesTotal: 20,
-			inReq:            test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups/foo/devices?page=4&per_page=5", nil),
+
+		"body formatted ok, attributes ok (all fields)": {
+			inReq: test.MakeSimpleRequest("PATCH",
+				"http://1.2.3.4/api/0.1.0/attributes",
+				[]model.DeviceAttribute{
+					{
+						Name:        "name1",
+						Value:       "value1",
+						Description: strPtr("descr1"),
+					},
+					{
+						Name:        "name2",
+						Value:       2,
+						Description: strPtr("descr2"),
+					},
+				},
+			),
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			},
+			inventoryErr: nil,
 			resp: JSONResponseParams{
-				OutputStatus:     404,
-				OutputBodyObject: RestError("group not found"),
-				OutputHeaders:    nil,
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: nil,
 			},
+			deviceAttributes: model.DeviceAttributes{
+				{Name: "name1", Value: "value1", Description: strPtr("descr1"), Scope: model.AttrScopeInventory},
+				{Name: "name2", Value: float64(2), Description: strPtr("descr2"), Scope: model.AttrScopeInventory},
+			},
+			scope: model.AttrScopeInventory,
 		},
-		"inv.ListDevicesByGroup error - internal": {
-			listDevicesNum:   5,
-			listDevicesErr:   errors.New("inventory error"),
-			listDevicesTotal: 20,
-			inReq:            test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups/foo/devices?page=4&per_page=5", nil),
+
+		"body formatted ok, attributes ok (all fields), with scope": {
+			inReq: test.MakeSimpleRequest("PATCH",
+				"http://1.2.3.4/api/0.1.0/attributes",
+				[]model.DeviceAttribute{
+					{
+						Name:        "name1",
+						Value:       "value1",
+						Description: strPtr("descr1"),
+						Scope:       model.AttrScopeInventory,
+					},
+					{
+						Name:        "name2",
+						Value:       2,
+						Description: strPtr("descr2"),
+						Scope:       model.AttrScopeInventory,
+					},
+				},
+			),
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			},
+			inventoryErr: nil,
 			resp: JSONResponseParams{
-				OutputStatus:     500,
-				OutputBodyObject: RestError("internal error"),
-				OutputHeaders:    nil,
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: nil,
+			},
+			deviceAttributes: model.DeviceAttributes{
+				{Name: "name1", Value: "value1", Description: strPtr("descr1"), Scope: model.AttrScopeInventory},
+				{Name: "name2", Value: float64(2), Description: strPtr("descr2"), Scope: model.AttrScopeInventory},
 			},
+			scope: model.AttrScopeInventory,
 		},
-	}
-
-	for name, testCase := range testCases {
-		t.Logf("test case: %s", name)
-		inv := minventory.InventoryApp{}
-
-		ctx := contextMatcher()
-
-		inv.On("ListDevicesByGroup",
-			ctx,
-			mock.AnythingOfType("model.GroupName"),
-			mock.AnythingOfType("int"),
-			mock.AnythingOfType("int"),
-		).Return(mockListDeviceIDs(testCase.listDevicesNum), testCase.listDevicesTotal, testCase.listDevicesErr)
-
-		apih := makeMockApiHandler(t, &inv)
-
-		runTestRequest(t, apih, testCase.inReq, testCase.resp)
-	}
-}
-
-func TestApiGetDeviceGroup(t *testing.T) {
-	rest.ErrorFieldName = "error"
-
-	tcases := map[string]struct {
-		JSONResponseParams
-
-		inReq *http.Request
-
-		inventoryGroup model.GroupName
-		inventoryErr   error
-	}{
-
-		/*
-		   device w group
-		   device n group
-		   no device
-		   generic error
-		*/
-
-		"device with group": {
-			inReq:          test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/1/group", nil),
-			inventoryGroup: model.GroupName("dev"),
-			inventoryErr:   nil,
 
-			JSONResponseParams: JSONResponseParams{
+		"body formatted ok, attributes ok (all fields, arrays)": {
+			inReq: test.MakeSimpleRequest("PATCH",
+				"http://1.2.3.4/api/0.1.0/attributes",
+				[]model.DeviceAttribute{
+					{
+						Name:        "name1",
+						Value:       []interface{}{"foo", "bar"},
+						Description: strPtr("descr1"),
+					},
+					{
+						Name:        "name2",
+						Value:       []interface{}{1, 2, 3},
+						Description: strPtr("descr2"),
+					},
+				},
+			),
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			},
+			inventoryErr: nil,
+			resp: JSONResponseParams{
 				OutputStatus:     http.StatusOK,
-				OutputBodyObject: map[string]interface{}{"group": "dev"},
+				OutputBodyObject: nil,
 			},
+			scope: model.AttrScopeInventory,
 		},
-		"device without group": {
-			inReq:          test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/1/group", nil),
-			inventoryGroup: model.GroupName(""),
-			inventoryErr:   nil,
 
-			JSONResponseParams: JSONResponseParams{
+		"body formatted ok, attributes ok (values only)": {
+			inReq: test.MakeSimpleRequest("PATCH",
+				"http://1.2.3.4/api/0.1.0/attributes",
+				[]model.DeviceAttribute{
+					{
+						Name:  "name1",
+						Value: "value1",
+					},
+					{
+						Name:  "name2",
+						Value: 2,
+					},
+				},
+			),
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			},
+			inventoryErr: nil,
+			resp: JSONResponseParams{
 				OutputStatus:     http.StatusOK,
-				OutputBodyObject: map[string]interface{}{"group": nil},
+				OutputBodyObject: nil,
 			},
+			scope: model.AttrScopeInventory,
 		},
-		"device not found": {
-			inReq:          test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/1/group", nil),
-			inventoryGroup: model.GroupName(""),
-			inventoryErr:   store.ErrDevNotFound,
 
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusNotFound,
-				OutputBodyObject: RestError(store.ErrDevNotFound.Error()),
+		"body formatted ok, attributes ok, but values are empty": {
+			inReq: test.MakeSimpleRequest("PATCH",
+				"http://1.2.3.4/api/0.1.0/attributes",
+				[]model.DeviceAttribute{
+					{
+						Name:  "name1",
+						Value: "",
+					},
+					{
+						Name:  "name2",
+						Value: "",
+					},
+				},
+			),
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			},
+			inventoryErr: nil,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: nil,
 			},
+			scope: model.AttrScopeInventory,
 		},
-		"generic inventory error": {
-			inReq:          test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/1/group", nil),
-			inventoryGroup: model.GroupName(""),
-			inventoryErr:   errors.New("inventory: internal error"),
 
-			JSONResponseParams: JSONResponseParams{
+		"body formatted ok, attributes ok (all fields), inventory err": {
+			inReq: test.MakeSimpleRequest("PATCH",
+				"http://1.2.3.4/api/0.1.0/attributes",
+				[]model.DeviceAttribute{
+					{
+						Name:        "name1",
+						Value:       "value1",
+						Description: strPtr("descr1"),
+					},
+					{
+						Name:        "name2",
+						Value:       2,
+						Description: strPtr("descr2"),
+					},
+				},
+			),
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			},
+			inventoryErr: errors.New("internal error"),
+			resp: JSONResponseParams{
 				OutputStatus:     http.StatusInternalServerError,
 				OutputBodyObject: RestError("internal error"),
 			},
+			scope: model.AttrScopeInventory,
 		},
-	}
-
-	for name, tc := range tcases {
-		t.Logf("test case: %s", name)
-		inv := minventory.InventoryApp{}
 
-		ctx := contextMatcher()
+		"body formatted ok, attributes ok (values only), PUT": {
+			inReq: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/0.1.0/attributes",
+				[]model.DeviceAttribute{
+					{
+						Name:  "name1",
+						Value: "value1",
+					},
+					{
+						Name:  "name2",
+						Value: 2,
+					},
+				},
+			),
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			},
+			inventoryErr: nil,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: nil,
+			},
+			scope: model.AttrScopeInventory,
+		},
+	}
 
-		inv.On("GetDeviceGroup",
-			ctx,
-			mock.AnythingOfType("model.DeviceID")).Return(tc.inventoryGroup, tc.inventoryErr)
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
 
-		apih := makeMockApiHandler(t, &inv)
+			ctx := contextMatcher()
 
-		runTestRequest(t, apih, tc.inReq, tc.JSONResponseParams)
+			if tc.inReq.Method == http.MethodPatch {
+				inv.On("UpsertAttributesWithUpdated",
+					ctx,
+					mock.AnythingOfType("model.DeviceID"),
+					mock.MatchedBy(
+						func(attrs model.DeviceAttributes) bool {
+							if tc.deviceAttributes != nil {
+								if !reflect.DeepEqual(tc.deviceAttributes, attrs) {
+									assert.FailNow(t, "", "attributes not equal: %v \n%v\n", tc.deviceAttributes, attrs)
+								}
+							}
+							return true
+						},
+					),
+					tc.scope,
+					tc.etag,
+				).Return(tc.inventoryErr)
+			} else {
+				inv.On("ReplaceAttributes",
+					ctx,
+					mock.AnythingOfType("model.DeviceID"),
+					mock.MatchedBy(
+						func(attrs model.DeviceAttributes) bool {
+							if tc.deviceAttributes != nil {
+								if !reflect.DeepEqual(tc.deviceAttributes, attrs) {
+									assert.FailNow(t, "", "attributes not equal: %v \n%v\n", tc.deviceAttributes, attrs)
+								}
+							}
+							return true
+						},
+					),
+					tc.scope,
+					tc.etag,
+				).Return(tc.inventoryErr)
+			}
+
+			apih := makeMockApiHandler(t, &inv)
+
+			rest.ErrorFieldName = "error"
+
+			for k, v := range tc.inHdrs {
+				tc.inReq.Header.Set(k, v)
+			}
+
+			runTestRequest(t, apih, tc.inReq, tc.resp)
+		})
 	}
 }
 
-func TestApiGetDeviceGroupInternal(t *testing.T) {
+func makeDeviceAuthHeader(claim string) string {
+	return fmt.Sprintf("Bearer base.%s.sign",
+		base64.RawURLEncoding.EncodeToString([]byte(claim)))
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestApiInventoryProtectedScopes(t *testing.T) {
+	t.Parallel()
 	rest.ErrorFieldName = "error"
 
-	tcases := map[string]struct {
-		JSONResponseParams
+	testCases := map[string]struct {
+		inReq  *http.Request
+		config *Config
 
-		inReq *http.Request
+		callsInventory bool
 
-		inventoryGroup model.GroupName
-		inventoryErr   error
+		resp JSONResponseParams
 	}{
-		"device with group": {
-			inReq:          test.MakeSimpleRequest("GET", "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/1/groups", nil),
-			inventoryGroup: model.GroupName("dev"),
-			inventoryErr:   nil,
-
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusOK,
-				OutputBodyObject: model.DeviceGroups{Groups: []string{"dev"}},
+		"ok, tags not protected": {
+			inReq: test.MakeSimpleRequest("PATCH",
+				"http://1.2.3.4/api/0.1.0/devices/1/tags",
+				[]model.DeviceAttribute{{Name: "env", Value: "prod"}},
+			),
+			callsInventory: true,
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
 			},
 		},
-		"device without group": {
-			inReq:          test.MakeSimpleRequest("GET", "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/1/groups", nil),
-			inventoryGroup: model.GroupName(""),
-			inventoryErr:   nil,
-
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusOK,
-				OutputBodyObject: model.DeviceGroups{},
+		"error, tags protected": {
+			inReq: test.MakeSimpleRequest("PATCH",
+				"http://1.2.3.4/api/0.1.0/devices/1/tags",
+				[]model.DeviceAttribute{{Name: "env", Value: "prod"}},
+			),
+			config: &Config{
+				ProtectedScopes: []string{model.AttrScopeTags},
+			},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusForbidden,
+				OutputBodyObject: RestError("attribute scope tags is read-only"),
 			},
 		},
-		"device not found": {
-			inReq:          test.MakeSimpleRequest("GET", "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/1/groups", nil),
-			inventoryGroup: model.GroupName(""),
-			inventoryErr:   store.ErrDevNotFound,
-
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusNotFound,
-				OutputBodyObject: RestError(store.ErrDevNotFound.Error()),
+		"error, tags protected, replace with no tags": {
+			inReq: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/0.1.0/devices/1/tags",
+				[]model.DeviceAttribute{},
+			),
+			config: &Config{
+				ProtectedScopes: []string{model.AttrScopeTags},
+			},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusForbidden,
+				OutputBodyObject: RestError("attribute scope tags is read-only"),
 			},
 		},
-		"generic inventory error": {
-			inReq:          test.MakeSimpleRequest("GET", "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/1/groups", nil),
-			inventoryGroup: model.GroupName(""),
-			inventoryErr:   errors.New("inventory: internal error"),
-
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusInternalServerError,
-				OutputBodyObject: RestError("internal error"),
+		"ok, device attributes": {
+			inReq: test.MakeSimpleRequest("PATCH",
+				"http://1.2.3.4/api/0.1.0/attributes",
+				[]model.DeviceAttribute{{Name: "mac", Value: "00:00:00:01"}},
+			),
+			callsInventory: true,
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+			},
+		},
+		"error, device attributes with protected scope": {
+			inReq: test.MakeSimpleRequest("PATCH",
+				"http://1.2.3.4/api/0.1.0/attributes",
+				[]model.DeviceAttribute{{
+					Name:  "status",
+					Value: "accepted",
+					Scope: model.AttrScopeIdentity,
+				}},
+			),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusForbidden,
+				OutputBodyObject: RestError("attribute scope identity is read-only"),
 			},
 		},
 	}
 
-	for name, tc := range tcases {
-		t.Logf("test case: %s", name)
-		inv := minventory.InventoryApp{}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
 
-		ctx := contextMatcher()
+			if tc.callsInventory {
+				inv.On("UpsertAttributesWithUpdated",
+					contextMatcher(),
+					mock.AnythingOfType("model.DeviceID"),
+					mock.AnythingOfType("model.DeviceAttributes"),
+					mock.AnythingOfType("string"),
+					"",
+				).Return(nil)
+			}
 
-		inv.On("GetDeviceGroup",
-			ctx,
-			mock.AnythingOfType("model.DeviceID")).Return(tc.inventoryGroup, tc.inventoryErr)
+			apih := makeMockApiHandlerWithConfig(t, &inv, tc.config)
 
-		apih := makeMockApiHandler(t, &inv)
+			tc.inReq.Header.Set("Authorization",
+				makeDeviceAuthHeader(`{"sub":"1","mender.device":true}`))
 
-		runTestRequest(t, apih, tc.inReq, tc.JSONResponseParams)
+			runTestRequest(t, apih, tc.inReq, tc.resp)
+		})
 	}
 }
 
-func TestApiDeleteDeviceInventory(t *testing.T) {
+func TestApiInventoryAttributesNullValue(t *testing.T) {
 	t.Parallel()
 	rest.ErrorFieldName = "error"
 
-	tcases := map[string]struct {
-		JSONResponseParams
+	payload := `[{"name": "removed", "value": null}, {"name": "empty", "value": ""}]`
+	expected := model.DeviceAttributes{
+		{Name: "removed", Value: nil, Scope: model.AttrScopeInventory},
+		{Name: "empty", Value: "", Scope: model.AttrScopeInventory},
+	}
 
-		inReq        *http.Request
-		inDevId      model.DeviceID
-		inventoryErr error
+	testCases := map[string]struct {
+		method string
+		config *Config
+
+		callsInventory string
+		resp           JSONResponseParams
 	}{
-		"no device": {
-			inDevId:      model.DeviceID("1"),
-			inReq:        test.MakeSimpleRequest("DELETE", "http://1.2.3.4/api/0.1.0/devices/1", nil),
-			inventoryErr: store.ErrDevNotFound,
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus: http.StatusNoContent,
+		"ok, upsert removes null attributes": {
+			method:         http.MethodPatch,
+			config:         &Config{NullAttributeValueRemoves: true},
+			callsInventory: "UpsertAttributesWithUpdated",
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
 			},
 		},
-		"some device": {
-			inDevId: model.DeviceID("2"),
-			inReq:   test.MakeSimpleRequest("DELETE", "http://1.2.3.4/api/0.1.0/devices/2", nil),
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus: http.StatusNoContent,
+		"ok, replace removes null attributes": {
+			method:         http.MethodPut,
+			config:         &Config{NullAttributeValueRemoves: true},
+			callsInventory: "ReplaceAttributes",
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
 			},
 		},
-		"error": {
-			inDevId: model.DeviceID("3"),
-			inReq:   test.MakeSimpleRequest("DELETE", "http://1.2.3.4/api/0.1.0/devices/3", nil),
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusInternalServerError,
-				OutputBodyObject: RestError("internal error"),
+		"error, null attributes not allowed": {
+			method: http.MethodPatch,
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError(
+					"value: supported types are string, float64, and arrays thereof."),
 			},
-			inventoryErr: errors.New("inventory internal error"),
 		},
 	}
 
-	for name, tc := range tcases {
-		t.Run(fmt.Sprintf("test case: %s", name), func(t *testing.T) {
-
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
 			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.callsInventory != "" {
+				inv.On(tc.callsInventory,
+					contextMatcher(),
+					model.DeviceID("1"),
+					expected,
+					model.AttrScopeInventory,
+					"",
+				).Return(nil)
+			}
 
-			ctx := contextMatcher()
-
-			inv.On("ReplaceAttributes",
-				ctx,
-				tc.inDevId,
-				model.DeviceAttributes{},
-				model.AttrScopeInventory,
-				"").Return(tc.inventoryErr)
+			apih := makeMockApiHandlerWithConfig(t, &inv, tc.config)
 
-			apih := makeMockApiHandler(t, &inv)
+			req := test.MakeSimpleRequest(tc.method,
+				"http://1.2.3.4/api/0.1.0/attributes", nil)
+			req.Body = io.NopCloser(strings.NewReader(payload))
+			req.Header.Set("Authorization",
+				makeDeviceAuthHeader(`{"sub":"1","mender.device":true}`))
 
-			runTestRequest(t, apih, tc.inReq, tc.JSONResponseParams)
+			runTestRequest(t, apih, req, tc.resp)
 		})
 	}
 }
 
-func TestApiDeleteDevice(t *testing.T) {
+func TestApiInventoryUpsertAttributesInternal(t *testing.T) {
 	t.Parallel()
+
 	rest.ErrorFieldName = "error"
 
-	tcases := map[string]struct {
-		JSONResponseParams
+	testCases := map[string]struct {
+		tenantId string
+		deviceId string
+		scope    string
+		inReq    *http.Request
+		inHdrs   map[string]string
+		payload  interface{}
 
-		inReq        *http.Request
-		inDevId      model.DeviceID
 		inventoryErr error
+
+		resp             JSONResponseParams
+		deviceAttributes model.DeviceAttributes
 	}{
-		"no device": {
-			inDevId:      model.DeviceID("1"),
-			inReq:        test.MakeSimpleRequest("DELETE", "http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices/1", nil),
-			inventoryErr: store.ErrDevNotFound,
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus: http.StatusNoContent,
+		"empty body": {
+			tenantId: "3456355",
+			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
+			scope:    "inventory",
+
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
 			},
-		},
-		"some device": {
-			inDevId: model.DeviceID("2"),
-			inReq:   test.MakeSimpleRequest("DELETE", "http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices/2", nil),
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus: http.StatusNoContent,
-			},
-		},
-		"error": {
-			inDevId: model.DeviceID("3"),
-			inReq:   test.MakeSimpleRequest("DELETE", "http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices/3", nil),
-			JSONResponseParams: JSONResponseParams{
-				OutputStatus:     http.StatusInternalServerError,
-				OutputBodyObject: RestError("internal error"),
+			inventoryErr: nil,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("failed to decode request body: JSON payload is empty"),
 			},
-			inventoryErr: errors.New("inventory internal error"),
 		},
-	}
-
-	for name, tc := range tcases {
-		t.Run(fmt.Sprintf("test case: %s", name), func(t *testing.T) {
-
-			inv := minventory.InventoryApp{}
-
-			ctx := contextMatcher()
-
-			inv.On("DeleteDevice",
-				ctx,
-				tc.inDevId).Return(tc.inventoryErr)
-
-			apih := makeMockApiHandler(t, &inv)
-
-			runTestRequest(t, apih, tc.inReq, tc.JSONResponseParams)
-		})
-	}
-}
 
-func TestAPICDeleteGroup(t *testing.T) {
-	testCases := []struct {
-		Name string
+		"missing device id": {
+			tenantId: "3456355",
+			scope:    "inventory",
+			payload: []model.DeviceAttribute{
+				{
+					Name:        "name1",
+					Value:       []interface{}{"foo", "bar"},
+					Description: strPtr("descr1"),
+				},
+				{
+					Name:        "name2",
+					Value:       []interface{}{1, 2, 3},
+					Description: strPtr("descr2"),
+				},
+			},
 
-		model.GroupName
-		*http.Request
-		JSONResponseParams
-		InventoryErr error
-	}{{
-		Name: "ok",
-		Request: test.MakeSimpleRequest(
-			"DELETE",
-			"http://localhost/api/0.1.0/groups/foo",
-			nil,
-		),
-		GroupName: "foo",
-		JSONResponseParams: JSONResponseParams{
-			OutputStatus: http.StatusOK,
-			OutputBodyObject: &model.UpdateResult{
-				UpdatedCount: 2,
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			},
+			inventoryErr: nil,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("device id cannot be empty"),
 			},
 		},
-	}, {
-		Name: "internal error",
 
-		Request: test.MakeSimpleRequest(
-			"DELETE",
-			"http://localhost/api/0.1.0/groups/foo",
-			nil,
-		),
-		GroupName: "foo",
-		JSONResponseParams: JSONResponseParams{
-			OutputStatus: http.StatusInternalServerError,
-			OutputBodyObject: map[string]interface{}{
-				"error":      "internal error",
-				"request_id": "test",
+		"attribute type conflict": {
+			tenantId: "3456355",
+			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
+			scope:    "inventory",
+			payload: []model.DeviceAttribute{
+				{
+					Name:  "name1",
+					Value: "foo",
+				},
 			},
-		},
-		InventoryErr: errors.New("unknown error"),
-	}, {
-		Name: "error, invalid group name",
 
-		Request: test.MakeSimpleRequest(
-			"DELETE",
-			"http://localhost/api/0.1.0/groups/illegal$group$name",
-			nil,
-		),
-		JSONResponseParams: JSONResponseParams{
-			OutputStatus: http.StatusBadRequest,
-			OutputBodyObject: map[string]interface{}{
-				"error": "Group name can only contain: upper/lowercase " +
-					"alphanum, -(dash), _(underscore)",
-				"request_id": "test",
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			},
+			inventoryErr: errors.Wrap(store.ErrAttributeTypeConflict, "attribute inventory/name1"),
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusUnprocessableEntity,
+				OutputBodyObject: RestError("attribute inventory/name1: " +
+					store.ErrAttributeTypeConflict.Error()),
 			},
 		},
-	}}
-
-	for _, testCase := range testCases {
-		t.Run(testCase.Name, func(t *testing.T) {
-			inv := minventory.InventoryApp{}
-			ctx := contextMatcher()
-			apih := makeMockApiHandler(t, &inv)
-
-			var ret *model.UpdateResult
-			if rsp, ok := testCase.JSONResponseParams.
-				OutputBodyObject.(*model.
-				UpdateResult); ok {
-				ret = rsp
-			}
-			inv.On("DeleteGroup",
-				ctx,
-				testCase.GroupName,
-			).Return(
-				ret,
-				testCase.InventoryErr,
-			)
-			runTestRequest(t, apih,
-				testCase.Request,
-				testCase.JSONResponseParams,
-			)
-		})
-	}
-}
-
-func TestAPIClearDevicesGroup(t *testing.T) {
-	testCases := []struct {
-		Name string
 
-		Devices []model.DeviceID
-		model.GroupName
-		*http.Request
-		JSONResponseParams
-		InventoryErr error
-	}{{
-		Name: "ok, some devices",
+		"garbled body": {
+			tenantId: "3456355",
+			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
+			scope:    "inventory",
 
-		Request: test.MakeSimpleRequest(
-			"DELETE",
-			"http://localhost/api/0.1.0/groups/foo/devices",
-			[]model.DeviceID{"1", "2", "3"},
-		),
-		GroupName: "foo",
-		Devices:   []model.DeviceID{"1", "2", "3"},
-		JSONResponseParams: JSONResponseParams{
-			OutputStatus: http.StatusOK,
-			OutputBodyObject: &model.UpdateResult{
-				UpdatedCount: 3,
+			payload: `{"foo": "bar"}`,
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			},
+			inventoryErr: nil,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("failed to decode request body: json: cannot unmarshal string into Go value of type []model.DeviceAttribute"),
 			},
 		},
-	}, {
-		Name: "error, empty device list",
 
-		Request: test.MakeSimpleRequest(
-			"DELETE",
-			"http://localhost/api/0.1.0/groups/foo/devices",
-			[]model.DeviceID{},
-		),
-		Devices:   []model.DeviceID{},
-		GroupName: "foo",
-		JSONResponseParams: JSONResponseParams{
-			OutputStatus: http.StatusBadRequest,
-			OutputBodyObject: map[string]interface{}{
-				"error":      "no device IDs present in payload",
-				"request_id": "test",
+		"body formatted ok, attribute name missing": {
+			tenantId: "3456355",
+			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
+			scope:    "inventory",
+
+			payload: []model.DeviceAttribute{
+				{
+					Name:        "name1",
+					Value:       "value1",
+					Description: strPtr("descr1"),
+				},
+				{
+					Value:       2,
+					Description: strPtr("descr2"),
+				},
+			},
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			},
+			inventoryErr: nil,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("name: cannot be blank."),
 			},
 		},
-	}, {
-		Name: "error, invalid schema",
 
-		Request: test.MakeSimpleRequest(
-			"DELETE",
-			"http://localhost/api/0.1.0/groups/foo/devices",
-			map[string]string{"foo": "bar"},
-		),
-		GroupName: "foo",
-		JSONResponseParams: JSONResponseParams{
-			OutputStatus: http.StatusBadRequest,
-			OutputBodyObject: map[string]interface{}{
-				"error": "invalid payload schema: json: " +
-					"cannot unmarshal object into Go " +
-					"value of type []model.DeviceID",
-				"request_id": "test",
+		"body formatted ok, attribute value missing": {
+			tenantId: "3456355",
+			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
+			scope:    "inventory",
+
+			payload: []model.DeviceAttribute{
+				{
+					Name:        "name1",
+					Description: strPtr("descr1"),
+				},
+			},
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			},
+			inventoryErr: nil,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("value: supported types are string, float64, and arrays thereof."),
 			},
 		},
-	}, {
-		Name: "internal error",
 
-		Request: test.MakeSimpleRequest(
-			"DELETE",
-			"http://localhost/api/0.1.0/groups/foo/devices",
-			[]model.DeviceID{"1", "2", "3"},
+		"body formatted ok, attributes ok (all fields)": {
+			tenantId: "3456355",
+			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
+			scope:    "inventory",
+
+			payload: []model.DeviceAttribute{
+				{
+					Name:        "name1",
+					Value:       "value1",
+					Description: strPtr("descr1"),
+				},
+				{
+					Name:        "name2",
+					Value:       2,
+					Description: strPtr("descr2"),
+				},
+			},
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			},
+			inventoryErr: nil,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: nil,
+			},
+			deviceAttributes: model.DeviceAttributes{
+				{Name: "name1", Value: "value1", Description: strPtr("descr1"), Scope: model.AttrScopeInventory},
+				{Name: "name2", Value: float64(2), Description: strPtr("descr2"), Scope: model.AttrScopeInventory},
+			},
+		},
+
+		"body formatted ok, attributes ok (all fields), with scope": {
+			tenantId: "3456355",
+			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
+			scope:    "inventory",
+
+			payload: []model.DeviceAttribute{
+				{
+					Name:        "name1",
+					Value:       "value1",
+					Description: strPtr("descr1"),
+					Scope:       model.AttrScopeInventory,
+				},
+				{
+					Name:        "name2",
+					Value:       2,
+					Description: strPtr("descr2"),
+					Scope:       model.AttrScopeInventory,
+				},
+			},
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			},
+			inventoryErr: nil,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: nil,
+			},
+			deviceAttributes: model.DeviceAttributes{
+				{Name: "name1", Value: "value1", Description: strPtr("descr1"), Scope: model.AttrScopeInventory},
+				{Name: "name2", Value: float64(2), Description: strPtr("descr2"), Scope: model.AttrScopeInventory},
+			},
+		},
+
+		"body formatted ok, attributes ok (all fields, arrays)": {
+			tenantId: "3456355",
+			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
+			scope:    "inventory",
+
+			payload: []model.DeviceAttribute{
+				{
+					Name:        "name1",
+					Value:       []interface{}{"foo", "bar"},
+					Description: strPtr("descr1"),
+				},
+				{
+					Name:        "name2",
+					Value:       []interface{}{1, 2, 3},
+					Description: strPtr("descr2"),
+				},
+			},
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			},
+			inventoryErr: nil,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: nil,
+			},
+		},
+
+		"body formatted ok, attributes ok (values only)": {
+			tenantId: "3456355",
+			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
+			scope:    "inventory",
+
+			payload: []model.DeviceAttribute{
+				{
+					Name:  "name1",
+					Value: "value1",
+				},
+				{
+					Name:  "name2",
+					Value: 2,
+				},
+			},
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			},
+			inventoryErr: nil,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: nil,
+			},
+		},
+
+		"body formatted ok, attributes ok, but values are empty": {
+			tenantId: "3456355",
+			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
+			scope:    "inventory",
+
+			payload: []model.DeviceAttribute{
+				{
+					Name:  "name1",
+					Value: "",
+				},
+				{
+					Name:  "name2",
+					Value: "",
+				},
+			},
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			},
+			inventoryErr: nil,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: nil,
+			},
+		},
+
+		"body formatted ok, attributes ok (all fields), inventory err": {
+			tenantId: "3456355",
+			deviceId: "sdfg435fgs-gs-dgsfgdfs-3456dgsf",
+			scope:    "inventory",
+
+			payload: []model.DeviceAttribute{
+				{
+					Name:        "name1",
+					Value:       "value1",
+					Description: strPtr("descr1"),
+				},
+				{
+					Name:        "name2",
+					Value:       2,
+					Description: strPtr("descr2"),
+				},
+			},
+			inHdrs: map[string]string{
+				"Authorization": makeDeviceAuthHeader(`{"sub":"fakeid","mender.device":true}`),
+			},
+			inventoryErr: errors.New("internal error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+		tc.inReq = test.MakeSimpleRequest("PATCH",
+			"http://1.2.3.4/api/internal/v1/inventory/tenants/"+tc.tenantId+"/device/"+tc.deviceId+"/attribute/scope/"+tc.scope,
+			tc.payload)
+		inv := minventory.InventoryApp{}
+
+		ctx := contextMatcher()
+
+		inv.On("UpsertAttributes",
+			ctx,
+			mock.AnythingOfType("model.DeviceID"),
+			mock.MatchedBy(
+				func(attrs model.DeviceAttributes) bool {
+					if tc.deviceAttributes != nil {
+						if !reflect.DeepEqual(tc.deviceAttributes, attrs) {
+							assert.FailNow(t, "", "attributes not equal: %v \n%v\n", tc.deviceAttributes, attrs)
+						}
+					}
+					return true
+				},
+			),
+		).Return(tc.inventoryErr)
+
+		apih := makeMockApiHandler(t, &inv)
+
+		rest.ErrorFieldName = "error"
+
+		for k, v := range tc.inHdrs {
+			tc.inReq.Header.Set(k, v)
+		}
+
+		runTestRequest(t, apih, tc.inReq, tc.resp)
+	}
+}
+
+func TestApiInventoryDeleteDeviceGroup(t *testing.T) {
+	rest.ErrorFieldName = "error"
+
+	tcases := map[string]struct {
+		JSONResponseParams
+
+		inReq *http.Request
+
+		inventoryErr error
+	}{
+		"ok": {
+			inReq: test.MakeSimpleRequest("DELETE",
+				"http://1.2.3.4/api/0.1.0/devices/123/group/g1", nil),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusNoContent,
+				OutputBodyObject: nil,
+			},
+		},
+		"device group not found (or device's group is other than requested)": {
+			inReq: test.MakeSimpleRequest("DELETE",
+				"http://1.2.3.4/api/0.1.0/devices/123/group/g1", nil),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusNotFound,
+				OutputBodyObject: RestError(store.ErrDevNotFound.Error()),
+			},
+			inventoryErr: store.ErrDevNotFound,
+		},
+		"internal error": {
+			inReq: test.MakeSimpleRequest("DELETE",
+				"http://1.2.3.4/api/0.1.0/devices/123/group/g1", nil),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+			inventoryErr: errors.New("internal error"),
+		},
+	}
+
+	for name, tc := range tcases {
+		t.Logf("test case: %s", name)
+		inv := minventory.InventoryApp{}
+
+		ctx := contextMatcher()
+
+		inv.On("UnsetDeviceGroup",
+			ctx,
+			mock.AnythingOfType("model.DeviceID"),
+			mock.AnythingOfType("model.GroupName")).Return(tc.inventoryErr)
+
+		apih := makeMockApiHandler(t, &inv)
+
+		runTestRequest(t, apih, tc.inReq, tc.JSONResponseParams)
+	}
+}
+
+func TestApiInventoryAddDeviceToGroup(t *testing.T) {
+	rest.ErrorFieldName = "error"
+
+	tcases := map[string]struct {
+		JSONResponseParams
+
+		inReq *http.Request
+
+		inventoryErr error
+	}{
+		"ok": {
+			inReq: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/0.1.0/devices/123/group",
+				InventoryApiGroup{"_a-b-c_"}),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusNoContent,
+				OutputBodyObject: nil,
+			},
+		},
+		"device not found": {
+			inReq: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/0.1.0/devices/123/group",
+				InventoryApiGroup{"abc"}),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusNotFound,
+				OutputBodyObject: RestError(store.ErrDevNotFound.Error()),
+			},
+			inventoryErr: store.ErrDevNotFound,
+		},
+		"empty group name": {
+			inReq: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/0.1.0/devices/123/group",
+				InventoryApiGroup{}),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("Group name cannot be blank"),
+			},
+			inventoryErr: nil,
+		},
+		"unsupported characters in group name": {
+			inReq: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/0.1.0/devices/123/group",
+				InventoryApiGroup{"__+X@#$  ;"}),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("Group name can only contain: upper/lowercase alphanum, -(dash), _(underscore)"),
+			},
+			inventoryErr: nil,
+		},
+		"non-ASCII characters in group name": {
+			inReq: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/0.1.0/devices/123/group",
+				InventoryApiGroup{"ęą"}),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("Group name can only contain: upper/lowercase alphanum, -(dash), _(underscore)"),
+			},
+			inventoryErr: nil,
+		},
+		"empty body": {
+			inReq: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/0.1.0/devices/123/group", nil),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("failed to decode device group data: JSON payload is empty"),
+			},
+			inventoryErr: nil,
+		},
+		"internal error": {
+			inReq: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/0.1.0/devices/123/group",
+				InventoryApiGroup{"abc"}),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+			inventoryErr: errors.New("internal error"),
+		},
+	}
+
+	for name, tc := range tcases {
+		t.Logf("test case: %s", name)
+		inv := minventory.InventoryApp{}
+
+		ctx := contextMatcher()
+
+		inv.On("UpdateDeviceGroup",
+			ctx,
+			mock.AnythingOfType("model.DeviceID"),
+			mock.AnythingOfType("model.GroupName")).Return(tc.inventoryErr)
+
+		apih := makeMockApiHandler(t, &inv)
+
+		runTestRequest(t, apih, tc.inReq, tc.JSONResponseParams)
+	}
+}
+
+func TestApiInventoryTrimGroupNames(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	testCases := map[string]struct {
+		trim bool
+
+		inReq  *http.Request
+		method string
+		args   []interface{}
+		ret    []interface{}
+
+		resp JSONResponseParams
+	}{
+		"ok, add device to group": {
+			trim: true,
+			inReq: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/0.1.0/devices/123/group",
+				InventoryApiGroup{" prod\t"}),
+			method: "UpdateDeviceGroup",
+			args: []interface{}{
+				contextMatcher(), model.DeviceID("123"), model.GroupName("prod"),
+			},
+			ret: []interface{}{nil},
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusNoContent,
+			},
+		},
+		"ok, unset device group": {
+			trim: true,
+			inReq: test.MakeSimpleRequest("DELETE",
+				"http://1.2.3.4/api/0.1.0/devices/123/group/prod%20", nil),
+			method: "UnsetDeviceGroup",
+			args: []interface{}{
+				contextMatcher(), model.DeviceID("123"), model.GroupName("prod"),
+			},
+			ret: []interface{}{nil},
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusNoContent,
+			},
+		},
+		"ok, list group devices": {
+			trim: true,
+			inReq: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/0.1.0/groups/prod%20/devices", nil),
+			method: "ListDevicesByGroup",
+			args: []interface{}{
+				contextMatcher(), model.GroupName("prod"), 0, 20,
+			},
+			ret: []interface{}{[]model.DeviceID{"123"}, 1, nil},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: []model.DeviceID{"123"},
+			},
+		},
+		"error, internal whitespace": {
+			trim: true,
+			inReq: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/0.1.0/devices/123/group",
+				InventoryApiGroup{" pro d "}),
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError("Group name can only contain: " +
+					"upper/lowercase alphanum, -(dash), _(underscore)"),
+			},
+		},
+		"error, trailing whitespace, trimming disabled": {
+			inReq: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/0.1.0/devices/123/group",
+				InventoryApiGroup{"prod "}),
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError("Group name can only contain: " +
+					"upper/lowercase alphanum, -(dash), _(underscore)"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.method != "" {
+				inv.On(tc.method, tc.args...).Return(tc.ret...)
+			}
+
+			config := NewConfig()
+			config.TrimGroupNames = tc.trim
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+			runTestRequest(t, apih, tc.inReq, tc.resp)
+		})
+	}
+}
+
+func TestApiListGroups(t *testing.T) {
+	rest.ErrorFieldName = "error"
+
+	tcases := map[string]struct {
+		JSONResponseParams
+
+		inReq        *http.Request
+		skip         int
+		limit        int
+		outputGroups []model.GroupName
+		totalCount   int
+
+		inventoryErr error
+	}{
+		"some groups": {
+			inReq:        test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups", nil),
+			outputGroups: []model.GroupName{"foo", "bar"},
+			totalCount:   2,
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: []string{"foo", "bar"},
+				OutputHeaders: map[string][]string{
+					hdrTotalCount: {"2"},
+				},
+			},
+		},
+		"no groups": {
+			inReq: test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups?status=rejected", nil),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: []string{},
+				OutputHeaders: map[string][]string{
+					hdrTotalCount: {"0"},
+				},
+			},
+		},
+		"paged": {
+			inReq:        test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups?page=2&per_page=2", nil),
+			skip:         2,
+			limit:        2,
+			outputGroups: []model.GroupName{"baz", "foo"},
+			totalCount:   5,
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: []string{"baz", "foo"},
+				OutputHeaders: map[string][]string{
+					"Link": {
+						fmt.Sprintf(utils.LinkTmpl, "groups", "page=1&per_page=2", "prev"),
+						fmt.Sprintf(utils.LinkTmpl, "groups", "page=3&per_page=2", "next"),
+						fmt.Sprintf(utils.LinkTmpl, "groups", "page=1&per_page=2", "first"),
+					},
+					hdrTotalCount: {"5"},
+				},
+			},
+		},
+		"paged, past the last page": {
+			inReq:        test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups?page=4&per_page=2", nil),
+			skip:         6,
+			limit:        2,
+			outputGroups: []model.GroupName{},
+			totalCount:   5,
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: []string{},
+				OutputHeaders: map[string][]string{
+					"Link": {
+						fmt.Sprintf(utils.LinkTmpl, "groups", "page=3&per_page=2", "prev"),
+						fmt.Sprintf(utils.LinkTmpl, "groups", "page=1&per_page=2", "first"),
+					},
+					hdrTotalCount: {"5"},
+				},
+			},
+		},
+		"error, bad pagination": {
+			inReq: test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups?per_page=foo", nil),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError(utils.MsgQueryParmInvalid("per_page")),
+			},
+		},
+		"error": {
+			inReq: test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups", nil),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+			inventoryErr: errors.New("internal error"),
+		},
+	}
+
+	for name, tc := range tcases {
+		t.Run(name, func(t *testing.T) {
+			var filters []model.FilterPredicate
+			if status := tc.inReq.URL.Query().
+				Get("status"); status != "" {
+				filters = []model.FilterPredicate{{
+					Scope:     model.AttrScopeIdentity,
+					Attribute: "status",
+					Type:      "$eq",
+					Value:     status,
+				}}
+			}
+			inv := minventory.InventoryApp{}
+			ctx := contextMatcher()
+
+			if tc.OutputStatus != http.StatusBadRequest {
+				inv.On("ListGroups", ctx, filters, tc.skip, tc.limit).
+					Return(tc.outputGroups, tc.totalCount, tc.inventoryErr)
+			}
+
+			apih := makeMockApiHandler(t, &inv)
+
+			runTestRequest(t, apih, tc.inReq, tc.JSONResponseParams)
+		})
+	}
+}
+
+func TestApiGetDevice(t *testing.T) {
+	rest.ErrorFieldName = "error"
+
+	tcases := map[string]struct {
+		JSONResponseParams
+
+		inReq        *http.Request
+		inDevId      model.DeviceID
+		outputDevice *model.Device
+		inventoryErr error
+	}{
+		"no device": {
+			inDevId:      model.DeviceID("1"),
+			inReq:        test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/1", nil),
+			outputDevice: nil,
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusNotFound,
+				OutputBodyObject: RestError(store.ErrDevNotFound.Error()),
+			},
+		},
+		"some device": {
+			inDevId: model.DeviceID("2"),
+			inReq:   test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/2", nil),
+			outputDevice: &model.Device{
+				ID:    model.DeviceID("2"),
+				Group: model.GroupName("foo"),
+			},
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+				OutputBodyObject: model.Device{
+					ID:    model.DeviceID("2"),
+					Group: model.GroupName("foo"),
+				},
+			},
+		},
+		"device with timestamps": {
+			inDevId: model.DeviceID("4"),
+			inReq:   test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/4", nil),
+			outputDevice: &model.Device{
+				ID: model.DeviceID("4"),
+				Attributes: model.DeviceAttributes{
+					{Name: "mac", Value: "00:00:00:01", Scope: model.AttrScopeInventory},
+					{Name: model.AttrNameCreated, Value: *timePtr("2023-01-02T03:04:05Z"), Scope: model.AttrScopeSystem},
+					{Name: model.AttrNameUpdated, Value: *timePtr("2023-02-03T04:05:06Z"), Scope: model.AttrScopeSystem},
+				},
+			},
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+				OutputBodyObject: map[string]interface{}{
+					"id": "4",
+					"attributes": []map[string]interface{}{
+						{"name": "mac", "value": "00:00:00:01", "scope": model.AttrScopeInventory},
+						{"name": model.AttrNameCreated, "value": "2023-01-02T03:04:05Z", "scope": model.AttrScopeSystem},
+						{"name": model.AttrNameUpdated, "value": "2023-02-03T04:05:06Z", "scope": model.AttrScopeSystem},
+					},
+					"created_ts": "2023-01-02T03:04:05Z",
+					"updated_ts": "2023-02-03T04:05:06Z",
+				},
+			},
+		},
+		"device with attribute timestamps": {
+			inDevId: model.DeviceID("6"),
+			inReq:   test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/6", nil),
+			outputDevice: &model.Device{
+				ID: model.DeviceID("6"),
+				Attributes: model.DeviceAttributes{
+					{
+						Name:      "ip",
+						Value:     "10.0.0.1",
+						Scope:     model.AttrScopeInventory,
+						Timestamp: timePtr("2023-01-02T03:04:05Z"),
+					},
+				},
+			},
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+				OutputBodyObject: map[string]interface{}{
+					"id": "6",
+					"attributes": []map[string]interface{}{
+						{
+							"name":      "ip",
+							"value":     "10.0.0.1",
+							"scope":     model.AttrScopeInventory,
+							"timestamp": "2023-01-02T03:04:05Z",
+						},
+					},
+				},
+			},
+		},
+		"device with timestamps set": {
+			inDevId: model.DeviceID("5"),
+			inReq:   test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/5", nil),
+			outputDevice: &model.Device{
+				ID:        model.DeviceID("5"),
+				CreatedTs: *timePtr("2023-01-02T03:04:05Z"),
+				UpdatedTs: timePtr("2023-02-03T04:05:06Z"),
+			},
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+				OutputBodyObject: map[string]interface{}{
+					"id":         "5",
+					"created_ts": "2023-01-02T03:04:05Z",
+					"updated_ts": "2023-02-03T04:05:06Z",
+				},
+			},
+		},
+		"error": {
+			inDevId: model.DeviceID("3"),
+			inReq:   test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/3", nil),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+			inventoryErr: errors.New("internal error"),
+		},
+	}
+
+	for name, tc := range tcases {
+		t.Logf("test case: %s", name)
+		inv := minventory.InventoryApp{}
+
+		ctx := contextMatcher()
+
+		inv.On("GetDevice", ctx, tc.inDevId).Return(tc.outputDevice, tc.inventoryErr)
+
+		apih := makeMockApiHandler(t, &inv)
+
+		runTestRequest(t, apih, tc.inReq, tc.JSONResponseParams)
+	}
+}
+
+func TestApiMsgpackResponses(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	device := model.Device{
+		ID: model.DeviceID("1"),
+		Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:00:00:01", Scope: model.AttrScopeIdentity},
+			{Name: "device_type", Value: "rpi3", Scope: model.AttrScopeInventory},
+			{Name: "cpus", Value: float64(4), Scope: model.AttrScopeInventory},
+		},
+		CreatedTs: now,
+		UpdatedTs: &now,
+	}
+	searchParams := model.SearchParams{Page: 1, PerPage: 20}
+
+	testCases := map[string]struct {
+		inReq   *http.Request
+		accept  string
+		msgpack bool
+	}{
+		"ok, device as msgpack": {
+			inReq:   test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/1", nil),
+			accept:  "application/msgpack",
+			msgpack: true,
+		},
+		"ok, device as msgpack, x- media type with parameters": {
+			inReq:   test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/1", nil),
+			accept:  "application/json;q=0.5, application/x-msgpack;q=1",
+			msgpack: true,
+		},
+		"ok, device as msgpack, preferred over any type": {
+			inReq:   test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/1", nil),
+			accept:  "*/*;q=0.1, application/msgpack;q=0.5",
+			msgpack: true,
+		},
+		"ok, device as json": {
+			inReq:  test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/1", nil),
+			accept: "application/json",
+		},
+		"ok, device as json, msgpack not acceptable": {
+			inReq:  test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/1", nil),
+			accept: "application/json;q=1, application/msgpack;q=0",
+		},
+		"ok, device as json, preferred over msgpack": {
+			inReq:  test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/1", nil),
+			accept: "application/msgpack;q=0.5, application/json",
+		},
+		"ok, device as json by default": {
+			inReq: test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/1", nil),
+		},
+		"ok, search as msgpack": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				searchParams),
+			accept:  "application/msgpack",
+			msgpack: true,
+		},
+		"ok, search as json": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				searchParams),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			isSearch := tc.inReq.Method == http.MethodPost
+			if isSearch {
+				inv.On("SearchDevices", contextMatcher(), searchParams).
+					Return([]model.Device{device}, 1, nil)
+			} else {
+				inv.On("GetDevice", contextMatcher(), device.ID).
+					Return(&device, nil)
+			}
+			if tc.accept != "" {
+				tc.inReq.Header.Set("Accept", tc.accept)
+			}
+
+			apih := makeMockApiHandler(t, &inv)
+			recorded := test.RunRequest(t, apih, tc.inReq)
+			recorded.CodeIs(http.StatusOK)
+
+			var expected interface{} = device
+			if isSearch {
+				expected = []model.Device{device}
+			}
+			if !tc.msgpack {
+				recorded.ContentTypeIsJson()
+				recorded.BodyIs(ToJson(expected))
+				return
+			}
+
+			// both encodings carry the same document
+			recorded.HeaderIs("Content-Type", "application/msgpack")
+			handle := &codec.MsgpackHandle{}
+			handle.RawToString = true
+			handle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+			var actual interface{}
+			err := codec.NewDecoderBytes(recorded.Recorder.Body.Bytes(), handle).
+				Decode(&actual)
+			assert.NoError(t, err)
+			var expectedDoc interface{}
+			err = json.Unmarshal([]byte(ToJson(expected)), &expectedDoc)
+			assert.NoError(t, err)
+			assert.Equal(t, expectedDoc, actual)
+			assert.Contains(t, ToJson(expected), `"created_ts"`)
+		})
+	}
+}
+
+func TestApiGetDeviceAttributes(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	// 25 attributes, 5 in each scope, inserted in reverse order
+	manyAttrs := model.DeviceAttributes{}
+	sortedAttrs := model.DeviceAttributes{}
+	scopes := []string{
+		model.AttrScopeIdentity,
+		model.AttrScopeInventory,
+		model.AttrScopeMonitor,
+		model.AttrScopeSystem,
+		model.AttrScopeTags,
+	}
+	for _, scope := range scopes {
+		for j := 0; j < 5; j++ {
+			sortedAttrs = append(sortedAttrs, model.DeviceAttribute{
+				Name:  fmt.Sprintf("attr%02d", j),
+				Value: "value",
+				Scope: scope,
+			})
+		}
+	}
+	for j := len(sortedAttrs) - 1; j >= 0; j-- {
+		manyAttrs = append(manyAttrs, sortedAttrs[j])
+	}
+	device := &model.Device{
+		ID:         model.DeviceID("1"),
+		Attributes: manyAttrs,
+	}
+
+	tcases := map[string]struct {
+		JSONResponseParams
+
+		inReq        *http.Request
+		outputDevice *model.Device
+		inventoryErr error
+	}{
+		"ok, first page": {
+			inReq: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/inventory/devices/1/attributes?per_page=10",
+				nil),
+			outputDevice: device,
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: sortedAttrs[:10],
+				OutputHeaders: map[string][]string{
+					"Link": {
+						fmt.Sprintf(utils.LinkTmpl, "attributes", "page=2&per_page=10", "next"),
+						fmt.Sprintf(utils.LinkTmpl, "attributes", "page=1&per_page=10", "first"),
+					},
+					hdrTotalCount: {"25"},
+				},
+			},
+		},
+		"ok, last page": {
+			inReq: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/inventory/devices/1/attributes?page=3&per_page=10",
+				nil),
+			outputDevice: device,
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: sortedAttrs[20:],
+				OutputHeaders: map[string][]string{
+					"Link": {
+						fmt.Sprintf(utils.LinkTmpl, "attributes", "page=2&per_page=10", "prev"),
+						fmt.Sprintf(utils.LinkTmpl, "attributes", "page=1&per_page=10", "first"),
+					},
+					hdrTotalCount: {"25"},
+				},
+			},
+		},
+		"ok, page out of range": {
+			inReq: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/inventory/devices/1/attributes?page=4&per_page=10",
+				nil),
+			outputDevice: device,
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: model.DeviceAttributes{},
+				OutputHeaders: map[string][]string{
+					hdrTotalCount: {"25"},
+				},
+			},
+		},
+		"error, bad pagination": {
+			inReq: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/inventory/devices/1/attributes?page=0",
+				nil),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError(utils.MsgQueryParmLimit(utils.PageName)),
+			},
+		},
+		"error, no device": {
+			inReq: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/inventory/devices/1/attributes",
+				nil),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusNotFound,
+				OutputBodyObject: RestError(store.ErrDevNotFound.Error()),
+			},
+		},
+		"error, internal": {
+			inReq: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/inventory/devices/1/attributes",
+				nil),
+			inventoryErr: errors.New("internal error"),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range tcases {
+		t.Logf("test case: %s", name)
+		inv := minventory.InventoryApp{}
+
+		ctx := contextMatcher()
+
+		inv.On("GetDevice", ctx, model.DeviceID("1")).
+			Return(tc.outputDevice, tc.inventoryErr)
+
+		apih := makeMockApiHandler(t, &inv)
+
+		runTestRequest(t, apih, tc.inReq, tc.JSONResponseParams)
+	}
+}
+
+func TestApiGetStaleDevices(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	tcases := map[string]struct {
+		JSONResponseParams
+
+		inReq     *http.Request
+		olderThan time.Duration
+
+		outputDevices []model.Device
+		outputTotal   int
+		inventoryErr  error
+	}{
+		"ok": {
+			inReq: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/inventory/devices/stale?older_than=24h&per_page=5",
+				nil),
+			olderThan:     24 * time.Hour,
+			outputDevices: mockListDevices(5),
+			outputTotal:   7,
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: mockListDevices(5),
+				OutputHeaders: map[string][]string{
+					"Link": {
+						fmt.Sprintf(utils.LinkTmpl, "stale", "older_than=24h&page=2&per_page=5", "next"),
+						fmt.Sprintf(utils.LinkTmpl, "stale", "older_than=24h&page=1&per_page=5", "first"),
+					},
+					hdrTotalCount: {"7"},
+				},
+			},
+		},
+		"error, missing older_than": {
+			inReq: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/inventory/devices/stale",
+				nil),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError(utils.MsgQueryParmMissing(queryParamOlderThan)),
+			},
+		},
+		"error, invalid older_than": {
+			inReq: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/inventory/devices/stale?older_than=yesterday",
+				nil),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError(utils.MsgQueryParmInvalid(queryParamOlderThan)),
+			},
+		},
+		"error, negative older_than": {
+			inReq: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/inventory/devices/stale?older_than=-1h",
+				nil),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError(utils.MsgQueryParmInvalid(queryParamOlderThan)),
+			},
+		},
+		"error, internal": {
+			inReq: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/inventory/devices/stale?older_than=1h",
+				nil),
+			olderThan:    time.Hour,
+			inventoryErr: errors.New("internal error"),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range tcases {
+		t.Logf("test case: %s", name)
+		inv := minventory.InventoryApp{}
+
+		ctx := contextMatcher()
+
+		inv.On("SearchDevices", ctx, mock.MatchedBy(
+			func(params model.SearchParams) bool {
+				if !assert.Len(t, params.Filters, 1) || !assert.Len(t, params.Sort, 1) {
+					return false
+				}
+				filter := params.Filters[0]
+				assert.Equal(t, model.AttrScopeSystem, filter.Scope)
+				assert.Equal(t, model.AttrNameUpdated, filter.Attribute)
+				assert.Equal(t, "$lt", filter.Type)
+				if assert.IsType(t, time.Time{}, filter.Value) {
+					assert.WithinDuration(t,
+						time.Now().Add(-tc.olderThan),
+						filter.Value.(time.Time),
+						time.Minute)
+				}
+				assert.Equal(t, model.SortCriteria{
+					Scope:     model.AttrScopeSystem,
+					Attribute: model.AttrNameUpdated,
+					Order:     "asc",
+				}, params.Sort[0])
+				return true
+			}),
+		).Return(tc.outputDevices, tc.outputTotal, tc.inventoryErr)
+
+		apih := makeMockApiHandler(t, &inv)
+
+		runTestRequest(t, apih, tc.inReq, tc.JSONResponseParams)
+	}
+}
+
+func TestApiInventoryGetDevicesByGroup(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	testCases := map[string]struct {
+		listDevicesNum   int
+		listDevicesErr   error
+		listDevicesTotal int
+		inReq            *http.Request
+		resp             JSONResponseParams
+	}{
+		"valid pagination, no next page": {
+			listDevicesNum:   5,
+			listDevicesErr:   nil,
+			listDevicesTotal: 20,
+			inReq:            test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups/foo/devices?page=4&per_page=5", nil),
+			resp: JSONResponseParams{
+				OutputStatus:     200,
+				OutputBodyObject: mockListDeviceIDs(5),
+				OutputHeaders: map[string][]string{
+					"Link": {
+						fmt.Sprintf(utils.LinkTmpl, "devices", "page=3&per_page=5", "prev"),
+						fmt.Sprintf(utils.LinkTmpl, "devices", "page=1&per_page=5", "first"),
+					},
+					hdrTotalCount: {"20"},
+				},
+			},
+		},
+		"valid pagination, with next page": {
+			listDevicesNum:   5,
+			listDevicesErr:   nil,
+			listDevicesTotal: 21,
+			inReq:            test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups/foo/devices?page=4&per_page=5", nil),
+			resp: JSONResponseParams{
+				OutputStatus:     200,
+				OutputBodyObject: mockListDeviceIDs(5),
+				OutputHeaders: map[string][]string{
+					"Link": {
+						fmt.Sprintf(utils.LinkTmpl, "devices", "page=3&per_page=5", "prev"),
+						fmt.Sprintf(utils.LinkTmpl, "devices", "page=1&per_page=5", "first"),
+					},
+					hdrTotalCount: {"21"},
+				},
+			},
+		},
+		"invalid pagination - page format": {
+			listDevicesNum:   5,
+			listDevicesErr:   nil,
+			listDevicesTotal: 5,
+			inReq:            test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups/foo/devices?page=foo&per_page=5", nil),
+			resp: JSONResponseParams{
+				OutputStatus:     400,
+				OutputBodyObject: RestError(utils.MsgQueryParmInvalid("page")),
+				OutputHeaders:    nil,
+			},
+		},
+		"invalid pagination - per_page format": {
+			listDevicesNum:   5,
+			listDevicesErr:   nil,
+			listDevicesTotal: 5,
+			inReq:            test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups/foo/devices?page=1&per_page=foo", nil),
+			resp: JSONResponseParams{
+				OutputStatus:     400,
+				OutputBodyObject: RestError(utils.MsgQueryParmInvalid("per_page")),
+				OutputHeaders:    nil,
+			},
+		},
+		"invalid pagination - bounds": {
+			listDevicesNum:   5,
+			listDevicesErr:   nil,
+			listDevicesTotal: 5,
+			inReq:            test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups/foo/devices?page=0&per_page=5", nil),
+			resp: JSONResponseParams{
+				OutputStatus:     400,
+				OutputBodyObject: RestError(utils.MsgQueryParmLimit("page")),
+				OutputHeaders:    nil,
+			},
+		},
+		"inv.ListDevicesByGroup error - group not found": {
+			listDevicesNum:   5,
+			listDevicesErr:   store.ErrGroupNotFound,
+			listDevicesTotal: 20,
+			inReq:            test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups/foo/devices?page=4&per_page=5", nil),
+			resp: JSONResponseParams{
+				OutputStatus:     404,
+				OutputBodyObject: RestError("group not found"),
+				OutputHeaders:    nil,
+			},
+		},
+		"inv.ListDevicesByGroup error - internal": {
+			listDevicesNum:   5,
+			listDevicesErr:   errors.New("inventory error"),
+			listDevicesTotal: 20,
+			inReq:            test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/groups/foo/devices?page=4&per_page=5", nil),
+			resp: JSONResponseParams{
+				OutputStatus:     500,
+				OutputBodyObject: RestError("internal error"),
+				OutputHeaders:    nil,
+			},
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Logf("test case: %s", name)
+		inv := minventory.InventoryApp{}
+
+		ctx := contextMatcher()
+
+		inv.On("ListDevicesByGroup",
+			ctx,
+			mock.AnythingOfType("model.GroupName"),
+			mock.AnythingOfType("int"),
+			mock.AnythingOfType("int"),
+		).Return(mockListDeviceIDs(testCase.listDevicesNum), testCase.listDevicesTotal, testCase.listDevicesErr)
+
+		apih := makeMockApiHandler(t, &inv)
+
+		runTestRequest(t, apih, testCase.inReq, testCase.resp)
+	}
+}
+
+func TestApiInventoryGetDevicesByGroupWithAttributes(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	devices := []model.Device{{
+		ID: "1",
+		Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+		},
+	}}
+
+	testCases := map[string]struct {
+		query      string
+		attributes []model.SelectAttribute
+		err        error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			query: "?attribute=identity/mac&attribute=os&attribute=inventory/cpu/model",
+			attributes: []model.SelectAttribute{
+				{Scope: model.AttrScopeIdentity, Attribute: "mac"},
+				{Scope: model.AttrScopeInventory, Attribute: "os"},
+				{Scope: model.AttrScopeInventory, Attribute: "cpu/model"},
+			},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: devices,
+				OutputHeaders: map[string][]string{
+					hdrTotalCount: {"1"},
+				},
+			},
+		},
+		"error, group not found": {
+			query: "?attribute=identity/mac",
+			attributes: []model.SelectAttribute{
+				{Scope: model.AttrScopeIdentity, Attribute: "mac"},
+			},
+			err: store.ErrGroupNotFound,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusNotFound,
+				OutputBodyObject: RestError(store.ErrGroupNotFound.Error()),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			var devs []model.Device
+			if tc.err == nil {
+				devs = devices
+			}
+			inv.On("ListDevicesByGroupWithAttributes",
+				contextMatcher(),
+				model.GroupName("foo"),
+				0,
+				20,
+				tc.attributes,
+			).Return(devs, len(devs), tc.err)
+
+			apih := makeMockApiHandler(t, &inv)
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/0.1.0/groups/foo/devices"+tc.query, nil)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiGetDeviceGroup(t *testing.T) {
+	rest.ErrorFieldName = "error"
+
+	tcases := map[string]struct {
+		JSONResponseParams
+
+		inReq *http.Request
+
+		inventoryGroup model.GroupName
+		inventoryErr   error
+	}{
+
+		/*
+		   device w group
+		   device n group
+		   no device
+		   generic error
+		*/
+
+		"device with group": {
+			inReq:          test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/1/group", nil),
+			inventoryGroup: model.GroupName("dev"),
+			inventoryErr:   nil,
+
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: map[string]interface{}{"group": "dev"},
+			},
+		},
+		"device without group": {
+			inReq:          test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/1/group", nil),
+			inventoryGroup: model.GroupName(""),
+			inventoryErr:   nil,
+
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: map[string]interface{}{"group": nil},
+			},
+		},
+		"device not found": {
+			inReq:          test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/1/group", nil),
+			inventoryGroup: model.GroupName(""),
+			inventoryErr:   store.ErrDevNotFound,
+
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusNotFound,
+				OutputBodyObject: RestError(store.ErrDevNotFound.Error()),
+			},
+		},
+		"device not found, with request ID": {
+			inReq:          test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/1/group", nil),
+			inventoryGroup: model.GroupName(""),
+			inventoryErr: &store.RequestIDError{
+				RequestID: "test",
+				Err:       store.ErrDevNotFound,
+			},
+
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusNotFound,
+				OutputBodyObject: RestError(store.ErrDevNotFound.Error()),
+			},
+		},
+		"generic inventory error": {
+			inReq:          test.MakeSimpleRequest("GET", "http://1.2.3.4/api/0.1.0/devices/1/group", nil),
+			inventoryGroup: model.GroupName(""),
+			inventoryErr:   errors.New("inventory: internal error"),
+
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range tcases {
+		t.Logf("test case: %s", name)
+		inv := minventory.InventoryApp{}
+
+		ctx := contextMatcher()
+
+		inv.On("GetDeviceGroup",
+			ctx,
+			mock.AnythingOfType("model.DeviceID")).Return(tc.inventoryGroup, tc.inventoryErr)
+
+		apih := makeMockApiHandler(t, &inv)
+
+		runTestRequest(t, apih, tc.inReq, tc.JSONResponseParams)
+	}
+}
+
+func TestApiGetDeviceGroupInternal(t *testing.T) {
+	rest.ErrorFieldName = "error"
+
+	tcases := map[string]struct {
+		JSONResponseParams
+
+		inReq *http.Request
+
+		inventoryGroup model.GroupName
+		inventoryErr   error
+	}{
+		"device with group": {
+			inReq:          test.MakeSimpleRequest("GET", "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/1/groups", nil),
+			inventoryGroup: model.GroupName("dev"),
+			inventoryErr:   nil,
+
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: model.DeviceGroups{Groups: []string{"dev"}},
+			},
+		},
+		"device without group": {
+			inReq:          test.MakeSimpleRequest("GET", "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/1/groups", nil),
+			inventoryGroup: model.GroupName(""),
+			inventoryErr:   nil,
+
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: model.DeviceGroups{},
+			},
+		},
+		"device not found": {
+			inReq:          test.MakeSimpleRequest("GET", "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/1/groups", nil),
+			inventoryGroup: model.GroupName(""),
+			inventoryErr:   store.ErrDevNotFound,
+
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusNotFound,
+				OutputBodyObject: RestError(store.ErrDevNotFound.Error()),
+			},
+		},
+		"generic inventory error": {
+			inReq:          test.MakeSimpleRequest("GET", "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/1/groups", nil),
+			inventoryGroup: model.GroupName(""),
+			inventoryErr:   errors.New("inventory: internal error"),
+
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range tcases {
+		t.Logf("test case: %s", name)
+		inv := minventory.InventoryApp{}
+
+		ctx := contextMatcher()
+
+		inv.On("GetDeviceGroup",
+			ctx,
+			mock.AnythingOfType("model.DeviceID")).Return(tc.inventoryGroup, tc.inventoryErr)
+
+		apih := makeMockApiHandler(t, &inv)
+
+		runTestRequest(t, apih, tc.inReq, tc.JSONResponseParams)
+	}
+}
+
+func TestApiGetDeviceGroupInternalExpanded(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const url = "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/1/groups"
+
+	identityAttrs := model.DeviceAttributes{
+		{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+		{Name: "sn", Value: "1234", Scope: model.AttrScopeIdentity},
+	}
+	device := &model.Device{
+		ID:    "1",
+		Group: "dev",
+		Attributes: append(model.DeviceAttributes{
+			{Name: "os", Value: "linux", Scope: model.AttrScopeInventory},
+		}, identityAttrs...),
+	}
+
+	testCases := map[string]struct {
+		url    string
+		device *model.Device
+		err    error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			url:    url + "?expand=true",
+			device: device,
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+				OutputBodyObject: InventoryApiDeviceGroupsExpanded{
+					DeviceGroups: model.DeviceGroups{Groups: []string{"dev"}},
+					Identity:     identityAttrs,
+				},
+			},
+		},
+		"ok, no group nor identity": {
+			url:    url + "?expand=true",
+			device: &model.Device{ID: "1"},
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+				OutputBodyObject: InventoryApiDeviceGroupsExpanded{
+					Identity: model.DeviceAttributes{},
+				},
+			},
+		},
+		"ok, not expanded": {
+			url: url + "?expand=false",
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: model.DeviceGroups{Groups: []string{"dev"}},
+			},
+		},
+		"error, invalid expand": {
+			url: url + "?expand=foo",
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError(utils.MsgQueryParmInvalid(queryParamExpand)),
+			},
+		},
+		"error, device not found": {
+			url: url + "?expand=true",
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusNotFound,
+				OutputBodyObject: RestError(store.ErrDevNotFound.Error()),
+			},
+		},
+		"error, internal": {
+			url: url + "?expand=true",
+			err: errors.New("internal error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			switch tc.url {
+			case url + "?expand=true":
+				inv.On("GetDevice", contextMatcher(), model.DeviceID("1")).
+					Return(tc.device, tc.err)
+			case url + "?expand=false":
+				inv.On("GetDeviceGroup", contextMatcher(), model.DeviceID("1")).
+					Return(model.GroupName("dev"), nil)
+			}
+
+			apih := makeMockApiHandler(t, &inv)
+
+			req := test.MakeSimpleRequest("GET", tc.url, nil)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiDeleteDeviceInventory(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	tcases := map[string]struct {
+		JSONResponseParams
+
+		inReq        *http.Request
+		inDevId      model.DeviceID
+		inventoryErr error
+	}{
+		"no device": {
+			inDevId:      model.DeviceID("1"),
+			inReq:        test.MakeSimpleRequest("DELETE", "http://1.2.3.4/api/0.1.0/devices/1", nil),
+			inventoryErr: store.ErrDevNotFound,
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus: http.StatusNoContent,
+			},
+		},
+		"some device": {
+			inDevId: model.DeviceID("2"),
+			inReq:   test.MakeSimpleRequest("DELETE", "http://1.2.3.4/api/0.1.0/devices/2", nil),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus: http.StatusNoContent,
+			},
+		},
+		"error": {
+			inDevId: model.DeviceID("3"),
+			inReq:   test.MakeSimpleRequest("DELETE", "http://1.2.3.4/api/0.1.0/devices/3", nil),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+			inventoryErr: errors.New("inventory internal error"),
+		},
+	}
+
+	for name, tc := range tcases {
+		t.Run(fmt.Sprintf("test case: %s", name), func(t *testing.T) {
+
+			inv := minventory.InventoryApp{}
+
+			ctx := contextMatcher()
+
+			inv.On("ReplaceAttributes",
+				ctx,
+				tc.inDevId,
+				model.DeviceAttributes{},
+				model.AttrScopeInventory,
+				"").Return(tc.inventoryErr)
+
+			apih := makeMockApiHandler(t, &inv)
+
+			runTestRequest(t, apih, tc.inReq, tc.JSONResponseParams)
+		})
+	}
+}
+
+func TestApiDeleteDevice(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	tcases := map[string]struct {
+		JSONResponseParams
+
+		inReq        *http.Request
+		inDevId      model.DeviceID
+		inventoryErr error
+	}{
+		"no device": {
+			inDevId:      model.DeviceID("1"),
+			inReq:        test.MakeSimpleRequest("DELETE", "http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices/1", nil),
+			inventoryErr: store.ErrDevNotFound,
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus: http.StatusNoContent,
+			},
+		},
+		"some device": {
+			inDevId: model.DeviceID("2"),
+			inReq:   test.MakeSimpleRequest("DELETE", "http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices/2", nil),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus: http.StatusNoContent,
+			},
+		},
+		"error": {
+			inDevId: model.DeviceID("3"),
+			inReq:   test.MakeSimpleRequest("DELETE", "http://1.2.3.4/api/internal/v1/inventory/tenants/1/devices/3", nil),
+			JSONResponseParams: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+			inventoryErr: errors.New("inventory internal error"),
+		},
+	}
+
+	for name, tc := range tcases {
+		t.Run(fmt.Sprintf("test case: %s", name), func(t *testing.T) {
+
+			inv := minventory.InventoryApp{}
+
+			ctx := contextMatcher()
+
+			inv.On("DeleteDevice",
+				ctx,
+				tc.inDevId).Return(tc.inventoryErr)
+
+			apih := makeMockApiHandler(t, &inv)
+
+			runTestRequest(t, apih, tc.inReq, tc.JSONResponseParams)
+		})
+	}
+}
+
+func TestAPICDeleteGroup(t *testing.T) {
+	testCases := []struct {
+		Name string
+
+		model.GroupName
+		*http.Request
+		JSONResponseParams
+		InventoryErr error
+	}{{
+		Name: "ok",
+		Request: test.MakeSimpleRequest(
+			"DELETE",
+			"http://localhost/api/0.1.0/groups/foo",
+			nil,
+		),
+		GroupName: "foo",
+		JSONResponseParams: JSONResponseParams{
+			OutputStatus: http.StatusOK,
+			OutputBodyObject: &model.UpdateResult{
+				UpdatedCount: 2,
+			},
+		},
+	}, {
+		Name: "internal error",
+
+		Request: test.MakeSimpleRequest(
+			"DELETE",
+			"http://localhost/api/0.1.0/groups/foo",
+			nil,
+		),
+		GroupName: "foo",
+		JSONResponseParams: JSONResponseParams{
+			OutputStatus: http.StatusInternalServerError,
+			OutputBodyObject: map[string]interface{}{
+				"error":      "internal error",
+				"request_id": "test",
+			},
+		},
+		InventoryErr: errors.New("unknown error"),
+	}, {
+		Name: "error, invalid group name",
+
+		Request: test.MakeSimpleRequest(
+			"DELETE",
+			"http://localhost/api/0.1.0/groups/illegal$group$name",
+			nil,
+		),
+		JSONResponseParams: JSONResponseParams{
+			OutputStatus: http.StatusBadRequest,
+			OutputBodyObject: map[string]interface{}{
+				"error": "Group name can only contain: upper/lowercase " +
+					"alphanum, -(dash), _(underscore)",
+				"request_id": "test",
+			},
+		},
+	}}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			ctx := contextMatcher()
+			apih := makeMockApiHandler(t, &inv)
+
+			var ret *model.UpdateResult
+			if rsp, ok := testCase.JSONResponseParams.
+				OutputBodyObject.(*model.
+				UpdateResult); ok {
+				ret = rsp
+			}
+			inv.On("DeleteGroup",
+				ctx,
+				testCase.GroupName,
+			).Return(
+				ret,
+				testCase.InventoryErr,
+			)
+			runTestRequest(t, apih,
+				testCase.Request,
+				testCase.JSONResponseParams,
+			)
+		})
+	}
+}
+
+func TestAPIClearDevicesGroup(t *testing.T) {
+	testCases := []struct {
+		Name string
+
+		Devices []model.DeviceID
+		model.GroupName
+		*http.Request
+		JSONResponseParams
+		InventoryErr error
+		DryRun       bool
+	}{{
+		Name: "ok, some devices",
+
+		Request: test.MakeSimpleRequest(
+			"DELETE",
+			"http://localhost/api/0.1.0/groups/foo/devices",
+			[]model.DeviceID{"1", "2", "3"},
+		),
+		GroupName: "foo",
+		Devices:   []model.DeviceID{"1", "2", "3"},
+		JSONResponseParams: JSONResponseParams{
+			OutputStatus: http.StatusOK,
+			OutputBodyObject: &model.UpdateResult{
+				UpdatedCount: 3,
+			},
+		},
+	}, {
+		Name: "error, empty device list",
+
+		Request: test.MakeSimpleRequest(
+			"DELETE",
+			"http://localhost/api/0.1.0/groups/foo/devices",
+			[]model.DeviceID{},
+		),
+		Devices:   []model.DeviceID{},
+		GroupName: "foo",
+		JSONResponseParams: JSONResponseParams{
+			OutputStatus: http.StatusBadRequest,
+			OutputBodyObject: map[string]interface{}{
+				"error":      "no device IDs present in payload",
+				"request_id": "test",
+			},
+		},
+	}, {
+		Name: "error, empty device ID",
+
+		Request: test.MakeSimpleRequest(
+			"DELETE",
+			"http://localhost/api/0.1.0/groups/foo/devices",
+			[]model.DeviceID{"1", "2", ""},
+		),
+		GroupName: "foo",
+		JSONResponseParams: JSONResponseParams{
+			OutputStatus: http.StatusBadRequest,
+			OutputBodyObject: map[string]interface{}{
+				"error":      "device ID at position 2 is empty",
+				"request_id": "test",
+			},
+		},
+	}, {
+		Name: "error, invalid schema",
+
+		Request: test.MakeSimpleRequest(
+			"DELETE",
+			"http://localhost/api/0.1.0/groups/foo/devices",
+			map[string]string{"foo": "bar"},
+		),
+		GroupName: "foo",
+		JSONResponseParams: JSONResponseParams{
+			OutputStatus: http.StatusBadRequest,
+			OutputBodyObject: map[string]interface{}{
+				"error": "invalid payload schema: json: " +
+					"cannot unmarshal object into Go " +
+					"value of type []model.DeviceID",
+				"request_id": "test",
+			},
+		},
+	}, {
+		Name: "internal error",
+
+		Request: test.MakeSimpleRequest(
+			"DELETE",
+			"http://localhost/api/0.1.0/groups/foo/devices",
+			[]model.DeviceID{"1", "2", "3"},
+		),
+		GroupName: "foo",
+		Devices:   []model.DeviceID{"1", "2", "3"},
+		JSONResponseParams: JSONResponseParams{
+			OutputStatus: http.StatusInternalServerError,
+			OutputBodyObject: map[string]interface{}{
+				"error":      "internal error",
+				"request_id": "test",
+			},
+		},
+		InventoryErr: errors.New("unknown error"),
+	}, {
+		Name: "ok, dry run",
+
+		Request: test.MakeSimpleRequest(
+			"DELETE",
+			"http://localhost/api/0.1.0/groups/foo/devices?dry_run=true",
+			[]model.DeviceID{"1", "2", "3"},
+		),
+		GroupName: "foo",
+		Devices:   []model.DeviceID{"1", "2", "3"},
+		DryRun:    true,
+		JSONResponseParams: JSONResponseParams{
+			OutputStatus: http.StatusOK,
+			OutputBodyObject: &model.UpdateResult{
+				MatchedCount: 2,
+			},
+		},
+	}, {
+		Name: "error, invalid dry run",
+
+		Request: test.MakeSimpleRequest(
+			"DELETE",
+			"http://localhost/api/0.1.0/groups/foo/devices?dry_run=maybe",
+			[]model.DeviceID{"1", "2", "3"},
 		),
 		GroupName: "foo",
+		JSONResponseParams: JSONResponseParams{
+			OutputStatus: http.StatusBadRequest,
+			OutputBodyObject: map[string]interface{}{
+				"error":      utils.MsgQueryParmInvalid("dry_run"),
+				"request_id": "test",
+			},
+		},
+	}, {
+		Name: "error, invalid group name",
+
+		Request: test.MakeSimpleRequest(
+			"DELETE",
+			"http://localhost/api/0.1.0/groups/illegal$group$name/devices",
+			[]model.DeviceID{"1", "2", "3"},
+		),
+		JSONResponseParams: JSONResponseParams{
+			OutputStatus: http.StatusBadRequest,
+			OutputBodyObject: map[string]interface{}{
+				"error": "Group name can only contain: upper/lowercase " +
+					"alphanum, -(dash), _(underscore)",
+				"request_id": "test",
+			},
+		},
+	}}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			ctx := contextMatcher()
+			apih := makeMockApiHandler(t, &inv)
+
+			var ret *model.UpdateResult
+			if rsp, ok := testCase.JSONResponseParams.
+				OutputBodyObject.(*model.
+				UpdateResult); ok {
+				ret = rsp
+			}
+			method := "UnsetDevicesGroup"
+			if testCase.DryRun {
+				method = "UnsetDevicesGroupDryRun"
+			}
+			inv.On(method,
+				ctx,
+				testCase.Devices,
+				testCase.GroupName,
+			).Return(
+				ret,
+				testCase.InventoryErr,
+			)
+			runTestRequest(t, apih,
+				testCase.Request,
+				testCase.JSONResponseParams,
+			)
+		})
+	}
+}
+
+func TestAPIPatchGroupDevices(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		Name string
+
+		Devices []model.DeviceID
+		model.GroupName
+		InventoryErr error
+
+		*http.Request
+		JSONResponseParams
+	}{{
+		Name: "ok, all device IDs match",
+
+		Request: test.MakeSimpleRequest(
+			"PATCH",
+			"http://localhost/api/0.1.0/groups/foo/devices",
+			[]model.DeviceID{"1", "2", "3"},
+		),
 		Devices:   []model.DeviceID{"1", "2", "3"},
+		GroupName: "foo",
+		JSONResponseParams: JSONResponseParams{
+			OutputStatus: http.StatusOK,
+			OutputBodyObject: &model.UpdateResult{
+				MatchedCount: 3,
+				UpdatedCount: 3,
+			},
+		},
+	}, {
+		Name: "error, invalid JSON schema",
+
+		Request: test.MakeSimpleRequest(
+			"PATCH",
+			"http://localhost/api/0.1.0/groups/foo/devices",
+			map[string][]string{"devices": {"foo", "bar", "baz"}},
+		),
+		JSONResponseParams: JSONResponseParams{
+			OutputStatus: http.StatusBadRequest,
+			OutputBodyObject: map[string]interface{}{
+				"error": "invalid payload schema: json: " +
+					"cannot unmarshal object into Go " +
+					"value of type []model.DeviceID",
+				"request_id": "test",
+			},
+		},
+	}, {
+		Name: "error, empty devices list",
+
+		Request: test.MakeSimpleRequest(
+			"PATCH",
+			"http://localhost/api/0.1.0/groups/foo/devices",
+			[]model.DeviceID{}),
+		JSONResponseParams: JSONResponseParams{
+			OutputStatus: http.StatusBadRequest,
+			OutputBodyObject: map[string]interface{}{
+				"error":      "no device IDs present in payload",
+				"request_id": "test",
+			},
+		},
+	}, {
+		Name: "error, empty device ID",
+
+		Request: test.MakeSimpleRequest(
+			"PATCH",
+			"http://localhost/api/0.1.0/groups/foo/devices",
+			[]model.DeviceID{"1", "", "3"}),
+		JSONResponseParams: JSONResponseParams{
+			OutputStatus: http.StatusBadRequest,
+			OutputBodyObject: map[string]interface{}{
+				"error":      "device ID at position 1 is empty",
+				"request_id": "test",
+			},
+		},
+	}, {
+		Name: "error, invalid group name",
+
+		Request: test.MakeSimpleRequest(
+			"PATCH",
+			"http://localhost/api/0.1.0/groups/deeeåååhh/devices",
+			[]model.DeviceID{"1", "2"},
+		),
+		JSONResponseParams: JSONResponseParams{
+			OutputStatus: http.StatusBadRequest,
+			OutputBodyObject: map[string]interface{}{
+				"error": "Group name can only contain: " +
+					"upper/lowercase alphanum, " +
+					"-(dash), _(underscore)",
+				"request_id": "test",
+			},
+		},
+	}, {
+		Name: "error, internal error",
+
+		Request: test.MakeSimpleRequest(
+			"PATCH",
+			"http://localhost/api/0.1.0/groups/foo/devices",
+			[]model.DeviceID{"1", "2"},
+		),
+		Devices:      []model.DeviceID{"1", "2"},
+		GroupName:    "foo",
+		InventoryErr: errors.New("unknown error"),
 		JSONResponseParams: JSONResponseParams{
 			OutputStatus: http.StatusInternalServerError,
 			OutputBodyObject: map[string]interface{}{
@@ -2462,415 +4900,4194 @@ func TestAPIClearDevicesGroup(t *testing.T) {
 				"request_id": "test",
 			},
 		},
-		InventoryErr: errors.New("unknown error"),
-	}, {
-		Name: "error, invalid group name",
+	}}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			ctx := contextMatcher()
+			apih := makeMockApiHandler(t, &inv)
+
+			var ret *model.UpdateResult
+			if rsp, ok := testCase.JSONResponseParams.
+				OutputBodyObject.(*model.
+				UpdateResult); ok {
+				ret = rsp
+			}
+			inv.On("UpdateDevicesGroup",
+				ctx,
+				testCase.Devices,
+				testCase.GroupName,
+			).Return(
+				ret,
+				testCase.InventoryErr,
+			)
+			runTestRequest(t, apih,
+				testCase.Request,
+				testCase.JSONResponseParams,
+			)
+		})
+	}
+}
+
+func TestUserAdmApiCreateTenant(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		uaError error
+		body    interface{}
+		tenant  model.NewTenant
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaError: nil,
+			body: map[string]interface{}{
+				"tenant_id": "foobar",
+			},
+			tenant: model.NewTenant{ID: "foobar"},
+
+			checker: mt.NewJSONResponse(
+				http.StatusCreated,
+				nil,
+				nil,
+			),
+		},
+		"error: useradm internal": {
+			body: map[string]interface{}{
+				"tenant_id": "failing-tenant",
+			},
+			uaError: errors.New("some internal error"),
+			tenant:  model.NewTenant{ID: "failing-tenant"},
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error"),
+			),
+		},
+		"error: no tenant id": {
+			body: map[string]interface{}{
+				"tenant_id": "",
+			},
+			tenant: model.NewTenant{},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("tenant_id: cannot be blank."),
+			),
+		},
+		"error: empty json": {
+			tenant: model.NewTenant{},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("JSON payload is empty"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := contextMatcher()
+
+			//make mock inventory
+			inv := &minventory.InventoryApp{}
+			inv.On("CreateTenant", ctx, tc.tenant).Return(tc.uaError)
+
+			//make handler
+			api := makeMockApiHandler(t, inv)
+
+			//make request
+			req := makeReq(http.MethodPost,
+				"http://1.2.3.4/api/internal/v1/inventory/tenants",
+				"",
+				tc.body)
+
+			//test
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestApiInventoryInternalDevicesStatus(t *testing.T) {
+	t.Parallel()
+
+	rest.ErrorFieldName = "error"
+
+	tenantId := "5abcb6de7a673a0001287c71"
+	emptyTenant := ""
+	acceptedStatus := "accepted"
+
+	testCases := map[string]struct {
+		// Let intputDevices be interface{} type in order to allow
+		// passing illegal request body values.
+		//inputDevices []model.DeviceUpdate
+		inputDevices interface{}
+		tenantID     string
+		status       string
+		*model.UpdateResult
+
+		callsInventory bool
+		inventoryErr   error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			inputDevices: []model.DeviceUpdate{
+				{Id: model.DeviceID(oid.NewUUIDv5("1").String()), Revision: 1},
+				{Id: model.DeviceID(oid.NewUUIDv5("2").String()), Revision: 1},
+				{Id: model.DeviceID(oid.NewUUIDv5("3").String()), Revision: 1},
+			},
+			tenantID: tenantId,
+			status:   acceptedStatus,
+			UpdateResult: &model.UpdateResult{
+				MatchedCount: 3,
+				UpdatedCount: 2,
+			},
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+				OutputBodyObject: &model.UpdateResult{
+					MatchedCount: 3,
+					UpdatedCount: 2,
+				},
+			},
+			callsInventory: true,
+		},
+		"ok, noauth": {
+			inputDevices: []model.DeviceUpdate{
+				{Id: model.DeviceID(oid.NewUUIDv5("1").String()), Revision: 1},
+				{Id: model.DeviceID(oid.NewUUIDv5("2").String()), Revision: 1},
+				{Id: model.DeviceID(oid.NewUUIDv5("3").String()), Revision: 1},
+			},
+			tenantID: tenantId,
+			status:   "noauth",
+			UpdateResult: &model.UpdateResult{
+				MatchedCount: 3,
+				UpdatedCount: 2,
+			},
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+				OutputBodyObject: &model.UpdateResult{
+					MatchedCount: 3,
+					UpdatedCount: 2,
+				},
+			},
+			callsInventory: true,
+		},
+
+		"ok single tenant": {
+			inputDevices: []model.DeviceUpdate{
+				{Id: model.DeviceID(oid.NewUUIDv5("1").String()), Revision: 1},
+				{Id: model.DeviceID(oid.NewUUIDv5("2").String()), Revision: 1},
+			},
+			tenantID: emptyTenant,
+			status:   acceptedStatus,
+			UpdateResult: &model.UpdateResult{
+				MatchedCount: 2,
+				UpdatedCount: 2,
+			},
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+				OutputBodyObject: &model.UpdateResult{
+					MatchedCount: 2,
+					UpdatedCount: 2,
+				},
+			},
+			callsInventory: true,
+		},
+		"error, payload empty": {
+			tenantID:     tenantId,
+			status:       acceptedStatus,
+			inputDevices: nil,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("cant parse devices: JSON payload is empty"),
+			},
+			callsInventory: false,
+		},
+
+		"error, payload not expected": {
+			inputDevices: "sneaky wool carpet",
+			tenantID:     tenantId,
+			status:       acceptedStatus,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("cant parse devices: json: cannot unmarshal string into Go value of type []model.DeviceUpdate"),
+			},
+			callsInventory: false,
+		},
+
+		"error, bad status": {
+			inputDevices: []model.DeviceUpdate{
+				{Id: model.DeviceID(oid.NewUUIDv5("1").String()), Revision: 1},
+				{Id: model.DeviceID(oid.NewUUIDv5("2").String()), Revision: 1},
+			},
+			tenantID: emptyTenant,
+			status:   "quo",
+			UpdateResult: &model.UpdateResult{
+				MatchedCount: 1,
+				UpdatedCount: 1,
+			},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusNotFound,
+				OutputBodyObject: RestError("unrecognized status: quo"),
+			},
+			callsInventory: false,
+		},
+
+		"error, db Upsert failed": {
+			inputDevices: []model.DeviceUpdate{
+				{Id: model.DeviceID(oid.NewUUIDv5("1").String()), Revision: 1},
+				{Id: model.DeviceID(oid.NewUUIDv5("2").String()), Revision: 1},
+			},
+			tenantID:     tenantId,
+			status:       acceptedStatus,
+			inventoryErr: errors.New("cant upsert"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+			callsInventory: true,
+		},
+		"error, conflict": {
+			inputDevices: []model.DeviceUpdate{
+				{Id: model.DeviceID(oid.NewUUIDv5("1").String()), Revision: 1},
+				{Id: model.DeviceID(oid.NewUUIDv5("2").String()), Revision: 1},
+			},
+			tenantID:     tenantId,
+			status:       acceptedStatus,
+			inventoryErr: store.ErrWriteConflict,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusConflict,
+				OutputBodyObject: RestError("write conflict"),
+			},
+			callsInventory: true,
+		},
+		"error, empty device ID": {
+			inputDevices: []model.DeviceUpdate{
+				{Id: model.DeviceID(oid.NewUUIDv5("1").String()), Revision: 1},
+				{Id: "", Revision: 1},
+			},
+			tenantID: tenantId,
+			status:   acceptedStatus,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("device ID at position 1 is empty"),
+			},
+		},
+		"error, empty device ID, decommissioned": {
+			inputDevices: []model.DeviceUpdate{
+				{Id: "", Revision: 1},
+			},
+			tenantID: tenantId,
+			status:   "decommissioned",
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("device ID at position 0 is empty"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var (
+				inReq = test.MakeSimpleRequest("POST",
+					"http://1.2.3.4/api/internal/v1/inventory/tenants/"+
+						tc.tenantID+"/devices/status/"+tc.status,
+					tc.inputDevices,
+				)
+				deviceAttributes = model.DeviceAttributes{{
+					Name:  "status",
+					Value: tc.status,
+					Scope: model.AttrScopeIdentity,
+				}}
+			)
+
+			inv := minventory.InventoryApp{}
+			ctx := contextMatcher()
+
+			if tc.callsInventory {
+				switch tc.status {
+				case "accepted", "preauthorized", "pending", "noauth":
+					// Update statuses
+					inv.On("UpsertDevicesStatuses",
+						ctx,
+						tc.inputDevices,
+						deviceAttributes,
+					).Return(tc.UpdateResult, tc.inventoryErr)
+
+				case "decommissioned":
+					// Delete Inventory
+					inv.On("DeleteDevices",
+						ctx,
+						getIdsFromDevices(tc.inputDevices.([]model.DeviceUpdate)),
+					).Return(tc.UpdateResult, tc.inventoryErr)
+				}
+			}
+
+			apih := makeMockApiHandler(t, &inv)
+
+			rest.ErrorFieldName = "error"
+
+			runTestRequest(t, apih, inReq, tc.resp)
+
+			inv.AssertExpectations(t)
+		})
+	}
+}
+
+func TestApiBulkDeviceIDsLimit(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const limit = 2
+	tenantID := "5abcb6de7a673a0001287c71"
+	makeIDs := func(n int) []model.DeviceID {
+		ids := make([]model.DeviceID, n)
+		for i := range ids {
+			ids[i] = model.DeviceID(oid.NewUUIDv5(strconv.Itoa(i)).String())
+		}
+		return ids
+	}
+	makeUpdates := func(n int) []model.DeviceUpdate {
+		devs := make([]model.DeviceUpdate, n)
+		for i, id := range makeIDs(n) {
+			devs[i] = model.DeviceUpdate{Id: id, Revision: 1}
+		}
+		return devs
+	}
+	result := &model.UpdateResult{MatchedCount: limit, UpdatedCount: limit}
+
+	testCases := map[string]struct {
+		method string
+		url    string
+		body   func(n int) interface{}
+		mock   func(inv *minventory.InventoryApp, n int)
+	}{
+		"UpdateDevicesGroup": {
+			method: http.MethodPatch,
+			url:    "http://localhost/api/0.1.0/groups/foo/devices",
+			body:   func(n int) interface{} { return makeIDs(n) },
+			mock: func(inv *minventory.InventoryApp, n int) {
+				inv.On("UpdateDevicesGroup",
+					contextMatcher(), makeIDs(n), model.GroupName("foo"),
+				).Return(result, nil)
+			},
+		},
+		"UnsetDevicesGroup": {
+			method: http.MethodDelete,
+			url:    "http://localhost/api/0.1.0/groups/foo/devices",
+			body:   func(n int) interface{} { return makeIDs(n) },
+			mock: func(inv *minventory.InventoryApp, n int) {
+				inv.On("UnsetDevicesGroup",
+					contextMatcher(), makeIDs(n), model.GroupName("foo"),
+				).Return(result, nil)
+			},
+		},
+		"UpsertDevicesStatuses": {
+			method: http.MethodPost,
+			url: "http://localhost/api/internal/v1/inventory/tenants/" +
+				tenantID + "/devices/status/accepted",
+			body: func(n int) interface{} { return makeUpdates(n) },
+			mock: func(inv *minventory.InventoryApp, n int) {
+				inv.On("UpsertDevicesStatuses",
+					contextMatcher(), makeUpdates(n), model.DeviceAttributes{{
+						Name:  "status",
+						Value: "accepted",
+						Scope: model.AttrScopeIdentity,
+					}},
+				).Return(result, nil)
+			},
+		},
+		"DeleteDevices": {
+			method: http.MethodPost,
+			url: "http://localhost/api/internal/v1/inventory/tenants/" +
+				tenantID + "/devices/status/decommissioned",
+			body: func(n int) interface{} { return makeUpdates(n) },
+			mock: func(inv *minventory.InventoryApp, n int) {
+				inv.On("DeleteDevices", contextMatcher(), makeIDs(n)).
+					Return(result, nil)
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name+", at the limit", func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+			tc.mock(&inv, limit)
+
+			apih := makeMockApiHandlerWithConfig(t, &inv, &Config{
+				MaxBulkDeviceIDs: limit,
+			})
+			runTestRequest(t, apih,
+				test.MakeSimpleRequest(tc.method, tc.url, tc.body(limit)),
+				JSONResponseParams{
+					OutputStatus:     http.StatusOK,
+					OutputBodyObject: result,
+				},
+			)
+		})
+		t.Run(name+", over the limit", func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			apih := makeMockApiHandlerWithConfig(t, &inv, &Config{
+				MaxBulkDeviceIDs: limit,
+			})
+			runTestRequest(t, apih,
+				test.MakeSimpleRequest(tc.method, tc.url, tc.body(limit+1)),
+				JSONResponseParams{
+					OutputStatus:     http.StatusBadRequest,
+					OutputBodyObject: RestError("too many device IDs: the limit is 2"),
+				},
+			)
+		})
+	}
+}
+
+func TestApiInventoryFiltersAttributes(t *testing.T) {
+	testCases := map[string]struct {
+		attributes []model.FilterAttribute
+		err        error
+		httpCode   int
+	}{
+		"ok": {
+			attributes: []model.FilterAttribute{
+				{
+					Name:  "name",
+					Scope: "scope",
+					Count: 100,
+				},
+				{
+					Name:  "other_name",
+					Scope: "scope",
+					Count: 90,
+				},
+			},
+			httpCode: http.StatusOK,
+		},
+		"ok, no attributes": {
+			attributes: nil,
+			httpCode:   http.StatusOK,
+		},
+		"ko": {
+			err:      errors.New("error"),
+			httpCode: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			inv.On("GetFiltersAttributes",
+				contextMatcher(),
+			).Return(tc.attributes, tc.err)
+
+			api := makeMockApiHandler(t, &inv)
+			req, _ := http.NewRequest("GET", "http://localhost"+urlFiltersAttributes, nil)
+			recorded := test.RunRequest(t, api, req)
+
+			recorded.CodeIs(tc.httpCode)
+			if tc.httpCode == http.StatusOK {
+				if tc.attributes == nil {
+					tc.attributes = []model.FilterAttribute{}
+				}
+				body, _ := json.Marshal(tc.attributes)
+				recorded.BodyIs(string(body))
+			}
+		})
+	}
+}
+
+func TestApiInventoryFiltersDescribedAttributes(t *testing.T) {
+	testCases := map[string]struct {
+		attributes []model.DescribedAttribute
+		err        error
+		httpCode   int
+	}{
+		"ok": {
+			attributes: []model.DescribedAttribute{
+				{
+					Name:        "ip_addr",
+					Scope:       "inventory",
+					Description: "IP address",
+				},
+				{
+					Name:        "mac",
+					Scope:       "identity",
+					Description: "MAC address",
+				},
+			},
+			httpCode: http.StatusOK,
+		},
+		"ok, no attributes": {
+			attributes: nil,
+			httpCode:   http.StatusOK,
+		},
+		"ko": {
+			err:      errors.New("error"),
+			httpCode: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			inv.On("GetDescribedAttributes",
+				contextMatcher(),
+			).Return(tc.attributes, tc.err)
+
+			api := makeMockApiHandler(t, &inv)
+			req, _ := http.NewRequest("GET", "http://localhost"+urlFiltersDescribed, nil)
+			recorded := test.RunRequest(t, api, req)
+
+			recorded.CodeIs(tc.httpCode)
+			if tc.httpCode == http.StatusOK {
+				if tc.attributes == nil {
+					tc.attributes = []model.DescribedAttribute{}
+				}
+				body, _ := json.Marshal(tc.attributes)
+				recorded.BodyIs(string(body))
+			}
+		})
+	}
+}
+
+func TestApiInventorySearchDevices(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	testCases := map[string]struct {
+		listDevicesNum  int
+		listDevicesErr  error
+		listDeviceTotal int
+		inReq           *http.Request
+		resp            JSONResponseParams
+	}{
+		"valid pagination, no next page": {
+			listDevicesNum:  5,
+			listDevicesErr:  nil,
+			listDeviceTotal: 20,
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				model.SearchParams{
+					Page:    4,
+					PerPage: 5,
+				},
+			),
+			resp: JSONResponseParams{
+				OutputStatus:     200,
+				OutputBodyObject: mockListDevices(5),
+				OutputHeaders: map[string][]string{
+					hdrTotalCount: {"20"},
+				},
+			},
+		},
+		"valid pagination, with next page": {
+			listDevicesNum:  5,
+			listDevicesErr:  nil,
+			listDeviceTotal: 21,
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				model.SearchParams{
+					Page:    4,
+					PerPage: 5,
+				},
+			),
+			resp: JSONResponseParams{
+				OutputStatus:     200,
+				OutputBodyObject: mockListDevices(5),
+				OutputHeaders: map[string][]string{
+					hdrTotalCount: {"21"},
+				},
+			},
+		},
+		"valid filter and sort": {
+			listDevicesNum:  5,
+			listDevicesErr:  nil,
+			listDeviceTotal: 21,
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				model.SearchParams{
+					Page:    4,
+					PerPage: 5,
+					Filters: []model.FilterPredicate{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Type:      "$eq",
+							Value:     "bar",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Type:      "$eq",
+							Value:     "baz",
+						},
+					},
+					Sort: []model.SortCriteria{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Order:     "asc",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Order:     "desc",
+						},
+					},
+				},
+			),
+			resp: JSONResponseParams{
+				OutputStatus:     200,
+				OutputBodyObject: mockListDevices(5),
+				OutputHeaders: map[string][]string{
+					hdrTotalCount: {"21"},
+				},
+			},
+		},
+		"invalid filter": {
+			listDevicesNum:  5,
+			listDevicesErr:  nil,
+			listDeviceTotal: 21,
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				model.SearchParams{
+					Page:    4,
+					PerPage: 5,
+					Filters: []model.FilterPredicate{
+						{},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Type:      "$eq",
+							Value:     "baz",
+						},
+					},
+					Sort: []model.SortCriteria{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Order:     "asc",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Order:     "desc",
+						},
+					},
+				},
+			),
+			resp: JSONResponseParams{
+				OutputStatus:     400,
+				OutputBodyObject: RestError("attribute: cannot be blank; scope: cannot be blank; type: cannot be blank; value: is required."),
+				OutputHeaders:    nil,
+			},
+		},
+		"invalid sort": {
+			listDevicesNum:  5,
+			listDevicesErr:  nil,
+			listDeviceTotal: 21,
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				model.SearchParams{
+					Page:    4,
+					PerPage: 5,
+					Filters: []model.FilterPredicate{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Type:      "$eq",
+							Value:     "bar",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Type:      "$eq",
+							Value:     "baz",
+						},
+					},
+					Sort: []model.SortCriteria{
+						{},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Order:     "desc",
+						},
+					},
+				},
+			),
+			resp: JSONResponseParams{
+				OutputStatus:     400,
+				OutputBodyObject: RestError("attribute: cannot be blank; order: cannot be blank; scope: cannot be blank."),
+				OutputHeaders:    nil,
+			},
+		},
+		"valid score": {
+			listDevicesNum:  5,
+			listDevicesErr:  nil,
+			listDeviceTotal: 21,
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				model.SearchParams{
+					Page:    4,
+					PerPage: 5,
+					Score: []model.ScoreTerm{
+						{
+							Scope:     "monitor",
+							Attribute: "alerts",
+							Weight:    2,
+						},
+					},
+				},
+			),
+			resp: JSONResponseParams{
+				OutputStatus:     200,
+				OutputBodyObject: mockListDevices(5),
+				OutputHeaders: map[string][]string{
+					hdrTotalCount: {"21"},
+				},
+			},
+		},
+		"invalid score": {
+			listDevicesNum:  5,
+			listDevicesErr:  nil,
+			listDeviceTotal: 21,
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				model.SearchParams{
+					Page:    4,
+					PerPage: 5,
+					Score: []model.ScoreTerm{
+						{
+							Scope:     "identity",
+							Attribute: "mac",
+							Weight:    1,
+						},
+					},
+				},
+			),
+			resp: JSONResponseParams{
+				OutputStatus:     400,
+				OutputBodyObject: RestError("score: scope: must be a valid value."),
+				OutputHeaders:    nil,
+			},
+		},
+		"inventory error": {
+			listDevicesNum:  5,
+			listDevicesErr:  errors.New("inventory error"),
+			listDeviceTotal: 21,
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				model.SearchParams{
+					Page:    4,
+					PerPage: 5,
+					Filters: []model.FilterPredicate{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Type:      "$eq",
+							Value:     "bar",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Type:      "$eq",
+							Value:     "baz",
+						},
+					},
+					Sort: []model.SortCriteria{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Order:     "asc",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Order:     "desc",
+						},
+					},
+				},
+			),
+			resp: JSONResponseParams{
+				OutputStatus:     500,
+				OutputBodyObject: RestError("internal error"),
+				OutputHeaders:    nil,
+			},
+		},
+		"inventory error, BadValue": {
+			listDevicesNum:  5,
+			listDevicesErr:  errors.New("inventory error: BadValue"),
+			listDeviceTotal: 21,
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				model.SearchParams{
+					Page:    4,
+					PerPage: 5,
+					Filters: []model.FilterPredicate{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Type:      "$eq",
+							Value:     "bar",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Type:      "$eq",
+							Value:     "baz",
+						},
+					},
+					Sort: []model.SortCriteria{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Order:     "asc",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Order:     "desc",
+						},
+					},
+				},
+			),
+			resp: JSONResponseParams{
+				OutputStatus:     400,
+				OutputBodyObject: RestError("inventory error: BadValue"),
+				OutputHeaders:    nil,
+			},
+		},
+		"regex filter on a non-string attribute": {
+			listDevicesNum: 5,
+			listDevicesErr: errors.Wrap(store.ErrRegexNonString,
+				"failed to fetch devices: attribute inventory/foo"),
+			listDeviceTotal: 21,
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				model.SearchParams{
+					Page:    1,
+					PerPage: 5,
+					Filters: []model.FilterPredicate{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Type:      model.FilterTypeRegex,
+							Value:     "^ba",
+							Options:   "i",
+						},
+					},
+				},
+			),
+			resp: JSONResponseParams{
+				OutputStatus: 400,
+				OutputBodyObject: RestError("failed to fetch devices: " +
+					"attribute inventory/foo: " + store.ErrRegexNonString.Error()),
+				OutputHeaders: nil,
+			},
+		},
+		"invalid regex filter": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				model.SearchParams{
+					Page:    1,
+					PerPage: 5,
+					Filters: []model.FilterPredicate{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Type:      model.FilterTypeRegex,
+							Value:     "ba(",
+						},
+					},
+				},
+			),
+			resp: JSONResponseParams{
+				OutputStatus: 400,
+				OutputBodyObject: RestError("value: invalid regex: " +
+					"error parsing regexp: missing closing ): `ba(`."),
+				OutputHeaders: nil,
+			},
+		},
+		"valid": {
+			listDevicesNum:  5,
+			listDevicesErr:  nil,
+			listDeviceTotal: 21,
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				model.SearchParams{
+					Page:    4,
+					PerPage: 5,
+					Filters: []model.FilterPredicate{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Type:      "$eq",
+							Value:     "bar",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Type:      "$eq",
+							Value:     "baz",
+						},
+					},
+					Sort: []model.SortCriteria{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Order:     "asc",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Order:     "desc",
+						},
+					},
+				},
+			),
+			resp: JSONResponseParams{
+				OutputStatus:     200,
+				OutputBodyObject: mockListDevices(5),
+				OutputHeaders: map[string][]string{
+					hdrTotalCount: {"21"},
+				},
+			},
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Logf("test case: %s", name)
+		inv := minventory.InventoryApp{}
+
+		ctx := contextMatcher()
+
+		inv.On("SearchDevices",
+			ctx,
+			mock.AnythingOfType("model.SearchParams"),
+		).Return(mockListDevices(testCase.listDevicesNum), testCase.listDeviceTotal, testCase.listDevicesErr)
+
+		apih := makeMockApiHandler(t, &inv)
+
+		runTestRequest(t, apih, testCase.inReq, testCase.resp)
+	}
+}
+
+func TestApiInventorySearchDevicesScopeAliases(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	config := &Config{
+		ScopeAliases: map[string]string{"inv": model.AttrScopeInventory},
+	}
+	inReq := test.MakeSimpleRequest("POST",
+		"http://1.2.3.4/api/management/v2/inventory/filters/search",
+		model.SearchParams{
+			Filters: []model.FilterPredicate{{
+				Scope:     "inv",
+				Attribute: "foo",
+				Type:      "$eq",
+				Value:     "bar",
+			}, {
+				Scope:     model.AttrScopeIdentity,
+				Attribute: "mac",
+				Type:      "$eq",
+				Value:     "00:00:00:01",
+			}},
+			Sort: []model.SortCriteria{{
+				Scope:     "inv",
+				Attribute: "foo",
+				Order:     "asc",
+			}},
+			Attributes: []model.SelectAttribute{{
+				Scope:     "inv",
+				Attribute: "foo",
+			}},
+		},
+	)
+	expected := model.SearchParams{
+		Page:    utils.PageDefault,
+		PerPage: utils.PerPageDefault,
+		Filters: []model.FilterPredicate{{
+			Scope:     model.AttrScopeInventory,
+			Attribute: "foo",
+			Type:      "$eq",
+			Value:     "bar",
+		}, {
+			Scope:     model.AttrScopeIdentity,
+			Attribute: "mac",
+			Type:      "$eq",
+			Value:     "00:00:00:01",
+		}},
+		Sort: []model.SortCriteria{{
+			Scope:     model.AttrScopeInventory,
+			Attribute: "foo",
+			Order:     "asc",
+		}},
+		Attributes: []model.SelectAttribute{{
+			Scope:     model.AttrScopeInventory,
+			Attribute: "foo",
+		}},
+	}
+
+	inv := minventory.InventoryApp{}
+	inv.On("SearchDevices", contextMatcher(), expected).
+		Return(mockListDevices(1), 1, nil)
+	defer inv.AssertExpectations(t)
+
+	apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+	runTestRequest(t, apih, inReq, JSONResponseParams{
+		OutputStatus:     http.StatusOK,
+		OutputBodyObject: mockListDevices(1),
+		OutputHeaders: map[string][]string{
+			hdrTotalCount: {"1"},
+		},
+	})
+}
+
+func TestApiInventorySearchDevicesRequireFilters(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	filters := []model.FilterPredicate{{
+		Scope:     model.AttrScopeInventory,
+		Attribute: "foo",
+		Type:      "$eq",
+		Value:     "bar",
+	}}
+
+	testCases := map[string]struct {
+		requireFilters bool
+		filters        []model.FilterPredicate
+
+		search bool
+		resp   JSONResponseParams
+	}{
+		"ok, empty filters, permissive": {
+			filters: []model.FilterPredicate{},
+			search:  true,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: mockListDevices(1),
+			},
+		},
+		"ok, filters, strict": {
+			requireFilters: true,
+			filters:        filters,
+			search:         true,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: mockListDevices(1),
+			},
+		},
+		"error, empty filters, strict": {
+			requireFilters: true,
+			filters:        []model.FilterPredicate{},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("at least one filter is required"),
+			},
+		},
+		"error, no filters, strict": {
+			requireFilters: true,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("at least one filter is required"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+			if tc.search {
+				inv.On("SearchDevices", contextMatcher(),
+					mock.AnythingOfType("model.SearchParams"),
+				).Return(mockListDevices(1), 1, nil)
+			}
+
+			config := NewConfig()
+			config.SearchRequireFilters = tc.requireFilters
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+			inReq := test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				model.SearchParams{Filters: tc.filters},
+			)
+			runTestRequest(t, apih, inReq, tc.resp)
+		})
+	}
+}
+
+func TestApiInventorySearchDevicesRequireTenant(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	testCases := map[string]struct {
+		requireTenant bool
+		claims        string
+		count         bool
+
+		search bool
+		resp   JSONResponseParams
+	}{
+		"ok, no identity, permissive": {
+			search: true,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: mockListDevices(1),
+			},
+		},
+		"ok, tenant, strict": {
+			requireTenant: true,
+			claims:        `{"sub":"user","mender.tenant":"foo"}`,
+			search:        true,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: mockListDevices(1),
+			},
+		},
+		"error, no tenant, strict": {
+			requireTenant: true,
+			claims:        `{"sub":"user"}`,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusUnauthorized,
+				OutputBodyObject: RestError("tenant required"),
+			},
+		},
+		"error, no identity, strict": {
+			requireTenant: true,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusUnauthorized,
+				OutputBodyObject: RestError("tenant required"),
+			},
+		},
+		"ok, count, tenant, strict": {
+			requireTenant: true,
+			claims:        `{"sub":"user","mender.tenant":"foo"}`,
+			count:         true,
+			search:        true,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: InventoryApiDevicesCount{Count: 1},
+			},
+		},
+		"error, count, no tenant, strict": {
+			requireTenant: true,
+			claims:        `{"sub":"user"}`,
+			count:         true,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusUnauthorized,
+				OutputBodyObject: RestError("tenant required"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+			if tc.search {
+				ctx := mock.MatchedBy(func(ctx context.Context) bool {
+					id := identity.FromContext(ctx)
+					if tc.claims == "" {
+						return id == nil
+					}
+					return id != nil && id.Tenant == "foo"
+				})
+				if tc.count {
+					inv.On("CountDevices", ctx,
+						mock.AnythingOfType("model.SearchParams"),
+					).Return(1, nil)
+				} else {
+					inv.On("SearchDevices", ctx,
+						mock.AnythingOfType("model.SearchParams"),
+					).Return(mockListDevices(1), 1, nil)
+				}
+			}
+
+			config := NewConfig()
+			config.SearchRequireTenant = tc.requireTenant
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+			url := "http://1.2.3.4/api/management/v2/inventory/filters/search"
+			if tc.count {
+				url = "http://1.2.3.4/api/management/v2/inventory/filters/count"
+			}
+			inReq := test.MakeSimpleRequest("POST", url, model.SearchParams{})
+			if tc.claims != "" {
+				inReq.Header.Set("Authorization", makeDeviceAuthHeader(tc.claims))
+			}
+			runTestRequest(t, apih, inReq, tc.resp)
+		})
+	}
+}
+
+func TestApiInventorySearchDevicesIndexedFiltersOnly(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	filter := func(scope, name string) model.FilterPredicate {
+		return model.FilterPredicate{
+			Scope:     scope,
+			Attribute: name,
+			Type:      "$eq",
+			Value:     "bar",
+		}
+	}
+
+	testCases := map[string]struct {
+		indexedOnly bool
+		filters     []model.FilterPredicate
+
+		search bool
+		resp   JSONResponseParams
+	}{
+		"ok, non-indexed attribute, lenient": {
+			filters: []model.FilterPredicate{filter(model.AttrScopeInventory, "foo")},
+			search:  true,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: mockListDevices(1),
+			},
+		},
+		"ok, indexed attributes, strict": {
+			indexedOnly: true,
+			filters: []model.FilterPredicate{
+				filter(model.AttrScopeInventory, "device_type"),
+				filter(model.AttrScopeIdentity, model.AttrNameID),
+			},
+			search: true,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: mockListDevices(1),
+			},
+		},
+		"ok, scope alias, strict": {
+			indexedOnly: true,
+			filters:     []model.FilterPredicate{filter("inv", "device_type")},
+			search:      true,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: mockListDevices(1),
+			},
+		},
+		"error, non-indexed attribute, strict": {
+			indexedOnly: true,
+			filters: []model.FilterPredicate{
+				filter(model.AttrScopeInventory, "device_type"),
+				filter(model.AttrScopeInventory, "foo"),
+			},
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError("attribute inventory/foo is not indexed; " +
+					"filter on an indexed attribute: identity/id, inventory/device_type"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+			if tc.search {
+				inv.On("SearchDevices", contextMatcher(),
+					mock.AnythingOfType("model.SearchParams"),
+				).Return(mockListDevices(1), 1, nil)
+			}
+
+			config := NewConfig()
+			config.ScopeAliases = map[string]string{"inv": model.AttrScopeInventory}
+			config.SearchIndexedFiltersOnly = tc.indexedOnly
+			config.IndexedAttributes = []string{"inventory/device_type"}
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+			inReq := test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				model.SearchParams{Filters: tc.filters},
+			)
+			runTestRequest(t, apih, inReq, tc.resp)
+		})
+	}
+}
+
+func TestApiInventorySearchDevicesResultETag(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	later := now.Add(time.Minute)
+	page := []model.Device{
+		{ID: "1", UpdatedTs: &now},
+		{ID: "2", UpdatedTs: &now},
+	}
+	updated := []model.Device{
+		{ID: "1", UpdatedTs: &now},
+		{ID: "2", UpdatedTs: &later},
+	}
+	reordered := []model.Device{
+		{ID: "2", UpdatedTs: &now},
+		{ID: "1", UpdatedTs: &now},
+	}
+
+	inv := minventory.InventoryApp{}
+	defer inv.AssertExpectations(t)
+	inv.On("SearchDevices", mock.Anything, mock.Anything).
+		Return(page, 2, nil).Twice()
+	inv.On("SearchDevices", mock.Anything, mock.Anything).
+		Return(updated, 2, nil).Once()
+	inv.On("SearchDevices", mock.Anything, mock.Anything).
+		Return(reordered, 2, nil).Once()
+	inv.On("SearchDevices", mock.Anything, mock.Anything).
+		Return(page, 2, nil).Once()
+	apih := makeMockApiHandler(t, &inv)
+
+	search := func(url string) string {
+		req := test.MakeSimpleRequest("POST", url, model.SearchParams{})
+		req.Header.Add(requestid.RequestIdHeader, "test")
+		recorded := test.RunRequest(t, apih, req)
+		recorded.CodeIs(http.StatusOK)
+		etag := recorded.Recorder.Header().Get(hdrResultETag)
+		assert.NotEmpty(t, etag)
+		return etag
+	}
+	const (
+		url         = "http://1.2.3.4/api/management/v2/inventory/filters/search"
+		urlInternal = "http://1.2.3.4/api/internal/v2/inventory/tenants/foo/filters/search"
+	)
+
+	etag := search(url)
+	assert.Equal(t, etag, search(url), "identical pages")
+	assert.NotEqual(t, etag, search(url), "updated device")
+	assert.NotEqual(t, etag, search(url), "reordered devices")
+	assert.Equal(t, etag, search(urlInternal), "internal search")
+}
+
+func TestApiInventoryInternalSearchExplain(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const url = "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/filters/search/explain"
+
+	searchParams := model.SearchParams{
+		Page:    1,
+		PerPage: 20,
+		Filters: []model.FilterPredicate{{
+			Scope:     "inventory",
+			Attribute: "foo",
+			Type:      "$eq",
+			Value:     "bar",
+		}},
+	}
+	plan := map[string]interface{}{
+		"queryPlanner": map[string]interface{}{
+			"namespace": "inventory-foo.devices",
+		},
+	}
+
+	testCases := map[string]struct {
+		body    interface{}
+		enabled bool
+		explain bool
+		err     error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			body:    searchParams,
+			enabled: true,
+			explain: true,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: plan,
+			},
+		},
+		"error, disabled": {
+			body: searchParams,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusForbidden,
+				OutputBodyObject: RestError("the search explain endpoint is disabled"),
+			},
+		},
+		"error, bad search params": {
+			body: model.SearchParams{
+				Filters: []model.FilterPredicate{{
+					Scope:     "inventory",
+					Attribute: "foo",
+					Type:      "$foo",
+					Value:     "bar",
+				}},
+			},
+			enabled: true,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("type: must be a valid value."),
+			},
+		},
+		"error, internal": {
+			body:    searchParams,
+			enabled: true,
+			explain: true,
+			err:     errors.New("internal error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.explain {
+				ctx := mock.MatchedBy(func(ctx context.Context) bool {
+					id := identity.FromContext(ctx)
+					return id != nil && id.Tenant == "foo"
+				})
+				var res map[string]interface{}
+				if tc.err == nil {
+					res = plan
+				}
+				inv.On("ExplainSearchDevices", ctx, searchParams).
+					Return(res, tc.err)
+			}
+
+			config := NewConfig()
+			config.EnableSearchExplain = tc.enabled
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+			req := test.MakeSimpleRequest("POST", url, tc.body)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiParseSearchParams(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		inReq        *http.Request
+		searchParams *model.SearchParams
+		err          error
+	}{
+		"ok": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				model.SearchParams{
+					Page:    4,
+					PerPage: 5,
+					Filters: []model.FilterPredicate{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Type:      "$eq",
+							Value:     "bar",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Type:      "$eq",
+							Value:     "baz",
+						},
+					},
+					Sort: []model.SortCriteria{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Order:     "asc",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Order:     "desc",
+						},
+					},
+				},
+			),
+			searchParams: &model.SearchParams{
+				Page:    4,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "foo",
+						Type:      "$eq",
+						Value:     "bar",
+					},
+					{
+						Scope:     "inventory",
+						Attribute: "foo1",
+						Type:      "$eq",
+						Value:     "baz",
+					},
+				},
+				Sort: []model.SortCriteria{
+					{
+						Scope:     "inventory",
+						Attribute: "foo",
+						Order:     "asc",
+					},
+					{
+						Scope:     "inventory",
+						Attribute: "foo1",
+						Order:     "desc",
+					},
+				},
+			},
+		},
+		"ok: all filter types and sort orders": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				model.SearchParams{
+					Page:    4,
+					PerPage: 5,
+					Filters: []model.FilterPredicate{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Type:      "$eq",
+							Value:     "bar",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Type:      "$eq",
+							Value:     5,
+						},
+					},
+					Sort: []model.SortCriteria{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Order:     "asc",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Order:     "desc",
+						},
+					},
+				},
+			),
+			searchParams: &model.SearchParams{
+				Page:    4,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "foo",
+						Type:      "$eq",
+						Value:     "bar",
+					},
+					{
+						Scope:     "inventory",
+						Attribute: "foo1",
+						Type:      "$eq",
+						Value:     float64(5),
+					},
+				},
+				Sort: []model.SortCriteria{
+					{
+						Scope:     "inventory",
+						Attribute: "foo",
+						Order:     "asc",
+					},
+					{
+						Scope:     "inventory",
+						Attribute: "foo1",
+						Order:     "desc",
+					},
+				},
+			},
+		},
+		"invalid Page and perPage": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				model.SearchParams{
+					Page:    -3,
+					PerPage: 0,
+					Filters: []model.FilterPredicate{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Type:      "$eq",
+							Value:     "bar",
+						},
+					},
+					Sort: []model.SortCriteria{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Order:     "asc",
+						},
+					},
+				},
+			),
+			searchParams: &model.SearchParams{
+				Page:    utils.PageDefault,
+				PerPage: utils.PerPageDefault,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "foo",
+						Type:      "$eq",
+						Value:     "bar",
+					},
+				},
+				Sort: []model.SortCriteria{
+					{
+						Scope:     "inventory",
+						Attribute: "foo",
+						Order:     "asc",
+					},
+				},
+			},
+		},
+		"wrong sort order": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				model.SearchParams{
+					Page:    4,
+					PerPage: 5,
+					Sort: []model.SortCriteria{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Order:     "foo",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Order:     "desc",
+						},
+					},
+				},
+			),
+			err: errors.New("order: must be a valid value."),
+		},
+		"wrong filter type": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				model.SearchParams{
+					Page:    4,
+					PerPage: 5,
+					Filters: []model.FilterPredicate{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Type:      "$eq",
+							Value:     "bar",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Type:      "$neq",
+							Value:     "baz",
+						},
+					},
+				},
+			),
+			err: errors.New("type: must be a valid value."),
+		},
+		"invalid JSON": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/search",
+				"invalid json",
+			),
+			err: errors.New("failed to decode request body: json: cannot unmarshal string into Go value of type model.SearchParams"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("test case: %s", name), func(t *testing.T) {
+			req := rest.Request{Request: tc.inReq}
+			params, err := parseSearchParams(&req, nil, 0)
+			if tc.err != nil {
+				assert.EqualError(t, tc.err, err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, params)
+				assert.NotEmpty(t, params)
+
+				assert.Equal(t, tc.searchParams, params)
+			}
+		})
+	}
+}
+
+func TestApiInventoryInternalSearchDevices(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	testCases := map[string]struct {
+		listDevicesNum  int
+		listDevicesErr  error
+		listDeviceTotal int
+		inReq           *http.Request
+		resp            JSONResponseParams
+	}{
+		"valid filter and sort": {
+			listDevicesNum:  5,
+			listDevicesErr:  nil,
+			listDeviceTotal: 21,
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v2/inventory/tenants/foo/filters/search",
+				model.SearchParams{
+					Page:    4,
+					PerPage: 5,
+					Filters: []model.FilterPredicate{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Type:      "$eq",
+							Value:     "bar",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Type:      "$eq",
+							Value:     "baz",
+						},
+					},
+					Sort: []model.SortCriteria{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Order:     "asc",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Order:     "desc",
+						},
+					},
+				},
+			),
+			resp: JSONResponseParams{
+				OutputStatus:     200,
+				OutputBodyObject: mockListDevices(5),
+				OutputHeaders: map[string][]string{
+					hdrTotalCount: {"21"},
+				},
+			},
+		},
+		"valid filter and sort no tenant": {
+			listDevicesNum:  5,
+			listDevicesErr:  nil,
+			listDeviceTotal: 21,
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v2/inventory/tenants//filters/search",
+				model.SearchParams{
+					Page:    4,
+					PerPage: 5,
+					Filters: []model.FilterPredicate{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Type:      "$eq",
+							Value:     "bar",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Type:      "$eq",
+							Value:     "baz",
+						},
+					},
+					Sort: []model.SortCriteria{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Order:     "asc",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Order:     "desc",
+						},
+					},
+				},
+			),
+			resp: JSONResponseParams{
+				OutputStatus:     200,
+				OutputBodyObject: mockListDevices(5),
+				OutputHeaders: map[string][]string{
+					hdrTotalCount: {"21"},
+				},
+			},
+		},
+		"invalid filter": {
+			listDevicesNum:  5,
+			listDevicesErr:  nil,
+			listDeviceTotal: 21,
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v2/inventory/tenants/foo/filters/search",
+				model.SearchParams{
+					Page:    4,
+					PerPage: 5,
+					Filters: []model.FilterPredicate{
+						{},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Type:      "$eq",
+							Value:     "baz",
+						},
+					},
+					Sort: []model.SortCriteria{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Order:     "asc",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Order:     "desc",
+						},
+					},
+				},
+			),
+			resp: JSONResponseParams{
+				OutputStatus:     400,
+				OutputBodyObject: RestError("attribute: cannot be blank; scope: cannot be blank; type: cannot be blank; value: is required."),
+				OutputHeaders:    nil,
+			},
+		},
+		"inventory error": {
+			listDevicesNum:  5,
+			listDevicesErr:  errors.New("inventory error"),
+			listDeviceTotal: 21,
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v2/inventory/tenants/foo/filters/search",
+				model.SearchParams{
+					Page:    4,
+					PerPage: 5,
+					Filters: []model.FilterPredicate{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Type:      "$eq",
+							Value:     "bar",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Type:      "$eq",
+							Value:     "baz",
+						},
+					},
+					Sort: []model.SortCriteria{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Order:     "asc",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Order:     "desc",
+						},
+					},
+				},
+			),
+			resp: JSONResponseParams{
+				OutputStatus:     500,
+				OutputBodyObject: RestError("internal error"),
+				OutputHeaders:    nil,
+			},
+		},
+		"inventory error, BadValue": {
+			listDevicesNum:  5,
+			listDevicesErr:  errors.New("inventory error: BadValue"),
+			listDeviceTotal: 21,
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v2/inventory/tenants/foo/filters/search",
+				model.SearchParams{
+					Page:    4,
+					PerPage: 5,
+					Filters: []model.FilterPredicate{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Type:      "$eq",
+							Value:     "bar",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Type:      "$eq",
+							Value:     "baz",
+						},
+					},
+					Sort: []model.SortCriteria{
+						{
+							Scope:     "inventory",
+							Attribute: "foo",
+							Order:     "asc",
+						},
+						{
+							Scope:     "inventory",
+							Attribute: "foo1",
+							Order:     "desc",
+						},
+					},
+				},
+			),
+			resp: JSONResponseParams{
+				OutputStatus:     400,
+				OutputBodyObject: RestError("inventory error: BadValue"),
+				OutputHeaders:    nil,
+			},
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Logf("test case: %s", name)
+		inv := minventory.InventoryApp{}
+
+		ctx := contextMatcher()
+
+		inv.On("SearchDevices",
+			ctx,
+			mock.AnythingOfType("model.SearchParams"),
+		).Return(mockListDevices(testCase.listDevicesNum), testCase.listDeviceTotal, testCase.listDevicesErr)
+
+		apih := makeMockApiHandler(t, &inv)
+
+		runTestRequest(t, apih, testCase.inReq, testCase.resp)
+	}
+}
+
+func makeReq(method, url, auth string, body interface{}) *http.Request {
+	req := test.MakeSimpleRequest(method, url, body)
+
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	req.Header.Add(requestid.RequestIdHeader, "test")
+
+	return req
+}
+
+func restError(status string) map[string]interface{} {
+	return map[string]interface{}{"error": status, "request_id": "test"}
+}
+
+func TestApiInventoryDuplicateAttributesInternal(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	duplicates := []model.DeviceDuplicateAttributes{{
+		DeviceID: "1",
+		Attributes: []model.DuplicateAttribute{{
+			Name:  "mac",
+			Scope: model.AttrScopeInventory,
+			Keys:  []string{"inventory-mac", "inventory-legacy-mac"},
+		}},
+	}}
+	report := &model.DeviceAttributesReport{
+		DeviceID: "1",
+		Issues: []model.AttributeIssue{{
+			Key:   "inventory-mac",
+			Name:  "mac",
+			Scope: model.AttrScopeInventory,
+			Issue: model.AttributeIssueDuplicateKey,
+		}},
+	}
+
+	testCases := map[string]struct {
+		inReq *http.Request
+
+		method    string
+		arguments []interface{}
+		returns   []interface{}
+
+		resp JSONResponseParams
+	}{
+		"ok, find": {
+			inReq: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/foo/diagnostics/duplicate-attributes",
+				nil),
+			method:    "FindDevicesWithDuplicateAttributes",
+			arguments: []interface{}{0, 21},
+			returns:   []interface{}{duplicates, nil},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: duplicates,
+			},
+		},
+		"ok, find, next page": {
+			inReq: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/foo/diagnostics/duplicate-attributes?page=2&per_page=1",
+				nil),
+			method:    "FindDevicesWithDuplicateAttributes",
+			arguments: []interface{}{1, 2},
+			returns: []interface{}{
+				append(duplicates, model.DeviceDuplicateAttributes{DeviceID: "2"}),
+				nil,
+			},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: duplicates,
+				OutputHeaders: map[string][]string{
+					"Link": {
+						fmt.Sprintf(utils.LinkTmpl, "duplicate-attributes", "page=1&per_page=1", "prev"),
+						fmt.Sprintf(utils.LinkTmpl, "duplicate-attributes", "page=3&per_page=1", "next"),
+						fmt.Sprintf(utils.LinkTmpl, "duplicate-attributes", "page=1&per_page=1", "first"),
+					},
+				},
+			},
+		},
+		"error, find, bad pagination": {
+			inReq: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/foo/diagnostics/duplicate-attributes?per_page=foo",
+				nil),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError(utils.MsgQueryParmInvalid("per_page")),
+			},
+		},
+		"error, find": {
+			inReq: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/foo/diagnostics/duplicate-attributes",
+				nil),
+			method:    "FindDevicesWithDuplicateAttributes",
+			arguments: []interface{}{0, 21},
+			returns:   []interface{}{nil, errors.New("internal error")},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+		"ok, repair": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/1/attributes/repair",
+				nil),
+			method:    "RepairDuplicateAttributes",
+			arguments: []interface{}{model.DeviceID("1")},
+			returns:   []interface{}{1, nil},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: map[string]int{"removed": 1},
+			},
+		},
+		"error, repair": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/1/attributes/repair",
+				nil),
+			method:    "RepairDuplicateAttributes",
+			arguments: []interface{}{model.DeviceID("1")},
+			returns:   []interface{}{0, errors.New("internal error")},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+		"ok, verify": {
+			inReq: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/1/attributes/verify",
+				nil),
+			method:    "VerifyDeviceAttributes",
+			arguments: []interface{}{model.DeviceID("1")},
+			returns:   []interface{}{report, nil},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: report,
+			},
+		},
+		"error, verify, device not found": {
+			inReq: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/1/attributes/verify",
+				nil),
+			method:    "VerifyDeviceAttributes",
+			arguments: []interface{}{model.DeviceID("1")},
+			returns: []interface{}{nil,
+				errors.Wrap(store.ErrDevNotFound, "failed to verify the device attributes")},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusNotFound,
+				OutputBodyObject: RestError(store.ErrDevNotFound.Error()),
+			},
+		},
+		"error, verify": {
+			inReq: test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/1/attributes/verify",
+				nil),
+			method:    "VerifyDeviceAttributes",
+			arguments: []interface{}{model.DeviceID("1")},
+			returns:   []interface{}{nil, errors.New("internal error")},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			ctx := mock.MatchedBy(func(ctx context.Context) bool {
+				id := identity.FromContext(ctx)
+				return id != nil && id.Tenant == "foo"
+			})
+			if tc.method != "" {
+				arguments := append([]interface{}{ctx}, tc.arguments...)
+				inv.On(tc.method, arguments...).Return(tc.returns...)
+			}
+
+			apih := makeMockApiHandler(t, &inv)
+
+			runTestRequest(t, apih, tc.inReq, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryAttributesChurnInternal(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	churn := []model.AttributeChurn{
+		{Name: "uptime", Scope: model.AttrScopeInventory, Count: 42},
+		{Name: "mac", Scope: model.AttrScopeInventory, Count: 1},
+	}
+
+	testCases := map[string]struct {
+		returns []interface{}
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			returns: []interface{}{churn, nil},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: churn,
+			},
+		},
+		"ok, empty": {
+			returns: []interface{}{[]model.AttributeChurn{}, nil},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: []model.AttributeChurn{},
+			},
+		},
+		"error": {
+			returns: []interface{}{nil, errors.New("internal error")},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			ctx := mock.MatchedBy(func(ctx context.Context) bool {
+				id := identity.FromContext(ctx)
+				return id != nil && id.Tenant == "foo"
+			})
+			inv.On("GetAttributesChurn", ctx).Return(tc.returns...)
+
+			apih := makeMockApiHandler(t, &inv)
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/foo/attributes/churn",
+				nil)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryDevicesAttributesCountInternal(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const url = "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/attribute-counts"
+
+	testCases := map[string]struct {
+		body   interface{}
+		ids    []model.DeviceID
+		counts map[model.DeviceID]int
+		err    error
+		config *Config
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			body:   []string{"1", "2", "3"},
+			ids:    []model.DeviceID{"1", "2", "3"},
+			counts: map[model.DeviceID]int{"1": 12, "3": 4},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: map[string]int{"1": 12, "3": 4},
+			},
+		},
+		"ok, no devices found": {
+			body:   []string{"1"},
+			ids:    []model.DeviceID{"1"},
+			counts: map[model.DeviceID]int{},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: map[string]int{},
+			},
+		},
+		"error, empty body": {
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("failed to decode request body: JSON payload is empty"),
+			},
+		},
+		"error, no devices": {
+			body: []string{},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("cannot be blank"),
+			},
+		},
+		"error, blank device ID": {
+			body: []string{"1", ""},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("1: cannot be blank."),
+			},
+		},
+		"error, too many devices": {
+			body:   []string{"1", "2", "3"},
+			config: &Config{MaxBulkDeviceIDs: 2},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("too many device IDs: the limit is 2"),
+			},
+		},
+		"error, internal": {
+			body: []string{"1"},
+			ids:  []model.DeviceID{"1"},
+			err:  errors.New("internal error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.ids != nil {
+				ctx := mock.MatchedBy(func(ctx context.Context) bool {
+					id := identity.FromContext(ctx)
+					return id != nil && id.Tenant == "foo"
+				})
+				inv.On("GetDevicesAttributesCount", ctx, tc.ids).
+					Return(tc.counts, tc.err)
+			}
+
+			apih := makeMockApiHandlerWithConfig(t, &inv, tc.config)
+
+			req := test.MakeSimpleRequest("POST", url, tc.body)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryFiltersTopAttributeValues(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const url = "http://1.2.3.4/api/management/v2/inventory/filters/attributes"
+
+	values := []model.AttributeValueCount{
+		{Value: "rpi4", Count: 5},
+		{Value: "rpi3", Count: 3},
+	}
+
+	testCases := map[string]struct {
+		url    string
+		scope  string
+		limit  int
+		values []model.AttributeValueCount
+		err    error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			url:    url + "/inventory/device_type/top-values?limit=2",
+			scope:  model.AttrScopeInventory,
+			limit:  2,
+			values: values,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: values,
+			},
+		},
+		"ok, default limit and scope alias": {
+			url:   url + "/inv/device_type/top-values",
+			scope: model.AttrScopeInventory,
+			limit: topAttributeValuesLimitDefault,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: []model.AttributeValueCount{},
+			},
+		},
+		"error, limit out of bounds": {
+			url: url + "/inventory/device_type/top-values?limit=101",
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError(utils.MsgQueryParmLimit(queryParamLimit)),
+			},
+		},
+		"error, internal": {
+			url:   url + "/inventory/device_type/top-values",
+			scope: model.AttrScopeInventory,
+			limit: topAttributeValuesLimitDefault,
+			err:   errors.New("internal error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.scope != "" {
+				inv.On("TopAttributeValues",
+					contextMatcher(), tc.scope, "device_type", tc.limit,
+				).Return(tc.values, tc.err)
+			}
+
+			config := NewConfig()
+			config.ScopeAliases = map[string]string{"inv": model.AttrScopeInventory}
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+			req := test.MakeSimpleRequest("GET", tc.url, nil)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryFiltersAttributeCardinality(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const url = "http://1.2.3.4/api/management/v2/inventory/filters/attributes"
+
+	testCases := map[string]struct {
+		url         string
+		cardinality int
+		err         error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			url:         url + "/inventory/device_type/cardinality",
+			cardinality: 4,
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+				OutputBodyObject: model.AttributeCardinality{
+					Name:        "device_type",
+					Scope:       model.AttrScopeInventory,
+					Cardinality: 4,
+				},
+			},
+		},
+		"ok, scope alias": {
+			url: url + "/inv/device_type/cardinality",
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+				OutputBodyObject: model.AttributeCardinality{
+					Name:  "device_type",
+					Scope: model.AttrScopeInventory,
+				},
+			},
+		},
+		"error, internal": {
+			url:         url + "/inventory/device_type/cardinality",
+			cardinality: -1,
+			err:         errors.New("internal error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			inv.On("AttributeCardinality",
+				contextMatcher(), model.AttrScopeInventory, "device_type",
+			).Return(tc.cardinality, tc.err)
+
+			config := NewConfig()
+			config.ScopeAliases = map[string]string{"inv": model.AttrScopeInventory}
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+			req := test.MakeSimpleRequest("GET", tc.url, nil)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryFiltersCoverage(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	coverage := []model.AttributeCoverage{
+		{Name: "mac", Scope: model.AttrScopeIdentity, Count: 4, Coverage: 100},
+		{Name: "device_type", Scope: model.AttrScopeInventory, Count: 1, Coverage: 25},
+	}
+
+	testCases := map[string]struct {
+		coverage []model.AttributeCoverage
+		err      error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			coverage: coverage,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: coverage,
+			},
+		},
+		"ok, no devices": {
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: []model.AttributeCoverage{},
+			},
+		},
+		"error, internal": {
+			err: errors.New("internal error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			inv.On("GetAttributesCoverage", contextMatcher()).
+				Return(tc.coverage, tc.err)
+
+			apih := makeMockApiHandler(t, &inv)
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/inventory/filters/coverage", nil)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryFiltersScopes(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	scopes := []string{
+		model.AttrScopeIdentity,
+		model.AttrScopeInventory,
+		model.AttrScopeSystem,
+	}
+
+	testCases := map[string]struct {
+		scopes []string
+		err    error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			scopes: scopes,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: scopes,
+			},
+		},
+		"ok, no devices": {
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: []string{},
+			},
+		},
+		"error, internal": {
+			err: errors.New("internal error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			inv.On("GetAttributeScopes", contextMatcher()).
+				Return(tc.scopes, tc.err)
+
+			apih := makeMockApiHandler(t, &inv)
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/inventory/filters/scopes", nil)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryCreateSavedFilter(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const url = "http://1.2.3.4/api/management/v2/inventory/filters"
+
+	filters := []model.FilterPredicate{{
+		Scope:     model.AttrScopeInventory,
+		Attribute: "device_type",
+		Type:      "$eq",
+		Value:     "qemux86-64",
+	}}
+
+	testCases := map[string]struct {
+		body interface{}
+
+		create    bool
+		createErr error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			body: map[string]interface{}{
+				"name": "qemu",
+				"filters": []map[string]interface{}{{
+					"scope":     "inv",
+					"attribute": "device_type",
+					"type":      "$eq",
+					"value":     "qemux86-64",
+				}},
+			},
+			create: true,
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusCreated,
+				OutputBodyObject: model.SavedFilter{
+					ID:      "1",
+					Name:    "qemu",
+					Filters: filters,
+				},
+				OutputHeaders: map[string][]string{
+					"Location": {"/api/management/v2/inventory/filters/1"},
+				},
+			},
+		},
+		"ko, missing name": {
+			body: map[string]interface{}{
+				"filters": filters,
+			},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("name: cannot be blank."),
+			},
+		},
+		"ko, missing filters": {
+			body: map[string]interface{}{
+				"name": "qemu",
+			},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("filters: cannot be blank."),
+			},
+		},
+		"ko, internal error": {
+			body: model.SavedFilter{
+				Name:    "qemu",
+				Filters: filters,
+			},
+			create:    true,
+			createErr: errors.New("db error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.create {
+				inv.On("CreateSavedFilter",
+					contextMatcher(),
+					mock.MatchedBy(func(filter *model.SavedFilter) bool {
+						return assert.Equal(t, filters, filter.Filters)
+					}),
+				).Run(func(args mock.Arguments) {
+					args.Get(1).(*model.SavedFilter).ID = "1"
+				}).Return(tc.createErr)
+			}
+
+			config := NewConfig()
+			config.ScopeAliases = map[string]string{"inv": model.AttrScopeInventory}
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+			req := test.MakeSimpleRequest("POST", url, tc.body)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryGetSavedFilter(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const url = "http://1.2.3.4/api/management/v2/inventory/filters/1"
+
+	filter := &model.SavedFilter{
+		ID:   "1",
+		Name: "qemu",
+		Filters: []model.FilterPredicate{{
+			Scope:     model.AttrScopeInventory,
+			Attribute: "device_type",
+			Type:      "$eq",
+			Value:     "qemux86-64",
+		}},
+	}
+
+	testCases := map[string]struct {
+		filter *model.SavedFilter
+		err    error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			filter: filter,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: filter,
+			},
+		},
+		"ko, not found": {
+			err: errors.Wrap(store.ErrFilterNotFound, "failed to get the filter"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusNotFound,
+				OutputBodyObject: RestError(store.ErrFilterNotFound.Error()),
+			},
+		},
+		"ko, internal error": {
+			err: errors.New("db error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			inv.On("GetSavedFilter", contextMatcher(), "1").
+				Return(tc.filter, tc.err)
+
+			apih := makeMockApiHandler(t, &inv)
+
+			req := test.MakeSimpleRequest("GET", url, nil)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryUpdateSavedFilter(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const url = "http://1.2.3.4/api/management/v2/inventory/filters/1"
+
+	filter := model.SavedFilter{
+		Name: "qemu",
+		Filters: []model.FilterPredicate{{
+			Scope:     model.AttrScopeInventory,
+			Attribute: "device_type",
+			Type:      "$eq",
+			Value:     "qemux86-64",
+		}},
+	}
+
+	testCases := map[string]struct {
+		body interface{}
+
+		update    bool
+		updateErr error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			body:   filter,
+			update: true,
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusNoContent,
+			},
+		},
+		"ko, missing name": {
+			body: model.SavedFilter{Filters: filter.Filters},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("name: cannot be blank."),
+			},
+		},
+		"ko, not found": {
+			body:      filter,
+			update:    true,
+			updateErr: errors.Wrap(store.ErrFilterNotFound, "failed to update the filter"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusNotFound,
+				OutputBodyObject: RestError(store.ErrFilterNotFound.Error()),
+			},
+		},
+		"ko, internal error": {
+			body:      filter,
+			update:    true,
+			updateErr: errors.New("db error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.update {
+				expected := filter
+				expected.ID = "1"
+				inv.On("UpdateSavedFilter", contextMatcher(), &expected).
+					Return(tc.updateErr)
+			}
+
+			apih := makeMockApiHandler(t, &inv)
+
+			req := test.MakeSimpleRequest("PUT", url, tc.body)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryDeleteSavedFilter(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const url = "http://1.2.3.4/api/management/v2/inventory/filters/1"
+
+	testCases := map[string]struct {
+		err error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusNoContent,
+			},
+		},
+		"ko, not found": {
+			err: errors.Wrap(store.ErrFilterNotFound, "failed to delete the filter"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusNotFound,
+				OutputBodyObject: RestError(store.ErrFilterNotFound.Error()),
+			},
+		},
+		"ko, internal error": {
+			err: errors.New("db error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			inv.On("DeleteSavedFilter", contextMatcher(), "1").Return(tc.err)
+
+			apih := makeMockApiHandler(t, &inv)
+
+			req := test.MakeSimpleRequest("DELETE", url, nil)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryGetSavedFilterDevices(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const url = "http://1.2.3.4/api/management/v2/inventory/filters/1/devices"
+
+	filter := &model.SavedFilter{
+		ID:   "1",
+		Name: "qemu",
+		Filters: []model.FilterPredicate{{
+			Scope:     model.AttrScopeInventory,
+			Attribute: "device_type",
+			Type:      "$eq",
+			Value:     "qemux86-64",
+		}},
+	}
+
+	testCases := map[string]struct {
+		url string
+
+		get    bool
+		filter *model.SavedFilter
+		getErr error
+
+		search    bool
+		devices   []model.Device
+		searchErr error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			url:     url + "?page=2&per_page=2",
+			get:     true,
+			filter:  filter,
+			search:  true,
+			devices: mockListDevices(2),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: mockListDevices(2),
+				OutputHeaders: map[string][]string{
+					hdrTotalCount: {"6"},
+				},
+			},
+		},
+		"ko, invalid pagination": {
+			url: url + "?page=0",
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError(
+					utils.MsgQueryParmLimit("page")),
+			},
+		},
+		"ko, filter not found": {
+			url:    url,
+			get:    true,
+			getErr: errors.Wrap(store.ErrFilterNotFound, "failed to get the filter"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusNotFound,
+				OutputBodyObject: RestError(store.ErrFilterNotFound.Error()),
+			},
+		},
+		"ko, search error": {
+			url:       url,
+			get:       true,
+			filter:    filter,
+			search:    true,
+			searchErr: errors.New("db error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.get {
+				inv.On("GetSavedFilter", contextMatcher(), "1").
+					Return(tc.filter, tc.getErr)
+			}
+			if tc.search {
+				inv.On("SearchDevices",
+					contextMatcher(),
+					mock.MatchedBy(func(params model.SearchParams) bool {
+						return assert.Equal(t, filter.Filters, params.Filters)
+					}),
+				).Return(tc.devices, 6, tc.searchErr)
+			}
+
+			apih := makeMockApiHandler(t, &inv)
+
+			req := test.MakeSimpleRequest("GET", tc.url, nil)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryCompareDevices(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	diff := &model.DevicesDiff{
+		Added: model.DeviceAttributes{
+			{Name: "foo", Value: "bar", Scope: model.AttrScopeTags},
+		},
+		Removed: model.DeviceAttributes{},
+		Changed: []model.AttributeChange{{
+			Name:     "kernel",
+			Scope:    model.AttrScopeInventory,
+			Value:    "5.10",
+			NewValue: "6.1",
+		}},
+	}
+
+	testCases := map[string]struct {
+		body interface{}
+
+		compare bool
+		diff    *model.DevicesDiff
+		err     error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			body:    map[string]interface{}{"base": "1", "other": "2"},
+			compare: true,
+			diff:    diff,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: diff,
+			},
+		},
+		"ko, missing device ID": {
+			body: map[string]interface{}{"base": "1"},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("other: cannot be blank."),
+			},
+		},
+		"ko, device not found": {
+			body:    map[string]interface{}{"base": "1", "other": "2"},
+			compare: true,
+			err:     errors.Wrap(store.ErrDevNotFound, "device 2"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusNotFound,
+				OutputBodyObject: RestError("device 2: " + store.ErrDevNotFound.Error()),
+			},
+		},
+		"ko, internal error": {
+			body:    map[string]interface{}{"base": "1", "other": "2"},
+			compare: true,
+			err:     errors.New("db error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
 
-		Request: test.MakeSimpleRequest(
-			"DELETE",
-			"http://localhost/api/0.1.0/groups/illegal$group$name/devices",
-			[]model.DeviceID{"1", "2", "3"},
-		),
-		JSONResponseParams: JSONResponseParams{
-			OutputStatus: http.StatusBadRequest,
-			OutputBodyObject: map[string]interface{}{
-				"error": "Group name can only contain: upper/lowercase " +
-					"alphanum, -(dash), _(underscore)",
-				"request_id": "test",
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+			if tc.compare {
+				inv.On("CompareDevices", contextMatcher(),
+					model.DeviceID("1"), model.DeviceID("2"),
+				).Return(tc.diff, tc.err)
+			}
+
+			apih := makeMockApiHandler(t, &inv)
+
+			req := test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/devices/compare", tc.body)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryOnboardingStats(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const url = "http://1.2.3.4/api/management/v2/inventory/devices/onboarding-stats"
+
+	from := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 3, 3, 0, 0, 0, 0, time.UTC)
+	stats := []model.TimeBucketCount{
+		{Bucket: from, Count: 2},
+		{Bucket: from.AddDate(0, 0, 1), Count: 0},
+	}
+
+	testCases := map[string]struct {
+		body   interface{}
+		params *model.OnboardingStatsParams
+		stats  []model.TimeBucketCount
+		err    error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			body: map[string]interface{}{
+				"from":        from,
+				"to":          to,
+				"granularity": "day",
+			},
+			params: &model.OnboardingStatsParams{
+				From: from, To: to, Granularity: model.BucketDay,
+			},
+			stats: stats,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: stats,
+			},
+		},
+		"error, empty body": {
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("failed to decode request body: JSON payload is empty"),
+			},
+		},
+		"error, bad granularity": {
+			body: map[string]interface{}{
+				"from":        from,
+				"to":          to,
+				"granularity": "month",
+			},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("granularity: must be a valid value."),
+			},
+		},
+		"error, empty range": {
+			body: map[string]interface{}{
+				"from":        to,
+				"to":          from,
+				"granularity": "week",
+			},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("to: must be after from."),
+			},
+		},
+		"error, internal": {
+			body: map[string]interface{}{
+				"from":        from,
+				"to":          to,
+				"granularity": "day",
+			},
+			params: &model.OnboardingStatsParams{
+				From: from, To: to, Granularity: model.BucketDay,
+			},
+			err: errors.New("internal error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.params != nil {
+				inv.On("GetOnboardingStats", contextMatcher(), *tc.params).
+					Return(tc.stats, tc.err)
+			}
+
+			apih := makeMockApiHandler(t, &inv)
+
+			req := test.MakeSimpleRequest("POST", url, tc.body)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryGetGroupSchema(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	attributes := []model.SchemaAttribute{{
+		Name:  "uptime",
+		Scope: model.AttrScopeInventory,
+		Types: []string{model.AttrTypeNumber, model.AttrTypeString},
+	}}
+
+	testCases := map[string]struct {
+		group      string
+		callsInv   bool
+		attributes []model.SchemaAttribute
+		err        error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			group:      "prod",
+			callsInv:   true,
+			attributes: attributes,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: attributes,
+			},
+		},
+		"ok, no devices": {
+			group:    "prod",
+			callsInv: true,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: []model.SchemaAttribute{},
+			},
+		},
+		"error, invalid group name": {
+			group: "pro.d",
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError("Group name can only contain: " +
+					"upper/lowercase alphanum, -(dash), _(underscore)"),
+			},
+		},
+		"error, internal": {
+			group:    "prod",
+			callsInv: true,
+			err:      errors.New("internal error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.callsInv {
+				inv.On("GetGroupSchema", contextMatcher(), model.GroupName(tc.group)).
+					Return(tc.attributes, tc.err)
+			}
+
+			apih := makeMockApiHandler(t, &inv)
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/management/v2/inventory/groups/"+tc.group+"/schema",
+				nil)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryGetAlertsSummary(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const url = "http://1.2.3.4/api/management/v2/inventory/devices/alerts-summary"
+
+	summary := &model.AlertsSummary{
+		WithAlerts:    3,
+		WithoutAlerts: 4,
+		Buckets: []model.AlertCountBucket{
+			{Bucket: model.AlertCountBucketNone, Count: 4},
+			{Bucket: model.AlertCountBucketFew, Count: 2},
+			{Bucket: model.AlertCountBucketMany, Count: 1},
+		},
+	}
+
+	testCases := map[string]struct {
+		config  *Config
+		scope   string
+		summary *model.AlertsSummary
+		err     error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			scope:   model.AttrScopeMonitor,
+			summary: summary,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: summary,
+			},
+		},
+		"ok, configured devicemonitor scope": {
+			config: &Config{
+				ReindexServiceScopes: map[string]string{
+					"devicemonitor": "alerts",
+				},
+			},
+			scope:   "alerts",
+			summary: summary,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: summary,
+			},
+		},
+		"error, internal": {
+			scope: model.AttrScopeMonitor,
+			err:   errors.New("internal error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			inv.On("GetAlertsSummary", contextMatcher(), tc.scope).
+				Return(tc.summary, tc.err)
+
+			apih := makeMockApiHandlerWithConfig(t, &inv, tc.config)
+
+			req := test.MakeSimpleRequest("GET", url, nil)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryDevicesStatusesInternal(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const url = "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/statuses"
+
+	testCases := map[string]struct {
+		body     interface{}
+		ids      []model.DeviceID
+		statuses map[model.DeviceID]*string
+		err      error
+		config   *Config
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			body: []string{"1", "2", "3"},
+			ids:  []model.DeviceID{"1", "2", "3"},
+			statuses: map[model.DeviceID]*string{
+				"1": strPtr("accepted"),
+				"3": nil,
+			},
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+				OutputBodyObject: map[string]*string{
+					"1": strPtr("accepted"),
+					"3": nil,
+				},
+			},
+		},
+		"ok, no devices found": {
+			body:     []string{"1"},
+			ids:      []model.DeviceID{"1"},
+			statuses: map[model.DeviceID]*string{},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: map[string]*string{},
+			},
+		},
+		"error, empty body": {
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("failed to decode request body: JSON payload is empty"),
+			},
+		},
+		"error, no devices": {
+			body: []string{},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("cannot be blank"),
+			},
+		},
+		"error, too many devices": {
+			body:   []string{"1", "2", "3"},
+			config: &Config{MaxBulkDeviceIDs: 2},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("too many device IDs: the limit is 2"),
+			},
+		},
+		"error, internal": {
+			body: []string{"1"},
+			ids:  []model.DeviceID{"1"},
+			err:  errors.New("internal error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.ids != nil {
+				ctx := mock.MatchedBy(func(ctx context.Context) bool {
+					id := identity.FromContext(ctx)
+					return id != nil && id.Tenant == "foo"
+				})
+				inv.On("GetDevicesStatuses", ctx, tc.ids).
+					Return(tc.statuses, tc.err)
+			}
+
+			apih := makeMockApiHandlerWithConfig(t, &inv, tc.config)
+
+			req := test.MakeSimpleRequest("POST", url, tc.body)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryFindDevicesByAttributeInternal(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const url = "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/by-attribute"
+
+	devices := []model.Device{
+		{ID: "1", Group: "foo"},
+		{ID: "2"},
+	}
+
+	testCases := map[string]struct {
+		body   interface{}
+		scope  string
+		name   string
+		values []interface{}
+		out    []model.Device
+		err    error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			body: map[string]interface{}{
+				"scope":  "inventory",
+				"name":   "mac",
+				"values": []interface{}{"00:11", "00:22", 3},
+			},
+			scope:  "inventory",
+			name:   "mac",
+			values: []interface{}{"00:11", "00:22", float64(3)},
+			out:    devices,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: devices,
+			},
+		},
+		"ok, no devices found": {
+			body: map[string]interface{}{
+				"scope":  "identity",
+				"name":   "mac",
+				"values": []interface{}{"00:11"},
+			},
+			scope:  "identity",
+			name:   "mac",
+			values: []interface{}{"00:11"},
+			out:    []model.Device{},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: []model.Device{},
+			},
+		},
+		"error, empty body": {
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("failed to decode request body: JSON payload is empty"),
+			},
+		},
+		"error, missing fields": {
+			body: map[string]interface{}{
+				"values": []interface{}{"00:11"},
+			},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("name: cannot be blank; scope: cannot be blank."),
+			},
+		},
+		"error, no values": {
+			body: map[string]interface{}{
+				"scope":  "inventory",
+				"name":   "mac",
+				"values": []interface{}{},
+			},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("values: cannot be blank."),
+			},
+		},
+		"error, unsupported value type": {
+			body: map[string]interface{}{
+				"scope":  "inventory",
+				"name":   "mac",
+				"values": []interface{}{"00:11", true},
+			},
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError(
+					"values: (1: supported types are string and float64.)."),
 			},
 		},
-	}}
+		"error, internal": {
+			body: map[string]interface{}{
+				"scope":  "inventory",
+				"name":   "mac",
+				"values": []interface{}{"00:11"},
+			},
+			scope:  "inventory",
+			name:   "mac",
+			values: []interface{}{"00:11"},
+			err:    errors.New("internal error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
 
-	for _, testCase := range testCases {
-		t.Run(testCase.Name, func(t *testing.T) {
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
 			inv := minventory.InventoryApp{}
-			ctx := contextMatcher()
+			defer inv.AssertExpectations(t)
+
+			if tc.values != nil {
+				ctx := mock.MatchedBy(func(ctx context.Context) bool {
+					id := identity.FromContext(ctx)
+					return id != nil && id.Tenant == "foo"
+				})
+				inv.On("FindDevicesByAttributeValues", ctx, tc.scope, tc.name, tc.values).
+					Return(tc.out, tc.err)
+			}
+
 			apih := makeMockApiHandler(t, &inv)
 
-			var ret *model.UpdateResult
-			if rsp, ok := testCase.JSONResponseParams.
-				OutputBodyObject.(*model.
-				UpdateResult); ok {
-				ret = rsp
-			}
-			inv.On("UnsetDevicesGroup",
-				ctx,
-				testCase.Devices,
-				testCase.GroupName,
-			).Return(
-				ret,
-				testCase.InventoryErr,
-			)
-			runTestRequest(t, apih,
-				testCase.Request,
-				testCase.JSONResponseParams,
-			)
+			req := test.MakeSimpleRequest("POST", url, tc.body)
+			runTestRequest(t, apih, req, tc.resp)
 		})
 	}
 }
 
-func TestAPIPatchGroupDevices(t *testing.T) {
+func TestApiInventoryFindDevicesWithAttributeDriftInternal(t *testing.T) {
 	t.Parallel()
+	rest.ErrorFieldName = "error"
 
-	testCases := []struct {
-		Name string
+	const url = "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/attribute-drift"
 
-		Devices []model.DeviceID
-		model.GroupName
-		InventoryErr error
+	devices := []model.Device{
+		{ID: "1", Group: "foo"},
+		{ID: "2"},
+	}
 
-		*http.Request
-		JSONResponseParams
-	}{{
-		Name: "ok, all device IDs match",
+	testCases := map[string]struct {
+		body  interface{}
+		find  bool
+		scope string
+		value interface{}
+		out   []model.Device
+		err   error
 
-		Request: test.MakeSimpleRequest(
-			"PATCH",
-			"http://localhost/api/0.1.0/groups/foo/devices",
-			[]model.DeviceID{"1", "2", "3"},
-		),
-		Devices:   []model.DeviceID{"1", "2", "3"},
-		GroupName: "foo",
-		JSONResponseParams: JSONResponseParams{
-			OutputStatus: http.StatusOK,
-			OutputBodyObject: &model.UpdateResult{
-				MatchedCount: 3,
-				UpdatedCount: 3,
+		resp JSONResponseParams
+	}{
+		"ok": {
+			body: map[string]interface{}{
+				"scope": "inv",
+				"name":  "kernel",
+				"value": "5.15",
+			},
+			find:  true,
+			scope: model.AttrScopeInventory,
+			value: "5.15",
+			out:   devices,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: devices,
 			},
 		},
-	}, {
-		Name: "error, invalid JSON schema",
-
-		Request: test.MakeSimpleRequest(
-			"PATCH",
-			"http://localhost/api/0.1.0/groups/foo/devices",
-			map[string][]string{"devices": {"foo", "bar", "baz"}},
-		),
-		JSONResponseParams: JSONResponseParams{
-			OutputStatus: http.StatusBadRequest,
-			OutputBodyObject: map[string]interface{}{
-				"error": "invalid payload schema: json: " +
-					"cannot unmarshal object into Go " +
-					"value of type []model.DeviceID",
-				"request_id": "test",
+		"ok, numeric value": {
+			body: map[string]interface{}{
+				"scope": "inventory",
+				"name":  "kernel",
+				"value": 4,
+			},
+			find:  true,
+			scope: model.AttrScopeInventory,
+			value: float64(4),
+			out:   []model.Device{},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: []model.Device{},
 			},
 		},
-	}, {
-		Name: "error, empty devices list",
-
-		Request: test.MakeSimpleRequest(
-			"PATCH",
-			"http://localhost/api/0.1.0/groups/foo/devices",
-			[]model.DeviceID{}),
-		JSONResponseParams: JSONResponseParams{
-			OutputStatus: http.StatusBadRequest,
-			OutputBodyObject: map[string]interface{}{
-				"error":      "no device IDs present in payload",
-				"request_id": "test",
+		"error, missing value": {
+			body: map[string]interface{}{
+				"scope": "inventory",
+				"name":  "kernel",
+			},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("value: is required."),
 			},
 		},
-	}, {
-		Name: "error, invalid group name",
+		"error, unsupported value type": {
+			body: map[string]interface{}{
+				"scope": "inventory",
+				"name":  "kernel",
+				"value": []string{"5.15"},
+			},
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError(
+					"value: supported types are string and float64."),
+			},
+		},
+		"error, internal": {
+			body: map[string]interface{}{
+				"scope": "inventory",
+				"name":  "kernel",
+				"value": "5.15",
+			},
+			find:  true,
+			scope: model.AttrScopeInventory,
+			value: "5.15",
+			err:   errors.New("internal error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
 
-		Request: test.MakeSimpleRequest(
-			"PATCH",
-			"http://localhost/api/0.1.0/groups/deeeåååhh/devices",
-			[]model.DeviceID{"1", "2"},
-		),
-		JSONResponseParams: JSONResponseParams{
-			OutputStatus: http.StatusBadRequest,
-			OutputBodyObject: map[string]interface{}{
-				"error": "Group name can only contain: " +
-					"upper/lowercase alphanum, " +
-					"-(dash), _(underscore)",
-				"request_id": "test",
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.find {
+				ctx := mock.MatchedBy(func(ctx context.Context) bool {
+					id := identity.FromContext(ctx)
+					return id != nil && id.Tenant == "foo"
+				})
+				inv.On("FindDevicesWithAttributeDrift", ctx, tc.scope, "kernel", tc.value).
+					Return(tc.out, tc.err)
+			}
+
+			config := NewConfig()
+			config.ScopeAliases = map[string]string{"inv": model.AttrScopeInventory}
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+			req := test.MakeSimpleRequest("POST", url, tc.body)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryFindDevicesByAttributeSetInternal(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const url = "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/by-attribute-set"
+
+	devices := []model.Device{{ID: "1"}}
+
+	testCases := map[string]struct {
+		body  interface{}
+		scope string
+		attrs model.DeviceAttributes
+		out   []model.Device
+		err   error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			body: map[string]interface{}{
+				"scope": "identity",
+				"attributes": map[string]interface{}{
+					"sn":  "0001",
+					"mac": "00:11",
+					"cpu": 4,
+				},
+			},
+			scope: model.AttrScopeIdentity,
+			attrs: model.DeviceAttributes{
+				{Name: "cpu", Value: float64(4), Scope: model.AttrScopeIdentity},
+				{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+				{Name: "sn", Value: "0001", Scope: model.AttrScopeIdentity},
+			},
+			out: devices,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: devices,
 			},
 		},
-	}, {
-		Name: "error, internal error",
+		"ok, scope alias, no devices found": {
+			body: map[string]interface{}{
+				"scope":      "inv",
+				"attributes": map[string]interface{}{"os": "linux"},
+			},
+			scope: model.AttrScopeInventory,
+			attrs: model.DeviceAttributes{
+				{Name: "os", Value: "linux", Scope: model.AttrScopeInventory},
+			},
+			out: []model.Device{},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: []model.Device{},
+			},
+		},
+		"error, empty body": {
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("failed to decode request body: JSON payload is empty"),
+			},
+		},
+		"error, missing fields": {
+			body: map[string]interface{}{},
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError(
+					"attributes: cannot be blank; scope: cannot be blank."),
+			},
+		},
+		"error, unsupported value type": {
+			body: map[string]interface{}{
+				"scope":      "identity",
+				"attributes": map[string]interface{}{"mac": true},
+			},
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError(
+					"attributes: (mac: supported types are string and float64.)."),
+			},
+		},
+		"error, internal": {
+			body: map[string]interface{}{
+				"scope":      "identity",
+				"attributes": map[string]interface{}{"mac": "00:11"},
+			},
+			scope: model.AttrScopeIdentity,
+			attrs: model.DeviceAttributes{
+				{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+			},
+			err: errors.New("internal error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
 
-		Request: test.MakeSimpleRequest(
-			"PATCH",
-			"http://localhost/api/0.1.0/groups/foo/devices",
-			[]model.DeviceID{"1", "2"},
-		),
-		Devices:      []model.DeviceID{"1", "2"},
-		GroupName:    "foo",
-		InventoryErr: errors.New("unknown error"),
-		JSONResponseParams: JSONResponseParams{
-			OutputStatus: http.StatusInternalServerError,
-			OutputBodyObject: map[string]interface{}{
-				"error":      "internal error",
-				"request_id": "test",
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.attrs != nil {
+				ctx := mock.MatchedBy(func(ctx context.Context) bool {
+					id := identity.FromContext(ctx)
+					return id != nil && id.Tenant == "foo"
+				})
+				inv.On("FindDevicesByAttributeSet", ctx, tc.scope, tc.attrs).
+					Return(tc.out, tc.err)
+			}
+
+			config := NewConfig()
+			config.ScopeAliases = map[string]string{"inv": model.AttrScopeInventory}
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+			req := test.MakeSimpleRequest("POST", url, tc.body)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryAttributesPresenceInternal(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const url = "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/attributes-presence"
+
+	attributes := []model.SelectAttribute{
+		{Scope: model.AttrScopeInventory, Attribute: "os"},
+		{Scope: model.AttrScopeTags, Attribute: "room"},
+	}
+	presence := map[model.DeviceID][]bool{
+		"1": {true, false},
+		"2": {true, true},
+	}
+
+	testCases := map[string]struct {
+		body       interface{}
+		maxIDs     int
+		ids        []model.DeviceID
+		attributes []model.SelectAttribute
+		out        map[model.DeviceID][]bool
+		err        error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			body: map[string]interface{}{
+				"device_ids": []string{"1", "2", "3"},
+				"attributes": []map[string]string{
+					{"scope": "inv", "attribute": "os"},
+					{"scope": "tags", "attribute": "room"},
+				},
+			},
+			ids:        []model.DeviceID{"1", "2", "3"},
+			attributes: attributes,
+			out:        presence,
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+				OutputBodyObject: InventoryApiAttributesPresence{
+					Attributes: attributes,
+					Devices:    presence,
+				},
+			},
+		},
+		"error, empty body": {
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("failed to decode request body: JSON payload is empty"),
+			},
+		},
+		"error, missing fields": {
+			body: map[string]interface{}{},
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError(
+					"attributes: cannot be blank; device_ids: cannot be blank."),
+			},
+		},
+		"error, attribute without name": {
+			body: map[string]interface{}{
+				"device_ids": []string{"1"},
+				"attributes": []map[string]string{{"scope": "inventory"}},
+			},
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError(
+					"attributes: (0: (attribute: cannot be blank.).)."),
+			},
+		},
+		"error, too many devices": {
+			body: map[string]interface{}{
+				"device_ids": []string{"1", "2", "3"},
+				"attributes": []map[string]string{{"scope": "inventory", "attribute": "os"}},
+			},
+			maxIDs: 2,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("too many device IDs: the limit is 2"),
+			},
+		},
+		"error, internal": {
+			body: map[string]interface{}{
+				"device_ids": []string{"1", "2", "3"},
+				"attributes": []map[string]string{
+					{"scope": "inventory", "attribute": "os"},
+					{"scope": "tags", "attribute": "room"},
+				},
+			},
+			ids:        []model.DeviceID{"1", "2", "3"},
+			attributes: attributes,
+			err:        errors.New("internal error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
 			},
 		},
-	}}
+	}
 
-	for _, testCase := range testCases {
-		t.Run(testCase.Name, func(t *testing.T) {
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
 			inv := minventory.InventoryApp{}
-			ctx := contextMatcher()
-			apih := makeMockApiHandler(t, &inv)
-
-			var ret *model.UpdateResult
-			if rsp, ok := testCase.JSONResponseParams.
-				OutputBodyObject.(*model.
-				UpdateResult); ok {
-				ret = rsp
+			defer inv.AssertExpectations(t)
+
+			if tc.ids != nil {
+				ctx := mock.MatchedBy(func(ctx context.Context) bool {
+					id := identity.FromContext(ctx)
+					return id != nil && id.Tenant == "foo"
+				})
+				inv.On("GetAttributesPresence", ctx, tc.ids, tc.attributes).
+					Return(tc.out, tc.err)
 			}
-			inv.On("UpdateDevicesGroup",
-				ctx,
-				testCase.Devices,
-				testCase.GroupName,
-			).Return(
-				ret,
-				testCase.InventoryErr,
-			)
-			runTestRequest(t, apih,
-				testCase.Request,
-				testCase.JSONResponseParams,
-			)
+
+			config := NewConfig()
+			config.ScopeAliases = map[string]string{"inv": model.AttrScopeInventory}
+			config.MaxBulkDeviceIDs = tc.maxIDs
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+			req := test.MakeSimpleRequest("POST", url, tc.body)
+			runTestRequest(t, apih, req, tc.resp)
 		})
 	}
 }
 
-func TestUserAdmApiCreateTenant(t *testing.T) {
+func TestApiInventoryFeatureFlagsInternal(t *testing.T) {
 	t.Parallel()
+	rest.ErrorFieldName = "error"
 
-	testCases := map[string]struct {
-		uaError error
-		body    interface{}
-		tenant  model.NewTenant
+	const url = "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/features"
 
-		checker mt.ResponseChecker
-	}{
-		"ok": {
-			uaError: nil,
-			body: map[string]interface{}{
-				"tenant_id": "foobar",
-			},
-			tenant: model.NewTenant{ID: "foobar"},
+	tenantCtx := mock.MatchedBy(func(ctx context.Context) bool {
+		id := identity.FromContext(ctx)
+		return id != nil && id.Tenant == "foo"
+	})
 
-			checker: mt.NewJSONResponse(
-				http.StatusCreated,
-				nil,
-				nil,
-			),
-		},
-		"error: useradm internal": {
-			body: map[string]interface{}{
-				"tenant_id": "failing-tenant",
+	t.Run("get", func(t *testing.T) {
+		testCases := map[string]struct {
+			flags model.FeatureFlags
+			err   error
+			resp  JSONResponseParams
+		}{
+			"ok": {
+				flags: model.FeatureFlags{model.FeatureAddDeviceCreateOnly: true},
+				resp: JSONResponseParams{
+					OutputStatus: http.StatusOK,
+					OutputBodyObject: map[string]bool{
+						model.FeatureAddDeviceCreateOnly: true,
+					},
+				},
 			},
-			uaError: errors.New("some internal error"),
-			tenant:  model.NewTenant{ID: "failing-tenant"},
+			"ok, no flags": {
+				resp: JSONResponseParams{
+					OutputStatus:     http.StatusOK,
+					OutputBodyObject: map[string]bool{},
+				},
+			},
+			"error, internal": {
+				err: errors.New("internal error"),
+				resp: JSONResponseParams{
+					OutputStatus:     http.StatusInternalServerError,
+					OutputBodyObject: RestError("internal error"),
+				},
+			},
+		}
+		for name, tc := range testCases {
+			t.Run(name, func(t *testing.T) {
+				inv := minventory.InventoryApp{}
+				defer inv.AssertExpectations(t)
+				inv.On("GetFeatureFlags", tenantCtx).Return(tc.flags, tc.err)
+
+				apih := makeMockApiHandler(t, &inv)
+				req := test.MakeSimpleRequest("GET", url, nil)
+				runTestRequest(t, apih, req, tc.resp)
+			})
+		}
+	})
 
-			checker: mt.NewJSONResponse(
-				http.StatusInternalServerError,
-				nil,
-				restError("internal error"),
-			),
-		},
-		"error: no tenant id": {
-			body: map[string]interface{}{
-				"tenant_id": "",
+	t.Run("set", func(t *testing.T) {
+		testCases := map[string]struct {
+			body  interface{}
+			flags model.FeatureFlags
+			err   error
+			resp  JSONResponseParams
+		}{
+			"ok": {
+				body: map[string]bool{
+					model.FeatureAddDeviceCreateOnly:       true,
+					model.FeatureNullAttributeValueRemoves: false,
+				},
+				flags: model.FeatureFlags{
+					model.FeatureAddDeviceCreateOnly:       true,
+					model.FeatureNullAttributeValueRemoves: false,
+				},
+				resp: JSONResponseParams{
+					OutputStatus: http.StatusNoContent,
+				},
 			},
-			tenant: model.NewTenant{},
+			"error, empty body": {
+				resp: JSONResponseParams{
+					OutputStatus:     http.StatusBadRequest,
+					OutputBodyObject: RestError("failed to decode request body: JSON payload is empty"),
+				},
+			},
+			"error, unknown feature": {
+				body: map[string]bool{"foo": true},
+				resp: JSONResponseParams{
+					OutputStatus:     http.StatusBadRequest,
+					OutputBodyObject: RestError("unknown feature: foo"),
+				},
+			},
+			"error, internal": {
+				body: map[string]bool{model.FeatureAddDeviceCreateOnly: true},
+				flags: model.FeatureFlags{
+					model.FeatureAddDeviceCreateOnly: true,
+				},
+				err: errors.New("internal error"),
+				resp: JSONResponseParams{
+					OutputStatus:     http.StatusInternalServerError,
+					OutputBodyObject: RestError("internal error"),
+				},
+			},
+		}
+		for name, tc := range testCases {
+			t.Run(name, func(t *testing.T) {
+				inv := minventory.InventoryApp{}
+				defer inv.AssertExpectations(t)
+				if tc.flags != nil {
+					inv.On("SetFeatureFlags", tenantCtx, tc.flags).Return(tc.err)
+				}
 
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("tenant_id: cannot be blank."),
-			),
-		},
-		"error: empty json": {
-			tenant: model.NewTenant{},
+				apih := makeMockApiHandler(t, &inv)
+				req := test.MakeSimpleRequest("PUT", url, tc.body)
+				runTestRequest(t, apih, req, tc.resp)
+			})
+		}
+	})
+}
 
-			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
-				nil,
-				restError("JSON payload is empty"),
-			),
-		},
-	}
+func TestApiInventoryFeatureFlagsPerTenant(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
 
-	for name, tc := range testCases {
-		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+	tenantCtx := func(tenant string) interface{} {
+		return mock.MatchedBy(func(ctx context.Context) bool {
+			id := identity.FromContext(ctx)
+			return id != nil && id.Tenant == tenant
+		})
+	}
 
-			ctx := contextMatcher()
+	inv := minventory.InventoryApp{}
+	defer inv.AssertExpectations(t)
+	inv.On("GetFeatureFlags", tenantCtx("foo")).
+		Return(model.FeatureFlags{model.FeatureAddDeviceCreateOnly: true}, nil)
+	inv.On("GetFeatureFlags", tenantCtx("bar")).
+		Return(model.FeatureFlags{}, nil)
+	inv.On("CreateDevice", tenantCtx("foo"), mock.AnythingOfType("*model.Device")).
+		Return(store.ErrDevExists)
+	inv.On("AddDevice", tenantCtx("bar"), mock.AnythingOfType("*model.Device")).
+		Return(nil)
 
-			//make mock inventory
-			inv := &minventory.InventoryApp{}
-			inv.On("CreateTenant", ctx, tc.tenant).Return(tc.uaError)
+	apih := makeMockApiHandler(t, &inv)
 
-			//make handler
-			api := makeMockApiHandler(t, inv)
+	device := map[string]interface{}{
+		"id": "1",
+		"attributes": []map[string]interface{}{
+			{"name": "mac", "value": "00:11", "scope": "identity"},
+		},
+	}
+	req := test.MakeSimpleRequest("POST",
+		"http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices", device)
+	runTestRequest(t, apih, req, JSONResponseParams{
+		OutputStatus:     http.StatusConflict,
+		OutputBodyObject: RestError(store.ErrDevExists.Error()),
+	})
 
-			//make request
-			req := makeReq(http.MethodPost,
-				"http://1.2.3.4/api/internal/v1/inventory/tenants",
-				"",
-				tc.body)
+	req = test.MakeSimpleRequest("POST",
+		"http://1.2.3.4/api/internal/v1/inventory/tenants/bar/devices", device)
+	runTestRequest(t, apih, req, JSONResponseParams{
+		OutputStatus: http.StatusCreated,
+	})
+}
 
-			//test
-			recorded := test.RunRequest(t, api, req)
-			mt.CheckResponse(t, tc.checker, recorded)
+// not parallel: the test captures the logs of the global logger
+func TestApiInventoryLogRedactedAttributes(t *testing.T) {
+	hook := logtest.NewLocal(log.Log)
+	defer hook.Reset()
+	level := log.Log.GetLevel()
+	log.Log.SetLevel(logrus.DebugLevel)
+	defer log.Log.SetLevel(level)
+
+	inv := minventory.InventoryApp{}
+	defer inv.AssertExpectations(t)
+	inv.On("UpsertAttributes", mock.Anything, model.DeviceID("dev-1"), mock.Anything).
+		Return(nil)
+
+	apih := makeMockApiHandlerWithConfig(t, &inv, &Config{
+		RedactedAttributes: []string{"token"},
+	})
+	req := test.MakeSimpleRequest("PATCH",
+		"http://1.2.3.4/api/internal/v1/inventory/tenants/foo/device/dev-1/attribute/scope/inventory",
+		[]map[string]interface{}{
+			{"name": "mac", "value": "00:11:22"},
+			{"name": "token", "value": "s3cr3t"},
 		})
+	runTestRequest(t, apih, req, JSONResponseParams{OutputStatus: http.StatusOK})
+
+	var logged []string
+	for _, entry := range hook.AllEntries() {
+		if strings.Contains(entry.Message, "attributes of device dev-1") {
+			logged = append(logged, entry.Message)
+		}
+	}
+	if assert.NotEmpty(t, logged) {
+		for _, msg := range logged {
+			assert.Contains(t, msg, "inventory/mac=00:11:22")
+			assert.Contains(t, msg, "inventory/token=[REDACTED]")
+			assert.NotContains(t, msg, "s3cr3t")
+		}
 	}
 }
 
-func TestApiInventoryInternalDevicesStatus(t *testing.T) {
+func TestApiInventoryInternalReindex(t *testing.T) {
 	t.Parallel()
 
-	rest.ErrorFieldName = "error"
+	testCases := map[string]struct {
+		tenantID    string
+		deviceID    string
+		serviceName string
 
-	tenantId := "5abcb6de7a673a0001287c71"
-	emptyTenant := ""
-	acceptedStatus := "accepted"
+		callsUpsertAttributes bool
+		upsertAttributesErr   error
 
-	testCases := map[string]struct {
-		// Let intputDevices be interface{} type in order to allow
-		// passing illegal request body values.
-		//inputDevices []model.DeviceUpdate
-		inputDevices interface{}
-		tenantID     string
-		status       string
-		*model.UpdateResult
+		callsCheckAlerts bool
+		alertsCount      int
+		checkAlertsError error
 
-		callsInventory bool
-		inventoryErr   error
+		deviceAttributes model.DeviceAttributes
+		config           *Config
 
 		resp JSONResponseParams
 	}{
-		"ok": {
-			inputDevices: []model.DeviceUpdate{
-				{Id: model.DeviceID(oid.NewUUIDv5("1").String()), Revision: 1},
-				{Id: model.DeviceID(oid.NewUUIDv5("2").String()), Revision: 1},
-				{Id: model.DeviceID(oid.NewUUIDv5("3").String()), Revision: 1},
+		"ok, alerts": {
+			tenantID:    "foo",
+			deviceID:    "bar",
+			serviceName: "devicemonitor",
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
 			},
-			tenantID: tenantId,
-			status:   acceptedStatus,
-			UpdateResult: &model.UpdateResult{
-				MatchedCount: 3,
-				UpdatedCount: 2,
+			callsUpsertAttributes: true,
+			callsCheckAlerts:      true,
+			alertsCount:           3,
+			deviceAttributes: model.DeviceAttributes{
+				{Name: model.AttrNameNumberOfAlerts, Value: 3, Scope: model.AttrScopeMonitor},
+				{Name: model.AttrNameAlerts, Value: true, Scope: model.AttrScopeMonitor},
 			},
+		},
+		"ok, no alerts": {
+			tenantID:    "foo",
+			deviceID:    "bar",
+			serviceName: "devicemonitor",
 			resp: JSONResponseParams{
 				OutputStatus: http.StatusOK,
-				OutputBodyObject: &model.UpdateResult{
-					MatchedCount: 3,
-					UpdatedCount: 2,
-				},
 			},
-			callsInventory: true,
-		},
-		"ok, noauth": {
-			inputDevices: []model.DeviceUpdate{
-				{Id: model.DeviceID(oid.NewUUIDv5("1").String()), Revision: 1},
-				{Id: model.DeviceID(oid.NewUUIDv5("2").String()), Revision: 1},
-				{Id: model.DeviceID(oid.NewUUIDv5("3").String()), Revision: 1},
+			callsUpsertAttributes: true,
+			callsCheckAlerts:      true,
+			alertsCount:           0,
+			deviceAttributes: model.DeviceAttributes{
+				{Name: model.AttrNameNumberOfAlerts, Value: 0, Scope: model.AttrScopeMonitor},
+				{Name: model.AttrNameAlerts, Value: false, Scope: model.AttrScopeMonitor},
 			},
-			tenantID: tenantId,
-			status:   "noauth",
-			UpdateResult: &model.UpdateResult{
-				MatchedCount: 3,
-				UpdatedCount: 2,
+		},
+		"ok, configured service scope": {
+			tenantID:    "foo",
+			deviceID:    "bar",
+			serviceName: "healthmonitor",
+			config: &Config{
+				ReindexServiceScopes: map[string]string{
+					"devicemonitor": model.AttrScopeMonitor,
+					"healthmonitor": "health",
+				},
 			},
 			resp: JSONResponseParams{
 				OutputStatus: http.StatusOK,
-				OutputBodyObject: &model.UpdateResult{
-					MatchedCount: 3,
-					UpdatedCount: 2,
-				},
 			},
-			callsInventory: true,
-		},
-
-		"ok single tenant": {
-			inputDevices: []model.DeviceUpdate{
-				{Id: model.DeviceID(oid.NewUUIDv5("1").String()), Revision: 1},
-				{Id: model.DeviceID(oid.NewUUIDv5("2").String()), Revision: 1},
+			callsUpsertAttributes: true,
+			callsCheckAlerts:      true,
+			alertsCount:           2,
+			deviceAttributes: model.DeviceAttributes{
+				{Name: model.AttrNameNumberOfAlerts, Value: 2, Scope: "health"},
+				{Name: model.AttrNameAlerts, Value: true, Scope: "health"},
 			},
-			tenantID: emptyTenant,
-			status:   acceptedStatus,
-			UpdateResult: &model.UpdateResult{
-				MatchedCount: 2,
-				UpdatedCount: 2,
+		},
+		"ok, devicemonitor with overridden scope": {
+			tenantID:    "foo",
+			deviceID:    "bar",
+			serviceName: "devicemonitor",
+			config: &Config{
+				ReindexServiceScopes: map[string]string{
+					"devicemonitor": "alerts",
+				},
 			},
 			resp: JSONResponseParams{
 				OutputStatus: http.StatusOK,
-				OutputBodyObject: &model.UpdateResult{
-					MatchedCount: 2,
-					UpdatedCount: 2,
-				},
 			},
-			callsInventory: true,
+			callsUpsertAttributes: true,
+			callsCheckAlerts:      true,
+			alertsCount:           0,
+			deviceAttributes: model.DeviceAttributes{
+				{Name: model.AttrNameNumberOfAlerts, Value: 0, Scope: "alerts"},
+				{Name: model.AttrNameAlerts, Value: false, Scope: "alerts"},
+			},
 		},
-		"error, payload empty": {
-			tenantID:     tenantId,
-			status:       acceptedStatus,
-			inputDevices: nil,
+		"wrong service, not configured": {
+			tenantID:    "foo",
+			deviceID:    "bar",
+			serviceName: "healthmonitor",
 			resp: JSONResponseParams{
 				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("cant parse devices: JSON payload is empty"),
+				OutputBodyObject: RestError("unsupported service"),
 			},
-			callsInventory: false,
 		},
-
-		"error, payload not expected": {
-			inputDevices: "sneaky wool carpet",
-			tenantID:     tenantId,
-			status:       acceptedStatus,
+		"wrong service": {
+			tenantID:    "foo",
+			deviceID:    "bar",
+			serviceName: "baz",
 			resp: JSONResponseParams{
 				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("cant parse devices: json: cannot unmarshal string into Go value of type []model.DeviceUpdate"),
+				OutputBodyObject: RestError("unsupported service"),
 			},
-			callsInventory: false,
 		},
-
-		"error, bad status": {
-			inputDevices: []model.DeviceUpdate{
-				{Id: model.DeviceID(oid.NewUUIDv5("1").String()), Revision: 1},
-				{Id: model.DeviceID(oid.NewUUIDv5("2").String()), Revision: 1},
-			},
-			tenantID: emptyTenant,
-			status:   "quo",
-			UpdateResult: &model.UpdateResult{
-				MatchedCount: 1,
-				UpdatedCount: 1,
-			},
+		"no device id": {
+			tenantID:    "foo",
+			serviceName: "baz",
 			resp: JSONResponseParams{
-				OutputStatus:     http.StatusNotFound,
-				OutputBodyObject: RestError("unrecognized status: quo"),
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("device id cannot be empty"),
 			},
-			callsInventory: false,
 		},
-
-		"error, db Upsert failed": {
-			inputDevices: []model.DeviceUpdate{
-				{Id: model.DeviceID(oid.NewUUIDv5("1").String()), Revision: 1},
-				{Id: model.DeviceID(oid.NewUUIDv5("2").String()), Revision: 1},
-			},
-			tenantID:     tenantId,
-			status:       acceptedStatus,
-			inventoryErr: errors.New("cant upsert"),
+		"ko, upsert attributes error": {
+			tenantID:              "foo",
+			deviceID:              "bar",
+			serviceName:           "devicemonitor",
+			callsCheckAlerts:      true,
+			alertsCount:           0,
+			callsUpsertAttributes: true,
+			upsertAttributesErr:   errors.New("upsert attributes error"),
 			resp: JSONResponseParams{
 				OutputStatus:     http.StatusInternalServerError,
 				OutputBodyObject: RestError("internal error"),
 			},
-			callsInventory: true,
 		},
-		"error, conflict": {
-			inputDevices: []model.DeviceUpdate{
-				{Id: model.DeviceID(oid.NewUUIDv5("1").String()), Revision: 1},
-				{Id: model.DeviceID(oid.NewUUIDv5("2").String()), Revision: 1},
-			},
-			tenantID:     tenantId,
-			status:       acceptedStatus,
-			inventoryErr: store.ErrWriteConflict,
+		"ko, check allerts error": {
+			tenantID:         "foo",
+			deviceID:         "bar",
+			serviceName:      "devicemonitor",
+			callsCheckAlerts: true,
+			checkAlertsError: errors.New("check allerts error"),
 			resp: JSONResponseParams{
-				OutputStatus:     http.StatusConflict,
-				OutputBodyObject: RestError("write conflict"),
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
 			},
-			callsInventory: true,
 		},
 	}
 
@@ -2879,39 +9096,38 @@ func TestApiInventoryInternalDevicesStatus(t *testing.T) {
 			var (
 				inReq = test.MakeSimpleRequest("POST",
 					"http://1.2.3.4/api/internal/v1/inventory/tenants/"+
-						tc.tenantID+"/devices/status/"+tc.status,
-					tc.inputDevices,
+						tc.tenantID+"/devices/"+tc.deviceID+"/reindex?service="+tc.serviceName,
+					nil,
 				)
-				deviceAttributes = model.DeviceAttributes{{
-					Name:  "status",
-					Value: tc.status,
-					Scope: model.AttrScopeIdentity,
-				}}
 			)
 
 			inv := minventory.InventoryApp{}
 			ctx := contextMatcher()
 
-			if tc.callsInventory {
-				switch tc.status {
-				case "accepted", "preauthorized", "pending", "noauth":
-					// Update statuses
-					inv.On("UpsertDevicesStatuses",
-						ctx,
-						tc.inputDevices,
-						deviceAttributes,
-					).Return(tc.UpdateResult, tc.inventoryErr)
-
-				case "decommissioned":
-					// Delete Inventory
-					inv.On("DeleteDevices",
-						ctx,
-						getIdsFromDevices(tc.inputDevices.([]model.DeviceUpdate)),
-					).Return(tc.UpdateResult, tc.inventoryErr)
-				}
+			if tc.callsUpsertAttributes {
+				inv.On("UpsertAttributes",
+					ctx,
+					mock.AnythingOfType("model.DeviceID"),
+					mock.MatchedBy(
+						func(attrs model.DeviceAttributes) bool {
+							if tc.deviceAttributes != nil {
+								if !reflect.DeepEqual(tc.deviceAttributes, attrs) {
+									assert.FailNow(t, "", "attributes not equal: %v \n%v\n", tc.deviceAttributes, attrs)
+								}
+							}
+							return true
+						},
+					),
+				).Return(tc.upsertAttributesErr)
+			}
+			if tc.callsCheckAlerts {
+				inv.On("CheckAlerts",
+					ctx,
+					tc.deviceID,
+				).Return(tc.alertsCount, tc.checkAlertsError)
 			}
 
-			apih := makeMockApiHandler(t, &inv)
+			apih := makeMockApiHandlerWithConfig(t, &inv, tc.config)
 
 			rest.ErrorFieldName = "error"
 
@@ -2922,978 +9138,841 @@ func TestApiInventoryInternalDevicesStatus(t *testing.T) {
 	}
 }
 
-func TestApiInventoryFiltersAttributes(t *testing.T) {
+func TestApiInventoryInternalToggleDeviceAttribute(t *testing.T) {
+	t.Parallel()
+
+	const url = "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/1/attributes"
+
 	testCases := map[string]struct {
-		attributes []model.FilterAttribute
-		err        error
-		httpCode   int
+		url  string
+		body interface{}
+
+		toggle       bool
+		scope        string
+		defaultValue bool
+		value        bool
+		toggleErr    error
+
+		resp JSONResponseParams
 	}{
 		"ok": {
-			attributes: []model.FilterAttribute{
-				{
-					Name:  "name",
-					Scope: "scope",
-					Count: 100,
+			url:    url + "/tags/maintenance/toggle",
+			toggle: true,
+			scope:  model.AttrScopeTags,
+			value:  true,
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+				OutputBodyObject: model.DeviceAttribute{
+					Name:  "maintenance",
+					Scope: model.AttrScopeTags,
+					Value: true,
 				},
-				{
-					Name:  "other_name",
-					Scope: "scope",
-					Count: 90,
+			},
+		},
+		"ok, default value": {
+			url:          url + "/tags/maintenance/toggle",
+			body:         map[string]interface{}{"default": true},
+			toggle:       true,
+			scope:        model.AttrScopeTags,
+			defaultValue: true,
+			value:        true,
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+				OutputBodyObject: model.DeviceAttribute{
+					Name:  "maintenance",
+					Scope: model.AttrScopeTags,
+					Value: true,
 				},
 			},
-			httpCode: http.StatusOK,
 		},
-		"ok, no attributes": {
-			attributes: nil,
-			httpCode:   http.StatusOK,
+		"ok, scope alias": {
+			url:    url + "/inv/maintenance/toggle",
+			toggle: true,
+			scope:  model.AttrScopeInventory,
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusOK,
+				OutputBodyObject: model.DeviceAttribute{
+					Name:  "maintenance",
+					Scope: model.AttrScopeInventory,
+					Value: false,
+				},
+			},
 		},
-		"ko": {
-			err:      errors.New("error"),
-			httpCode: http.StatusInternalServerError,
+		"ko, system scope": {
+			url: url + "/system/maintenance/toggle",
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError(
+					"the attributes of the system scope cannot be toggled"),
+			},
+		},
+		"ko, malformed body": {
+			url:  url + "/tags/maintenance/toggle",
+			body: map[string]interface{}{"default": "yes"},
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError("failed to decode request body: " +
+					"json: cannot unmarshal string into Go struct field " +
+					"InventoryApiToggleAttribute.default of type bool"),
+			},
+		},
+		"ko, device not found": {
+			url:       url + "/tags/maintenance/toggle",
+			toggle:    true,
+			scope:     model.AttrScopeTags,
+			toggleErr: store.ErrDevNotFound,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusNotFound,
+				OutputBodyObject: RestError(store.ErrDevNotFound.Error()),
+			},
+		},
+		"ko, not a boolean": {
+			url:    url + "/tags/maintenance/toggle",
+			toggle: true,
+			scope:  model.AttrScopeTags,
+			toggleErr: errors.Wrap(store.ErrAttributeTypeConflict,
+				"failed to toggle the attribute in db"),
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusUnprocessableEntity,
+				OutputBodyObject: RestError("failed to toggle the attribute in db: " +
+					store.ErrAttributeTypeConflict.Error()),
+			},
+		},
+		"ko, internal error": {
+			url:       url + "/tags/maintenance/toggle",
+			toggle:    true,
+			scope:     model.AttrScopeTags,
+			toggleErr: errors.New("db error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
 		},
 	}
 
 	for name, tc := range testCases {
 		t.Run(name, func(t *testing.T) {
 			inv := minventory.InventoryApp{}
-			inv.On("GetFiltersAttributes",
-				contextMatcher(),
-			).Return(tc.attributes, tc.err)
+			defer inv.AssertExpectations(t)
+
+			if tc.toggle {
+				ctx := mock.MatchedBy(func(ctx context.Context) bool {
+					id := identity.FromContext(ctx)
+					return id != nil && id.Tenant == "foo"
+				})
+				inv.On("ToggleAttribute",
+					ctx, model.DeviceID("1"), tc.scope, "maintenance", tc.defaultValue,
+				).Return(tc.value, tc.toggleErr)
+			}
 
-			api := makeMockApiHandler(t, &inv)
-			req, _ := http.NewRequest("GET", "http://localhost"+urlFiltersAttributes, nil)
-			recorded := test.RunRequest(t, api, req)
+			config := NewConfig()
+			config.ScopeAliases = map[string]string{"inv": model.AttrScopeInventory}
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
+			rest.ErrorFieldName = "error"
 
-			recorded.CodeIs(tc.httpCode)
-			if tc.httpCode == http.StatusOK {
-				if tc.attributes == nil {
-					tc.attributes = []model.FilterAttribute{}
-				}
-				body, _ := json.Marshal(tc.attributes)
-				recorded.BodyIs(string(body))
-			}
+			req := test.MakeSimpleRequest("POST", tc.url, tc.body)
+			runTestRequest(t, apih, req, tc.resp)
 		})
 	}
 }
 
-func TestApiInventorySearchDevices(t *testing.T) {
+func TestApiInventoryInternalMoveDeviceAttributes(t *testing.T) {
 	t.Parallel()
 	rest.ErrorFieldName = "error"
 
+	const url = "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/1/attributes/move"
+
 	testCases := map[string]struct {
-		listDevicesNum  int
-		listDevicesErr  error
-		listDeviceTotal int
-		inReq           *http.Request
-		resp            JSONResponseParams
+		body interface{}
+
+		move    bool
+		from    string
+		to      string
+		policy  string
+		moveErr error
+
+		resp JSONResponseParams
 	}{
-		"valid pagination, no next page": {
-			listDevicesNum:  5,
-			listDevicesErr:  nil,
-			listDeviceTotal: 20,
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/management/v2/inventory/filters/search",
-				model.SearchParams{
-					Page:    4,
-					PerPage: 5,
-				},
-			),
+		"ok": {
+			body: map[string]interface{}{
+				"from":   "monitor",
+				"to":     "inventory",
+				"policy": "keep",
+			},
+			move:   true,
+			from:   model.AttrScopeMonitor,
+			to:     model.AttrScopeInventory,
+			policy: model.MergePolicyKeep,
 			resp: JSONResponseParams{
-				OutputStatus:     200,
-				OutputBodyObject: mockListDevices(5),
-				OutputHeaders: map[string][]string{
-					hdrTotalCount: {"20"},
-				},
+				OutputStatus: http.StatusNoContent,
+			},
+		},
+		"ok, default policy, scope alias": {
+			body: map[string]interface{}{
+				"from": "monitor",
+				"to":   "inv",
+			},
+			move:   true,
+			from:   model.AttrScopeMonitor,
+			to:     model.AttrScopeInventory,
+			policy: model.MergePolicyOverwrite,
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusNoContent,
+			},
+		},
+		"ko, same scope": {
+			body: map[string]interface{}{
+				"from": "inventory",
+				"to":   "inv",
+			},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("to: must not be in list."),
+			},
+		},
+		"ko, system scope": {
+			body: map[string]interface{}{
+				"from": "system",
+				"to":   "inventory",
+			},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("from: must not be in list."),
+			},
+		},
+		"ko, unknown policy": {
+			body: map[string]interface{}{
+				"from":   "monitor",
+				"to":     "inventory",
+				"policy": "merge",
+			},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("policy: must be a valid value."),
+			},
+		},
+		"ko, device not found": {
+			body: map[string]interface{}{
+				"from": "monitor",
+				"to":   "inventory",
+			},
+			move:    true,
+			from:    model.AttrScopeMonitor,
+			to:      model.AttrScopeInventory,
+			policy:  model.MergePolicyOverwrite,
+			moveErr: errors.Wrap(store.ErrDevNotFound, "failed to move the attributes in db"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusNotFound,
+				OutputBodyObject: RestError(store.ErrDevNotFound.Error()),
+			},
+		},
+		"ko, internal error": {
+			body: map[string]interface{}{
+				"from": "monitor",
+				"to":   "inventory",
+			},
+			move:    true,
+			from:    model.AttrScopeMonitor,
+			to:      model.AttrScopeInventory,
+			policy:  model.MergePolicyOverwrite,
+			moveErr: errors.New("db error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
 			},
 		},
-		"valid pagination, with next page": {
-			listDevicesNum:  5,
-			listDevicesErr:  nil,
-			listDeviceTotal: 21,
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/management/v2/inventory/filters/search",
-				model.SearchParams{
-					Page:    4,
-					PerPage: 5,
-				},
-			),
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.move {
+				ctx := mock.MatchedBy(func(ctx context.Context) bool {
+					id := identity.FromContext(ctx)
+					return id != nil && id.Tenant == "foo"
+				})
+				inv.On("MoveAttributesBetweenScopes",
+					ctx, model.DeviceID("1"), tc.from, tc.to, tc.policy,
+				).Return(tc.moveErr)
+			}
+
+			config := NewConfig()
+			config.ScopeAliases = map[string]string{"inv": model.AttrScopeInventory}
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+			req := test.MakeSimpleRequest("POST", url, tc.body)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryInternalGetDevicesWithStaleScope(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const url = "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/stale"
+
+	testCases := map[string]struct {
+		url string
+
+		get     bool
+		scope   string
+		devices []model.Device
+		getErr  error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			url:     url + "/monitor?older_than=1h",
+			get:     true,
+			scope:   model.AttrScopeMonitor,
+			devices: mockListDevices(2),
 			resp: JSONResponseParams{
-				OutputStatus:     200,
-				OutputBodyObject: mockListDevices(5),
-				OutputHeaders: map[string][]string{
-					hdrTotalCount: {"21"},
-				},
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: mockListDevices(2),
 			},
 		},
-		"valid filter and sort": {
-			listDevicesNum:  5,
-			listDevicesErr:  nil,
-			listDeviceTotal: 21,
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/management/v2/inventory/filters/search",
-				model.SearchParams{
-					Page:    4,
-					PerPage: 5,
-					Filters: []model.FilterPredicate{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Type:      "$eq",
-							Value:     "bar",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Type:      "$eq",
-							Value:     "baz",
-						},
-					},
-					Sort: []model.SortCriteria{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Order:     "asc",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Order:     "desc",
-						},
-					},
-				},
-			),
+		"ok, scope alias": {
+			url:     url + "/inv?older_than=1h",
+			get:     true,
+			scope:   model.AttrScopeInventory,
+			devices: []model.Device{},
 			resp: JSONResponseParams{
-				OutputStatus:     200,
-				OutputBodyObject: mockListDevices(5),
-				OutputHeaders: map[string][]string{
-					hdrTotalCount: {"21"},
-				},
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: []model.Device{},
 			},
 		},
-		"invalid filter": {
-			listDevicesNum:  5,
-			listDevicesErr:  nil,
-			listDeviceTotal: 21,
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/management/v2/inventory/filters/search",
-				model.SearchParams{
-					Page:    4,
-					PerPage: 5,
-					Filters: []model.FilterPredicate{
-						{},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Type:      "$eq",
-							Value:     "baz",
-						},
-					},
-					Sort: []model.SortCriteria{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Order:     "asc",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Order:     "desc",
-						},
-					},
-				},
-			),
+		"ko, missing older_than": {
+			url: url + "/monitor",
 			resp: JSONResponseParams{
-				OutputStatus:     400,
-				OutputBodyObject: RestError("attribute: cannot be blank; scope: cannot be blank; type: cannot be blank; value: is required."),
-				OutputHeaders:    nil,
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError(
+					utils.MsgQueryParmMissing(queryParamOlderThan)),
 			},
 		},
-		"invalid sort": {
-			listDevicesNum:  5,
-			listDevicesErr:  nil,
-			listDeviceTotal: 21,
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/management/v2/inventory/filters/search",
-				model.SearchParams{
-					Page:    4,
-					PerPage: 5,
-					Filters: []model.FilterPredicate{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Type:      "$eq",
-							Value:     "bar",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Type:      "$eq",
-							Value:     "baz",
-						},
-					},
-					Sort: []model.SortCriteria{
-						{},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Order:     "desc",
-						},
-					},
-				},
-			),
+		"ko, invalid older_than": {
+			url: url + "/monitor?older_than=-1h",
 			resp: JSONResponseParams{
-				OutputStatus:     400,
-				OutputBodyObject: RestError("attribute: cannot be blank; order: cannot be blank; scope: cannot be blank."),
-				OutputHeaders:    nil,
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError(
+					utils.MsgQueryParmInvalid(queryParamOlderThan)),
 			},
 		},
-		"inventory error": {
-			listDevicesNum:  5,
-			listDevicesErr:  errors.New("inventory error"),
-			listDeviceTotal: 21,
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/management/v2/inventory/filters/search",
-				model.SearchParams{
-					Page:    4,
-					PerPage: 5,
-					Filters: []model.FilterPredicate{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Type:      "$eq",
-							Value:     "bar",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Type:      "$eq",
-							Value:     "baz",
-						},
-					},
-					Sort: []model.SortCriteria{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Order:     "asc",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Order:     "desc",
-						},
-					},
-				},
-			),
+		"ko, internal error": {
+			url:    url + "/monitor?older_than=1h",
+			get:    true,
+			scope:  model.AttrScopeMonitor,
+			getErr: errors.New("db error"),
 			resp: JSONResponseParams{
-				OutputStatus:     500,
+				OutputStatus:     http.StatusInternalServerError,
 				OutputBodyObject: RestError("internal error"),
-				OutputHeaders:    nil,
 			},
 		},
-		"inventory error, BadValue": {
-			listDevicesNum:  5,
-			listDevicesErr:  errors.New("inventory error: BadValue"),
-			listDeviceTotal: 21,
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/management/v2/inventory/filters/search",
-				model.SearchParams{
-					Page:    4,
-					PerPage: 5,
-					Filters: []model.FilterPredicate{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Type:      "$eq",
-							Value:     "bar",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Type:      "$eq",
-							Value:     "baz",
-						},
-					},
-					Sort: []model.SortCriteria{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Order:     "asc",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Order:     "desc",
-						},
-					},
-				},
-			),
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.get {
+				ctx := mock.MatchedBy(func(ctx context.Context) bool {
+					id := identity.FromContext(ctx)
+					return id != nil && id.Tenant == "foo"
+				})
+				inv.On("GetDevicesWithStaleScope", ctx, tc.scope, time.Hour).
+					Return(tc.devices, tc.getErr)
+			}
+
+			config := NewConfig()
+			config.ScopeAliases = map[string]string{"inv": model.AttrScopeInventory}
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+			req := test.MakeSimpleRequest("GET", tc.url, nil)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
+
+func TestApiInventoryInternalGetDevicesUpdatedByScopeSince(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const url = "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/updated"
+	since := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		url string
+
+		get     bool
+		scope   string
+		devices []model.Device
+		getErr  error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			url:     url + "/monitor?since=2026-01-01T10:00:00Z",
+			get:     true,
+			scope:   model.AttrScopeMonitor,
+			devices: mockListDevices(2),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: mockListDevices(2),
+			},
+		},
+		"ok, scope alias": {
+			url:     url + "/inv?since=2026-01-01T10:00:00Z",
+			get:     true,
+			scope:   model.AttrScopeInventory,
+			devices: []model.Device{},
 			resp: JSONResponseParams{
-				OutputStatus:     400,
-				OutputBodyObject: RestError("inventory error: BadValue"),
-				OutputHeaders:    nil,
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: []model.Device{},
 			},
 		},
-		"valid": {
-			listDevicesNum:  5,
-			listDevicesErr:  nil,
-			listDeviceTotal: 21,
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/management/v2/inventory/filters/search",
-				model.SearchParams{
-					Page:    4,
-					PerPage: 5,
-					Filters: []model.FilterPredicate{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Type:      "$eq",
-							Value:     "bar",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Type:      "$eq",
-							Value:     "baz",
-						},
-					},
-					Sort: []model.SortCriteria{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Order:     "asc",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Order:     "desc",
-						},
-					},
-				},
-			),
+		"ko, missing since": {
+			url: url + "/monitor",
 			resp: JSONResponseParams{
-				OutputStatus:     200,
-				OutputBodyObject: mockListDevices(5),
-				OutputHeaders: map[string][]string{
-					hdrTotalCount: {"21"},
-				},
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError(
+					utils.MsgQueryParmMissing(queryParamSince)),
+			},
+		},
+		"ko, invalid since": {
+			url: url + "/monitor?since=yesterday",
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError(
+					utils.MsgQueryParmInvalid(queryParamSince)),
+			},
+		},
+		"ko, internal error": {
+			url:    url + "/monitor?since=2026-01-01T10:00:00Z",
+			get:    true,
+			scope:  model.AttrScopeMonitor,
+			getErr: errors.New("db error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
 			},
 		},
 	}
 
-	for name, testCase := range testCases {
-		t.Logf("test case: %s", name)
-		inv := minventory.InventoryApp{}
-
-		ctx := contextMatcher()
-
-		inv.On("SearchDevices",
-			ctx,
-			mock.AnythingOfType("model.SearchParams"),
-		).Return(mockListDevices(testCase.listDevicesNum), testCase.listDeviceTotal, testCase.listDevicesErr)
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.get {
+				ctx := mock.MatchedBy(func(ctx context.Context) bool {
+					id := identity.FromContext(ctx)
+					return id != nil && id.Tenant == "foo"
+				})
+				inv.On("GetDevicesUpdatedByScopeSince", ctx, tc.scope,
+					mock.MatchedBy(func(t time.Time) bool {
+						return t.Equal(since)
+					}),
+				).Return(tc.devices, tc.getErr)
+			}
 
-		apih := makeMockApiHandler(t, &inv)
+			config := NewConfig()
+			config.ScopeAliases = map[string]string{"inv": model.AttrScopeInventory}
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
 
-		runTestRequest(t, apih, testCase.inReq, testCase.resp)
+			req := test.MakeSimpleRequest("GET", tc.url, nil)
+			runTestRequest(t, apih, req, tc.resp)
+		})
 	}
 }
 
-func TestApiParseSearchParams(t *testing.T) {
+func TestApiInventoryInternalSampleDevices(t *testing.T) {
 	t.Parallel()
+	rest.ErrorFieldName = "error"
+
+	const url = "http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/sample"
+
+	filters := []model.FilterPredicate{{
+		Scope:     model.AttrScopeInventory,
+		Attribute: "device_type",
+		Type:      "$eq",
+		Value:     "rpi4",
+	}}
 
 	testCases := map[string]struct {
-		inReq        *http.Request
-		searchParams *model.SearchParams
-		err          error
+		body interface{}
+
+		sample    bool
+		size      int
+		filters   []model.FilterPredicate
+		devices   []model.Device
+		sampleErr error
+
+		resp JSONResponseParams
 	}{
 		"ok": {
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/management/v2/inventory/filters/search",
-				model.SearchParams{
-					Page:    4,
-					PerPage: 5,
-					Filters: []model.FilterPredicate{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Type:      "$eq",
-							Value:     "bar",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Type:      "$eq",
-							Value:     "baz",
-						},
-					},
-					Sort: []model.SortCriteria{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Order:     "asc",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Order:     "desc",
-						},
-					},
-				},
-			),
-			searchParams: &model.SearchParams{
-				Page:    4,
-				PerPage: 5,
-				Filters: []model.FilterPredicate{
-					{
-						Scope:     "inventory",
-						Attribute: "foo",
-						Type:      "$eq",
-						Value:     "bar",
-					},
-					{
-						Scope:     "inventory",
-						Attribute: "foo1",
-						Type:      "$eq",
-						Value:     "baz",
-					},
-				},
-				Sort: []model.SortCriteria{
-					{
-						Scope:     "inventory",
-						Attribute: "foo",
-						Order:     "asc",
-					},
-					{
-						Scope:     "inventory",
-						Attribute: "foo1",
-						Order:     "desc",
-					},
-				},
-			},
-		},
-		"ok: all filter types and sort orders": {
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/management/v2/inventory/filters/search",
-				model.SearchParams{
-					Page:    4,
-					PerPage: 5,
-					Filters: []model.FilterPredicate{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Type:      "$eq",
-							Value:     "bar",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Type:      "$eq",
-							Value:     5,
-						},
-					},
-					Sort: []model.SortCriteria{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Order:     "asc",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Order:     "desc",
-						},
-					},
-				},
-			),
-			searchParams: &model.SearchParams{
-				Page:    4,
-				PerPage: 5,
-				Filters: []model.FilterPredicate{
-					{
-						Scope:     "inventory",
-						Attribute: "foo",
-						Type:      "$eq",
-						Value:     "bar",
-					},
-					{
-						Scope:     "inventory",
-						Attribute: "foo1",
-						Type:      "$eq",
-						Value:     float64(5),
-					},
-				},
-				Sort: []model.SortCriteria{
-					{
-						Scope:     "inventory",
-						Attribute: "foo",
-						Order:     "asc",
-					},
-					{
-						Scope:     "inventory",
-						Attribute: "foo1",
-						Order:     "desc",
-					},
-				},
+			body: map[string]interface{}{
+				"size": 2,
+				"filters": []map[string]interface{}{{
+					"scope":     "inv",
+					"attribute": "device_type",
+					"type":      "$eq",
+					"value":     "rpi4",
+				}},
+			},
+			sample:  true,
+			size:    2,
+			filters: filters,
+			devices: mockListDevices(2),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: mockListDevices(2),
 			},
 		},
-		"invalid Page and perPage": {
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/management/v2/inventory/filters/search",
-				model.SearchParams{
-					Page:    -3,
-					PerPage: 0,
-					Filters: []model.FilterPredicate{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Type:      "$eq",
-							Value:     "bar",
-						},
-					},
-					Sort: []model.SortCriteria{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Order:     "asc",
-						},
-					},
-				},
-			),
-			searchParams: &model.SearchParams{
-				Page:    utils.PageDefault,
-				PerPage: utils.PerPageDefault,
-				Filters: []model.FilterPredicate{
-					{
-						Scope:     "inventory",
-						Attribute: "foo",
-						Type:      "$eq",
-						Value:     "bar",
-					},
-				},
-				Sort: []model.SortCriteria{
-					{
-						Scope:     "inventory",
-						Attribute: "foo",
-						Order:     "asc",
-					},
-				},
+		"ok, no filters": {
+			body:    map[string]interface{}{"size": 3},
+			sample:  true,
+			size:    3,
+			devices: []model.Device{},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: []model.Device{},
 			},
 		},
-		"wrong sort order": {
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/management/v2/inventory/filters/search",
-				model.SearchParams{
-					Page:    4,
-					PerPage: 5,
-					Sort: []model.SortCriteria{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Order:     "foo",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Order:     "desc",
-						},
-					},
-				},
-			),
-			err: errors.New("order: must be a valid value."),
+		"ko, missing size": {
+			body: map[string]interface{}{"filters": filters},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("size: cannot be blank."),
+			},
 		},
-		"wrong filter type": {
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/management/v2/inventory/filters/search",
-				model.SearchParams{
-					Page:    4,
-					PerPage: 5,
-					Filters: []model.FilterPredicate{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Type:      "$eq",
-							Value:     "bar",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Type:      "$neq",
-							Value:     "baz",
-						},
-					},
-				},
-			),
-			err: errors.New("type: must be a valid value."),
+		"ko, size too large": {
+			body: map[string]interface{}{"size": utils.PerPageMax + 1},
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError(
+					"size: must be no greater than 500."),
+			},
 		},
-		"invalid JSON": {
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/management/v2/inventory/filters/search",
-				"invalid json",
-			),
-			err: errors.New("failed to decode request body: json: cannot unmarshal string into Go value of type model.SearchParams"),
+		"ko, invalid filter": {
+			body: map[string]interface{}{
+				"size": 2,
+				"filters": []map[string]interface{}{{
+					"scope":     "inventory",
+					"attribute": "device_type",
+					"type":      "$foo",
+					"value":     "rpi4",
+				}},
+			},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("filters: (0: (type: must be a valid value.).)."),
+			},
+		},
+		"ko, internal error": {
+			body:      map[string]interface{}{"size": 2},
+			sample:    true,
+			size:      2,
+			sampleErr: errors.New("db error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
 		},
 	}
 
 	for name, tc := range testCases {
-		t.Run(fmt.Sprintf("test case: %s", name), func(t *testing.T) {
-			req := rest.Request{Request: tc.inReq}
-			params, err := parseSearchParams(&req)
-			if tc.err != nil {
-				assert.EqualError(t, tc.err, err.Error())
-			} else {
-				assert.NoError(t, err)
-				assert.NotNil(t, params)
-				assert.NotEmpty(t, params)
-
-				assert.Equal(t, tc.searchParams, params)
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.sample {
+				ctx := mock.MatchedBy(func(ctx context.Context) bool {
+					id := identity.FromContext(ctx)
+					return id != nil && id.Tenant == "foo"
+				})
+				inv.On("SampleDevices", ctx, tc.size, tc.filters).
+					Return(tc.devices, tc.sampleErr)
 			}
+
+			config := NewConfig()
+			config.ScopeAliases = map[string]string{"inv": model.AttrScopeInventory}
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
+
+			req := test.MakeSimpleRequest("POST", url, tc.body)
+			runTestRequest(t, apih, req, tc.resp)
 		})
 	}
 }
 
-func TestApiInventoryInternalSearchDevices(t *testing.T) {
+func TestApiInventoryInternalReplaceAllDeviceAttributes(t *testing.T) {
 	t.Parallel()
-	rest.ErrorFieldName = "error"
+
+	attrs := []map[string]interface{}{
+		{"name": "mac", "value": "00:11", "scope": model.AttrScopeIdentity},
+		{"name": "os", "value": "linux", "scope": model.AttrScopeInventory},
+		{"name": "room", "value": "2", "scope": model.AttrScopeTags},
+	}
+	deviceAttrs := model.DeviceAttributes{
+		{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+		{Name: "os", Value: "linux", Scope: model.AttrScopeInventory},
+		{Name: "room", Value: "2", Scope: model.AttrScopeTags},
+	}
 
 	testCases := map[string]struct {
-		listDevicesNum  int
-		listDevicesErr  error
-		listDeviceTotal int
-		inReq           *http.Request
-		resp            JSONResponseParams
+		body interface{}
+
+		replace    bool
+		replaceErr error
+
+		resp JSONResponseParams
 	}{
-		"valid filter and sort": {
-			listDevicesNum:  5,
-			listDevicesErr:  nil,
-			listDeviceTotal: 21,
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v2/inventory/tenants/foo/filters/search",
-				model.SearchParams{
-					Page:    4,
-					PerPage: 5,
-					Filters: []model.FilterPredicate{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Type:      "$eq",
-							Value:     "bar",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Type:      "$eq",
-							Value:     "baz",
-						},
-					},
-					Sort: []model.SortCriteria{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Order:     "asc",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Order:     "desc",
-						},
-					},
-				},
-			),
+		"ok": {
+			body:    attrs,
+			replace: true,
 			resp: JSONResponseParams{
-				OutputStatus:     200,
-				OutputBodyObject: mockListDevices(5),
-				OutputHeaders: map[string][]string{
-					hdrTotalCount: {"21"},
-				},
+				OutputStatus: http.StatusNoContent,
 			},
 		},
-		"valid filter and sort no tenant": {
-			listDevicesNum:  5,
-			listDevicesErr:  nil,
-			listDeviceTotal: 21,
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v2/inventory/tenants//filters/search",
-				model.SearchParams{
-					Page:    4,
-					PerPage: 5,
-					Filters: []model.FilterPredicate{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Type:      "$eq",
-							Value:     "bar",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Type:      "$eq",
-							Value:     "baz",
-						},
-					},
-					Sort: []model.SortCriteria{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Order:     "asc",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Order:     "desc",
-						},
-					},
-				},
-			),
+		"ko, system scope": {
+			body: append([]map[string]interface{}{{
+				"name": model.AttrNameGroup, "value": "grp", "scope": model.AttrScopeSystem,
+			}}, attrs...),
 			resp: JSONResponseParams{
-				OutputStatus:     200,
-				OutputBodyObject: mockListDevices(5),
-				OutputHeaders: map[string][]string{
-					hdrTotalCount: {"21"},
-				},
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError(
+					"the attributes of the system scope cannot be replaced"),
 			},
 		},
-		"invalid filter": {
-			listDevicesNum:  5,
-			listDevicesErr:  nil,
-			listDeviceTotal: 21,
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v2/inventory/tenants/foo/filters/search",
-				model.SearchParams{
-					Page:    4,
-					PerPage: 5,
-					Filters: []model.FilterPredicate{
-						{},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Type:      "$eq",
-							Value:     "baz",
-						},
-					},
-					Sort: []model.SortCriteria{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Order:     "asc",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Order:     "desc",
-						},
-					},
-				},
-			),
+		"ko, missing name": {
+			body: []map[string]interface{}{{"value": "00:11", "scope": "identity"}},
 			resp: JSONResponseParams{
-				OutputStatus:     400,
-				OutputBodyObject: RestError("attribute: cannot be blank; scope: cannot be blank; type: cannot be blank; value: is required."),
-				OutputHeaders:    nil,
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("name: cannot be blank."),
 			},
 		},
-		"inventory error": {
-			listDevicesNum:  5,
-			listDevicesErr:  errors.New("inventory error"),
-			listDeviceTotal: 21,
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v2/inventory/tenants/foo/filters/search",
-				model.SearchParams{
-					Page:    4,
-					PerPage: 5,
-					Filters: []model.FilterPredicate{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Type:      "$eq",
-							Value:     "bar",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Type:      "$eq",
-							Value:     "baz",
-						},
-					},
-					Sort: []model.SortCriteria{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Order:     "asc",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Order:     "desc",
-						},
-					},
-				},
-			),
+		"ko, device not found": {
+			body:       attrs,
+			replace:    true,
+			replaceErr: store.ErrDevNotFound,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusNotFound,
+				OutputBodyObject: RestError(store.ErrDevNotFound.Error()),
+			},
+		},
+		"ko, too many attributes": {
+			body:       attrs,
+			replace:    true,
+			replaceErr: inventory.ErrTooManyAttributes,
 			resp: JSONResponseParams{
-				OutputStatus:     500,
-				OutputBodyObject: RestError("internal error"),
-				OutputHeaders:    nil,
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError(inventory.ErrTooManyAttributes.Error()),
 			},
 		},
-		"inventory error, BadValue": {
-			listDevicesNum:  5,
-			listDevicesErr:  errors.New("inventory error: BadValue"),
-			listDeviceTotal: 21,
-			inReq: test.MakeSimpleRequest("POST",
-				"http://1.2.3.4/api/internal/v2/inventory/tenants/foo/filters/search",
-				model.SearchParams{
-					Page:    4,
-					PerPage: 5,
-					Filters: []model.FilterPredicate{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Type:      "$eq",
-							Value:     "bar",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Type:      "$eq",
-							Value:     "baz",
-						},
-					},
-					Sort: []model.SortCriteria{
-						{
-							Scope:     "inventory",
-							Attribute: "foo",
-							Order:     "asc",
-						},
-						{
-							Scope:     "inventory",
-							Attribute: "foo1",
-							Order:     "desc",
-						},
-					},
-				},
-			),
+		"ko, internal error": {
+			body:       attrs,
+			replace:    true,
+			replaceErr: errors.New("db error"),
 			resp: JSONResponseParams{
-				OutputStatus:     400,
-				OutputBodyObject: RestError("inventory error: BadValue"),
-				OutputHeaders:    nil,
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
 			},
 		},
 	}
 
-	for name, testCase := range testCases {
-		t.Logf("test case: %s", name)
-		inv := minventory.InventoryApp{}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+
+			if tc.replace {
+				ctx := mock.MatchedBy(func(ctx context.Context) bool {
+					id := identity.FromContext(ctx)
+					return id != nil && id.Tenant == "foo"
+				})
+				inv.On("ReplaceAllAttributes", ctx, model.DeviceID("1"), deviceAttrs).
+					Return(tc.replaceErr)
+			}
 
-		ctx := contextMatcher()
+			apih := makeMockApiHandler(t, &inv)
+			rest.ErrorFieldName = "error"
 
-		inv.On("SearchDevices",
-			ctx,
-			mock.AnythingOfType("model.SearchParams"),
-		).Return(mockListDevices(testCase.listDevicesNum), testCase.listDeviceTotal, testCase.listDevicesErr)
+			req := test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/internal/v1/inventory/tenants/foo/devices/1/attributes",
+				tc.body,
+			)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
 
-		apih := makeMockApiHandler(t, &inv)
+func TestApiInventoryGetDevicesBatch(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
 
-		runTestRequest(t, apih, testCase.inReq, testCase.resp)
+	tooMany := make([]string, devicesBatchMax+1)
+	for i := range tooMany {
+		tooMany[i] = strconv.Itoa(i)
 	}
-}
+	devices := []model.Device{{ID: "2"}, {ID: "1"}}
 
-func makeReq(method, url, auth string, body interface{}) *http.Request {
-	req := test.MakeSimpleRequest(method, url, body)
+	testCases := map[string]struct {
+		body interface{}
 
-	if auth != "" {
-		req.Header.Set("Authorization", auth)
+		ids     []model.DeviceID
+		devices []model.Device
+		err     error
+
+		resp JSONResponseParams
+	}{
+		"ok": {
+			body:    []string{"2", "3", "1"},
+			ids:     []model.DeviceID{"2", "3", "1"},
+			devices: devices,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: devices,
+			},
+		},
+		"ok, no devices found": {
+			body:    []string{"3"},
+			ids:     []model.DeviceID{"3"},
+			devices: []model.Device{},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: []model.Device{},
+			},
+		},
+		"ko, empty list": {
+			body: []string{},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("no device IDs present in payload"),
+			},
+		},
+		"ko, too many device IDs": {
+			body: tooMany,
+			resp: JSONResponseParams{
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError(
+					"too many device IDs: the limit is " + strconv.Itoa(devicesBatchMax)),
+			},
+		},
+		"ko, empty device ID": {
+			body: []string{"1", ""},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusBadRequest,
+				OutputBodyObject: RestError("device ID at position 1 is empty"),
+			},
+		},
+		"ko, internal error": {
+			body: []string{"1"},
+			ids:  []model.DeviceID{"1"},
+			err:  errors.New("db error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
 	}
-	req.Header.Add(requestid.RequestIdHeader, "test")
 
-	return req
-}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+			if tc.ids != nil {
+				inv.On("GetDevicesByIDs", contextMatcher(), tc.ids).
+					Return(tc.devices, tc.err)
+			}
 
-func restError(status string) map[string]interface{} {
-	return map[string]interface{}{"error": status, "request_id": "test"}
+			apih := makeMockApiHandler(t, &inv)
+
+			req := test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/devices/batch", tc.body)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
 }
 
-func TestApiInventoryInternalReindex(t *testing.T) {
+func TestApiInventoryFiltersCount(t *testing.T) {
 	t.Parallel()
+	rest.ErrorFieldName = "error"
 
-	testCases := map[string]struct {
-		tenantID    string
-		deviceID    string
-		serviceName string
-
-		callsUpsertAttributes bool
-		upsertAttributesErr   error
+	filters := []model.FilterPredicate{{
+		Scope:     model.AttrScopeInventory,
+		Attribute: "channel",
+		Type:      "$eq",
+		Value:     "beta",
+	}}
 
-		callsCheckAlerts bool
-		alertsCount      int
-		checkAlertsError error
+	testCases := map[string]struct {
+		body   interface{}
+		config *Config
 
-		deviceAttributes model.DeviceAttributes
+		count  bool
+		result int
+		err    error
 
 		resp JSONResponseParams
 	}{
-		"ok, alerts": {
-			tenantID:    "foo",
-			deviceID:    "bar",
-			serviceName: "devicemonitor",
+		"ok": {
+			body:   map[string]interface{}{"filters": filters},
+			count:  true,
+			result: 42,
 			resp: JSONResponseParams{
-				OutputStatus: http.StatusOK,
-			},
-			callsUpsertAttributes: true,
-			callsCheckAlerts:      true,
-			alertsCount:           3,
-			deviceAttributes: model.DeviceAttributes{
-				{Name: model.AttrNameNumberOfAlerts, Value: 3, Scope: model.AttrScopeMonitor},
-				{Name: model.AttrNameAlerts, Value: true, Scope: model.AttrScopeMonitor},
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: InventoryApiDevicesCount{Count: 42},
 			},
 		},
-		"ok, no alerts": {
-			tenantID:    "foo",
-			deviceID:    "bar",
-			serviceName: "devicemonitor",
+		"ok, no filters": {
+			body:   map[string]interface{}{},
+			count:  true,
+			result: 100,
 			resp: JSONResponseParams{
-				OutputStatus: http.StatusOK,
-			},
-			callsUpsertAttributes: true,
-			callsCheckAlerts:      true,
-			alertsCount:           0,
-			deviceAttributes: model.DeviceAttributes{
-				{Name: model.AttrNameNumberOfAlerts, Value: 0, Scope: model.AttrScopeMonitor},
-				{Name: model.AttrNameAlerts, Value: false, Scope: model.AttrScopeMonitor},
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: InventoryApiDevicesCount{Count: 100},
 			},
 		},
-		"wrong service": {
-			tenantID:    "foo",
-			deviceID:    "bar",
-			serviceName: "baz",
+		"ko, invalid filter": {
+			body: map[string]interface{}{"filters": []model.FilterPredicate{{
+				Scope:     model.AttrScopeInventory,
+				Attribute: "channel",
+				Type:      "$foo",
+				Value:     "beta",
+			}}},
 			resp: JSONResponseParams{
 				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("unsupported service"),
+				OutputBodyObject: RestError("type: must be a valid value."),
 			},
 		},
-		"no device id": {
-			tenantID:    "foo",
-			serviceName: "baz",
+		"ko, filters required": {
+			body: map[string]interface{}{},
+			config: func() *Config {
+				config := NewConfig()
+				config.SearchRequireFilters = true
+				return config
+			}(),
 			resp: JSONResponseParams{
 				OutputStatus:     http.StatusBadRequest,
-				OutputBodyObject: RestError("device id cannot be empty"),
+				OutputBodyObject: RestError("at least one filter is required"),
 			},
 		},
-		"ko, upsert attributes error": {
-			tenantID:              "foo",
-			deviceID:              "bar",
-			serviceName:           "devicemonitor",
-			callsCheckAlerts:      true,
-			alertsCount:           0,
-			callsUpsertAttributes: true,
-			upsertAttributesErr:   errors.New("upsert attributes error"),
+		"ko, regex on non-string values": {
+			body:  map[string]interface{}{"filters": filters},
+			count: true,
+			err:   errors.Wrap(store.ErrRegexNonString, "failed to count devices"),
 			resp: JSONResponseParams{
-				OutputStatus:     http.StatusInternalServerError,
-				OutputBodyObject: RestError("internal error"),
+				OutputStatus: http.StatusBadRequest,
+				OutputBodyObject: RestError(
+					"failed to count devices: " + store.ErrRegexNonString.Error()),
 			},
 		},
-		"ko, check allerts error": {
-			tenantID:         "foo",
-			deviceID:         "bar",
-			serviceName:      "devicemonitor",
-			callsCheckAlerts: true,
-			checkAlertsError: errors.New("check allerts error"),
+		"ko, internal error": {
+			body:  map[string]interface{}{"filters": filters},
+			count: true,
+			err:   errors.New("db error"),
 			resp: JSONResponseParams{
 				OutputStatus:     http.StatusInternalServerError,
 				OutputBodyObject: RestError("internal error"),
@@ -3903,47 +9982,84 @@ func TestApiInventoryInternalReindex(t *testing.T) {
 
 	for name, tc := range testCases {
 		t.Run(name, func(t *testing.T) {
-			var (
-				inReq = test.MakeSimpleRequest("POST",
-					"http://1.2.3.4/api/internal/v1/inventory/tenants/"+
-						tc.tenantID+"/devices/"+tc.deviceID+"/reindex?service="+tc.serviceName,
-					nil,
-				)
-			)
-
 			inv := minventory.InventoryApp{}
-			ctx := contextMatcher()
-
-			if tc.callsUpsertAttributes {
-				inv.On("UpsertAttributes",
-					ctx,
-					mock.AnythingOfType("model.DeviceID"),
-					mock.MatchedBy(
-						func(attrs model.DeviceAttributes) bool {
-							if tc.deviceAttributes != nil {
-								if !reflect.DeepEqual(tc.deviceAttributes, attrs) {
-									assert.FailNow(t, "", "attributes not equal: %v \n%v\n", tc.deviceAttributes, attrs)
-								}
-							}
-							return true
-						},
-					),
-				).Return(tc.upsertAttributesErr)
+			defer inv.AssertExpectations(t)
+			if tc.count {
+				inv.On("CountDevices", contextMatcher(),
+					mock.AnythingOfType("model.SearchParams"),
+				).Return(tc.result, tc.err)
 			}
-			if tc.callsCheckAlerts {
-				inv.On("CheckAlerts",
-					ctx,
-					tc.deviceID,
-				).Return(tc.alertsCount, tc.checkAlertsError)
+
+			config := tc.config
+			if config == nil {
+				config = NewConfig()
 			}
+			apih := makeMockApiHandlerWithConfig(t, &inv, config)
 
-			apih := makeMockApiHandler(t, &inv)
+			req := test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v2/inventory/filters/count", tc.body)
+			runTestRequest(t, apih, req, tc.resp)
+		})
+	}
+}
 
-			rest.ErrorFieldName = "error"
+func TestApiInventoryGetGroupSiblings(t *testing.T) {
+	t.Parallel()
+	rest.ErrorFieldName = "error"
 
-			runTestRequest(t, apih, inReq, tc.resp)
+	siblings := []model.Device{
+		{ID: "2", Group: "dev"},
+		{ID: "3", Group: "dev"},
+	}
 
-			inv.AssertExpectations(t)
+	testCases := map[string]struct {
+		devices []model.Device
+		err     error
+
+		resp JSONResponseParams
+	}{
+		"ok, grouped": {
+			devices: siblings,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: siblings,
+			},
+		},
+		"ok, ungrouped": {
+			devices: []model.Device{},
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusOK,
+				OutputBodyObject: []model.Device{},
+			},
+		},
+		"ko, device not found": {
+			err: store.ErrDevNotFound,
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusNotFound,
+				OutputBodyObject: RestError(store.ErrDevNotFound.Error()),
+			},
+		},
+		"ko, internal error": {
+			err: errors.New("db error"),
+			resp: JSONResponseParams{
+				OutputStatus:     http.StatusInternalServerError,
+				OutputBodyObject: RestError("internal error"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv := minventory.InventoryApp{}
+			defer inv.AssertExpectations(t)
+			inv.On("GetGroupSiblings", contextMatcher(), model.DeviceID("1")).
+				Return(tc.devices, tc.err)
+
+			apih := makeMockApiHandler(t, &inv)
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/0.1.0/devices/1/group/siblings", nil)
+			runTestRequest(t, apih, req, tc.resp)
 		})
 	}
 }
@@ -14,6 +14,8 @@
 package main
 
 import (
+	"time"
+
 	"github.com/mendersoftware/inventory/config"
 )
 
@@ -47,6 +49,120 @@ const (
 
 	SettingOrchestratorAddr        = "orchestrator_addr"
 	SettingOrchestratorAddrDefault = "http://mender-workflows-server:8080"
+
+	SettingAddDeviceRejectUnknownFields        = "add_device_reject_unknown_fields"
+	SettingAddDeviceRejectUnknownFieldsDefault = false
+
+	SettingAddDeviceCreateOnly        = "add_device_create_only"
+	SettingAddDeviceCreateOnlyDefault = false
+
+	SettingAddDeviceLocationBaseURL        = "add_device_location_base_url"
+	SettingAddDeviceLocationBaseURLDefault = ""
+
+	SettingScopeAliases = "scope_aliases"
+
+	SettingSearchDisableSortTieBreaker        = "search_disable_sort_tiebreaker"
+	SettingSearchDisableSortTieBreakerDefault = false
+
+	SettingHTTPReadHeaderTimeout        = "http_read_header_timeout"
+	SettingHTTPReadHeaderTimeoutDefault = 10 * time.Second
+
+	SettingHTTPReadTimeout        = "http_read_timeout"
+	SettingHTTPReadTimeoutDefault = 30 * time.Second
+
+	SettingHTTPWriteTimeout        = "http_write_timeout"
+	SettingHTTPWriteTimeoutDefault = 60 * time.Second
+
+	SettingHTTPIdleTimeout        = "http_idle_timeout"
+	SettingHTTPIdleTimeoutDefault = 120 * time.Second
+
+	SettingShutdownTimeout        = "shutdown_timeout"
+	SettingShutdownTimeoutDefault = 30 * time.Second
+
+	SettingProtectedScopes = "protected_scopes"
+
+	SettingMaxBulkDeviceIDs        = "max_bulk_device_ids"
+	SettingMaxBulkDeviceIDsDefault = 0
+
+	SettingMaxPageOffset        = "max_page_offset"
+	SettingMaxPageOffsetDefault = 0
+
+	SettingMaxLinkPage        = "max_link_page"
+	SettingMaxLinkPageDefault = 0
+
+	SettingSearchCountLimit        = "search_count_limit"
+	SettingSearchCountLimitDefault = 10000
+
+	SettingNullAttributeValueRemoves        = "null_attribute_value_removes"
+	SettingNullAttributeValueRemovesDefault = false
+
+	SettingFilterDefaultScope        = "filter_default_scope"
+	SettingFilterDefaultScopeDefault = "inventory"
+
+	SettingIndexAttributes = "index_attributes"
+
+	SettingDefaultProjection = "default_projection"
+
+	SettingSearchLargeInThreshold        = "search_large_in_threshold"
+	SettingSearchLargeInThresholdDefault = 0
+
+	SettingSearchMaxAttributesBytes        = "search_max_attributes_bytes"
+	SettingSearchMaxAttributesBytesDefault = 0
+
+	SettingLogRedactedAttributes = "log_redacted_attributes"
+
+	SettingReindexServiceScopes = "reindex_service_scopes"
+
+	SettingStrictAttributeTypes        = "strict_attribute_types"
+	SettingStrictAttributeTypesDefault = false
+
+	SettingAttributeChangeTimestamps        = "attribute_change_timestamps"
+	SettingAttributeChangeTimestampsDefault = false
+
+	SettingSearchCaseInsensitiveNames        = "search_case_insensitive_names"
+	SettingSearchCaseInsensitiveNamesDefault = false
+
+	SettingEnableSearchExplain        = "enable_search_explain"
+	SettingEnableSearchExplainDefault = false
+
+	SettingTrimGroupNames        = "trim_group_names"
+	SettingTrimGroupNamesDefault = false
+
+	SettingSearchSortIDLast        = "search_sort_id_last"
+	SettingSearchSortIDLastDefault = false
+
+	SettingSearchRequireFilters        = "search_require_filters"
+	SettingSearchRequireFiltersDefault = false
+
+	SettingSearchRequireTenant        = "search_require_tenant"
+	SettingSearchRequireTenantDefault = false
+
+	SettingSearchIndexedFiltersOnly        = "search_indexed_filters_only"
+	SettingSearchIndexedFiltersOnlyDefault = false
+
+	SettingStoreErrorsRequestID        = "store_errors_request_id"
+	SettingStoreErrorsRequestIDDefault = false
+
+	SettingLenientSortOrder        = "lenient_sort_order"
+	SettingLenientSortOrderDefault = false
+
+	SettingMaxResponseBytes        = "max_response_bytes"
+	SettingMaxResponseBytesDefault = 0
+
+	SettingIngestDedupWindow        = "ingest_dedup_window"
+	SettingIngestDedupWindowDefault = time.Duration(0)
+
+	SettingAttributeFloatDecimals        = "attribute_float_decimals"
+	SettingAttributeFloatDecimalsDefault = -1
+
+	SettingAttributeTrimScopes = "attribute_trim_scopes"
+
+	SettingMigrationConcurrency        = "migration_concurrency"
+	SettingMigrationConcurrencyDefault = 1
+)
+
+var (
+	SettingProtectedScopesDefault = []string{"identity", "system"}
 )
 
 var (
@@ -60,5 +176,38 @@ var (
 		{Key: SettingDevicemonitorAddr, Value: SettingDevicemonitorAddrDefault},
 		{Key: SettingEnableReporting, Value: SettingEnableReportingDefault},
 		{Key: SettingOrchestratorAddr, Value: SettingOrchestratorAddrDefault},
+		{Key: SettingAddDeviceRejectUnknownFields, Value: SettingAddDeviceRejectUnknownFieldsDefault},
+		{Key: SettingAddDeviceCreateOnly, Value: SettingAddDeviceCreateOnlyDefault},
+		{Key: SettingAddDeviceLocationBaseURL, Value: SettingAddDeviceLocationBaseURLDefault},
+		{Key: SettingSearchDisableSortTieBreaker, Value: SettingSearchDisableSortTieBreakerDefault},
+		{Key: SettingHTTPReadHeaderTimeout, Value: SettingHTTPReadHeaderTimeoutDefault},
+		{Key: SettingHTTPReadTimeout, Value: SettingHTTPReadTimeoutDefault},
+		{Key: SettingHTTPWriteTimeout, Value: SettingHTTPWriteTimeoutDefault},
+		{Key: SettingHTTPIdleTimeout, Value: SettingHTTPIdleTimeoutDefault},
+		{Key: SettingShutdownTimeout, Value: SettingShutdownTimeoutDefault},
+		{Key: SettingProtectedScopes, Value: SettingProtectedScopesDefault},
+		{Key: SettingMaxBulkDeviceIDs, Value: SettingMaxBulkDeviceIDsDefault},
+		{Key: SettingMaxPageOffset, Value: SettingMaxPageOffsetDefault},
+		{Key: SettingMaxLinkPage, Value: SettingMaxLinkPageDefault},
+		{Key: SettingSearchCountLimit, Value: SettingSearchCountLimitDefault},
+		{Key: SettingNullAttributeValueRemoves, Value: SettingNullAttributeValueRemovesDefault},
+		{Key: SettingFilterDefaultScope, Value: SettingFilterDefaultScopeDefault},
+		{Key: SettingSearchLargeInThreshold, Value: SettingSearchLargeInThresholdDefault},
+		{Key: SettingSearchMaxAttributesBytes, Value: SettingSearchMaxAttributesBytesDefault},
+		{Key: SettingStrictAttributeTypes, Value: SettingStrictAttributeTypesDefault},
+		{Key: SettingAttributeChangeTimestamps, Value: SettingAttributeChangeTimestampsDefault},
+		{Key: SettingSearchCaseInsensitiveNames, Value: SettingSearchCaseInsensitiveNamesDefault},
+		{Key: SettingEnableSearchExplain, Value: SettingEnableSearchExplainDefault},
+		{Key: SettingTrimGroupNames, Value: SettingTrimGroupNamesDefault},
+		{Key: SettingSearchSortIDLast, Value: SettingSearchSortIDLastDefault},
+		{Key: SettingSearchRequireFilters, Value: SettingSearchRequireFiltersDefault},
+		{Key: SettingSearchRequireTenant, Value: SettingSearchRequireTenantDefault},
+		{Key: SettingSearchIndexedFiltersOnly, Value: SettingSearchIndexedFiltersOnlyDefault},
+		{Key: SettingStoreErrorsRequestID, Value: SettingStoreErrorsRequestIDDefault},
+		{Key: SettingLenientSortOrder, Value: SettingLenientSortOrderDefault},
+		{Key: SettingMaxResponseBytes, Value: SettingMaxResponseBytesDefault},
+		{Key: SettingIngestDedupWindow, Value: SettingIngestDedupWindowDefault},
+		{Key: SettingAttributeFloatDecimals, Value: SettingAttributeFloatDecimalsDefault},
+		{Key: SettingMigrationConcurrency, Value: SettingMigrationConcurrencyDefault},
 	}
 )
@@ -16,9 +16,14 @@ package inv
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"reflect"
+	"sort"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
@@ -46,8 +51,21 @@ type InventoryApp interface {
 	WithReporting(c workflows.Client) InventoryApp
 	HealthCheck(ctx context.Context) error
 	ListDevices(ctx context.Context, q store.ListQuery) ([]model.Device, int, error)
+	ListDevicesPartitionedByGroup(
+		ctx context.Context,
+		q store.ListQuery,
+		perGroup int,
+	) (map[model.GroupName][]model.DeviceID, error)
 	GetDevice(ctx context.Context, id model.DeviceID) (*model.Device, error)
+	GetDevicesByIDs(ctx context.Context, ids []model.DeviceID) ([]model.Device, error)
+	CompareDevices(
+		ctx context.Context,
+		baseID model.DeviceID,
+		otherID model.DeviceID,
+	) (*model.DevicesDiff, error)
 	AddDevice(ctx context.Context, d *model.Device) error
+	CreateDevice(ctx context.Context, d *model.Device) error
+	ReplaceDevice(ctx context.Context, d *model.Device) error
 	UpsertAttributes(ctx context.Context, id model.DeviceID, attrs model.DeviceAttributes) error
 	UpsertAttributesWithUpdated(
 		ctx context.Context,
@@ -68,7 +86,108 @@ type InventoryApp interface {
 		scope string,
 		etag string,
 	) error
+	ReplaceAllAttributes(
+		ctx context.Context,
+		id model.DeviceID,
+		attrs model.DeviceAttributes,
+	) error
+	ToggleAttribute(
+		ctx context.Context,
+		id model.DeviceID,
+		scope string,
+		name string,
+		defaultValue bool,
+	) (bool, error)
+	MoveAttributesBetweenScopes(
+		ctx context.Context,
+		id model.DeviceID,
+		fromScope string,
+		toScope string,
+		policy string,
+	) error
 	GetFiltersAttributes(ctx context.Context) ([]model.FilterAttribute, error)
+	GetDescribedAttributes(ctx context.Context) ([]model.DescribedAttribute, error)
+	GetGroupSchema(ctx context.Context, group model.GroupName) ([]model.SchemaAttribute, error)
+	TopAttributeValues(
+		ctx context.Context,
+		scope string,
+		name string,
+		limit int,
+	) ([]model.AttributeValueCount, error)
+	AttributeCardinality(ctx context.Context, scope, name string) (int, error)
+	GetAttributesCoverage(ctx context.Context) ([]model.AttributeCoverage, error)
+	GetAttributeScopes(ctx context.Context) ([]string, error)
+	FindDevicesWithDuplicateAttributes(
+		ctx context.Context,
+		skip int,
+		limit int,
+	) ([]model.DeviceDuplicateAttributes, error)
+	RepairDuplicateAttributes(ctx context.Context, id model.DeviceID) (int, error)
+	VerifyDeviceAttributes(
+		ctx context.Context,
+		id model.DeviceID,
+	) (*model.DeviceAttributesReport, error)
+	GetAttributesChurn(ctx context.Context) ([]model.AttributeChurn, error)
+	GetDevicesAttributesCount(
+		ctx context.Context,
+		ids []model.DeviceID,
+	) (map[model.DeviceID]int, error)
+	GetAttributesPresence(
+		ctx context.Context,
+		ids []model.DeviceID,
+		attributes []model.SelectAttribute,
+	) (map[model.DeviceID][]bool, error)
+	SampleDevices(
+		ctx context.Context,
+		n int,
+		filters []model.FilterPredicate,
+	) ([]model.Device, error)
+	GetDevicesStatuses(
+		ctx context.Context,
+		ids []model.DeviceID,
+	) (map[model.DeviceID]*string, error)
+	GetOnboardingStats(
+		ctx context.Context,
+		params model.OnboardingStatsParams,
+	) ([]model.TimeBucketCount, error)
+	GetAlertsSummary(
+		ctx context.Context,
+		scope string,
+	) (*model.AlertsSummary, error)
+	FindDevicesByAttributeValues(
+		ctx context.Context,
+		scope string,
+		name string,
+		values []interface{},
+	) ([]model.Device, error)
+	FindDevicesWithAttributeDrift(
+		ctx context.Context,
+		scope string,
+		name string,
+		value interface{},
+	) ([]model.Device, error)
+	GetDevicesWithStaleScope(
+		ctx context.Context,
+		scope string,
+		olderThan time.Duration,
+	) ([]model.Device, error)
+	GetDevicesUpdatedByScopeSince(
+		ctx context.Context,
+		scope string,
+		since time.Time,
+	) ([]model.Device, error)
+	FindDevicesByAttributeSet(
+		ctx context.Context,
+		scope string,
+		attrs model.DeviceAttributes,
+	) ([]model.Device, error)
+	GetFeatureFlags(ctx context.Context) (model.FeatureFlags, error)
+	SetFeatureFlags(ctx context.Context, flags model.FeatureFlags) error
+	CreateSavedFilter(ctx context.Context, filter *model.SavedFilter) error
+	GetSavedFilter(ctx context.Context, id string) (*model.SavedFilter, error)
+	ListSavedFilters(ctx context.Context) ([]model.SavedFilter, error)
+	UpdateSavedFilter(ctx context.Context, filter *model.SavedFilter) error
+	DeleteSavedFilter(ctx context.Context, id string) error
 	DeleteGroup(ctx context.Context, groupName model.GroupName) (*model.UpdateResult, error)
 	UnsetDeviceGroup(ctx context.Context, id model.DeviceID, groupName model.GroupName) error
 	UnsetDevicesGroup(
@@ -76,20 +195,42 @@ type InventoryApp interface {
 		deviceIDs []model.DeviceID,
 		groupName model.GroupName,
 	) (*model.UpdateResult, error)
+	UnsetDevicesGroupDryRun(
+		ctx context.Context,
+		deviceIDs []model.DeviceID,
+		groupName model.GroupName,
+	) (*model.UpdateResult, error)
 	UpdateDeviceGroup(ctx context.Context, id model.DeviceID, group model.GroupName) error
 	UpdateDevicesGroup(
 		ctx context.Context,
 		ids []model.DeviceID,
 		group model.GroupName,
 	) (*model.UpdateResult, error)
-	ListGroups(ctx context.Context, filters []model.FilterPredicate) ([]model.GroupName, error)
+	ListGroups(
+		ctx context.Context,
+		filters []model.FilterPredicate,
+		skip int,
+		limit int,
+	) ([]model.GroupName, int, error)
 	ListDevicesByGroup(
 		ctx context.Context,
 		group model.GroupName,
 		skip int,
 		limit int,
 	) ([]model.DeviceID, int, error)
+	ListDevicesByGroupWithAttributes(
+		ctx context.Context,
+		group model.GroupName,
+		skip int,
+		limit int,
+		attributes []model.SelectAttribute,
+	) ([]model.Device, int, error)
 	GetDeviceGroup(ctx context.Context, id model.DeviceID) (model.GroupName, error)
+	GetGroupSiblings(ctx context.Context, id model.DeviceID) ([]model.Device, error)
+	GetDevicesDistinctGroups(
+		ctx context.Context,
+		ids []model.DeviceID,
+	) ([]model.GroupName, error)
 	DeleteDevice(ctx context.Context, id model.DeviceID) error
 	DeleteDevices(
 		ctx context.Context,
@@ -97,8 +238,16 @@ type InventoryApp interface {
 	) (*model.UpdateResult, error)
 	CreateTenant(ctx context.Context, tenant model.NewTenant) error
 	SearchDevices(ctx context.Context, searchParams model.SearchParams) ([]model.Device, int, error)
+	CountDevices(ctx context.Context, searchParams model.SearchParams) (int, error)
+	ExplainSearchDevices(
+		ctx context.Context,
+		searchParams model.SearchParams,
+	) (map[string]interface{}, error)
 	CheckAlerts(ctx context.Context, deviceId string) (int, error)
 	WithLimits(attributes, tags int) InventoryApp
+	WithIngestDedupWindow(window time.Duration) InventoryApp
+	WithFloatDecimals(decimals int) InventoryApp
+	WithTrimScopes(scopes []string) InventoryApp
 	WithDevicemonitor(client devicemonitor.Client) InventoryApp
 }
 
@@ -106,6 +255,10 @@ type inventory struct {
 	db              store.DataStore
 	limitAttributes int
 	limitTags       int
+	dedupWindow     time.Duration
+	roundFloats     bool
+	floatDecimals   int
+	trimScopes      []string
 	dmClient        devicemonitor.Client
 	enableReporting bool
 	wfClient        workflows.Client
@@ -126,6 +279,46 @@ func (i *inventory) WithLimits(limitAttributes, limitTags int) InventoryApp {
 	return i
 }
 
+// WithIngestDedupWindow skips the upserts of the inventory attributes of a
+// device identical to the ones ingested within the window
+func (i *inventory) WithIngestDedupWindow(window time.Duration) InventoryApp {
+	i.dedupWindow = window
+	return i
+}
+
+// WithFloatDecimals rounds the numeric values of the upserted attributes
+// to the decimals; a negative number of decimals disables the rounding
+func (i *inventory) WithFloatDecimals(decimals int) InventoryApp {
+	i.roundFloats = decimals >= 0
+	i.floatDecimals = decimals
+	return i
+}
+
+// roundAttributes rounds the numeric values of the attributes, if enabled
+func (i *inventory) roundAttributes(attrs model.DeviceAttributes) model.DeviceAttributes {
+	if !i.roundFloats {
+		return attrs
+	}
+	return attrs.RoundFloats(i.floatDecimals)
+}
+
+// WithTrimScopes trims the leading and trailing whitespace of the string
+// values, including the strings in arrays, of the upserted attributes of
+// the scopes
+func (i *inventory) WithTrimScopes(scopes []string) InventoryApp {
+	i.trimScopes = scopes
+	return i
+}
+
+// trimAttributes trims the string values of the attributes of the trimmed
+// scopes, if any
+func (i *inventory) trimAttributes(attrs model.DeviceAttributes) model.DeviceAttributes {
+	if len(i.trimScopes) == 0 {
+		return attrs
+	}
+	return attrs.TrimStrings(i.trimScopes)
+}
+
 func (i *inventory) WithReporting(client workflows.Client) InventoryApp {
 	i.enableReporting = true
 	i.wfClient = client
@@ -161,6 +354,18 @@ func (i *inventory) ListDevices(
 	return devs, totalCount, nil
 }
 
+func (i *inventory) ListDevicesPartitionedByGroup(
+	ctx context.Context,
+	q store.ListQuery,
+	perGroup int,
+) (map[model.GroupName][]model.DeviceID, error) {
+	groups, err := i.db.GetDevicesPartitionedByGroup(ctx, q, perGroup)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch devices by group")
+	}
+	return groups, nil
+}
+
 func (i *inventory) GetDevice(ctx context.Context, id model.DeviceID) (*model.Device, error) {
 	dev, err := i.db.GetDevice(ctx, id)
 	if err != nil {
@@ -169,6 +374,38 @@ func (i *inventory) GetDevice(ctx context.Context, id model.DeviceID) (*model.De
 	return dev, nil
 }
 
+func (i *inventory) GetDevicesByIDs(
+	ctx context.Context,
+	ids []model.DeviceID,
+) ([]model.Device, error) {
+	devices, err := i.db.GetDevicesByIDs(ctx, ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch devices")
+	}
+	return devices, nil
+}
+
+// CompareDevices returns the difference between the attributes of the base
+// device and the other device; returns store.ErrDevNotFound if either of
+// them doesn't exist
+func (i *inventory) CompareDevices(
+	ctx context.Context,
+	baseID model.DeviceID,
+	otherID model.DeviceID,
+) (*model.DevicesDiff, error) {
+	devices, err := i.db.GetDevicesMap(ctx, []model.DeviceID{baseID, otherID})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch the devices")
+	}
+	for _, id := range []model.DeviceID{baseID, otherID} {
+		if devices[id] == nil {
+			return nil, errors.Wrapf(store.ErrDevNotFound, "device %s", id)
+		}
+	}
+	diff := model.DiffAttributes(devices[baseID].Attributes, devices[otherID].Attributes)
+	return &diff, nil
+}
+
 func (i *inventory) AddDevice(ctx context.Context, dev *model.Device) error {
 	if dev == nil {
 		return errors.New("no device given")
@@ -184,6 +421,40 @@ func (i *inventory) AddDevice(ctx context.Context, dev *model.Device) error {
 	return nil
 }
 
+// CreateDevice adds the device like AddDevice, but fails with
+// store.ErrDevExists instead of updating an existing device
+func (i *inventory) CreateDevice(ctx context.Context, dev *model.Device) error {
+	if dev == nil {
+		return errors.New("no device given")
+	}
+	dev.Text = utils.GetTextField(dev)
+	err := i.db.CreateDevice(ctx, dev)
+	if err != nil {
+		return errors.Wrap(err, "failed to add device")
+	}
+
+	i.maybeTriggerReindex(ctx, []model.DeviceID{dev.ID})
+
+	return nil
+}
+
+// ReplaceDevice adds the device like AddDevice, but replaces all the
+// attributes of an existing device instead of merging them
+func (i *inventory) ReplaceDevice(ctx context.Context, dev *model.Device) error {
+	if dev == nil {
+		return errors.New("no device given")
+	}
+	dev.Text = utils.GetTextField(dev)
+	err := i.db.ReplaceDevice(ctx, dev)
+	if err != nil {
+		return errors.Wrap(err, "failed to add device")
+	}
+
+	i.maybeTriggerReindex(ctx, []model.DeviceID{dev.ID})
+
+	return nil
+}
+
 func (i *inventory) DeleteDevices(
 	ctx context.Context,
 	ids []model.DeviceID,
@@ -219,6 +490,8 @@ func (i *inventory) UpsertAttributes(
 	id model.DeviceID,
 	attrs model.DeviceAttributes,
 ) error {
+	attrs = i.roundAttributes(attrs)
+	attrs = i.trimAttributes(attrs)
 	res, err := i.db.UpsertDevicesAttributes(
 		ctx, []model.DeviceID{id}, attrs,
 	)
@@ -249,7 +522,7 @@ func (i *inventory) checkAttributesLimits(
 		return nil
 	}
 	device, err := i.db.GetDevice(ctx, id)
-	if err != nil && err != store.ErrDevNotFound {
+	if err != nil && errors.Cause(err) != store.ErrDevNotFound {
 		return errors.Wrap(err, "failed to get the device")
 	} else if device == nil {
 		return nil
@@ -299,38 +572,17 @@ func (i *inventory) needsUpsert(
 		}
 		needsUpsert = false
 		for _, attribute := range upsertAttrs {
-			if attribute.Scope != model.AttrScopeInventory {
-				needsUpsert = true
-				break
-			}
-			attributeChanged := true
-			for _, deviceAttribute := range device.Attributes {
-				if !(attribute.Scope == deviceAttribute.Scope &&
-					attribute.Name == deviceAttribute.Name) {
-					continue
-				}
-				if _, ok := deviceAttribute.Value.(primitive.A); ok {
-					attributeChanged = !reflect.DeepEqual(attribute.Value,
-						[]interface{}(deviceAttribute.Value.(primitive.A)))
-				} else {
-					attributeChanged = !reflect.DeepEqual(attribute.Value, deviceAttribute.Value)
-				}
-				break
-			}
-			if attributeChanged {
+			if attribute.Scope != model.AttrScopeInventory ||
+				attributeChanged(device, attribute) {
 				needsUpsert = true
 				break
 			}
 		}
 		if !needsUpsert && len(removeAttrs) > 0 {
-		OuterLoop:
 			for _, attribute := range removeAttrs {
-				for _, deviceAttribute := range device.Attributes {
-					if attribute.Scope == deviceAttribute.Scope &&
-						attribute.Name == deviceAttribute.Name {
-						needsUpsert = true
-						break OuterLoop
-					}
+				if findAttribute(device, attribute) != nil {
+					needsUpsert = true
+					break
 				}
 			}
 		}
@@ -338,6 +590,74 @@ func (i *inventory) needsUpsert(
 	return needsUpsert
 }
 
+// findAttribute returns the device's attribute with the same scope and
+// name as attribute, or nil if the device does not have it
+func findAttribute(
+	device *model.Device,
+	attribute model.DeviceAttribute,
+) *model.DeviceAttribute {
+	for i, deviceAttribute := range device.Attributes {
+		if attribute.Scope == deviceAttribute.Scope &&
+			attribute.Name == deviceAttribute.Name {
+			return &device.Attributes[i]
+		}
+	}
+	return nil
+}
+
+// attributeChanged returns true if the device does not have the attribute
+// or has it with a different value
+func attributeChanged(device *model.Device, attribute model.DeviceAttribute) bool {
+	deviceAttribute := findAttribute(device, attribute)
+	if deviceAttribute == nil {
+		return true
+	}
+	if value, ok := deviceAttribute.Value.(primitive.A); ok {
+		return !reflect.DeepEqual(attribute.Value, []interface{}(value))
+	}
+	return !reflect.DeepEqual(attribute.Value, deviceAttribute.Value)
+}
+
+// changedAttributes returns the attributes whose value is changed by the
+// update of the device, i.e. the new or modified upserted attributes and
+// the removed attributes the device has
+func changedAttributes(
+	device *model.Device,
+	upsertAttrs model.DeviceAttributes,
+	removeAttrs model.DeviceAttributes,
+) model.DeviceAttributes {
+	if device == nil {
+		return upsertAttrs
+	}
+	var changed model.DeviceAttributes
+	for _, attribute := range upsertAttrs {
+		if attributeChanged(device, attribute) {
+			changed = append(changed, attribute)
+		}
+	}
+	for _, attribute := range removeAttrs {
+		if findAttribute(device, attribute) != nil {
+			changed = append(changed, attribute)
+		}
+	}
+	return changed
+}
+
+// recordAttributesChurn counts the changes of the attributes' values for
+// the attribute churn diagnostics; failures are logged, not returned
+func (i *inventory) recordAttributesChurn(
+	ctx context.Context,
+	attrs model.DeviceAttributes,
+) {
+	if len(attrs) == 0 {
+		return
+	}
+	if err := i.db.IncrementAttributesChurn(ctx, attrs); err != nil {
+		log.FromContext(ctx).
+			Warnf("failed to record the attributes churn: %s", err.Error())
+	}
+}
+
 func (i *inventory) UpsertAttributesWithUpdated(
 	ctx context.Context,
 	id model.DeviceID,
@@ -345,20 +665,42 @@ func (i *inventory) UpsertAttributesWithUpdated(
 	scope string,
 	etag string,
 ) error {
+	attrs = i.roundAttributes(attrs)
+	attrs = i.trimAttributes(attrs)
+	var hash string
+	if i.dedupWindow > 0 && scope == model.AttrScopeInventory {
+		hash = hashAttributes(attrs)
+		recent, err := i.db.GetIngestHash(ctx, id)
+		if err != nil {
+			return errors.Wrap(err, "failed to get the hash of the ingested attributes")
+		} else if recent == hash {
+			return nil
+		}
+	}
+
+	attrs, removeAttrs := splitNullAttributes(attrs)
 	if err := i.checkAttributesLimits(ctx, id, attrs, scope); err != nil {
 		return err
 	}
 
 	device, err := i.db.GetDevice(ctx, id)
-	if err != nil && err != store.ErrDevNotFound {
+	if err != nil && errors.Cause(err) != store.ErrDevNotFound {
 		return errors.Wrap(err, "failed to get the device")
-	} else if !i.needsUpsert(device, attrs, nil) {
+	} else if !i.needsUpsert(device, attrs, removeAttrs) {
+		i.recordIngestHash(ctx, id, hash)
 		return nil
 	}
 
-	res, err := i.db.UpsertDevicesAttributesWithUpdated(
-		ctx, []model.DeviceID{id}, attrs, scope, etag,
-	)
+	var res *model.UpdateResult
+	if len(removeAttrs) > 0 {
+		res, err = i.db.UpsertRemoveDeviceAttributes(
+			ctx, id, attrs, removeAttrs, scope, etag,
+		)
+	} else {
+		res, err = i.db.UpsertDevicesAttributesWithUpdated(
+			ctx, []model.DeviceID{id}, attrs, scope, etag,
+		)
+	}
 	if err != nil {
 		return errors.Wrap(err, "failed to upsert attributes in db")
 	}
@@ -367,6 +709,8 @@ func (i *inventory) UpsertAttributesWithUpdated(
 			return ErrETagDoesntMatch
 		}
 	}
+	i.recordAttributesChurn(ctx, changedAttributes(device, attrs, removeAttrs))
+	i.recordIngestHash(ctx, id, hash)
 
 	if res != nil && res.MatchedCount > 0 {
 		i.reindexTextField(ctx, res.Devices)
@@ -375,6 +719,54 @@ func (i *inventory) UpsertAttributesWithUpdated(
 	return nil
 }
 
+// hashAttributes returns the hash of the attributes, independent of their
+// order in the payload
+func hashAttributes(attrs model.DeviceAttributes) string {
+	sorted := make(model.DeviceAttributes, len(attrs))
+	copy(sorted, attrs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Scope != sorted[j].Scope {
+			return sorted[i].Scope < sorted[j].Scope
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	data, _ := json.Marshal(sorted)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// recordIngestHash records the hash of the ingested attributes, if any;
+// failing to record it only costs a write on the next identical upsert
+func (i *inventory) recordIngestHash(ctx context.Context, id model.DeviceID, hash string) {
+	if hash == "" {
+		return
+	}
+	err := i.db.SetIngestHash(ctx, id, hash, time.Now().Add(i.dedupWindow))
+	if err != nil {
+		log.FromContext(ctx).
+			Warnf("failed to record the hash of the ingested attributes: %s", err.Error())
+	}
+}
+
+// splitNullAttributes separates the attributes with a null value, which
+// are to be removed from the device, from the attributes to upsert
+func splitNullAttributes(
+	attrs model.DeviceAttributes,
+) (model.DeviceAttributes, model.DeviceAttributes) {
+	var upsertAttrs, removeAttrs model.DeviceAttributes
+	for _, attr := range attrs {
+		if attr.Value == nil {
+			removeAttrs = append(removeAttrs, attr)
+		} else {
+			upsertAttrs = append(upsertAttrs, attr)
+		}
+	}
+	if removeAttrs == nil {
+		return attrs, nil
+	}
+	return upsertAttrs, removeAttrs
+}
+
 func getRemoveAttrs(
 	device *model.Device,
 	scope string,
@@ -407,6 +799,8 @@ func (i *inventory) ReplaceAttributes(
 	scope string,
 	etag string,
 ) error {
+	upsertAttrs = i.roundAttributes(upsertAttrs)
+	upsertAttrs = i.trimAttributes(upsertAttrs)
 	limit := 0
 	switch scope {
 	case model.AttrScopeInventory:
@@ -419,11 +813,17 @@ func (i *inventory) ReplaceAttributes(
 	}
 
 	device, err := i.db.GetDevice(ctx, id)
-	if err != nil && err != store.ErrDevNotFound {
+	if err != nil && errors.Cause(err) != store.ErrDevNotFound {
 		return errors.Wrap(err, "failed to get the device")
 	}
 
+	upsertAttrs, nullAttrs := splitNullAttributes(upsertAttrs)
 	removeAttrs := getRemoveAttrs(device, scope, upsertAttrs)
+	for _, attr := range nullAttrs {
+		if attr.Scope != scope {
+			removeAttrs = append(removeAttrs, attr)
+		}
+	}
 	if !i.needsUpsert(device, upsertAttrs, removeAttrs) {
 		return nil
 	}
@@ -437,6 +837,7 @@ func (i *inventory) ReplaceAttributes(
 			return ErrETagDoesntMatch
 		}
 	}
+	i.recordAttributesChurn(ctx, changedAttributes(device, upsertAttrs, removeAttrs))
 	if res != nil && res.MatchedCount > 0 {
 		i.reindexTextField(ctx, res.Devices)
 		i.maybeTriggerReindex(ctx, []model.DeviceID{id})
@@ -444,6 +845,91 @@ func (i *inventory) ReplaceAttributes(
 	return nil
 }
 
+// ReplaceAllAttributes replaces the attributes of the device in all the
+// scopes but the system one with the given attributes, e.g. to resync the
+// device from a source of truth
+func (i *inventory) ReplaceAllAttributes(
+	ctx context.Context,
+	id model.DeviceID,
+	attrs model.DeviceAttributes,
+) error {
+	attrs = i.roundAttributes(attrs)
+	attrs = i.trimAttributes(attrs)
+	counts := make(map[string]int)
+	for _, attr := range attrs {
+		counts[attr.Scope]++
+	}
+	if (i.limitAttributes > 0 && counts[model.AttrScopeInventory] > i.limitAttributes) ||
+		(i.limitTags > 0 && counts[model.AttrScopeTags] > i.limitTags) {
+		return ErrTooManyAttributes
+	}
+
+	device, err := i.db.GetDevice(ctx, id)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the device")
+	} else if device == nil {
+		return store.ErrDevNotFound
+	}
+	var removeAttrs model.DeviceAttributes
+	for _, attr := range device.Attributes {
+		if attr.Scope == model.AttrScopeSystem {
+			continue
+		}
+		replaced := false
+		for _, newAttr := range attrs {
+			if newAttr.Scope == attr.Scope && newAttr.Name == attr.Name {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			removeAttrs = append(removeAttrs, attr)
+		}
+	}
+
+	err = i.db.ReplaceAllAttributes(ctx, id, attrs)
+	if err != nil {
+		return errors.Wrap(err, "failed to replace the attributes in db")
+	}
+	i.recordAttributesChurn(ctx, changedAttributes(device, attrs, removeAttrs))
+
+	device, err = i.db.GetDevice(ctx, id)
+	if err != nil {
+		log.FromContext(ctx).Errorf(
+			"failed to get device %v to reindex the text field: %v", id, err)
+	} else if device != nil {
+		i.reindexTextField(ctx, []*model.Device{device})
+	}
+	i.maybeTriggerReindex(ctx, []model.DeviceID{id})
+	return nil
+}
+
+// ToggleAttribute flips the boolean attribute of the device, or sets it to
+// defaultValue if absent, and returns the new value
+func (i *inventory) ToggleAttribute(
+	ctx context.Context,
+	id model.DeviceID,
+	scope string,
+	name string,
+	defaultValue bool,
+) (bool, error) {
+	device, err := i.db.ToggleAttribute(ctx, id, scope, name, defaultValue)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to toggle the attribute in db")
+	}
+
+	var value bool
+	for _, attr := range device.Attributes {
+		if attr.Scope == scope && attr.Name == name {
+			value, _ = attr.Value.(bool)
+			break
+		}
+	}
+	i.reindexTextField(ctx, []*model.Device{device})
+	i.maybeTriggerReindex(ctx, []model.DeviceID{id})
+	return value, nil
+}
+
 func (i *inventory) GetFiltersAttributes(ctx context.Context) ([]model.FilterAttribute, error) {
 	attributes, err := i.db.GetFiltersAttributes(ctx)
 	if err != nil {
@@ -452,6 +938,356 @@ func (i *inventory) GetFiltersAttributes(ctx context.Context) ([]model.FilterAtt
 	return attributes, nil
 }
 
+func (i *inventory) GetDescribedAttributes(
+	ctx context.Context,
+) ([]model.DescribedAttribute, error) {
+	attributes, err := i.db.GetDescribedAttributes(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get described attributes from the db")
+	}
+	return attributes, nil
+}
+
+func (i *inventory) GetGroupSchema(
+	ctx context.Context,
+	group model.GroupName,
+) ([]model.SchemaAttribute, error) {
+	attributes, err := i.db.GetGroupSchema(ctx, group)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the group schema from the db")
+	}
+	return attributes, nil
+}
+
+func (i *inventory) TopAttributeValues(
+	ctx context.Context,
+	scope string,
+	name string,
+	limit int,
+) ([]model.AttributeValueCount, error) {
+	values, err := i.db.TopAttributeValues(ctx, scope, name, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the top attribute values from the db")
+	}
+	return values, nil
+}
+
+// MoveAttributesBetweenScopes moves the attributes of the device from one
+// scope to another, resolving the conflicts per the policy
+func (i *inventory) MoveAttributesBetweenScopes(
+	ctx context.Context,
+	id model.DeviceID,
+	fromScope string,
+	toScope string,
+	policy string,
+) error {
+	device, err := i.db.MoveAttributesBetweenScopes(ctx, id, fromScope, toScope, policy)
+	if err != nil {
+		return errors.Wrap(err, "failed to move the attributes in db")
+	}
+	i.reindexTextField(ctx, []*model.Device{device})
+	i.maybeTriggerReindex(ctx, []model.DeviceID{id})
+	return nil
+}
+
+func (i *inventory) AttributeCardinality(
+	ctx context.Context,
+	scope string,
+	name string,
+) (int, error) {
+	cardinality, err := i.db.AttributeCardinality(ctx, scope, name)
+	if err != nil {
+		return -1, errors.Wrap(err, "failed to get the attribute cardinality from the db")
+	}
+	return cardinality, nil
+}
+
+// GetAttributesCoverage returns the percentage of the devices having each
+// attribute
+func (i *inventory) GetAttributesCoverage(
+	ctx context.Context,
+) ([]model.AttributeCoverage, error) {
+	counts, total, err := i.db.CountDevicesByAttribute(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count the devices by attribute in the db")
+	}
+	for j := range counts {
+		counts[j].Coverage = 100 * float64(counts[j].Count) / float64(total)
+	}
+	return counts, nil
+}
+
+func (i *inventory) GetAttributeScopes(ctx context.Context) ([]string, error) {
+	scopes, err := i.db.GetAttributeScopes(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the attribute scopes from the db")
+	}
+	return scopes, nil
+}
+
+func (i *inventory) FindDevicesWithDuplicateAttributes(
+	ctx context.Context,
+	skip int,
+	limit int,
+) ([]model.DeviceDuplicateAttributes, error) {
+	devices, err := i.db.FindDevicesWithDuplicateAttributes(ctx, skip, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find devices with duplicate attributes")
+	}
+	return devices, nil
+}
+
+func (i *inventory) VerifyDeviceAttributes(
+	ctx context.Context,
+	id model.DeviceID,
+) (*model.DeviceAttributesReport, error) {
+	report, err := i.db.VerifyDeviceAttributes(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to verify the device attributes")
+	}
+	return report, nil
+}
+
+func (i *inventory) RepairDuplicateAttributes(
+	ctx context.Context,
+	id model.DeviceID,
+) (int, error) {
+	removed, err := i.db.RepairDuplicateAttributes(ctx, id)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to repair duplicate attributes")
+	}
+	if removed > 0 {
+		i.maybeTriggerReindex(ctx, []model.DeviceID{id})
+	}
+	return removed, nil
+}
+
+func (i *inventory) GetAttributesChurn(
+	ctx context.Context,
+) ([]model.AttributeChurn, error) {
+	churn, err := i.db.GetAttributesChurn(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the attributes churn")
+	}
+	return churn, nil
+}
+
+func (i *inventory) GetDevicesAttributesCount(
+	ctx context.Context,
+	ids []model.DeviceID,
+) (map[model.DeviceID]int, error) {
+	counts, err := i.db.GetDevicesAttributesCount(ctx, ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count the devices' attributes")
+	}
+	return counts, nil
+}
+
+func (i *inventory) SampleDevices(
+	ctx context.Context,
+	n int,
+	filters []model.FilterPredicate,
+) ([]model.Device, error) {
+	devices, err := i.db.SampleDevices(ctx, n, filters)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sample the devices")
+	}
+	return devices, nil
+}
+
+func (i *inventory) GetAttributesPresence(
+	ctx context.Context,
+	ids []model.DeviceID,
+	attributes []model.SelectAttribute,
+) (map[model.DeviceID][]bool, error) {
+	presence, err := i.db.GetAttributesPresence(ctx, ids, attributes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the attributes presence")
+	}
+	return presence, nil
+}
+
+func (i *inventory) GetDevicesStatuses(
+	ctx context.Context,
+	ids []model.DeviceID,
+) (map[model.DeviceID]*string, error) {
+	statuses, err := i.db.GetDevicesStatuses(ctx, ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the devices' statuses")
+	}
+	return statuses, nil
+}
+
+// GetOnboardingStats counts the devices created within the time range per
+// time bucket, including the empty buckets.
+func (i *inventory) GetOnboardingStats(
+	ctx context.Context,
+	params model.OnboardingStatsParams,
+) ([]model.TimeBucketCount, error) {
+	counts, err := i.db.CountDevicesCreatedPerDay(ctx, params.From, params.To)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count the created devices")
+	}
+	buckets := params.Buckets()
+	stats := make([]model.TimeBucketCount, len(buckets))
+	index := make(map[time.Time]int, len(buckets))
+	for n, bucket := range buckets {
+		stats[n].Bucket = bucket
+		index[bucket] = n
+	}
+	for day, count := range counts {
+		if n, ok := index[params.BucketStart(day)]; ok {
+			stats[n].Count += count
+		}
+	}
+	return stats, nil
+}
+
+// GetAlertsSummary counts the devices with and without alerts according to
+// the alert count attribute in the given scope, including the empty alert
+// count buckets.
+func (i *inventory) GetAlertsSummary(
+	ctx context.Context,
+	scope string,
+) (*model.AlertsSummary, error) {
+	counts, err := i.db.CountDevicesByAlertCount(ctx, scope)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count the devices by alert count")
+	}
+	summary := &model.AlertsSummary{
+		Buckets: make([]model.AlertCountBucket, len(model.AlertCountBuckets)),
+	}
+	for n, bucket := range model.AlertCountBuckets {
+		summary.Buckets[n] = model.AlertCountBucket{
+			Bucket: bucket,
+			Count:  counts[bucket],
+		}
+		if bucket == model.AlertCountBucketNone {
+			summary.WithoutAlerts += counts[bucket]
+		} else {
+			summary.WithAlerts += counts[bucket]
+		}
+	}
+	return summary, nil
+}
+
+func (i *inventory) GetFeatureFlags(ctx context.Context) (model.FeatureFlags, error) {
+	flags, err := i.db.GetFeatureFlags(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the feature flags")
+	}
+	return flags, nil
+}
+
+func (i *inventory) SetFeatureFlags(ctx context.Context, flags model.FeatureFlags) error {
+	if err := i.db.SetFeatureFlags(ctx, flags); err != nil {
+		return errors.Wrap(err, "failed to set the feature flags")
+	}
+	return nil
+}
+
+// CreateSavedFilter stores the filter under a new ID, which is set in the
+// filter
+func (i *inventory) CreateSavedFilter(ctx context.Context, filter *model.SavedFilter) error {
+	filter.ID = uuid.NewString()
+	if err := i.db.CreateSavedFilter(ctx, filter); err != nil {
+		return errors.Wrap(err, "failed to store the filter")
+	}
+	return nil
+}
+
+func (i *inventory) GetSavedFilter(ctx context.Context, id string) (*model.SavedFilter, error) {
+	filter, err := i.db.GetSavedFilter(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the filter")
+	}
+	return filter, nil
+}
+
+func (i *inventory) ListSavedFilters(ctx context.Context) ([]model.SavedFilter, error) {
+	filters, err := i.db.ListSavedFilters(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the filters")
+	}
+	return filters, nil
+}
+
+func (i *inventory) UpdateSavedFilter(ctx context.Context, filter *model.SavedFilter) error {
+	if err := i.db.UpdateSavedFilter(ctx, filter); err != nil {
+		return errors.Wrap(err, "failed to update the filter")
+	}
+	return nil
+}
+
+func (i *inventory) DeleteSavedFilter(ctx context.Context, id string) error {
+	if err := i.db.DeleteSavedFilter(ctx, id); err != nil {
+		return errors.Wrap(err, "failed to delete the filter")
+	}
+	return nil
+}
+
+func (i *inventory) FindDevicesByAttributeValues(
+	ctx context.Context,
+	scope string,
+	name string,
+	values []interface{},
+) ([]model.Device, error) {
+	devices, err := i.db.FindDevicesByAttributeValues(ctx, scope, name, values)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find the devices by attribute values")
+	}
+	return devices, nil
+}
+
+func (i *inventory) FindDevicesWithAttributeDrift(
+	ctx context.Context,
+	scope string,
+	name string,
+	value interface{},
+) ([]model.Device, error) {
+	devices, err := i.db.FindDevicesWithAttributeDrift(ctx, scope, name, value)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find the devices with attribute drift")
+	}
+	return devices, nil
+}
+
+func (i *inventory) FindDevicesByAttributeSet(
+	ctx context.Context,
+	scope string,
+	attrs model.DeviceAttributes,
+) ([]model.Device, error) {
+	devices, err := i.db.FindDevicesByAttributeSet(ctx, scope, attrs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find the devices by attribute set")
+	}
+	return devices, nil
+}
+
+func (i *inventory) GetDevicesWithStaleScope(
+	ctx context.Context,
+	scope string,
+	olderThan time.Duration,
+) ([]model.Device, error) {
+	devices, err := i.db.GetDevicesWithStaleScope(ctx, scope, olderThan)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the devices with stale scope from the db")
+	}
+	return devices, nil
+}
+
+func (i *inventory) GetDevicesUpdatedByScopeSince(
+	ctx context.Context,
+	scope string,
+	since time.Time,
+) ([]model.Device, error) {
+	devices, err := i.db.GetDevicesUpdatedByScopeSince(ctx, scope, since)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the devices updated by scope from the db")
+	}
+	return devices, nil
+}
+
 func (i *inventory) DeleteGroup(
 	ctx context.Context,
 	groupName model.GroupName,
@@ -524,6 +1360,20 @@ func (i *inventory) UnsetDevicesGroup(
 	return res, nil
 }
 
+// UnsetDevicesGroupDryRun returns the result UnsetDevicesGroup would
+// have, without changing the devices' groups
+func (i *inventory) UnsetDevicesGroupDryRun(
+	ctx context.Context,
+	deviceIDs []model.DeviceID,
+	groupName model.GroupName,
+) (*model.UpdateResult, error) {
+	matched, err := i.db.CountDevicesInGroup(ctx, deviceIDs, groupName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count the devices in the group")
+	}
+	return &model.UpdateResult{MatchedCount: matched}, nil
+}
+
 func (i *inventory) UnsetDeviceGroup(
 	ctx context.Context,
 	id model.DeviceID,
@@ -581,14 +1431,27 @@ func (i *inventory) UpdateDeviceGroup(
 func (i *inventory) ListGroups(
 	ctx context.Context,
 	filters []model.FilterPredicate,
-) ([]model.GroupName, error) {
-	groups, err := i.db.ListGroups(ctx, filters)
+	skip int,
+	limit int,
+) ([]model.GroupName, int, error) {
+	groups, totalCount, err := i.db.ListGroups(ctx, filters, skip, limit)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to list groups")
+		return nil, -1, errors.Wrap(err, "failed to list groups")
 	}
 
 	if groups == nil {
-		return []model.GroupName{}, nil
+		return []model.GroupName{}, totalCount, nil
+	}
+	return groups, totalCount, nil
+}
+
+func (i *inventory) GetDevicesDistinctGroups(
+	ctx context.Context,
+	ids []model.DeviceID,
+) ([]model.GroupName, error) {
+	groups, err := i.db.GetDevicesDistinctGroups(ctx, ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the devices' groups")
 	}
 	return groups, nil
 }
@@ -601,7 +1464,7 @@ func (i *inventory) ListDevicesByGroup(
 ) ([]model.DeviceID, int, error) {
 	ids, totalCount, err := i.db.GetDevicesByGroup(ctx, group, skip, limit)
 	if err != nil {
-		if err == store.ErrGroupNotFound {
+		if errors.Cause(err) == store.ErrGroupNotFound {
 			return nil, -1, err
 		} else {
 			return nil, -1, errors.Wrap(err, "failed to list devices by group")
@@ -611,13 +1474,35 @@ func (i *inventory) ListDevicesByGroup(
 	return ids, totalCount, nil
 }
 
+// ListDevicesByGroupWithAttributes works like ListDevicesByGroup, but
+// returns the devices with only the given attributes and the system
+// timestamps
+func (i *inventory) ListDevicesByGroupWithAttributes(
+	ctx context.Context,
+	group model.GroupName,
+	skip,
+	limit int,
+	attributes []model.SelectAttribute,
+) ([]model.Device, int, error) {
+	devices, totalCount, err := i.db.GetDevicesByGroupWithAttributes(
+		ctx, group, skip, limit, attributes)
+	if err != nil {
+		if errors.Cause(err) == store.ErrGroupNotFound {
+			return nil, -1, err
+		}
+		return nil, -1, errors.Wrap(err, "failed to list devices by group")
+	}
+
+	return devices, totalCount, nil
+}
+
 func (i *inventory) GetDeviceGroup(
 	ctx context.Context,
 	id model.DeviceID,
 ) (model.GroupName, error) {
 	group, err := i.db.GetDeviceGroup(ctx, id)
 	if err != nil {
-		if err == store.ErrDevNotFound {
+		if errors.Cause(err) == store.ErrDevNotFound {
 			return "", err
 		} else {
 			return "", errors.Wrap(err, "failed to get device's group")
@@ -627,6 +1512,20 @@ func (i *inventory) GetDeviceGroup(
 	return group, nil
 }
 
+func (i *inventory) GetGroupSiblings(
+	ctx context.Context,
+	id model.DeviceID,
+) ([]model.Device, error) {
+	devices, err := i.db.GetGroupSiblings(ctx, id)
+	if err != nil {
+		if errors.Cause(err) == store.ErrDevNotFound {
+			return nil, err
+		}
+		return nil, errors.Wrap(err, "failed to get the device's group siblings")
+	}
+	return devices, nil
+}
+
 func (i *inventory) CreateTenant(ctx context.Context, tenant model.NewTenant) error {
 	if err := i.db.WithAutomigrate().
 		MigrateTenant(ctx, mongo.DbVersion, tenant.ID); err != nil {
@@ -648,6 +1547,28 @@ func (i *inventory) SearchDevices(
 	return devs, totalCount, nil
 }
 
+func (i *inventory) CountDevices(
+	ctx context.Context,
+	searchParams model.SearchParams,
+) (int, error) {
+	count, err := i.db.CountDevices(ctx, searchParams)
+	if err != nil {
+		return -1, errors.Wrap(err, "failed to count devices")
+	}
+	return count, nil
+}
+
+func (i *inventory) ExplainSearchDevices(
+	ctx context.Context,
+	searchParams model.SearchParams,
+) (map[string]interface{}, error) {
+	plan, err := i.db.ExplainSearchDevices(ctx, searchParams)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to explain the devices search")
+	}
+	return plan, nil
+}
+
 func (i *inventory) CheckAlerts(ctx context.Context, deviceId string) (int, error) {
 	return i.dmClient.CheckAlerts(ctx, deviceId)
 }
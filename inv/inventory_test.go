@@ -44,6 +44,10 @@ func boolPtr(value bool) *bool {
 	return &value
 }
 
+func intPtr(value int) *int {
+	return &value
+}
+
 func timePtr(value time.Time) *time.Time {
 	return &value
 }
@@ -238,6 +242,185 @@ func TestInventoryGetDevice(t *testing.T) {
 	}
 }
 
+func TestInventoryGetGroupSiblings(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		devices := []model.Device{{ID: "2", Group: "dev"}}
+		db.On("GetGroupSiblings", ctx, model.DeviceID("1")).Return(devices, nil)
+		i := invForTest(db)
+
+		res, err := i.GetGroupSiblings(ctx, "1")
+		assert.NoError(t, err)
+		assert.Equal(t, devices, res)
+	})
+
+	t.Run("error, device not found", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetGroupSiblings", ctx, model.DeviceID("1")).
+			Return(nil, store.ErrDevNotFound)
+		i := invForTest(db)
+
+		_, err := i.GetGroupSiblings(ctx, "1")
+		assert.Equal(t, store.ErrDevNotFound, err)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetGroupSiblings", ctx, model.DeviceID("1")).
+			Return(nil, errors.New("db error"))
+		i := invForTest(db)
+
+		_, err := i.GetGroupSiblings(ctx, "1")
+		assert.EqualError(t, err, "failed to get the device's group siblings: db error")
+	})
+}
+
+func TestInventoryCountDevices(t *testing.T) {
+	t.Parallel()
+
+	params := model.SearchParams{
+		Filters: []model.FilterPredicate{{
+			Scope:     model.AttrScopeInventory,
+			Attribute: "channel",
+			Type:      "$eq",
+			Value:     "beta",
+		}},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("CountDevices", ctx, params).Return(3, nil)
+		i := invForTest(db)
+
+		count, err := i.CountDevices(ctx, params)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, count)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("CountDevices", ctx, params).Return(-1, errors.New("db error"))
+		i := invForTest(db)
+
+		_, err := i.CountDevices(ctx, params)
+		assert.EqualError(t, err, "failed to count devices: db error")
+	})
+}
+
+func TestInventoryGetDevicesByIDs(t *testing.T) {
+	t.Parallel()
+
+	ids := []model.DeviceID{"2", "1"}
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		devices := []model.Device{{ID: "2"}, {ID: "1"}}
+		db.On("GetDevicesByIDs", ctx, ids).Return(devices, nil)
+		i := invForTest(db)
+
+		res, err := i.GetDevicesByIDs(ctx, ids)
+		assert.NoError(t, err)
+		assert.Equal(t, devices, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetDevicesByIDs", ctx, ids).Return(nil, errors.New("db error"))
+		i := invForTest(db)
+
+		_, err := i.GetDevicesByIDs(ctx, ids)
+		assert.EqualError(t, err, "failed to fetch devices: db error")
+	})
+}
+
+func TestInventoryCompareDevices(t *testing.T) {
+	t.Parallel()
+
+	ids := []model.DeviceID{"1", "2"}
+	devices := map[model.DeviceID]*model.Device{
+		"1": {ID: "1", Attributes: model.DeviceAttributes{
+			{Name: "kernel", Value: "5.10", Scope: model.AttrScopeInventory},
+			{Name: "legacy", Value: "yes", Scope: model.AttrScopeInventory},
+		}},
+		"2": {ID: "2", Attributes: model.DeviceAttributes{
+			{Name: "kernel", Value: "6.1", Scope: model.AttrScopeInventory},
+		}},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetDevicesMap", ctx, ids).Return(devices, nil)
+		i := invForTest(db)
+
+		diff, err := i.CompareDevices(ctx, "1", "2")
+		assert.NoError(t, err)
+		assert.Equal(t, &model.DevicesDiff{
+			Added: model.DeviceAttributes{},
+			Removed: model.DeviceAttributes{
+				{Name: "legacy", Value: "yes", Scope: model.AttrScopeInventory},
+			},
+			Changed: []model.AttributeChange{{
+				Name:     "kernel",
+				Scope:    model.AttrScopeInventory,
+				Value:    "5.10",
+				NewValue: "6.1",
+			}},
+		}, diff)
+	})
+
+	t.Run("error, device not found", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetDevicesMap", ctx, ids).Return(
+			map[model.DeviceID]*model.Device{"1": devices["1"]}, nil)
+		i := invForTest(db)
+
+		_, err := i.CompareDevices(ctx, "1", "2")
+		assert.EqualError(t, err, "device 2: "+store.ErrDevNotFound.Error())
+		assert.ErrorIs(t, err, store.ErrDevNotFound)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetDevicesMap", ctx, ids).Return(nil, errors.New("db error"))
+		i := invForTest(db)
+
+		_, err := i.CompareDevices(ctx, "1", "2")
+		assert.EqualError(t, err, "failed to fetch the devices: db error")
+	})
+}
+
 func TestInventoryAddDevice(t *testing.T) {
 	t.Parallel()
 
@@ -292,6 +475,100 @@ func TestInventoryAddDevice(t *testing.T) {
 	}
 }
 
+func TestInventoryCreateDevice(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		inDevice       *model.Device
+		datastoreError error
+		outError       error
+	}{
+		"nil device": {
+			outError: errors.New("no device given"),
+		},
+		"datastore success": {
+			inDevice: &model.Device{ID: "1"},
+		},
+		"device exists": {
+			inDevice:       &model.Device{ID: "1"},
+			datastoreError: store.ErrDevExists,
+			outError:       errors.New("failed to add device: device already exists"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			defer db.AssertExpectations(t)
+			if tc.inDevice != nil {
+				db.On("CreateDevice",
+					ctx,
+					mock.MatchedBy(func(device *model.Device) bool {
+						return device.Text == utils.GetTextField(device)
+					})).
+					Return(tc.datastoreError)
+			}
+			i := invForTest(db)
+
+			err := i.CreateDevice(ctx, tc.inDevice)
+			if tc.outError != nil {
+				assert.EqualError(t, err, tc.outError.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestInventoryReplaceDevice(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		inDevice       *model.Device
+		datastoreError error
+		outError       error
+	}{
+		"nil device": {
+			outError: errors.New("no device given"),
+		},
+		"datastore success": {
+			inDevice: &model.Device{ID: "1"},
+		},
+		"datastore error": {
+			inDevice:       &model.Device{ID: "1"},
+			datastoreError: errors.New("db error"),
+			outError:       errors.New("failed to add device: db error"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			defer db.AssertExpectations(t)
+			if tc.inDevice != nil {
+				db.On("ReplaceDevice",
+					ctx,
+					mock.MatchedBy(func(device *model.Device) bool {
+						return device.Text == utils.GetTextField(device)
+					})).
+					Return(tc.datastoreError)
+			}
+			i := invForTest(db)
+
+			err := i.ReplaceDevice(ctx, tc.inDevice)
+			if tc.outError != nil {
+				assert.EqualError(t, err, tc.outError.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
 func TestInventoryUpsertAttributes(t *testing.T) {
 	t.Parallel()
 
@@ -698,6 +975,11 @@ func TestInventoryUpsertAttributesWithUpdated(t *testing.T) {
 				).Return(nil)
 			}
 
+			db.On("IncrementAttributesChurn",
+				ctx,
+				mock.AnythingOfType("model.DeviceAttributes"),
+			).Return(nil).Maybe()
+
 			i := invForTest(db).WithLimits(tc.limitAttributes, tc.limitTags)
 
 			err := i.UpsertAttributesWithUpdated(ctx, devID, tc.attributes, tc.scope, tc.etag)
@@ -718,106 +1000,1278 @@ func TestInventoryUpsertAttributesWithUpdated(t *testing.T) {
 	}
 }
 
-func TestReplaceAttributes(t *testing.T) {
+func TestInventoryAttributesNullValue(t *testing.T) {
 	t.Parallel()
 
-	updateResult := &model.UpdateResult{
-		Devices: []*model.Device{
-			{
-				ID: "1",
-			},
+	const devID = model.DeviceID("devid")
+	device := &model.Device{
+		ID: devID,
+		Attributes: model.DeviceAttributes{
+			{Name: "foo", Value: "foo", Scope: model.AttrScopeInventory},
+			{Name: "bar", Value: "bar", Scope: model.AttrScopeInventory},
 		},
-		MatchedCount: 1,
 	}
+	attrs := model.DeviceAttributes{
+		{Name: "foo", Value: nil, Scope: model.AttrScopeInventory},
+		{Name: "bar", Value: "", Scope: model.AttrScopeInventory},
+	}
+	upsertAttrs := model.DeviceAttributes{
+		{Name: "bar", Value: "", Scope: model.AttrScopeInventory},
+	}
+	removeAttrs := model.DeviceAttributes{
+		{Name: "foo", Value: nil, Scope: model.AttrScopeInventory},
+	}
+	result := &model.UpdateResult{MatchedCount: 1}
 
-	testCases := map[string]struct {
-		deviceID        model.DeviceID
-		getDevice       *model.Device
-		getDeviceErr    error
-		dataStoreResult *model.UpdateResult
-		datastoreError  error
-		limitAttributes int
-		limitTags       int
+	t.Run("upsert", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetDevice", ctx, devID).Return(device, nil)
+		db.On("UpsertRemoveDeviceAttributes", ctx, devID,
+			upsertAttrs, removeAttrs, model.AttrScopeInventory, "",
+		).Return(result, nil)
+		db.On("IncrementAttributesChurn", ctx, model.DeviceAttributes{
+			upsertAttrs[0], removeAttrs[0],
+		}).Return(nil)
+		i := invForTest(db)
 
-		upsertAttrs model.DeviceAttributes
-		removeAttrs model.DeviceAttributes
-		outError    error
+		err := i.UpsertAttributesWithUpdated(ctx, devID, attrs,
+			model.AttrScopeInventory, "")
+		assert.NoError(t, err)
+	})
 
-		scope string
-		etag  string
-	}{
-		"ok, device not found": {
-			deviceID:     "1",
-			getDevice:    nil,
-			getDeviceErr: store.ErrDevNotFound,
+	t.Run("replace", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetDevice", ctx, devID).Return(device, nil)
+		db.On("UpsertRemoveDeviceAttributes", ctx, devID,
+			upsertAttrs, model.DeviceAttributes{device.Attributes[0]},
+			model.AttrScopeInventory, "",
+		).Return(result, nil)
+		db.On("IncrementAttributesChurn", ctx, model.DeviceAttributes{
+			upsertAttrs[0], device.Attributes[0],
+		}).Return(nil)
+		i := invForTest(db)
 
-			upsertAttrs: model.DeviceAttributes{
-				model.DeviceAttribute{
-					Name:  "name",
-					Value: "foo",
-					Scope: model.AttrScopeInventory,
-				},
-				model.DeviceAttribute{
-					Name:  "ip_address",
-					Value: "127.0.0.1",
-					Scope: model.AttrScopeInventory,
-				},
-			},
-			removeAttrs: model.DeviceAttributes{},
+		err := i.ReplaceAttributes(ctx, devID, attrs,
+			model.AttrScopeInventory, "")
+		assert.NoError(t, err)
+	})
+}
 
-			dataStoreResult: nil,
-			datastoreError:  nil,
-			outError:        nil,
+func TestInventoryAttributesChurn(t *testing.T) {
+	t.Parallel()
 
-			scope: model.AttrScopeInventory,
-		},
-		"ok, device found": {
-			deviceID: "1",
-			getDevice: &model.Device{
-				Attributes: model.DeviceAttributes{},
-			},
-			getDeviceErr: nil,
+	const devID = model.DeviceID("devid")
+	ctx := context.Background()
+	device := &model.Device{
+		ID: devID,
+		Attributes: model.DeviceAttributes{
+			{Name: "foo", Value: "1", Scope: model.AttrScopeInventory},
+			{Name: "bar", Value: "a", Scope: model.AttrScopeInventory},
+		},
+		UpdatedTs: timePtr(time.Now()),
+	}
+	churn := map[string]int{}
+
+	db := &mstore.DataStore{}
+	defer db.AssertExpectations(t)
+	db.On("GetDevice", ctx, devID).Return(
+		func(context.Context, model.DeviceID) *model.Device {
+			dev := *device
+			dev.Attributes = append(model.DeviceAttributes{}, device.Attributes...)
+			return &dev
+		}, nil)
+	db.On("UpsertDevicesAttributesWithUpdated",
+		ctx,
+		[]model.DeviceID{devID},
+		mock.AnythingOfType("model.DeviceAttributes"),
+		model.AttrScopeInventory,
+		"",
+	).Run(func(args mock.Arguments) {
+		for _, attr := range args.Get(2).(model.DeviceAttributes) {
+			device.Attributes[map[string]int{"foo": 0, "bar": 1}[attr.Name]] = attr
+		}
+		device.UpdatedTs = timePtr(time.Now())
+	}).Return(&model.UpdateResult{}, nil)
+	db.On("IncrementAttributesChurn",
+		ctx,
+		mock.AnythingOfType("model.DeviceAttributes"),
+	).Run(func(args mock.Arguments) {
+		for _, attr := range args.Get(1).(model.DeviceAttributes) {
+			churn[attr.Name]++
+		}
+	}).Return(nil)
+	i := invForTest(db)
+
+	upsert := func(foo, bar string) {
+		err := i.UpsertAttributesWithUpdated(ctx, devID, model.DeviceAttributes{
+			{Name: "foo", Value: foo, Scope: model.AttrScopeInventory},
+			{Name: "bar", Value: bar, Scope: model.AttrScopeInventory},
+		}, model.AttrScopeInventory, "")
+		assert.NoError(t, err)
+	}
 
-			upsertAttrs: model.DeviceAttributes{
-				model.DeviceAttribute{
-					Name:  "name",
-					Value: "foo",
-					Scope: model.AttrScopeInventory,
-				},
-				model.DeviceAttribute{
-					Name:  "ip_address",
-					Value: "127.0.0.1",
-					Scope: model.AttrScopeInventory,
-				},
-			},
-			removeAttrs: model.DeviceAttributes{},
+	upsert("1", "a")
+	assert.Equal(t, map[string]int{}, churn)
 
-			dataStoreResult: updateResult,
-			datastoreError:  nil,
-			outError:        nil,
+	upsert("2", "a")
+	upsert("2", "a")
+	assert.Equal(t, map[string]int{"foo": 1}, churn)
 
-			scope: model.AttrScopeInventory,
-		},
-		"ok, device found, replace attributes": {
-			deviceID: "1",
-			getDevice: &model.Device{
-				Attributes: model.DeviceAttributes{
-					model.DeviceAttribute{
-						Name:  "name",
-						Value: "foo",
-						Scope: model.AttrScopeInventory,
-					},
-					model.DeviceAttribute{
-						Name:  "custom",
-						Value: "bar",
-						Scope: model.AttrScopeInventory,
-					},
-				},
-			},
-			getDeviceErr: nil,
+	upsert("3", "b")
+	upsert("1", "b")
+	assert.Equal(t, map[string]int{"foo": 3, "bar": 1}, churn)
 
-			upsertAttrs: model.DeviceAttributes{
-				model.DeviceAttribute{
+	// the daily update is written even if nothing changed, but it is not
+	// counted as a change
+	device.UpdatedTs = timePtr(time.Now().Add(-2 * oneDay))
+	upsert("1", "b")
+	assert.Equal(t, map[string]int{"foo": 3, "bar": 1}, churn)
+	db.AssertNumberOfCalls(t, "UpsertDevicesAttributesWithUpdated", 4)
+}
+
+func TestInventoryFloatDecimals(t *testing.T) {
+	t.Parallel()
+
+	const devID = model.DeviceID("devid")
+	attrs := model.DeviceAttributes{
+		{Name: "temp", Value: 21.456789, Scope: model.AttrScopeInventory},
+		{Name: "load", Value: []interface{}{0.1234, 1.0}, Scope: model.AttrScopeInventory},
+	}
+
+	testCases := map[string]struct {
+		decimals *int
+
+		upserted model.DeviceAttributes
+	}{
+		"ok, rounded": {
+			decimals: intPtr(2),
+			upserted: model.DeviceAttributes{
+				{Name: "temp", Value: 21.46, Scope: model.AttrScopeInventory},
+				{Name: "load", Value: []interface{}{0.12, 1.0}, Scope: model.AttrScopeInventory},
+			},
+		},
+		"ok, disabled": {
+			decimals: intPtr(-1),
+			upserted: attrs,
+		},
+		"ok, off by default": {
+			upserted: attrs,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			db := &mstore.DataStore{}
+			defer db.AssertExpectations(t)
+
+			db.On("GetDevice", ctx, devID).Return(nil, store.ErrDevNotFound)
+			db.On("UpsertDevicesAttributesWithUpdated",
+				ctx,
+				[]model.DeviceID{devID},
+				tc.upserted,
+				model.AttrScopeInventory,
+				"",
+			).Return(&model.UpdateResult{}, nil)
+			db.On("IncrementAttributesChurn", ctx, tc.upserted).Return(nil)
+			i := invForTest(db)
+			if tc.decimals != nil {
+				i = i.WithFloatDecimals(*tc.decimals)
+			}
+
+			err := i.UpsertAttributesWithUpdated(ctx, devID, attrs, model.AttrScopeInventory, "")
+			assert.NoError(t, err)
+			// the attributes of the caller are left untouched
+			assert.Equal(t, 21.456789, attrs[0].Value)
+		})
+	}
+}
+
+func TestInventoryTrimScopes(t *testing.T) {
+	t.Parallel()
+
+	const devID = model.DeviceID("devid")
+	attrs := model.DeviceAttributes{
+		{Name: "hostname", Value: " foo ", Scope: model.AttrScopeInventory},
+		{Name: "hosts", Value: []interface{}{" a.example.com", "b.example.com "},
+			Scope: model.AttrScopeInventory},
+	}
+
+	testCases := map[string]struct {
+		scopes []string
+
+		upserted model.DeviceAttributes
+	}{
+		"ok, trimmed": {
+			scopes: []string{model.AttrScopeInventory},
+			upserted: model.DeviceAttributes{
+				{Name: "hostname", Value: "foo", Scope: model.AttrScopeInventory},
+				{Name: "hosts", Value: []interface{}{"a.example.com", "b.example.com"},
+					Scope: model.AttrScopeInventory},
+			},
+		},
+		"ok, other scope": {
+			scopes:   []string{model.AttrScopeTags},
+			upserted: attrs,
+		},
+		"ok, off by default": {
+			upserted: attrs,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			db := &mstore.DataStore{}
+			defer db.AssertExpectations(t)
+
+			db.On("GetDevice", ctx, devID).Return(nil, store.ErrDevNotFound)
+			db.On("UpsertDevicesAttributesWithUpdated",
+				ctx,
+				[]model.DeviceID{devID},
+				tc.upserted,
+				model.AttrScopeInventory,
+				"",
+			).Return(&model.UpdateResult{}, nil)
+			db.On("IncrementAttributesChurn", ctx, tc.upserted).Return(nil)
+			i := invForTest(db).WithTrimScopes(tc.scopes)
+
+			err := i.UpsertAttributesWithUpdated(ctx, devID, attrs, model.AttrScopeInventory, "")
+			assert.NoError(t, err)
+			// the attributes of the caller are left untouched
+			assert.Equal(t, " foo ", attrs[0].Value)
+		})
+	}
+}
+
+func TestInventoryIngestDedupWindow(t *testing.T) {
+	t.Parallel()
+
+	const devID = model.DeviceID("devid")
+	ctx := context.Background()
+	// updated two days ago, so that every upsert reaching the db writes
+	device := &model.Device{
+		ID:        devID,
+		UpdatedTs: timePtr(time.Now().Add(-2 * oneDay)),
+	}
+	hash := ""
+
+	db := &mstore.DataStore{}
+	defer db.AssertExpectations(t)
+	db.On("GetIngestHash", ctx, devID).Return(
+		func(context.Context, model.DeviceID) string {
+			return hash
+		}, nil)
+	db.On("SetIngestHash", ctx, devID,
+		mock.AnythingOfType("string"),
+		mock.MatchedBy(func(expire time.Time) bool {
+			return assert.WithinDuration(t, time.Now().Add(time.Hour), expire, time.Minute)
+		}),
+	).Run(func(args mock.Arguments) {
+		hash = args.String(2)
+	}).Return(nil)
+	db.On("GetDevice", ctx, devID).Return(device, nil)
+	db.On("UpsertDevicesAttributesWithUpdated",
+		ctx,
+		[]model.DeviceID{devID},
+		mock.AnythingOfType("model.DeviceAttributes"),
+		model.AttrScopeInventory,
+		"",
+	).Return(&model.UpdateResult{}, nil)
+	db.On("IncrementAttributesChurn",
+		ctx,
+		mock.AnythingOfType("model.DeviceAttributes"),
+	).Return(nil)
+	i := invForTest(db).WithIngestDedupWindow(time.Hour)
+
+	upsert := func(attrs ...model.DeviceAttribute) {
+		err := i.UpsertAttributesWithUpdated(ctx, devID, attrs, model.AttrScopeInventory, "")
+		assert.NoError(t, err)
+	}
+	foo := model.DeviceAttribute{Name: "foo", Value: "1", Scope: model.AttrScopeInventory}
+	bar := model.DeviceAttribute{Name: "bar", Value: "a", Scope: model.AttrScopeInventory}
+
+	upsert(foo, bar)
+	db.AssertNumberOfCalls(t, "UpsertDevicesAttributesWithUpdated", 1)
+
+	// identical payloads, in any order, are skipped within the window
+	upsert(foo, bar)
+	upsert(bar, foo)
+	db.AssertNumberOfCalls(t, "UpsertDevicesAttributesWithUpdated", 1)
+	db.AssertNumberOfCalls(t, "GetDevice", 1)
+
+	bar.Value = "b"
+	upsert(foo, bar)
+	db.AssertNumberOfCalls(t, "UpsertDevicesAttributesWithUpdated", 2)
+
+	// once the hash expired, the identical payload is written again
+	hash = ""
+	upsert(foo, bar)
+	db.AssertNumberOfCalls(t, "UpsertDevicesAttributesWithUpdated", 3)
+}
+
+func TestInventoryFindDevicesWithDuplicateAttributes(t *testing.T) {
+	t.Parallel()
+
+	devices := []model.DeviceDuplicateAttributes{{
+		DeviceID: "1",
+		Attributes: []model.DuplicateAttribute{{
+			Name:  "mac",
+			Scope: model.AttrScopeInventory,
+			Keys:  []string{"inventory-mac", "inventory-legacy-mac"},
+		}},
+	}}
+
+	testCases := map[string]struct {
+		datastoreResult []model.DeviceDuplicateAttributes
+		datastoreError  error
+		outError        string
+	}{
+		"ok": {
+			datastoreResult: devices,
+		},
+		"datastore error": {
+			datastoreError: errors.New("db connection failed"),
+			outError:       "failed to find devices with duplicate attributes: db connection failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			defer db.AssertExpectations(t)
+			db.On("FindDevicesWithDuplicateAttributes", ctx, 10, 5).
+				Return(tc.datastoreResult, tc.datastoreError)
+
+			i := invForTest(db)
+
+			res, err := i.FindDevicesWithDuplicateAttributes(ctx, 10, 5)
+			if tc.outError != "" {
+				assert.EqualError(t, err, tc.outError)
+				assert.Nil(t, res)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.datastoreResult, res)
+			}
+		})
+	}
+}
+
+func TestInventoryVerifyDeviceAttributes(t *testing.T) {
+	t.Parallel()
+
+	const devID = model.DeviceID("1")
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		report := &model.DeviceAttributesReport{
+			DeviceID: devID,
+			Issues: []model.AttributeIssue{{
+				Key:   "-sn",
+				Name:  "sn",
+				Issue: model.AttributeIssueMissingScope,
+			}},
+		}
+		db.On("VerifyDeviceAttributes", ctx, devID).Return(report, nil)
+		i := invForTest(db)
+
+		res, err := i.VerifyDeviceAttributes(ctx, devID)
+		assert.NoError(t, err)
+		assert.Equal(t, report, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("VerifyDeviceAttributes", ctx, devID).Return(nil, store.ErrDevNotFound)
+		i := invForTest(db)
+
+		res, err := i.VerifyDeviceAttributes(ctx, devID)
+		assert.EqualError(t, err, "failed to verify the device attributes: Device not found")
+		assert.Nil(t, res)
+	})
+}
+
+func TestInventoryRepairDuplicateAttributes(t *testing.T) {
+	t.Parallel()
+
+	const devID = model.DeviceID("1")
+
+	testCases := map[string]struct {
+		removed        int
+		datastoreError error
+		outError       string
+	}{
+		"ok": {
+			removed: 2,
+		},
+		"ok, nothing to repair": {
+			removed: 0,
+		},
+		"datastore error": {
+			datastoreError: errors.New("db connection failed"),
+			outError:       "failed to repair duplicate attributes: db connection failed",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			defer db.AssertExpectations(t)
+			db.On("RepairDuplicateAttributes", ctx, devID).
+				Return(tc.removed, tc.datastoreError)
+
+			workflows := &mworkflows.Client{}
+			defer workflows.AssertExpectations(t)
+			if tc.removed > 0 {
+				workflows.On("StartReindex",
+					ctx,
+					[]model.DeviceID{devID},
+				).Return(nil)
+			}
+
+			i := invForTest(db).WithReporting(workflows)
+
+			removed, err := i.RepairDuplicateAttributes(ctx, devID)
+			if tc.outError != "" {
+				assert.EqualError(t, err, tc.outError)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.removed, removed)
+		})
+	}
+}
+
+func TestInventoryGetAttributesChurn(t *testing.T) {
+	t.Parallel()
+
+	churn := []model.AttributeChurn{
+		{Name: "uptime", Scope: model.AttrScopeInventory, Count: 2},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetAttributesChurn", ctx).Return(churn, nil)
+		i := invForTest(db)
+
+		res, err := i.GetAttributesChurn(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, churn, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetAttributesChurn", ctx).Return(nil, errors.New("db error"))
+		i := invForTest(db)
+
+		res, err := i.GetAttributesChurn(ctx)
+		assert.EqualError(t, err, "failed to get the attributes churn: db error")
+		assert.Nil(t, res)
+	})
+}
+
+func TestInventoryGetDevicesAttributesCount(t *testing.T) {
+	t.Parallel()
+
+	ids := []model.DeviceID{"1", "2"}
+	counts := map[model.DeviceID]int{"1": 7}
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetDevicesAttributesCount", ctx, ids).Return(counts, nil)
+		i := invForTest(db)
+
+		res, err := i.GetDevicesAttributesCount(ctx, ids)
+		assert.NoError(t, err)
+		assert.Equal(t, counts, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetDevicesAttributesCount", ctx, ids).Return(nil, errors.New("db error"))
+		i := invForTest(db)
+
+		res, err := i.GetDevicesAttributesCount(ctx, ids)
+		assert.EqualError(t, err, "failed to count the devices' attributes: db error")
+		assert.Nil(t, res)
+	})
+}
+
+func TestInventoryGetDevicesStatuses(t *testing.T) {
+	t.Parallel()
+
+	ids := []model.DeviceID{"1", "2"}
+	accepted := "accepted"
+	statuses := map[model.DeviceID]*string{"1": &accepted, "2": nil}
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetDevicesStatuses", ctx, ids).Return(statuses, nil)
+		i := invForTest(db)
+
+		res, err := i.GetDevicesStatuses(ctx, ids)
+		assert.NoError(t, err)
+		assert.Equal(t, statuses, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetDevicesStatuses", ctx, ids).Return(nil, errors.New("db error"))
+		i := invForTest(db)
+
+		res, err := i.GetDevicesStatuses(ctx, ids)
+		assert.EqualError(t, err, "failed to get the devices' statuses: db error")
+		assert.Nil(t, res)
+	})
+}
+
+func TestInventoryGetOnboardingStats(t *testing.T) {
+	t.Parallel()
+
+	day := func(d int) time.Time {
+		return time.Date(2023, 3, d, 0, 0, 0, 0, time.UTC)
+	}
+	// 2023-03-06 and 2023-03-13 are Mondays
+	counts := map[time.Time]int{day(1): 2, day(3): 1, day(6): 4, day(13): 5}
+
+	testCases := map[string]struct {
+		params model.OnboardingStatsParams
+		counts map[time.Time]int
+		err    error
+
+		stats    []model.TimeBucketCount
+		outError string
+	}{
+		"ok, days": {
+			params: model.OnboardingStatsParams{
+				From: day(1), To: day(5), Granularity: model.BucketDay,
+			},
+			counts: counts,
+			stats: []model.TimeBucketCount{
+				{Bucket: day(1), Count: 2},
+				{Bucket: day(2), Count: 0},
+				{Bucket: day(3), Count: 1},
+				{Bucket: day(4), Count: 0},
+			},
+		},
+		"ok, weeks": {
+			params: model.OnboardingStatsParams{
+				From: day(1), To: day(14), Granularity: model.BucketWeek,
+			},
+			counts: counts,
+			stats: []model.TimeBucketCount{
+				{Bucket: time.Date(2023, 2, 27, 0, 0, 0, 0, time.UTC), Count: 3},
+				{Bucket: day(6), Count: 4},
+				{Bucket: day(13), Count: 5},
+			},
+		},
+		"ok, empty range": {
+			params: model.OnboardingStatsParams{
+				From: day(20), To: day(22), Granularity: model.BucketDay,
+			},
+			counts: map[time.Time]int{},
+			stats: []model.TimeBucketCount{
+				{Bucket: day(20), Count: 0},
+				{Bucket: day(21), Count: 0},
+			},
+		},
+		"error": {
+			params: model.OnboardingStatsParams{
+				From: day(1), To: day(5), Granularity: model.BucketDay,
+			},
+			err:      errors.New("db error"),
+			outError: "failed to count the created devices: db error",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			db := &mstore.DataStore{}
+			defer db.AssertExpectations(t)
+
+			db.On("CountDevicesCreatedPerDay", ctx, tc.params.From, tc.params.To).
+				Return(tc.counts, tc.err)
+			i := invForTest(db)
+
+			stats, err := i.GetOnboardingStats(ctx, tc.params)
+			if tc.outError != "" {
+				assert.EqualError(t, err, tc.outError)
+				assert.Nil(t, stats)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.stats, stats)
+			}
+		})
+	}
+}
+
+func TestInventoryGetAlertsSummary(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		counts map[string]int
+		err    error
+
+		summary  *model.AlertsSummary
+		outError string
+	}{
+		"ok": {
+			counts: map[string]int{
+				model.AlertCountBucketNone: 4,
+				model.AlertCountBucketFew:  2,
+				model.AlertCountBucketMany: 1,
+			},
+			summary: &model.AlertsSummary{
+				WithAlerts:    3,
+				WithoutAlerts: 4,
+				Buckets: []model.AlertCountBucket{
+					{Bucket: model.AlertCountBucketNone, Count: 4},
+					{Bucket: model.AlertCountBucketFew, Count: 2},
+					{Bucket: model.AlertCountBucketMany, Count: 1},
+				},
+			},
+		},
+		"ok, empty buckets": {
+			counts: map[string]int{
+				model.AlertCountBucketMany: 1,
+			},
+			summary: &model.AlertsSummary{
+				WithAlerts: 1,
+				Buckets: []model.AlertCountBucket{
+					{Bucket: model.AlertCountBucketNone, Count: 0},
+					{Bucket: model.AlertCountBucketFew, Count: 0},
+					{Bucket: model.AlertCountBucketMany, Count: 1},
+				},
+			},
+		},
+		"error": {
+			err:      errors.New("db error"),
+			outError: "failed to count the devices by alert count: db error",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			db := &mstore.DataStore{}
+			defer db.AssertExpectations(t)
+
+			db.On("CountDevicesByAlertCount", ctx, model.AttrScopeMonitor).
+				Return(tc.counts, tc.err)
+			i := invForTest(db)
+
+			summary, err := i.GetAlertsSummary(ctx, model.AttrScopeMonitor)
+			if tc.outError != "" {
+				assert.EqualError(t, err, tc.outError)
+				assert.Nil(t, summary)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.summary, summary)
+			}
+		})
+	}
+}
+
+func TestInventoryExplainSearchDevices(t *testing.T) {
+	t.Parallel()
+
+	searchParams := model.SearchParams{Page: 1, PerPage: 20}
+	plan := map[string]interface{}{"ok": 1.0}
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("ExplainSearchDevices", ctx, searchParams).Return(plan, nil)
+		i := invForTest(db)
+
+		res, err := i.ExplainSearchDevices(ctx, searchParams)
+		assert.NoError(t, err)
+		assert.Equal(t, plan, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("ExplainSearchDevices", ctx, searchParams).
+			Return(nil, errors.New("db error"))
+		i := invForTest(db)
+
+		res, err := i.ExplainSearchDevices(ctx, searchParams)
+		assert.EqualError(t, err, "failed to explain the devices search: db error")
+		assert.Nil(t, res)
+	})
+}
+
+func TestInventoryTopAttributeValues(t *testing.T) {
+	t.Parallel()
+
+	values := []model.AttributeValueCount{
+		{Value: "rpi4", Count: 5},
+		{Value: "rpi3", Count: 3},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("TopAttributeValues", ctx, model.AttrScopeInventory, "device_type", 2).
+			Return(values, nil)
+		i := invForTest(db)
+
+		res, err := i.TopAttributeValues(ctx, model.AttrScopeInventory, "device_type", 2)
+		assert.NoError(t, err)
+		assert.Equal(t, values, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("TopAttributeValues", ctx, model.AttrScopeInventory, "device_type", 2).
+			Return(nil, errors.New("db error"))
+		i := invForTest(db)
+
+		res, err := i.TopAttributeValues(ctx, model.AttrScopeInventory, "device_type", 2)
+		assert.EqualError(t, err,
+			"failed to get the top attribute values from the db: db error")
+		assert.Nil(t, res)
+	})
+}
+
+func TestInventoryAttributeCardinality(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("AttributeCardinality", ctx, model.AttrScopeInventory, "device_type").
+			Return(4, nil)
+		i := invForTest(db)
+
+		res, err := i.AttributeCardinality(ctx, model.AttrScopeInventory, "device_type")
+		assert.NoError(t, err)
+		assert.Equal(t, 4, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("AttributeCardinality", ctx, model.AttrScopeInventory, "device_type").
+			Return(-1, errors.New("db error"))
+		i := invForTest(db)
+
+		res, err := i.AttributeCardinality(ctx, model.AttrScopeInventory, "device_type")
+		assert.EqualError(t, err,
+			"failed to get the attribute cardinality from the db: db error")
+		assert.Equal(t, -1, res)
+	})
+}
+
+func TestInventoryGetAttributesCoverage(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("CountDevicesByAttribute", ctx).Return([]model.AttributeCoverage{
+			{Name: "mac", Scope: model.AttrScopeIdentity, Count: 4},
+			{Name: "device_type", Scope: model.AttrScopeInventory, Count: 3},
+			{Name: "foo", Scope: model.AttrScopeTags, Count: 1},
+		}, 4, nil)
+		i := invForTest(db)
+
+		res, err := i.GetAttributesCoverage(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []model.AttributeCoverage{
+			{Name: "mac", Scope: model.AttrScopeIdentity, Count: 4, Coverage: 100},
+			{Name: "device_type", Scope: model.AttrScopeInventory, Count: 3, Coverage: 75},
+			{Name: "foo", Scope: model.AttrScopeTags, Count: 1, Coverage: 25},
+		}, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("CountDevicesByAttribute", ctx).Return(nil, -1, errors.New("db error"))
+		i := invForTest(db)
+
+		res, err := i.GetAttributesCoverage(ctx)
+		assert.EqualError(t, err,
+			"failed to count the devices by attribute in the db: db error")
+		assert.Nil(t, res)
+	})
+}
+
+func TestInventoryGetAttributeScopes(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		scopes := []string{model.AttrScopeIdentity, model.AttrScopeSystem}
+		db.On("GetAttributeScopes", ctx).Return(scopes, nil)
+		i := invForTest(db)
+
+		res, err := i.GetAttributeScopes(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, scopes, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetAttributeScopes", ctx).Return(nil, errors.New("db error"))
+		i := invForTest(db)
+
+		res, err := i.GetAttributeScopes(ctx)
+		assert.EqualError(t, err,
+			"failed to get the attribute scopes from the db: db error")
+		assert.Nil(t, res)
+	})
+}
+
+func TestInventorySampleDevices(t *testing.T) {
+	t.Parallel()
+
+	filters := []model.FilterPredicate{{
+		Scope:     model.AttrScopeInventory,
+		Attribute: "device_type",
+		Type:      "$eq",
+		Value:     "rpi4",
+	}}
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		devices := []model.Device{{ID: "1"}, {ID: "2"}}
+		db.On("SampleDevices", ctx, 2, filters).Return(devices, nil)
+		i := invForTest(db)
+
+		res, err := i.SampleDevices(ctx, 2, filters)
+		assert.NoError(t, err)
+		assert.Equal(t, devices, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("SampleDevices", ctx, 2, filters).Return(nil, errors.New("db error"))
+		i := invForTest(db)
+
+		res, err := i.SampleDevices(ctx, 2, filters)
+		assert.EqualError(t, err, "failed to sample the devices: db error")
+		assert.Nil(t, res)
+	})
+}
+
+func TestInventoryCreateSavedFilter(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("CreateSavedFilter", ctx,
+			mock.MatchedBy(func(filter *model.SavedFilter) bool {
+				return filter.ID != ""
+			}),
+		).Return(nil)
+		i := invForTest(db)
+
+		filter := &model.SavedFilter{Name: "qemu"}
+		err := i.CreateSavedFilter(ctx, filter)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, filter.ID)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("CreateSavedFilter", ctx, mock.AnythingOfType("*model.SavedFilter")).
+			Return(errors.New("db error"))
+		i := invForTest(db)
+
+		err := i.CreateSavedFilter(ctx, &model.SavedFilter{Name: "qemu"})
+		assert.EqualError(t, err, "failed to store the filter: db error")
+	})
+}
+
+func TestInventoryGetSavedFilter(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		filter := &model.SavedFilter{ID: "1", Name: "qemu"}
+		db.On("GetSavedFilter", ctx, "1").Return(filter, nil)
+		i := invForTest(db)
+
+		res, err := i.GetSavedFilter(ctx, "1")
+		assert.NoError(t, err)
+		assert.Equal(t, filter, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetSavedFilter", ctx, "1").Return(nil, store.ErrFilterNotFound)
+		i := invForTest(db)
+
+		res, err := i.GetSavedFilter(ctx, "1")
+		assert.EqualError(t, err, "failed to get the filter: filter not found")
+		assert.Nil(t, res)
+	})
+}
+
+func TestInventoryFeatureFlags(t *testing.T) {
+	t.Parallel()
+
+	flags := model.FeatureFlags{model.FeatureAddDeviceCreateOnly: true}
+
+	t.Run("get", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetFeatureFlags", ctx).Return(flags, nil).Once()
+		db.On("GetFeatureFlags", ctx).Return(nil, errors.New("db error")).Once()
+		i := invForTest(db)
+
+		res, err := i.GetFeatureFlags(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, flags, res)
+
+		res, err = i.GetFeatureFlags(ctx)
+		assert.EqualError(t, err, "failed to get the feature flags: db error")
+		assert.Nil(t, res)
+	})
+
+	t.Run("set", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("SetFeatureFlags", ctx, flags).Return(nil).Once()
+		db.On("SetFeatureFlags", ctx, flags).Return(errors.New("db error")).Once()
+		i := invForTest(db)
+
+		err := i.SetFeatureFlags(ctx, flags)
+		assert.NoError(t, err)
+
+		err = i.SetFeatureFlags(ctx, flags)
+		assert.EqualError(t, err, "failed to set the feature flags: db error")
+	})
+}
+
+func TestInventoryFindDevicesByAttributeValues(t *testing.T) {
+	t.Parallel()
+
+	values := []interface{}{"00:11", "00:22"}
+	devices := []model.Device{{ID: "1"}, {ID: "2"}}
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("FindDevicesByAttributeValues", ctx, model.AttrScopeIdentity, "mac", values).
+			Return(devices, nil)
+		i := invForTest(db)
+
+		res, err := i.FindDevicesByAttributeValues(ctx, model.AttrScopeIdentity, "mac", values)
+		assert.NoError(t, err)
+		assert.Equal(t, devices, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("FindDevicesByAttributeValues", ctx, model.AttrScopeIdentity, "mac", values).
+			Return(nil, errors.New("db error"))
+		i := invForTest(db)
+
+		res, err := i.FindDevicesByAttributeValues(ctx, model.AttrScopeIdentity, "mac", values)
+		assert.EqualError(t, err, "failed to find the devices by attribute values: db error")
+		assert.Nil(t, res)
+	})
+}
+
+func TestInventoryFindDevicesWithAttributeDrift(t *testing.T) {
+	t.Parallel()
+
+	devices := []model.Device{{ID: "1"}, {ID: "2"}}
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("FindDevicesWithAttributeDrift", ctx, model.AttrScopeInventory, "kernel", "5.15").
+			Return(devices, nil)
+		i := invForTest(db)
+
+		res, err := i.FindDevicesWithAttributeDrift(ctx, model.AttrScopeInventory, "kernel", "5.15")
+		assert.NoError(t, err)
+		assert.Equal(t, devices, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("FindDevicesWithAttributeDrift", ctx, model.AttrScopeInventory, "kernel", "5.15").
+			Return(nil, errors.New("db error"))
+		i := invForTest(db)
+
+		res, err := i.FindDevicesWithAttributeDrift(ctx, model.AttrScopeInventory, "kernel", "5.15")
+		assert.EqualError(t, err, "failed to find the devices with attribute drift: db error")
+		assert.Nil(t, res)
+	})
+}
+
+func TestInventoryFindDevicesByAttributeSet(t *testing.T) {
+	t.Parallel()
+
+	attrs := model.DeviceAttributes{
+		{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+		{Name: "sn", Value: "0001", Scope: model.AttrScopeIdentity},
+	}
+	devices := []model.Device{{ID: "1"}}
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("FindDevicesByAttributeSet", ctx, model.AttrScopeIdentity, attrs).
+			Return(devices, nil)
+		i := invForTest(db)
+
+		res, err := i.FindDevicesByAttributeSet(ctx, model.AttrScopeIdentity, attrs)
+		assert.NoError(t, err)
+		assert.Equal(t, devices, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("FindDevicesByAttributeSet", ctx, model.AttrScopeIdentity, attrs).
+			Return(nil, errors.New("db error"))
+		i := invForTest(db)
+
+		res, err := i.FindDevicesByAttributeSet(ctx, model.AttrScopeIdentity, attrs)
+		assert.EqualError(t, err, "failed to find the devices by attribute set: db error")
+		assert.Nil(t, res)
+	})
+}
+
+func TestInventoryGetAttributesPresence(t *testing.T) {
+	t.Parallel()
+
+	ids := []model.DeviceID{"1", "2"}
+	attributes := []model.SelectAttribute{
+		{Scope: model.AttrScopeInventory, Attribute: "os"},
+	}
+	presence := map[model.DeviceID][]bool{"1": {true}, "2": {false}}
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetAttributesPresence", ctx, ids, attributes).
+			Return(presence, nil)
+		i := invForTest(db)
+
+		res, err := i.GetAttributesPresence(ctx, ids, attributes)
+		assert.NoError(t, err)
+		assert.Equal(t, presence, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetAttributesPresence", ctx, ids, attributes).
+			Return(nil, errors.New("db error"))
+		i := invForTest(db)
+
+		res, err := i.GetAttributesPresence(ctx, ids, attributes)
+		assert.EqualError(t, err, "failed to get the attributes presence: db error")
+		assert.Nil(t, res)
+	})
+}
+
+func TestReplaceAttributes(t *testing.T) {
+	t.Parallel()
+
+	updateResult := &model.UpdateResult{
+		Devices: []*model.Device{
+			{
+				ID: "1",
+			},
+		},
+		MatchedCount: 1,
+	}
+
+	testCases := map[string]struct {
+		deviceID        model.DeviceID
+		getDevice       *model.Device
+		getDeviceErr    error
+		dataStoreResult *model.UpdateResult
+		datastoreError  error
+		limitAttributes int
+		limitTags       int
+
+		upsertAttrs model.DeviceAttributes
+		removeAttrs model.DeviceAttributes
+		outError    error
+
+		scope string
+		etag  string
+	}{
+		"ok, device not found": {
+			deviceID:     "1",
+			getDevice:    nil,
+			getDeviceErr: store.ErrDevNotFound,
+
+			upsertAttrs: model.DeviceAttributes{
+				model.DeviceAttribute{
+					Name:  "name",
+					Value: "foo",
+					Scope: model.AttrScopeInventory,
+				},
+				model.DeviceAttribute{
+					Name:  "ip_address",
+					Value: "127.0.0.1",
+					Scope: model.AttrScopeInventory,
+				},
+			},
+			removeAttrs: model.DeviceAttributes{},
+
+			dataStoreResult: nil,
+			datastoreError:  nil,
+			outError:        nil,
+
+			scope: model.AttrScopeInventory,
+		},
+		"ok, device found": {
+			deviceID: "1",
+			getDevice: &model.Device{
+				Attributes: model.DeviceAttributes{},
+			},
+			getDeviceErr: nil,
+
+			upsertAttrs: model.DeviceAttributes{
+				model.DeviceAttribute{
+					Name:  "name",
+					Value: "foo",
+					Scope: model.AttrScopeInventory,
+				},
+				model.DeviceAttribute{
+					Name:  "ip_address",
+					Value: "127.0.0.1",
+					Scope: model.AttrScopeInventory,
+				},
+			},
+			removeAttrs: model.DeviceAttributes{},
+
+			dataStoreResult: updateResult,
+			datastoreError:  nil,
+			outError:        nil,
+
+			scope: model.AttrScopeInventory,
+		},
+		"ok, device found, replace attributes": {
+			deviceID: "1",
+			getDevice: &model.Device{
+				Attributes: model.DeviceAttributes{
+					model.DeviceAttribute{
+						Name:  "name",
+						Value: "foo",
+						Scope: model.AttrScopeInventory,
+					},
+					model.DeviceAttribute{
+						Name:  "custom",
+						Value: "bar",
+						Scope: model.AttrScopeInventory,
+					},
+				},
+			},
+			getDeviceErr: nil,
+
+			upsertAttrs: model.DeviceAttributes{
+				model.DeviceAttribute{
 					Name:  "name",
 					Value: "foo",
 					Scope: model.AttrScopeInventory,
@@ -1146,39 +2600,157 @@ func TestReplaceAttributes(t *testing.T) {
 			defer db.AssertExpectations(t)
 
 			if tc.outError != ErrTooManyAttributes {
-				db.On("GetDevice",
-					ctx,
-					tc.deviceID,
-				).Return(tc.getDevice, tc.getDeviceErr)
+				db.On("GetDevice",
+					ctx,
+					tc.deviceID,
+				).Return(tc.getDevice, tc.getDeviceErr)
+			}
+
+			if (tc.getDeviceErr == nil || tc.getDeviceErr == store.ErrDevNotFound) && tc.outError != ErrTooManyAttributes {
+				db.On("UpsertRemoveDeviceAttributes",
+					ctx,
+					tc.deviceID,
+					tc.upsertAttrs,
+					tc.removeAttrs,
+					tc.scope,
+					tc.etag,
+				).Return(tc.dataStoreResult, tc.datastoreError)
+
+				if (tc.getDeviceErr == nil || tc.getDeviceErr == store.ErrDevNotFound) &&
+					tc.datastoreError == nil && tc.dataStoreResult != nil {
+					db.On("UpdateDeviceText",
+						ctx,
+						tc.dataStoreResult.Devices[0].ID,
+						utils.GetTextField(tc.dataStoreResult.Devices[0]),
+					).Return(nil)
+				}
+			}
+
+			db.On("IncrementAttributesChurn",
+				ctx,
+				mock.AnythingOfType("model.DeviceAttributes"),
+			).Return(nil).Maybe()
+
+			i := invForTest(db).WithLimits(tc.limitAttributes, tc.limitTags)
+			err := i.ReplaceAttributes(ctx, tc.deviceID, tc.upsertAttrs, tc.scope, tc.etag)
+
+			if tc.outError != nil {
+				if assert.Error(t, err) {
+					assert.EqualError(t, err, tc.outError.Error())
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestReplaceAllAttributes(t *testing.T) {
+	t.Parallel()
+
+	attrs := model.DeviceAttributes{
+		{Name: "mac", Value: "00:22", Scope: model.AttrScopeIdentity},
+		{Name: "kernel", Value: "6.1", Scope: model.AttrScopeInventory},
+		{Name: "room", Value: "2", Scope: model.AttrScopeTags},
+	}
+	device := &model.Device{
+		ID: "1",
+		Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+			{Name: "os", Value: "linux", Scope: model.AttrScopeInventory},
+			{Name: "room", Value: "2", Scope: model.AttrScopeTags},
+			{Name: model.AttrNameGroup, Value: "grp", Scope: model.AttrScopeSystem},
+		},
+	}
+	replacedDevice := &model.Device{
+		ID:         "1",
+		Attributes: append(attrs, device.Attributes[3]),
+	}
+
+	testCases := map[string]struct {
+		attrs           model.DeviceAttributes
+		limitAttributes int
+
+		getDevice    *model.Device
+		getDeviceErr error
+		replaceErr   error
+
+		churnAttrs model.DeviceAttributes
+		outError   error
+	}{
+		"ok": {
+			attrs:     attrs,
+			getDevice: device,
+
+			churnAttrs: model.DeviceAttributes{
+				attrs[0],
+				attrs[1],
+				device.Attributes[1],
+			},
+		},
+		"ko, too many attributes": {
+			attrs: append(model.DeviceAttributes{
+				{Name: "os", Value: "linux", Scope: model.AttrScopeInventory},
+			}, attrs...),
+			limitAttributes: 1,
+			getDevice:       device,
+
+			outError: ErrTooManyAttributes,
+		},
+		"ko, device not found": {
+			attrs: attrs,
+
+			outError: store.ErrDevNotFound,
+		},
+		"ko, get device error": {
+			attrs:        attrs,
+			getDeviceErr: errors.New("get device error"),
+
+			outError: errors.New("failed to get the device: get device error"),
+		},
+		"ko, datastore error": {
+			attrs:      attrs,
+			getDevice:  device,
+			replaceErr: errors.New("replace error"),
+
+			outError: errors.New(
+				"failed to replace the attributes in db: replace error"),
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			defer db.AssertExpectations(t)
+
+			if tc.outError != ErrTooManyAttributes {
+				db.On("GetDevice", ctx, model.DeviceID("1")).
+					Return(tc.getDevice, tc.getDeviceErr).Once()
 			}
-
-			if (tc.getDeviceErr == nil || tc.getDeviceErr == store.ErrDevNotFound) && tc.outError != ErrTooManyAttributes {
-				db.On("UpsertRemoveDeviceAttributes",
+			if tc.getDevice != nil && tc.outError != ErrTooManyAttributes {
+				db.On("ReplaceAllAttributes", ctx, model.DeviceID("1"), tc.attrs).
+					Return(tc.replaceErr)
+			}
+			if tc.outError == nil {
+				db.On("IncrementAttributesChurn", ctx, tc.churnAttrs).
+					Return(nil)
+				db.On("GetDevice", ctx, model.DeviceID("1")).
+					Return(replacedDevice, nil).Once()
+				db.On("UpdateDeviceText",
 					ctx,
-					tc.deviceID,
-					tc.upsertAttrs,
-					tc.removeAttrs,
-					tc.scope,
-					tc.etag,
-				).Return(tc.dataStoreResult, tc.datastoreError)
-
-				if (tc.getDeviceErr == nil || tc.getDeviceErr == store.ErrDevNotFound) &&
-					tc.datastoreError == nil && tc.dataStoreResult != nil {
-					db.On("UpdateDeviceText",
-						ctx,
-						tc.dataStoreResult.Devices[0].ID,
-						utils.GetTextField(tc.dataStoreResult.Devices[0]),
-					).Return(nil)
-				}
+					model.DeviceID("1"),
+					utils.GetTextField(replacedDevice),
+				).Return(nil)
 			}
 
-			i := invForTest(db).WithLimits(tc.limitAttributes, tc.limitTags)
-			err := i.ReplaceAttributes(ctx, tc.deviceID, tc.upsertAttrs, tc.scope, tc.etag)
-
+			i := invForTest(db).WithLimits(tc.limitAttributes, 0)
+			err := i.ReplaceAllAttributes(ctx, model.DeviceID("1"), tc.attrs)
 			if tc.outError != nil {
-				if assert.Error(t, err) {
-					assert.EqualError(t, err, tc.outError.Error())
-				}
+				assert.EqualError(t, err, tc.outError.Error())
 			} else {
 				assert.NoError(t, err)
 			}
@@ -1186,6 +2758,173 @@ func TestReplaceAttributes(t *testing.T) {
 	}
 }
 
+func TestInventoryToggleAttribute(t *testing.T) {
+	t.Parallel()
+
+	device := &model.Device{
+		ID: model.DeviceID("1"),
+		Attributes: model.DeviceAttributes{
+			{Name: "maintenance", Value: true, Scope: model.AttrScopeTags},
+		},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("ToggleAttribute",
+			ctx, model.DeviceID("1"), model.AttrScopeTags, "maintenance", false,
+		).Return(device, nil)
+		db.On("UpdateDeviceText",
+			ctx,
+			model.DeviceID("1"),
+			utils.GetTextField(device),
+		).Return(nil)
+		i := invForTest(db)
+
+		value, err := i.ToggleAttribute(
+			ctx, model.DeviceID("1"), model.AttrScopeTags, "maintenance", false,
+		)
+		assert.NoError(t, err)
+		assert.True(t, value)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("ToggleAttribute",
+			ctx, model.DeviceID("1"), model.AttrScopeTags, "maintenance", false,
+		).Return(nil, store.ErrAttributeTypeConflict)
+		i := invForTest(db)
+
+		_, err := i.ToggleAttribute(
+			ctx, model.DeviceID("1"), model.AttrScopeTags, "maintenance", false,
+		)
+		assert.EqualError(t, err, "failed to toggle the attribute in db: "+
+			store.ErrAttributeTypeConflict.Error())
+	})
+}
+
+func TestInventoryMoveAttributesBetweenScopes(t *testing.T) {
+	t.Parallel()
+
+	device := &model.Device{
+		ID: model.DeviceID("1"),
+		Attributes: model.DeviceAttributes{
+			{Name: "cpu", Value: "arm", Scope: model.AttrScopeInventory},
+		},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("MoveAttributesBetweenScopes", ctx, model.DeviceID("1"),
+			model.AttrScopeMonitor, model.AttrScopeInventory, model.MergePolicyKeep,
+		).Return(device, nil)
+		db.On("UpdateDeviceText",
+			ctx,
+			model.DeviceID("1"),
+			utils.GetTextField(device),
+		).Return(nil)
+		i := invForTest(db)
+
+		err := i.MoveAttributesBetweenScopes(ctx, model.DeviceID("1"),
+			model.AttrScopeMonitor, model.AttrScopeInventory, model.MergePolicyKeep)
+		assert.NoError(t, err)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("MoveAttributesBetweenScopes", ctx, model.DeviceID("1"),
+			model.AttrScopeMonitor, model.AttrScopeInventory, model.MergePolicyKeep,
+		).Return(nil, store.ErrDevNotFound)
+		i := invForTest(db)
+
+		err := i.MoveAttributesBetweenScopes(ctx, model.DeviceID("1"),
+			model.AttrScopeMonitor, model.AttrScopeInventory, model.MergePolicyKeep)
+		assert.EqualError(t, err, "failed to move the attributes in db: "+
+			store.ErrDevNotFound.Error())
+	})
+}
+
+func TestInventoryGetDevicesWithStaleScope(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		devices := []model.Device{{ID: model.DeviceID("1")}}
+		db.On("GetDevicesWithStaleScope", ctx, model.AttrScopeMonitor, time.Hour).
+			Return(devices, nil)
+		i := invForTest(db)
+
+		res, err := i.GetDevicesWithStaleScope(ctx, model.AttrScopeMonitor, time.Hour)
+		assert.NoError(t, err)
+		assert.Equal(t, devices, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetDevicesWithStaleScope", ctx, model.AttrScopeMonitor, time.Hour).
+			Return(nil, errors.New("db error"))
+		i := invForTest(db)
+
+		res, err := i.GetDevicesWithStaleScope(ctx, model.AttrScopeMonitor, time.Hour)
+		assert.EqualError(t, err,
+			"failed to get the devices with stale scope from the db: db error")
+		assert.Nil(t, res)
+	})
+}
+
+func TestInventoryGetDevicesUpdatedByScopeSince(t *testing.T) {
+	t.Parallel()
+
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		devices := []model.Device{{ID: model.DeviceID("1")}}
+		db.On("GetDevicesUpdatedByScopeSince", ctx, model.AttrScopeMonitor, since).
+			Return(devices, nil)
+		i := invForTest(db)
+
+		res, err := i.GetDevicesUpdatedByScopeSince(ctx, model.AttrScopeMonitor, since)
+		assert.NoError(t, err)
+		assert.Equal(t, devices, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetDevicesUpdatedByScopeSince", ctx, model.AttrScopeMonitor, since).
+			Return(nil, errors.New("db error"))
+		i := invForTest(db)
+
+		res, err := i.GetDevicesUpdatedByScopeSince(ctx, model.AttrScopeMonitor, since)
+		assert.EqualError(t, err,
+			"failed to get the devices updated by scope from the db: db error")
+		assert.Nil(t, res)
+	})
+}
+
 func TestGetFiltersAttributes(t *testing.T) {
 	t.Parallel()
 
@@ -1234,6 +2973,93 @@ func TestGetFiltersAttributes(t *testing.T) {
 	}
 }
 
+func TestGetDescribedAttributes(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		attributes []model.DescribedAttribute
+		err        error
+		outErr     error
+	}{
+		"ok": {
+			attributes: []model.DescribedAttribute{
+				{
+					Name:        "mac",
+					Scope:       "identity",
+					Description: "MAC address",
+				},
+			},
+		},
+		"ko": {
+			err:    errors.New("error"),
+			outErr: errors.New("failed to get described attributes from the db: error"),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetDescribedAttributes",
+				ctx,
+			).Return(tc.attributes, tc.err)
+
+			i := invForTest(db)
+			attributes, err := i.GetDescribedAttributes(ctx)
+			assert.Equal(t, tc.attributes, attributes)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.outErr.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestGetGroupSchema(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		attributes []model.SchemaAttribute
+		err        error
+		outErr     error
+	}{
+		"ok": {
+			attributes: []model.SchemaAttribute{
+				{
+					Name:  "uptime",
+					Scope: "inventory",
+					Types: []string{model.AttrTypeNumber, model.AttrTypeString},
+				},
+			},
+		},
+		"ko": {
+			err:    errors.New("error"),
+			outErr: errors.New("failed to get the group schema from the db: error"),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetGroupSchema",
+				ctx,
+				model.GroupName("prod"),
+			).Return(tc.attributes, tc.err)
+
+			i := invForTest(db)
+			attributes, err := i.GetGroupSchema(ctx, "prod")
+			assert.Equal(t, tc.attributes, attributes)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.outErr.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
 func TestDeleteGroup(t *testing.T) {
 	t.Parallel()
 
@@ -1488,11 +3314,11 @@ func TestInventoryListGroups(t *testing.T) {
 			ctx := context.Background()
 			db := &mstore.DataStore{}
 
-			db.On("ListGroups", ctx, tc.filters).
-				Return(tc.inputGroups, tc.datastoreError)
+			db.On("ListGroups", ctx, tc.filters, 10, 5).
+				Return(tc.inputGroups, len(tc.inputGroups), tc.datastoreError)
 			i := invForTest(db)
 
-			groups, err := i.ListGroups(ctx, tc.filters)
+			groups, totalCount, err := i.ListGroups(ctx, tc.filters, 10, 5)
 			if tc.outError != nil {
 				if assert.Error(t, err) {
 					assert.EqualError(t, err, tc.outError.Error())
@@ -1500,11 +3326,90 @@ func TestInventoryListGroups(t *testing.T) {
 			} else {
 				assert.NoError(t, err)
 				assert.EqualValues(t, tc.outputGroups, groups)
+				assert.Equal(t, len(tc.inputGroups), totalCount)
+			}
+		})
+	}
+}
+
+func TestInventoryGetDevicesDistinctGroups(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		ids            []model.DeviceID
+		outputGroups   []model.GroupName
+		datastoreError error
+		outError       error
+	}{
+		"ok": {
+			ids:          []model.DeviceID{"1", "2", "3"},
+			outputGroups: []model.GroupName{"", "bar", "foo"},
+		},
+		"error": {
+			ids:            []model.DeviceID{"1"},
+			datastoreError: errors.New("random error"),
+			outError:       errors.New("failed to get the devices' groups: random error"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			db := &mstore.DataStore{}
+			defer db.AssertExpectations(t)
+
+			db.On("GetDevicesDistinctGroups", ctx, tc.ids).
+				Return(tc.outputGroups, tc.datastoreError)
+			i := invForTest(db)
+
+			groups, err := i.GetDevicesDistinctGroups(ctx, tc.ids)
+			if tc.outError != nil {
+				assert.EqualError(t, err, tc.outError.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.outputGroups, groups)
 			}
 		})
 	}
 }
 
+func TestInventoryListDevicesPartitionedByGroup(t *testing.T) {
+	t.Parallel()
+
+	q := store.ListQuery{Limit: 100}
+	groups := map[model.GroupName][]model.DeviceID{
+		"foo": {"1", "2"},
+		"":    {"3"},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetDevicesPartitionedByGroup", ctx, q, 10).Return(groups, nil)
+		i := invForTest(db)
+
+		res, err := i.ListDevicesPartitionedByGroup(ctx, q, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, groups, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+
+		db.On("GetDevicesPartitionedByGroup", ctx, q, 10).
+			Return(nil, errors.New("db error"))
+		i := invForTest(db)
+
+		res, err := i.ListDevicesPartitionedByGroup(ctx, q, 10)
+		assert.EqualError(t, err, "failed to fetch devices by group: db error")
+		assert.Nil(t, res)
+	})
+}
+
 func TestInventoryListDevicesByGroup(t *testing.T) {
 	t.Parallel()
 
@@ -1578,6 +3483,63 @@ func TestInventoryListDevicesByGroup(t *testing.T) {
 	}
 }
 
+func TestInventoryListDevicesByGroupWithAttributes(t *testing.T) {
+	t.Parallel()
+
+	attributes := []model.SelectAttribute{
+		{Scope: model.AttrScopeInventory, Attribute: "mac"},
+	}
+	devices := []model.Device{{ID: "1"}, {ID: "2"}}
+
+	testCases := map[string]struct {
+		devices    []model.Device
+		totalCount int
+		err        error
+
+		outError string
+	}{
+		"ok": {
+			devices:    devices,
+			totalCount: 2,
+		},
+		"error, group not found": {
+			totalCount: -1,
+			err:        store.ErrGroupNotFound,
+			outError:   store.ErrGroupNotFound.Error(),
+		},
+		"error, datastore": {
+			totalCount: -1,
+			err:        errors.New("datastore error"),
+			outError:   "failed to list devices by group: datastore error",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			db := &mstore.DataStore{}
+			defer db.AssertExpectations(t)
+
+			db.On("GetDevicesByGroupWithAttributes",
+				ctx, model.GroupName("foo"), 10, 5, attributes,
+			).Return(tc.devices, tc.totalCount, tc.err)
+			i := invForTest(db)
+
+			devs, totalCount, err := i.ListDevicesByGroupWithAttributes(
+				ctx, "foo", 10, 5, attributes)
+			if tc.outError != "" {
+				assert.EqualError(t, err, tc.outError)
+				assert.Nil(t, devs)
+				assert.Equal(t, -1, totalCount)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.devices, devs)
+				assert.Equal(t, tc.totalCount, totalCount)
+			}
+		})
+	}
+}
+
 func TestInventoryGetDeviceGroup(t *testing.T) {
 	t.Parallel()
 
@@ -1918,6 +3880,36 @@ func TestInventorySearchDevices(t *testing.T) {
 	}
 }
 
+func TestInventoryUnsetDevicesGroupDryRun(t *testing.T) {
+	t.Parallel()
+
+	ids := []model.DeviceID{"1", "2"}
+	group := model.GroupName("foo")
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+		db.On("CountDevicesInGroup", ctx, ids, group).Return(int64(1), nil)
+
+		res, err := invForTest(db).UnsetDevicesGroupDryRun(ctx, ids, group)
+		assert.NoError(t, err)
+		assert.Equal(t, &model.UpdateResult{MatchedCount: 1}, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := context.Background()
+		db := &mstore.DataStore{}
+		defer db.AssertExpectations(t)
+		db.On("CountDevicesInGroup", ctx, ids, group).
+			Return(int64(0), errors.New("db error"))
+
+		res, err := invForTest(db).UnsetDevicesGroupDryRun(ctx, ids, group)
+		assert.EqualError(t, err, "failed to count the devices in the group: db error")
+		assert.Nil(t, res)
+	})
+}
+
 func TestInventoryUpdateDevicesGroup(t *testing.T) {
 	t.Parallel()
 	testCases := []struct {
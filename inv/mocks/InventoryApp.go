@@ -28,6 +28,8 @@ import (
 
 	store "github.com/mendersoftware/inventory/store"
 
+	time "time"
+
 	workflows "github.com/mendersoftware/inventory/client/workflows"
 )
 
@@ -50,6 +52,27 @@ func (_m *InventoryApp) AddDevice(ctx context.Context, d *model.Device) error {
 	return r0
 }
 
+// AttributeCardinality provides a mock function with given fields: ctx, scope, name
+func (_m *InventoryApp) AttributeCardinality(ctx context.Context, scope string, name string) (int, error) {
+	ret := _m.Called(ctx, scope, name)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) int); ok {
+		r0 = rf(ctx, scope, name)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, scope, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // CheckAlerts provides a mock function with given fields: ctx, deviceId
 func (_m *InventoryApp) CheckAlerts(ctx context.Context, deviceId string) (int, error) {
 	ret := _m.Called(ctx, deviceId)
@@ -71,6 +94,78 @@ func (_m *InventoryApp) CheckAlerts(ctx context.Context, deviceId string) (int,
 	return r0, r1
 }
 
+// CompareDevices provides a mock function with given fields: ctx, baseID, otherID
+func (_m *InventoryApp) CompareDevices(ctx context.Context, baseID model.DeviceID, otherID model.DeviceID) (*model.DevicesDiff, error) {
+	ret := _m.Called(ctx, baseID, otherID)
+
+	var r0 *model.DevicesDiff
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceID, model.DeviceID) *model.DevicesDiff); ok {
+		r0 = rf(ctx, baseID, otherID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.DevicesDiff)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceID, model.DeviceID) error); ok {
+		r1 = rf(ctx, baseID, otherID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CountDevices provides a mock function with given fields: ctx, searchParams
+func (_m *InventoryApp) CountDevices(ctx context.Context, searchParams model.SearchParams) (int, error) {
+	ret := _m.Called(ctx, searchParams)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, model.SearchParams) int); ok {
+		r0 = rf(ctx, searchParams)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.SearchParams) error); ok {
+		r1 = rf(ctx, searchParams)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateDevice provides a mock function with given fields: ctx, d
+func (_m *InventoryApp) CreateDevice(ctx context.Context, d *model.Device) error {
+	ret := _m.Called(ctx, d)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.Device) error); ok {
+		r0 = rf(ctx, d)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateSavedFilter provides a mock function with given fields: ctx, filter
+func (_m *InventoryApp) CreateSavedFilter(ctx context.Context, filter *model.SavedFilter) error {
+	ret := _m.Called(ctx, filter)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.SavedFilter) error); ok {
+		r0 = rf(ctx, filter)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // CreateTenant provides a mock function with given fields: ctx, tenant
 func (_m *InventoryApp) CreateTenant(ctx context.Context, tenant model.NewTenant) error {
 	ret := _m.Called(ctx, tenant)
@@ -145,6 +240,273 @@ func (_m *InventoryApp) DeleteGroup(ctx context.Context, groupName model.GroupNa
 	return r0, r1
 }
 
+// DeleteSavedFilter provides a mock function with given fields: ctx, id
+func (_m *InventoryApp) DeleteSavedFilter(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ExplainSearchDevices provides a mock function with given fields: ctx, searchParams
+func (_m *InventoryApp) ExplainSearchDevices(ctx context.Context, searchParams model.SearchParams) (map[string]interface{}, error) {
+	ret := _m.Called(ctx, searchParams)
+
+	var r0 map[string]interface{}
+	if rf, ok := ret.Get(0).(func(context.Context, model.SearchParams) map[string]interface{}); ok {
+		r0 = rf(ctx, searchParams)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]interface{})
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.SearchParams) error); ok {
+		r1 = rf(ctx, searchParams)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindDevicesByAttributeSet provides a mock function with given fields: ctx, scope, attrs
+func (_m *InventoryApp) FindDevicesByAttributeSet(ctx context.Context, scope string, attrs model.DeviceAttributes) ([]model.Device, error) {
+	ret := _m.Called(ctx, scope, attrs)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.DeviceAttributes) []model.Device); ok {
+		r0 = rf(ctx, scope, attrs)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, model.DeviceAttributes) error); ok {
+		r1 = rf(ctx, scope, attrs)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindDevicesByAttributeValues provides a mock function with given fields: ctx, scope, name, values
+func (_m *InventoryApp) FindDevicesByAttributeValues(ctx context.Context, scope string, name string, values []interface{}) ([]model.Device, error) {
+	ret := _m.Called(ctx, scope, name, values)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, []interface{}) []model.Device); ok {
+		r0 = rf(ctx, scope, name, values)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, []interface{}) error); ok {
+		r1 = rf(ctx, scope, name, values)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindDevicesWithAttributeDrift provides a mock function with given fields: ctx, scope, name, value
+func (_m *InventoryApp) FindDevicesWithAttributeDrift(ctx context.Context, scope string, name string, value interface{}) ([]model.Device, error) {
+	ret := _m.Called(ctx, scope, name, value)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, interface{}) []model.Device); ok {
+		r0 = rf(ctx, scope, name, value)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, interface{}) error); ok {
+		r1 = rf(ctx, scope, name, value)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindDevicesWithDuplicateAttributes provides a mock function with given fields: ctx, skip, limit
+func (_m *InventoryApp) FindDevicesWithDuplicateAttributes(ctx context.Context, skip int, limit int) ([]model.DeviceDuplicateAttributes, error) {
+	ret := _m.Called(ctx, skip, limit)
+
+	var r0 []model.DeviceDuplicateAttributes
+	if rf, ok := ret.Get(0).(func(context.Context, int, int) []model.DeviceDuplicateAttributes); ok {
+		r0 = rf(ctx, skip, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.DeviceDuplicateAttributes)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int, int) error); ok {
+		r1 = rf(ctx, skip, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAlertsSummary provides a mock function with given fields: ctx, scope
+func (_m *InventoryApp) GetAlertsSummary(ctx context.Context, scope string) (*model.AlertsSummary, error) {
+	ret := _m.Called(ctx, scope)
+
+	var r0 *model.AlertsSummary
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.AlertsSummary); ok {
+		r0 = rf(ctx, scope)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.AlertsSummary)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, scope)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAttributeScopes provides a mock function with given fields: ctx
+func (_m *InventoryApp) GetAttributeScopes(ctx context.Context) ([]string, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context) []string); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAttributesChurn provides a mock function with given fields: ctx
+func (_m *InventoryApp) GetAttributesChurn(ctx context.Context) ([]model.AttributeChurn, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.AttributeChurn
+	if rf, ok := ret.Get(0).(func(context.Context) []model.AttributeChurn); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.AttributeChurn)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAttributesCoverage provides a mock function with given fields: ctx
+func (_m *InventoryApp) GetAttributesCoverage(ctx context.Context) ([]model.AttributeCoverage, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.AttributeCoverage
+	if rf, ok := ret.Get(0).(func(context.Context) []model.AttributeCoverage); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.AttributeCoverage)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAttributesPresence provides a mock function with given fields: ctx, ids, attributes
+func (_m *InventoryApp) GetAttributesPresence(ctx context.Context, ids []model.DeviceID, attributes []model.SelectAttribute) (map[model.DeviceID][]bool, error) {
+	ret := _m.Called(ctx, ids, attributes)
+
+	var r0 map[model.DeviceID][]bool
+	if rf, ok := ret.Get(0).(func(context.Context, []model.DeviceID, []model.SelectAttribute) map[model.DeviceID][]bool); ok {
+		r0 = rf(ctx, ids, attributes)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[model.DeviceID][]bool)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []model.DeviceID, []model.SelectAttribute) error); ok {
+		r1 = rf(ctx, ids, attributes)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDescribedAttributes provides a mock function with given fields: ctx
+func (_m *InventoryApp) GetDescribedAttributes(ctx context.Context) ([]model.DescribedAttribute, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.DescribedAttribute
+	if rf, ok := ret.Get(0).(func(context.Context) []model.DescribedAttribute); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.DescribedAttribute)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetDevice provides a mock function with given fields: ctx, id
 func (_m *InventoryApp) GetDevice(ctx context.Context, id model.DeviceID) (*model.Device, error) {
 	ret := _m.Called(ctx, id)
@@ -180,8 +542,261 @@ func (_m *InventoryApp) GetDeviceGroup(ctx context.Context, id model.DeviceID) (
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceID) error); ok {
-		r1 = rf(ctx, id)
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceID) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDevicesAttributesCount provides a mock function with given fields: ctx, ids
+func (_m *InventoryApp) GetDevicesAttributesCount(ctx context.Context, ids []model.DeviceID) (map[model.DeviceID]int, error) {
+	ret := _m.Called(ctx, ids)
+
+	var r0 map[model.DeviceID]int
+	if rf, ok := ret.Get(0).(func(context.Context, []model.DeviceID) map[model.DeviceID]int); ok {
+		r0 = rf(ctx, ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[model.DeviceID]int)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []model.DeviceID) error); ok {
+		r1 = rf(ctx, ids)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDevicesByIDs provides a mock function with given fields: ctx, ids
+func (_m *InventoryApp) GetDevicesByIDs(ctx context.Context, ids []model.DeviceID) ([]model.Device, error) {
+	ret := _m.Called(ctx, ids)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, []model.DeviceID) []model.Device); ok {
+		r0 = rf(ctx, ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []model.DeviceID) error); ok {
+		r1 = rf(ctx, ids)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDevicesDistinctGroups provides a mock function with given fields: ctx, ids
+func (_m *InventoryApp) GetDevicesDistinctGroups(ctx context.Context, ids []model.DeviceID) ([]model.GroupName, error) {
+	ret := _m.Called(ctx, ids)
+
+	var r0 []model.GroupName
+	if rf, ok := ret.Get(0).(func(context.Context, []model.DeviceID) []model.GroupName); ok {
+		r0 = rf(ctx, ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.GroupName)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []model.DeviceID) error); ok {
+		r1 = rf(ctx, ids)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDevicesStatuses provides a mock function with given fields: ctx, ids
+func (_m *InventoryApp) GetDevicesStatuses(ctx context.Context, ids []model.DeviceID) (map[model.DeviceID]*string, error) {
+	ret := _m.Called(ctx, ids)
+
+	var r0 map[model.DeviceID]*string
+	if rf, ok := ret.Get(0).(func(context.Context, []model.DeviceID) map[model.DeviceID]*string); ok {
+		r0 = rf(ctx, ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[model.DeviceID]*string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []model.DeviceID) error); ok {
+		r1 = rf(ctx, ids)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDevicesUpdatedByScopeSince provides a mock function with given fields: ctx, scope, since
+func (_m *InventoryApp) GetDevicesUpdatedByScopeSince(ctx context.Context, scope string, since time.Time) ([]model.Device, error) {
+	ret := _m.Called(ctx, scope, since)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) []model.Device); ok {
+		r0 = rf(ctx, scope, since)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time) error); ok {
+		r1 = rf(ctx, scope, since)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDevicesWithStaleScope provides a mock function with given fields: ctx, scope, olderThan
+func (_m *InventoryApp) GetDevicesWithStaleScope(ctx context.Context, scope string, olderThan time.Duration) ([]model.Device, error) {
+	ret := _m.Called(ctx, scope, olderThan)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Duration) []model.Device); ok {
+		r0 = rf(ctx, scope, olderThan)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Duration) error); ok {
+		r1 = rf(ctx, scope, olderThan)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetFeatureFlags provides a mock function with given fields: ctx
+func (_m *InventoryApp) GetFeatureFlags(ctx context.Context) (model.FeatureFlags, error) {
+	ret := _m.Called(ctx)
+
+	var r0 model.FeatureFlags
+	if rf, ok := ret.Get(0).(func(context.Context) model.FeatureFlags); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(model.FeatureFlags)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetFiltersAttributes provides a mock function with given fields: ctx
+func (_m *InventoryApp) GetFiltersAttributes(ctx context.Context) ([]model.FilterAttribute, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.FilterAttribute
+	if rf, ok := ret.Get(0).(func(context.Context) []model.FilterAttribute); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.FilterAttribute)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetGroupSchema provides a mock function with given fields: ctx, group
+func (_m *InventoryApp) GetGroupSchema(ctx context.Context, group model.GroupName) ([]model.SchemaAttribute, error) {
+	ret := _m.Called(ctx, group)
+
+	var r0 []model.SchemaAttribute
+	if rf, ok := ret.Get(0).(func(context.Context, model.GroupName) []model.SchemaAttribute); ok {
+		r0 = rf(ctx, group)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.SchemaAttribute)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.GroupName) error); ok {
+		r1 = rf(ctx, group)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetGroupSiblings provides a mock function with given fields: ctx, id
+func (_m *InventoryApp) GetGroupSiblings(ctx context.Context, id model.DeviceID) ([]model.Device, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceID) []model.Device); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceID) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetOnboardingStats provides a mock function with given fields: ctx, params
+func (_m *InventoryApp) GetOnboardingStats(ctx context.Context, params model.OnboardingStatsParams) ([]model.TimeBucketCount, error) {
+	ret := _m.Called(ctx, params)
+
+	var r0 []model.TimeBucketCount
+	if rf, ok := ret.Get(0).(func(context.Context, model.OnboardingStatsParams) []model.TimeBucketCount); ok {
+		r0 = rf(ctx, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.TimeBucketCount)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.OnboardingStatsParams) error); ok {
+		r1 = rf(ctx, params)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -189,22 +804,22 @@ func (_m *InventoryApp) GetDeviceGroup(ctx context.Context, id model.DeviceID) (
 	return r0, r1
 }
 
-// GetFiltersAttributes provides a mock function with given fields: ctx
-func (_m *InventoryApp) GetFiltersAttributes(ctx context.Context) ([]model.FilterAttribute, error) {
-	ret := _m.Called(ctx)
+// GetSavedFilter provides a mock function with given fields: ctx, id
+func (_m *InventoryApp) GetSavedFilter(ctx context.Context, id string) (*model.SavedFilter, error) {
+	ret := _m.Called(ctx, id)
 
-	var r0 []model.FilterAttribute
-	if rf, ok := ret.Get(0).(func(context.Context) []model.FilterAttribute); ok {
-		r0 = rf(ctx)
+	var r0 *model.SavedFilter
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.SavedFilter); ok {
+		r0 = rf(ctx, id)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]model.FilterAttribute)
+			r0 = ret.Get(0).(*model.SavedFilter)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
-		r1 = rf(ctx)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -286,22 +901,140 @@ func (_m *InventoryApp) ListDevicesByGroup(ctx context.Context, group model.Grou
 	return r0, r1, r2
 }
 
-// ListGroups provides a mock function with given fields: ctx, filters
-func (_m *InventoryApp) ListGroups(ctx context.Context, filters []model.FilterPredicate) ([]model.GroupName, error) {
-	ret := _m.Called(ctx, filters)
+// ListDevicesByGroupWithAttributes provides a mock function with given fields: ctx, group, skip, limit, attributes
+func (_m *InventoryApp) ListDevicesByGroupWithAttributes(ctx context.Context, group model.GroupName, skip int, limit int, attributes []model.SelectAttribute) ([]model.Device, int, error) {
+	ret := _m.Called(ctx, group, skip, limit, attributes)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, model.GroupName, int, int, []model.SelectAttribute) []model.Device); ok {
+		r0 = rf(ctx, group, skip, limit, attributes)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 int
+	if rf, ok := ret.Get(1).(func(context.Context, model.GroupName, int, int, []model.SelectAttribute) int); ok {
+		r1 = rf(ctx, group, skip, limit, attributes)
+	} else {
+		r1 = ret.Get(1).(int)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, model.GroupName, int, int, []model.SelectAttribute) error); ok {
+		r2 = rf(ctx, group, skip, limit, attributes)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// ListDevicesPartitionedByGroup provides a mock function with given fields: ctx, q, perGroup
+func (_m *InventoryApp) ListDevicesPartitionedByGroup(ctx context.Context, q store.ListQuery, perGroup int) (map[model.GroupName][]model.DeviceID, error) {
+	ret := _m.Called(ctx, q, perGroup)
+
+	var r0 map[model.GroupName][]model.DeviceID
+	if rf, ok := ret.Get(0).(func(context.Context, store.ListQuery, int) map[model.GroupName][]model.DeviceID); ok {
+		r0 = rf(ctx, q, perGroup)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[model.GroupName][]model.DeviceID)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, store.ListQuery, int) error); ok {
+		r1 = rf(ctx, q, perGroup)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListGroups provides a mock function with given fields: ctx, filters, skip, limit
+func (_m *InventoryApp) ListGroups(ctx context.Context, filters []model.FilterPredicate, skip int, limit int) ([]model.GroupName, int, error) {
+	ret := _m.Called(ctx, filters, skip, limit)
 
 	var r0 []model.GroupName
-	if rf, ok := ret.Get(0).(func(context.Context, []model.FilterPredicate) []model.GroupName); ok {
-		r0 = rf(ctx, filters)
+	if rf, ok := ret.Get(0).(func(context.Context, []model.FilterPredicate, int, int) []model.GroupName); ok {
+		r0 = rf(ctx, filters, skip, limit)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]model.GroupName)
 		}
 	}
 
+	var r1 int
+	if rf, ok := ret.Get(1).(func(context.Context, []model.FilterPredicate, int, int) int); ok {
+		r1 = rf(ctx, filters, skip, limit)
+	} else {
+		r1 = ret.Get(1).(int)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, []model.FilterPredicate, int, int) error); ok {
+		r2 = rf(ctx, filters, skip, limit)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// ListSavedFilters provides a mock function with given fields: ctx
+func (_m *InventoryApp) ListSavedFilters(ctx context.Context) ([]model.SavedFilter, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.SavedFilter
+	if rf, ok := ret.Get(0).(func(context.Context) []model.SavedFilter); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.SavedFilter)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MoveAttributesBetweenScopes provides a mock function with given fields: ctx, id, fromScope, toScope, policy
+func (_m *InventoryApp) MoveAttributesBetweenScopes(ctx context.Context, id model.DeviceID, fromScope string, toScope string, policy string) error {
+	ret := _m.Called(ctx, id, fromScope, toScope, policy)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceID, string, string, string) error); ok {
+		r0 = rf(ctx, id, fromScope, toScope, policy)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RepairDuplicateAttributes provides a mock function with given fields: ctx, id
+func (_m *InventoryApp) RepairDuplicateAttributes(ctx context.Context, id model.DeviceID) (int, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceID) int); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, []model.FilterPredicate) error); ok {
-		r1 = rf(ctx, filters)
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceID) error); ok {
+		r1 = rf(ctx, id)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -309,6 +1042,20 @@ func (_m *InventoryApp) ListGroups(ctx context.Context, filters []model.FilterPr
 	return r0, r1
 }
 
+// ReplaceAllAttributes provides a mock function with given fields: ctx, id, attrs
+func (_m *InventoryApp) ReplaceAllAttributes(ctx context.Context, id model.DeviceID, attrs model.DeviceAttributes) error {
+	ret := _m.Called(ctx, id, attrs)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceID, model.DeviceAttributes) error); ok {
+		r0 = rf(ctx, id, attrs)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // ReplaceAttributes provides a mock function with given fields: ctx, id, upsertAttrs, scope, etag
 func (_m *InventoryApp) ReplaceAttributes(ctx context.Context, id model.DeviceID, upsertAttrs model.DeviceAttributes, scope string, etag string) error {
 	ret := _m.Called(ctx, id, upsertAttrs, scope, etag)
@@ -323,6 +1070,43 @@ func (_m *InventoryApp) ReplaceAttributes(ctx context.Context, id model.DeviceID
 	return r0
 }
 
+// ReplaceDevice provides a mock function with given fields: ctx, d
+func (_m *InventoryApp) ReplaceDevice(ctx context.Context, d *model.Device) error {
+	ret := _m.Called(ctx, d)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.Device) error); ok {
+		r0 = rf(ctx, d)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SampleDevices provides a mock function with given fields: ctx, n, filters
+func (_m *InventoryApp) SampleDevices(ctx context.Context, n int, filters []model.FilterPredicate) ([]model.Device, error) {
+	ret := _m.Called(ctx, n, filters)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, int, []model.FilterPredicate) []model.Device); ok {
+		r0 = rf(ctx, n, filters)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int, []model.FilterPredicate) error); ok {
+		r1 = rf(ctx, n, filters)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // SearchDevices provides a mock function with given fields: ctx, searchParams
 func (_m *InventoryApp) SearchDevices(ctx context.Context, searchParams model.SearchParams) ([]model.Device, int, error) {
 	ret := _m.Called(ctx, searchParams)
@@ -353,6 +1137,64 @@ func (_m *InventoryApp) SearchDevices(ctx context.Context, searchParams model.Se
 	return r0, r1, r2
 }
 
+// SetFeatureFlags provides a mock function with given fields: ctx, flags
+func (_m *InventoryApp) SetFeatureFlags(ctx context.Context, flags model.FeatureFlags) error {
+	ret := _m.Called(ctx, flags)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.FeatureFlags) error); ok {
+		r0 = rf(ctx, flags)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ToggleAttribute provides a mock function with given fields: ctx, id, scope, name, defaultValue
+func (_m *InventoryApp) ToggleAttribute(ctx context.Context, id model.DeviceID, scope string, name string, defaultValue bool) (bool, error) {
+	ret := _m.Called(ctx, id, scope, name, defaultValue)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceID, string, string, bool) bool); ok {
+		r0 = rf(ctx, id, scope, name, defaultValue)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceID, string, string, bool) error); ok {
+		r1 = rf(ctx, id, scope, name, defaultValue)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// TopAttributeValues provides a mock function with given fields: ctx, scope, name, limit
+func (_m *InventoryApp) TopAttributeValues(ctx context.Context, scope string, name string, limit int) ([]model.AttributeValueCount, error) {
+	ret := _m.Called(ctx, scope, name, limit)
+
+	var r0 []model.AttributeValueCount
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int) []model.AttributeValueCount); ok {
+		r0 = rf(ctx, scope, name, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.AttributeValueCount)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int) error); ok {
+		r1 = rf(ctx, scope, name, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // UnsetDeviceGroup provides a mock function with given fields: ctx, id, groupName
 func (_m *InventoryApp) UnsetDeviceGroup(ctx context.Context, id model.DeviceID, groupName model.GroupName) error {
 	ret := _m.Called(ctx, id, groupName)
@@ -390,6 +1232,29 @@ func (_m *InventoryApp) UnsetDevicesGroup(ctx context.Context, deviceIDs []model
 	return r0, r1
 }
 
+// UnsetDevicesGroupDryRun provides a mock function with given fields: ctx, deviceIDs, groupName
+func (_m *InventoryApp) UnsetDevicesGroupDryRun(ctx context.Context, deviceIDs []model.DeviceID, groupName model.GroupName) (*model.UpdateResult, error) {
+	ret := _m.Called(ctx, deviceIDs, groupName)
+
+	var r0 *model.UpdateResult
+	if rf, ok := ret.Get(0).(func(context.Context, []model.DeviceID, model.GroupName) *model.UpdateResult); ok {
+		r0 = rf(ctx, deviceIDs, groupName)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.UpdateResult)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []model.DeviceID, model.GroupName) error); ok {
+		r1 = rf(ctx, deviceIDs, groupName)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // UpdateDeviceGroup provides a mock function with given fields: ctx, id, group
 func (_m *InventoryApp) UpdateDeviceGroup(ctx context.Context, id model.DeviceID, group model.GroupName) error {
 	ret := _m.Called(ctx, id, group)
@@ -427,6 +1292,20 @@ func (_m *InventoryApp) UpdateDevicesGroup(ctx context.Context, ids []model.Devi
 	return r0, r1
 }
 
+// UpdateSavedFilter provides a mock function with given fields: ctx, filter
+func (_m *InventoryApp) UpdateSavedFilter(ctx context.Context, filter *model.SavedFilter) error {
+	ret := _m.Called(ctx, filter)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.SavedFilter) error); ok {
+		r0 = rf(ctx, filter)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // UpsertAttributes provides a mock function with given fields: ctx, id, attrs
 func (_m *InventoryApp) UpsertAttributes(ctx context.Context, id model.DeviceID, attrs model.DeviceAttributes) error {
 	ret := _m.Called(ctx, id, attrs)
@@ -478,6 +1357,29 @@ func (_m *InventoryApp) UpsertDevicesStatuses(ctx context.Context, devices []mod
 	return r0, r1
 }
 
+// VerifyDeviceAttributes provides a mock function with given fields: ctx, id
+func (_m *InventoryApp) VerifyDeviceAttributes(ctx context.Context, id model.DeviceID) (*model.DeviceAttributesReport, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.DeviceAttributesReport
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceID) *model.DeviceAttributesReport); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.DeviceAttributesReport)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceID) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // WithDevicemonitor provides a mock function with given fields: client
 func (_m *InventoryApp) WithDevicemonitor(client devicemonitor.Client) inv.InventoryApp {
 	ret := _m.Called(client)
@@ -494,6 +1396,38 @@ func (_m *InventoryApp) WithDevicemonitor(client devicemonitor.Client) inv.Inven
 	return r0
 }
 
+// WithFloatDecimals provides a mock function with given fields: decimals
+func (_m *InventoryApp) WithFloatDecimals(decimals int) inv.InventoryApp {
+	ret := _m.Called(decimals)
+
+	var r0 inv.InventoryApp
+	if rf, ok := ret.Get(0).(func(int) inv.InventoryApp); ok {
+		r0 = rf(decimals)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(inv.InventoryApp)
+		}
+	}
+
+	return r0
+}
+
+// WithIngestDedupWindow provides a mock function with given fields: window
+func (_m *InventoryApp) WithIngestDedupWindow(window time.Duration) inv.InventoryApp {
+	ret := _m.Called(window)
+
+	var r0 inv.InventoryApp
+	if rf, ok := ret.Get(0).(func(time.Duration) inv.InventoryApp); ok {
+		r0 = rf(window)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(inv.InventoryApp)
+		}
+	}
+
+	return r0
+}
+
 // WithLimits provides a mock function with given fields: attributes, tags
 func (_m *InventoryApp) WithLimits(attributes int, tags int) inv.InventoryApp {
 	ret := _m.Called(attributes, tags)
@@ -525,3 +1459,19 @@ func (_m *InventoryApp) WithReporting(c workflows.Client) inv.InventoryApp {
 
 	return r0
 }
+
+// WithTrimScopes provides a mock function with given fields: scopes
+func (_m *InventoryApp) WithTrimScopes(scopes []string) inv.InventoryApp {
+	ret := _m.Called(scopes)
+
+	var r0 inv.InventoryApp
+	if rf, ok := ret.Get(0).(func([]string) inv.InventoryApp); ok {
+		r0 = rf(scopes)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(inv.InventoryApp)
+		}
+	}
+
+	return r0
+}
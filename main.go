@@ -108,6 +108,30 @@ func doMain(args []string) {
 
 			Action: cmdMaintenence,
 		},
+		{
+			Name: "purge-scope",
+			Usage: "Purge the attributes of a scope older than " +
+				"the retention period",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "scope",
+					Usage: "Scope of the attributes to purge",
+				},
+				cli.DurationFlag{
+					Name: "retention",
+					Usage: "Retention period of the attributes, " +
+						"based on their timestamps",
+				},
+				cli.StringSliceFlag{
+					Name: "tenant, t",
+					Usage: "Takes ID of specific " +
+						"tenant(s) to purge. " +
+						"Flag can be provided " +
+						"multiple times.",
+				},
+			},
+			Action: cmdPurgeScope,
+		},
 	}
 
 	app.Action = cmdServer
@@ -140,6 +164,19 @@ func makeDataStoreConfig() mongo.DataStoreMongoConfig {
 
 		Username: config.Config.GetString(SettingDbUsername),
 		Password: config.Config.GetString(SettingDbPassword),
+
+		DisableSortTieBreaker: config.Config.GetBool(SettingSearchDisableSortTieBreaker),
+		SortIDLast:            config.Config.GetBool(SettingSearchSortIDLast),
+		IndexAttributes:       config.Config.GetStringSlice(SettingIndexAttributes),
+		LargeInThreshold:      config.Config.GetInt(SettingSearchLargeInThreshold),
+		MaxAttributesBytes:    config.Config.GetInt(SettingSearchMaxAttributesBytes),
+		RedactedAttributes:    config.Config.GetStringSlice(SettingLogRedactedAttributes),
+		StrictAttributeTypes:  config.Config.GetBool(SettingStrictAttributeTypes),
+		CaseInsensitiveAttributeNames: config.Config.GetBool(
+			SettingSearchCaseInsensitiveNames),
+		MigrationConcurrency: config.Config.GetInt(SettingMigrationConcurrency),
+		AttributeChangeTimestamps: config.Config.GetBool(
+			SettingAttributeChangeTimestamps),
 	}
 
 }
@@ -249,3 +286,35 @@ func cmdMaintenence(args *cli.Context) error {
 
 	return nil
 }
+
+func cmdPurgeScope(args *cli.Context) error {
+	scope := args.String("scope")
+	retention := args.Duration("retention")
+	tenantIDs := args.StringSlice("tenant")
+	if scope == "" || retention <= 0 {
+		return cli.NewExitError(
+			"the scope and a positive retention period are required",
+			1)
+	}
+
+	l := log.New(log.Ctx{})
+
+	db, err := mongo.NewDataStoreMongo(makeDataStoreConfig())
+	if err != nil {
+		return cli.NewExitError(
+			fmt.Sprintf("failed to connect to db: %v", err),
+			3)
+	}
+
+	ctx := context.Background()
+
+	purged, err := db.PurgeScopeByRetention(ctx, scope, retention, tenantIDs...)
+	if err != nil {
+		return cli.NewExitError(
+			fmt.Sprintf("failed to purge the attributes: %v", err),
+			3)
+	}
+	l.Infof("purged the %s attributes of %d devices", scope, purged)
+
+	return nil
+}
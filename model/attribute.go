@@ -13,8 +13,198 @@
 //	limitations under the License.
 package model
 
+import (
+	"reflect"
+	"sort"
+)
+
 type FilterAttribute struct {
 	Name  string `json:"name" bson:"name"`
 	Scope string `json:"scope" bson:"scope"`
 	Count int32  `json:"count" bson:"count"`
 }
+
+// DescribedAttribute is an attribute having a description set on at least
+// one device, along with one of its descriptions.
+type DescribedAttribute struct {
+	Name        string `json:"name" bson:"name"`
+	Scope       string `json:"scope" bson:"scope"`
+	Description string `json:"description" bson:"description"`
+}
+
+// Types of the attribute values in the group schema.
+const (
+	AttrTypeString = "string"
+	AttrTypeNumber = "number"
+	AttrTypeBool   = "bool"
+	AttrTypeTime   = "time"
+	AttrTypeArray  = "array"
+)
+
+// SchemaAttribute is an attribute set on the devices of a group, along
+// with the types of its values.
+type SchemaAttribute struct {
+	Name  string   `json:"name" bson:"name"`
+	Scope string   `json:"scope" bson:"scope"`
+	Types []string `json:"types" bson:"types"`
+}
+
+// AttributeValueCount is the number of devices having an attribute set
+// to the value.
+type AttributeValueCount struct {
+	Value interface{} `json:"value" bson:"_id"`
+	Count int         `json:"count" bson:"count"`
+}
+
+// AttributeCardinality is the number of distinct values of an attribute
+// across all the devices.
+type AttributeCardinality struct {
+	Name        string `json:"name"`
+	Scope       string `json:"scope"`
+	Cardinality int    `json:"cardinality"`
+}
+
+// AttributeCoverage is the number and the percentage of the devices
+// having an attribute.
+type AttributeCoverage struct {
+	Name     string  `json:"name" bson:"name"`
+	Scope    string  `json:"scope" bson:"scope"`
+	Count    int     `json:"count" bson:"count"`
+	Coverage float64 `json:"coverage" bson:"-"`
+}
+
+// AttributeChurn is the number of changes of the value of an attribute
+// across all the devices.
+type AttributeChurn struct {
+	Name  string `json:"name" bson:"name"`
+	Scope string `json:"scope" bson:"scope"`
+	Count int    `json:"count" bson:"count"`
+}
+
+// DuplicateAttribute lists the storage keys of attribute entries sharing
+// the same scope and name.
+type DuplicateAttribute struct {
+	Name  string   `json:"name" bson:"name"`
+	Scope string   `json:"scope" bson:"scope"`
+	Keys  []string `json:"keys" bson:"keys"`
+}
+
+// DeviceDuplicateAttributes lists the duplicated attributes of a device.
+type DeviceDuplicateAttributes struct {
+	DeviceID   DeviceID             `json:"device_id" bson:"_id"`
+	Attributes []DuplicateAttribute `json:"attributes" bson:"attributes"`
+}
+
+const (
+	// AttributeIssueDuplicateKey flags an attribute entry sharing its
+	// scope and name with other entries of the device
+	AttributeIssueDuplicateKey = "duplicate_key"
+	// AttributeIssueMissingScope flags an attribute entry without scope
+	AttributeIssueMissingScope = "missing_scope"
+	// AttributeIssueMixedArrayTypes flags an attribute entry whose array
+	// value mixes elements of different types
+	AttributeIssueMixedArrayTypes = "mixed_array_types"
+)
+
+// AttributeIssue is an integrity problem of a stored attribute entry.
+type AttributeIssue struct {
+	Key   string `json:"key"`
+	Name  string `json:"name"`
+	Scope string `json:"scope"`
+	Issue string `json:"issue"`
+}
+
+// DeviceAttributesReport lists the integrity problems of the attributes
+// of a device, empty if the attributes are sound.
+type DeviceAttributesReport struct {
+	DeviceID DeviceID         `json:"device_id"`
+	Issues   []AttributeIssue `json:"issues"`
+}
+
+const (
+	// MergePolicyOverwrite makes the moved attributes replace the
+	// attributes of the target scope with the same names
+	MergePolicyOverwrite = "overwrite"
+	// MergePolicyKeep keeps the attributes of the target scope, dropping
+	// the moved attributes with the same names
+	MergePolicyKeep = "keep"
+)
+
+// AttributeChange is an attribute set to different values on two devices.
+type AttributeChange struct {
+	Name     string      `json:"name"`
+	Scope    string      `json:"scope"`
+	Value    interface{} `json:"value"`
+	NewValue interface{} `json:"new_value"`
+}
+
+// DevicesDiff is the difference between the attributes of two devices,
+// from the base device to the other one.
+type DevicesDiff struct {
+	Added   DeviceAttributes  `json:"added"`
+	Removed DeviceAttributes  `json:"removed"`
+	Changed []AttributeChange `json:"changed"`
+}
+
+// DiffAttributes returns the attributes set only on the other device as
+// added, the ones set only on the base device as removed and the ones set
+// to different values as changed, each ordered by scope and name; the
+// creation and update timestamps, which differ between any two devices,
+// are left out.
+func DiffAttributes(base, other DeviceAttributes) DevicesDiff {
+	type key struct{ scope, name string }
+	index := func(attrs DeviceAttributes) map[key]DeviceAttribute {
+		res := make(map[key]DeviceAttribute, len(attrs))
+		for _, attr := range attrs {
+			if attr.Scope == AttrScopeSystem &&
+				(attr.Name == AttrNameCreated || attr.Name == AttrNameUpdated) {
+				continue
+			}
+			res[key{attr.Scope, attr.Name}] = attr
+		}
+		return res
+	}
+	baseAttrs, otherAttrs := index(base), index(other)
+
+	diff := DevicesDiff{
+		Added:   DeviceAttributes{},
+		Removed: DeviceAttributes{},
+		Changed: []AttributeChange{},
+	}
+	for k, attr := range baseAttrs {
+		otherAttr, ok := otherAttrs[k]
+		if !ok {
+			diff.Removed = append(diff.Removed, attr)
+		} else if !reflect.DeepEqual(attr.Value, otherAttr.Value) {
+			diff.Changed = append(diff.Changed, AttributeChange{
+				Name:     k.name,
+				Scope:    k.scope,
+				Value:    attr.Value,
+				NewValue: otherAttr.Value,
+			})
+		}
+	}
+	for k, attr := range otherAttrs {
+		if _, ok := baseAttrs[k]; !ok {
+			diff.Added = append(diff.Added, attr)
+		}
+	}
+
+	sortAttrs := func(attrs DeviceAttributes) {
+		sort.Slice(attrs, func(i, j int) bool {
+			if attrs[i].Scope != attrs[j].Scope {
+				return attrs[i].Scope < attrs[j].Scope
+			}
+			return attrs[i].Name < attrs[j].Name
+		})
+	}
+	sortAttrs(diff.Added)
+	sortAttrs(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		if diff.Changed[i].Scope != diff.Changed[j].Scope {
+			return diff.Changed[i].Scope < diff.Changed[j].Scope
+		}
+		return diff.Changed[i].Name < diff.Changed[j].Name
+	})
+	return diff
+}
@@ -0,0 +1,60 @@
+// Copyright 2023 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffAttributes(t *testing.T) {
+	created := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	base := DeviceAttributes{
+		{Name: "mac", Value: "00:01", Scope: AttrScopeIdentity},
+		{Name: "device_type", Value: "rpi4", Scope: AttrScopeInventory},
+		{Name: "kernel", Value: "5.10", Scope: AttrScopeInventory},
+		{Name: "ipv4", Value: []interface{}{"10.0.0.1", "10.0.0.2"}, Scope: AttrScopeInventory},
+		{Name: "legacy", Value: "yes", Scope: AttrScopeInventory},
+		{Name: AttrNameCreated, Value: created, Scope: AttrScopeSystem},
+	}
+	other := DeviceAttributes{
+		{Name: "mac", Value: "00:02", Scope: AttrScopeIdentity},
+		{Name: "device_type", Value: "rpi4", Scope: AttrScopeInventory},
+		{Name: "kernel", Value: "6.1", Scope: AttrScopeInventory},
+		{Name: "ipv4", Value: []interface{}{"10.0.0.1", "10.0.0.2"}, Scope: AttrScopeInventory},
+		{Name: "kernel", Value: "6.1", Scope: AttrScopeTags},
+		{Name: AttrNameCreated, Value: created.Add(time.Hour), Scope: AttrScopeSystem},
+	}
+
+	assert.Equal(t, DevicesDiff{
+		Added: DeviceAttributes{
+			{Name: "kernel", Value: "6.1", Scope: AttrScopeTags},
+		},
+		Removed: DeviceAttributes{
+			{Name: "legacy", Value: "yes", Scope: AttrScopeInventory},
+		},
+		Changed: []AttributeChange{
+			{Name: "mac", Scope: AttrScopeIdentity, Value: "00:01", NewValue: "00:02"},
+			{Name: "kernel", Scope: AttrScopeInventory, Value: "5.10", NewValue: "6.1"},
+		},
+	}, DiffAttributes(base, other))
+
+	assert.Equal(t, DevicesDiff{
+		Added:   DeviceAttributes{},
+		Removed: DeviceAttributes{},
+		Changed: []AttributeChange{},
+	}, DiffAttributes(base, base))
+}
@@ -16,6 +16,7 @@ package model
 
 import (
 	"encoding/json"
+	"math"
 	"reflect"
 	"regexp"
 	"strings"
@@ -70,10 +71,17 @@ type DeviceAttribute struct {
 }
 
 func (da DeviceAttribute) Validate() error {
+	return da.validate(false)
+}
+
+func (da DeviceAttribute) validate(nullable bool) error {
 	return validation.ValidateStruct(&da,
 		validation.Field(&da.Name, validation.Required, validation.Length(1, 1024)),
 		validation.Field(&da.Scope, validation.Required, validation.Length(1, 1024)),
-		validation.Field(&da.Value, validation.By(validateDeviceAttrVal)),
+		validation.Field(&da.Value, validation.When(
+			!nullable || da.Value != nil,
+			validation.By(validateDeviceAttrVal),
+		)),
 		validation.Field(&da.Timestamp, validation.Date(time.RFC3339)),
 	)
 }
@@ -157,6 +165,13 @@ type Device struct {
 
 	//text attribute for the full-text search
 	Text string `json:"-" bson:"text,omitempty"`
+
+	//set if some attributes were left out of the search result to
+	//bound its size
+	Truncated bool `json:"truncated,omitempty" bson:"truncated,omitempty"`
+
+	//composite score of the device, set when searching with scoring
+	Score *float64 `json:"score,omitempty" bson:"score,omitempty"`
 }
 
 // internalDevice is only used internally to avoid recursive type-loops for
@@ -203,6 +218,51 @@ func (d Device) MarshalBSON() ([]byte, error) {
 	return bson.Marshal(internalDevice(d))
 }
 
+// MarshalJSON adds the device's creation and last update timestamps as
+// top-level fields, falling back to the system-scope attributes when the
+// timestamps are not set on the device itself.
+func (d Device) MarshalJSON() ([]byte, error) {
+	var createdTs *time.Time
+	if !d.CreatedTs.IsZero() {
+		createdTs = &d.CreatedTs
+	}
+	for _, attr := range d.Attributes {
+		if attr.Scope != AttrScopeSystem {
+			continue
+		}
+		switch attr.Name {
+		case AttrNameCreated:
+			if createdTs == nil {
+				createdTs = attributeTime(attr.Value)
+			}
+		case AttrNameUpdated:
+			if d.UpdatedTs == nil {
+				d.UpdatedTs = attributeTime(attr.Value)
+			}
+		}
+	}
+	return json.Marshal(struct {
+		internalDevice
+		CreatedTs *time.Time `json:"created_ts,omitempty"`
+	}{
+		internalDevice: internalDevice(d),
+		CreatedTs:      createdTs,
+	})
+}
+
+func attributeTime(value interface{}) *time.Time {
+	var t time.Time
+	switch v := value.(type) {
+	case time.Time:
+		t = v
+	case primitive.DateTime:
+		t = v.Time()
+	default:
+		return nil
+	}
+	return &t
+}
+
 func (d Device) Validate() error {
 	return validation.ValidateStruct(&d,
 		validation.Field(&d.ID, validation.Required, validation.Length(1, 1024)),
@@ -272,6 +332,100 @@ func (d DeviceAttributes) Validate() error {
 	return nil
 }
 
+// ValidateNullable works like Validate, but accepts attributes with a null
+// value, which the attribute update operations remove from the device.
+func (d DeviceAttributes) ValidateNullable() error {
+	for _, a := range d {
+		if err := a.validate(true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RoundFloats returns a copy of the attributes with the numeric values,
+// and the numeric values of the arrays, rounded to the given decimals
+func (d DeviceAttributes) RoundFloats(decimals int) DeviceAttributes {
+	if d == nil {
+		return nil
+	}
+	pow := math.Pow10(decimals)
+	round := func(value float64) float64 {
+		scaled := value * pow
+		if math.IsInf(scaled, 0) || math.IsNaN(scaled) {
+			// too large to round, and has no decimals anyway
+			return value
+		}
+		return math.Round(scaled) / pow
+	}
+	attrs := make(DeviceAttributes, len(d))
+	copy(attrs, d)
+	for i := range attrs {
+		switch value := attrs[i].Value.(type) {
+		case float64:
+			attrs[i].Value = round(value)
+		case []float64:
+			values := make([]float64, len(value))
+			for j := range value {
+				values[j] = round(value[j])
+			}
+			attrs[i].Value = values
+		case []interface{}:
+			values := make([]interface{}, len(value))
+			for j := range value {
+				if f, ok := value[j].(float64); ok {
+					values[j] = round(f)
+				} else {
+					values[j] = value[j]
+				}
+			}
+			attrs[i].Value = values
+		}
+	}
+	return attrs
+}
+
+// TrimStrings returns a copy of the attributes with the string values, and
+// the string elements of the arrays, of the attributes of the given scopes
+// trimmed of the leading and trailing whitespace
+func (d DeviceAttributes) TrimStrings(scopes []string) DeviceAttributes {
+	if d == nil {
+		return nil
+	}
+	trimmed := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		trimmed[scope] = true
+	}
+	attrs := make(DeviceAttributes, len(d))
+	copy(attrs, d)
+	for i := range attrs {
+		if !trimmed[attrs[i].Scope] {
+			continue
+		}
+		switch value := attrs[i].Value.(type) {
+		case string:
+			attrs[i].Value = strings.TrimSpace(value)
+		case []string:
+			values := make([]string, len(value))
+			for j := range value {
+				values[j] = strings.TrimSpace(value[j])
+			}
+			attrs[i].Value = values
+		case []interface{}:
+			values := make([]interface{}, len(value))
+			for j := range value {
+				if s, ok := value[j].(string); ok {
+					values[j] = strings.TrimSpace(s)
+				} else {
+					values[j] = value[j]
+				}
+			}
+			attrs[i].Value = values
+		}
+	}
+	return attrs
+}
+
 func GetDeviceAttributeNameReplacer() *strings.Replacer {
 	return strings.NewReplacer(".", string(runeDot), "$", string(runeDollar))
 }
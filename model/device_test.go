@@ -15,10 +15,13 @@ package model
 
 import (
 	"encoding/json"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func TestDeviceAttributesUnmarshal(t *testing.T) {
@@ -77,6 +80,32 @@ func TestDeviceAttributesMarshal(t *testing.T) {
 	assert.Equal(t, "[]", string(data))
 }
 
+func TestDeviceMarshalJSONTimestamps(t *testing.T) {
+	created := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	updated := time.Date(2023, 2, 3, 4, 5, 6, 0, time.UTC)
+
+	data, err := json.Marshal(Device{ID: "1"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":"1"}`, string(data))
+
+	data, err = json.Marshal(Device{ID: "1", Truncated: true})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":"1","truncated":true}`, string(data))
+
+	data, err = json.Marshal(Device{
+		ID: "1",
+		Attributes: DeviceAttributes{
+			{Name: AttrNameCreated, Scope: AttrScopeSystem, Value: primitive.NewDateTimeFromTime(created)},
+			{Name: AttrNameUpdated, Scope: AttrScopeSystem, Value: updated},
+		},
+	})
+	assert.NoError(t, err)
+	var dev map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &dev))
+	assert.Equal(t, "2023-01-02T03:04:05Z", dev["created_ts"])
+	assert.Equal(t, "2023-02-03T04:05:06Z", dev["updated_ts"])
+}
+
 func TestMarshalMarshalBSON(t *testing.T) {
 	dev := Device{
 		ID: "foo",
@@ -265,6 +294,89 @@ func TestValidateDeviceAttributes(t *testing.T) {
 
 }
 
+func TestValidateDeviceAttributesNullable(t *testing.T) {
+	t.Parallel()
+
+	attrs := DeviceAttributes{{
+		Name:  "removed",
+		Scope: AttrScopeInventory,
+	}, {
+		Name:  "empty",
+		Value: "",
+		Scope: AttrScopeInventory,
+	}}
+	assert.NoError(t, attrs.ValidateNullable())
+	assert.EqualError(t, attrs.Validate(),
+		"value: supported types are string, float64, and arrays thereof.")
+
+	attrs = DeviceAttributes{{
+		Name:  "illegal",
+		Value: []byte("foo"),
+		Scope: AttrScopeInventory,
+	}}
+	assert.EqualError(t, attrs.ValidateNullable(),
+		"value: supported types are string, float64, and arrays thereof.")
+}
+
+func TestDeviceAttributesRoundFloats(t *testing.T) {
+	attrs := DeviceAttributes{
+		{Name: "temp", Value: 21.456789, Scope: AttrScopeInventory},
+		{Name: "load", Value: []float64{0.125, 1.0049}, Scope: AttrScopeInventory},
+		{Name: "mixed", Value: []interface{}{2.0051, 3.5}, Scope: AttrScopeInventory},
+		{Name: "os", Value: "Linux 5.15.0", Scope: AttrScopeInventory},
+		{Name: "ips", Value: []interface{}{"1.1.1.1"}, Scope: AttrScopeInventory},
+	}
+
+	rounded := attrs.RoundFloats(2)
+	assert.Equal(t, DeviceAttributes{
+		{Name: "temp", Value: 21.46, Scope: AttrScopeInventory},
+		{Name: "load", Value: []float64{0.13, 1.0}, Scope: AttrScopeInventory},
+		{Name: "mixed", Value: []interface{}{2.01, 3.5}, Scope: AttrScopeInventory},
+		{Name: "os", Value: "Linux 5.15.0", Scope: AttrScopeInventory},
+		{Name: "ips", Value: []interface{}{"1.1.1.1"}, Scope: AttrScopeInventory},
+	}, rounded)
+	// the attributes are left untouched
+	assert.Equal(t, 21.456789, attrs[0].Value)
+	assert.Equal(t, []interface{}{2.0051, 3.5}, attrs[2].Value)
+
+	assert.Equal(t, 21.0, attrs.RoundFloats(0)[0].Value)
+	assert.Nil(t, DeviceAttributes(nil).RoundFloats(2))
+
+	attrs = DeviceAttributes{
+		{Name: "big", Value: math.MaxFloat64, Scope: AttrScopeInventory},
+		{Name: "bigs", Value: []float64{-math.MaxFloat64, 1.234}, Scope: AttrScopeInventory},
+	}
+	rounded = attrs.RoundFloats(15)
+	assert.Equal(t, math.MaxFloat64, rounded[0].Value)
+	assert.Equal(t, []float64{-math.MaxFloat64, 1.234}, rounded[1].Value)
+}
+
+func TestDeviceAttributesTrimStrings(t *testing.T) {
+	attrs := DeviceAttributes{
+		{Name: "os", Value: " Linux 5.15.0\n", Scope: AttrScopeInventory},
+		{Name: "hosts", Value: []string{" a.example.com", "b.example.com "},
+			Scope: AttrScopeInventory},
+		{Name: "mixed", Value: []interface{}{" a ", 1.5}, Scope: AttrScopeInventory},
+		{Name: "temp", Value: 21.5, Scope: AttrScopeInventory},
+		{Name: "tag", Value: " foo ", Scope: AttrScopeTags},
+	}
+
+	trimmed := attrs.TrimStrings([]string{AttrScopeInventory})
+	assert.Equal(t, DeviceAttributes{
+		{Name: "os", Value: "Linux 5.15.0", Scope: AttrScopeInventory},
+		{Name: "hosts", Value: []string{"a.example.com", "b.example.com"},
+			Scope: AttrScopeInventory},
+		{Name: "mixed", Value: []interface{}{"a", 1.5}, Scope: AttrScopeInventory},
+		{Name: "temp", Value: 21.5, Scope: AttrScopeInventory},
+		{Name: "tag", Value: " foo ", Scope: AttrScopeTags},
+	}, trimmed)
+	// the attributes are left untouched
+	assert.Equal(t, " Linux 5.15.0\n", attrs[0].Value)
+	assert.Equal(t, []interface{}{" a ", 1.5}, attrs[2].Value)
+
+	assert.Nil(t, DeviceAttributes(nil).TrimStrings([]string{AttrScopeInventory}))
+}
+
 func TestValidateGroupName(t *testing.T) {
 	t.Parallel()
 	group1 := GroupName(make([]byte, 1025))
@@ -277,4 +389,10 @@ func TestValidateGroupName(t *testing.T) {
 	assert.EqualError(t, group3.Validate(), "Group name cannot be blank")
 	group4 := GroupName("test")
 	assert.NoError(t, group4.Validate())
+	group5 := GroupName("pro d")
+	assert.EqualError(t, group5.Validate(), "Group name can only contain: "+
+		"upper/lowercase alphanum, -(dash), _(underscore)")
+	group6 := GroupName("prod ")
+	assert.EqualError(t, group6.Validate(), "Group name can only contain: "+
+		"upper/lowercase alphanum, -(dash), _(underscore)")
 }
@@ -0,0 +1,57 @@
+// Copyright 2023 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+package model
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Names of the features which can be toggled per tenant.
+const (
+	FeatureAddDeviceCreateOnly       = "add_device_create_only"
+	FeatureNullAttributeValueRemoves = "null_attribute_value_removes"
+)
+
+var knownFeatures = []string{
+	FeatureAddDeviceCreateOnly,
+	FeatureNullAttributeValueRemoves,
+}
+
+// FeatureFlags maps the names of the features to whether they are enabled
+// for a tenant; the features not set follow the service configuration.
+type FeatureFlags map[string]bool
+
+func (f FeatureFlags) Validate() error {
+	for name := range f {
+		known := false
+		for _, feature := range knownFeatures {
+			if name == feature {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return errors.Errorf("unknown feature: %s", name)
+		}
+	}
+	return nil
+}
+
+// Enabled returns whether the feature is enabled, or def if it is not set.
+func (f FeatureFlags) Enabled(name string, def bool) bool {
+	if enabled, ok := f[name]; ok {
+		return enabled
+	}
+	return def
+}
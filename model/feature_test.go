@@ -0,0 +1,40 @@
+// Copyright 2023 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeatureFlagsValidate(t *testing.T) {
+	err := FeatureFlags{
+		FeatureAddDeviceCreateOnly:       true,
+		FeatureNullAttributeValueRemoves: false,
+	}.Validate()
+	assert.NoError(t, err)
+
+	err = FeatureFlags{"foo": true}.Validate()
+	assert.EqualError(t, err, "unknown feature: foo")
+}
+
+func TestFeatureFlagsEnabled(t *testing.T) {
+	flags := FeatureFlags{
+		FeatureAddDeviceCreateOnly: false,
+	}
+	assert.False(t, flags.Enabled(FeatureAddDeviceCreateOnly, true))
+	assert.True(t, flags.Enabled(FeatureNullAttributeValueRemoves, true))
+	assert.False(t, FeatureFlags(nil).Enabled(FeatureNullAttributeValueRemoves, false))
+}
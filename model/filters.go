@@ -14,17 +14,102 @@
 package model
 
 import (
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/pkg/errors"
 )
 
+// FilterTypePrefix matches the string attribute values starting with the
+// predicate's value.
+const FilterTypePrefix = "$prefix"
+
+// FilterTypeRegex matches the string attribute values against the
+// regular expression of the predicate's value.
+const FilterTypeRegex = "$regex"
+
+// FilterTypeExists matches the devices having the attribute, or not
+// having it if the predicate's value is false.
+const FilterTypeExists = "$exists"
+
+// FilterTypeExclude matches the devices having the attribute with none of
+// the values of the predicate; unlike $nin, it doesn't match the devices
+// missing the attribute.
+const FilterTypeExclude = "$exclude"
+
+// MaxRegexLength is the maximum length of the regular expression of a
+// $regex predicate.
+const MaxRegexLength = 256
+
 var validSelectors = []interface{}{
 	"$eq",
 	"$nin",
+	"$gt",
+	"$gte",
+	"$lt",
+	"$lte",
+	FilterTypePrefix,
+	FilterTypeRegex,
+	FilterTypeExists,
+	FilterTypeExclude,
+}
+
+// rangeSelectors are the operators bounding the attribute values; the
+// predicates with them on the same attribute make up a single range.
+var rangeSelectors = map[string]bool{
+	"$gt":  true,
+	"$gte": true,
+	"$lt":  true,
+	"$lte": true,
+}
+
+// IsRange tells whether the predicate bounds the values of the attribute,
+// e.g. from below with $gte.
+func (f FilterPredicate) IsRange() bool {
+	return f.Ref == nil && rangeSelectors[f.Type]
+}
+
+// validRegexOptions matches the options of a $regex predicate supported
+// by both the MongoDB and the Go regular expressions: case-insensitive,
+// multi-line and dot matching new lines.
+var validRegexOptions = regexp.MustCompile("^[ims]*$")
+
+// MaxFilterPathDepth is the maximum number of fields of the path of a
+// filter predicate into an object attribute value.
+const MaxFilterPathDepth = 8
+
+// validFilterPath matches the dot-separated field names of the path of a
+// filter predicate into an object attribute value.
+var validFilterPath = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+
+// validRefSelectors are the comparison operators allowed when a predicate
+// compares two attributes of the same device.
+var validRefSelectors = []interface{}{
+	"$eq",
+	"$ne",
+	"$gt",
+	"$gte",
+	"$lt",
+	"$lte",
 }
 
 var validSortOrders = []interface{}{"asc", "desc"}
 
+// MaxScoreTerms is the maximum number of weighted attributes making up
+// the composite score of a search.
+const MaxScoreTerms = 10
+
+// validScoreScopes are the scopes holding the numeric attributes which
+// may contribute to the composite score.
+var validScoreScopes = []interface{}{
+	AttrScopeInventory,
+	AttrScopeMonitor,
+	AttrScopeTags,
+}
+
 type SearchParams struct {
 	Page       int               `json:"page"`
 	PerPage    int               `json:"per_page"`
@@ -33,6 +118,15 @@ type SearchParams struct {
 	Attributes []SelectAttribute `json:"attributes"`
 	DeviceIDs  []string          `json:"device_ids"`
 	Text       string            `json:"text"`
+	// Score, if set, orders the devices by the weighted sum of the
+	// given numeric attributes, highest first.
+	Score []ScoreTerm `json:"score"`
+	// EstimateCount tolerates an estimated total count of the matching
+	// devices, counting them up to the configured limit only.
+	EstimateCount bool `json:"estimate_count"`
+	// CountLimit, if positive, stops counting the matching devices at
+	// this number; set from the configuration when EstimateCount is set.
+	CountLimit int `json:"-"`
 }
 
 type Filter struct {
@@ -46,6 +140,15 @@ type FilterPredicate struct {
 	Attribute string      `json:"attribute" bson:"attribute"`
 	Type      string      `json:"type" bson:"type"`
 	Value     interface{} `json:"value" bson:"value"`
+	// Ref, if set, makes the predicate compare the attribute against
+	// another attribute of the same device instead of against Value.
+	Ref *SelectAttribute `json:"ref,omitempty" bson:"ref,omitempty"`
+	// Options are the flags of a $regex predicate, e.g. "i" to match
+	// regardless of the case.
+	Options string `json:"options,omitempty" bson:"options,omitempty"`
+	// Path, if set, makes the predicate match the field at the dotted
+	// path within an object attribute value, e.g. "region" of "geo".
+	Path string `json:"path,omitempty" bson:"path,omitempty"`
 }
 
 type SortCriteria struct {
@@ -54,11 +157,51 @@ type SortCriteria struct {
 	Order     string `json:"order"`
 }
 
+// ScoreTerm is a weighted attribute contributing to the composite score
+// of a device; non-numeric or missing values contribute nothing.
+type ScoreTerm struct {
+	Scope     string  `json:"scope"`
+	Attribute string  `json:"attribute"`
+	Weight    float64 `json:"weight"`
+}
+
+func (t ScoreTerm) Validate() error {
+	return validation.ValidateStruct(&t,
+		validation.Field(&t.Scope, validation.Required,
+			validation.In(validScoreScopes...)),
+		validation.Field(&t.Attribute, validation.Required),
+		validation.Field(&t.Weight, validation.Required,
+			validation.By(validateFinite)))
+}
+
+func validateFinite(value interface{}) error {
+	f, _ := value.(float64)
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return errors.New("must be a finite number")
+	}
+	return nil
+}
+
 type SelectAttribute struct {
 	Scope     string `json:"scope" bson:"scope"`
 	Attribute string `json:"attribute" bson:"attribute"`
 }
 
+// SavedFilter is a named list of filter predicates stored per tenant,
+// which can be searched by without repeating the predicates.
+type SavedFilter struct {
+	ID      string            `json:"id" bson:"_id"`
+	Name    string            `json:"name" bson:"name"`
+	Filters []FilterPredicate `json:"filters" bson:"filters"`
+}
+
+func (f SavedFilter) Validate() error {
+	return validation.ValidateStruct(&f,
+		validation.Field(&f.Name, validation.Required, validation.Length(1, 1024)),
+		validation.Field(&f.Filters, validation.Required),
+	)
+}
+
 func (sp SearchParams) Validate() error {
 	for _, f := range sp.Filters {
 		err := f.Validate()
@@ -85,6 +228,20 @@ func (sp SearchParams) Validate() error {
 			return err
 		}
 	}
+
+	if len(sp.Score) > 0 {
+		if sp.Text != "" {
+			return errors.New("score cannot be combined with text search")
+		}
+		if len(sp.Score) > MaxScoreTerms {
+			return errors.Errorf("score: at most %d terms are allowed", MaxScoreTerms)
+		}
+		for _, t := range sp.Score {
+			if err := t.Validate(); err != nil {
+				return errors.Wrap(err, "score")
+			}
+		}
+	}
 	return nil
 }
 
@@ -110,9 +267,97 @@ func (f Filter) Validate() error {
 }
 
 func (f FilterPredicate) Validate() error {
+	if f.Ref != nil {
+		return f.validateRef()
+	}
 	return validation.ValidateStruct(&f,
 		validation.Field(&f.Scope, validation.Required),
 		validation.Field(&f.Attribute, validation.Required),
 		validation.Field(&f.Type, validation.Required, validation.In(validSelectors...)),
-		validation.Field(&f.Value, validation.NotNil))
+		validation.Field(&f.Value, validation.NotNil,
+			validation.When(f.Type == FilterTypePrefix,
+				validation.By(validatePrefixValue)),
+			validation.When(f.Type == FilterTypeRegex,
+				validation.By(f.validateRegexValue)),
+			validation.When(f.Type == FilterTypeExists,
+				validation.By(validateExistsValue)),
+			validation.When(f.Type == FilterTypeExclude,
+				validation.By(validateExcludeValue))),
+		validation.Field(&f.Options,
+			validation.When(f.Type != FilterTypeRegex, validation.Empty),
+			validation.Match(validRegexOptions).
+				Error("must be a combination of i, m and s")),
+		validation.Field(&f.Path, validation.By(validateFilterPath)))
+}
+
+func validateFilterPath(value interface{}) error {
+	path, _ := value.(string)
+	if path == "" {
+		return nil
+	} else if !validFilterPath.MatchString(path) {
+		return errors.New("must be dot-separated field names made of " +
+			"alphanumeric characters, - and _")
+	} else if strings.Count(path, ".") >= MaxFilterPathDepth {
+		return errors.Errorf("must be at most %d fields deep", MaxFilterPathDepth)
+	}
+	return nil
+}
+
+func validatePrefixValue(value interface{}) error {
+	if s, ok := value.(string); !ok || s == "" {
+		return errors.New("prefix must be a non-empty string")
+	}
+	return nil
+}
+
+func validateExistsValue(value interface{}) error {
+	if _, ok := value.(bool); !ok {
+		return errors.New("must be a boolean")
+	}
+	return nil
+}
+
+func validateExcludeValue(value interface{}) error {
+	if v := reflect.ValueOf(value); v.Kind() != reflect.Slice {
+		return errors.New("must be an array")
+	}
+	return nil
+}
+
+// validateRegexValue checks that the value is a regular expression which
+// compiles with the options of the predicate
+func (f FilterPredicate) validateRegexValue(value interface{}) error {
+	pattern, ok := value.(string)
+	if !ok || pattern == "" {
+		return errors.New("regex must be a non-empty string")
+	} else if len(pattern) > MaxRegexLength {
+		return errors.Errorf("regex must be at most %d characters long", MaxRegexLength)
+	}
+	if f.Options != "" && validRegexOptions.MatchString(f.Options) {
+		pattern = "(?" + f.Options + ")" + pattern
+	}
+	if _, err := regexp.Compile(pattern); err != nil {
+		return errors.Wrap(err, "invalid regex")
+	}
+	return nil
+}
+
+func (f FilterPredicate) validateRef() error {
+	err := validation.ValidateStruct(&f,
+		validation.Field(&f.Scope, validation.Required),
+		validation.Field(&f.Attribute, validation.Required),
+		validation.Field(&f.Type, validation.Required, validation.In(validRefSelectors...)),
+		validation.Field(&f.Value, validation.Nil),
+		validation.Field(&f.Path, validation.Empty))
+	if err != nil {
+		return err
+	}
+	ref := f.Ref
+	err = validation.ValidateStruct(ref,
+		validation.Field(&ref.Scope, validation.Required),
+		validation.Field(&ref.Attribute, validation.Required))
+	if err != nil {
+		return errors.Wrap(err, "ref")
+	}
+	return nil
 }
@@ -14,6 +14,7 @@
 package model
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/pkg/errors"
@@ -52,6 +53,298 @@ func TestSearchParams(t *testing.T) {
 			},
 			err: errors.New("attribute: cannot be blank."),
 		},
+		"ok, prefix": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "identity",
+						Attribute: "id",
+						Type:      FilterTypePrefix,
+						Value:     "5f2a",
+					},
+				},
+			},
+		},
+		"ko, prefix not a string": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "identity",
+						Attribute: "id",
+						Type:      FilterTypePrefix,
+						Value:     5.0,
+					},
+				},
+			},
+			err: errors.New("value: prefix must be a non-empty string."),
+		},
+		"ko, empty prefix": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "identity",
+						Attribute: "id",
+						Type:      FilterTypePrefix,
+						Value:     "",
+					},
+				},
+			},
+			err: errors.New("value: prefix must be a non-empty string."),
+		},
+		"ok, regex": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "hostname",
+						Type:      FilterTypeRegex,
+						Value:     "^rpi-[0-9]+",
+						Options:   "i",
+					},
+				},
+			},
+		},
+		"ko, regex not a string": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "hostname",
+						Type:      FilterTypeRegex,
+						Value:     5.0,
+					},
+				},
+			},
+			err: errors.New("value: regex must be a non-empty string."),
+		},
+		"ko, regex too long": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "hostname",
+						Type:      FilterTypeRegex,
+						Value:     strings.Repeat("a", MaxRegexLength+1),
+					},
+				},
+			},
+			err: errors.New("value: regex must be at most 256 characters long."),
+		},
+		"ko, invalid regex": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "hostname",
+						Type:      FilterTypeRegex,
+						Value:     "rpi-(",
+					},
+				},
+			},
+			err: errors.New("value: invalid regex: error parsing regexp: " +
+				"missing closing ): `rpi-(`."),
+		},
+		"ko, invalid regex options": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "hostname",
+						Type:      FilterTypeRegex,
+						Value:     "rpi",
+						Options:   "x",
+					},
+				},
+			},
+			err: errors.New("options: must be a combination of i, m and s."),
+		},
+		"ko, options without regex": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "hostname",
+						Type:      "$eq",
+						Value:     "rpi",
+						Options:   "i",
+					},
+				},
+			},
+			err: errors.New("options: must be blank."),
+		},
+		"ok, range": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "disk_free",
+						Type:      "$gte",
+						Value:     1024.0,
+					},
+					{
+						Scope:     "inventory",
+						Attribute: "disk_free",
+						Type:      "$lt",
+						Value:     4096.0,
+					},
+				},
+			},
+		},
+		"ok, exists": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "rootfs-image.version",
+						Type:      FilterTypeExists,
+						Value:     false,
+					},
+				},
+			},
+		},
+		"ko, exists not a boolean": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "rootfs-image.version",
+						Type:      FilterTypeExists,
+						Value:     "false",
+					},
+				},
+			},
+			err: errors.New("value: must be a boolean."),
+		},
+		"ok, exclude": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "rootfs-image.version",
+						Type:      FilterTypeExclude,
+						Value:     []interface{}{"1.0", "1.1"},
+					},
+				},
+			},
+		},
+		"ko, exclude not an array": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "rootfs-image.version",
+						Type:      FilterTypeExclude,
+						Value:     "1.0",
+					},
+				},
+			},
+			err: errors.New("value: must be an array."),
+		},
+		"ok, path": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "geo",
+						Type:      "$eq",
+						Value:     "EU",
+						Path:      "location.region",
+					},
+				},
+			},
+		},
+		"ko, invalid path": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "geo",
+						Type:      "$eq",
+						Value:     "EU",
+						Path:      "location..$region",
+					},
+				},
+			},
+			err: errors.New("path: must be dot-separated field names made of " +
+				"alphanumeric characters, - and _."),
+		},
+		"ko, path too deep": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "geo",
+						Type:      "$eq",
+						Value:     "EU",
+						Path:      "a.b.c.d.e.f.g.h.i",
+					},
+				},
+			},
+			err: errors.New("path: must be at most 8 fields deep."),
+		},
+		"ok, attribute reference": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "scope",
+						Attribute: "attribute",
+						Type:      "$ne",
+						Ref: &SelectAttribute{
+							Scope:     "scope",
+							Attribute: "other",
+						},
+					},
+				},
+			},
+		},
+		"ko, attribute reference with value": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "scope",
+						Attribute: "attribute",
+						Type:      "$ne",
+						Value:     "value",
+						Ref: &SelectAttribute{
+							Scope:     "scope",
+							Attribute: "other",
+						},
+					},
+				},
+			},
+			err: errors.New("value: must be blank."),
+		},
+		"ko, attribute reference without attribute": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "scope",
+						Attribute: "attribute",
+						Type:      "$eq",
+						Ref: &SelectAttribute{
+							Scope: "scope",
+						},
+					},
+				},
+			},
+			err: errors.New("ref: attribute: cannot be blank."),
+		},
+		"ko, attribute reference bad operator": {
+			params: &SearchParams{
+				Filters: []FilterPredicate{
+					{
+						Scope:     "scope",
+						Attribute: "attribute",
+						Type:      "$in",
+						Ref: &SelectAttribute{
+							Scope:     "scope",
+							Attribute: "other",
+						},
+					},
+				},
+			},
+			err: errors.New("type: must be a valid value."),
+		},
 		"ok, sort": {
 			params: &SearchParams{
 				Sort: []SortCriteria{
@@ -94,6 +387,45 @@ func TestSearchParams(t *testing.T) {
 			},
 			err: errors.New("attribute: cannot be blank."),
 		},
+		"ok, score": {
+			params: &SearchParams{
+				Score: []ScoreTerm{
+					{Scope: "monitor", Attribute: "alerts", Weight: 2},
+					{Scope: "inventory", Attribute: "uptime", Weight: -0.5},
+				},
+			},
+		},
+		"ko, score scope": {
+			params: &SearchParams{
+				Score: []ScoreTerm{
+					{Scope: "identity", Attribute: "mac", Weight: 1},
+				},
+			},
+			err: errors.New("score: scope: must be a valid value."),
+		},
+		"ko, score weight": {
+			params: &SearchParams{
+				Score: []ScoreTerm{
+					{Scope: "monitor", Attribute: "alerts"},
+				},
+			},
+			err: errors.New("score: weight: cannot be blank."),
+		},
+		"ko, score with text": {
+			params: &SearchParams{
+				Text: "foo",
+				Score: []ScoreTerm{
+					{Scope: "monitor", Attribute: "alerts", Weight: 1},
+				},
+			},
+			err: errors.New("score cannot be combined with text search"),
+		},
+		"ko, too many score terms": {
+			params: &SearchParams{
+				Score: make([]ScoreTerm, MaxScoreTerms+1),
+			},
+			err: errors.New("score: at most 10 terms are allowed"),
+		},
 	}
 
 	for name, tc := range testCases {
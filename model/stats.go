@@ -0,0 +1,123 @@
+// Copyright 2023 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+package model
+
+import (
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pkg/errors"
+)
+
+// Granularities of the time buckets of the device statistics.
+const (
+	BucketDay  = "day"
+	BucketWeek = "week"
+)
+
+// MaxTimeBuckets limits the number of time buckets of the statistics.
+const MaxTimeBuckets = 366
+
+// TimeBucketCount is the number of devices counted in the time bucket
+// starting at the given time.
+type TimeBucketCount struct {
+	Bucket time.Time `json:"bucket" bson:"bucket"`
+	Count  int       `json:"count" bson:"count"`
+}
+
+// OnboardingStatsParams are the parameters of the statistics of the
+// devices created within the time range [From, To).
+type OnboardingStatsParams struct {
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Granularity string    `json:"granularity"`
+}
+
+func (p OnboardingStatsParams) Validate() error {
+	err := validation.ValidateStruct(&p,
+		validation.Field(&p.From, validation.Required),
+		validation.Field(&p.To, validation.Required),
+		validation.Field(&p.Granularity, validation.Required,
+			validation.In(BucketDay, BucketWeek)),
+	)
+	if err != nil {
+		return err
+	}
+	if !p.To.After(p.From) {
+		return errors.New("to: must be after from.")
+	}
+	if len(p.Buckets()) > MaxTimeBuckets {
+		return errors.Errorf("too many buckets: the limit is %d", MaxTimeBuckets)
+	}
+	return nil
+}
+
+// BucketStart returns the start of the time bucket, in UTC, containing t;
+// the weeks start on Monday.
+func (p OnboardingStatsParams) BucketStart(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if p.Granularity == BucketWeek {
+		// time.Sunday is 0: shift so that Monday starts the week
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	}
+	return day
+}
+
+// Buckets returns the starts of the time buckets covering the time range;
+// the buckets are capped past MaxTimeBuckets.
+func (p OnboardingStatsParams) Buckets() []time.Time {
+	step := 1
+	if p.Granularity == BucketWeek {
+		step = 7
+	}
+	var buckets []time.Time
+	for t := p.BucketStart(p.From); t.Before(p.To); t = t.AddDate(0, 0, step) {
+		buckets = append(buckets, t)
+		if len(buckets) > MaxTimeBuckets {
+			break
+		}
+	}
+	return buckets
+}
+
+// Alert count buckets of the devices' alerts summary.
+const (
+	AlertCountBucketNone = "0"
+	AlertCountBucketFew  = "1-5"
+	AlertCountBucketMany = "6+"
+)
+
+// AlertCountBuckets lists the alert count buckets in ascending order.
+var AlertCountBuckets = []string{
+	AlertCountBucketNone,
+	AlertCountBucketFew,
+	AlertCountBucketMany,
+}
+
+// AlertCountBucket is the number of devices whose alert count falls in
+// the bucket.
+type AlertCountBucket struct {
+	Bucket string `json:"bucket"`
+	Count  int    `json:"count"`
+}
+
+// AlertsSummary counts the devices with and without alerts, and the
+// devices per alert count bucket.
+type AlertsSummary struct {
+	WithAlerts    int                `json:"with_alerts"`
+	WithoutAlerts int                `json:"without_alerts"`
+	Buckets       []AlertCountBucket `json:"buckets"`
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnboardingStatsParamsValidate(t *testing.T) {
+	from := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		params OnboardingStatsParams
+		err    string
+	}{
+		"ok": {
+			params: OnboardingStatsParams{
+				From: from, To: from.AddDate(0, 1, 0), Granularity: BucketDay,
+			},
+		},
+		"ok, a year of weeks": {
+			params: OnboardingStatsParams{
+				From: from, To: from.AddDate(1, 0, 0), Granularity: BucketWeek,
+			},
+		},
+		"error, missing fields": {
+			err: "from: cannot be blank; granularity: cannot be blank; to: cannot be blank.",
+		},
+		"error, to before from": {
+			params: OnboardingStatsParams{
+				From: from, To: from, Granularity: BucketDay,
+			},
+			err: "to: must be after from.",
+		},
+		"error, too many buckets": {
+			params: OnboardingStatsParams{
+				From: from, To: from.AddDate(2, 0, 0), Granularity: BucketDay,
+			},
+			err: "too many buckets: the limit is 366",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.params.Validate()
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestOnboardingStatsParamsBuckets(t *testing.T) {
+	params := OnboardingStatsParams{
+		// a Wednesday
+		From:        time.Date(2023, 3, 1, 15, 0, 0, 0, time.UTC),
+		To:          time.Date(2023, 3, 7, 0, 0, 0, 0, time.UTC),
+		Granularity: BucketWeek,
+	}
+	assert.Equal(t, []time.Time{
+		time.Date(2023, 2, 27, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, 3, 6, 0, 0, 0, 0, time.UTC),
+	}, params.Buckets())
+
+	params.Granularity = BucketDay
+	assert.Len(t, params.Buckets(), 6)
+	assert.Equal(t, time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), params.Buckets()[0])
+}
@@ -17,3 +17,9 @@ package model
 type NewTenant struct {
 	ID string
 }
+
+// TenantDevice is a device labeled with the ID of the tenant owning it.
+type TenantDevice struct {
+	TenantID string `json:"tenant_id"`
+	Device   Device `json:"device"`
+}
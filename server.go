@@ -14,7 +14,12 @@
 package main
 
 import (
+	"context"
+	"net"
 	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -25,22 +30,39 @@ import (
 	"github.com/mendersoftware/inventory/client/workflows"
 	"github.com/mendersoftware/inventory/config"
 	inventory "github.com/mendersoftware/inventory/inv"
+	"github.com/mendersoftware/inventory/store"
 	"github.com/mendersoftware/inventory/store/mongo"
 )
 
+// maxFloatDecimals is the most decimals a float64 holds exactly
+const maxFloatDecimals = 15
+
 func RunServer(c config.Reader) error {
 
 	l := log.New(log.Ctx{})
 
+	floatDecimals := c.GetInt(SettingAttributeFloatDecimals)
+	if floatDecimals > maxFloatDecimals {
+		return errors.Errorf("%s must be at most %d",
+			SettingAttributeFloatDecimals, maxFloatDecimals)
+	}
+
 	db, err := mongo.NewDataStoreMongo(makeDataStoreConfig())
 	if err != nil {
 		return errors.Wrap(err, "database connection failed")
 	}
+	if c.GetBool(SettingStoreErrorsRequestID) {
+		db = store.WithRequestIDErrors(db)
+	}
 
 	limitAttributes := c.GetInt(SettingLimitAttributes)
 	limitTags := c.GetInt(SettingLimitTags)
 
-	inv := inventory.NewInventory(db).WithLimits(limitAttributes, limitTags)
+	inv := inventory.NewInventory(db).
+		WithLimits(limitAttributes, limitTags).
+		WithIngestDedupWindow(c.GetDuration(SettingIngestDedupWindow)).
+		WithFloatDecimals(floatDecimals).
+		WithTrimScopes(c.GetStringSlice(SettingAttributeTrimScopes))
 
 	devicemonitorAddr := c.GetString(SettingDevicemonitorAddr)
 	if devicemonitorAddr != "" {
@@ -52,15 +74,100 @@ func RunServer(c config.Reader) error {
 		return err
 	}
 
-	invapi := api_http.NewInventoryApiHandlers(inv)
+	apiConfig := api_http.NewConfig()
+	apiConfig.AddDeviceRejectUnknownFields = c.GetBool(SettingAddDeviceRejectUnknownFields)
+	apiConfig.AddDeviceCreateOnly = c.GetBool(SettingAddDeviceCreateOnly)
+	apiConfig.AddDeviceLocationBaseURL = c.GetString(SettingAddDeviceLocationBaseURL)
+	apiConfig.ScopeAliases = c.GetStringMapString(SettingScopeAliases)
+	apiConfig.ProtectedScopes = c.GetStringSlice(SettingProtectedScopes)
+	apiConfig.MaxBulkDeviceIDs = c.GetInt(SettingMaxBulkDeviceIDs)
+	apiConfig.MaxPageOffset = c.GetInt(SettingMaxPageOffset)
+	apiConfig.MaxLinkPage = c.GetInt(SettingMaxLinkPage)
+	apiConfig.SearchCountLimit = c.GetInt(SettingSearchCountLimit)
+	apiConfig.NullAttributeValueRemoves = c.GetBool(SettingNullAttributeValueRemoves)
+	apiConfig.DefaultFilterScope = c.GetString(SettingFilterDefaultScope)
+	apiConfig.RedactedAttributes = c.GetStringSlice(SettingLogRedactedAttributes)
+	apiConfig.EnableSearchExplain = c.GetBool(SettingEnableSearchExplain)
+	apiConfig.TrimGroupNames = c.GetBool(SettingTrimGroupNames)
+	apiConfig.SearchRequireFilters = c.GetBool(SettingSearchRequireFilters)
+	apiConfig.SearchRequireTenant = c.GetBool(SettingSearchRequireTenant)
+	apiConfig.SearchIndexedFiltersOnly = c.GetBool(SettingSearchIndexedFiltersOnly)
+	apiConfig.IndexedAttributes = c.GetStringSlice(SettingIndexAttributes)
+	apiConfig.DefaultProjection = c.GetStringSlice(SettingDefaultProjection)
+	apiConfig.LenientSortOrder = c.GetBool(SettingLenientSortOrder)
+	apiConfig.MaxResponseBytes = c.GetInt(SettingMaxResponseBytes)
+	for service, scope := range c.GetStringMapString(SettingReindexServiceScopes) {
+		apiConfig.ReindexServiceScopes[service] = scope
+	}
+
+	invapi := api_http.NewInventoryApiHandlers(inv, apiConfig)
 	handler, err := invapi.Build()
 	if err != nil {
 		return errors.Wrap(err, "inventory API handlers setup failed")
 	}
 	addr := c.GetString(SettingListen)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
 	l.Printf("listening on %s", addr)
 
-	return http.ListenAndServe(addr, handler)
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	shutdownTimeout := c.GetDuration(SettingShutdownTimeout)
+	err = runHTTPServer(ctx, makeHTTPServer(c, addr, handler), listener, shutdownTimeout)
+	if err != nil {
+		return err
+	}
+	l.Print("server stopped, closing database connection")
+
+	ctx, cancel = context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return db.Close(ctx)
+}
+
+// runHTTPServer serves requests on the listener until the context is
+// done, then shuts the server down waiting up to the timeout for the
+// in-flight requests to complete.
+func runHTTPServer(
+	ctx context.Context,
+	srv *http.Server,
+	listener net.Listener,
+	shutdownTimeout time.Duration,
+) error {
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- srv.Serve(listener)
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return errors.Wrap(err, "failed to shut down the server gracefully")
+	}
+	if err := <-errChan; err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func makeHTTPServer(c config.Reader, addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: c.GetDuration(SettingHTTPReadHeaderTimeout),
+		ReadTimeout:       c.GetDuration(SettingHTTPReadTimeout),
+		WriteTimeout:      c.GetDuration(SettingHTTPWriteTimeout),
+		IdleTimeout:       c.GetDuration(SettingHTTPIdleTimeout),
+	}
 }
 
 func maybeWithInventory(
@@ -14,7 +14,11 @@
 package main
 
 import (
+	"context"
+	"net"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
@@ -37,3 +41,113 @@ func TestMaybeWithInventory(t *testing.T) {
 	_, err = maybeWithInventory(inv, conf)
 	assert.Nil(t, err)
 }
+
+func TestRunServerFloatDecimals(t *testing.T) {
+	conf := viper.New()
+	conf.Set(SettingAttributeFloatDecimals, 16)
+
+	err := RunServer(conf)
+	assert.EqualError(t, err, "attribute_float_decimals must be at most 15")
+}
+
+func TestMakeHTTPServer(t *testing.T) {
+	handler := http.NewServeMux()
+
+	conf := viper.New()
+	conf.SetDefault(SettingHTTPReadHeaderTimeout, SettingHTTPReadHeaderTimeoutDefault)
+	conf.SetDefault(SettingHTTPReadTimeout, SettingHTTPReadTimeoutDefault)
+	conf.SetDefault(SettingHTTPWriteTimeout, SettingHTTPWriteTimeoutDefault)
+	conf.SetDefault(SettingHTTPIdleTimeout, SettingHTTPIdleTimeoutDefault)
+
+	srv := makeHTTPServer(conf, ":8080", handler)
+	assert.Equal(t, ":8080", srv.Addr)
+	assert.Equal(t, handler, srv.Handler)
+	assert.Equal(t, SettingHTTPReadHeaderTimeoutDefault, srv.ReadHeaderTimeout)
+	assert.Equal(t, SettingHTTPReadTimeoutDefault, srv.ReadTimeout)
+	assert.Equal(t, SettingHTTPWriteTimeoutDefault, srv.WriteTimeout)
+	assert.Equal(t, SettingHTTPIdleTimeoutDefault, srv.IdleTimeout)
+
+	conf.Set(SettingHTTPReadHeaderTimeout, "1s")
+	conf.Set(SettingHTTPReadTimeout, "2s")
+	conf.Set(SettingHTTPWriteTimeout, "3s")
+	conf.Set(SettingHTTPIdleTimeout, "4s")
+
+	srv = makeHTTPServer(conf, ":8080", handler)
+	assert.Equal(t, time.Second, srv.ReadHeaderTimeout)
+	assert.Equal(t, 2*time.Second, srv.ReadTimeout)
+	assert.Equal(t, 3*time.Second, srv.WriteTimeout)
+	assert.Equal(t, 4*time.Second, srv.IdleTimeout)
+}
+
+func TestRunHTTPServer(t *testing.T) {
+	const shutdownTimeout = 5 * time.Second
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	srv := &http.Server{Handler: handler}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- runHTTPServer(ctx, srv, listener, shutdownTimeout)
+	}()
+
+	rsp, err := http.Get("http://" + listener.Addr().String())
+	if assert.NoError(t, err) {
+		rsp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, rsp.StatusCode)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(shutdownTimeout):
+		assert.FailNow(t, "server did not shut down within the timeout")
+	}
+
+	_, err = http.Get("http://" + listener.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestRunHTTPServerDrainTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	srv := &http.Server{Handler: handler}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- runHTTPServer(ctx, srv, listener, 100*time.Millisecond)
+	}()
+
+	go func() {
+		rsp, err := http.Get("http://" + listener.Addr().String())
+		if err == nil {
+			rsp.Body.Close()
+		}
+	}()
+	<-started
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "server did not give up on the in-flight request")
+	}
+}
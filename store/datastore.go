@@ -17,6 +17,7 @@ package store
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/mendersoftware/inventory/model"
 )
@@ -27,24 +28,70 @@ var (
 
 	ErrGroupNotFound = errors.New("group not found")
 
+	ErrFilterNotFound = errors.New("filter not found")
+
 	// ErrNoAttrName is returned if attributes are attempted upserted without
 	// a Name identifier.
 	ErrNoAttrName = errors.New("attribute name not present")
 
 	// ErrWriteConflict represents a write conflict in the storage layer
 	ErrWriteConflict = errors.New("write conflict")
+
+	// ErrDevExists is returned when creating a device which already exists
+	ErrDevExists = errors.New("device already exists")
+
+	// ErrAdminAccessRequired is returned by the cross-tenant operations
+	// if the data store was not created with admin access.
+	ErrAdminAccessRequired = errors.New("admin access required")
+
+	// ErrAttributeTypeConflict is returned in the strict attribute types
+	// mode when an attribute value differs in type from the stored one.
+	ErrAttributeTypeConflict = errors.New(
+		"the type of the attribute value differs from the stored one")
+
+	// ErrScopeNotPurgeable is returned when purging the attributes of
+	// a scope which the devices can't do without.
+	ErrScopeNotPurgeable = errors.New("the attributes of the scope can't be purged")
+
+	// ErrRegexNonString is returned when searching the devices with a
+	// $regex filter on an attribute known to hold non-string values.
+	ErrRegexNonString = errors.New("the $regex filter applies to string attributes only")
 )
 
 //go:generate ../utils/mockgen.sh
 type DataStore interface {
 	Ping(ctx context.Context) error
 
+	// Close disconnects from the database
+	Close(ctx context.Context) error
+
 	GetDevices(ctx context.Context, q ListQuery) ([]model.Device, int, error)
 
+	// GetDevicesPartitionedByGroup returns the IDs of the devices matching
+	// the query filters by group, with the ungrouped devices under the
+	// empty group name; q.Limit caps the number of devices in total and
+	// perGroup the number of devices of each group, zero meaning no limit
+	GetDevicesPartitionedByGroup(
+		ctx context.Context,
+		q ListQuery,
+		perGroup int,
+	) (map[model.GroupName][]model.DeviceID, error)
+
 	// find a device with given `id`, returns the device or nil,
 	// if device was not found, error and returned device are nil
 	GetDevice(ctx context.Context, id model.DeviceID) (*model.Device, error)
 
+	// GetDevicesMap returns the devices with the given IDs keyed by their
+	// IDs; the IDs of the devices which were not found are left out
+	GetDevicesMap(
+		ctx context.Context,
+		ids []model.DeviceID,
+	) (map[model.DeviceID]*model.Device, error)
+
+	// GetDevicesByIDs returns the devices with the given IDs in the order
+	// of the IDs; the IDs of the devices which were not found are left out
+	GetDevicesByIDs(ctx context.Context, ids []model.DeviceID) ([]model.Device, error)
+
 	// insert device into data store
 	//
 	// ds.AddDevice(&model.Device{
@@ -53,6 +100,16 @@ type DataStore interface {
 	// })
 	AddDevice(ctx context.Context, dev *model.Device) error
 
+	// CreateDevice inserts the device into the data store, unlike
+	// AddDevice it never modifies an existing device and returns
+	// ErrDevExists instead
+	CreateDevice(ctx context.Context, dev *model.Device) error
+
+	// ReplaceDevice inserts the device into the data store, unlike
+	// AddDevice it replaces all the attributes of an existing device
+	// with the given ones instead of merging them
+	ReplaceDevice(ctx context.Context, dev *model.Device) error
+
 	// DeleteDevices removes devices with the given IDs from the database.
 	DeleteDevices(ctx context.Context, ids []model.DeviceID) (*model.UpdateResult, error)
 
@@ -94,6 +151,44 @@ type DataStore interface {
 		scope string,
 		etag string,
 	) (*model.UpdateResult, error)
+
+	// ReplaceAllAttributes replaces all the attributes of the device, in
+	// every scope but the system one, with the given attributes in a
+	// single update; the system attributes, such as the creation
+	// timestamp, are kept and the update timestamp is refreshed. Returns
+	// ErrDevNotFound if the device doesn't exist.
+	ReplaceAllAttributes(
+		ctx context.Context,
+		id model.DeviceID,
+		attrs model.DeviceAttributes,
+	) error
+
+	// ToggleAttribute flips the boolean value of the attribute with a
+	// conditional update, or sets it to defaultValue if the device doesn't
+	// have the attribute, and returns the updated device. Returns
+	// ErrDevNotFound if the device doesn't exist and
+	// ErrAttributeTypeConflict if the stored value is not a boolean.
+	ToggleAttribute(
+		ctx context.Context,
+		id model.DeviceID,
+		scope string,
+		name string,
+		defaultValue bool,
+	) (*model.Device, error)
+
+	// MoveAttributesBetweenScopes moves all the attributes of the device
+	// from one scope to another in one update, resolving the conflicts
+	// with the attributes of the target scope per the model.MergePolicy*
+	// policy, and returns the updated device. Returns ErrDevNotFound if
+	// the device doesn't exist.
+	MoveAttributesBetweenScopes(
+		ctx context.Context,
+		id model.DeviceID,
+		fromScope string,
+		toScope string,
+		policy string,
+	) (*model.Device, error)
+
 	// UpsertDevicesAttributesWithRevision upserts attributes for devices in the same way
 	// UpsertDevicesAttributes does.
 	// The only difference between this method and UpsertDevicesAttributes
@@ -115,6 +210,229 @@ type DataStore interface {
 	// in filters
 	GetFiltersAttributes(ctx context.Context) ([]model.FilterAttribute, error)
 
+	// GetDescribedAttributes returns the attributes having a non-empty
+	// description on at least one device, with a sample description
+	GetDescribedAttributes(ctx context.Context) ([]model.DescribedAttribute, error)
+
+	// GetGroupSchema returns the attributes set on the devices of the
+	// group with the types of their values, sorted by scope and name;
+	// empty if the group has no devices
+	GetGroupSchema(
+		ctx context.Context,
+		group model.GroupName,
+	) ([]model.SchemaAttribute, error)
+
+	// FacetByAttributeFiltered counts the devices matching the filters
+	// by the values of the given attribute, sorted by decreasing count
+	FacetByAttributeFiltered(
+		ctx context.Context,
+		scope string,
+		name string,
+		filters []model.FilterPredicate,
+	) ([]model.AttributeValueCount, error)
+
+	// TopAttributeValues counts the devices by the values of the given
+	// attribute, returning the limit most frequent values by decreasing
+	// count
+	TopAttributeValues(
+		ctx context.Context,
+		scope string,
+		name string,
+		limit int,
+	) ([]model.AttributeValueCount, error)
+
+	// AttributeCardinality returns the number of distinct values of the
+	// given attribute across all the devices, counting each element of
+	// the array values
+	AttributeCardinality(
+		ctx context.Context,
+		scope string,
+		name string,
+	) (int, error)
+
+	// CountDevicesByAttribute returns the number of devices having each
+	// attribute, ordered by scope and name, and the total number of
+	// devices; the coverage of the attributes is left unset
+	CountDevicesByAttribute(
+		ctx context.Context,
+	) ([]model.AttributeCoverage, int, error)
+
+	// GetAttributeScopes returns the distinct scopes of the attributes of
+	// the devices, sorted
+	GetAttributeScopes(ctx context.Context) ([]string, error)
+
+	// IncrementAttributesChurn increments the change counters of the
+	// given attributes
+	IncrementAttributesChurn(ctx context.Context, attrs model.DeviceAttributes) error
+
+	// GetAttributesChurn returns the change counters of the attributes,
+	// sorted by decreasing count
+	GetAttributesChurn(ctx context.Context) ([]model.AttributeChurn, error)
+
+	// GetIngestHash returns the hash of the attributes last ingested for
+	// the device, or an empty string if none was recorded or it expired
+	GetIngestHash(ctx context.Context, id model.DeviceID) (string, error)
+
+	// SetIngestHash records the hash of the attributes ingested for the
+	// device, expiring at the given time
+	SetIngestHash(
+		ctx context.Context,
+		id model.DeviceID,
+		hash string,
+		expire time.Time,
+	) error
+
+	// FindDevicesByAttributeValues returns the devices whose attribute
+	// equals any of the given values, ordered by device ID
+	FindDevicesByAttributeValues(
+		ctx context.Context,
+		scope string,
+		name string,
+		values []interface{},
+	) ([]model.Device, error)
+
+	// FindDevicesWithAttributeDrift returns the devices having the
+	// attribute with a value other than the known one, ordered by device
+	// ID; the devices without the attribute are left out
+	FindDevicesWithAttributeDrift(
+		ctx context.Context,
+		scope string,
+		name string,
+		value interface{},
+	) ([]model.Device, error)
+
+	// FindDevicesByAttributeSet returns the devices whose attributes of
+	// the scope are exactly the given ones, with equal values and no
+	// other attributes in the scope, ordered by device ID
+	FindDevicesByAttributeSet(
+		ctx context.Context,
+		scope string,
+		attrs model.DeviceAttributes,
+	) ([]model.Device, error)
+
+	// GetDevicesWithStaleScope returns the devices whose attributes of the
+	// scope were last updated before the olderThan duration, oldest-first;
+	// the devices which never reported the scope are left out
+	GetDevicesWithStaleScope(
+		ctx context.Context,
+		scope string,
+		olderThan time.Duration,
+	) ([]model.Device, error)
+
+	// GetDevicesUpdatedByScopeSince returns the devices whose attributes of
+	// the scope were updated after since, oldest-first; the updates of the
+	// other scopes are not taken into account
+	GetDevicesUpdatedByScopeSince(
+		ctx context.Context,
+		scope string,
+		since time.Time,
+	) ([]model.Device, error)
+
+	// SampleDevices returns up to n devices picked at random among the
+	// devices matching the filter predicates
+	SampleDevices(
+		ctx context.Context,
+		n int,
+		filters []model.FilterPredicate,
+	) ([]model.Device, error)
+
+	// GetAttributesPresence returns, for each of the given devices, whether
+	// the device has each of the given attributes, in the order of the
+	// attributes; the devices which don't exist are left out
+	GetAttributesPresence(
+		ctx context.Context,
+		ids []model.DeviceID,
+		attributes []model.SelectAttribute,
+	) (map[model.DeviceID][]bool, error)
+
+	// GetDevicesAttributesCount returns the number of attributes of each
+	// of the given devices; the devices which don't exist are left out
+	GetDevicesAttributesCount(
+		ctx context.Context,
+		ids []model.DeviceID,
+	) (map[model.DeviceID]int, error)
+
+	// GetDevicesStatuses returns the identity status of each of the given
+	// devices, nil for the devices without a status; the devices which
+	// don't exist are left out
+	GetDevicesStatuses(
+		ctx context.Context,
+		ids []model.DeviceID,
+	) (map[model.DeviceID]*string, error)
+
+	// ExplainSearchDevices returns the query plan of the devices search,
+	// with the values of the query redacted
+	ExplainSearchDevices(
+		ctx context.Context,
+		searchParams model.SearchParams,
+	) (map[string]interface{}, error)
+
+	// CountDevicesCreatedPerDay returns the number of devices created
+	// within the time range [from, to) per UTC day, keyed by the start of
+	// the day; the days without devices are left out
+	CountDevicesCreatedPerDay(
+		ctx context.Context,
+		from, to time.Time,
+	) (map[time.Time]int, error)
+
+	// CountDevicesByAlertCount returns the number of devices per alert
+	// count bucket, keyed by the model.AlertCountBuckets, of the alert
+	// count attribute in the given scope; the devices without the
+	// attribute count as having no alerts and the empty buckets are left
+	// out
+	CountDevicesByAlertCount(
+		ctx context.Context,
+		scope string,
+	) (map[string]int, error)
+
+	// GetFeatureFlags returns the feature flags of the tenant, empty if
+	// none were set
+	GetFeatureFlags(ctx context.Context) (model.FeatureFlags, error)
+
+	// SetFeatureFlags replaces the feature flags of the tenant
+	SetFeatureFlags(ctx context.Context, flags model.FeatureFlags) error
+
+	// CreateSavedFilter stores a new saved filter of the tenant
+	CreateSavedFilter(ctx context.Context, filter *model.SavedFilter) error
+
+	// GetSavedFilter returns the saved filter with the given ID, or
+	// ErrFilterNotFound if it doesn't exist
+	GetSavedFilter(ctx context.Context, id string) (*model.SavedFilter, error)
+
+	// ListSavedFilters returns the saved filters of the tenant, sorted
+	// by name
+	ListSavedFilters(ctx context.Context) ([]model.SavedFilter, error)
+
+	// UpdateSavedFilter replaces the name and the predicates of the saved
+	// filter, or returns ErrFilterNotFound if it doesn't exist
+	UpdateSavedFilter(ctx context.Context, filter *model.SavedFilter) error
+
+	// DeleteSavedFilter removes the saved filter, or returns
+	// ErrFilterNotFound if it doesn't exist
+	DeleteSavedFilter(ctx context.Context, id string) error
+
+	// FindDevicesWithDuplicateAttributes returns a page of the devices
+	// having more than one attribute entry with the same scope and name,
+	// ordered by device ID
+	FindDevicesWithDuplicateAttributes(
+		ctx context.Context,
+		skip int,
+		limit int,
+	) ([]model.DeviceDuplicateAttributes, error)
+
+	// RepairDuplicateAttributes removes the duplicated attribute entries
+	// of the device, keeping one entry per scope and name, and returns
+	// the number of removed entries
+	RepairDuplicateAttributes(ctx context.Context, id model.DeviceID) (int, error)
+
+	// VerifyDeviceAttributes checks the stored attribute entries of the
+	// device for duplicate keys, missing scopes and arrays mixing element
+	// types, and reports the issues ordered by storage key
+	VerifyDeviceAttributes(
+		ctx context.Context,
+		id model.DeviceID,
+	) (*model.DeviceAttributesReport, error)
+
 	// DeleteGroup removes a device group
 	DeleteGroup(ctx context.Context, group model.GroupName) (chan model.DeviceID, error)
 
@@ -126,6 +444,13 @@ type DataStore interface {
 		group model.GroupName,
 	) (*model.UpdateResult, error)
 
+	// CountDevicesInGroup returns how many of the devices are in the
+	// group, i.e. the devices UnsetDevicesGroup would match
+	CountDevicesInGroup(ctx context.Context,
+		deviceIDs []model.DeviceID,
+		group model.GroupName,
+	) (int64, error)
+
 	// UpdateDevicesGroup updates multiple devices' group, returning number
 	// of matching devices, the number devices that changed group and error,
 	// if any.
@@ -134,9 +459,34 @@ type DataStore interface {
 		group model.GroupName,
 	) (*model.UpdateResult, error)
 
-	// ListGroups returns a list of all existing groups. Devices included
-	// in the evaluation can be filtered by the filters argument.
-	ListGroups(ctx context.Context, filters []model.FilterPredicate) ([]model.GroupName, error)
+	// UpdateDeviceGroupIf sets the device's group to newGroup only if the
+	// device's current group equals expected (empty meaning no group),
+	// returning whether the group changed. Returns ErrDevNotFound if the
+	// device does not exist.
+	UpdateDeviceGroupIf(ctx context.Context,
+		id model.DeviceID,
+		expected model.GroupName,
+		newGroup model.GroupName,
+	) (bool, error)
+
+	// ListGroups returns a page of the existing groups, sorted by name,
+	// and the total number of groups; a zero limit returns all the groups
+	// past skip. Devices included in the evaluation can be filtered by the
+	// filters argument.
+	ListGroups(
+		ctx context.Context,
+		filters []model.FilterPredicate,
+		skip int,
+		limit int,
+	) ([]model.GroupName, int, error)
+
+	// GetDevicesDistinctGroups returns the distinct groups the given
+	// devices belong to; an empty group name represents the devices
+	// without a group.
+	GetDevicesDistinctGroups(
+		ctx context.Context,
+		ids []model.DeviceID,
+	) ([]model.GroupName, error)
 
 	// Lists devices belonging to a group
 	GetDevicesByGroup(ctx context.Context,
@@ -145,21 +495,66 @@ type DataStore interface {
 		limit int,
 	) ([]model.DeviceID, int, error)
 
+	// Lists devices belonging to a group with only the given attributes
+	// and the system timestamps
+	GetDevicesByGroupWithAttributes(ctx context.Context,
+		group model.GroupName,
+		skip,
+		limit int,
+		attributes []model.SelectAttribute,
+	) ([]model.Device, int, error)
+
 	// Get device's group
 	GetDeviceGroup(ctx context.Context, id model.DeviceID) (model.GroupName, error)
 
-	// Scan all devices in collection, grab all (unique) attribute names
-	GetAllAttributeNames(ctx context.Context) ([]string, error)
+	// GetGroupSiblings returns the other devices of the group of the
+	// device sorted by ID, empty if the device has no group; returns
+	// ErrDevNotFound if the device doesn't exist
+	GetGroupSiblings(ctx context.Context, id model.DeviceID) ([]model.Device, error)
+
+	// Scan all devices in collection, grab all (unique) attribute names;
+	// the names of the system scope are left out if excludeSystem is set
+	GetAllAttributeNames(ctx context.Context, excludeSystem bool) ([]string, error)
 
 	SearchDevices(ctx context.Context,
 		searchParams model.SearchParams,
 	) ([]model.Device, int, error)
 
+	// CountDevices returns the number of devices matching the filters of
+	// the search, without fetching them
+	CountDevices(ctx context.Context, searchParams model.SearchParams) (int, error)
+
 	MigrateTenant(ctx context.Context, version string, tenantId string) error
 
 	Migrate(ctx context.Context, version string) error
 
 	WithAutomigrate() DataStore
 
+	// WithAdminAccess returns a data store allowed to run the
+	// cross-tenant operations meant for admin tooling
+	WithAdminAccess() DataStore
+
+	// StreamAllDevicesAcrossTenants calls fn with each device of all the
+	// tenants labeled with its tenant ID, the devices without a tenant
+	// included; requires admin access. It stops at the first error,
+	// returned by fn or met reading the devices, and returns it, so that
+	// a nil error means all the devices were streamed.
+	StreamAllDevicesAcrossTenants(
+		ctx context.Context,
+		fn func(model.TenantDevice) error,
+	) error
+
 	Maintenance(ctx context.Context, version string, tenantIDs ...string) error
+
+	// PurgeScopeByRetention removes the attributes of the scope whose
+	// timestamp is older than the retention period from the devices of
+	// the given tenants, or of all the tenants if none is given; the
+	// attributes without a timestamp are kept. Returns the number of
+	// devices purged.
+	PurgeScopeByRetention(
+		ctx context.Context,
+		scope string,
+		retention time.Duration,
+		tenantIDs ...string,
+	) (int, error)
 }
@@ -19,6 +19,8 @@ package mocks
 import (
 	context "context"
 
+	time "time"
+
 	model "github.com/mendersoftware/inventory/model"
 	mock "github.com/stretchr/testify/mock"
 
@@ -44,6 +46,187 @@ func (_m *DataStore) AddDevice(ctx context.Context, dev *model.Device) error {
 	return r0
 }
 
+// AttributeCardinality provides a mock function with given fields: ctx, scope, name
+func (_m *DataStore) AttributeCardinality(ctx context.Context, scope string, name string) (int, error) {
+	ret := _m.Called(ctx, scope, name)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) int); ok {
+		r0 = rf(ctx, scope, name)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, scope, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Close provides a mock function with given fields: ctx
+func (_m *DataStore) Close(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CountDevices provides a mock function with given fields: ctx, searchParams
+func (_m *DataStore) CountDevices(ctx context.Context, searchParams model.SearchParams) (int, error) {
+	ret := _m.Called(ctx, searchParams)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, model.SearchParams) int); ok {
+		r0 = rf(ctx, searchParams)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.SearchParams) error); ok {
+		r1 = rf(ctx, searchParams)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CountDevicesByAlertCount provides a mock function with given fields: ctx, scope
+func (_m *DataStore) CountDevicesByAlertCount(ctx context.Context, scope string) (map[string]int, error) {
+	ret := _m.Called(ctx, scope)
+
+	var r0 map[string]int
+	if rf, ok := ret.Get(0).(func(context.Context, string) map[string]int); ok {
+		r0 = rf(ctx, scope)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]int)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, scope)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CountDevicesByAttribute provides a mock function with given fields: ctx
+func (_m *DataStore) CountDevicesByAttribute(ctx context.Context) ([]model.AttributeCoverage, int, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.AttributeCoverage
+	if rf, ok := ret.Get(0).(func(context.Context) []model.AttributeCoverage); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.AttributeCoverage)
+		}
+	}
+
+	var r1 int
+	if rf, ok := ret.Get(1).(func(context.Context) int); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Get(1).(int)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context) error); ok {
+		r2 = rf(ctx)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// CountDevicesCreatedPerDay provides a mock function with given fields: ctx, from, to
+func (_m *DataStore) CountDevicesCreatedPerDay(ctx context.Context, from time.Time, to time.Time) (map[time.Time]int, error) {
+	ret := _m.Called(ctx, from, to)
+
+	var r0 map[time.Time]int
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, time.Time) map[time.Time]int); ok {
+		r0 = rf(ctx, from, to)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[time.Time]int)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time, time.Time) error); ok {
+		r1 = rf(ctx, from, to)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CountDevicesInGroup provides a mock function with given fields: ctx, deviceIDs, group
+func (_m *DataStore) CountDevicesInGroup(ctx context.Context, deviceIDs []model.DeviceID, group model.GroupName) (int64, error) {
+	ret := _m.Called(ctx, deviceIDs, group)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, []model.DeviceID, model.GroupName) int64); ok {
+		r0 = rf(ctx, deviceIDs, group)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []model.DeviceID, model.GroupName) error); ok {
+		r1 = rf(ctx, deviceIDs, group)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateDevice provides a mock function with given fields: ctx, dev
+func (_m *DataStore) CreateDevice(ctx context.Context, dev *model.Device) error {
+	ret := _m.Called(ctx, dev)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.Device) error); ok {
+		r0 = rf(ctx, dev)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateSavedFilter provides a mock function with given fields: ctx, filter
+func (_m *DataStore) CreateSavedFilter(ctx context.Context, filter *model.SavedFilter) error {
+	ret := _m.Called(ctx, filter)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.SavedFilter) error); ok {
+		r0 = rf(ctx, filter)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // DeleteDevices provides a mock function with given fields: ctx, ids
 func (_m *DataStore) DeleteDevices(ctx context.Context, ids []model.DeviceID) (*model.UpdateResult, error) {
 	ret := _m.Called(ctx, ids)
@@ -90,22 +273,36 @@ func (_m *DataStore) DeleteGroup(ctx context.Context, group model.GroupName) (ch
 	return r0, r1
 }
 
-// GetAllAttributeNames provides a mock function with given fields: ctx
-func (_m *DataStore) GetAllAttributeNames(ctx context.Context) ([]string, error) {
-	ret := _m.Called(ctx)
+// DeleteSavedFilter provides a mock function with given fields: ctx, id
+func (_m *DataStore) DeleteSavedFilter(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
 
-	var r0 []string
-	if rf, ok := ret.Get(0).(func(context.Context) []string); ok {
-		r0 = rf(ctx)
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ExplainSearchDevices provides a mock function with given fields: ctx, searchParams
+func (_m *DataStore) ExplainSearchDevices(ctx context.Context, searchParams model.SearchParams) (map[string]interface{}, error) {
+	ret := _m.Called(ctx, searchParams)
+
+	var r0 map[string]interface{}
+	if rf, ok := ret.Get(0).(func(context.Context, model.SearchParams) map[string]interface{}); ok {
+		r0 = rf(ctx, searchParams)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]string)
+			r0 = ret.Get(0).(map[string]interface{})
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
-		r1 = rf(ctx)
+	if rf, ok := ret.Get(1).(func(context.Context, model.SearchParams) error); ok {
+		r1 = rf(ctx, searchParams)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -113,22 +310,22 @@ func (_m *DataStore) GetAllAttributeNames(ctx context.Context) ([]string, error)
 	return r0, r1
 }
 
-// GetDevice provides a mock function with given fields: ctx, id
-func (_m *DataStore) GetDevice(ctx context.Context, id model.DeviceID) (*model.Device, error) {
-	ret := _m.Called(ctx, id)
+// FacetByAttributeFiltered provides a mock function with given fields: ctx, scope, name, filters
+func (_m *DataStore) FacetByAttributeFiltered(ctx context.Context, scope string, name string, filters []model.FilterPredicate) ([]model.AttributeValueCount, error) {
+	ret := _m.Called(ctx, scope, name, filters)
 
-	var r0 *model.Device
-	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceID) *model.Device); ok {
-		r0 = rf(ctx, id)
+	var r0 []model.AttributeValueCount
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, []model.FilterPredicate) []model.AttributeValueCount); ok {
+		r0 = rf(ctx, scope, name, filters)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*model.Device)
+			r0 = ret.Get(0).([]model.AttributeValueCount)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceID) error); ok {
-		r1 = rf(ctx, id)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, []model.FilterPredicate) error); ok {
+		r1 = rf(ctx, scope, name, filters)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -136,20 +333,22 @@ func (_m *DataStore) GetDevice(ctx context.Context, id model.DeviceID) (*model.D
 	return r0, r1
 }
 
-// GetDeviceGroup provides a mock function with given fields: ctx, id
-func (_m *DataStore) GetDeviceGroup(ctx context.Context, id model.DeviceID) (model.GroupName, error) {
-	ret := _m.Called(ctx, id)
+// FindDevicesByAttributeSet provides a mock function with given fields: ctx, scope, attrs
+func (_m *DataStore) FindDevicesByAttributeSet(ctx context.Context, scope string, attrs model.DeviceAttributes) ([]model.Device, error) {
+	ret := _m.Called(ctx, scope, attrs)
 
-	var r0 model.GroupName
-	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceID) model.GroupName); ok {
-		r0 = rf(ctx, id)
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.DeviceAttributes) []model.Device); ok {
+		r0 = rf(ctx, scope, attrs)
 	} else {
-		r0 = ret.Get(0).(model.GroupName)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceID) error); ok {
-		r1 = rf(ctx, id)
+	if rf, ok := ret.Get(1).(func(context.Context, string, model.DeviceAttributes) error); ok {
+		r1 = rf(ctx, scope, attrs)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -157,59 +356,681 @@ func (_m *DataStore) GetDeviceGroup(ctx context.Context, id model.DeviceID) (mod
 	return r0, r1
 }
 
-// GetDevices provides a mock function with given fields: ctx, q
-func (_m *DataStore) GetDevices(ctx context.Context, q store.ListQuery) ([]model.Device, int, error) {
-	ret := _m.Called(ctx, q)
+// FindDevicesByAttributeValues provides a mock function with given fields: ctx, scope, name, values
+func (_m *DataStore) FindDevicesByAttributeValues(ctx context.Context, scope string, name string, values []interface{}) ([]model.Device, error) {
+	ret := _m.Called(ctx, scope, name, values)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, []interface{}) []model.Device); ok {
+		r0 = rf(ctx, scope, name, values)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, []interface{}) error); ok {
+		r1 = rf(ctx, scope, name, values)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindDevicesWithAttributeDrift provides a mock function with given fields: ctx, scope, name, value
+func (_m *DataStore) FindDevicesWithAttributeDrift(ctx context.Context, scope string, name string, value interface{}) ([]model.Device, error) {
+	ret := _m.Called(ctx, scope, name, value)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, interface{}) []model.Device); ok {
+		r0 = rf(ctx, scope, name, value)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, interface{}) error); ok {
+		r1 = rf(ctx, scope, name, value)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindDevicesWithDuplicateAttributes provides a mock function with given fields: ctx, skip, limit
+func (_m *DataStore) FindDevicesWithDuplicateAttributes(ctx context.Context, skip int, limit int) ([]model.DeviceDuplicateAttributes, error) {
+	ret := _m.Called(ctx, skip, limit)
+
+	var r0 []model.DeviceDuplicateAttributes
+	if rf, ok := ret.Get(0).(func(context.Context, int, int) []model.DeviceDuplicateAttributes); ok {
+		r0 = rf(ctx, skip, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.DeviceDuplicateAttributes)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int, int) error); ok {
+		r1 = rf(ctx, skip, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAllAttributeNames provides a mock function with given fields: ctx, excludeSystem
+func (_m *DataStore) GetAllAttributeNames(ctx context.Context, excludeSystem bool) ([]string, error) {
+	ret := _m.Called(ctx, excludeSystem)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context, bool) []string); ok {
+		r0 = rf(ctx, excludeSystem)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, bool) error); ok {
+		r1 = rf(ctx, excludeSystem)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAttributeScopes provides a mock function with given fields: ctx
+func (_m *DataStore) GetAttributeScopes(ctx context.Context) ([]string, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context) []string); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAttributesChurn provides a mock function with given fields: ctx
+func (_m *DataStore) GetAttributesChurn(ctx context.Context) ([]model.AttributeChurn, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.AttributeChurn
+	if rf, ok := ret.Get(0).(func(context.Context) []model.AttributeChurn); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.AttributeChurn)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAttributesPresence provides a mock function with given fields: ctx, ids, attributes
+func (_m *DataStore) GetAttributesPresence(ctx context.Context, ids []model.DeviceID, attributes []model.SelectAttribute) (map[model.DeviceID][]bool, error) {
+	ret := _m.Called(ctx, ids, attributes)
+
+	var r0 map[model.DeviceID][]bool
+	if rf, ok := ret.Get(0).(func(context.Context, []model.DeviceID, []model.SelectAttribute) map[model.DeviceID][]bool); ok {
+		r0 = rf(ctx, ids, attributes)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[model.DeviceID][]bool)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []model.DeviceID, []model.SelectAttribute) error); ok {
+		r1 = rf(ctx, ids, attributes)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDescribedAttributes provides a mock function with given fields: ctx
+func (_m *DataStore) GetDescribedAttributes(ctx context.Context) ([]model.DescribedAttribute, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.DescribedAttribute
+	if rf, ok := ret.Get(0).(func(context.Context) []model.DescribedAttribute); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.DescribedAttribute)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDevice provides a mock function with given fields: ctx, id
+func (_m *DataStore) GetDevice(ctx context.Context, id model.DeviceID) (*model.Device, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceID) *model.Device); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceID) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDeviceGroup provides a mock function with given fields: ctx, id
+func (_m *DataStore) GetDeviceGroup(ctx context.Context, id model.DeviceID) (model.GroupName, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 model.GroupName
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceID) model.GroupName); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(model.GroupName)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceID) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDevices provides a mock function with given fields: ctx, q
+func (_m *DataStore) GetDevices(ctx context.Context, q store.ListQuery) ([]model.Device, int, error) {
+	ret := _m.Called(ctx, q)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, store.ListQuery) []model.Device); ok {
+		r0 = rf(ctx, q)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 int
+	if rf, ok := ret.Get(1).(func(context.Context, store.ListQuery) int); ok {
+		r1 = rf(ctx, q)
+	} else {
+		r1 = ret.Get(1).(int)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, store.ListQuery) error); ok {
+		r2 = rf(ctx, q)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// GetDevicesAttributesCount provides a mock function with given fields: ctx, ids
+func (_m *DataStore) GetDevicesAttributesCount(ctx context.Context, ids []model.DeviceID) (map[model.DeviceID]int, error) {
+	ret := _m.Called(ctx, ids)
+
+	var r0 map[model.DeviceID]int
+	if rf, ok := ret.Get(0).(func(context.Context, []model.DeviceID) map[model.DeviceID]int); ok {
+		r0 = rf(ctx, ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[model.DeviceID]int)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []model.DeviceID) error); ok {
+		r1 = rf(ctx, ids)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDevicesByGroup provides a mock function with given fields: ctx, group, skip, limit
+func (_m *DataStore) GetDevicesByGroup(ctx context.Context, group model.GroupName, skip int, limit int) ([]model.DeviceID, int, error) {
+	ret := _m.Called(ctx, group, skip, limit)
+
+	var r0 []model.DeviceID
+	if rf, ok := ret.Get(0).(func(context.Context, model.GroupName, int, int) []model.DeviceID); ok {
+		r0 = rf(ctx, group, skip, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.DeviceID)
+		}
+	}
+
+	var r1 int
+	if rf, ok := ret.Get(1).(func(context.Context, model.GroupName, int, int) int); ok {
+		r1 = rf(ctx, group, skip, limit)
+	} else {
+		r1 = ret.Get(1).(int)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, model.GroupName, int, int) error); ok {
+		r2 = rf(ctx, group, skip, limit)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// GetDevicesByGroupWithAttributes provides a mock function with given fields: ctx, group, skip, limit, attributes
+func (_m *DataStore) GetDevicesByGroupWithAttributes(ctx context.Context, group model.GroupName, skip int, limit int, attributes []model.SelectAttribute) ([]model.Device, int, error) {
+	ret := _m.Called(ctx, group, skip, limit, attributes)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, model.GroupName, int, int, []model.SelectAttribute) []model.Device); ok {
+		r0 = rf(ctx, group, skip, limit, attributes)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 int
+	if rf, ok := ret.Get(1).(func(context.Context, model.GroupName, int, int, []model.SelectAttribute) int); ok {
+		r1 = rf(ctx, group, skip, limit, attributes)
+	} else {
+		r1 = ret.Get(1).(int)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, model.GroupName, int, int, []model.SelectAttribute) error); ok {
+		r2 = rf(ctx, group, skip, limit, attributes)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// GetDevicesByIDs provides a mock function with given fields: ctx, ids
+func (_m *DataStore) GetDevicesByIDs(ctx context.Context, ids []model.DeviceID) ([]model.Device, error) {
+	ret := _m.Called(ctx, ids)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, []model.DeviceID) []model.Device); ok {
+		r0 = rf(ctx, ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []model.DeviceID) error); ok {
+		r1 = rf(ctx, ids)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDevicesDistinctGroups provides a mock function with given fields: ctx, ids
+func (_m *DataStore) GetDevicesDistinctGroups(ctx context.Context, ids []model.DeviceID) ([]model.GroupName, error) {
+	ret := _m.Called(ctx, ids)
+
+	var r0 []model.GroupName
+	if rf, ok := ret.Get(0).(func(context.Context, []model.DeviceID) []model.GroupName); ok {
+		r0 = rf(ctx, ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.GroupName)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []model.DeviceID) error); ok {
+		r1 = rf(ctx, ids)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDevicesMap provides a mock function with given fields: ctx, ids
+func (_m *DataStore) GetDevicesMap(ctx context.Context, ids []model.DeviceID) (map[model.DeviceID]*model.Device, error) {
+	ret := _m.Called(ctx, ids)
+
+	var r0 map[model.DeviceID]*model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, []model.DeviceID) map[model.DeviceID]*model.Device); ok {
+		r0 = rf(ctx, ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[model.DeviceID]*model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []model.DeviceID) error); ok {
+		r1 = rf(ctx, ids)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDevicesPartitionedByGroup provides a mock function with given fields: ctx, q, perGroup
+func (_m *DataStore) GetDevicesPartitionedByGroup(ctx context.Context, q store.ListQuery, perGroup int) (map[model.GroupName][]model.DeviceID, error) {
+	ret := _m.Called(ctx, q, perGroup)
+
+	var r0 map[model.GroupName][]model.DeviceID
+	if rf, ok := ret.Get(0).(func(context.Context, store.ListQuery, int) map[model.GroupName][]model.DeviceID); ok {
+		r0 = rf(ctx, q, perGroup)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[model.GroupName][]model.DeviceID)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, store.ListQuery, int) error); ok {
+		r1 = rf(ctx, q, perGroup)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDevicesStatuses provides a mock function with given fields: ctx, ids
+func (_m *DataStore) GetDevicesStatuses(ctx context.Context, ids []model.DeviceID) (map[model.DeviceID]*string, error) {
+	ret := _m.Called(ctx, ids)
+
+	var r0 map[model.DeviceID]*string
+	if rf, ok := ret.Get(0).(func(context.Context, []model.DeviceID) map[model.DeviceID]*string); ok {
+		r0 = rf(ctx, ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[model.DeviceID]*string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []model.DeviceID) error); ok {
+		r1 = rf(ctx, ids)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDevicesUpdatedByScopeSince provides a mock function with given fields: ctx, scope, since
+func (_m *DataStore) GetDevicesUpdatedByScopeSince(ctx context.Context, scope string, since time.Time) ([]model.Device, error) {
+	ret := _m.Called(ctx, scope, since)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) []model.Device); ok {
+		r0 = rf(ctx, scope, since)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time) error); ok {
+		r1 = rf(ctx, scope, since)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDevicesWithStaleScope provides a mock function with given fields: ctx, scope, olderThan
+func (_m *DataStore) GetDevicesWithStaleScope(ctx context.Context, scope string, olderThan time.Duration) ([]model.Device, error) {
+	ret := _m.Called(ctx, scope, olderThan)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Duration) []model.Device); ok {
+		r0 = rf(ctx, scope, olderThan)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Duration) error); ok {
+		r1 = rf(ctx, scope, olderThan)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetFeatureFlags provides a mock function with given fields: ctx
+func (_m *DataStore) GetFeatureFlags(ctx context.Context) (model.FeatureFlags, error) {
+	ret := _m.Called(ctx)
+
+	var r0 model.FeatureFlags
+	if rf, ok := ret.Get(0).(func(context.Context) model.FeatureFlags); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(model.FeatureFlags)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetFiltersAttributes provides a mock function with given fields: ctx
+func (_m *DataStore) GetFiltersAttributes(ctx context.Context) ([]model.FilterAttribute, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.FilterAttribute
+	if rf, ok := ret.Get(0).(func(context.Context) []model.FilterAttribute); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.FilterAttribute)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetGroupSchema provides a mock function with given fields: ctx, group
+func (_m *DataStore) GetGroupSchema(ctx context.Context, group model.GroupName) ([]model.SchemaAttribute, error) {
+	ret := _m.Called(ctx, group)
+
+	var r0 []model.SchemaAttribute
+	if rf, ok := ret.Get(0).(func(context.Context, model.GroupName) []model.SchemaAttribute); ok {
+		r0 = rf(ctx, group)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.SchemaAttribute)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.GroupName) error); ok {
+		r1 = rf(ctx, group)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetGroupSiblings provides a mock function with given fields: ctx, id
+func (_m *DataStore) GetGroupSiblings(ctx context.Context, id model.DeviceID) ([]model.Device, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceID) []model.Device); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceID) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetIngestHash provides a mock function with given fields: ctx, id
+func (_m *DataStore) GetIngestHash(ctx context.Context, id model.DeviceID) (string, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceID) string); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceID) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSavedFilter provides a mock function with given fields: ctx, id
+func (_m *DataStore) GetSavedFilter(ctx context.Context, id string) (*model.SavedFilter, error) {
+	ret := _m.Called(ctx, id)
 
-	var r0 []model.Device
-	if rf, ok := ret.Get(0).(func(context.Context, store.ListQuery) []model.Device); ok {
-		r0 = rf(ctx, q)
+	var r0 *model.SavedFilter
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.SavedFilter); ok {
+		r0 = rf(ctx, id)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]model.Device)
+			r0 = ret.Get(0).(*model.SavedFilter)
 		}
 	}
 
-	var r1 int
-	if rf, ok := ret.Get(1).(func(context.Context, store.ListQuery) int); ok {
-		r1 = rf(ctx, q)
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
 	} else {
-		r1 = ret.Get(1).(int)
+		r1 = ret.Error(1)
 	}
 
-	var r2 error
-	if rf, ok := ret.Get(2).(func(context.Context, store.ListQuery) error); ok {
-		r2 = rf(ctx, q)
+	return r0, r1
+}
+
+// IncrementAttributesChurn provides a mock function with given fields: ctx, attrs
+func (_m *DataStore) IncrementAttributesChurn(ctx context.Context, attrs model.DeviceAttributes) error {
+	ret := _m.Called(ctx, attrs)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceAttributes) error); ok {
+		r0 = rf(ctx, attrs)
 	} else {
-		r2 = ret.Error(2)
+		r0 = ret.Error(0)
 	}
 
-	return r0, r1, r2
+	return r0
 }
 
-// GetDevicesByGroup provides a mock function with given fields: ctx, group, skip, limit
-func (_m *DataStore) GetDevicesByGroup(ctx context.Context, group model.GroupName, skip int, limit int) ([]model.DeviceID, int, error) {
-	ret := _m.Called(ctx, group, skip, limit)
+// ListGroups provides a mock function with given fields: ctx, filters, skip, limit
+func (_m *DataStore) ListGroups(ctx context.Context, filters []model.FilterPredicate, skip int, limit int) ([]model.GroupName, int, error) {
+	ret := _m.Called(ctx, filters, skip, limit)
 
-	var r0 []model.DeviceID
-	if rf, ok := ret.Get(0).(func(context.Context, model.GroupName, int, int) []model.DeviceID); ok {
-		r0 = rf(ctx, group, skip, limit)
+	var r0 []model.GroupName
+	if rf, ok := ret.Get(0).(func(context.Context, []model.FilterPredicate, int, int) []model.GroupName); ok {
+		r0 = rf(ctx, filters, skip, limit)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]model.DeviceID)
+			r0 = ret.Get(0).([]model.GroupName)
 		}
 	}
 
 	var r1 int
-	if rf, ok := ret.Get(1).(func(context.Context, model.GroupName, int, int) int); ok {
-		r1 = rf(ctx, group, skip, limit)
+	if rf, ok := ret.Get(1).(func(context.Context, []model.FilterPredicate, int, int) int); ok {
+		r1 = rf(ctx, filters, skip, limit)
 	} else {
 		r1 = ret.Get(1).(int)
 	}
 
 	var r2 error
-	if rf, ok := ret.Get(2).(func(context.Context, model.GroupName, int, int) error); ok {
-		r2 = rf(ctx, group, skip, limit)
+	if rf, ok := ret.Get(2).(func(context.Context, []model.FilterPredicate, int, int) error); ok {
+		r2 = rf(ctx, filters, skip, limit)
 	} else {
 		r2 = ret.Error(2)
 	}
@@ -217,16 +1038,16 @@ func (_m *DataStore) GetDevicesByGroup(ctx context.Context, group model.GroupNam
 	return r0, r1, r2
 }
 
-// GetFiltersAttributes provides a mock function with given fields: ctx
-func (_m *DataStore) GetFiltersAttributes(ctx context.Context) ([]model.FilterAttribute, error) {
+// ListSavedFilters provides a mock function with given fields: ctx
+func (_m *DataStore) ListSavedFilters(ctx context.Context) ([]model.SavedFilter, error) {
 	ret := _m.Called(ctx)
 
-	var r0 []model.FilterAttribute
-	if rf, ok := ret.Get(0).(func(context.Context) []model.FilterAttribute); ok {
+	var r0 []model.SavedFilter
+	if rf, ok := ret.Get(0).(func(context.Context) []model.SavedFilter); ok {
 		r0 = rf(ctx)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]model.FilterAttribute)
+			r0 = ret.Get(0).([]model.SavedFilter)
 		}
 	}
 
@@ -240,29 +1061,6 @@ func (_m *DataStore) GetFiltersAttributes(ctx context.Context) ([]model.FilterAt
 	return r0, r1
 }
 
-// ListGroups provides a mock function with given fields: ctx, filters
-func (_m *DataStore) ListGroups(ctx context.Context, filters []model.FilterPredicate) ([]model.GroupName, error) {
-	ret := _m.Called(ctx, filters)
-
-	var r0 []model.GroupName
-	if rf, ok := ret.Get(0).(func(context.Context, []model.FilterPredicate) []model.GroupName); ok {
-		r0 = rf(ctx, filters)
-	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]model.GroupName)
-		}
-	}
-
-	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, []model.FilterPredicate) error); ok {
-		r1 = rf(ctx, filters)
-	} else {
-		r1 = ret.Error(1)
-	}
-
-	return r0, r1
-}
-
 // Maintenance provides a mock function with given fields: ctx, version, tenantIDs
 func (_m *DataStore) Maintenance(ctx context.Context, version string, tenantIDs ...string) error {
 	_va := make([]interface{}, len(tenantIDs))
@@ -312,6 +1110,29 @@ func (_m *DataStore) MigrateTenant(ctx context.Context, version string, tenantId
 	return r0
 }
 
+// MoveAttributesBetweenScopes provides a mock function with given fields: ctx, id, fromScope, toScope, policy
+func (_m *DataStore) MoveAttributesBetweenScopes(ctx context.Context, id model.DeviceID, fromScope string, toScope string, policy string) (*model.Device, error) {
+	ret := _m.Called(ctx, id, fromScope, toScope, policy)
+
+	var r0 *model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceID, string, string, string) *model.Device); ok {
+		r0 = rf(ctx, id, fromScope, toScope, policy)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceID, string, string, string) error); ok {
+		r1 = rf(ctx, id, fromScope, toScope, policy)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Ping provides a mock function with given fields: ctx
 func (_m *DataStore) Ping(ctx context.Context) error {
 	ret := _m.Called(ctx)
@@ -326,6 +1147,106 @@ func (_m *DataStore) Ping(ctx context.Context) error {
 	return r0
 }
 
+// PurgeScopeByRetention provides a mock function with given fields: ctx, scope, retention, tenantIDs
+func (_m *DataStore) PurgeScopeByRetention(ctx context.Context, scope string, retention time.Duration, tenantIDs ...string) (int, error) {
+	_va := make([]interface{}, len(tenantIDs))
+	for _i := range tenantIDs {
+		_va[_i] = tenantIDs[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, scope, retention)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Duration, ...string) int); ok {
+		r0 = rf(ctx, scope, retention, tenantIDs...)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Duration, ...string) error); ok {
+		r1 = rf(ctx, scope, retention, tenantIDs...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RepairDuplicateAttributes provides a mock function with given fields: ctx, id
+func (_m *DataStore) RepairDuplicateAttributes(ctx context.Context, id model.DeviceID) (int, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceID) int); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceID) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReplaceAllAttributes provides a mock function with given fields: ctx, id, attrs
+func (_m *DataStore) ReplaceAllAttributes(ctx context.Context, id model.DeviceID, attrs model.DeviceAttributes) error {
+	ret := _m.Called(ctx, id, attrs)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceID, model.DeviceAttributes) error); ok {
+		r0 = rf(ctx, id, attrs)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ReplaceDevice provides a mock function with given fields: ctx, dev
+func (_m *DataStore) ReplaceDevice(ctx context.Context, dev *model.Device) error {
+	ret := _m.Called(ctx, dev)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.Device) error); ok {
+		r0 = rf(ctx, dev)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SampleDevices provides a mock function with given fields: ctx, n, filters
+func (_m *DataStore) SampleDevices(ctx context.Context, n int, filters []model.FilterPredicate) ([]model.Device, error) {
+	ret := _m.Called(ctx, n, filters)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, int, []model.FilterPredicate) []model.Device); ok {
+		r0 = rf(ctx, n, filters)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int, []model.FilterPredicate) error); ok {
+		r1 = rf(ctx, n, filters)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // SearchDevices provides a mock function with given fields: ctx, searchParams
 func (_m *DataStore) SearchDevices(ctx context.Context, searchParams model.SearchParams) ([]model.Device, int, error) {
 	ret := _m.Called(ctx, searchParams)
@@ -356,6 +1277,94 @@ func (_m *DataStore) SearchDevices(ctx context.Context, searchParams model.Searc
 	return r0, r1, r2
 }
 
+// SetFeatureFlags provides a mock function with given fields: ctx, flags
+func (_m *DataStore) SetFeatureFlags(ctx context.Context, flags model.FeatureFlags) error {
+	ret := _m.Called(ctx, flags)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.FeatureFlags) error); ok {
+		r0 = rf(ctx, flags)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetIngestHash provides a mock function with given fields: ctx, id, hash, expire
+func (_m *DataStore) SetIngestHash(ctx context.Context, id model.DeviceID, hash string, expire time.Time) error {
+	ret := _m.Called(ctx, id, hash, expire)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceID, string, time.Time) error); ok {
+		r0 = rf(ctx, id, hash, expire)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// StreamAllDevicesAcrossTenants provides a mock function with given fields: ctx, fn
+func (_m *DataStore) StreamAllDevicesAcrossTenants(ctx context.Context, fn func(model.TenantDevice) error) error {
+	ret := _m.Called(ctx, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, func(model.TenantDevice) error) error); ok {
+		r0 = rf(ctx, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ToggleAttribute provides a mock function with given fields: ctx, id, scope, name, defaultValue
+func (_m *DataStore) ToggleAttribute(ctx context.Context, id model.DeviceID, scope string, name string, defaultValue bool) (*model.Device, error) {
+	ret := _m.Called(ctx, id, scope, name, defaultValue)
+
+	var r0 *model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceID, string, string, bool) *model.Device); ok {
+		r0 = rf(ctx, id, scope, name, defaultValue)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceID, string, string, bool) error); ok {
+		r1 = rf(ctx, id, scope, name, defaultValue)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// TopAttributeValues provides a mock function with given fields: ctx, scope, name, limit
+func (_m *DataStore) TopAttributeValues(ctx context.Context, scope string, name string, limit int) ([]model.AttributeValueCount, error) {
+	ret := _m.Called(ctx, scope, name, limit)
+
+	var r0 []model.AttributeValueCount
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int) []model.AttributeValueCount); ok {
+		r0 = rf(ctx, scope, name, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.AttributeValueCount)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int) error); ok {
+		r1 = rf(ctx, scope, name, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // UnsetDevicesGroup provides a mock function with given fields: ctx, deviceIDs, group
 func (_m *DataStore) UnsetDevicesGroup(ctx context.Context, deviceIDs []model.DeviceID, group model.GroupName) (*model.UpdateResult, error) {
 	ret := _m.Called(ctx, deviceIDs, group)
@@ -379,6 +1388,27 @@ func (_m *DataStore) UnsetDevicesGroup(ctx context.Context, deviceIDs []model.De
 	return r0, r1
 }
 
+// UpdateDeviceGroupIf provides a mock function with given fields: ctx, id, expected, newGroup
+func (_m *DataStore) UpdateDeviceGroupIf(ctx context.Context, id model.DeviceID, expected model.GroupName, newGroup model.GroupName) (bool, error) {
+	ret := _m.Called(ctx, id, expected, newGroup)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceID, model.GroupName, model.GroupName) bool); ok {
+		r0 = rf(ctx, id, expected, newGroup)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceID, model.GroupName, model.GroupName) error); ok {
+		r1 = rf(ctx, id, expected, newGroup)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // UpdateDeviceText provides a mock function with given fields: ctx, id, text
 func (_m *DataStore) UpdateDeviceText(ctx context.Context, id model.DeviceID, text string) error {
 	ret := _m.Called(ctx, id, text)
@@ -416,6 +1446,20 @@ func (_m *DataStore) UpdateDevicesGroup(ctx context.Context, devIDs []model.Devi
 	return r0, r1
 }
 
+// UpdateSavedFilter provides a mock function with given fields: ctx, filter
+func (_m *DataStore) UpdateSavedFilter(ctx context.Context, filter *model.SavedFilter) error {
+	ret := _m.Called(ctx, filter)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.SavedFilter) error); ok {
+		r0 = rf(ctx, filter)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // UpsertDevicesAttributes provides a mock function with given fields: ctx, ids, attrs
 func (_m *DataStore) UpsertDevicesAttributes(ctx context.Context, ids []model.DeviceID, attrs model.DeviceAttributes) (*model.UpdateResult, error) {
 	ret := _m.Called(ctx, ids, attrs)
@@ -508,6 +1552,45 @@ func (_m *DataStore) UpsertRemoveDeviceAttributes(ctx context.Context, id model.
 	return r0, r1
 }
 
+// VerifyDeviceAttributes provides a mock function with given fields: ctx, id
+func (_m *DataStore) VerifyDeviceAttributes(ctx context.Context, id model.DeviceID) (*model.DeviceAttributesReport, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.DeviceAttributesReport
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceID) *model.DeviceAttributesReport); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.DeviceAttributesReport)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceID) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// WithAdminAccess provides a mock function with given fields:
+func (_m *DataStore) WithAdminAccess() store.DataStore {
+	ret := _m.Called()
+
+	var r0 store.DataStore
+	if rf, ok := ret.Get(0).(func() store.DataStore); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(store.DataStore)
+		}
+	}
+
+	return r0
+}
+
 // WithAutomigrate provides a mock function with given fields:
 func (_m *DataStore) WithAutomigrate() store.DataStore {
 	ret := _m.Called()
@@ -19,11 +19,16 @@ import (
 	"crypto/tls"
 	"fmt"
 	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	mopts "go.mongodb.org/mongo-driver/mongo/options"
@@ -31,7 +36,9 @@ import (
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 
+	"github.com/mendersoftware/go-lib-micro/identity"
 	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
 	mstore "github.com/mendersoftware/go-lib-micro/store"
 
 	"github.com/mendersoftware/inventory/model"
@@ -40,22 +47,46 @@ import (
 )
 
 const (
-	DbVersion = "1.1.0"
-
-	DbName        = "inventory"
-	DbDevicesColl = "devices"
+	DbVersion = "1.2.0"
+
+	DbName                 = "inventory"
+	DbDevicesColl          = "devices"
+	DbAttributesChurnColl  = "attributes_churn"
+	DbFeatureFlagsColl     = "feature_flags"
+	DbSavedFiltersColl     = "saved_filters"
+	DbIngestHashesColl     = "ingest_hashes"
+	DbIngestHash           = "hash"
+	DbIngestHashExpireTs   = "expire_ts"
+	DbAttributesChurnCount = "count"
+	DbSearchInValuesPrefix = "search_in_values_"
+	DbAttributeNamesColl   = "attribute_names"
+	DbAttributeNames       = "names"
+
+	// purgeBatchSize is the number of devices purged of the expired
+	// attributes with each update
+	purgeBatchSize = 1000
+
+	// dropInValuesTimeout bounds the drop of the temporary collections
+	// of the $in filter values, which outlives the request
+	dropInValuesTimeout = 10 * time.Second
+
+	// inValuesStaleAge is the age past which the temporary collections
+	// of the $in filter values are dropped when migrating
+	inValuesStaleAge = time.Hour
 
 	DbDevId              = "_id"
 	DbDevAttributes      = "attributes"
 	DbDevGroup           = "group"
 	DbDevRevision        = "revision"
 	DbDevUpdatedTs       = "updated_ts"
+	DbDevScopesUpdatedTs = "scopes_updated_ts"
 	DbDevAttributesText  = "text"
 	DbDevAttributesTs    = "timestamp"
 	DbDevAttributesDesc  = "description"
 	DbDevAttributesValue = "value"
 	DbDevAttributesScope = "scope"
 	DbDevAttributesName  = "name"
+	DbDevScore           = "score"
 	DbDevAttributesGroup = DbDevAttributes + "." +
 		model.AttrScopeSystem + "-" + model.AttrNameGroup
 	DbDevAttributesGroupValue = DbDevAttributesGroup + "." +
@@ -77,6 +108,14 @@ var (
 	once sync.Once
 
 	ErrNotFound = errors.New("mongo: no documents in result")
+
+	ErrInvalidAttributeRef = errors.New(
+		"mongo: attribute reference must name two attributes",
+	)
+
+	ErrInvalidIndexAttribute = errors.New(
+		"mongo: indexed attribute must be given as <scope>/<name>",
+	)
 )
 
 type DataStoreMongoConfig struct {
@@ -90,11 +129,66 @@ type DataStoreMongoConfig struct {
 	// Overwrites credentials provided in connection string if provided
 	Username string
 	Password string
+
+	// DisableSortTieBreaker disables the implicit final sort on the
+	// device ID applied to sorted device searches
+	DisableSortTieBreaker bool
+
+	// SortIDLast moves the sort on the device ID, `identity/id`, of the
+	// device searches after the attribute sorts instead of applying it at
+	// its position among the sort criteria
+	SortIDLast bool
+
+	// IndexAttributes lists the attributes, as <scope>/<name>, whose
+	// values are indexed when migrating the databases
+	IndexAttributes []string
+
+	// LargeInThreshold is the number of values above which the $in
+	// search filters are matched by joining a temporary collection of
+	// the values instead of querying with the values; zero disables it
+	LargeInThreshold int
+
+	// MaxAttributesBytes limits the BSON size of the attributes of each
+	// device returned by the search, leaving out the attributes past the
+	// limit and flagging the device as truncated; zero disables it
+	MaxAttributesBytes int
+
+	// RedactedAttributes lists the names of the attributes whose values
+	// are hidden in the logs
+	RedactedAttributes []string
+
+	// StrictAttributeTypes rejects the attribute upserts changing the
+	// type of the stored values, e.g. from string to number
+	StrictAttributeTypes bool
+
+	// CaseInsensitiveAttributeNames makes the search filters match the
+	// attributes regardless of the case of their names, e.g. a filter on
+	// `mac` matches the `MAC` attributes too
+	CaseInsensitiveAttributeNames bool
+
+	// MigrationConcurrency is the maximum number of tenant databases
+	// migrated at the same time when migrating all the tenants
+	MigrationConcurrency int
+
+	// AttributeChangeTimestamps sets the timestamp of the upserted
+	// attributes to the time their value last changed
+	AttributeChangeTimestamps bool
 }
 
 type DataStoreMongo struct {
-	client      *mongo.Client
-	automigrate bool
+	client                *mongo.Client
+	automigrate           bool
+	disableSortTieBreaker bool
+	sortIDLast            bool
+	adminAccess           bool
+	indexAttributes       []string
+	largeInThreshold      int
+	maxAttributesBytes    int
+	redactor              utils.AttributesRedactor
+	strictAttributeTypes  bool
+	caseInsensitiveNames  bool
+	migrationConcurrency  int
+	attributeChangeTs     bool
 }
 
 func NewDataStoreMongoWithSession(client *mongo.Client) store.DataStore {
@@ -103,8 +197,12 @@ func NewDataStoreMongoWithSession(client *mongo.Client) store.DataStore {
 
 // config.ConnectionString must contain a valid
 func NewDataStoreMongo(config DataStoreMongoConfig) (store.DataStore, error) {
+	indexAttributes, err := parseIndexAttributes(config.IndexAttributes)
+	if err != nil {
+		return nil, err
+	}
+
 	//init master session
-	var err error
 	once.Do(func() {
 		if !strings.Contains(config.ConnectionString, "://") {
 			config.ConnectionString = "mongodb://" + config.ConnectionString
@@ -157,7 +255,19 @@ func NewDataStoreMongo(config DataStoreMongoConfig) (store.DataStore, error) {
 	if clientGlobal == nil {
 		return nil, errors.New("failed to open mongo-driver session")
 	}
-	db := &DataStoreMongo{client: clientGlobal}
+	db := &DataStoreMongo{
+		client:                clientGlobal,
+		disableSortTieBreaker: config.DisableSortTieBreaker,
+		sortIDLast:            config.SortIDLast,
+		indexAttributes:       indexAttributes,
+		largeInThreshold:      config.LargeInThreshold,
+		maxAttributesBytes:    config.MaxAttributesBytes,
+		redactor:              utils.NewAttributesRedactor(config.RedactedAttributes),
+		strictAttributeTypes:  config.StrictAttributeTypes,
+		caseInsensitiveNames:  config.CaseInsensitiveAttributeNames,
+		migrationConcurrency:  config.MigrationConcurrency,
+		attributeChangeTs:     config.AttributeChangeTimestamps,
+	}
 
 	return db, nil
 }
@@ -167,12 +277,12 @@ func (db *DataStoreMongo) Ping(ctx context.Context) error {
 	return res.Err()
 }
 
-func (db *DataStoreMongo) GetDevices(
-	ctx context.Context,
-	q store.ListQuery,
-) ([]model.Device, int, error) {
-	c := db.client.Database(mstore.DbFromContext(ctx, DbName)).Collection(DbDevicesColl)
+func (db *DataStoreMongo) Close(ctx context.Context) error {
+	return db.client.Disconnect(ctx)
+}
 
+// makeListQueryFilter returns the devices query matching the filters of q.
+func makeListQueryFilter(q store.ListQuery) bson.M {
 	queryFilters := make([]bson.M, 0)
 	for _, filter := range q.Filters {
 		op := mongoOperator(filter.Operator)
@@ -203,10 +313,6 @@ func (db *DataStoreMongo) GetDevices(
 		groupFilter := bson.M{DbDevAttributesGroupValue: q.GroupName}
 		queryFilters = append(queryFilters, groupFilter)
 	}
-	if q.GroupName != "" {
-		groupFilter := bson.M{DbDevAttributesGroupValue: q.GroupName}
-		queryFilters = append(queryFilters, groupFilter)
-	}
 	if q.HasGroup != nil {
 		groupExistenceFilter := bson.M{
 			DbDevAttributesGroup: bson.M{
@@ -215,11 +321,30 @@ func (db *DataStoreMongo) GetDevices(
 		}
 		queryFilters = append(queryFilters, groupExistenceFilter)
 	}
+	if len(q.AnyTags) > 0 {
+		tagFilters := make([]bson.M, len(q.AnyTags))
+		for i, tag := range q.AnyTags {
+			tagFilters[i] = bson.M{
+				makeAttrField(tag, model.AttrScopeTags): bson.M{"$exists": true},
+			}
+		}
+		queryFilters = append(queryFilters, bson.M{"$or": tagFilters})
+	}
 
 	findQuery := bson.M{}
 	if len(queryFilters) > 0 {
 		findQuery["$and"] = queryFilters
 	}
+	return findQuery
+}
+
+func (db *DataStoreMongo) GetDevices(
+	ctx context.Context,
+	q store.ListQuery,
+) ([]model.Device, int, error) {
+	c := db.client.Database(mstore.DbFromContext(ctx, DbName)).Collection(DbDevicesColl)
+
+	findQuery := makeListQueryFilter(q)
 
 	findOptions := mopts.Find()
 	if q.Skip > 0 {
@@ -228,6 +353,12 @@ func (db *DataStoreMongo) GetDevices(
 	if q.Limit > 0 {
 		findOptions.SetLimit(int64(q.Limit))
 	}
+	if len(q.Attributes) > 0 {
+		projection := makeAttributesProjection(q.Attributes)
+		projection[DbDevAttributes+"."+model.AttrScopeSystem+"-"+
+			model.AttrNameCreated] = 1
+		findOptions.SetProjection(projection)
+	}
 	if q.Sort != nil {
 		name := fmt.Sprintf(
 			"%s-%s",
@@ -253,7 +384,14 @@ func (db *DataStoreMongo) GetDevices(
 		return nil, -1, errors.Wrap(err, "failed to search devices")
 	}
 
-	count, err := c.CountDocuments(ctx, findQuery)
+	var count int64
+	if q.Unfiltered() {
+		// counting all the documents is slow on large collections,
+		// use the collection metadata instead
+		count, err = c.EstimatedDocumentCount(ctx)
+	} else {
+		count, err = c.CountDocuments(ctx, findQuery)
+	}
 	if err != nil {
 		return nil, -1, errors.Wrap(err, "failed to count devices")
 	}
@@ -261,6 +399,58 @@ func (db *DataStoreMongo) GetDevices(
 	return devices, int(count), nil
 }
 
+func (db *DataStoreMongo) GetDevicesPartitionedByGroup(
+	ctx context.Context,
+	q store.ListQuery,
+	perGroup int,
+) (map[model.GroupName][]model.DeviceID, error) {
+	const devicesField = "devices"
+	c := db.client.Database(mstore.DbFromContext(ctx, DbName)).Collection(DbDevicesColl)
+
+	pipeline := []bson.M{
+		{"$match": makeListQueryFilter(q)},
+		{"$sort": bson.M{DbDevId: 1}},
+	}
+	if q.Limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": q.Limit})
+	}
+	pipeline = append(pipeline, bson.M{
+		"$group": bson.M{
+			DbDevId: bson.M{
+				"$ifNull": bson.A{"$" + DbDevAttributesGroupValue, ""},
+			},
+			devicesField: bson.M{"$push": "$" + DbDevId},
+		},
+	})
+	if perGroup > 0 {
+		pipeline = append(pipeline, bson.M{
+			"$project": bson.M{
+				devicesField: bson.M{
+					"$slice": bson.A{"$" + devicesField, perGroup},
+				},
+			},
+		})
+	}
+
+	cur, err := c.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var results []struct {
+		Group   model.GroupName  `bson:"_id"`
+		Devices []model.DeviceID `bson:"devices"`
+	}
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	groups := make(map[model.GroupName][]model.DeviceID, len(results))
+	for _, res := range results {
+		groups[res.Group] = res.Devices
+	}
+	return groups, nil
+}
+
 func (db *DataStoreMongo) GetDevice(
 	ctx context.Context,
 	id model.DeviceID,
@@ -286,6 +476,58 @@ func (db *DataStoreMongo) GetDevice(
 	return &res, nil
 }
 
+func (db *DataStoreMongo) GetDevicesMap(
+	ctx context.Context,
+	ids []model.DeviceID,
+) (map[model.DeviceID]*model.Device, error) {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	devices := make(map[model.DeviceID]*model.Device, len(ids))
+	if len(ids) == 0 {
+		return devices, nil
+	}
+	cursor, err := c.Find(ctx, bson.M{DbDevId: bson.M{"$in": ids}})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch devices")
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var dev model.Device
+		if err = cursor.Decode(&dev); err != nil {
+			return nil, errors.Wrap(err, "failed to decode device")
+		}
+		devices[dev.ID] = &dev
+	}
+	if err = cursor.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch devices")
+	}
+	return devices, nil
+}
+
+// GetDevicesByIDs returns the devices with the given IDs in the order of
+// the IDs, fetching them in a single query; unknown and repeated IDs are
+// left out
+func (db *DataStoreMongo) GetDevicesByIDs(
+	ctx context.Context,
+	ids []model.DeviceID,
+) ([]model.Device, error) {
+	devMap, err := db.GetDevicesMap(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	devices := make([]model.Device, 0, len(devMap))
+	for _, id := range ids {
+		if dev, ok := devMap[id]; ok {
+			devices = append(devices, *dev)
+			delete(devMap, id)
+		}
+	}
+	return devices, nil
+}
+
 // AddDevice inserts a new device, initializing the inventory data.
 func (db *DataStoreMongo) AddDevice(ctx context.Context, dev *model.Device) error {
 	if dev.Group != "" {
@@ -304,6 +546,105 @@ func (db *DataStoreMongo) AddDevice(ctx context.Context, dev *model.Device) erro
 	return nil
 }
 
+func (db *DataStoreMongo) CreateDevice(ctx context.Context, dev *model.Device) error {
+	const createdField = DbDevAttributes + "." +
+		model.AttrScopeSystem + "-" + model.AttrNameCreated
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	attrs := dev.Attributes
+	if dev.Group != "" {
+		attrs = append(attrs, model.DeviceAttribute{
+			Scope: model.AttrScopeSystem,
+			Name:  model.AttrNameGroup,
+			Value: dev.Group,
+		})
+	}
+	oninsert, err := makeAttrUpsert(attrs)
+	if err != nil {
+		return err
+	}
+	oninsert[createdField] = model.DeviceAttribute{
+		Scope: model.AttrScopeSystem,
+		Name:  model.AttrNameCreated,
+		Value: time.Now(),
+	}
+	oninsert[DbDevRevision] = 0
+	if err := db.recordAttributeNames(ctx, attrs); err != nil {
+		return err
+	}
+
+	// only set on insert: an existing device matches and is left as is
+	res, err := c.UpdateOne(ctx,
+		bson.M{DbDevId: dev.ID},
+		bson.M{"$setOnInsert": oninsert},
+		mopts.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return store.ErrDevExists
+	} else if err != nil {
+		return errors.Wrap(err, "failed to store device")
+	} else if res.UpsertedCount == 0 {
+		return store.ErrDevExists
+	}
+	return nil
+}
+
+func (db *DataStoreMongo) ReplaceDevice(ctx context.Context, dev *model.Device) error {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	attrs := make(model.DeviceAttributes, len(dev.Attributes), len(dev.Attributes)+3)
+	for i, attr := range dev.Attributes {
+		if attr.Name == "" {
+			return store.ErrNoAttrName
+		}
+		if attr.Scope == "" {
+			// Default to inventory scope
+			attr.Scope = model.AttrScopeInventory
+		}
+		attrs[i] = attr
+	}
+	if dev.Group != "" {
+		attrs = append(attrs, model.DeviceAttribute{
+			Scope: model.AttrScopeSystem,
+			Name:  model.AttrNameGroup,
+			Value: dev.Group,
+		})
+	}
+	now := time.Now()
+	attrs = append(attrs, model.DeviceAttribute{
+		Scope: model.AttrScopeSystem,
+		Name:  model.AttrNameCreated,
+		Value: now,
+	}, model.DeviceAttribute{
+		Scope: model.AttrScopeSystem,
+		Name:  model.AttrNameUpdated,
+		Value: now,
+	})
+
+	// setting the whole attributes document drops the existing attributes;
+	// the revision is kept as it follows the device's authentication data
+	_, err := c.UpdateOne(ctx,
+		bson.M{DbDevId: dev.ID},
+		bson.M{
+			"$set": bson.M{
+				DbDevAttributes:     attrs,
+				DbDevAttributesText: dev.Text,
+			},
+			"$unset":       bson.M{model.AttrNameTagsEtag: ""},
+			"$setOnInsert": bson.M{DbDevRevision: 0},
+		},
+		mopts.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to store device")
+	}
+	return nil
+}
+
 func (db *DataStoreMongo) UpsertDevicesAttributesWithRevision(
 	ctx context.Context,
 	devices []model.DeviceUpdate,
@@ -361,10 +702,26 @@ func (db *DataStoreMongo) upsertAttributes(
 		Database(mstore.DbFromContext(ctx, DbName)).
 		Collection(DbDevicesColl)
 
+	log.FromContext(ctx).Debugf("upserting the attributes of %d devices: %s",
+		len(devices), db.redactor.Format(attrs))
 	update, err := makeAttrUpsert(attrs)
 	if err != nil {
 		return nil, err
 	}
+	if db.strictAttributeTypes && len(devices) > 0 {
+		ids := make([]model.DeviceID, len(devices))
+		for i, dev := range devices {
+			ids[i] = dev.Id
+		}
+		if err := checkAttributeTypes(ctx, c, ids, attrs); err != nil {
+			return nil, err
+		}
+	}
+	if len(devices) > 0 {
+		if err := db.recordAttributeNames(ctx, attrs); err != nil {
+			return nil, err
+		}
+	}
 
 	now := time.Now()
 	oninsert := bson.M{
@@ -386,6 +743,9 @@ func (db *DataStoreMongo) upsertAttributes(
 			Value: now,
 		}
 	}
+	if scope != "" {
+		update[DbDevScopesUpdatedTs+"."+scope] = now
+	}
 
 	switch len(devices) {
 	case 0:
@@ -412,13 +772,9 @@ func (db *DataStoreMongo) upsertAttributes(
 			filter[etagField] = bson.M{"$eq": etag}
 		}
 
-		update = bson.M{
-			"$set":         update,
-			"$setOnInsert": oninsert,
-		}
-
 		device := &model.Device{}
-		res := c.FindOneAndUpdate(ctx, filter, update, updateOpts)
+		res := c.FindOneAndUpdate(ctx, filter,
+			db.makeUpsertUpdate(update, oninsert, attrs, now), updateOpts)
 		err = res.Decode(device)
 		if err != nil {
 			if mongo.IsDuplicateKeyError(err) {
@@ -449,17 +805,10 @@ func (db *DataStoreMongo) upsertAttributes(
 					DbDevRevision: bson.M{"$lt": dev.Revision},
 				}
 				update[DbDevRevision] = dev.Revision
-				umod.Update = bson.M{
-					"$set":         update,
-					"$setOnInsert": oninsert,
-				}
 			} else {
 				filter = map[string]interface{}{"_id": dev.Id}
-				umod.Update = bson.M{
-					"$set":         update,
-					"$setOnInsert": oninsert,
-				}
 			}
+			umod.Update = db.makeUpsertUpdate(update, oninsert, attrs, now)
 			umod.Filter = filter
 			umod.SetUpsert(true)
 			models[i] = umod
@@ -485,6 +834,108 @@ func (db *DataStoreMongo) upsertAttributes(
 	return result, err
 }
 
+// makeUpsertUpdate returns the update setting the fields of set and, on
+// insert, the fields of oninsert. With the attribute change timestamps
+// enabled, it is a pipeline update also setting the timestamp of each
+// of the attrs to now when its value differs from the stored one.
+func (db *DataStoreMongo) makeUpsertUpdate(
+	set, oninsert bson.M,
+	attrs model.DeviceAttributes,
+	now time.Time,
+) interface{} {
+	if !db.attributeChangeTs {
+		return bson.M{
+			"$set":         set,
+			"$setOnInsert": oninsert,
+		}
+	}
+	stage := make(bson.M, len(set)+len(oninsert)+len(attrs))
+	for field, value := range set {
+		stage[field] = bson.M{"$literal": value}
+	}
+	for field, value := range oninsert {
+		stage[field] = bson.M{"$ifNull": bson.A{
+			"$" + field, bson.M{"$literal": value},
+		}}
+	}
+	for _, attr := range attrs {
+		if attr.Value == nil || attr.Timestamp != nil {
+			continue
+		}
+		valueField := makeAttrField(attr.Name, attr.Scope, DbDevAttributesValue)
+		tsField := makeAttrField(attr.Name, attr.Scope, DbDevAttributesTs)
+		stage[tsField] = bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{
+				"$" + valueField, bson.M{"$literal": attr.Value},
+			}},
+			"$" + tsField,
+			now,
+		}}
+	}
+	return bson.A{bson.M{"$set": stage}}
+}
+
+// bsonTypeClass maps the numeric BSON types to a single type, as the
+// numbers are decoded and encoded back with varying precision.
+func bsonTypeClass(t bsontype.Type) bsontype.Type {
+	switch t {
+	case bsontype.Int32, bsontype.Int64, bsontype.Decimal128:
+		return bsontype.Double
+	}
+	return t
+}
+
+// checkAttributeTypes returns ErrAttributeTypeConflict if any of the
+// attribute values differs in type from the value stored for any of the
+// devices; attributes not yet stored are accepted with any type.
+func checkAttributeTypes(
+	ctx context.Context,
+	c *mongo.Collection,
+	ids []model.DeviceID,
+	attrs model.DeviceAttributes,
+) error {
+	projection := bson.M{}
+	for _, attr := range attrs {
+		if attr.Value != nil {
+			projection[makeAttrField(attr.Name, attr.Scope, DbDevAttributesValue)] = 1
+		}
+	}
+	if len(projection) == 0 {
+		return nil
+	}
+
+	cur, err := c.Find(ctx,
+		bson.M{DbDevId: bson.M{"$in": ids}},
+		mopts.Find().SetProjection(projection),
+	)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		for _, attr := range attrs {
+			if attr.Value == nil {
+				continue
+			}
+			field := makeAttrField(attr.Name, attr.Scope, DbDevAttributesValue)
+			stored, err := cur.Current.LookupErr(strings.Split(field, ".")...)
+			if err != nil {
+				continue
+			}
+			valueType, _, err := bson.MarshalValue(attr.Value)
+			if err != nil {
+				return err
+			}
+			if bsonTypeClass(valueType) != bsonTypeClass(stored.Type) {
+				return errors.Wrapf(store.ErrAttributeTypeConflict,
+					"attribute %s/%s", attr.Scope, attr.Name)
+			}
+		}
+	}
+	return cur.Err()
+}
+
 // makeAttrField is a convenience function for composing attribute field names.
 func makeAttrField(attrName, attrScope string, subFields ...string) string {
 	field := fmt.Sprintf(
@@ -589,69 +1040,298 @@ func mongoOperator(co store.ComparisonOperator) string {
 	return ""
 }
 
-func (db *DataStoreMongo) UpsertRemoveDeviceAttributes(
+func (db *DataStoreMongo) ReplaceAllAttributes(
 	ctx context.Context,
 	id model.DeviceID,
-	updateAttrs model.DeviceAttributes,
-	removeAttrs model.DeviceAttributes,
-	scope string,
-	etag string,
-) (*model.UpdateResult, error) {
-	const systemScope = DbDevAttributes + "." + model.AttrScopeSystem
-	const updatedField = systemScope + "-" + model.AttrNameUpdated
-	const createdField = systemScope + "-" + model.AttrNameCreated
-	const etagField = model.AttrNameTagsEtag
-	var (
-		err error
-	)
-
+	attrs model.DeviceAttributes,
+) error {
 	c := db.client.
 		Database(mstore.DbFromContext(ctx, DbName)).
 		Collection(DbDevicesColl)
 
-	update, err := makeAttrUpsert(updateAttrs)
-	if err != nil {
-		return nil, err
+	replacer := model.GetDeviceAttributeNameReplacer()
+	newAttrs := make(bson.M, len(attrs)+1)
+	for _, attr := range attrs {
+		if attr.Name == "" {
+			return store.ErrNoAttrName
+		}
+		if attr.Scope == "" {
+			// Default to inventory scope
+			attr.Scope = model.AttrScopeInventory
+		}
+		newAttrs[attr.Scope+"-"+replacer.Replace(attr.Name)] = attr
 	}
-	remove, err := makeAttrRemove(removeAttrs)
+	newAttrs[model.AttrScopeSystem+"-"+model.AttrNameUpdated] = model.DeviceAttribute{
+		Scope: model.AttrScopeSystem,
+		Name:  model.AttrNameUpdated,
+		Value: time.Now(),
+	}
+	if err := db.recordAttributeNames(ctx, attrs); err != nil {
+		return err
+	}
+
+	// the pipeline update keeps the stored system attributes and sets the
+	// others in one go; the new attributes are literals so that values
+	// starting with $ are not taken for field paths
+	res, err := c.UpdateOne(ctx,
+		bson.M{DbDevId: id},
+		bson.A{
+			bson.M{"$set": bson.M{
+				DbDevAttributes: bson.M{"$mergeObjects": bson.A{
+					bson.M{"$arrayToObject": bson.M{"$filter": bson.M{
+						"input": bson.M{"$objectToArray": bson.M{
+							"$ifNull": bson.A{"$" + DbDevAttributes, bson.M{}},
+						}},
+						"cond": bson.M{"$eq": bson.A{
+							"$$this.v." + DbDevAttributesScope,
+							model.AttrScopeSystem,
+						}},
+					}}},
+					bson.M{"$literal": newAttrs},
+				}},
+			}},
+			bson.M{"$unset": model.AttrNameTagsEtag},
+		},
+	)
 	if err != nil {
-		return nil, err
+		return errors.Wrap(err, "failed to replace the device attributes")
 	}
-	filter := bson.M{"_id": id}
-	if etag != "" {
-		filter[etagField] = bson.M{"$eq": etag}
+	if res.MatchedCount == 0 {
+		return store.ErrDevNotFound
 	}
+	return nil
+}
 
-	updateOpts := mopts.FindOneAndUpdate().
-		SetUpsert(true).
-		SetReturnDocument(mopts.After)
-	if scope == model.AttrScopeTags {
-		update[etagField] = uuid.New().String()
-		updateOpts = updateOpts.SetUpsert(false)
+func (db *DataStoreMongo) ToggleAttribute(
+	ctx context.Context,
+	id model.DeviceID,
+	scope string,
+	name string,
+	defaultValue bool,
+) (*model.Device, error) {
+	const updatedField = DbDevAttributes + "." +
+		model.AttrScopeSystem + "-" + model.AttrNameUpdated
+	if name == "" {
+		return nil, store.ErrNoAttrName
 	}
-	now := time.Now()
-	if scope != model.AttrScopeTags {
-		update[updatedField] = model.DeviceAttribute{
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	field := makeAttrField(name, scope)
+	valueType := bson.M{"$type": "$" + field + "." + DbDevAttributesValue}
+
+	// the filter makes the update conditional on the stored value being
+	// a boolean or missing, so that concurrent toggles don't clobber
+	// a value of another type
+	filter := bson.M{
+		DbDevId: id,
+		"$expr": bson.M{"$in": bson.A{valueType, bson.A{"bool", "missing"}}},
+	}
+	set := bson.M{
+		field: bson.M{"$cond": bson.M{
+			"if": bson.M{"$eq": bson.A{valueType, "bool"}},
+			"then": bson.M{"$mergeObjects": bson.A{
+				"$" + field,
+				bson.M{DbDevAttributesValue: bson.M{
+					"$not": bson.A{"$" + field + "." + DbDevAttributesValue},
+				}},
+			}},
+			"else": bson.M{"$literal": model.DeviceAttribute{
+				Scope: scope,
+				Name:  name,
+				Value: defaultValue,
+			}},
+		}},
+		updatedField: bson.M{"$literal": model.DeviceAttribute{
 			Scope: model.AttrScopeSystem,
 			Name:  model.AttrNameUpdated,
-			Value: now,
-		}
+			Value: time.Now(),
+		}},
 	}
-	update = bson.M{
-		"$set": update,
-		"$setOnInsert": bson.M{
-			createdField: model.DeviceAttribute{
-				Scope: model.AttrScopeSystem,
-				Name:  model.AttrNameCreated,
-				Value: now,
-			},
-		},
+	if scope == model.AttrScopeTags {
+		set[model.AttrNameTagsEtag] = uuid.New().String()
 	}
-	if len(remove) > 0 {
-		update["$unset"] = remove
+	err := db.recordAttributeNames(ctx, model.DeviceAttributes{{Scope: scope, Name: name}})
+	if err != nil {
+		return nil, err
 	}
 
-	device := &model.Device{}
+	updateOpts := mopts.FindOneAndUpdate().
+		SetReturnDocument(mopts.After)
+	device := &model.Device{}
+	err = c.FindOneAndUpdate(ctx, filter, bson.A{bson.M{"$set": set}}, updateOpts).
+		Decode(device)
+	if err == mongo.ErrNoDocuments {
+		count, err := c.CountDocuments(ctx, bson.M{DbDevId: id})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to check the device")
+		} else if count == 0 {
+			return nil, store.ErrDevNotFound
+		}
+		return nil, errors.Wrapf(store.ErrAttributeTypeConflict,
+			"attribute %s/%s", scope, name)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to toggle the attribute")
+	}
+	return device, nil
+}
+
+func (db *DataStoreMongo) MoveAttributesBetweenScopes(
+	ctx context.Context,
+	id model.DeviceID,
+	fromScope string,
+	toScope string,
+	policy string,
+) (*model.Device, error) {
+	const updatedField = DbDevAttributes + "." +
+		model.AttrScopeSystem + "-" + model.AttrNameUpdated
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	attrs := bson.M{"$objectToArray": bson.M{
+		"$ifNull": bson.A{"$" + DbDevAttributes, bson.M{}},
+	}}
+	inScope := bson.M{"$eq": bson.A{"$$this.v." + DbDevAttributesScope, fromScope}}
+	// the attributes are re-keyed by replacing the scope prefix of their
+	// keys, which keeps the escaping of the names
+	moved := bson.M{"$arrayToObject": bson.M{"$map": bson.M{
+		"input": bson.M{"$filter": bson.M{"input": attrs, "cond": inScope}},
+		"in": bson.M{
+			"k": bson.M{"$concat": bson.A{
+				toScope + "-",
+				bson.M{"$substrCP": bson.A{
+					"$$this.k",
+					len([]rune(fromScope)) + 1,
+					bson.M{"$strLenCP": "$$this.k"},
+				}},
+			}},
+			"v": bson.M{"$mergeObjects": bson.A{
+				"$$this.v",
+				bson.M{DbDevAttributesScope: toScope},
+			}},
+		},
+	}}}
+	kept := bson.M{"$arrayToObject": bson.M{"$filter": bson.M{
+		"input": attrs,
+		"cond":  bson.M{"$not": bson.A{inScope}},
+	}}}
+	// the later objects win the conflicts of $mergeObjects
+	merged := bson.A{kept, moved}
+	if policy == model.MergePolicyKeep {
+		merged = bson.A{moved, kept}
+	}
+
+	update := bson.A{
+		bson.M{"$set": bson.M{DbDevAttributes: bson.M{"$mergeObjects": merged}}},
+		bson.M{"$set": bson.M{
+			updatedField: bson.M{"$literal": model.DeviceAttribute{
+				Scope: model.AttrScopeSystem,
+				Name:  model.AttrNameUpdated,
+				Value: time.Now(),
+			}},
+		}},
+	}
+	if fromScope == model.AttrScopeTags || toScope == model.AttrScopeTags {
+		update = append(update, bson.M{"$set": bson.M{
+			model.AttrNameTagsEtag: uuid.New().String(),
+		}})
+	}
+
+	updateOpts := mopts.FindOneAndUpdate().
+		SetReturnDocument(mopts.After)
+	device := &model.Device{}
+	err := c.FindOneAndUpdate(ctx, bson.M{DbDevId: id}, update, updateOpts).
+		Decode(device)
+	if err == mongo.ErrNoDocuments {
+		return nil, store.ErrDevNotFound
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to move the attributes")
+	}
+	var movedAttrs model.DeviceAttributes
+	for _, attr := range device.Attributes {
+		if attr.Scope == toScope {
+			movedAttrs = append(movedAttrs, attr)
+		}
+	}
+	if err := db.recordAttributeNames(ctx, movedAttrs); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+func (db *DataStoreMongo) UpsertRemoveDeviceAttributes(
+	ctx context.Context,
+	id model.DeviceID,
+	updateAttrs model.DeviceAttributes,
+	removeAttrs model.DeviceAttributes,
+	scope string,
+	etag string,
+) (*model.UpdateResult, error) {
+	const systemScope = DbDevAttributes + "." + model.AttrScopeSystem
+	const updatedField = systemScope + "-" + model.AttrNameUpdated
+	const createdField = systemScope + "-" + model.AttrNameCreated
+	const etagField = model.AttrNameTagsEtag
+	var (
+		err error
+	)
+
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	log.FromContext(ctx).Debugf("replacing the attributes of device %s: %s",
+		id, db.redactor.Format(updateAttrs))
+	update, err := makeAttrUpsert(updateAttrs)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.recordAttributeNames(ctx, updateAttrs); err != nil {
+		return nil, err
+	}
+	remove, err := makeAttrRemove(removeAttrs)
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.M{"_id": id}
+	if etag != "" {
+		filter[etagField] = bson.M{"$eq": etag}
+	}
+
+	updateOpts := mopts.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(mopts.After)
+	if scope == model.AttrScopeTags {
+		update[etagField] = uuid.New().String()
+		updateOpts = updateOpts.SetUpsert(false)
+	}
+	now := time.Now()
+	if scope != model.AttrScopeTags {
+		update[updatedField] = model.DeviceAttribute{
+			Scope: model.AttrScopeSystem,
+			Name:  model.AttrNameUpdated,
+			Value: now,
+		}
+	}
+	if scope != "" {
+		update[DbDevScopesUpdatedTs+"."+scope] = now
+	}
+	update = bson.M{
+		"$set": update,
+		"$setOnInsert": bson.M{
+			createdField: model.DeviceAttribute{
+				Scope: model.AttrScopeSystem,
+				Name:  model.AttrNameCreated,
+				Value: now,
+			},
+		},
+	}
+	if len(remove) > 0 {
+		update["$unset"] = remove
+	}
+
+	device := &model.Device{}
 	res := c.FindOneAndUpdate(ctx, filter, update, updateOpts)
 	err = res.Decode(device)
 	if err == mongo.ErrNoDocuments {
@@ -706,6 +1386,59 @@ func (db *DataStoreMongo) UpdateDevicesGroup(
 	}, nil
 }
 
+// UpdateDeviceGroupIf sets the device's group only if the current group
+// matches the expected one.
+func (db *DataStoreMongo) UpdateDeviceGroupIf(
+	ctx context.Context,
+	id model.DeviceID,
+	expected model.GroupName,
+	newGroup model.GroupName,
+) (bool, error) {
+	database := db.client.Database(mstore.DbFromContext(ctx, DbName))
+	collDevs := database.Collection(DbDevicesColl)
+
+	filter := bson.D{{Key: DbDevId, Value: id}}
+	if expected == "" {
+		// a null match includes devices without the group attribute
+		filter = append(filter, bson.E{
+			Key: DbDevAttributesGroupValue, Value: bson.M{"$in": bson.A{nil, ""}},
+		})
+	} else {
+		filter = append(filter, bson.E{Key: DbDevAttributesGroupValue, Value: expected})
+	}
+	var update bson.M
+	if newGroup == "" {
+		update = bson.M{
+			"$unset": bson.M{
+				DbDevAttributesGroup: "",
+			},
+		}
+	} else {
+		update = bson.M{
+			"$set": bson.M{
+				DbDevAttributesGroup: model.DeviceAttribute{
+					Scope: model.AttrScopeSystem,
+					Name:  DbDevGroup,
+					Value: newGroup,
+				},
+			},
+		}
+	}
+	res, err := collDevs.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	if res.MatchedCount == 0 {
+		count, err := collDevs.CountDocuments(ctx, bson.M{DbDevId: id})
+		if err != nil {
+			return false, err
+		} else if count == 0 {
+			return false, store.ErrDevNotFound
+		}
+	}
+	return res.ModifiedCount > 0, nil
+}
+
 // UpdateDeviceText updates the device text field
 func (db *DataStoreMongo) UpdateDeviceText(
 	ctx context.Context,
@@ -804,67 +1537,449 @@ func (db *DataStoreMongo) GetFiltersAttributes(
 	return attributes, nil
 }
 
-func (db *DataStoreMongo) DeleteGroup(
+func (db *DataStoreMongo) GetDescribedAttributes(
 	ctx context.Context,
-	group model.GroupName,
-) (chan model.DeviceID, error) {
-	deviceIDs := make(chan model.DeviceID)
-
-	database := db.client.Database(mstore.DbFromContext(ctx, DbName))
-	collDevs := database.Collection(DbDevicesColl)
-
-	filter := bson.M{DbDevAttributesGroupValue: group}
+) ([]model.DescribedAttribute, error) {
+	collDevs := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
 
-	const batchMaxSize = 100
-	batchSize := int32(batchMaxSize)
-	findOptions := &mopts.FindOptions{
-		Projection: bson.M{DbDevId: 1},
-		BatchSize:  &batchSize,
-	}
-	cursor, err := collDevs.Find(ctx, filter, findOptions)
+	const attr = "$" + DbDevAttributes + ".v."
+	cur, err := collDevs.Aggregate(ctx, []bson.M{
+		{
+			"$project": bson.M{
+				"_id": 0,
+				DbDevAttributes: bson.M{
+					"$objectToArray": "$" + DbDevAttributes,
+				},
+			},
+		},
+		{
+			"$unwind": "$" + DbDevAttributes,
+		},
+		{
+			"$match": bson.M{
+				DbDevAttributes + ".v." + DbDevAttributesDesc: bson.M{
+					"$type": "string",
+					"$ne":   "",
+				},
+			},
+		},
+		{
+			"$group": bson.M{
+				DbDevId: bson.M{
+					DbDevAttributesName:  attr + DbDevAttributesName,
+					DbDevAttributesScope: attr + DbDevAttributesScope,
+				},
+				DbDevAttributesDesc: bson.M{
+					"$first": attr + DbDevAttributesDesc,
+				},
+			},
+		},
+		{
+			"$project": bson.M{
+				"_id":                0,
+				DbDevAttributesName:  "$" + DbDevId + "." + DbDevAttributesName,
+				DbDevAttributesScope: "$" + DbDevId + "." + DbDevAttributesScope,
+				DbDevAttributesDesc:  1,
+			},
+		},
+		{
+			"$sort": bson.D{
+				{Key: DbDevAttributesScope, Value: 1},
+				{Key: DbDevAttributesName, Value: 1},
+			},
+		},
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	go func() {
-		defer cursor.Close(ctx)
-		batch := make([]model.DeviceID, batchMaxSize)
-		batchSize := 0
+	attributes := []model.DescribedAttribute{}
+	if err := cur.All(ctx, &attributes); err != nil {
+		return nil, err
+	}
+	return attributes, nil
+}
 
-		update := bson.M{"$unset": bson.M{DbDevAttributesGroup: 1}}
-		device := &model.Device{}
-		defer close(deviceIDs)
+// schemaAttrTypes maps the BSON types of the attribute values to the
+// types of the group schema
+var schemaAttrTypes = map[string]string{
+	"string":  model.AttrTypeString,
+	"double":  model.AttrTypeNumber,
+	"int":     model.AttrTypeNumber,
+	"long":    model.AttrTypeNumber,
+	"decimal": model.AttrTypeNumber,
+	"bool":    model.AttrTypeBool,
+	"date":    model.AttrTypeTime,
+	"array":   model.AttrTypeArray,
+}
 
-	next:
-		for {
-			hasNext := cursor.Next(ctx)
-			if !hasNext {
-				if batchSize > 0 {
-					break
+func (db *DataStoreMongo) GetGroupSchema(
+	ctx context.Context,
+	group model.GroupName,
+) ([]model.SchemaAttribute, error) {
+	collDevs := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	const (
+		attr        = "$" + DbDevAttributes + ".v."
+		DbTypes     = "types"
+		typeNull    = "null"
+		typeMissing = "missing"
+	)
+	cur, err := collDevs.Aggregate(ctx, []bson.M{
+		{
+			"$match": bson.M{DbDevAttributesGroupValue: group},
+		},
+		// Sample the devices like the filter attributes
+		{
+			"$limit": FiltersAttributesMaxDevices,
+		},
+		{
+			"$project": bson.M{
+				"_id": 0,
+				DbDevAttributes: bson.M{
+					"$objectToArray": "$" + DbDevAttributes,
+				},
+			},
+		},
+		{
+			"$unwind": "$" + DbDevAttributes,
+		},
+		{
+			"$group": bson.M{
+				DbDevId: bson.M{
+					DbDevAttributesName:  attr + DbDevAttributesName,
+					DbDevAttributesScope: attr + DbDevAttributesScope,
+				},
+				DbTypes: bson.M{
+					"$addToSet": bson.M{"$type": attr + DbDevAttributesValue},
+				},
+			},
+		},
+		{
+			"$project": bson.M{
+				"_id":                0,
+				DbDevAttributesName:  "$" + DbDevId + "." + DbDevAttributesName,
+				DbDevAttributesScope: "$" + DbDevId + "." + DbDevAttributesScope,
+				DbTypes:              1,
+			},
+		},
+		{
+			"$sort": bson.D{
+				{Key: DbDevAttributesScope, Value: 1},
+				{Key: DbDevAttributesName, Value: 1},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []model.SchemaAttribute
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	attributes := make([]model.SchemaAttribute, 0, len(results))
+	for _, res := range results {
+		types := make([]string, 0, len(res.Types))
+		for _, bsonType := range res.Types {
+			attrType, ok := schemaAttrTypes[bsonType]
+			if !ok {
+				// the attributes without value have no type, the
+				// other types keep their BSON name
+				if bsonType == typeNull || bsonType == typeMissing {
+					continue
 				}
-				return
+				attrType = bsonType
 			}
-			if err = cursor.Decode(&device); err == nil {
-				batch[batchSize] = device.ID
-				batchSize++
-				if len(batch) == batchSize {
-					break
-				}
+			if !utils.ContainsString(attrType, types) {
+				types = append(types, attrType)
 			}
 		}
+		sort.Strings(types)
+		res.Types = types
+		attributes = append(attributes, res)
+	}
+	return attributes, nil
+}
 
-		_, _ = collDevs.UpdateMany(ctx, bson.M{DbDevId: bson.M{"$in": batch[:batchSize]}}, update)
-		for _, item := range batch[:batchSize] {
-			deviceIDs <- item
-		}
-		batchSize = 0
-		goto next
-	}()
-
-	return deviceIDs, nil
+func (db *DataStoreMongo) FindDevicesWithDuplicateAttributes(
+	ctx context.Context,
+	skip int,
+	limit int,
+) ([]model.DeviceDuplicateAttributes, error) {
+	return db.findDuplicateAttributes(ctx, bson.M{}, skip, limit)
 }
 
-func (db *DataStoreMongo) UnsetDevicesGroup(
+func (db *DataStoreMongo) RepairDuplicateAttributes(
+	ctx context.Context,
+	id model.DeviceID,
+) (int, error) {
+	devices, err := db.findDuplicateAttributes(ctx, bson.M{DbDevId: id}, 0, 0)
+	if err != nil {
+		return 0, err
+	} else if len(devices) == 0 {
+		return 0, nil
+	}
+
+	replacer := model.GetDeviceAttributeNameReplacer()
+	unset := bson.M{}
+	for _, dup := range devices[0].Attributes {
+		// keep the entry stored under the canonical key, or the first one
+		keep := dup.Keys[0]
+		canonical := dup.Scope + "-" + replacer.Replace(dup.Name)
+		for _, key := range dup.Keys {
+			if key == canonical {
+				keep = key
+				break
+			}
+		}
+		for _, key := range dup.Keys {
+			if key != keep {
+				unset[DbDevAttributes+"."+key] = ""
+			}
+		}
+	}
+
+	c := db.client.Database(mstore.DbFromContext(ctx, DbName)).Collection(DbDevicesColl)
+	_, err = c.UpdateOne(ctx, bson.M{DbDevId: id}, bson.M{"$unset": unset})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to remove duplicate attributes")
+	}
+	return len(unset), nil
+}
+
+func (db *DataStoreMongo) VerifyDeviceAttributes(
+	ctx context.Context,
+	id model.DeviceID,
+) (*model.DeviceAttributesReport, error) {
+	c := db.client.Database(mstore.DbFromContext(ctx, DbName)).Collection(DbDevicesColl)
+
+	// decode the raw entries, as decoding the device drops the storage
+	// keys and merges the duplicates
+	var doc struct {
+		Attributes bson.Raw `bson:"attributes"`
+	}
+	err := c.FindOne(ctx, bson.M{DbDevId: id},
+		mopts.FindOne().SetProjection(bson.M{DbDevAttributes: 1}),
+	).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, store.ErrDevNotFound
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to get the device")
+	}
+
+	report := &model.DeviceAttributesReport{
+		DeviceID: id,
+		Issues:   []model.AttributeIssue{},
+	}
+	if doc.Attributes == nil {
+		return report, nil
+	}
+	elems, err := doc.Attributes.Elements()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode the attributes")
+	}
+
+	type entry struct {
+		key   string
+		name  string
+		scope string
+		value interface{}
+	}
+	entries := make([]entry, 0, len(elems))
+	counts := map[[2]string]int{}
+	for _, elem := range elems {
+		var attr struct {
+			Name  string      `bson:"name"`
+			Scope string      `bson:"scope"`
+			Value interface{} `bson:"value"`
+		}
+		if err := elem.Value().Unmarshal(&attr); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode the attribute %s", elem.Key())
+		}
+		entries = append(entries, entry{
+			key:   elem.Key(),
+			name:  attr.Name,
+			scope: attr.Scope,
+			value: attr.Value,
+		})
+		counts[[2]string{attr.Scope, attr.Name}]++
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+
+	for _, e := range entries {
+		addIssue := func(issue string) {
+			report.Issues = append(report.Issues, model.AttributeIssue{
+				Key:   e.key,
+				Name:  e.name,
+				Scope: e.scope,
+				Issue: issue,
+			})
+		}
+		if counts[[2]string{e.scope, e.name}] > 1 {
+			addIssue(model.AttributeIssueDuplicateKey)
+		}
+		if e.scope == "" {
+			addIssue(model.AttributeIssueMissingScope)
+		}
+		if values, ok := e.value.(bson.A); ok && hasMixedTypes(values) {
+			addIssue(model.AttributeIssueMixedArrayTypes)
+		}
+	}
+	return report, nil
+}
+
+// hasMixedTypes returns whether the values mix strings, numbers or other
+// types; the numbers of any BSON type count as the same type
+func hasMixedTypes(values bson.A) bool {
+	typeOf := func(value interface{}) string {
+		switch value.(type) {
+		case string:
+			return "string"
+		case float64, int32, int64:
+			return "number"
+		default:
+			return fmt.Sprintf("%T", value)
+		}
+	}
+	for i := 1; i < len(values); i++ {
+		if typeOf(values[i]) != typeOf(values[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// findDuplicateAttributes groups the attribute entries of the devices
+// matching the filter by scope and name, returning the groups with more
+// than one entry; a zero limit returns all the devices.
+func (db *DataStoreMongo) findDuplicateAttributes(
+	ctx context.Context,
+	filter bson.M,
+	skip int,
+	limit int,
+) ([]model.DeviceDuplicateAttributes, error) {
+	c := db.client.Database(mstore.DbFromContext(ctx, DbName)).Collection(DbDevicesColl)
+
+	const (
+		attrs  = "attrs"
+		count  = "count"
+		device = "device"
+	)
+	pipeline := []bson.M{
+		{"$match": filter},
+		{"$project": bson.M{
+			attrs: bson.M{"$objectToArray": "$" + DbDevAttributes},
+		}},
+		{"$unwind": "$" + attrs},
+		{"$match": bson.M{attrs + ".v.name": bson.M{"$exists": true}}},
+		{"$group": bson.M{
+			"_id": bson.M{
+				device:               "$_id",
+				DbDevAttributesScope: "$" + attrs + ".v.scope",
+				DbDevAttributesName:  "$" + attrs + ".v.name",
+			},
+			"keys": bson.M{"$push": "$" + attrs + ".k"},
+			count:  bson.M{"$sum": 1},
+		}},
+		{"$match": bson.M{count: bson.M{"$gt": 1}}},
+		{"$group": bson.M{
+			"_id": "$_id." + device,
+			DbDevAttributes: bson.M{"$push": bson.M{
+				DbDevAttributesScope: "$_id." + DbDevAttributesScope,
+				DbDevAttributesName:  "$_id." + DbDevAttributesName,
+				"keys":               "$keys",
+			}},
+		}},
+		{"$sort": bson.M{"_id": 1}},
+	}
+	if skip > 0 {
+		pipeline = append(pipeline, bson.M{"$skip": skip})
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": limit})
+	}
+	// the unwound attributes of all the devices exceed the memory limit
+	// of the aggregation stages on large tenants
+	cur, err := c.Aggregate(ctx, pipeline, mopts.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find duplicate attributes")
+	}
+
+	devices := []model.DeviceDuplicateAttributes{}
+	if err := cur.All(ctx, &devices); err != nil {
+		return nil, errors.Wrap(err, "failed to find duplicate attributes")
+	}
+	return devices, nil
+}
+
+func (db *DataStoreMongo) DeleteGroup(
+	ctx context.Context,
+	group model.GroupName,
+) (chan model.DeviceID, error) {
+	deviceIDs := make(chan model.DeviceID)
+
+	database := db.client.Database(mstore.DbFromContext(ctx, DbName))
+	collDevs := database.Collection(DbDevicesColl)
+
+	filter := bson.M{DbDevAttributesGroupValue: group}
+
+	const batchMaxSize = 100
+	batchSize := int32(batchMaxSize)
+	findOptions := &mopts.FindOptions{
+		Projection: bson.M{DbDevId: 1},
+		BatchSize:  &batchSize,
+	}
+	cursor, err := collDevs.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		defer cursor.Close(ctx)
+		batch := make([]model.DeviceID, batchMaxSize)
+		batchSize := 0
+
+		update := bson.M{"$unset": bson.M{DbDevAttributesGroup: 1}}
+		device := &model.Device{}
+		defer close(deviceIDs)
+
+	next:
+		for {
+			hasNext := cursor.Next(ctx)
+			if !hasNext {
+				if batchSize > 0 {
+					break
+				}
+				return
+			}
+			if err = cursor.Decode(&device); err == nil {
+				batch[batchSize] = device.ID
+				batchSize++
+				if len(batch) == batchSize {
+					break
+				}
+			}
+		}
+
+		_, _ = collDevs.UpdateMany(ctx, bson.M{DbDevId: bson.M{"$in": batch[:batchSize]}}, update)
+		for _, item := range batch[:batchSize] {
+			deviceIDs <- item
+		}
+		batchSize = 0
+		goto next
+	}()
+
+	return deviceIDs, nil
+}
+
+func (db *DataStoreMongo) UnsetDevicesGroup(
 	ctx context.Context,
 	deviceIDs []model.DeviceID,
 	group model.GroupName,
@@ -872,56 +1987,993 @@ func (db *DataStoreMongo) UnsetDevicesGroup(
 	database := db.client.Database(mstore.DbFromContext(ctx, DbName))
 	collDevs := database.Collection(DbDevicesColl)
 
-	var filter bson.D
-	// Add filter on device id (either $in or direct indexing)
-	switch len(deviceIDs) {
-	case 0:
-		return &model.UpdateResult{}, nil
-	case 1:
-		filter = bson.D{{Key: DbDevId, Value: deviceIDs[0]}}
-	default:
-		filter = bson.D{{Key: DbDevId, Value: bson.M{"$in": deviceIDs}}}
+	if len(deviceIDs) == 0 {
+		return &model.UpdateResult{}, nil
+	}
+	filter := makeDevicesInGroupFilter(deviceIDs, group)
+	// Create unset operation on group attribute
+	update := bson.M{
+		"$unset": bson.M{
+			DbDevAttributesGroup: "",
+		},
+	}
+	res, err := collDevs.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return nil, err
+	}
+	return &model.UpdateResult{
+		MatchedCount: res.MatchedCount,
+		UpdatedCount: res.ModifiedCount,
+	}, nil
+}
+
+func (db *DataStoreMongo) CountDevicesInGroup(
+	ctx context.Context,
+	deviceIDs []model.DeviceID,
+	group model.GroupName,
+) (int64, error) {
+	database := db.client.Database(mstore.DbFromContext(ctx, DbName))
+	collDevs := database.Collection(DbDevicesColl)
+
+	if len(deviceIDs) == 0 {
+		return 0, nil
+	}
+	return collDevs.CountDocuments(ctx, makeDevicesInGroupFilter(deviceIDs, group))
+}
+
+// makeDevicesInGroupFilter matches the devices among deviceIDs which are
+// in the group
+func makeDevicesInGroupFilter(deviceIDs []model.DeviceID, group model.GroupName) bson.D {
+	var filter bson.D
+	// Add filter on device id (either $in or direct indexing)
+	if len(deviceIDs) == 1 {
+		filter = bson.D{{Key: DbDevId, Value: deviceIDs[0]}}
+	} else {
+		filter = bson.D{{Key: DbDevId, Value: bson.M{"$in": deviceIDs}}}
+	}
+	// Append filter on group
+	return append(
+		filter,
+		bson.E{Key: DbDevAttributesGroupValue, Value: group},
+	)
+}
+
+func predicateToQuery(pred model.FilterPredicate) (bson.D, error) {
+	if err := pred.Validate(); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf(
+		"%s.%s-%s.value",
+		DbDevAttributes,
+		pred.Scope,
+		model.GetDeviceAttributeNameReplacer().Replace(pred.Attribute),
+	)
+	if pred.Path != "" {
+		name += "." + pred.Path
+	}
+	return bson.D{{Key: name, Value: makeFilterCondition(pred)}}, nil
+}
+
+// makeFilterCondition returns the condition on the attribute value of
+// the filter predicate; prefixes are matched by an anchored regular
+// expression, which can use the indexes.
+func makeFilterCondition(filter model.FilterPredicate) bson.M {
+	switch filter.Type {
+	case model.FilterTypePrefix:
+		prefix, _ := filter.Value.(string)
+		return bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}
+	case model.FilterTypeRegex:
+		// the values of other types never match, but the strings of
+		// arrays do
+		cond := bson.M{"$regex": filter.Value, "$type": "string"}
+		if filter.Options != "" {
+			cond["$options"] = filter.Options
+		}
+		return cond
+	case model.FilterTypeExclude:
+		return bson.M{"$exists": true, "$nin": filter.Value}
+	}
+	if filter.IsRange() && isSystemTimestamp(filter.Scope, filter.Attribute) {
+		// the system timestamps are stored as dates
+		if s, ok := filter.Value.(string); ok {
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				return bson.M{filter.Type: t}
+			}
+		}
+	}
+	return bson.M{filter.Type: filter.Value}
+}
+
+func isSystemTimestamp(scope, name string) bool {
+	return scope == model.AttrScopeSystem &&
+		(name == model.AttrNameCreated || name == model.AttrNameUpdated)
+}
+
+// mergeRangeCondition adds the bound of the range filter on the field to
+// the condition of a previous range filter on the same field, returning
+// false if there is none or it already has the same bound; the conditions
+// of the first range filters on the fields are recorded in ranges.
+func mergeRangeCondition(
+	ranges map[string]bson.M,
+	field string,
+	filter model.FilterPredicate,
+	cond bson.M,
+) bool {
+	if !filter.IsRange() {
+		return false
+	}
+	prev, ok := ranges[field]
+	if !ok {
+		ranges[field] = cond
+		return false
+	} else if _, dup := prev[filter.Type]; dup {
+		return false
+	}
+	prev[filter.Type] = cond[filter.Type]
+	return true
+}
+
+// checkRegexFilters returns ErrRegexNonString if any of the $regex
+// filters applies to an attribute known not to hold strings, i.e. the
+// system timestamps; on other attributes, the $regex filters match the
+// string values only.
+func checkRegexFilters(filters []model.FilterPredicate) error {
+	for _, filter := range filters {
+		if filter.Type != model.FilterTypeRegex || filter.Ref != nil {
+			continue
+		}
+		if isSystemTimestamp(filter.Scope, filter.Attribute) {
+			return errors.Wrapf(store.ErrRegexNonString,
+				"attribute %s/%s", filter.Scope, filter.Attribute)
+		}
+	}
+	return nil
+}
+
+func (db *DataStoreMongo) FacetByAttributeFiltered(
+	ctx context.Context,
+	scope string,
+	name string,
+	filters []model.FilterPredicate,
+) ([]model.AttributeValueCount, error) {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	field := makeAttrField(name, scope, DbDevAttributesValue)
+	queryFilters := []bson.M{{field: bson.M{"$exists": true}}}
+	for _, filter := range filters {
+		if err := filter.Validate(); err != nil {
+			return nil, err
+		}
+		query, err := makeSearchFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		queryFilters = append(queryFilters, query)
+	}
+
+	return countAttributeValues(ctx, c, bson.M{"$and": queryFilters}, field, 0)
+}
+
+func (db *DataStoreMongo) TopAttributeValues(
+	ctx context.Context,
+	scope string,
+	name string,
+	limit int,
+) ([]model.AttributeValueCount, error) {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	field := makeAttrField(name, scope, DbDevAttributesValue)
+	return countAttributeValues(ctx, c,
+		bson.M{field: bson.M{"$exists": true}}, field, limit)
+}
+
+func (db *DataStoreMongo) AttributeCardinality(
+	ctx context.Context,
+	scope string,
+	name string,
+) (int, error) {
+	const cardinality = "cardinality"
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	field := makeAttrField(name, scope, DbDevAttributesValue)
+	cur, err := c.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{field: bson.M{"$exists": true}}},
+		{"$project": bson.M{DbDevAttributesValue: "$" + field}},
+		// count each element of array values separately
+		{"$unwind": "$" + DbDevAttributesValue},
+		{"$group": bson.M{DbDevId: "$" + DbDevAttributesValue}},
+		{"$count": cardinality},
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	var results []struct {
+		Cardinality int `bson:"cardinality"`
+	}
+	if err := cur.All(ctx, &results); err != nil {
+		return -1, err
+	}
+	// $count outputs no document if there are no values
+	if len(results) == 0 {
+		return 0, nil
+	}
+	return results[0].Cardinality, nil
+}
+
+func (db *DataStoreMongo) CountDevicesByAttribute(
+	ctx context.Context,
+) ([]model.AttributeCoverage, int, error) {
+	const (
+		attrs  = "attrs"
+		counts = "counts"
+		total  = "total"
+	)
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	cur, err := c.Aggregate(ctx, []bson.M{
+		{"$facet": bson.M{
+			total: bson.A{bson.M{"$count": total}},
+			counts: bson.A{
+				// the set union counts each attribute once per device
+				// even if it's stored under several keys
+				bson.M{"$project": bson.M{attrs: bson.M{"$setUnion": bson.A{
+					bson.M{"$map": bson.M{
+						"input": bson.M{"$objectToArray": bson.M{
+							"$ifNull": bson.A{"$" + DbDevAttributes, bson.M{}},
+						}},
+						"in": bson.M{
+							DbDevAttributesScope: "$$this.v." + DbDevAttributesScope,
+							DbDevAttributesName:  "$$this.v." + DbDevAttributesName,
+						},
+					}},
+				}}}},
+				bson.M{"$unwind": "$" + attrs},
+				bson.M{"$group": bson.M{
+					DbDevId: "$" + attrs,
+					"count": bson.M{"$sum": 1},
+				}},
+				bson.M{"$project": bson.M{
+					DbDevId:              0,
+					DbDevAttributesName:  "$" + DbDevId + "." + DbDevAttributesName,
+					DbDevAttributesScope: "$" + DbDevId + "." + DbDevAttributesScope,
+					"count":              1,
+				}},
+				bson.M{"$sort": bson.D{
+					{Key: DbDevAttributesScope, Value: 1},
+					{Key: DbDevAttributesName, Value: 1},
+				}},
+			},
+		}},
+	})
+	if err != nil {
+		return nil, -1, err
+	}
+
+	var results []struct {
+		Total []struct {
+			Total int `bson:"total"`
+		} `bson:"total"`
+		Counts []model.AttributeCoverage `bson:"counts"`
+	}
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, -1, err
+	}
+	// $count outputs no document if there are no devices
+	if len(results) == 0 || len(results[0].Total) == 0 {
+		return []model.AttributeCoverage{}, 0, nil
+	}
+	return results[0].Counts, results[0].Total[0].Total, nil
+}
+
+func (db *DataStoreMongo) GetAttributeScopes(ctx context.Context) ([]string, error) {
+	const scopes = "scopes"
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	// the attributes are keyed by their scope and name, joined by a dash
+	cur, err := c.Aggregate(ctx, []bson.M{
+		{"$project": bson.M{scopes: bson.M{"$map": bson.M{
+			"input": bson.M{"$objectToArray": bson.M{
+				"$ifNull": bson.A{"$" + DbDevAttributes, bson.M{}},
+			}},
+			"in": bson.M{"$arrayElemAt": bson.A{
+				bson.M{"$split": bson.A{"$$this.k", "-"}}, 0,
+			}},
+		}}}},
+		{"$unwind": "$" + scopes},
+		{"$group": bson.M{DbDevId: "$" + scopes}},
+		{"$sort": bson.M{DbDevId: 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		Scope string `bson:"_id"`
+	}
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	res := make([]string, len(results))
+	for i, result := range results {
+		res[i] = result.Scope
+	}
+	return res, nil
+}
+
+// countAttributeValues counts the devices matching the query by the values
+// of the attribute field, sorted by decreasing count; a positive limit
+// keeps only the most frequent values
+func countAttributeValues(
+	ctx context.Context,
+	c *mongo.Collection,
+	match bson.M,
+	field string,
+	limit int,
+) ([]model.AttributeValueCount, error) {
+	const count = "count"
+
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$project": bson.M{DbDevAttributesValue: "$" + field}},
+		// count each element of array values separately
+		{"$unwind": "$" + DbDevAttributesValue},
+		{"$group": bson.M{
+			DbDevId: "$" + DbDevAttributesValue,
+			count:   bson.M{"$sum": 1},
+		}},
+		{"$sort": bson.D{
+			{Key: count, Value: -1},
+			{Key: DbDevId, Value: 1},
+		}},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": limit})
+	}
+	cur, err := c.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := []model.AttributeValueCount{}
+	if err := cur.All(ctx, &buckets); err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
+
+func (db *DataStoreMongo) IncrementAttributesChurn(
+	ctx context.Context,
+	attrs model.DeviceAttributes,
+) error {
+	if len(attrs) == 0 {
+		return nil
+	}
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbAttributesChurnColl)
+
+	models := make([]mongo.WriteModel, len(attrs))
+	for i, attr := range attrs {
+		models[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{DbDevId: attr.Scope + "-" + attr.Name}).
+			SetUpdate(bson.M{
+				"$inc": bson.M{DbAttributesChurnCount: 1},
+				"$setOnInsert": bson.M{
+					DbDevAttributesScope: attr.Scope,
+					DbDevAttributesName:  attr.Name,
+				},
+			}).
+			SetUpsert(true)
+	}
+	_, err := c.BulkWrite(ctx, models, mopts.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (db *DataStoreMongo) GetAttributesChurn(
+	ctx context.Context,
+) ([]model.AttributeChurn, error) {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbAttributesChurnColl)
+
+	cur, err := c.Find(ctx, bson.M{}, mopts.Find().SetSort(bson.D{
+		{Key: DbAttributesChurnCount, Value: -1},
+		{Key: DbDevAttributesScope, Value: 1},
+		{Key: DbDevAttributesName, Value: 1},
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	churn := []model.AttributeChurn{}
+	if err := cur.All(ctx, &churn); err != nil {
+		return nil, err
+	}
+	return churn, nil
+}
+
+// the feature flags of a tenant are stored in a single document
+const featureFlagsDocID = "feature_flags"
+
+func (db *DataStoreMongo) GetFeatureFlags(ctx context.Context) (model.FeatureFlags, error) {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbFeatureFlagsColl)
+
+	var doc struct {
+		Flags model.FeatureFlags `bson:"flags"`
+	}
+	err := c.FindOne(ctx, bson.M{DbDevId: featureFlagsDocID}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return model.FeatureFlags{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if doc.Flags == nil {
+		doc.Flags = model.FeatureFlags{}
+	}
+	return doc.Flags, nil
+}
+
+func (db *DataStoreMongo) SetFeatureFlags(
+	ctx context.Context,
+	flags model.FeatureFlags,
+) error {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbFeatureFlagsColl)
+
+	if flags == nil {
+		flags = model.FeatureFlags{}
+	}
+	_, err := c.ReplaceOne(ctx,
+		bson.M{DbDevId: featureFlagsDocID},
+		bson.M{"flags": flags},
+		mopts.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+func (db *DataStoreMongo) GetIngestHash(
+	ctx context.Context,
+	id model.DeviceID,
+) (string, error) {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbIngestHashesColl)
+
+	// the TTL monitor removes the expired documents only periodically
+	var res struct {
+		Hash string `bson:"hash"`
+	}
+	err := c.FindOne(ctx, bson.M{
+		DbDevId:              id,
+		DbIngestHashExpireTs: bson.M{"$gt": time.Now()},
+	}).Decode(&res)
+	if err == mongo.ErrNoDocuments {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return res.Hash, nil
+}
+
+func (db *DataStoreMongo) SetIngestHash(
+	ctx context.Context,
+	id model.DeviceID,
+	hash string,
+	expire time.Time,
+) error {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbIngestHashesColl)
+
+	_, err := c.UpdateOne(ctx,
+		bson.M{DbDevId: id},
+		bson.M{"$set": bson.M{
+			DbIngestHash:         hash,
+			DbIngestHashExpireTs: expire,
+		}},
+		mopts.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (db *DataStoreMongo) CreateSavedFilter(
+	ctx context.Context,
+	filter *model.SavedFilter,
+) error {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbSavedFiltersColl)
+
+	_, err := c.InsertOne(ctx, filter)
+	return err
+}
+
+func (db *DataStoreMongo) GetSavedFilter(
+	ctx context.Context,
+	id string,
+) (*model.SavedFilter, error) {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbSavedFiltersColl)
+
+	filter := &model.SavedFilter{}
+	err := c.FindOne(ctx, bson.M{DbDevId: id}).Decode(filter)
+	if err == mongo.ErrNoDocuments {
+		return nil, store.ErrFilterNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+func (db *DataStoreMongo) ListSavedFilters(ctx context.Context) ([]model.SavedFilter, error) {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbSavedFiltersColl)
+
+	cur, err := c.Find(ctx, bson.M{},
+		mopts.Find().SetSort(bson.D{
+			{Key: "name", Value: 1},
+			{Key: DbDevId, Value: 1},
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	filters := []model.SavedFilter{}
+	if err := cur.All(ctx, &filters); err != nil {
+		return nil, err
+	}
+	return filters, nil
+}
+
+func (db *DataStoreMongo) UpdateSavedFilter(
+	ctx context.Context,
+	filter *model.SavedFilter,
+) error {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbSavedFiltersColl)
+
+	res, err := c.ReplaceOne(ctx, bson.M{DbDevId: filter.ID}, filter)
+	if err != nil {
+		return err
+	} else if res.MatchedCount == 0 {
+		return store.ErrFilterNotFound
+	}
+	return nil
+}
+
+func (db *DataStoreMongo) DeleteSavedFilter(ctx context.Context, id string) error {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbSavedFiltersColl)
+
+	res, err := c.DeleteOne(ctx, bson.M{DbDevId: id})
+	if err != nil {
+		return err
+	} else if res.DeletedCount == 0 {
+		return store.ErrFilterNotFound
+	}
+	return nil
+}
+
+func (db *DataStoreMongo) FindDevicesByAttributeValues(
+	ctx context.Context,
+	scope string,
+	name string,
+	values []interface{},
+) ([]model.Device, error) {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	devices := []model.Device{}
+	if len(values) == 0 {
+		return devices, nil
+	}
+	field := makeSearchAttrField(scope, name)
+	cur, err := c.Find(ctx,
+		bson.M{field: bson.M{"$in": values}},
+		mopts.Find().SetSort(bson.D{{Key: DbDevId, Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := cur.All(ctx, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+func (db *DataStoreMongo) FindDevicesWithAttributeDrift(
+	ctx context.Context,
+	scope string,
+	name string,
+	value interface{},
+) ([]model.Device, error) {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	field := makeSearchAttrField(scope, name)
+	cur, err := c.Find(ctx,
+		bson.M{field: bson.M{"$exists": true, "$ne": value}},
+		mopts.Find().SetSort(bson.D{{Key: DbDevId, Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	devices := []model.Device{}
+	if err := cur.All(ctx, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+func (db *DataStoreMongo) FindDevicesByAttributeSet(
+	ctx context.Context,
+	scope string,
+	attrs model.DeviceAttributes,
+) ([]model.Device, error) {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	// each attribute must match, and the number of attributes in the
+	// scope must equal the size of the set to rule out the extra ones
+	filter := bson.M{
+		"$expr": bson.M{"$eq": bson.A{
+			bson.M{"$size": bson.M{"$filter": bson.M{
+				"input": bson.M{"$objectToArray": bson.M{
+					"$ifNull": bson.A{"$" + DbDevAttributes, bson.M{}},
+				}},
+				"cond": bson.M{"$eq": bson.A{
+					"$$this.v." + DbDevAttributesScope, scope,
+				}},
+			}}},
+			len(attrs),
+		}},
+	}
+	for _, attr := range attrs {
+		filter[makeAttrField(attr.Name, scope, DbDevAttributesValue)] = attr.Value
+	}
+	cur, err := c.Find(ctx, filter,
+		mopts.Find().SetSort(bson.D{{Key: DbDevId, Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	devices := []model.Device{}
+	if err := cur.All(ctx, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+func (db *DataStoreMongo) GetDevicesWithStaleScope(
+	ctx context.Context,
+	scope string,
+	olderThan time.Duration,
+) ([]model.Device, error) {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	field := DbDevScopesUpdatedTs + "." + scope
+	cur, err := c.Find(ctx,
+		bson.M{field: bson.M{"$lt": time.Now().Add(-olderThan)}},
+		mopts.Find().SetSort(bson.D{
+			{Key: field, Value: 1},
+			{Key: DbDevId, Value: 1},
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	devices := []model.Device{}
+	if err := cur.All(ctx, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+func (db *DataStoreMongo) GetDevicesUpdatedByScopeSince(
+	ctx context.Context,
+	scope string,
+	since time.Time,
+) ([]model.Device, error) {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	field := DbDevScopesUpdatedTs + "." + scope
+	cur, err := c.Find(ctx,
+		bson.M{field: bson.M{"$gt": since}},
+		mopts.Find().SetSort(bson.D{
+			{Key: field, Value: 1},
+			{Key: DbDevId, Value: 1},
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	devices := []model.Device{}
+	if err := cur.All(ctx, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+func (db *DataStoreMongo) GetDevicesAttributesCount(
+	ctx context.Context,
+	ids []model.DeviceID,
+) (map[model.DeviceID]int, error) {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	counts := make(map[model.DeviceID]int, len(ids))
+	if len(ids) == 0 {
+		return counts, nil
+	}
+	cur, err := c.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{DbDevId: bson.M{"$in": ids}}},
+		{"$project": bson.M{
+			"count": bson.M{"$size": bson.M{"$objectToArray": bson.M{
+				"$ifNull": bson.A{"$" + DbDevAttributes, bson.M{}},
+			}}},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		ID    model.DeviceID `bson:"_id"`
+		Count int            `bson:"count"`
+	}
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	for _, res := range results {
+		counts[res.ID] = res.Count
+	}
+	return counts, nil
+}
+
+func (db *DataStoreMongo) SampleDevices(
+	ctx context.Context,
+	n int,
+	filters []model.FilterPredicate,
+) ([]model.Device, error) {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	query, err := makeSearchQuery(model.SearchParams{Filters: filters}, nil)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := c.Aggregate(ctx, []bson.M{
+		{"$match": query},
+		{"$sample": bson.M{"size": n}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	devices := []model.Device{}
+	if err := cur.All(ctx, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+func (db *DataStoreMongo) GetAttributesPresence(
+	ctx context.Context,
+	ids []model.DeviceID,
+	attributes []model.SelectAttribute,
+) (map[model.DeviceID][]bool, error) {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	presence := make(map[model.DeviceID][]bool, len(ids))
+	if len(ids) == 0 {
+		return presence, nil
 	}
-	// Append filter on group
-	filter = append(
-		filter,
-		bson.E{Key: DbDevAttributesGroupValue, Value: group},
-	)
-	// Create unset operation on group attribute
-	update := bson.M{
-		"$unset": bson.M{
-			DbDevAttributesGroup: "",
-		},
+	present := make(bson.A, len(attributes))
+	for i, attr := range attributes {
+		present[i] = bson.M{"$ne": bson.A{
+			bson.M{"$type": "$" + makeAttrField(attr.Attribute, attr.Scope)},
+			"missing",
+		}}
 	}
-	res, err := collDevs.UpdateMany(ctx, filter, update)
+	cur, err := c.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{DbDevId: bson.M{"$in": ids}}},
+		{"$project": bson.M{"present": present}},
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &model.UpdateResult{
-		MatchedCount: res.MatchedCount,
-		UpdatedCount: res.ModifiedCount,
-	}, nil
+
+	var results []struct {
+		ID      model.DeviceID `bson:"_id"`
+		Present []bool         `bson:"present"`
+	}
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	for _, res := range results {
+		presence[res.ID] = res.Present
+	}
+	return presence, nil
 }
 
-func predicateToQuery(pred model.FilterPredicate) (bson.D, error) {
-	if err := pred.Validate(); err != nil {
+func (db *DataStoreMongo) GetDevicesStatuses(
+	ctx context.Context,
+	ids []model.DeviceID,
+) (map[model.DeviceID]*string, error) {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	statuses := make(map[model.DeviceID]*string, len(ids))
+	if len(ids) == 0 {
+		return statuses, nil
+	}
+	const statusValue = DbDevAttributes + "." + attrIdentityStatus + "." +
+		DbDevAttributesValue
+	cur, err := c.Find(ctx,
+		bson.M{DbDevId: bson.M{"$in": ids}},
+		mopts.Find().SetProjection(bson.M{statusValue: 1}),
+	)
+	if err != nil {
 		return nil, err
 	}
-	name := fmt.Sprintf(
-		"%s.%s-%s.value",
-		DbDevAttributes,
-		pred.Scope,
-		model.GetDeviceAttributeNameReplacer().Replace(pred.Attribute),
+
+	var results []struct {
+		ID         model.DeviceID `bson:"_id"`
+		Attributes struct {
+			Status struct {
+				Value *string `bson:"value"`
+			} `bson:"identity-status"`
+		} `bson:"attributes"`
+	}
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	for _, res := range results {
+		statuses[res.ID] = res.Attributes.Status.Value
+	}
+	return statuses, nil
+}
+
+func (db *DataStoreMongo) CountDevicesCreatedPerDay(
+	ctx context.Context,
+	from, to time.Time,
+) (map[time.Time]int, error) {
+	const (
+		dayFormat    = "%Y-%m-%d"
+		createdValue = DbDevAttributes + "." + model.AttrScopeSystem + "-" +
+			model.AttrNameCreated + "." + DbDevAttributesValue
 	)
-	return bson.D{{
-		Key: name, Value: bson.D{{Key: pred.Type, Value: pred.Value}},
-	}}, nil
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			createdValue: bson.M{"$gte": from, "$lt": to},
+		}},
+		{"$group": bson.M{
+			"_id": bson.M{"$dateToString": bson.M{
+				"format":   dayFormat,
+				"date":     "$" + createdValue,
+				"timezone": "UTC",
+			}},
+			"count": bson.M{"$sum": 1},
+		}},
+	}
+	cur, err := c.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		Day   string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	counts := make(map[time.Time]int, len(results))
+	for _, res := range results {
+		day, err := time.Parse("2006-01-02", res.Day)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse the day")
+		}
+		counts[day] = res.Count
+	}
+	return counts, nil
+}
+
+func (db *DataStoreMongo) CountDevicesByAlertCount(
+	ctx context.Context,
+	scope string,
+) (map[string]int, error) {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	alertCountValue := DbDevAttributes + "." + scope + "-" +
+		model.AttrNameNumberOfAlerts + "." + DbDevAttributesValue
+	pipeline := []bson.M{
+		{"$bucket": bson.M{
+			"groupBy": bson.M{
+				"$ifNull": bson.A{"$" + alertCountValue, 0},
+			},
+			"boundaries": bson.A{0, 1, 6},
+			"default":    model.AlertCountBucketMany,
+			"output":     bson.M{"count": bson.M{"$sum": 1}},
+		}},
+	}
+	cur, err := c.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		Bucket interface{} `bson:"_id"`
+		Count  int         `bson:"count"`
+	}
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	// the buckets are identified by their lower boundary, but for the
+	// default one
+	bucketsByBoundary := map[int64]string{
+		0: model.AlertCountBucketNone,
+		1: model.AlertCountBucketFew,
+	}
+	counts := make(map[string]int, len(results))
+	for _, res := range results {
+		bucket := model.AlertCountBucketMany
+		switch boundary := res.Bucket.(type) {
+		case int32:
+			bucket = bucketsByBoundary[int64(boundary)]
+		case int64:
+			bucket = bucketsByBoundary[boundary]
+		}
+		counts[bucket] += res.Count
+	}
+	return counts, nil
 }
 
 func (db *DataStoreMongo) ListGroups(
 	ctx context.Context,
 	filters []model.FilterPredicate,
-) ([]model.GroupName, error) {
+	skip int,
+	limit int,
+) ([]model.GroupName, int, error) {
+	const (
+		groups = "groups"
+		total  = "total"
+	)
 	c := db.client.
 		Database(mstore.DbFromContext(ctx, DbName)).
 		Collection(DbDevicesColl)
@@ -930,36 +2982,302 @@ func (db *DataStoreMongo) ListGroups(
 		Key: DbDevAttributesGroupValue, Value: bson.M{"$exists": true},
 	}}
 	if len(fltr) > 0 {
+		ranges := map[string]bson.M{}
 		for _, p := range filters {
 			q, err := predicateToQuery(p)
 			if err != nil {
-				return nil, errors.Wrap(
+				return nil, -1, errors.Wrap(
 					err, "store: bad filter predicate",
 				)
 			}
+			if mergeRangeCondition(ranges, q[0].Key, p, q[0].Value.(bson.M)) {
+				continue
+			}
 			fltr = append(fltr, q...)
 		}
 	}
-	results, err := c.Distinct(
-		ctx, DbDevAttributesGroupValue, fltr,
-	)
+
+	page := bson.A{bson.M{"$skip": skip}}
+	if limit > 0 {
+		page = append(page, bson.M{"$limit": limit})
+	}
+	cur, err := c.Aggregate(ctx, []bson.M{
+		{"$match": fltr},
+		{"$group": bson.M{DbDevId: "$" + DbDevAttributesGroupValue}},
+		// sorting by name keeps the pages stable
+		{"$sort": bson.M{DbDevId: 1}},
+		{"$facet": bson.M{
+			total:  bson.A{bson.M{"$count": total}},
+			groups: page,
+		}},
+	})
+	if err != nil {
+		return nil, -1, err
+	}
+
+	var results []struct {
+		Total []struct {
+			Total int `bson:"total"`
+		} `bson:"total"`
+		Groups []struct {
+			Name model.GroupName `bson:"_id"`
+		} `bson:"groups"`
+	}
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, -1, err
+	}
+	// $count outputs no document if there are no groups
+	if len(results) == 0 || len(results[0].Total) == 0 {
+		return []model.GroupName{}, 0, nil
+	}
+
+	names := make([]model.GroupName, len(results[0].Groups))
+	for i, g := range results[0].Groups {
+		names[i] = g.Name
+	}
+	return names, results[0].Total[0].Total, nil
+}
+
+func (db *DataStoreMongo) GetDevicesDistinctGroups(
+	ctx context.Context,
+	ids []model.DeviceID,
+) ([]model.GroupName, error) {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	if len(ids) == 0 {
+		return []model.GroupName{}, nil
+	}
+	cur, err := c.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{DbDevId: bson.M{"$in": ids}}},
+		// devices without a group are grouped under null
+		{"$group": bson.M{"_id": "$" + DbDevAttributesGroupValue}},
+		{"$sort": bson.M{"_id": 1}},
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	var results []struct {
+		Group *model.GroupName `bson:"_id"`
+	}
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
 	groups := make([]model.GroupName, len(results))
-	for i, d := range results {
-		groups[i] = model.GroupName(d.(string))
+	for i, res := range results {
+		if res.Group != nil {
+			groups[i] = *res.Group
+		}
 	}
 	return groups, nil
 }
 
+func (db *DataStoreMongo) WithAdminAccess() store.DataStore {
+	dup := *db
+	dup.adminAccess = true
+	return &dup
+}
+
+func (db *DataStoreMongo) StreamAllDevicesAcrossTenants(
+	ctx context.Context,
+	fn func(model.TenantDevice) error,
+) error {
+	if !db.adminAccess {
+		return store.ErrAdminAccessRequired
+	}
+
+	dbs, err := migrate.GetTenantDbs(ctx, db.client, mstore.IsTenantDb(DbName))
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve tenant DBs")
+	}
+	// the tenant-less database is not a tenant DB, but its devices count
+	dbs = append([]string{DbName}, dbs...)
+
+	for _, d := range dbs {
+		tenantID := mstore.TenantFromDbName(d, DbName)
+		if err := db.streamDevices(ctx, d, tenantID, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamDevices calls fn with each device of the database labeled with
+// the tenant ID
+func (db *DataStoreMongo) streamDevices(
+	ctx context.Context,
+	database string,
+	tenantID string,
+	fn func(model.TenantDevice) error,
+) error {
+	cursor, err := db.client.
+		Database(database).
+		Collection(DbDevicesColl).
+		Find(ctx, bson.M{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to list the devices of tenant %q", tenantID)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var device model.Device
+		if err := cursor.Decode(&device); err != nil {
+			return errors.Wrapf(err, "failed to decode device of tenant %q", tenantID)
+		}
+		if err := fn(model.TenantDevice{TenantID: tenantID, Device: device}); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return errors.Wrapf(err, "failed to list the devices of tenant %q", tenantID)
+	}
+	return nil
+}
+
+func (db *DataStoreMongo) PurgeScopeByRetention(
+	ctx context.Context,
+	scope string,
+	retention time.Duration,
+	tenantIDs ...string,
+) (int, error) {
+	if scope == model.AttrScopeIdentity || scope == model.AttrScopeSystem {
+		return 0, store.ErrScopeNotPurgeable
+	}
+	l := log.FromContext(ctx)
+
+	if len(tenantIDs) == 0 {
+		dbs, err := migrate.GetTenantDbs(ctx, db.client, mstore.IsTenantDb(DbName))
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to retrieve tenant DBs")
+		}
+		if len(dbs) == 0 {
+			dbs = []string{DbName}
+		}
+		for _, d := range dbs {
+			tenantIDs = append(tenantIDs, mstore.TenantFromDbName(d, DbName))
+		}
+	}
+
+	cutoff := time.Now().Add(-retention)
+	total := 0
+	for _, tenantID := range tenantIDs {
+		tenantCtx := identity.WithContext(ctx, &identity.Identity{
+			Tenant: tenantID,
+		})
+		purged, err := db.purgeScopeAttributes(tenantCtx, scope, cutoff)
+		total += purged
+		if err != nil {
+			return total, errors.Wrapf(err,
+				"failed to purge the attributes of tenant %q", tenantID)
+		}
+		l.Infof("purged the %s attributes of %d devices of tenant %q",
+			scope, purged, tenantID)
+	}
+	return total, nil
+}
+
+// purgeScopeAttributes removes the attributes of the scope with a timestamp
+// before the cutoff from the devices of the tenant, in batches of
+// purgeBatchSize devices, and returns the number of devices purged
+func (db *DataStoreMongo) purgeScopeAttributes(
+	ctx context.Context,
+	scope string,
+	cutoff time.Time,
+) (int, error) {
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+
+	// the timestamp must be a date as missing values compare lower than
+	// any date
+	expired := bson.M{"$and": bson.A{
+		bson.M{"$eq": bson.A{"$$this.v." + DbDevAttributesScope, scope}},
+		bson.M{"$eq": bson.A{
+			bson.M{"$type": "$$this.v." + DbDevAttributesTs}, "date",
+		}},
+		bson.M{"$lt": bson.A{"$$this.v." + DbDevAttributesTs, cutoff}},
+	}}
+	update := bson.A{
+		bson.M{"$set": bson.M{
+			DbDevAttributes: bson.M{"$arrayToObject": bson.M{"$filter": bson.M{
+				"input": bson.M{"$objectToArray": bson.M{
+					"$ifNull": bson.A{"$" + DbDevAttributes, bson.M{}},
+				}},
+				"cond": bson.M{"$not": bson.A{expired}},
+			}}},
+		}},
+	}
+
+	findOptions := mopts.Find().
+		SetProjection(bson.M{DbDevId: 1}).
+		SetSort(bson.M{DbDevId: 1}).
+		SetLimit(purgeBatchSize)
+	filter := bson.M{}
+	purged := 0
+	for {
+		cursor, err := c.Find(ctx, filter, findOptions)
+		if err != nil {
+			return purged, err
+		}
+		var devices []model.Device
+		if err = cursor.All(ctx, &devices); err != nil {
+			return purged, err
+		}
+		if len(devices) == 0 {
+			return purged, nil
+		}
+		ids := make([]model.DeviceID, len(devices))
+		for i, dev := range devices {
+			ids[i] = dev.ID
+		}
+		res, err := c.UpdateMany(ctx, bson.M{DbDevId: bson.M{"$in": ids}}, update)
+		if err != nil {
+			return purged, err
+		}
+		purged += int(res.ModifiedCount)
+		filter = bson.M{DbDevId: bson.M{"$gt": ids[len(ids)-1]}}
+	}
+}
+
 func (db *DataStoreMongo) GetDevicesByGroup(
 	ctx context.Context,
 	group model.GroupName,
 	skip,
 	limit int,
 ) ([]model.DeviceID, int, error) {
+	devices, totalDevices, err := db.listGroupDevices(ctx, group, skip, limit, nil)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	resIds := make([]model.DeviceID, len(devices))
+	for i, d := range devices {
+		resIds[i] = d.ID
+	}
+	return resIds, totalDevices, nil
+}
+
+func (db *DataStoreMongo) GetDevicesByGroupWithAttributes(
+	ctx context.Context,
+	group model.GroupName,
+	skip,
+	limit int,
+	attributes []model.SelectAttribute,
+) ([]model.Device, int, error) {
+	return db.listGroupDevices(ctx, group, skip, limit, attributes)
+}
+
+// listGroupDevices lists the devices of the group, with all their
+// attributes if attributes is empty
+func (db *DataStoreMongo) listGroupDevices(
+	ctx context.Context,
+	group model.GroupName,
+	skip,
+	limit int,
+	attributes []model.SelectAttribute,
+) ([]model.Device, int, error) {
 	c := db.client.
 		Database(mstore.DbFromContext(ctx, DbName)).
 		Collection(DbDevicesColl)
@@ -979,21 +3297,17 @@ func (db *DataStoreMongo) GetDevicesByGroup(
 	hasGroup := group != ""
 	devices, totalDevices, e := db.GetDevices(ctx,
 		store.ListQuery{
-			Skip:      skip,
-			Limit:     limit,
-			Filters:   nil,
-			Sort:      nil,
-			HasGroup:  &hasGroup,
-			GroupName: string(group)})
+			Skip:       skip,
+			Limit:      limit,
+			Filters:    nil,
+			Sort:       nil,
+			HasGroup:   &hasGroup,
+			GroupName:  string(group),
+			Attributes: attributes})
 	if e != nil {
 		return nil, -1, errors.Wrap(e, "failed to get device list for group")
 	}
-
-	resIds := make([]model.DeviceID, len(devices))
-	for i, d := range devices {
-		resIds[i] = d.ID
-	}
-	return resIds, totalDevices, nil
+	return devices, totalDevices, nil
 }
 
 func (db *DataStoreMongo) GetDeviceGroup(
@@ -1008,6 +3322,42 @@ func (db *DataStoreMongo) GetDeviceGroup(
 	return dev.Group, nil
 }
 
+// GetGroupSiblings returns the devices sharing the group of the device,
+// sorted by ID and leaving the device itself out
+func (db *DataStoreMongo) GetGroupSiblings(
+	ctx context.Context,
+	id model.DeviceID,
+) ([]model.Device, error) {
+	dev, err := db.GetDevice(ctx, id)
+	if err != nil {
+		return nil, err
+	} else if dev == nil {
+		return nil, store.ErrDevNotFound
+	}
+
+	devices := []model.Device{}
+	if dev.Group == "" {
+		return devices, nil
+	}
+	c := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl)
+	cursor, err := c.Find(ctx,
+		bson.D{
+			{Key: DbDevAttributesGroupValue, Value: dev.Group},
+			{Key: DbDevId, Value: bson.M{"$ne": id}},
+		},
+		mopts.Find().SetSort(bson.D{{Key: DbDevId, Value: 1}}),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch the group siblings")
+	}
+	if err = cursor.All(ctx, &devices); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch the group siblings")
+	}
+	return devices, nil
+}
+
 func (db *DataStoreMongo) DeleteDevices(
 	ctx context.Context, ids []model.DeviceID,
 ) (*model.UpdateResult, error) {
@@ -1033,7 +3383,10 @@ func (db *DataStoreMongo) DeleteDevices(
 	}, nil
 }
 
-func (db *DataStoreMongo) GetAllAttributeNames(ctx context.Context) ([]string, error) {
+func (db *DataStoreMongo) GetAllAttributeNames(
+	ctx context.Context,
+	excludeSystem bool,
+) ([]string, error) {
 	c := db.client.Database(mstore.DbFromContext(ctx, DbName)).Collection(DbDevicesColl)
 
 	project := bson.M{
@@ -1057,12 +3410,18 @@ func (db *DataStoreMongo) GetAllAttributeNames(ctx context.Context) ([]string, e
 		},
 	}
 
+	pipeline := []bson.M{project, unwind}
+	if excludeSystem {
+		pipeline = append(pipeline, bson.M{
+			"$match": bson.M{
+				"arrayofkeyvalue.v.scope": bson.M{"$ne": model.AttrScopeSystem},
+			},
+		})
+	}
+	pipeline = append(pipeline, group)
+
 	l := log.FromContext(ctx)
-	cursor, err := c.Aggregate(ctx, []bson.M{
-		project,
-		unwind,
-		group,
-	})
+	cursor, err := c.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
@@ -1095,29 +3454,39 @@ func (db *DataStoreMongo) GetAllAttributeNames(ctx context.Context) ([]string, e
 	}
 
 	return attributeNames, nil
-}
-
-func (db *DataStoreMongo) SearchDevices(
-	ctx context.Context,
-	searchParams model.SearchParams,
-) ([]model.Device, int, error) {
-	c := db.client.Database(mstore.DbFromContext(ctx, DbName)).Collection(DbDevicesColl)
+}
 
+// makeSearchQuery returns the query matching the filters, device IDs and
+// text of the search; names, if set, are the stored variants of the
+// attribute names matched case-insensitively
+func makeSearchQuery(
+	searchParams model.SearchParams,
+	names map[string][]string,
+) (bson.M, error) {
 	queryFilters := make([]bson.M, 0)
+	ranges := map[string]bson.M{}
 	for _, filter := range searchParams.Filters {
-		op := filter.Type
-		var field string
-		if filter.Scope == model.AttrScopeIdentity && filter.Attribute == model.AttrNameID {
-			field = DbDevId
+		var (
+			query bson.M
+			err   error
+		)
+		if names == nil && filter.IsRange() {
+			field := makeFilterField(filter)
+			cond := makeFilterCondition(filter)
+			if !mergeRangeCondition(ranges, field, filter, cond) {
+				queryFilters = append(queryFilters, bson.M{field: cond})
+			}
+			continue
+		}
+		if names != nil {
+			query, err = makeCaseInsensitiveSearchFilter(filter, names)
 		} else {
-			name := fmt.Sprintf(
-				"%s-%s",
-				filter.Scope,
-				model.GetDeviceAttributeNameReplacer().Replace(filter.Attribute),
-			)
-			field = fmt.Sprintf("%s.%s.%s", DbDevAttributes, name, DbDevAttributesValue)
+			query, err = makeSearchFilter(filter)
+		}
+		if err != nil {
+			return nil, err
 		}
-		queryFilters = append(queryFilters, bson.M{field: bson.M{op: filter.Value}})
+		queryFilters = append(queryFilters, query)
 	}
 
 	// FIXME: remove after migrating ids to attributes
@@ -1137,39 +3506,93 @@ func (db *DataStoreMongo) SearchDevices(
 	if len(queryFilters) > 0 {
 		findQuery["$and"] = queryFilters
 	}
+	return findQuery, nil
+}
 
-	findOptions := mopts.Find()
-	findOptions.SetSkip(int64((searchParams.Page - 1) * searchParams.PerPage))
-	findOptions.SetLimit(int64(searchParams.PerPage))
-
+// makeSearchProjection returns the projection of the attributes selected
+// by the search, nil to return all the attributes
+func makeSearchProjection(searchParams model.SearchParams) bson.M {
+	var projection bson.M
 	if len(searchParams.Attributes) > 0 {
+		projection = makeAttributesProjection(searchParams.Attributes)
+		if len(searchParams.Score) > 0 {
+			projection[DbDevScore] = 1
+		}
+	}
+	return projection
+}
+
+// numericTypes are the BSON types of the attribute values contributing to
+// the composite score
+var numericTypes = bson.A{"double", "int", "long", "decimal"}
+
+// makeScoreStage returns the stage setting the composite score of each
+// device to the weighted sum of the numeric values of the score attributes
+func makeScoreStage(terms []model.ScoreTerm) bson.D {
+	sum := make(bson.A, len(terms))
+	for i, term := range terms {
+		value := "$" + makeAttrField(term.Attribute, term.Scope, DbDevAttributesValue)
+		sum[i] = bson.M{"$multiply": bson.A{
+			term.Weight,
+			bson.M{"$cond": bson.A{
+				bson.M{"$in": bson.A{bson.M{"$type": value}, numericTypes}},
+				value,
+				0,
+			}},
+		}}
+	}
+	return bson.D{{Key: "$addFields", Value: bson.D{
+		{Key: DbDevScore, Value: bson.M{"$add": sum}},
+	}}}
+}
+
+// makeAttributesProjection returns the projection of the devices keeping
+// the given attributes and the updated timestamp
+func makeAttributesProjection(attributes []model.SelectAttribute) bson.M {
+	name := fmt.Sprintf(
+		"%s-%s",
+		model.AttrScopeSystem,
+		model.GetDeviceAttributeNameReplacer().Replace(DbDevUpdatedTs),
+	)
+	field := fmt.Sprintf("%s.%s", DbDevAttributes, name)
+	projection := bson.M{field: 1}
+	for _, attribute := range attributes {
 		name := fmt.Sprintf(
 			"%s-%s",
-			model.AttrScopeSystem,
-			model.GetDeviceAttributeNameReplacer().Replace(DbDevUpdatedTs),
+			attribute.Scope,
+			model.GetDeviceAttributeNameReplacer().Replace(attribute.Attribute),
 		)
 		field := fmt.Sprintf("%s.%s", DbDevAttributes, name)
-		projection := bson.M{field: 1}
-		for _, attribute := range searchParams.Attributes {
-			name := fmt.Sprintf(
-				"%s-%s",
-				attribute.Scope,
-				model.GetDeviceAttributeNameReplacer().Replace(attribute.Attribute),
-			)
-			field := fmt.Sprintf("%s.%s", DbDevAttributes, name)
-			projection[field] = 1
-		}
-		findOptions.SetProjection(projection)
+		projection[field] = 1
 	}
+	return projection
+}
 
+// makeSearchSort returns the sort order of the search results; the sort
+// on the device ID applies at its position among the sort criteria, or
+// after the attribute sorts if sortIDLast is set, and only its first
+// occurrence counts
+func (db *DataStoreMongo) makeSearchSort(searchParams model.SearchParams) bson.D {
+	sortField := bson.D{}
+	sortsById := false
+	var sortById bson.E
 	if searchParams.Text != "" {
-		findOptions.SetSort(bson.M{"score": bson.M{"$meta": "textScore"}})
-	} else if len(searchParams.Sort) > 0 {
-		sortField := make(bson.D, len(searchParams.Sort))
-		for i, sortQ := range searchParams.Sort {
+		sortField = append(sortField,
+			bson.E{Key: "score", Value: bson.M{"$meta": "textScore"}})
+	} else {
+		// the composite score takes precedence over the sort criteria,
+		// which break the ties between equal scores
+		if len(searchParams.Score) > 0 {
+			sortField = append(sortField, bson.E{Key: DbDevScore, Value: -1})
+		}
+		for _, sortQ := range searchParams.Sort {
 			var field string
 			if sortQ.Scope == model.AttrScopeIdentity && sortQ.Attribute == model.AttrNameID {
+				if sortsById {
+					continue
+				}
 				field = DbDevId
+				sortsById = true
 			} else {
 				name := fmt.Sprintf(
 					"%s-%s",
@@ -1178,11 +3601,126 @@ func (db *DataStoreMongo) SearchDevices(
 				)
 				field = fmt.Sprintf("%s.%s.value", DbDevAttributes, name)
 			}
-			sortField[i] = bson.E{Key: field, Value: 1}
+			order := 1
 			if sortQ.Order == "desc" {
-				sortField[i].Value = -1
+				order = -1
+			}
+			if field == DbDevId && db.sortIDLast {
+				sortById = bson.E{Key: field, Value: order}
+				continue
+			}
+			sortField = append(sortField, bson.E{Key: field, Value: order})
+		}
+	}
+	if sortById.Key != "" {
+		sortField = append(sortField, sortById)
+	}
+	// break ties between equal sort values, or order the results when no
+	// sort is requested, by the device ID so that the order of the results
+	// is stable across pages and calls
+	if !sortsById && !db.disableSortTieBreaker {
+		sortField = append(sortField, bson.E{Key: DbDevId, Value: 1})
+	}
+	return sortField
+}
+
+// makeSearchMatch returns the query matching the devices by the filters
+// of the search, and the stages matching the large $in filters against
+// the values loaded into temporary collections instead, which cleanup
+// drops; on error, the collections are already dropped.
+func (db *DataStoreMongo) makeSearchMatch(
+	ctx context.Context,
+	database *mongo.Database,
+	searchParams model.SearchParams,
+) (findQuery bson.M, inLookups bson.A, cleanup func(), err error) {
+	var colls []*mongo.Collection
+	cleanup = func() {
+		for _, coll := range colls {
+			dropInValues(ctx, coll)
+		}
+	}
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
+
+	inLookups = bson.A{}
+	filters := make([]model.FilterPredicate, 0, len(searchParams.Filters))
+	for i, filter := range searchParams.Filters {
+		if values, ok := db.largeInValues(filter); ok {
+			coll, err := loadInValues(ctx, database, values)
+			if err != nil {
+				return nil, nil, nil, err
 			}
+			colls = append(colls, coll)
+			field := makeFilterField(filter)
+			inLookups = append(inLookups,
+				makeInValuesLookup(coll.Name(), field, i)...)
+			continue
+		}
+		filters = append(filters, filter)
+	}
+	queryParams := searchParams
+	queryParams.Filters = filters
+
+	if err := checkRegexFilters(filters); err != nil {
+		return nil, nil, nil, err
+	}
+
+	var names map[string][]string
+	if db.caseInsensitiveNames && len(filters) > 0 {
+		names, err = resolveAttributeNames(ctx, database, filters)
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err,
+				"failed to resolve the attribute names")
+		}
+	}
+	findQuery, err = makeSearchQuery(queryParams, names)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return findQuery, inLookups, cleanup, nil
+}
+
+func (db *DataStoreMongo) SearchDevices(
+	ctx context.Context,
+	searchParams model.SearchParams,
+) ([]model.Device, int, error) {
+	database := db.client.Database(mstore.DbFromContext(ctx, DbName))
+	c := database.Collection(DbDevicesColl)
+
+	findQuery, inLookups, cleanup, err := db.makeSearchMatch(ctx, database, searchParams)
+	if err != nil {
+		return nil, -1, err
+	}
+	defer cleanup()
+
+	skip := int64((searchParams.Page - 1) * searchParams.PerPage)
+	limit := int64(searchParams.PerPage)
+	projection := makeSearchProjection(searchParams)
+	sortField := db.makeSearchSort(searchParams)
+
+	// bounding the size of the attributes and scoring the devices
+	// require the aggregation
+	if len(inLookups) > 0 || db.maxAttributesBytes > 0 || len(searchParams.Score) > 0 {
+		pipeline := append(bson.A{bson.D{{Key: "$match", Value: findQuery}}}, inLookups...)
+		if len(searchParams.Score) > 0 {
+			pipeline = append(pipeline, makeScoreStage(searchParams.Score))
 		}
+		return aggregateSearchDevices(ctx, c,
+			pipeline, sortField, projection, skip, limit, db.maxAttributesBytes,
+			int64(searchParams.CountLimit),
+		)
+	}
+
+	findOptions := mopts.Find()
+	findOptions.SetSkip(skip)
+	findOptions.SetLimit(limit)
+	if projection != nil {
+		findOptions.SetProjection(projection)
+	}
+	if len(sortField) > 0 {
 		findOptions.SetSort(sortField)
 	}
 
@@ -1198,7 +3736,11 @@ func (db *DataStoreMongo) SearchDevices(
 		return nil, -1, errors.Wrap(err, "failed to search devices")
 	}
 
-	count, err := c.CountDocuments(ctx, findQuery)
+	countOptions := mopts.Count()
+	if searchParams.CountLimit > 0 {
+		countOptions.SetLimit(int64(searchParams.CountLimit))
+	}
+	count, err := c.CountDocuments(ctx, findQuery, countOptions)
 	if err != nil {
 		return nil, -1, errors.Wrap(err, "failed to search devices")
 	}
@@ -1206,6 +3748,585 @@ func (db *DataStoreMongo) SearchDevices(
 	return devices, int(count), nil
 }
 
+// CountDevices returns the number of devices matching the filters of the
+// search; unlike SearchDevices, it neither sorts nor fetches the devices.
+func (db *DataStoreMongo) CountDevices(
+	ctx context.Context,
+	searchParams model.SearchParams,
+) (int, error) {
+	database := db.client.Database(mstore.DbFromContext(ctx, DbName))
+	c := database.Collection(DbDevicesColl)
+
+	findQuery, inLookups, cleanup, err := db.makeSearchMatch(ctx, database, searchParams)
+	if err != nil {
+		return -1, err
+	}
+	defer cleanup()
+
+	if len(inLookups) == 0 {
+		count, err := c.CountDocuments(ctx, findQuery)
+		if err != nil {
+			return -1, errors.Wrap(err, "failed to count devices")
+		}
+		return int(count), nil
+	}
+
+	pipeline := append(bson.A{bson.D{{Key: "$match", Value: findQuery}}}, inLookups...)
+	pipeline = append(pipeline, bson.D{{Key: "$count", Value: "count"}})
+	cursor, err := c.Aggregate(ctx, pipeline)
+	if err != nil {
+		return -1, errors.Wrap(err, "failed to count devices")
+	}
+	var counts []struct {
+		Count int `bson:"count"`
+	}
+	if err = cursor.All(ctx, &counts); err != nil {
+		return -1, errors.Wrap(err, "failed to count devices")
+	}
+	if len(counts) == 0 {
+		return 0, nil
+	}
+	return counts[0].Count, nil
+}
+
+// explainRedactedKeys are the keys of the query plan whose values, and the
+// values of their descendants, carry the query values
+var explainRedactedKeys = map[string]struct{}{
+	"command":         {},
+	"filter":          {},
+	"indexBounds":     {},
+	"parsedQuery":     {},
+	"parsedTextQuery": {},
+	"$match":          {},
+}
+
+// ExplainSearchDevices explains the aggregation equivalent to the devices
+// search; the large $in filters are explained as plain $in filters.
+func (db *DataStoreMongo) ExplainSearchDevices(
+	ctx context.Context,
+	searchParams model.SearchParams,
+) (map[string]interface{}, error) {
+	database := db.client.Database(mstore.DbFromContext(ctx, DbName))
+
+	var names map[string][]string
+	if db.caseInsensitiveNames && len(searchParams.Filters) > 0 {
+		var err error
+		names, err = resolveAttributeNames(ctx, database, searchParams.Filters)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to explain the search")
+		}
+	}
+	findQuery, err := makeSearchQuery(searchParams, names)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline := bson.A{bson.D{{Key: "$match", Value: findQuery}}}
+	if len(searchParams.Score) > 0 {
+		pipeline = append(pipeline, makeScoreStage(searchParams.Score))
+	}
+	if sortField := db.makeSearchSort(searchParams); len(sortField) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: sortField}})
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$skip", Value: int64((searchParams.Page - 1) * searchParams.PerPage)}},
+		bson.D{{Key: "$limit", Value: int64(searchParams.PerPage)}},
+	)
+	if projection := makeSearchProjection(searchParams); projection != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$project", Value: projection}})
+	}
+	if db.maxAttributesBytes > 0 {
+		pipeline = append(pipeline, makeAttributesCapStages(db.maxAttributesBytes)...)
+	}
+
+	var plan bson.M
+	err = database.RunCommand(ctx, bson.D{
+		{Key: "explain", Value: bson.D{
+			{Key: "aggregate", Value: DbDevicesColl},
+			{Key: "pipeline", Value: pipeline},
+			{Key: "cursor", Value: bson.D{}},
+		}},
+		{Key: "verbosity", Value: "queryPlanner"},
+	}).Decode(&plan)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to explain the search")
+	}
+	return redactExplainPlan(plan, false).(bson.M), nil
+}
+
+// redactExplainPlan returns the query plan with the scalar values under the
+// keys carrying the query values replaced with utils.RedactedValue
+func redactExplainPlan(v interface{}, redact bool) interface{} {
+	switch v := v.(type) {
+	case bson.M:
+		res := make(bson.M, len(v))
+		for key, value := range v {
+			_, redactKey := explainRedactedKeys[key]
+			res[key] = redactExplainPlan(value, redact || redactKey)
+		}
+		return res
+	case bson.D:
+		res := make(bson.D, len(v))
+		for i, elem := range v {
+			_, redactKey := explainRedactedKeys[elem.Key]
+			res[i] = bson.E{
+				Key:   elem.Key,
+				Value: redactExplainPlan(elem.Value, redact || redactKey),
+			}
+		}
+		return res
+	case bson.A:
+		res := make(bson.A, len(v))
+		for i, value := range v {
+			res[i] = redactExplainPlan(value, redact)
+		}
+		return res
+	default:
+		if redact {
+			return utils.RedactedValue
+		}
+		return v
+	}
+}
+
+// aggregateSearchDevices returns the page of the devices matching the
+// pipeline, and the total number of matching devices; a positive
+// maxAttributesBytes bounds the size of the attributes of each device
+// and a positive countLimit stops counting the devices at this number
+func aggregateSearchDevices(
+	ctx context.Context,
+	c *mongo.Collection,
+	pipeline bson.A,
+	sortField bson.D,
+	projection bson.M,
+	skip, limit int64,
+	maxAttributesBytes int,
+	countLimit int64,
+) ([]model.Device, int, error) {
+	var counts []struct {
+		Count int `bson:"count"`
+	}
+	countPipeline := append(bson.A{}, pipeline...)
+	if countLimit > 0 {
+		countPipeline = append(countPipeline, bson.D{{Key: "$limit", Value: countLimit}})
+	}
+	countPipeline = append(countPipeline, bson.D{{Key: "$count", Value: "count"}})
+	cursor, err := c.Aggregate(ctx, countPipeline)
+	if err != nil {
+		return nil, -1, errors.Wrap(err, "failed to search devices")
+	}
+	if err = cursor.All(ctx, &counts); err != nil {
+		return nil, -1, errors.Wrap(err, "failed to search devices")
+	}
+	count := 0
+	if len(counts) > 0 {
+		count = counts[0].Count
+	}
+
+	if len(sortField) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: sortField}})
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$skip", Value: skip}},
+		bson.D{{Key: "$limit", Value: limit}},
+	)
+	if projection != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$project", Value: projection}})
+	}
+	if maxAttributesBytes > 0 {
+		pipeline = append(pipeline, makeAttributesCapStages(maxAttributesBytes)...)
+	}
+	cursor, err = c.Aggregate(ctx, pipeline, mopts.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, -1, errors.Wrap(err, "failed to search devices")
+	}
+	devices := []model.Device{}
+	if err = cursor.All(ctx, &devices); err != nil {
+		return nil, -1, errors.Wrap(err, "failed to search devices")
+	}
+	return devices, count, nil
+}
+
+// makeAttributesCapStages returns the stages keeping the attributes of
+// each device, in storage order, as long as their total BSON size is within
+// maxBytes, and flagging the devices whose attributes were left out
+func makeAttributesCapStages(maxBytes int) bson.A {
+	const (
+		capped    = "_capped"
+		size      = "size"
+		attrs     = "attrs"
+		truncated = "truncated"
+	)
+	return bson.A{
+		bson.D{{Key: "$addFields", Value: bson.D{{Key: capped, Value: bson.D{
+			{Key: "$reduce", Value: bson.D{
+				{Key: "input", Value: bson.D{{Key: "$objectToArray", Value: bson.D{
+					{Key: "$ifNull", Value: bson.A{"$" + DbDevAttributes, bson.D{}}},
+				}}}},
+				{Key: "initialValue", Value: bson.D{
+					{Key: size, Value: 0},
+					{Key: attrs, Value: bson.A{}},
+					{Key: truncated, Value: false},
+				}},
+				{Key: "in", Value: bson.D{{Key: "$let", Value: bson.D{
+					{Key: "vars", Value: bson.D{{Key: size, Value: bson.D{
+						{Key: "$add", Value: bson.A{
+							"$$value." + size,
+							bson.D{{Key: "$bsonSize", Value: "$$this"}},
+						}},
+					}}}},
+					{Key: "in", Value: bson.D{{Key: "$cond", Value: bson.A{
+						bson.D{{Key: "$lte", Value: bson.A{"$$" + size, maxBytes}}},
+						bson.D{
+							{Key: size, Value: "$$" + size},
+							{Key: attrs, Value: bson.D{{Key: "$concatArrays", Value: bson.A{
+								"$$value." + attrs, bson.A{"$$this"},
+							}}}},
+							{Key: truncated, Value: "$$value." + truncated},
+						},
+						bson.D{
+							{Key: size, Value: "$$value." + size},
+							{Key: attrs, Value: "$$value." + attrs},
+							{Key: truncated, Value: true},
+						},
+					}}}},
+				}}}},
+			}},
+		}}}}},
+		bson.D{{Key: "$addFields", Value: bson.D{
+			{Key: DbDevAttributes, Value: bson.D{
+				{Key: "$arrayToObject", Value: "$" + capped + "." + attrs},
+			}},
+			{Key: truncated, Value: "$" + capped + "." + truncated},
+		}}},
+		bson.D{{Key: "$project", Value: bson.D{{Key: capped, Value: 0}}}},
+	}
+}
+
+// largeInValues returns the values of the $in filter if they are more
+// than the large $in threshold and can be loaded into a collection
+func (db *DataStoreMongo) largeInValues(filter model.FilterPredicate) ([]interface{}, bool) {
+	if db.largeInThreshold <= 0 || filter.Type != "$in" || filter.Ref != nil {
+		return nil, false
+	}
+	v := reflect.ValueOf(filter.Value)
+	if v.Kind() != reflect.Slice || v.Len() <= db.largeInThreshold {
+		return nil, false
+	}
+	seen := make(map[interface{}]struct{}, v.Len())
+	values := make([]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		value := v.Index(i).Interface()
+		// the values become document IDs, which can't be arrays
+		if value != nil && !reflect.TypeOf(value).Comparable() {
+			return nil, false
+		}
+		if _, ok := seen[value]; !ok {
+			seen[value] = struct{}{}
+			values = append(values, value)
+		}
+	}
+	return values, true
+}
+
+// loadInValues stores the values, as document IDs, into a new temporary
+// collection named after its creation time
+func loadInValues(
+	ctx context.Context,
+	database *mongo.Database,
+	values []interface{},
+) (*mongo.Collection, error) {
+	coll := database.Collection(fmt.Sprintf("%s%d_%s",
+		DbSearchInValuesPrefix, time.Now().Unix(), uuid.New().String()))
+	docs := make([]interface{}, len(values))
+	for i, value := range values {
+		docs[i] = bson.D{{Key: DbDevId, Value: value}}
+	}
+	_, err := coll.InsertMany(ctx, docs)
+	if err != nil {
+		dropInValues(ctx, coll)
+		return nil, errors.Wrap(err, "failed to load the filter values")
+	}
+	return coll, nil
+}
+
+// dropInValues drops the temporary collection of the values, even if the
+// request was cancelled
+func dropInValues(ctx context.Context, coll *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), dropInValuesTimeout)
+	defer cancel()
+	if err := coll.Drop(ctx); err != nil {
+		log.FromContext(ctx).Warnf(
+			"failed to drop the filter values collection %s: %s",
+			coll.Name(), err.Error(),
+		)
+	}
+}
+
+// dropStaleInValues drops the temporary collections of the $in filter
+// values older than inValuesStaleAge, left over by the searches which
+// failed to drop them; the names without a creation time predate it.
+func dropStaleInValues(ctx context.Context, database *mongo.Database) error {
+	names, err := database.ListCollectionNames(ctx, bson.M{
+		"name": bson.M{"$regex": "^" + DbSearchInValuesPrefix},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to list the filter values collections")
+	}
+	staleBefore := time.Now().Add(-inValuesStaleAge).Unix()
+	for _, name := range names {
+		created := strings.SplitN(
+			strings.TrimPrefix(name, DbSearchInValuesPrefix), "_", 2)
+		if len(created) == 2 {
+			ts, err := strconv.ParseInt(created[0], 10, 64)
+			if err == nil && ts >= staleBefore {
+				continue
+			}
+		}
+		if err := database.Collection(name).Drop(ctx); err != nil {
+			return errors.Wrapf(err,
+				"failed to drop the filter values collection %s", name)
+		}
+	}
+	return nil
+}
+
+// makeInValuesLookup returns the stages keeping only the documents whose
+// field matches one of the values of the collection, equivalent to $in
+func makeInValuesLookup(coll, field string, n int) bson.A {
+	as := fmt.Sprintf("_in_values_%d", n)
+	return bson.A{
+		bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: coll},
+			{Key: "localField", Value: field},
+			{Key: "foreignField", Value: DbDevId},
+			{Key: "as", Value: as},
+		}}},
+		bson.D{{Key: "$match", Value: bson.D{
+			{Key: as + ".0", Value: bson.D{{Key: "$exists", Value: true}}},
+		}}},
+		bson.D{{Key: "$project", Value: bson.D{{Key: as, Value: 0}}}},
+	}
+}
+
+// makeSearchAttrField returns the document field holding the value of the
+// given attribute; the identity/id attribute maps to the document ID.
+func makeSearchAttrField(scope, name string) string {
+	if scope == model.AttrScopeIdentity && name == model.AttrNameID {
+		return DbDevId
+	}
+	return makeAttrField(name, scope, DbDevAttributesValue)
+}
+
+// makeFilterField returns the field matched by the filter predicate: the
+// attribute value, or the field at the path within an object value.
+func makeFilterField(filter model.FilterPredicate) string {
+	field := makeSearchAttrField(filter.Scope, filter.Attribute)
+	if filter.Path != "" {
+		field += "." + filter.Path
+	}
+	return field
+}
+
+// makeSearchFilter translates a filter predicate into a query document.
+func makeSearchFilter(filter model.FilterPredicate) (bson.M, error) {
+	field := makeFilterField(filter)
+	if filter.Ref != nil {
+		return makeAttrRefFilter(field, filter)
+	}
+	return bson.M{field: makeFilterCondition(filter)}, nil
+}
+
+// attributeNameKey returns the key of the attribute in the attributes
+// document, lowercased to compare the names regardless of their case.
+func attributeNameKey(scope, name string) string {
+	return strings.ToLower(
+		scope + "-" + model.GetDeviceAttributeNameReplacer().Replace(name))
+}
+
+// resolveAttributeNames returns the names of the stored attributes equal,
+// regardless of the case, to the attributes of the filters, by the
+// attributeNameKey of the attributes, as recorded by recordAttributeNames.
+func resolveAttributeNames(
+	ctx context.Context,
+	database *mongo.Database,
+	filters []model.FilterPredicate,
+) (map[string][]string, error) {
+	keys := make(bson.A, 0, len(filters))
+	for _, filter := range filters {
+		keys = append(keys, attributeNameKey(filter.Scope, filter.Attribute))
+	}
+	cur, err := database.Collection(DbAttributeNamesColl).
+		Find(ctx, bson.M{DbDevId: bson.M{"$in": keys}})
+	if err != nil {
+		return nil, err
+	}
+	var results []struct {
+		Key   string   `bson:"_id"`
+		Names []string `bson:"names"`
+	}
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	names := make(map[string][]string, len(results))
+	for _, res := range results {
+		names[res.Key] = res.Names
+	}
+	return names, nil
+}
+
+// recordAttributeNames adds the names of the attributes to the names
+// resolving the case-insensitive search filters, keyed by their
+// attributeNameKey, if the case-insensitive names are enabled.
+func (db *DataStoreMongo) recordAttributeNames(
+	ctx context.Context,
+	attrs model.DeviceAttributes,
+) error {
+	if !db.caseInsensitiveNames || len(attrs) == 0 {
+		return nil
+	}
+	names := make(map[string][]string, len(attrs))
+	for _, attr := range attrs {
+		scope := attr.Scope
+		if scope == "" {
+			scope = model.AttrScopeInventory
+		}
+		key := attributeNameKey(scope, attr.Name)
+		names[key] = append(names[key], attr.Name)
+	}
+	models := make([]mongo.WriteModel, 0, len(names))
+	for key, keyNames := range names {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{DbDevId: key}).
+			SetUpdate(bson.M{"$addToSet": bson.M{
+				DbAttributeNames: bson.M{"$each": keyNames},
+			}}).
+			SetUpsert(true))
+	}
+	_, err := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbAttributeNamesColl).
+		BulkWrite(ctx, models, mopts.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return errors.Wrap(err, "failed to record the attribute names")
+	}
+	return nil
+}
+
+// indexAttributeNames records the names of the attributes of all the
+// devices, as recordAttributeNames does on each update.
+func (db *DataStoreMongo) indexAttributeNames(ctx context.Context) error {
+	cur, err := db.client.
+		Database(mstore.DbFromContext(ctx, DbName)).
+		Collection(DbDevicesColl).
+		Aggregate(ctx, []bson.M{
+			{"$project": bson.M{
+				"_id":           0,
+				DbDevAttributes: bson.M{"$objectToArray": "$" + DbDevAttributes},
+			}},
+			{"$unwind": "$" + DbDevAttributes},
+			{"$group": bson.M{
+				DbDevId: bson.M{"$toLower": "$" + DbDevAttributes + ".k"},
+				DbAttributeNames: bson.M{
+					"$addToSet": "$" + DbDevAttributes + ".v." + DbDevAttributesName,
+				},
+			}},
+			{"$merge": bson.M{
+				"into": DbAttributeNamesColl,
+				"on":   DbDevId,
+				"whenMatched": bson.A{bson.M{"$set": bson.M{
+					DbAttributeNames: bson.M{"$setUnion": bson.A{
+						"$" + DbAttributeNames, "$$new." + DbAttributeNames,
+					}},
+				}}},
+				"whenNotMatched": "insert",
+			}},
+		})
+	if err != nil {
+		return errors.Wrap(err, "failed to index the attribute names")
+	}
+	return cur.Close(ctx)
+}
+
+// makeCaseInsensitiveSearchFilter translates a filter predicate into a
+// query document matching any of the stored names of the attribute; the
+// negative predicates must hold for all of them.
+func makeCaseInsensitiveSearchFilter(
+	filter model.FilterPredicate,
+	names map[string][]string,
+) (bson.M, error) {
+	variants := names[attributeNameKey(filter.Scope, filter.Attribute)]
+	if filter.Ref != nil || len(variants) == 0 {
+		return makeSearchFilter(filter)
+	}
+	queries := make(bson.A, 0, len(variants))
+	for _, name := range variants {
+		variant := filter
+		variant.Attribute = name
+		query, err := makeSearchFilter(variant)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, query)
+	}
+	if len(queries) == 1 {
+		return queries[0].(bson.M), nil
+	}
+	switch filter.Type {
+	case "$ne", "$nin":
+		return bson.M{"$and": queries}, nil
+	case model.FilterTypeExclude:
+		// one of the names holds a value, none of them an excluded one
+		exclude := make(bson.A, 0, len(variants))
+		for _, name := range variants {
+			variant := filter
+			variant.Attribute = name
+			variant.Type = "$nin"
+			query, err := makeSearchFilter(variant)
+			if err != nil {
+				return nil, err
+			}
+			exclude = append(exclude, query)
+		}
+		return bson.M{"$and": append(exclude, bson.M{"$or": queries})}, nil
+	case model.FilterTypeExists:
+		if exists, _ := filter.Value.(bool); !exists {
+			return bson.M{"$and": queries}, nil
+		}
+		return bson.M{"$or": queries}, nil
+	default:
+		return bson.M{"$or": queries}, nil
+	}
+}
+
+// makeAttrRefFilter builds an $expr comparing two attributes of the same
+// device. Only plain comparison operators between attribute paths are
+// accepted, arbitrary expressions are not.
+func makeAttrRefFilter(field string, filter model.FilterPredicate) (bson.M, error) {
+	if filter.Scope == "" || filter.Attribute == "" ||
+		filter.Ref.Scope == "" || filter.Ref.Attribute == "" {
+		return nil, ErrInvalidAttributeRef
+	}
+	switch filter.Type {
+	case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte":
+	default:
+		return nil, errors.Wrapf(ErrInvalidAttributeRef,
+			"unsupported operator %q", filter.Type)
+	}
+	ref := makeSearchAttrField(filter.Ref.Scope, filter.Ref.Attribute)
+	// within $expr a missing field takes part in the comparison; like the
+	// other predicates, never match devices missing either attribute
+	return bson.M{
+		"$and": bson.A{
+			bson.M{field: bson.M{"$exists": true}},
+			bson.M{ref: bson.M{"$exists": true}},
+			bson.M{"$expr": bson.M{
+				filter.Type: bson.A{"$" + field, "$" + ref},
+			}},
+		},
+	}, nil
+}
+
 func indexAttr(s *mongo.Client, ctx context.Context, attr string) error {
 	l := log.FromContext(ctx)
 	c := s.Database(mstore.DbFromContext(ctx, DbName)).Collection(DbDevicesColl)
@@ -1239,6 +4360,45 @@ func indexAttr(s *mongo.Client, ctx context.Context, attr string) error {
 	return nil
 }
 
+// parseIndexAttributes converts the <scope>/<name> attribute keys to the
+// attribute field names used in the devices collection
+func parseIndexAttributes(keys []string) ([]string, error) {
+	attrs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		scope, name, ok := strings.Cut(key, "/")
+		if !ok || scope == "" || name == "" ||
+			strings.ContainsAny(key, ".$") {
+			return nil, errors.Wrapf(ErrInvalidIndexAttribute, "invalid key %q", key)
+		}
+		attrs = append(attrs, scope+"-"+name)
+	}
+	return attrs, nil
+}
+
+// indexAttributesValues creates the indexes on the values of the
+// configured attributes; creating an existing index is a no-op
+func (db *DataStoreMongo) indexAttributesValues(ctx context.Context) error {
+	l := log.FromContext(ctx)
+	database := mstore.DbFromContext(ctx, DbName)
+	indexView := db.client.Database(database).Collection(DbDevicesColl).Indexes()
+
+	for _, attr := range db.indexAttributes {
+		field := indexAttrName(attr)
+		_, err := indexView.CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: field, Value: 1}},
+			Options: mopts.Index().SetName(field),
+		})
+		if err != nil {
+			if isTooManyIndexes(err) {
+				l.Warnf("failed to index attr %s in db %s: too many indexes", attr, database)
+				continue
+			}
+			return errors.Wrapf(err, "failed to index attr %s in db %s", attr, database)
+		}
+	}
+	return nil
+}
+
 func indexAttrName(attr string) string {
 	return fmt.Sprintf("attributes.%s.value", attr)
 }
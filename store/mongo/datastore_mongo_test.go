@@ -16,13 +16,19 @@ package mongo
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	mopts "go.mongodb.org/mongo-driver/mongo/options"
@@ -32,6 +38,7 @@ import (
 	"github.com/mendersoftware/inventory/utils"
 
 	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
 
 	"github.com/pkg/errors"
 
@@ -305,14 +312,93 @@ func TestMongoGetDevices(t *testing.T) {
 	}
 }
 
+func TestMongoGetDevicesAnyTags(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoGetDevicesAnyTags in short mode.")
+	}
+
+	inputDevs := []model.Device{
+		{ID: model.DeviceID("0")},
+		{
+			ID: model.DeviceID("1"),
+			Attributes: model.DeviceAttributes{
+				{Name: "env", Value: "prod", Scope: model.AttrScopeTags},
+			},
+		},
+		{
+			ID: model.DeviceID("2"),
+			Attributes: model.DeviceAttributes{
+				{Name: "owner", Value: "alice", Scope: model.AttrScopeTags},
+			},
+		},
+		{
+			ID: model.DeviceID("3"),
+			Attributes: model.DeviceAttributes{
+				{Name: "env", Value: "dev", Scope: model.AttrScopeTags},
+				{Name: "owner", Value: "bob", Scope: model.AttrScopeTags},
+			},
+		},
+		{
+			ID: model.DeviceID("4"),
+			Attributes: model.DeviceAttributes{
+				// same name in a different scope is not a tag
+				{Name: "env", Value: "prod", Scope: model.AttrScopeInventory},
+				{Name: "location", Value: "lab", Scope: model.AttrScopeTags},
+			},
+		},
+	}
+
+	testCases := map[string]struct {
+		tags     []string
+		expected []model.DeviceID
+	}{
+		"one tag": {
+			tags:     []string{"env"},
+			expected: []model.DeviceID{"1", "3"},
+		},
+		"two tags": {
+			tags:     []string{"env", "owner"},
+			expected: []model.DeviceID{"1", "2", "3"},
+		},
+		"unknown tag": {
+			tags:     []string{"foo"},
+			expected: []model.DeviceID{},
+		},
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+	for _, d := range inputDevs {
+		err := mongoStore.AddDevice(ctx, &d)
+		assert.NoError(t, err, "failed to setup input data")
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			devs, totalCount, err := mongoStore.GetDevices(ctx,
+				store.ListQuery{AnyTags: tc.tags})
+			assert.NoError(t, err, "failed to get devices")
+
+			assert.Equal(t, len(tc.expected), totalCount)
+			ids := make([]model.DeviceID, len(devs))
+			for i, dev := range devs {
+				ids[i] = dev.ID
+			}
+			assert.ElementsMatch(t, tc.expected, ids)
+		})
+	}
+}
+
 func TestMongoGetAllAttributeNames(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping TestMongoGetAllAttributeNames in short mode.")
 	}
 
 	testCases := map[string]struct {
-		inDevs []model.Device
-		tenant string
+		inDevs        []model.Device
+		tenant        string
+		excludeSystem bool
 
 		outAttrs []string
 	}{
@@ -380,9 +466,33 @@ func TestMongoGetAllAttributeNames(t *testing.T) {
 			outAttrs: []string{"mac", "sn", "created_ts"},
 			tenant:   "tenant1",
 		},
+		"two devs, exclude system": {
+			inDevs: []model.Device{
+				{
+					ID: model.DeviceID("1"),
+					Attributes: model.DeviceAttributes{
+						{Name: "mac", Value: "foo", Description: strPtr("desc"), Scope: model.AttrScopeInventory},
+						{Name: "sn", Value: "bar", Description: strPtr("desc"), Scope: model.AttrScopeInventory},
+					},
+				},
+				{
+					ID: model.DeviceID("2"),
+					Attributes: model.DeviceAttributes{
+						{Name: "mac", Value: "foo", Description: strPtr("desc"), Scope: model.AttrScopeInventory},
+						{Name: "room", Value: "1", Scope: model.AttrScopeTags},
+					},
+				},
+			},
+			excludeSystem: true,
+			outAttrs:      []string{"mac", "sn", "room"},
+		},
 		"no devs": {
 			outAttrs: []string{},
 		},
+		"no devs, exclude system": {
+			excludeSystem: true,
+			outAttrs:      []string{},
+		},
 	}
 
 	for name, tc := range testCases {
@@ -411,7 +521,7 @@ func TestMongoGetAllAttributeNames(t *testing.T) {
 		}
 
 		//test
-		names, err := mongoStore.GetAllAttributeNames(ctx)
+		names, err := mongoStore.GetAllAttributeNames(ctx, tc.excludeSystem)
 		assert.NoError(t, err, "failed to get devices")
 
 		assert.ElementsMatch(t, tc.outAttrs, names)
@@ -505,6 +615,241 @@ func TestMongoGetDevice(t *testing.T) {
 	}
 }
 
+func TestMongoGetDevicesMap(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoGetDevicesMap in short mode.")
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	store := NewDataStoreMongoWithSession(db.Client())
+
+	for _, id := range []model.DeviceID{"1", "2", "3"} {
+		err := store.AddDevice(ctx, &model.Device{
+			ID: id,
+			Attributes: model.DeviceAttributes{
+				{Name: "mac", Value: string(id) + "-mac", Scope: model.AttrScopeInventory},
+			},
+		})
+		require.NoError(t, err, "failed to setup input data")
+	}
+
+	devices, err := store.GetDevicesMap(ctx, []model.DeviceID{"1", "3", "4"})
+	require.NoError(t, err)
+	require.Len(t, devices, 2)
+	for _, id := range []model.DeviceID{"1", "3"} {
+		require.Contains(t, devices, id)
+		assert.Equal(t, id, devices[id].ID)
+		var mac interface{}
+		for _, attr := range devices[id].Attributes {
+			if attr.Name == "mac" {
+				mac = attr.Value
+			}
+		}
+		assert.Equal(t, string(id)+"-mac", mac)
+	}
+	assert.NotContains(t, devices, model.DeviceID("2"))
+	assert.NotContains(t, devices, model.DeviceID("4"))
+
+	devices, err = store.GetDevicesMap(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, devices)
+}
+
+func TestMongoGetDevicesByIDs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoGetDevicesByIDs in short mode.")
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	store := NewDataStoreMongoWithSession(db.Client())
+
+	for _, id := range []model.DeviceID{"1", "2", "3"} {
+		err := store.AddDevice(ctx, &model.Device{
+			ID: id,
+			Attributes: model.DeviceAttributes{
+				{Name: "mac", Value: string(id) + "-mac", Scope: model.AttrScopeInventory},
+			},
+		})
+		require.NoError(t, err, "failed to setup input data")
+	}
+
+	devices, err := store.GetDevicesByIDs(ctx, []model.DeviceID{"3", "4", "1", "3"})
+	require.NoError(t, err)
+	require.Len(t, devices, 2)
+	assert.Equal(t, model.DeviceID("3"), devices[0].ID)
+	assert.Equal(t, model.DeviceID("1"), devices[1].ID)
+
+	devices, err = store.GetDevicesByIDs(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, devices)
+}
+
+func TestMongoCreateDevice(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoCreateDevice in short mode.")
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+
+	device := &model.Device{
+		ID: model.DeviceID("1"),
+		Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:00:00:01", Scope: model.AttrScopeIdentity},
+		},
+		Group: "foo",
+	}
+	err := mongoStore.CreateDevice(ctx, device)
+	assert.NoError(t, err)
+
+	// creating the device again fails and leaves it untouched
+	err = mongoStore.CreateDevice(ctx, &model.Device{
+		ID: model.DeviceID("1"),
+		Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:00:00:02", Scope: model.AttrScopeIdentity},
+		},
+	})
+	assert.ErrorIs(t, err, store.ErrDevExists)
+
+	dev, err := mongoStore.GetDevice(ctx, device.ID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, dev) {
+		assert.Equal(t, model.GroupName("foo"), dev.Group)
+		assert.Contains(t, dev.Attributes, model.DeviceAttribute{
+			Name: "mac", Value: "00:00:00:01", Scope: model.AttrScopeIdentity,
+		})
+		assert.False(t, dev.CreatedTs.IsZero())
+	}
+
+	// adding the device merges the attributes instead
+	err = mongoStore.AddDevice(ctx, &model.Device{
+		ID: model.DeviceID("1"),
+		Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:00:00:02", Scope: model.AttrScopeIdentity},
+		},
+	})
+	assert.NoError(t, err)
+	dev, err = mongoStore.GetDevice(ctx, device.ID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, dev) {
+		assert.Contains(t, dev.Attributes, model.DeviceAttribute{
+			Name: "mac", Value: "00:00:00:02", Scope: model.AttrScopeIdentity,
+		})
+	}
+}
+
+func TestMongoReplaceDevice(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoReplaceDevice in short mode.")
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+
+	prior := model.DeviceAttributes{
+		{Name: "mac", Value: "00:00:00:01", Scope: model.AttrScopeIdentity},
+		{Name: "sn", Value: "sn-1", Scope: model.AttrScopeInventory},
+		{Name: "location", Value: "lab", Scope: model.AttrScopeTags},
+	}
+	update := model.DeviceAttributes{
+		{Name: "mac", Value: "00:00:00:02", Scope: model.AttrScopeIdentity},
+		{Name: "os", Value: "linux", Scope: model.AttrScopeInventory},
+	}
+	for _, id := range []model.DeviceID{"merged", "fresh"} {
+		err := mongoStore.AddDevice(ctx, &model.Device{
+			ID:         id,
+			Attributes: append(model.DeviceAttributes{}, prior...),
+			Group:      "foo",
+		})
+		require.NoError(t, err, "failed to setup input data")
+	}
+
+	// merge mode retains the prior attributes
+	err := mongoStore.AddDevice(ctx, &model.Device{
+		ID:         "merged",
+		Attributes: append(model.DeviceAttributes{}, update...),
+	})
+	assert.NoError(t, err)
+	dev, err := mongoStore.GetDevice(ctx, "merged")
+	require.NoError(t, err)
+	require.NotNil(t, dev)
+	assert.Equal(t, model.GroupName("foo"), dev.Group)
+	for _, attr := range append(update, prior[1:]...) {
+		assert.Contains(t, dev.Attributes, attr)
+	}
+
+	// fresh mode removes them
+	err = mongoStore.ReplaceDevice(ctx, &model.Device{
+		ID:         "fresh",
+		Attributes: append(model.DeviceAttributes{}, update...),
+	})
+	assert.NoError(t, err)
+	dev, err = mongoStore.GetDevice(ctx, "fresh")
+	require.NoError(t, err)
+	require.NotNil(t, dev)
+	assert.Empty(t, dev.Group)
+	assert.False(t, dev.CreatedTs.IsZero())
+	assert.NotNil(t, dev.UpdatedTs)
+	userAttrs := model.DeviceAttributes{}
+	for _, attr := range dev.Attributes {
+		if attr.Scope != model.AttrScopeSystem {
+			userAttrs = append(userAttrs, attr)
+		}
+	}
+	assert.ElementsMatch(t, update, userAttrs)
+
+	// and creates a device which doesn't exist
+	err = mongoStore.ReplaceDevice(ctx, &model.Device{
+		ID:         "new",
+		Attributes: append(model.DeviceAttributes{}, update...),
+		Group:      "bar",
+	})
+	assert.NoError(t, err)
+	dev, err = mongoStore.GetDevice(ctx, "new")
+	require.NoError(t, err)
+	if assert.NotNil(t, dev) {
+		assert.Equal(t, model.GroupName("bar"), dev.Group)
+	}
+}
+
+func TestMongoLogRedactedAttributes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoLogRedactedAttributes in short mode.")
+	}
+
+	db.Wipe()
+	logger, hook := logtest.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	ctx := log.WithContext(db.CTX(), log.NewFromLogger(logger, log.Ctx{}))
+	mongoStore := &DataStoreMongo{
+		client:   db.Client(),
+		redactor: utils.NewAttributesRedactor([]string{"token"}),
+	}
+
+	attrs := model.DeviceAttributes{
+		{Name: "mac", Value: "00:11:22", Scope: model.AttrScopeIdentity},
+		{Name: "token", Value: "s3cr3t", Scope: model.AttrScopeInventory},
+	}
+	_, err := mongoStore.UpsertDevicesAttributes(ctx, []model.DeviceID{"1"}, attrs)
+	assert.NoError(t, err)
+	_, err = mongoStore.UpsertRemoveDeviceAttributes(ctx, "1", attrs, nil, "", "")
+	assert.NoError(t, err)
+
+	entries := hook.AllEntries()
+	if assert.Len(t, entries, 2) {
+		for _, entry := range entries {
+			assert.Equal(t, logrus.DebugLevel, entry.Level)
+			assert.Contains(t, entry.Message, "identity/mac=00:11:22")
+			assert.Contains(t, entry.Message, "inventory/token="+utils.RedactedValue)
+			assert.NotContains(t, entry.Message, "s3cr3t")
+		}
+	}
+}
+
 func TestMongoAddDevice(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping TestMongoAddDevice in short mode.")
@@ -1635,6 +1980,161 @@ func TestMongoUpsertDevicesAttributes(t *testing.T) {
 	}
 }
 
+func TestMongoUpsertDevicesAttributesStrictTypes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoUpsertDevicesAttributesStrictTypes in short mode.")
+	}
+
+	testCases := map[string]struct {
+		strict bool
+		ids    []model.DeviceID
+		attrs  model.DeviceAttributes
+
+		outErr error
+		value  interface{}
+	}{
+		"strict, type changed": {
+			strict: true,
+			ids:    []model.DeviceID{"1"},
+			attrs: model.DeviceAttributes{
+				{Name: "version", Value: float64(2), Scope: model.AttrScopeInventory},
+			},
+			outErr: store.ErrAttributeTypeConflict,
+			value:  "1.0",
+		},
+		"strict, type changed on one of the devices": {
+			strict: true,
+			ids:    []model.DeviceID{"2", "1"},
+			attrs: model.DeviceAttributes{
+				{Name: "version", Value: float64(2), Scope: model.AttrScopeInventory},
+			},
+			outErr: store.ErrAttributeTypeConflict,
+			value:  "1.0",
+		},
+		"strict, same type": {
+			strict: true,
+			ids:    []model.DeviceID{"1"},
+			attrs: model.DeviceAttributes{
+				{Name: "version", Value: "2.0", Scope: model.AttrScopeInventory},
+			},
+			value: "2.0",
+		},
+		"lenient, type changed": {
+			ids: []model.DeviceID{"1"},
+			attrs: model.DeviceAttributes{
+				{Name: "version", Value: float64(2), Scope: model.AttrScopeInventory},
+			},
+			value: float64(2),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db.Wipe()
+			ctx := db.CTX()
+			mongoStore := &DataStoreMongo{
+				client:               db.Client(),
+				strictAttributeTypes: tc.strict,
+			}
+			err := mongoStore.AddDevice(ctx, &model.Device{
+				ID: "1",
+				Attributes: model.DeviceAttributes{
+					{Name: "version", Value: "1.0", Scope: model.AttrScopeInventory},
+				},
+			})
+			require.NoError(t, err)
+			err = mongoStore.AddDevice(ctx, &model.Device{ID: "2"})
+			require.NoError(t, err)
+
+			_, err = mongoStore.UpsertDevicesAttributes(ctx, tc.ids, tc.attrs)
+			if tc.outErr != nil {
+				assert.ErrorIs(t, err, tc.outErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			dev, err := mongoStore.GetDevice(ctx, "1")
+			require.NoError(t, err)
+			var value interface{}
+			for _, attr := range dev.Attributes {
+				if attr.Name == "version" {
+					value = attr.Value
+				}
+			}
+			assert.Equal(t, tc.value, value)
+		})
+	}
+}
+
+func TestMongoUpsertDevicesAttributesChangeTimestamps(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoUpsertDevicesAttributesChangeTimestamps in short mode.")
+	}
+
+	attrTimestamps := func(t *testing.T, s store.DataStore, id model.DeviceID) map[string]*time.Time {
+		dev, err := s.GetDevice(db.CTX(), id)
+		require.NoError(t, err)
+		require.NotNil(t, dev)
+		timestamps := map[string]*time.Time{}
+		for _, attr := range dev.Attributes {
+			if attr.Scope == model.AttrScopeInventory {
+				timestamps[attr.Name] = attr.Timestamp
+			}
+		}
+		return timestamps
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		db.Wipe()
+		ctx := db.CTX()
+		mongoStore := &DataStoreMongo{
+			client:            db.Client(),
+			attributeChangeTs: true,
+		}
+
+		_, err := mongoStore.UpsertDevicesAttributes(ctx,
+			[]model.DeviceID{"1", "2"},
+			model.DeviceAttributes{
+				{Name: "ip", Value: "10.0.0.1", Scope: model.AttrScopeInventory},
+				{Name: "mac", Value: "de:ad:be:ef", Scope: model.AttrScopeInventory},
+			})
+		require.NoError(t, err)
+		before := attrTimestamps(t, mongoStore, "1")
+		require.NotNil(t, before["ip"])
+		require.NotNil(t, before["mac"])
+
+		time.Sleep(10 * time.Millisecond)
+		_, err = mongoStore.UpsertDevicesAttributes(ctx,
+			[]model.DeviceID{"1"},
+			model.DeviceAttributes{
+				{Name: "ip", Value: "10.0.0.2", Scope: model.AttrScopeInventory},
+				{Name: "mac", Value: "de:ad:be:ef", Scope: model.AttrScopeInventory},
+			})
+		require.NoError(t, err)
+		after := attrTimestamps(t, mongoStore, "1")
+		require.NotNil(t, after["ip"])
+		assert.True(t, after["ip"].After(*before["ip"]))
+		assert.Equal(t, before["mac"], after["mac"])
+
+		// the other device is left untouched
+		assert.Equal(t, before, attrTimestamps(t, mongoStore, "2"))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		db.Wipe()
+		ctx := db.CTX()
+		mongoStore := &DataStoreMongo{client: db.Client()}
+
+		_, err := mongoStore.UpsertDevicesAttributes(ctx,
+			[]model.DeviceID{"1"},
+			model.DeviceAttributes{
+				{Name: "ip", Value: "10.0.0.1", Scope: model.AttrScopeInventory},
+			})
+		require.NoError(t, err)
+		assert.Nil(t, attrTimestamps(t, mongoStore, "1")["ip"])
+	})
+}
+
 func TestMongoUpsertRemoveDeviceAttributes(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping TestMongoUpsertRemoveDeviceAttributes in short mode.")
@@ -1883,6 +2383,53 @@ func TestMongoUpsertRemoveDeviceAttributes(t *testing.T) {
 			}},
 			scope: model.AttrScopeInventory,
 		},
+		"dev exists, attributes exist, remove attr with null value, set another to empty": {
+			devs: []model.Device{
+				{
+					ID: model.DeviceID("0003"),
+					Attributes: model.DeviceAttributes{
+						{
+							Name:  "mac",
+							Value: "0003-mac",
+							Scope: model.AttrScopeInventory,
+						},
+						{
+							Name:  "sn",
+							Value: "0003-sn",
+							Scope: model.AttrScopeInventory,
+						},
+					},
+					CreatedTs: createdTs,
+				},
+			},
+			inDevID: model.DeviceID("0003"),
+			inUpsertAttrs: model.DeviceAttributes{
+				{
+					Scope: model.AttrScopeInventory,
+					Name:  "sn",
+					Value: "",
+				},
+			},
+			inRemoveAttrs: model.DeviceAttributes{
+				{
+					Name:  "mac",
+					Value: nil,
+					Scope: model.AttrScopeInventory,
+				},
+			},
+			outDevs: []model.Device{{
+				ID: model.DeviceID("0003"),
+				Attributes: model.DeviceAttributes{
+					{
+						Scope: model.AttrScopeInventory,
+						Name:  "sn",
+						Value: "",
+					},
+				},
+				CreatedTs: createdTs,
+			}},
+			scope: model.AttrScopeInventory,
+		},
 		"dev exists, attributes exist, update one attr (descr only)": {
 			devs: []model.Device{
 				{
@@ -2901,6 +3448,138 @@ func TestMongoUpdateDeviceGroup(t *testing.T) {
 	}
 }
 
+func TestMongoUpdateDeviceGroupIf(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoUpdateDeviceGroupIf in short mode.")
+	}
+
+	testCases := map[string]struct {
+		InputDeviceID model.DeviceID
+		Expected      model.GroupName
+		NewGroup      model.GroupName
+		InputDevices  []model.Device
+		tenant        string
+
+		Changed     bool
+		OutputGroup model.GroupName
+		OutputError error
+	}{
+		"ok, group matches": {
+			InputDeviceID: "1",
+			Expected:      "abc",
+			NewGroup:      "def",
+			InputDevices: []model.Device{{
+				ID:    model.DeviceID("1"),
+				Group: model.GroupName("abc"),
+			}},
+			Changed:     true,
+			OutputGroup: "def",
+		},
+		"ok, group matches; with tenant": {
+			InputDeviceID: "1",
+			Expected:      "abc",
+			NewGroup:      "def",
+			InputDevices: []model.Device{{
+				ID:    model.DeviceID("1"),
+				Group: model.GroupName("abc"),
+			}},
+			tenant:      "foo",
+			Changed:     true,
+			OutputGroup: "def",
+		},
+		"ok, no group expected": {
+			InputDeviceID: "1",
+			Expected:      "",
+			NewGroup:      "def",
+			InputDevices: []model.Device{{
+				ID: model.DeviceID("1"),
+			}},
+			Changed:     true,
+			OutputGroup: "def",
+		},
+		"ok, unset group": {
+			InputDeviceID: "1",
+			Expected:      "abc",
+			NewGroup:      "",
+			InputDevices: []model.Device{{
+				ID:    model.DeviceID("1"),
+				Group: model.GroupName("abc"),
+			}},
+			Changed:     true,
+			OutputGroup: "",
+		},
+		"group mismatch": {
+			InputDeviceID: "1",
+			Expected:      "xyz",
+			NewGroup:      "def",
+			InputDevices: []model.Device{{
+				ID:    model.DeviceID("1"),
+				Group: model.GroupName("abc"),
+			}},
+			Changed:     false,
+			OutputGroup: "abc",
+		},
+		"group mismatch, device not in group": {
+			InputDeviceID: "1",
+			Expected:      "xyz",
+			NewGroup:      "def",
+			InputDevices: []model.Device{{
+				ID: model.DeviceID("1"),
+			}},
+			Changed:     false,
+			OutputGroup: "",
+		},
+		"device not found": {
+			InputDeviceID: "2",
+			Expected:      "abc",
+			NewGroup:      "def",
+			InputDevices: []model.Device{{
+				ID:    model.DeviceID("1"),
+				Group: model.GroupName("abc"),
+			}},
+			OutputError: store.ErrDevNotFound,
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db.Wipe()
+
+			client := db.Client()
+			ds := NewDataStoreMongoWithSession(client)
+
+			ctx := identity.WithContext(db.CTX(), &identity.Identity{
+				Tenant: testCase.tenant,
+			})
+
+			ins := make(bson.A, len(testCase.InputDevices))
+			for i := range testCase.InputDevices {
+				ins[i] = &testCase.InputDevices[i]
+			}
+			_, err := client.Database(mstore.DbFromContext(ctx, DbName)).
+				Collection(DbDevicesColl).
+				InsertMany(ctx, ins)
+			if err != nil {
+				panic(err)
+			}
+
+			changed, err := ds.UpdateDeviceGroupIf(
+				ctx, testCase.InputDeviceID, testCase.Expected, testCase.NewGroup,
+			)
+			if testCase.OutputError != nil {
+				assert.EqualError(t, err, testCase.OutputError.Error())
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.Changed, changed)
+
+			group, err := ds.GetDeviceGroup(ctx, testCase.InputDeviceID)
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.OutputGroup, group)
+		})
+	}
+}
+
 func TestMongoUpdateDeviceText(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping UpdateDeviceText in short mode.")
@@ -2989,6 +3668,178 @@ func compareAttrsWithoutTimestamp(a, b model.DeviceAttributes) bool {
 	return true
 }
 
+func TestMongoDuplicateAttributes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoDuplicateAttributes in short mode.")
+	}
+
+	db.Wipe()
+	client := db.Client()
+	ctx := db.CTX()
+	ds := NewDataStoreMongoWithSession(client)
+
+	err := ds.AddDevice(ctx, &model.Device{
+		ID: "clean",
+		Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:00:00:01", Scope: model.AttrScopeInventory},
+			{Name: "mac", Value: "foo", Scope: model.AttrScopeTags},
+		},
+	})
+	assert.NoError(t, err)
+
+	// legacy document storing the same attribute under two keys
+	_, err = client.Database(DbName).Collection(DbDevicesColl).InsertOne(ctx, bson.M{
+		DbDevId: "malformed",
+		DbDevAttributes: bson.M{
+			"inventory-mac": bson.M{
+				DbDevAttributesName:  "mac",
+				DbDevAttributesScope: model.AttrScopeInventory,
+				DbDevAttributesValue: "00:00:00:02",
+			},
+			"inventory-legacy-mac": bson.M{
+				DbDevAttributesName:  "mac",
+				DbDevAttributesScope: model.AttrScopeInventory,
+				DbDevAttributesValue: "00:00:00:03",
+			},
+			"inventory-sn": bson.M{
+				DbDevAttributesName:  "sn",
+				DbDevAttributesScope: model.AttrScopeInventory,
+				DbDevAttributesValue: "123",
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	devices, err := ds.FindDevicesWithDuplicateAttributes(ctx, 1, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, devices)
+
+	devices, err = ds.FindDevicesWithDuplicateAttributes(ctx, 0, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, devices, 1) {
+		assert.Equal(t, model.DeviceID("malformed"), devices[0].DeviceID)
+		if assert.Len(t, devices[0].Attributes, 1) {
+			dup := devices[0].Attributes[0]
+			assert.Equal(t, "mac", dup.Name)
+			assert.Equal(t, model.AttrScopeInventory, dup.Scope)
+			assert.ElementsMatch(t,
+				[]string{"inventory-mac", "inventory-legacy-mac"},
+				dup.Keys)
+		}
+	}
+
+	removed, err := ds.RepairDuplicateAttributes(ctx, "clean")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+
+	removed, err = ds.RepairDuplicateAttributes(ctx, "malformed")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	devices, err = ds.FindDevicesWithDuplicateAttributes(ctx, 0, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, devices)
+
+	dev, err := ds.GetDevice(ctx, "malformed")
+	assert.NoError(t, err)
+	if assert.NotNil(t, dev) {
+		assert.ElementsMatch(t, model.DeviceAttributes{
+			{Name: "mac", Value: "00:00:00:02", Scope: model.AttrScopeInventory},
+			{Name: "sn", Value: "123", Scope: model.AttrScopeInventory},
+		}, dev.Attributes)
+	}
+}
+
+func TestMongoVerifyDeviceAttributes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoVerifyDeviceAttributes in short mode.")
+	}
+
+	db.Wipe()
+	client := db.Client()
+	ctx := db.CTX()
+	ds := NewDataStoreMongoWithSession(client)
+
+	err := ds.AddDevice(ctx, &model.Device{
+		ID: "clean",
+		Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:00:00:01", Scope: model.AttrScopeInventory},
+			{Name: "ips", Value: []interface{}{"1.1.1.1", "1.1.1.2"},
+				Scope: model.AttrScopeInventory},
+			{Name: "mac", Value: "foo", Scope: model.AttrScopeTags},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = client.Database(DbName).Collection(DbDevicesColl).InsertOne(ctx, bson.M{
+		DbDevId: "malformed",
+		DbDevAttributes: bson.M{
+			"inventory-mac": bson.M{
+				DbDevAttributesName:  "mac",
+				DbDevAttributesScope: model.AttrScopeInventory,
+				DbDevAttributesValue: "00:00:00:02",
+			},
+			"inventory-legacy-mac": bson.M{
+				DbDevAttributesName:  "mac",
+				DbDevAttributesScope: model.AttrScopeInventory,
+				DbDevAttributesValue: "00:00:00:03",
+			},
+			"-sn": bson.M{
+				DbDevAttributesName:  "sn",
+				DbDevAttributesValue: "123",
+			},
+			"inventory-ports": bson.M{
+				DbDevAttributesName:  "ports",
+				DbDevAttributesScope: model.AttrScopeInventory,
+				DbDevAttributesValue: bson.A{"80", float64(443)},
+			},
+			"inventory-cpus": bson.M{
+				DbDevAttributesName:  "cpus",
+				DbDevAttributesScope: model.AttrScopeInventory,
+				DbDevAttributesValue: bson.A{float64(1), int32(2)},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	report, err := ds.VerifyDeviceAttributes(ctx, "clean")
+	require.NoError(t, err)
+	assert.Equal(t, &model.DeviceAttributesReport{
+		DeviceID: "clean",
+		Issues:   []model.AttributeIssue{},
+	}, report)
+
+	report, err = ds.VerifyDeviceAttributes(ctx, "malformed")
+	require.NoError(t, err)
+	assert.Equal(t, &model.DeviceAttributesReport{
+		DeviceID: "malformed",
+		Issues: []model.AttributeIssue{{
+			Key:   "-sn",
+			Name:  "sn",
+			Issue: model.AttributeIssueMissingScope,
+		}, {
+			Key:   "inventory-legacy-mac",
+			Name:  "mac",
+			Scope: model.AttrScopeInventory,
+			Issue: model.AttributeIssueDuplicateKey,
+		}, {
+			Key:   "inventory-mac",
+			Name:  "mac",
+			Scope: model.AttrScopeInventory,
+			Issue: model.AttributeIssueDuplicateKey,
+		}, {
+			Key:   "inventory-ports",
+			Name:  "ports",
+			Scope: model.AttrScopeInventory,
+			Issue: model.AttributeIssueMixedArrayTypes,
+		}},
+	}, report)
+
+	report, err = ds.VerifyDeviceAttributes(ctx, "missing")
+	assert.Equal(t, store.ErrDevNotFound, err)
+	assert.Nil(t, report)
+}
+
 func TestMongoDeleteGroup(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping TestMongoUnsetDevicesGroupWithmodel.GroupName in short mode.")
@@ -3150,6 +4001,16 @@ func TestMongoUnsetDevicesGroupWithGroupName(t *testing.T) {
 				}
 			}
 
+			// the dry run leaves the groups intact
+			matched, err := store.CountDevicesInGroup(ctx,
+				testCase.InputDeviceIDs, testCase.InputGroupName)
+			assert.NoError(t, err)
+			for _, dev := range testCase.InputDevices {
+				group, err := store.GetDeviceGroup(ctx, dev.ID)
+				assert.NoError(t, err)
+				assert.Equal(t, dev.Group, group)
+			}
+
 			res, err := store.UnsetDevicesGroup(ctx, testCase.InputDeviceIDs, testCase.InputGroupName)
 			if testCase.OutputError != nil {
 				assert.Error(t, err, "expected error")
@@ -3159,1071 +4020,3272 @@ func TestMongoUnsetDevicesGroupWithGroupName(t *testing.T) {
 				assert.NoError(t, err, "expected no error")
 				if assert.NotNil(t, res) {
 					assert.Equal(t, testCase.Result, *res)
+					assert.Equal(t, res.MatchedCount, matched)
 				}
 			}
 		})
 	}
 }
 
-func TestMongoListGroups(t *testing.T) {
+func TestMongoGetDevicesDistinctGroups(t *testing.T) {
 	if testing.Short() {
-		t.Skip("skipping TestMongoListGroups in short mode.")
+		t.Skip("skipping TestMongoGetDevicesDistinctGroups in short mode.")
+	}
+
+	inputDevs := []model.Device{
+		{ID: model.DeviceID("1"), Group: model.GroupName("foo")},
+		{ID: model.DeviceID("2"), Group: model.GroupName("foo")},
+		{ID: model.DeviceID("3"), Group: model.GroupName("bar")},
+		{ID: model.DeviceID("4"), Group: model.GroupName("baz")},
+		{ID: model.DeviceID("5")},
+		{ID: model.DeviceID("6")},
 	}
 
 	testCases := map[string]struct {
-		InputDevices []model.Device
-		Filters      []model.FilterPredicate
-		tenant       string
-		OutputGroups []model.GroupName
-		Error        error
+		ids      []model.DeviceID
+		expected []model.GroupName
 	}{
-		"groups foo, bar": {
-			InputDevices: []model.Device{
-				{
-					ID:    model.DeviceID("1"),
-					Group: model.GroupName("foo"),
-				},
-				{
-					ID:    model.DeviceID("2"),
-					Group: model.GroupName("foo"),
-				},
-				{
-					ID:    model.DeviceID("3"),
-					Group: model.GroupName("foo"),
-				},
-				{
-					ID:    model.DeviceID("4"),
-					Group: model.GroupName("bar"),
-				},
-				{
-					ID:    model.DeviceID("5"),
-					Group: model.GroupName(""),
-				},
-			},
-			OutputGroups: []model.GroupName{"foo", "bar"},
+		"ok, grouped devices": {
+			ids:      []model.DeviceID{"1", "2", "3"},
+			expected: []model.GroupName{"bar", "foo"},
 		},
-		"groups foo, bar; with tenant": {
-			InputDevices: []model.Device{
-				{
-					ID:    model.DeviceID("1"),
-					Group: model.GroupName("foo"),
-				},
-				{
-					ID:    model.DeviceID("2"),
-					Group: model.GroupName("foo"),
-				},
-				{
-					ID:    model.DeviceID("3"),
-					Group: model.GroupName("foo"),
-				},
-				{
-					ID:    model.DeviceID("4"),
-					Group: model.GroupName("bar"),
-				},
-				{
-					ID:    model.DeviceID("5"),
-					Group: model.GroupName(""),
-				},
-			},
-			tenant:       "foo",
-			OutputGroups: []model.GroupName{"foo", "bar"},
+		"ok, grouped and ungrouped devices": {
+			ids:      []model.DeviceID{"1", "4", "5", "6"},
+			expected: []model.GroupName{"", "baz", "foo"},
 		},
-		"no groups": {
-			InputDevices: []model.Device{
-				{
-					ID:    model.DeviceID("1"),
-					Group: model.GroupName(""),
-				},
-				{
-					ID:    model.DeviceID("2"),
-					Group: model.GroupName(""),
-				},
-				{
-					ID:    model.DeviceID("3"),
-					Group: model.GroupName(""),
-				},
-			},
-			OutputGroups: []model.GroupName{},
+		"ok, ungrouped devices": {
+			ids:      []model.DeviceID{"5", "6"},
+			expected: []model.GroupName{""},
 		},
-		"no groups; with tenant": {
-			InputDevices: []model.Device{
-				{
-					ID:    model.DeviceID("1"),
-					Group: model.GroupName(""),
-				},
-				{
-					ID:    model.DeviceID("2"),
-					Group: model.GroupName(""),
-				},
-				{
-					ID:    model.DeviceID("3"),
-					Group: model.GroupName(""),
-				},
-			},
-			tenant:       "foo",
-			OutputGroups: []model.GroupName{},
+		"ok, unknown devices": {
+			ids:      []model.DeviceID{"7", "8"},
+			expected: []model.GroupName{},
 		},
-		"ok, filtered result": {
-			InputDevices: []model.Device{
-				{
-					ID:    model.DeviceID("1"),
-					Group: model.GroupName("foo"),
-					Attributes: model.DeviceAttributes{{
-						Scope: model.AttrScopeIdentity,
-						Name:  "status",
-						Value: "accepted",
-					}},
-				},
-				{
-					ID:    model.DeviceID("2"),
-					Group: model.GroupName("foo"),
-					Attributes: model.DeviceAttributes{{
-						Scope: model.AttrScopeIdentity,
-						Name:  "status",
-						Value: "accepted",
-					}},
-				},
-				{
-					ID:    model.DeviceID("3"),
-					Group: model.GroupName("foo"),
-					Attributes: model.DeviceAttributes{{
-						Scope: model.AttrScopeIdentity,
-						Name:  "status",
-						Value: "rejected",
-					}},
-				},
-				{
-					ID:    model.DeviceID("4"),
-					Group: model.GroupName("bar"),
-					Attributes: model.DeviceAttributes{{
-						Scope: model.AttrScopeIdentity,
-						Name:  "status",
-						Value: "noauth",
-					}},
-				},
-				{
-					ID:    model.DeviceID("5"),
-					Group: model.GroupName(""),
-					Attributes: model.DeviceAttributes{{
-						Scope: model.AttrScopeIdentity,
-						Name:  "status",
-						Value: "accepted",
-					}},
-				},
-			},
-			Filters: []model.FilterPredicate{{
-				Attribute: "status",
-				Scope:     model.AttrScopeIdentity,
-				Type:      "$eq",
-				Value:     "accepted",
-			}},
-			tenant:       "foo",
-			OutputGroups: []model.GroupName{"foo"},
-		},
-		"error, bad filter": {
-			InputDevices: []model.Device{{
-				ID:    model.DeviceID("1"),
-				Group: model.GroupName("foo"),
-			}, {
-				ID:    model.DeviceID("2"),
-				Group: model.GroupName("foo"),
-			}, {
-				ID:    model.DeviceID("3"),
-				Group: model.GroupName("foo"),
-			}, {
-				ID:    model.DeviceID("4"),
-				Group: model.GroupName("bar"),
-			}, {
-				ID:    model.DeviceID("5"),
-				Group: model.GroupName(""),
-			}},
-			Filters: []model.FilterPredicate{{
-				Attribute: "status",
-				Scope:     model.AttrScopeIdentity,
-				Type:      "$expr",
-				Value:     "accepted",
-			}},
-			tenant:       "foo",
-			OutputGroups: []model.GroupName{"foo"},
-			Error: errors.New(
-				"store: bad filter predicate: " +
-					"type: must be a valid value.",
-			),
+		"ok, no devices": {
+			ids:      []model.DeviceID{},
+			expected: []model.GroupName{},
 		},
 	}
 
-	for name, testCase := range testCases {
-		t.Run(name, func(t *testing.T) {
-			db.Wipe()
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+	for _, d := range inputDevs {
+		err := mongoStore.AddDevice(ctx, &d)
+		assert.NoError(t, err, "failed to setup input data")
+	}
 
-			client := db.Client()
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			groups, err := mongoStore.GetDevicesDistinctGroups(ctx, tc.ids)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, groups)
+		})
+	}
+}
 
-			var ctx context.Context
-			if testCase.tenant != "" {
-				ctx = identity.WithContext(db.CTX(), &identity.Identity{
-					Tenant: testCase.tenant,
-				})
-			} else {
-				ctx = identity.WithContext(db.CTX(), &identity.Identity{
-					Tenant: "",
-				})
-			}
+func TestMongoGetDevicesAttributesCount(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoGetDevicesAttributesCount in short mode.")
+	}
 
-			for _, d := range testCase.InputDevices {
-				client.Database(mstore.DbFromContext(ctx, DbName)).
-					Collection(DbDevicesColl).
-					InsertOne(ctx, d)
-			}
+	inputDevs := []model.Device{
+		{ID: model.DeviceID("1"), Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+			{Name: "os", Value: "linux", Scope: model.AttrScopeInventory},
+			{Name: "kernel", Value: "6.1", Scope: model.AttrScopeInventory},
+		}},
+		{ID: model.DeviceID("2"), Group: model.GroupName("foo"), Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:22", Scope: model.AttrScopeIdentity},
+		}},
+		{ID: model.DeviceID("3")},
+	}
 
-			// Make sure we start test with empty database
-			store := NewDataStoreMongoWithSession(client)
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+	for _, d := range inputDevs {
+		err := mongoStore.AddDevice(ctx, &d)
+		assert.NoError(t, err, "failed to setup input data")
+	}
+	expected := map[model.DeviceID]int{}
+	for _, d := range inputDevs {
+		dev, err := mongoStore.GetDevice(ctx, d.ID)
+		require.NoError(t, err)
+		expected[d.ID] = len(dev.Attributes)
+	}
+	assert.Greater(t, expected["1"], expected["2"])
 
-			groups, err := store.ListGroups(ctx, testCase.Filters)
-			if testCase.Error != nil {
-				assert.EqualError(t, err, testCase.Error.Error())
-				return
-			}
-			assert.NoError(t, err, "expected no error")
+	testCases := map[string]struct {
+		ids      []model.DeviceID
+		expected map[model.DeviceID]int
+	}{
+		"ok": {
+			ids:      []model.DeviceID{"1", "2", "3"},
+			expected: expected,
+		},
+		"ok, unknown devices left out": {
+			ids:      []model.DeviceID{"2", "4", "5"},
+			expected: map[model.DeviceID]int{"2": expected["2"]},
+		},
+		"ok, no devices": {
+			ids:      []model.DeviceID{},
+			expected: map[model.DeviceID]int{},
+		},
+	}
 
-			if testCase.OutputGroups != nil {
-				assert.Len(t, groups, len(testCase.OutputGroups))
-				for _, eg := range testCase.OutputGroups {
-					assert.Contains(t, groups, eg)
-				}
-			} else {
-				assert.Len(t, groups, 0)
-			}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			counts, err := mongoStore.GetDevicesAttributesCount(ctx, tc.ids)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, counts)
 		})
 	}
 }
 
-func TestGetDevicesByGroup(t *testing.T) {
+func TestMongoGetDevicesPartitionedByGroup(t *testing.T) {
 	if testing.Short() {
-		t.Skip("skipping TestGetDevicesByGroup in short mode.")
+		t.Skip("skipping TestMongoGetDevicesPartitionedByGroup in short mode.")
 	}
 
-	devDevices := []model.Device{
-		{
-			ID:    model.DeviceID("1"),
-			Group: model.GroupName("dev"),
-		},
-		{
-			ID:    model.DeviceID("6"),
-			Group: model.GroupName("dev"),
-		},
-		{
-			ID:    model.DeviceID("8"),
-			Group: model.GroupName("dev"),
-		},
-	}
-	prodDevices := []model.Device{
-		{
-			ID:    model.DeviceID("2"),
-			Group: model.GroupName("prod"),
-		},
-		{
-			ID:    model.DeviceID("4"),
-			Group: model.GroupName("prod"),
-		},
-		{
-			ID:    model.DeviceID("5"),
-			Group: model.GroupName("prod"),
-		},
+	makeDevice := func(id, group, deviceType string) model.Device {
+		return model.Device{
+			ID:    model.DeviceID(id),
+			Group: model.GroupName(group),
+			Attributes: model.DeviceAttributes{
+				{Name: "device_type", Value: deviceType, Scope: model.AttrScopeInventory},
+			},
+		}
 	}
-	testDevices := []model.Device{
-		{
-			ID:    model.DeviceID("3"),
-			Group: model.GroupName("test"),
-		},
-		{
-			ID:    model.DeviceID("7"),
-			Group: model.GroupName("test"),
-		},
+	inputDevs := []model.Device{
+		makeDevice("1", "foo", "rpi3"),
+		makeDevice("2", "bar", "rpi3"),
+		makeDevice("3", "foo", "bbb"),
+		makeDevice("4", "", "rpi3"),
+		makeDevice("5", "foo", "rpi3"),
+		makeDevice("6", "", "bbb"),
 	}
 
-	inputDevices := make([]model.Device, 0, len(devDevices)+len(prodDevices)+len(testDevices))
-	inputDevices = append(inputDevices, devDevices...)
-	inputDevices = append(inputDevices, prodDevices...)
-	inputDevices = append(inputDevices, testDevices...)
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+	for _, d := range inputDevs {
+		err := mongoStore.AddDevice(ctx, &d)
+		require.NoError(t, err, "failed to setup input data")
+	}
 
 	testCases := map[string]struct {
-		InputGroupName    model.GroupName
-		InputSkip         int
-		InputLimit        int
-		OutputDevices     []model.DeviceID
-		OutputDeviceCount int
-		OutputError       error
+		q        store.ListQuery
+		perGroup int
+		expected map[model.GroupName][]model.DeviceID
 	}{
-		"no skip, no limit": {
-			InputGroupName: "dev",
-			InputSkip:      0,
-			InputLimit:     0,
-			OutputDevices: []model.DeviceID{
-				model.DeviceID("1"),
-				model.DeviceID("6"),
-				model.DeviceID("8"),
-			},
-			OutputDeviceCount: len(devDevices),
-			OutputError:       nil,
-		},
-		"no skip, limit": {
-			InputGroupName: "prod",
-			InputSkip:      0,
-			InputLimit:     2,
-			OutputDevices: []model.DeviceID{
-				model.DeviceID("2"),
-				model.DeviceID("4"),
+		"ok, all devices": {
+			expected: map[model.GroupName][]model.DeviceID{
+				"foo": {"1", "3", "5"},
+				"bar": {"2"},
+				"":    {"4", "6"},
 			},
-			OutputDeviceCount: len(prodDevices),
-			OutputError:       nil,
 		},
-		"skip, no limit": {
-			InputGroupName: "dev",
-			InputSkip:      2,
-			InputLimit:     0,
-			OutputDevices: []model.DeviceID{
-				model.DeviceID("8"),
+		"ok, filtered": {
+			q: store.ListQuery{
+				Filters: []store.Filter{{
+					AttrName:  "device_type",
+					AttrScope: model.AttrScopeInventory,
+					Value:     "rpi3",
+					Operator:  store.Eq,
+				}},
 			},
-			OutputDeviceCount: len(devDevices),
-			OutputError:       nil,
-		},
-		"skip + limit": {
-			InputGroupName: "prod",
-			InputSkip:      1,
-			InputLimit:     1,
-			OutputDevices: []model.DeviceID{
-				model.DeviceID("4"),
+			expected: map[model.GroupName][]model.DeviceID{
+				"foo": {"1", "5"},
+				"bar": {"2"},
+				"":    {"4"},
 			},
-			OutputDeviceCount: len(prodDevices),
-			OutputError:       nil,
-		},
-		"no results (past last page)": {
-			InputGroupName:    "dev",
-			InputSkip:         10,
-			InputLimit:        1,
-			OutputDevices:     []model.DeviceID{},
-			OutputDeviceCount: len(devDevices),
-			OutputError:       nil,
-		},
-		"group doesn't exist": {
-			InputGroupName:    "unknown",
-			InputSkip:         0,
-			InputLimit:        0,
-			OutputDevices:     nil,
-			OutputDeviceCount: -1,
-			OutputError:       store.ErrGroupNotFound,
 		},
-		"dev group": {
-			InputGroupName: "dev",
-			InputSkip:      0,
-			InputLimit:     10,
-			OutputDevices: []model.DeviceID{
-				model.DeviceID("1"),
-				model.DeviceID("6"),
-				model.DeviceID("8"),
+		"ok, capped per group": {
+			perGroup: 1,
+			expected: map[model.GroupName][]model.DeviceID{
+				"foo": {"1"},
+				"bar": {"2"},
+				"":    {"4"},
 			},
-			OutputDeviceCount: len(devDevices),
-			OutputError:       nil,
 		},
-		"prod group": {
-			InputGroupName: "prod",
-			InputSkip:      0,
-			InputLimit:     10,
-			OutputDevices: []model.DeviceID{
-				model.DeviceID("2"),
-				model.DeviceID("4"),
-				model.DeviceID("5"),
+		"ok, capped in total": {
+			q: store.ListQuery{Limit: 3},
+			expected: map[model.GroupName][]model.DeviceID{
+				"foo": {"1", "3"},
+				"bar": {"2"},
 			},
-			OutputDeviceCount: len(prodDevices),
-			OutputError:       nil,
 		},
-		"test group": {
-			InputGroupName: "test",
-			InputSkip:      0,
-			InputLimit:     10,
-			OutputDevices: []model.DeviceID{
-				model.DeviceID("3"),
-				model.DeviceID("7"),
-			},
-			OutputDeviceCount: len(testDevices),
-			OutputError:       nil,
+		"ok, no devices": {
+			q:        store.ListQuery{GroupName: "baz"},
+			expected: map[model.GroupName][]model.DeviceID{},
 		},
 	}
 
-	db.Wipe()
-	client := db.Client()
-
-	for _, d := range inputDevices {
-		_, err := client.Database(DbName).Collection(DbDevicesColl).InsertOne(db.CTX(), d)
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			groups, err := mongoStore.GetDevicesPartitionedByGroup(ctx, tc.q, tc.perGroup)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, groups)
+		})
+	}
+}
+
+func TestMongoGetDescribedAttributes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoGetDescribedAttributes in short mode.")
+	}
+
+	inputDevs := []model.Device{
+		{ID: model.DeviceID("1"), Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:11", Description: strPtr("MAC address"),
+				Scope: model.AttrScopeIdentity},
+			{Name: "os", Value: "linux", Scope: model.AttrScopeInventory},
+			{Name: "kernel", Value: "6.1", Description: strPtr(""),
+				Scope: model.AttrScopeInventory},
+		}},
+		{ID: model.DeviceID("2"), Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:22", Description: strPtr("MAC address"),
+				Scope: model.AttrScopeIdentity},
+			{Name: "os", Value: "linux", Scope: model.AttrScopeInventory},
+			{Name: "ip_addr", Value: "1.2.3.4", Description: strPtr("IP address"),
+				Scope: model.AttrScopeInventory},
+		}},
+		{ID: model.DeviceID("3")},
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+	for _, d := range inputDevs {
+		err := mongoStore.AddDevice(ctx, &d)
 		assert.NoError(t, err, "failed to setup input data")
 	}
 
-	for name, tc := range testCases {
-		t.Logf("test case: %s", name)
+	attributes, err := mongoStore.GetDescribedAttributes(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.DescribedAttribute{
+		{Name: "mac", Scope: model.AttrScopeIdentity, Description: "MAC address"},
+		{Name: "ip_addr", Scope: model.AttrScopeInventory, Description: "IP address"},
+	}, attributes)
+}
 
-		store := NewDataStoreMongoWithSession(client)
+func TestMongoGetGroupSchema(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoGetGroupSchema in short mode.")
+	}
 
-		devs, totalCount, err := store.GetDevicesByGroup(db.CTX(), tc.InputGroupName, tc.InputSkip, tc.InputLimit)
+	inputDevs := []model.Device{
+		{ID: model.DeviceID("1"), Group: "prod", Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+			{Name: "uptime", Value: float64(10), Scope: model.AttrScopeInventory},
+			{Name: "ips", Value: []interface{}{"1.2.3.4", "1.2.3.5"},
+				Scope: model.AttrScopeInventory},
+			{Name: "room", Value: "1", Scope: model.AttrScopeTags},
+		}},
+		{ID: model.DeviceID("2"), Group: "prod", Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:22", Scope: model.AttrScopeIdentity},
+			{Name: "uptime", Value: "10h", Scope: model.AttrScopeInventory},
+		}},
+		{ID: model.DeviceID("3"), Group: "dev", Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:33", Scope: model.AttrScopeIdentity},
+			{Name: "kernel", Value: "6.1", Scope: model.AttrScopeInventory},
+		}},
+	}
 
-		if tc.OutputError != nil {
-			assert.EqualError(t, err, tc.OutputError.Error())
-		} else {
-			assert.NoError(t, err, "expected no error")
-			if !reflect.DeepEqual(tc.OutputDevices, devs) {
-				assert.Fail(t, "expected outputDevices to match", fmt.Sprintf("Expected: %v but\n have:%v", tc.OutputDevices, devs))
-			}
-			if !reflect.DeepEqual(tc.OutputDeviceCount, totalCount) {
-				assert.Fail(t, "expected outputDeviceCount to match", fmt.Sprintf("Expected: %v but\n have:%v", tc.OutputDeviceCount, totalCount))
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+	for _, d := range inputDevs {
+		err := mongoStore.AddDevice(ctx, &d)
+		assert.NoError(t, err, "failed to setup input data")
+	}
+
+	attributes, err := mongoStore.GetGroupSchema(ctx, "prod")
+	assert.NoError(t, err)
+	var nonSystem []model.SchemaAttribute
+	for _, attr := range attributes {
+		if attr.Scope == model.AttrScopeSystem {
+			if attr.Name == model.AttrNameGroup {
+				assert.Equal(t, []string{model.AttrTypeString}, attr.Types)
 			}
+			continue
 		}
+		nonSystem = append(nonSystem, attr)
 	}
+	assert.Equal(t, []model.SchemaAttribute{
+		{Name: "mac", Scope: model.AttrScopeIdentity,
+			Types: []string{model.AttrTypeString}},
+		{Name: "ips", Scope: model.AttrScopeInventory,
+			Types: []string{model.AttrTypeArray}},
+		{Name: "uptime", Scope: model.AttrScopeInventory,
+			Types: []string{model.AttrTypeNumber, model.AttrTypeString}},
+		{Name: "room", Scope: model.AttrScopeTags,
+			Types: []string{model.AttrTypeString}},
+	}, nonSystem)
+
+	attributes, err = mongoStore.GetGroupSchema(ctx, "test")
+	assert.NoError(t, err)
+	assert.Empty(t, attributes)
 }
 
-func TestGetDevicesByGroupWithTenant(t *testing.T) {
+func TestMongoGetDevicesStatuses(t *testing.T) {
 	if testing.Short() {
-		t.Skip("skipping TestGetDevicesByGroupWithTenant in short mode.")
+		t.Skip("skipping TestMongoGetDevicesStatuses in short mode.")
 	}
 
-	inputDevices := []model.Device{
-		{
-			ID:    model.DeviceID("1"),
-			Group: model.GroupName("dev"),
-		},
-		{
-			ID:    model.DeviceID("2"),
-			Group: model.GroupName("prod"),
-		},
-		{
-			ID:    model.DeviceID("3"),
-			Group: model.GroupName("test"),
-		},
-		{
-			ID:    model.DeviceID("4"),
-			Group: model.GroupName("prod"),
-		},
-		{
-			ID:    model.DeviceID("5"),
-			Group: model.GroupName("prod"),
-		},
-		{
-			ID:    model.DeviceID("6"),
-			Group: model.GroupName("dev"),
-		},
-		{
-			ID:    model.DeviceID("7"),
-			Group: model.GroupName("test"),
-		},
-		{
-			ID:    model.DeviceID("8"),
-			Group: model.GroupName("dev"),
-		},
+	inputDevs := []model.Device{
+		{ID: model.DeviceID("1"), Attributes: model.DeviceAttributes{
+			{Name: "status", Value: "accepted", Scope: model.AttrScopeIdentity},
+			{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+		}},
+		{ID: model.DeviceID("2"), Attributes: model.DeviceAttributes{
+			{Name: "status", Value: "pending", Scope: model.AttrScopeIdentity},
+		}},
+		{ID: model.DeviceID("3"), Attributes: model.DeviceAttributes{
+			{Name: "status", Value: "ignored", Scope: model.AttrScopeInventory},
+		}},
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+	for _, d := range inputDevs {
+		err := mongoStore.AddDevice(ctx, &d)
+		require.NoError(t, err, "failed to setup input data")
 	}
 
 	testCases := map[string]struct {
-		InputGroupName    model.GroupName
-		InputSkip         int
-		InputLimit        int
-		OutputDevices     []model.DeviceID
-		OutputDeviceCount int
-		OutputError       error
+		ids      []model.DeviceID
+		expected map[model.DeviceID]*string
 	}{
-		"no skip, no limit": {
-			InputGroupName: "dev",
-			InputSkip:      0,
-			InputLimit:     0,
-			OutputDevices: []model.DeviceID{
-				model.DeviceID("1"),
-				model.DeviceID("6"),
-				model.DeviceID("8"),
-			},
-			OutputDeviceCount: 3,
-			OutputError:       nil,
-		},
-		"no skip, limit": {
-			InputGroupName: "prod",
-			InputSkip:      0,
-			InputLimit:     2,
-			OutputDevices: []model.DeviceID{
-				model.DeviceID("2"),
-				model.DeviceID("4"),
-			},
-			OutputDeviceCount: 3,
-			OutputError:       nil,
-		},
-		"skip, no limit": {
-			InputGroupName: "dev",
-			InputSkip:      2,
-			InputLimit:     0,
-			OutputDevices: []model.DeviceID{
-				model.DeviceID("8"),
+		"ok": {
+			ids: []model.DeviceID{"1", "2", "3"},
+			expected: map[model.DeviceID]*string{
+				"1": strPtr("accepted"),
+				"2": strPtr("pending"),
+				"3": nil,
 			},
-			OutputDeviceCount: 3,
-			OutputError:       nil,
 		},
-		"skip + limit": {
-			InputGroupName: "prod",
-			InputSkip:      1,
-			InputLimit:     1,
-			OutputDevices: []model.DeviceID{
-				model.DeviceID("4"),
+		"ok, unknown devices left out": {
+			ids: []model.DeviceID{"2", "4"},
+			expected: map[model.DeviceID]*string{
+				"2": strPtr("pending"),
 			},
-			OutputDeviceCount: 3,
-			OutputError:       nil,
-		},
-		"no results (past last page)": {
-			InputGroupName:    "dev",
-			InputSkip:         10,
-			InputLimit:        1,
-			OutputDevices:     []model.DeviceID{},
-			OutputDeviceCount: 3,
-			OutputError:       nil,
 		},
-		"group doesn't exist": {
-			InputGroupName:    "unknown",
-			InputSkip:         0,
-			InputLimit:        0,
-			OutputDevices:     nil,
-			OutputDeviceCount: -1,
-			OutputError:       store.ErrGroupNotFound,
+		"ok, no devices": {
+			ids:      []model.DeviceID{},
+			expected: map[model.DeviceID]*string{},
 		},
 	}
 
-	db.Wipe()
-	client := db.Client()
-
-	for _, d := range inputDevices {
-		_, err := client.Database(DbName+"-foo").Collection(DbDevicesColl).InsertOne(db.CTX(), d)
-		assert.NoError(t, err, "failed to setup input data")
-	}
-
 	for name, tc := range testCases {
-		t.Logf("test case: %s", name)
-
-		store := NewDataStoreMongoWithSession(client)
-
-		ctx := identity.WithContext(db.CTX(), &identity.Identity{
-			Tenant: "foo",
+		t.Run(name, func(t *testing.T) {
+			statuses, err := mongoStore.GetDevicesStatuses(ctx, tc.ids)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, statuses)
 		})
-		devs, totalCount, err := store.GetDevicesByGroup(ctx, tc.InputGroupName, tc.InputSkip, tc.InputLimit)
-
-		if tc.OutputError != nil {
-			assert.EqualError(t, err, tc.OutputError.Error())
-		} else {
-			assert.NoError(t, err, "expected no error")
-			if !reflect.DeepEqual(tc.OutputDevices, devs) {
-				assert.Fail(t, "expected outputDevices to match", fmt.Sprintf("Expected: %v but\n have:%v", tc.OutputDevices, devs))
-			}
-			if !reflect.DeepEqual(tc.OutputDeviceCount, totalCount) {
-				assert.Fail(t, "expected outputDeviceCount to match", fmt.Sprintf("Expected: %v but\n have:%v", tc.OutputDeviceCount, totalCount))
-			}
-		}
 	}
 }
 
-func TestGetDeviceGroup(t *testing.T) {
+func TestMongoCountDevicesCreatedPerDay(t *testing.T) {
 	if testing.Short() {
-		t.Skip("skipping TestGetDeviceGroup in short mode.")
+		t.Skip("skipping TestMongoCountDevicesCreatedPerDay in short mode.")
 	}
 
-	inputDevices := []model.Device{
-		{
-			ID:    model.DeviceID("1"),
-			Group: model.GroupName("dev"),
-		},
-		{
-			ID: model.DeviceID("2"),
-		},
+	db.Wipe()
+	ctx := db.CTX()
+	client := db.Client()
+	mongoStore := NewDataStoreMongoWithSession(client)
+
+	created := []time.Time{
+		time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, 3, 1, 23, 59, 0, 0, time.UTC),
+		time.Date(2023, 3, 3, 12, 0, 0, 0, time.UTC),
+		time.Date(2023, 3, 10, 12, 0, 0, 0, time.UTC),
+	}
+	for n, ts := range created {
+		_, err := client.Database(DbName).Collection(DbDevicesColl).InsertOne(ctx, bson.M{
+			DbDevId: strconv.Itoa(n),
+			DbDevAttributes: bson.M{
+				model.AttrScopeSystem + "-" + model.AttrNameCreated: bson.M{
+					DbDevAttributesName:  model.AttrNameCreated,
+					DbDevAttributesScope: model.AttrScopeSystem,
+					DbDevAttributesValue: ts,
+				},
+			},
+		})
+		require.NoError(t, err, "failed to setup input data")
 	}
 
 	testCases := map[string]struct {
-		InputDeviceID model.DeviceID
-		OutputGroup   model.GroupName
-		OutputError   error
+		from, to time.Time
+		expected map[time.Time]int
 	}{
-		"dev has group": {
-			InputDeviceID: model.DeviceID("1"),
-			OutputGroup:   model.GroupName("dev"),
-			OutputError:   nil,
-		},
-		"dev has no group": {
-			InputDeviceID: model.DeviceID("2"),
-			OutputGroup:   "",
-			OutputError:   nil,
+		"ok": {
+			from: time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC),
+			to:   time.Date(2023, 3, 10, 0, 0, 0, 0, time.UTC),
+			expected: map[time.Time]int{
+				time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC): 2,
+				time.Date(2023, 3, 3, 0, 0, 0, 0, time.UTC): 1,
+			},
 		},
-		"dev doesn't exist": {
-			InputDeviceID: model.DeviceID("3"),
-			OutputGroup:   "",
-			OutputError:   store.ErrDevNotFound,
+		"ok, empty range": {
+			from:     time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC),
+			to:       time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC),
+			expected: map[time.Time]int{},
 		},
 	}
 
-	db.Wipe()
-	client := db.Client()
-	store := NewDataStoreMongoWithSession(client)
-	for _, dev := range inputDevices {
-		err := store.AddDevice(db.CTX(), &dev)
-		assert.NoError(t, err, "failed to setup input data")
-	}
-
 	for name, tc := range testCases {
 		t.Run(name, func(t *testing.T) {
-			group, err := store.GetDeviceGroup(
-				db.CTX(), tc.InputDeviceID,
-			)
-			if tc.OutputError != nil {
-				assert.EqualError(t, err, tc.OutputError.Error())
-			} else {
-				assert.NoError(t, err, "expected no error")
-				if !assert.Equal(t, tc.OutputGroup, group) {
-					time.Sleep(time.Minute * 5)
-				}
-			}
+			counts, err := mongoStore.CountDevicesCreatedPerDay(ctx, tc.from, tc.to)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, counts)
 		})
 	}
 }
 
-func TestGetDeviceGroupWithTenant(t *testing.T) {
+func TestMongoCountDevicesByAlertCount(t *testing.T) {
 	if testing.Short() {
-		t.Skip("skipping TestGetDeviceGroupWithTenant in short mode.")
+		t.Skip("skipping TestMongoCountDevicesByAlertCount in short mode.")
 	}
 
-	inputDevices := []model.Device{
-		{
-			ID:    model.DeviceID("1"),
-			Group: model.GroupName("dev"),
-		},
-		{
-			ID: model.DeviceID("2"),
-		},
-	}
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
 
-	testCases := map[string]struct {
-		InputDeviceID model.DeviceID
-		OutputGroup   model.GroupName
-		OutputError   error
-	}{
-		"dev has group": {
-			InputDeviceID: model.DeviceID("1"),
-			OutputGroup:   model.GroupName("dev"),
-			OutputError:   nil,
-		},
-		"dev has no group": {
-			InputDeviceID: model.DeviceID("2"),
-			OutputGroup:   "",
-			OutputError:   nil,
-		},
-		"dev doesn't exist": {
-			InputDeviceID: model.DeviceID("3"),
-			OutputGroup:   "",
-			OutputError:   store.ErrDevNotFound,
-		},
+	counts, err := mongoStore.CountDevicesByAlertCount(ctx, model.AttrScopeMonitor)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{}, counts)
+
+	// the device without alert count counts as having no alerts
+	alertCounts := []interface{}{nil, 0, 0, 1, 3, 5, 6, 42}
+	for n, alertCount := range alertCounts {
+		dev := &model.Device{ID: model.DeviceID(strconv.Itoa(n))}
+		if alertCount != nil {
+			dev.Attributes = model.DeviceAttributes{{
+				Name:  model.AttrNameNumberOfAlerts,
+				Value: alertCount,
+				Scope: model.AttrScopeMonitor,
+			}}
+		}
+		err := mongoStore.AddDevice(ctx, dev)
+		require.NoError(t, err, "failed to setup input data")
+	}
+
+	counts, err = mongoStore.CountDevicesByAlertCount(ctx, model.AttrScopeMonitor)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{
+		model.AlertCountBucketNone: 3,
+		model.AlertCountBucketFew:  3,
+		model.AlertCountBucketMany: 2,
+	}, counts)
+
+	counts, err = mongoStore.CountDevicesByAlertCount(ctx, "alerts")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{
+		model.AlertCountBucketNone: len(alertCounts),
+	}, counts)
+}
+
+func TestMongoFeatureFlags(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoFeatureFlags in short mode.")
 	}
 
 	db.Wipe()
-	client := db.Client()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+	ctxFoo := identity.WithContext(db.CTX(), &identity.Identity{Tenant: "foo"})
+	ctxBar := identity.WithContext(db.CTX(), &identity.Identity{Tenant: "bar"})
 
-	for _, d := range inputDevices {
-		_, err := client.Database(DbName+"-foo").Collection(DbDevicesColl).InsertOne(db.CTX(), d)
-		assert.NoError(t, err, "failed to setup input data")
+	flags, err := mongoStore.GetFeatureFlags(ctxFoo)
+	assert.NoError(t, err)
+	assert.Equal(t, model.FeatureFlags{}, flags)
+
+	err = mongoStore.SetFeatureFlags(ctxFoo, model.FeatureFlags{
+		model.FeatureAddDeviceCreateOnly:       true,
+		model.FeatureNullAttributeValueRemoves: true,
+	})
+	assert.NoError(t, err)
+	err = mongoStore.SetFeatureFlags(ctxFoo, model.FeatureFlags{
+		model.FeatureAddDeviceCreateOnly: true,
+	})
+	assert.NoError(t, err)
+	err = mongoStore.SetFeatureFlags(ctxBar, model.FeatureFlags{
+		model.FeatureAddDeviceCreateOnly: false,
+	})
+	assert.NoError(t, err)
+
+	flags, err = mongoStore.GetFeatureFlags(ctxFoo)
+	assert.NoError(t, err)
+	assert.Equal(t, model.FeatureFlags{model.FeatureAddDeviceCreateOnly: true}, flags)
+
+	flags, err = mongoStore.GetFeatureFlags(ctxBar)
+	assert.NoError(t, err)
+	assert.Equal(t, model.FeatureFlags{model.FeatureAddDeviceCreateOnly: false}, flags)
+}
+
+func TestMongoFindDevicesByAttributeValues(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoFindDevicesByAttributeValues in short mode.")
 	}
 
-	for name, tc := range testCases {
-		t.Logf("test case: %s", name)
+	inputDevs := []model.Device{
+		{ID: model.DeviceID("1"), Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+			{Name: "cpus", Value: float64(4), Scope: model.AttrScopeInventory},
+		}},
+		{ID: model.DeviceID("2"), Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:22", Scope: model.AttrScopeIdentity},
+			{Name: "cpus", Value: float64(2), Scope: model.AttrScopeInventory},
+		}},
+		{ID: model.DeviceID("3"), Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:33", Scope: model.AttrScopeInventory},
+		}},
+	}
 
-		store := NewDataStoreMongoWithSession(client)
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+	for _, d := range inputDevs {
+		err := mongoStore.AddDevice(ctx, &d)
+		assert.NoError(t, err, "failed to setup input data")
+	}
 
-		ctx := identity.WithContext(db.CTX(), &identity.Identity{
-			Tenant: "foo",
-		})
-		group, err := store.GetDeviceGroup(ctx, tc.InputDeviceID)
+	testCases := map[string]struct {
+		scope  string
+		name   string
+		values []interface{}
+		ids    []model.DeviceID
+	}{
+		"ok, multiple values": {
+			scope:  model.AttrScopeIdentity,
+			name:   "mac",
+			values: []interface{}{"00:22", "00:11", "00:33"},
+			ids:    []model.DeviceID{"1", "2"},
+		},
+		"ok, numeric value": {
+			scope:  model.AttrScopeInventory,
+			name:   "cpus",
+			values: []interface{}{float64(2)},
+			ids:    []model.DeviceID{"2"},
+		},
+		"ok, no match": {
+			scope:  model.AttrScopeIdentity,
+			name:   "mac",
+			values: []interface{}{"00:44"},
+			ids:    []model.DeviceID{},
+		},
+		"ok, no values": {
+			scope: model.AttrScopeIdentity,
+			name:  "mac",
+			ids:   []model.DeviceID{},
+		},
+	}
 
-		if tc.OutputError != nil {
-			assert.EqualError(t, err, tc.OutputError.Error())
-		} else {
-			assert.NoError(t, err, "expected no error")
-			assert.Equal(t, tc.OutputGroup, group)
-		}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			devs, err := mongoStore.FindDevicesByAttributeValues(
+				ctx, tc.scope, tc.name, tc.values)
+			assert.NoError(t, err)
+			ids := []model.DeviceID{}
+			for _, d := range devs {
+				ids = append(ids, d.ID)
+			}
+			assert.Equal(t, tc.ids, ids)
+		})
 	}
 }
 
-func TestMigrate(t *testing.T) {
+func TestMongoFindDevicesWithAttributeDrift(t *testing.T) {
 	if testing.Short() {
-		t.Skip("skipping TestMigrate in short mode.")
+		t.Skip("skipping TestMongoFindDevicesWithAttributeDrift in short mode.")
 	}
 
-	someDevs := []model.Device{
-		{
-			ID: model.DeviceID("0"),
-			Attributes: model.DeviceAttributes{
-				{Name: "mac", Value: "foo", Description: strPtr("desc"), Scope: model.AttrScopeInventory},
-				{Name: "sn", Value: "bar", Description: strPtr("desc"), Scope: model.AttrScopeInventory},
-			},
+	inputDevs := []model.Device{
+		{ID: model.DeviceID("1"), Attributes: model.DeviceAttributes{
+			{Name: "kernel", Value: "5.15", Scope: model.AttrScopeInventory},
+			{Name: "cpus", Value: float64(4), Scope: model.AttrScopeInventory},
+		}},
+		{ID: model.DeviceID("2"), Attributes: model.DeviceAttributes{
+			{Name: "kernel", Value: "6.1", Scope: model.AttrScopeInventory},
+			{Name: "cpus", Value: float64(2), Scope: model.AttrScopeInventory},
+		}},
+		{ID: model.DeviceID("3"), Attributes: model.DeviceAttributes{
+			{Name: "kernel", Value: "5.10", Scope: model.AttrScopeInventory},
+		}},
+		{ID: model.DeviceID("4"), Attributes: model.DeviceAttributes{
+			{Name: "kernel", Value: "5.10", Scope: model.AttrScopeTags},
+		}},
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+	for _, d := range inputDevs {
+		err := mongoStore.AddDevice(ctx, &d)
+		assert.NoError(t, err, "failed to setup input data")
+	}
+
+	testCases := map[string]struct {
+		scope string
+		name  string
+		value interface{}
+		ids   []model.DeviceID
+	}{
+		"ok, drifted devices": {
+			scope: model.AttrScopeInventory,
+			name:  "kernel",
+			value: "5.15",
+			ids:   []model.DeviceID{"2", "3"},
 		},
-		{
-			ID: model.DeviceID("1"),
-			Attributes: model.DeviceAttributes{
-				{Name: "mac", Value: "foo", Description: strPtr("desc"), Scope: model.AttrScopeInventory},
-				{Name: "foo", Value: "foo", Description: strPtr("desc"), Scope: model.AttrScopeInventory},
-				{Name: "bar", Value: "bar", Description: strPtr("desc"), Scope: model.AttrScopeInventory},
-			},
+		"ok, numeric value, devices without the attribute left out": {
+			scope: model.AttrScopeInventory,
+			name:  "cpus",
+			value: float64(4),
+			ids:   []model.DeviceID{"2"},
 		},
-		{
-			ID: model.DeviceID("2"),
+		"ok, no drift": {
+			scope: model.AttrScopeTags,
+			name:  "kernel",
+			value: "5.10",
+			ids:   []model.DeviceID{},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			devs, err := mongoStore.FindDevicesWithAttributeDrift(
+				ctx, tc.scope, tc.name, tc.value)
+			assert.NoError(t, err)
+			ids := []model.DeviceID{}
+			for _, d := range devs {
+				ids = append(ids, d.ID)
+			}
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+}
+
+func TestMongoFacetByAttributeFiltered(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoFacetByAttributeFiltered in short mode.")
+	}
+
+	makeDevice := func(id, status, deviceType string) model.Device {
+		return model.Device{
+			ID: model.DeviceID(id),
 			Attributes: model.DeviceAttributes{
-				{Name: "baz", Value: "baz", Description: strPtr("desc"), Scope: model.AttrScopeInventory},
+				{Name: "status", Value: status, Scope: model.AttrScopeIdentity},
+				{Name: "device_type", Value: deviceType, Scope: model.AttrScopeInventory},
 			},
-		},
+		}
+	}
+	inputDevs := []model.Device{
+		makeDevice("1", "accepted", "rpi3"),
+		makeDevice("2", "accepted", "rpi3"),
+		makeDevice("3", "accepted", "bbb"),
+		makeDevice("4", "pending", "bbb"),
+		makeDevice("5", "pending", "bbb"),
+		makeDevice("6", "rejected", "qemu"),
+		{ID: model.DeviceID("7")},
 	}
 
 	testCases := map[string]struct {
-		versionFrom string
-		inDevs      []model.Device
-		automigrate bool
-		tenant      string
-
-		outVers []string
-		err     error
+		filters  []model.FilterPredicate
+		expected []model.AttributeValueCount
+		err      string
 	}{
-		"from no version (fresh db)": {
-			versionFrom: "",
-			automigrate: true,
-
-			outVers: []string{
-				"0.2.0",
-				"1.0.0",
-				"1.0.1",
-				"1.0.2",
-				DbVersion,
+		"ok, unfiltered": {
+			expected: []model.AttributeValueCount{
+				{Value: "bbb", Count: 3},
+				{Value: "rpi3", Count: 2},
+				{Value: "qemu", Count: 1},
 			},
 		},
-		"from 0.1.0 (first, dummy migration)": {
-			versionFrom: "0.1.0",
-			automigrate: true,
-
-			outVers: []string{
-				"0.1.0",
-				"0.2.0",
-				"1.0.0",
-				"1.0.1",
-				"1.0.2",
-				DbVersion,
+		"ok, filtered": {
+			filters: []model.FilterPredicate{{
+				Scope:     model.AttrScopeIdentity,
+				Attribute: "status",
+				Type:      "$eq",
+				Value:     "accepted",
+			}},
+			expected: []model.AttributeValueCount{
+				{Value: "rpi3", Count: 2},
+				{Value: "bbb", Count: 1},
 			},
 		},
-		"from 0.1.0, no-automigrate": {
-			versionFrom: "0.0.0",
-
-			err: errors.New("failed to apply migrations: db needs migration: inventory has version 0.0.0, needs version " + DbVersion),
+		"ok, no matching devices": {
+			filters: []model.FilterPredicate{{
+				Scope:     model.AttrScopeIdentity,
+				Attribute: "status",
+				Type:      "$eq",
+				Value:     "noauth",
+			}},
+			expected: []model.AttributeValueCount{},
 		},
-		"with devices, from 0.1.0": {
-			versionFrom: "0.1.0",
-			inDevs:      someDevs,
-			automigrate: true,
+		"error, invalid operator": {
+			filters: []model.FilterPredicate{{
+				Scope:     model.AttrScopeIdentity,
+				Attribute: "status",
+				Type:      "$where",
+				Value:     "sleep(1000)",
+			}},
+			err: "type: must be a valid value.",
+		},
+	}
 
-			outVers: []string{
-				"0.1.0",
-				"0.2.0",
-				"1.0.0",
-				"1.0.1",
-				"1.0.2",
-				DbVersion,
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+	for _, d := range inputDevs {
+		err := mongoStore.AddDevice(ctx, &d)
+		assert.NoError(t, err, "failed to setup input data")
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			buckets, err := mongoStore.FacetByAttributeFiltered(ctx,
+				model.AttrScopeInventory, "device_type", tc.filters)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, buckets)
+		})
+	}
+}
+
+func TestMongoTopAttributeValues(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoTopAttributeValues in short mode.")
+	}
+
+	// skewed distribution: 5 rpi4, 3 rpi3, 2 bbb, 1 qemu
+	deviceTypes := []string{
+		"rpi4", "rpi3", "bbb", "rpi4", "qemu", "rpi4",
+		"rpi3", "rpi4", "bbb", "rpi3", "rpi4",
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+	for i, deviceType := range deviceTypes {
+		err := mongoStore.AddDevice(ctx, &model.Device{
+			ID: model.DeviceID(strconv.Itoa(i)),
+			Attributes: model.DeviceAttributes{
+				{Name: "device_type", Value: deviceType, Scope: model.AttrScopeInventory},
 			},
-		},
-		"with devices, from 0.1.0, with tenant": {
-			versionFrom: "",
-			inDevs:      someDevs,
-			automigrate: true,
-			tenant:      "tenant",
+		})
+		require.NoError(t, err, "failed to setup input data")
+	}
+	err := mongoStore.AddDevice(ctx, &model.Device{ID: model.DeviceID("no-type")})
+	require.NoError(t, err, "failed to setup input data")
 
-			outVers: []string{
-				"0.2.0",
-				"1.0.0",
-				"1.0.1",
-				"1.0.2",
-				DbVersion,
+	testCases := map[string]struct {
+		name     string
+		limit    int
+		expected []model.AttributeValueCount
+	}{
+		"ok": {
+			name:  "device_type",
+			limit: 10,
+			expected: []model.AttributeValueCount{
+				{Value: "rpi4", Count: 5},
+				{Value: "rpi3", Count: 3},
+				{Value: "bbb", Count: 2},
+				{Value: "qemu", Count: 1},
 			},
 		},
-		"with devices, from 0.1.0, with tenant, other devs": {
-			versionFrom: "0.1.0",
-			inDevs:      []model.Device{someDevs[0], someDevs[2]},
-			automigrate: true,
-			tenant:      "tenant",
-
-			outVers: []string{
-				"0.1.0",
-				"0.2.0",
-				"1.0.0",
-				"1.0.1",
-				"1.0.2",
-				DbVersion,
+		"ok, limited": {
+			name:  "device_type",
+			limit: 2,
+			expected: []model.AttributeValueCount{
+				{Value: "rpi4", Count: 5},
+				{Value: "rpi3", Count: 3},
 			},
 		},
+		"ok, unknown attribute": {
+			name:     "unknown",
+			limit:    10,
+			expected: []model.AttributeValueCount{},
+		},
 	}
 
 	for name, tc := range testCases {
 		t.Run(name, func(t *testing.T) {
-			db.Wipe()
+			values, err := mongoStore.TopAttributeValues(ctx,
+				model.AttrScopeInventory, tc.name, tc.limit)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, values)
+		})
+	}
+}
 
-			client := db.Client()
+func TestMongoSearchDevicesRoundedFloats(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoSearchDevicesRoundedFloats in short mode.")
+	}
 
-			var ctx context.Context
-			if tc.tenant != "" {
-				ctx = identity.WithContext(db.CTX(), &identity.Identity{
-					Tenant: tc.tenant,
-				})
-			} else {
-				ctx = identity.WithContext(db.CTX(), &identity.Identity{
-					Tenant: "",
-				})
-			}
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
 
-			store := NewDataStoreMongoWithSession(client)
+	reported := []float64{21.456789, 21.4612, 3.14159}
+	for i, temp := range reported {
+		attrs := model.DeviceAttributes{
+			{Name: "temp", Value: temp, Scope: model.AttrScopeInventory},
+		}
+		_, err := mongoStore.UpsertDevicesAttributes(ctx,
+			[]model.DeviceID{model.DeviceID(strconv.Itoa(i))},
+			attrs.RoundFloats(2),
+		)
+		require.NoError(t, err, "failed to setup input data")
+	}
 
-			if tc.automigrate {
-				store = store.WithAutomigrate()
-			}
+	search := func(value float64) []model.Device {
+		devs, _, err := mongoStore.SearchDevices(ctx, model.SearchParams{
+			Page:    1,
+			PerPage: 10,
+			Filters: []model.FilterPredicate{{
+				Scope:     model.AttrScopeInventory,
+				Attribute: "temp",
+				Type:      "$eq",
+				Value:     value,
+			}},
+		})
+		require.NoError(t, err)
+		return devs
+	}
 
-			// prep input data
-			// input migrations
-			if tc.versionFrom != "" {
-				v, err := migrate.NewVersion(tc.versionFrom)
-				assert.NoError(t, err)
+	// both values reported with excessive precision match the rounded one
+	devs := search(21.46)
+	require.Len(t, devs, 2)
+	assert.Equal(t, model.DeviceID("0"), devs[0].ID)
+	assert.Equal(t, model.DeviceID("1"), devs[1].ID)
 
-				entry := migrate.MigrationEntry{
-					Version: *v,
-				}
-				assert.NoError(t, err)
+	assert.Len(t, search(3.14), 1)
+	assert.Empty(t, search(3.14159))
+}
 
-				_, err = client.
-					Database(mstore.DbFromContext(ctx, DbName)).
-					Collection(migrate.DbMigrationsColl).
-					InsertOne(ctx, entry)
-				assert.NoError(t, err)
-			}
+func TestMongoSearchDevicesTrimmedStrings(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoSearchDevicesTrimmedStrings in short mode.")
+	}
 
-			// input devices
-			for _, d := range tc.inDevs {
-				err := store.AddDevice(ctx, &d)
-				assert.NoError(t, err)
-			}
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
 
-			err := store.Migrate(ctx, DbVersion)
-			if tc.err == nil {
-				assert.NoError(t, err)
+	reported := [][]interface{}{
+		{" a.example.com", "b.example.com\n"},
+		{"c.example.com ", " b.example.com"},
+	}
+	for i, hosts := range reported {
+		attrs := model.DeviceAttributes{
+			{Name: "hosts", Value: hosts, Scope: model.AttrScopeInventory},
+		}
+		_, err := mongoStore.UpsertDevicesAttributes(ctx,
+			[]model.DeviceID{model.DeviceID(strconv.Itoa(i))},
+			attrs.TrimStrings([]string{model.AttrScopeInventory}),
+		)
+		require.NoError(t, err, "failed to setup input data")
+	}
 
-				// verify migration entries
-				var out []migrate.MigrationEntry
-				cursor, _ := client.
-					Database(mstore.DbFromContext(ctx, DbName)).
-					Collection(migrate.DbMigrationsColl).
-					Find(ctx, bson.M{})
+	search := func(typ string, value interface{}) []model.Device {
+		devs, _, err := mongoStore.SearchDevices(ctx, model.SearchParams{
+			Page:    1,
+			PerPage: 10,
+			Filters: []model.FilterPredicate{{
+				Scope:     model.AttrScopeInventory,
+				Attribute: "hosts",
+				Type:      typ,
+				Value:     value,
+			}},
+		})
+		require.NoError(t, err)
+		return devs
+	}
 
-				count := 0
-				for cursor.Next(db.CTX()) {
-					var res migrate.MigrationEntry
-					count++
-					err = cursor.Decode(&res)
-					out = append(out, res)
-				}
+	// the elements reported with whitespace match the trimmed values
+	devs := search("$eq", "b.example.com")
+	require.Len(t, devs, 2)
+	assert.Equal(t, model.DeviceID("0"), devs[0].ID)
+	assert.Equal(t, model.DeviceID("1"), devs[1].ID)
 
-				assert.Equal(t, len(tc.outVers), count)
-				for i, v := range tc.outVers {
-					assert.Equal(t, v, out[i].Version.String())
-				}
-			} else {
-				assert.EqualError(t, err, tc.err.Error())
+	assert.Len(t, search("$in", []interface{}{"a.example.com", "unknown"}), 1)
+	assert.Empty(t, search("$eq", " a.example.com"))
+}
+
+func TestMongoSearchDevicesScore(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoSearchDevicesScore in short mode.")
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+
+	devices := map[model.DeviceID]model.DeviceAttributes{
+		"0": {
+			{Name: "alerts", Value: float64(1), Scope: model.AttrScopeMonitor},
+			{Name: "uptime", Value: float64(10), Scope: model.AttrScopeInventory},
+		},
+		"1": {
+			{Name: "alerts", Value: float64(3), Scope: model.AttrScopeMonitor},
+			{Name: "uptime", Value: float64(100), Scope: model.AttrScopeInventory},
+		},
+		// non-numeric values don't contribute to the score
+		"2": {
+			{Name: "alerts", Value: float64(2), Scope: model.AttrScopeMonitor},
+			{Name: "uptime", Value: "n/a", Scope: model.AttrScopeInventory},
+		},
+		"3": {
+			{Name: "device_type", Value: "rpi4", Scope: model.AttrScopeInventory},
+		},
+	}
+	for id, attrs := range devices {
+		_, err := mongoStore.UpsertDevicesAttributes(ctx, []model.DeviceID{id}, attrs)
+		require.NoError(t, err, "failed to setup input data")
+	}
+
+	score := []model.ScoreTerm{
+		{Scope: model.AttrScopeMonitor, Attribute: "alerts", Weight: 2},
+		{Scope: model.AttrScopeInventory, Attribute: "uptime", Weight: -0.1},
+	}
+	expected := []struct {
+		id    model.DeviceID
+		score float64
+	}{
+		{"2", 4},
+		{"0", 1},
+		{"3", 0},
+		{"1", -4},
+	}
+
+	for name, attributes := range map[string][]model.SelectAttribute{
+		"all attributes": nil,
+		"selected attributes": {
+			{Scope: model.AttrScopeInventory, Attribute: "uptime"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			devs, count, err := mongoStore.SearchDevices(ctx, model.SearchParams{
+				Page:       1,
+				PerPage:    10,
+				Score:      score,
+				Attributes: attributes,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, len(expected), count)
+			require.Len(t, devs, len(expected))
+			for i, exp := range expected {
+				assert.Equal(t, exp.id, devs[i].ID)
+				require.NotNil(t, devs[i].Score)
+				assert.InDelta(t, exp.score, *devs[i].Score, 1e-9)
 			}
 		})
 	}
 }
 
-func TestMongoDeleteDevices(t *testing.T) {
+func TestMongoSampleDevices(t *testing.T) {
 	if testing.Short() {
-		t.Skip("skipping TestMongoDeleteDevice in short mode.")
+		t.Skip("skipping TestMongoSampleDevices in short mode.")
 	}
 
-	inputDevs := []model.Device{
-		{ID: model.DeviceID("0")},
-		{ID: model.DeviceID("1")},
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+
+	for i := 0; i < 10; i++ {
+		deviceType := "rpi4"
+		if i%2 == 1 {
+			deviceType = "bbb"
+		}
+		err := mongoStore.AddDevice(ctx, &model.Device{
+			ID: model.DeviceID(strconv.Itoa(i)),
+			Attributes: model.DeviceAttributes{
+				{Name: "device_type", Value: deviceType, Scope: model.AttrScopeInventory},
+			},
+		})
+		require.NoError(t, err, "failed to setup input data")
 	}
+	bbb := []model.FilterPredicate{{
+		Scope:     model.AttrScopeInventory,
+		Attribute: "device_type",
+		Type:      "$eq",
+		Value:     "bbb",
+	}}
 
 	testCases := map[string]struct {
-		inputIDs []model.DeviceID
-		expected []model.Device
-		err      error
-		result   model.UpdateResult
+		n       int
+		filters []model.FilterPredicate
+
+		size int
 	}{
-		"existing 1": {
-			inputIDs: []model.DeviceID{"0"},
-			expected: []model.Device{
-				{ID: model.DeviceID("1")},
-			},
-			err: nil,
-			result: model.UpdateResult{
-				DeletedCount: 1,
-			},
-		},
-		"delete all": {
-			inputIDs: []model.DeviceID{"0", "1"},
-			expected: []model.Device(nil),
-			err:      nil,
-			result: model.UpdateResult{
-				DeletedCount: 2,
-			},
-		},
-		"doesn't exist": {
-			inputIDs: []model.DeviceID{"3"},
-			expected: []model.Device{
-				{ID: model.DeviceID("0")},
-				{ID: model.DeviceID("1")},
-			},
-			result: model.UpdateResult{
-				DeletedCount: 0,
-			},
+		"ok, bounded by n": {
+			n:    3,
+			size: 3,
+		},
+		"ok, filtered": {
+			n:       3,
+			filters: bbb,
+			size:    3,
+		},
+		"ok, pool smaller than n": {
+			n:       8,
+			filters: bbb,
+			size:    5,
+		},
+		"ok, no match": {
+			n: 3,
+			filters: []model.FilterPredicate{{
+				Scope:     model.AttrScopeInventory,
+				Attribute: "device_type",
+				Type:      "$eq",
+				Value:     "qemux86-64",
+			}},
+			size: 0,
 		},
 	}
 
 	for name, tc := range testCases {
-		t.Logf("test case: %s", name)
 		t.Run(name, func(t *testing.T) {
+			devices, err := mongoStore.SampleDevices(ctx, tc.n, tc.filters)
+			require.NoError(t, err)
+			assert.Len(t, devices, tc.size)
+
+			seen := map[model.DeviceID]bool{}
+			for _, device := range devices {
+				assert.False(t, seen[device.ID], "device sampled twice")
+				seen[device.ID] = true
+				if tc.filters == nil {
+					continue
+				}
+				for _, attr := range device.Attributes {
+					if attr.Name == "device_type" {
+						assert.Equal(t, "bbb", attr.Value)
+					}
+				}
+			}
+		})
+	}
+}
 
-			// Make sure we start test with empty database
-			db.Wipe()
+func TestMongoIngestHash(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoIngestHash in short mode.")
+	}
 
-			client := db.Client()
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+
+	hash, err := mongoStore.GetIngestHash(ctx, "1")
+	require.NoError(t, err)
+	assert.Empty(t, hash)
+
+	err = mongoStore.SetIngestHash(ctx, "1", "abc", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	hash, err = mongoStore.GetIngestHash(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", hash)
+
+	hash, err = mongoStore.GetIngestHash(ctx, "2")
+	require.NoError(t, err)
+	assert.Empty(t, hash)
+
+	// the expired hashes are ignored before the TTL monitor removes them
+	err = mongoStore.SetIngestHash(ctx, "1", "def", time.Now().Add(-time.Second))
+	require.NoError(t, err)
+	hash, err = mongoStore.GetIngestHash(ctx, "1")
+	require.NoError(t, err)
+	assert.Empty(t, hash)
+}
 
-			for _, d := range inputDevs {
-				_, err := client.Database(DbName).
-					Collection(DbDevicesColl).
-					InsertOne(db.CTX(), d)
-				assert.NoError(t, err, "failed to setup input data")
-			}
+func TestMongoSavedFilters(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoSavedFilters in short mode.")
+	}
 
-			store := NewDataStoreMongoWithSession(client)
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
 
-			//test
-			result, err := store.DeleteDevices(db.CTX(), tc.inputIDs)
-			if tc.err != nil {
-				assert.EqualError(t, err, tc.err.Error())
-			} else {
-				assert.NoError(t, err, "failed to delete device")
-				if assert.NotNil(t, result) {
-					assert.Equal(t, tc.result, *result)
-				}
+	for i, deviceType := range []string{"rpi4", "bbb", "rpi4"} {
+		err := mongoStore.AddDevice(ctx, &model.Device{
+			ID: model.DeviceID(strconv.Itoa(i)),
+			Attributes: model.DeviceAttributes{
+				{Name: "device_type", Value: deviceType, Scope: model.AttrScopeInventory},
+			},
+		})
+		require.NoError(t, err, "failed to setup input data")
+	}
 
-				var outDevs []model.Device
-				cursor, err := client.Database(DbName).
-					Collection(DbDevicesColl).
-					Find(db.CTX(), bson.M{})
-				assert.NoError(t, err, "failed to verify devices")
-				cursor.All(nil, &outDevs)
-				assert.Equal(t, tc.expected, outDevs)
-			}
+	rpi := &model.SavedFilter{
+		ID:   "1",
+		Name: "rpi",
+		Filters: []model.FilterPredicate{{
+			Scope:     model.AttrScopeInventory,
+			Attribute: "device_type",
+			Type:      "$eq",
+			Value:     "rpi4",
+		}},
+	}
+	bbb := &model.SavedFilter{
+		ID:   "2",
+		Name: "bbb",
+		Filters: []model.FilterPredicate{{
+			Scope:     model.AttrScopeInventory,
+			Attribute: "device_type",
+			Type:      "$in",
+			Value:     []interface{}{"bbb"},
+		}},
+	}
+	require.NoError(t, mongoStore.CreateSavedFilter(ctx, rpi))
+	require.NoError(t, mongoStore.CreateSavedFilter(ctx, bbb))
+
+	filters, err := mongoStore.ListSavedFilters(ctx)
+	require.NoError(t, err)
+	require.Len(t, filters, 2)
+	assert.Equal(t, "bbb", filters[0].Name)
+	assert.Equal(t, "rpi", filters[1].Name)
+
+	// the saved predicates match the same devices as inline ones
+	filter, err := mongoStore.GetSavedFilter(ctx, "2")
+	require.NoError(t, err)
+	devs, count, err := mongoStore.SearchDevices(ctx, model.SearchParams{
+		Page:    1,
+		PerPage: 10,
+		Filters: filter.Filters,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	require.Len(t, devs, 1)
+	assert.Equal(t, model.DeviceID("1"), devs[0].ID)
+
+	rpi.Name = "raspberry"
+	require.NoError(t, mongoStore.UpdateSavedFilter(ctx, rpi))
+	filter, err = mongoStore.GetSavedFilter(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "raspberry", filter.Name)
+
+	require.NoError(t, mongoStore.DeleteSavedFilter(ctx, "1"))
+	_, err = mongoStore.GetSavedFilter(ctx, "1")
+	assert.Equal(t, store.ErrFilterNotFound, err)
+	err = mongoStore.UpdateSavedFilter(ctx, rpi)
+	assert.Equal(t, store.ErrFilterNotFound, err)
+	err = mongoStore.DeleteSavedFilter(ctx, "1")
+	assert.Equal(t, store.ErrFilterNotFound, err)
+}
+
+func TestMongoCountDevicesByAttribute(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoCountDevicesByAttribute in short mode.")
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	store := NewDataStoreMongoWithSession(db.Client())
+
+	counts, total, err := store.CountDevicesByAttribute(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, total)
+	assert.Empty(t, counts)
+
+	for i := 0; i < 4; i++ {
+		attrs := model.DeviceAttributes{
+			{Name: "mac", Value: strconv.Itoa(i), Scope: model.AttrScopeIdentity},
+		}
+		if i < 3 {
+			attrs = append(attrs, model.DeviceAttribute{
+				Name: "device_type", Value: "rpi4", Scope: model.AttrScopeInventory,
+			})
+		}
+		if i == 0 {
+			attrs = append(attrs, model.DeviceAttribute{
+				Name: "foo", Value: "bar", Scope: model.AttrScopeTags,
+			})
+		}
+		err := store.AddDevice(ctx, &model.Device{
+			ID:         model.DeviceID(strconv.Itoa(i)),
+			Attributes: attrs,
 		})
+		require.NoError(t, err, "failed to setup input data")
+	}
+
+	counts, total, err = store.CountDevicesByAttribute(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 4, total)
+
+	nonSystem := []model.AttributeCoverage{}
+	for _, count := range counts {
+		if count.Scope != model.AttrScopeSystem {
+			nonSystem = append(nonSystem, count)
+		}
 	}
+	assert.Equal(t, []model.AttributeCoverage{
+		{Name: "mac", Scope: model.AttrScopeIdentity, Count: 4},
+		{Name: "device_type", Scope: model.AttrScopeInventory, Count: 3},
+		{Name: "foo", Scope: model.AttrScopeTags, Count: 1},
+	}, nonSystem)
 }
 
-func TestMongoSearchDevices(t *testing.T) {
+func TestMongoGetAttributeScopes(t *testing.T) {
 	if testing.Short() {
-		t.Skip("skipping TestMongoSearchDevices in short mode.")
+		t.Skip("skipping TestMongoGetAttributeScopes in short mode.")
 	}
 
-	now := time.Now()
-	before := now.Add(-time.Hour)
-	inputDevs := []model.Device{
-		{
-			ID: model.DeviceID("0"),
-			Attributes: model.DeviceAttributes{
-				{Name: "MAC", Value: "000", Description: strPtr("MAC"), Scope: model.AttrScopeInventory},
-				{Name: "SN", Value: float64(100), Description: strPtr("SN"), Scope: model.AttrScopeInventory},
-				{Name: "group", Value: "foo", Description: strPtr("group"), Scope: model.AttrScopeInventory},
-				{Name: "ip.address", Value: "1.2.3.4", Scope: model.AttrScopeInventory},
-				{Name: "name", Value: "device0", Scope: model.AttrScopeTags, Timestamp: &now},
-			},
-			Group:     "foo",
-			CreatedTs: now,
-			UpdatedTs: &now,
+	db.Wipe()
+	ctx := db.CTX()
+	store := NewDataStoreMongoWithSession(db.Client())
+
+	scopes, err := store.GetAttributeScopes(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, scopes)
+
+	inputDevs := []model.Device{{
+		ID: "1",
+		Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+			{Name: "device-type", Value: "rpi4", Scope: model.AttrScopeInventory},
 		},
+	}, {
+		ID: "2",
+		Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:22", Scope: model.AttrScopeIdentity},
+			{Name: "foo", Value: "bar", Scope: model.AttrScopeTags},
+			{Name: "alerts", Value: true, Scope: model.AttrScopeMonitor},
+		},
+	}}
+	for _, d := range inputDevs {
+		err := store.AddDevice(ctx, &d)
+		require.NoError(t, err, "failed to setup input data")
+	}
+
+	scopes, err = store.GetAttributeScopes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		model.AttrScopeIdentity,
+		model.AttrScopeInventory,
+		model.AttrScopeMonitor,
+		model.AttrScopeSystem,
+		model.AttrScopeTags,
+	}, scopes)
+}
+
+func TestMongoAttributeCardinality(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoAttributeCardinality in short mode.")
+	}
+
+	inputDevs := []model.DeviceAttributes{
 		{
-			ID: model.DeviceID("1"),
-			Attributes: model.DeviceAttributes{
-				{Name: "MAC", Value: "001", Description: strPtr("MAC"), Scope: model.AttrScopeInventory},
-				{Name: "SN", Value: float64(111), Description: strPtr("SN"), Scope: model.AttrScopeInventory},
-				{Name: "group", Value: "foo", Description: strPtr("group"), Scope: model.AttrScopeInventory},
-				{Name: "name", Value: "device1", Scope: model.AttrScopeTags, Timestamp: &before},
-			},
-			Group:     "foo",
-			CreatedTs: now,
-			UpdatedTs: &now,
+			{Name: "device_type", Value: "rpi4", Scope: model.AttrScopeInventory},
+			{Name: "ips", Value: []interface{}{"1.1.1.1", "1.1.1.2"},
+				Scope: model.AttrScopeInventory},
+			{Name: "room", Value: "1", Scope: model.AttrScopeTags},
 		},
 		{
-			ID: model.DeviceID("2"),
-			Attributes: model.DeviceAttributes{
-				{Name: "MAC", Value: "002", Description: strPtr("MAC"), Scope: model.AttrScopeInventory},
-				{Name: "SN", Value: float64(122), Description: strPtr("SN"), Scope: model.AttrScopeInventory},
-				{Name: "group", Value: "foo", Description: strPtr("group"), Scope: model.AttrScopeInventory},
-				{Name: "name", Value: "device2", Scope: model.AttrScopeTags, Timestamp: &now},
-			},
-			Group:     "foo",
-			CreatedTs: now,
-			UpdatedTs: &now,
+			{Name: "device_type", Value: "rpi4", Scope: model.AttrScopeInventory},
+			{Name: "ips", Value: []interface{}{"1.1.1.2", "1.1.1.3"},
+				Scope: model.AttrScopeInventory},
+			{Name: "room", Value: "2", Scope: model.AttrScopeTags},
 		},
 		{
-			ID: model.DeviceID("3"),
-			Attributes: model.DeviceAttributes{
-				{Name: "MAC", Value: "003", Description: strPtr("MAC"), Scope: model.AttrScopeInventory},
-				{Name: "SN", Value: float64(133), Description: strPtr("SN"), Scope: model.AttrScopeInventory},
-				{Name: "group", Value: "bar", Description: strPtr("group"), Scope: model.AttrScopeInventory},
-				{Name: "name", Value: "device3", Scope: model.AttrScopeTags, Timestamp: &now},
-			},
-			Group:     "bar",
-			CreatedTs: now,
-			UpdatedTs: &now,
+			{Name: "device_type", Value: "bbb", Scope: model.AttrScopeInventory},
+			{Name: "room", Value: "3", Scope: model.AttrScopeTags},
 		},
 		{
-			ID: model.DeviceID("4"),
-			Attributes: model.DeviceAttributes{
-				{Name: "MAC", Value: "003", Description: strPtr("MAC"), Scope: model.AttrScopeInventory},
-				{Name: "SN", Value: float64(144), Description: strPtr("SN"), Scope: model.AttrScopeInventory},
-				{Name: "group", Value: "bar", Description: strPtr("group"), Scope: model.AttrScopeInventory},
-				{Name: "text", Value: "this is a free-text searchable attribute", Scope: model.AttrScopeInventory},
-				{Name: "name", Value: "device4", Scope: model.AttrScopeTags, Timestamp: &now},
-			},
-			Group:     "bar",
-			CreatedTs: now,
-			UpdatedTs: &now,
+			{Name: "device_type", Value: "rpi4", Scope: model.AttrScopeInventory},
+			{Name: "uptime", Value: float64(10), Scope: model.AttrScopeInventory},
 		},
+		{},
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+	for i, attrs := range inputDevs {
+		err := mongoStore.AddDevice(ctx, &model.Device{
+			ID:         model.DeviceID(strconv.Itoa(i)),
+			Attributes: attrs,
+		})
+		require.NoError(t, err, "failed to setup input data")
 	}
 
 	testCases := map[string]struct {
-		expected           []model.Device
-		expectedAttributes model.DeviceAttributes
-		devTotal           int
-		searchParams       model.SearchParams
-		tenant             string
-		dbError            error
+		scope    string
+		name     string
+		expected int
 	}{
-		"single filter, single device": {
-			expected: []model.Device{inputDevs[0]},
-			devTotal: 1,
-			searchParams: model.SearchParams{
-				Page:    1,
-				PerPage: 5,
+		"ok": {
+			scope:    model.AttrScopeInventory,
+			name:     "device_type",
+			expected: 2,
+		},
+		"ok, array values": {
+			scope:    model.AttrScopeInventory,
+			name:     "ips",
+			expected: 3,
+		},
+		"ok, tags": {
+			scope:    model.AttrScopeTags,
+			name:     "room",
+			expected: 3,
+		},
+		"ok, single value": {
+			scope:    model.AttrScopeInventory,
+			name:     "uptime",
+			expected: 1,
+		},
+		"ok, unknown attribute": {
+			scope:    model.AttrScopeInventory,
+			name:     "unknown",
+			expected: 0,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cardinality, err := mongoStore.AttributeCardinality(ctx, tc.scope, tc.name)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, cardinality)
+		})
+	}
+}
+
+func TestMongoAttributesChurn(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoAttributesChurn in short mode.")
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+
+	churn, err := mongoStore.GetAttributesChurn(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.AttributeChurn{}, churn)
+
+	uptime := model.DeviceAttribute{
+		Name: "uptime", Value: 1, Scope: model.AttrScopeInventory,
+	}
+	mac := model.DeviceAttribute{
+		Name: "mac", Value: "00:11", Scope: model.AttrScopeInventory,
+	}
+	tag := model.DeviceAttribute{
+		Name: "uptime", Value: "x", Scope: model.AttrScopeTags,
+	}
+	for _, attrs := range []model.DeviceAttributes{
+		{uptime, mac},
+		{uptime},
+		{uptime, tag},
+		{},
+	} {
+		err := mongoStore.IncrementAttributesChurn(ctx, attrs)
+		assert.NoError(t, err)
+	}
+
+	churn, err = mongoStore.GetAttributesChurn(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.AttributeChurn{
+		{Name: "uptime", Scope: model.AttrScopeInventory, Count: 3},
+		{Name: "mac", Scope: model.AttrScopeInventory, Count: 1},
+		{Name: "uptime", Scope: model.AttrScopeTags, Count: 1},
+	}, churn)
+}
+
+func TestMongoStreamAllDevicesAcrossTenants(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoStreamAllDevicesAcrossTenants in short mode.")
+	}
+
+	inputDevs := map[string][]model.DeviceID{
+		"":        {"0"},
+		"tenant1": {"1", "2"},
+		"tenant2": {"3"},
+	}
+
+	db.Wipe()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+	for tenantID, ids := range inputDevs {
+		ctx := db.CTX()
+		if tenantID != "" {
+			ctx = identity.WithContext(ctx, &identity.Identity{
+				Tenant: tenantID,
+			})
+		}
+		for _, id := range ids {
+			err := mongoStore.AddDevice(ctx, &model.Device{ID: id})
+			assert.NoError(t, err, "failed to setup input data")
+		}
+	}
+
+	streamed := map[string][]model.DeviceID{}
+	collect := func(dev model.TenantDevice) error {
+		streamed[dev.TenantID] = append(streamed[dev.TenantID], dev.Device.ID)
+		return nil
+	}
+
+	err := mongoStore.StreamAllDevicesAcrossTenants(db.CTX(), collect)
+	assert.ErrorIs(t, err, store.ErrAdminAccessRequired)
+
+	err = mongoStore.WithAdminAccess().
+		StreamAllDevicesAcrossTenants(db.CTX(), collect)
+	assert.NoError(t, err)
+	assert.Len(t, streamed, len(inputDevs))
+	for tenantID, ids := range inputDevs {
+		assert.ElementsMatch(t, ids, streamed[tenantID])
+	}
+
+	// the error of the callback stops the stream and is returned
+	calls := 0
+	err = mongoStore.WithAdminAccess().StreamAllDevicesAcrossTenants(db.CTX(),
+		func(model.TenantDevice) error {
+			calls++
+			return errors.New("stop")
+		})
+	assert.EqualError(t, err, "stop")
+	assert.Equal(t, 1, calls)
+}
+
+func TestMongoPurgeScopeByRetention(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoPurgeScopeByRetention in short mode.")
+	}
+
+	db.Wipe()
+	ctx := identity.WithContext(db.CTX(), &identity.Identity{
+		Tenant: "tenant1",
+	})
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+
+	old := time.Now().Add(-48 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+	inputDevs := map[model.DeviceID]model.DeviceAttributes{
+		"1": {
+			{Name: "cpu", Value: 90.0, Scope: model.AttrScopeMonitor, Timestamp: &old},
+			{Name: "mem", Value: 40.0, Scope: model.AttrScopeMonitor, Timestamp: &recent},
+			{Name: "fw", Value: "1.0", Scope: model.AttrScopeInventory, Timestamp: &old},
+		},
+		"2": {
+			{Name: "cpu", Value: 10.0, Scope: model.AttrScopeMonitor, Timestamp: &recent},
+			{Name: "alerts", Value: 1.0, Scope: model.AttrScopeMonitor},
+		},
+		"3": {
+			{Name: "cpu", Value: 20.0, Scope: model.AttrScopeMonitor, Timestamp: &old},
+		},
+	}
+	for id, attrs := range inputDevs {
+		err := mongoStore.AddDevice(ctx, &model.Device{ID: id, Attributes: attrs})
+		require.NoError(t, err, "failed to setup input data")
+	}
+
+	_, err := mongoStore.PurgeScopeByRetention(ctx,
+		model.AttrScopeIdentity, 24*time.Hour, "tenant1")
+	assert.ErrorIs(t, err, store.ErrScopeNotPurgeable)
+
+	purged, err := mongoStore.PurgeScopeByRetention(ctx,
+		model.AttrScopeMonitor, 24*time.Hour, "tenant1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, purged)
+
+	kept := map[model.DeviceID][]string{
+		"1": {"monitor/mem", "inventory/fw"},
+		"2": {"monitor/cpu", "monitor/alerts"},
+		"3": {},
+	}
+	for id, names := range kept {
+		dev, err := mongoStore.GetDevice(ctx, id)
+		require.NoError(t, err)
+		require.NotNil(t, dev)
+		actual := []string{}
+		for _, attr := range dev.Attributes {
+			if attr.Scope == model.AttrScopeSystem {
+				continue
+			}
+			actual = append(actual, attr.Scope+"/"+attr.Name)
+		}
+		assert.ElementsMatch(t, names, actual, "device %s", id)
+	}
+
+	// the purge is idempotent
+	purged, err = mongoStore.PurgeScopeByRetention(ctx,
+		model.AttrScopeMonitor, 24*time.Hour, "tenant1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, purged)
+}
+
+func TestMongoListGroups(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoListGroups in short mode.")
+	}
+
+	testCases := map[string]struct {
+		InputDevices []model.Device
+		Filters      []model.FilterPredicate
+		tenant       string
+		OutputGroups []model.GroupName
+		Error        error
+	}{
+		"groups foo, bar": {
+			InputDevices: []model.Device{
+				{
+					ID:    model.DeviceID("1"),
+					Group: model.GroupName("foo"),
+				},
+				{
+					ID:    model.DeviceID("2"),
+					Group: model.GroupName("foo"),
+				},
+				{
+					ID:    model.DeviceID("3"),
+					Group: model.GroupName("foo"),
+				},
+				{
+					ID:    model.DeviceID("4"),
+					Group: model.GroupName("bar"),
+				},
+				{
+					ID:    model.DeviceID("5"),
+					Group: model.GroupName(""),
+				},
+			},
+			OutputGroups: []model.GroupName{"foo", "bar"},
+		},
+		"groups foo, bar; with tenant": {
+			InputDevices: []model.Device{
+				{
+					ID:    model.DeviceID("1"),
+					Group: model.GroupName("foo"),
+				},
+				{
+					ID:    model.DeviceID("2"),
+					Group: model.GroupName("foo"),
+				},
+				{
+					ID:    model.DeviceID("3"),
+					Group: model.GroupName("foo"),
+				},
+				{
+					ID:    model.DeviceID("4"),
+					Group: model.GroupName("bar"),
+				},
+				{
+					ID:    model.DeviceID("5"),
+					Group: model.GroupName(""),
+				},
+			},
+			tenant:       "foo",
+			OutputGroups: []model.GroupName{"foo", "bar"},
+		},
+		"no groups": {
+			InputDevices: []model.Device{
+				{
+					ID:    model.DeviceID("1"),
+					Group: model.GroupName(""),
+				},
+				{
+					ID:    model.DeviceID("2"),
+					Group: model.GroupName(""),
+				},
+				{
+					ID:    model.DeviceID("3"),
+					Group: model.GroupName(""),
+				},
+			},
+			OutputGroups: []model.GroupName{},
+		},
+		"no groups; with tenant": {
+			InputDevices: []model.Device{
+				{
+					ID:    model.DeviceID("1"),
+					Group: model.GroupName(""),
+				},
+				{
+					ID:    model.DeviceID("2"),
+					Group: model.GroupName(""),
+				},
+				{
+					ID:    model.DeviceID("3"),
+					Group: model.GroupName(""),
+				},
+			},
+			tenant:       "foo",
+			OutputGroups: []model.GroupName{},
+		},
+		"ok, filtered result": {
+			InputDevices: []model.Device{
+				{
+					ID:    model.DeviceID("1"),
+					Group: model.GroupName("foo"),
+					Attributes: model.DeviceAttributes{{
+						Scope: model.AttrScopeIdentity,
+						Name:  "status",
+						Value: "accepted",
+					}},
+				},
+				{
+					ID:    model.DeviceID("2"),
+					Group: model.GroupName("foo"),
+					Attributes: model.DeviceAttributes{{
+						Scope: model.AttrScopeIdentity,
+						Name:  "status",
+						Value: "accepted",
+					}},
+				},
+				{
+					ID:    model.DeviceID("3"),
+					Group: model.GroupName("foo"),
+					Attributes: model.DeviceAttributes{{
+						Scope: model.AttrScopeIdentity,
+						Name:  "status",
+						Value: "rejected",
+					}},
+				},
+				{
+					ID:    model.DeviceID("4"),
+					Group: model.GroupName("bar"),
+					Attributes: model.DeviceAttributes{{
+						Scope: model.AttrScopeIdentity,
+						Name:  "status",
+						Value: "noauth",
+					}},
+				},
+				{
+					ID:    model.DeviceID("5"),
+					Group: model.GroupName(""),
+					Attributes: model.DeviceAttributes{{
+						Scope: model.AttrScopeIdentity,
+						Name:  "status",
+						Value: "accepted",
+					}},
+				},
+			},
+			Filters: []model.FilterPredicate{{
+				Attribute: "status",
+				Scope:     model.AttrScopeIdentity,
+				Type:      "$eq",
+				Value:     "accepted",
+			}},
+			tenant:       "foo",
+			OutputGroups: []model.GroupName{"foo"},
+		},
+		"error, bad filter": {
+			InputDevices: []model.Device{{
+				ID:    model.DeviceID("1"),
+				Group: model.GroupName("foo"),
+			}, {
+				ID:    model.DeviceID("2"),
+				Group: model.GroupName("foo"),
+			}, {
+				ID:    model.DeviceID("3"),
+				Group: model.GroupName("foo"),
+			}, {
+				ID:    model.DeviceID("4"),
+				Group: model.GroupName("bar"),
+			}, {
+				ID:    model.DeviceID("5"),
+				Group: model.GroupName(""),
+			}},
+			Filters: []model.FilterPredicate{{
+				Attribute: "status",
+				Scope:     model.AttrScopeIdentity,
+				Type:      "$expr",
+				Value:     "accepted",
+			}},
+			tenant:       "foo",
+			OutputGroups: []model.GroupName{"foo"},
+			Error: errors.New(
+				"store: bad filter predicate: " +
+					"type: must be a valid value.",
+			),
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db.Wipe()
+
+			client := db.Client()
+
+			var ctx context.Context
+			if testCase.tenant != "" {
+				ctx = identity.WithContext(db.CTX(), &identity.Identity{
+					Tenant: testCase.tenant,
+				})
+			} else {
+				ctx = identity.WithContext(db.CTX(), &identity.Identity{
+					Tenant: "",
+				})
+			}
+
+			for _, d := range testCase.InputDevices {
+				client.Database(mstore.DbFromContext(ctx, DbName)).
+					Collection(DbDevicesColl).
+					InsertOne(ctx, d)
+			}
+
+			// Make sure we start test with empty database
+			store := NewDataStoreMongoWithSession(client)
+
+			groups, totalCount, err := store.ListGroups(ctx, testCase.Filters, 0, 0)
+			if testCase.Error != nil {
+				assert.EqualError(t, err, testCase.Error.Error())
+				return
+			}
+			assert.NoError(t, err, "expected no error")
+			assert.Equal(t, len(groups), totalCount)
+
+			if testCase.OutputGroups != nil {
+				assert.Len(t, groups, len(testCase.OutputGroups))
+				for _, eg := range testCase.OutputGroups {
+					assert.Contains(t, groups, eg)
+				}
+			} else {
+				assert.Len(t, groups, 0)
+			}
+		})
+	}
+}
+
+func TestMongoListGroupsPaging(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoListGroupsPaging in short mode.")
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	store := NewDataStoreMongoWithSession(db.Client())
+	for i, group := range []model.GroupName{"delta", "alpha", "charlie", "bravo", "alpha"} {
+		err := store.AddDevice(ctx, &model.Device{
+			ID:    model.DeviceID(strconv.Itoa(i)),
+			Group: group,
+		})
+		require.NoError(t, err)
+	}
+	err := store.AddDevice(ctx, &model.Device{ID: "ungrouped"})
+	require.NoError(t, err)
+
+	testCases := map[string]struct {
+		skip  int
+		limit int
+
+		groups []model.GroupName
+	}{
+		"all": {
+			groups: []model.GroupName{"alpha", "bravo", "charlie", "delta"},
+		},
+		"first page": {
+			limit:  3,
+			groups: []model.GroupName{"alpha", "bravo", "charlie"},
+		},
+		"last page": {
+			skip:   3,
+			limit:  3,
+			groups: []model.GroupName{"delta"},
+		},
+		"past the last page": {
+			skip:   6,
+			limit:  3,
+			groups: []model.GroupName{},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			groups, totalCount, err := store.ListGroups(ctx, nil, tc.skip, tc.limit)
+			require.NoError(t, err)
+			assert.Equal(t, tc.groups, groups)
+			assert.Equal(t, 4, totalCount)
+		})
+	}
+}
+
+func TestGetDevicesByGroup(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestGetDevicesByGroup in short mode.")
+	}
+
+	devDevices := []model.Device{
+		{
+			ID:    model.DeviceID("1"),
+			Group: model.GroupName("dev"),
+		},
+		{
+			ID:    model.DeviceID("6"),
+			Group: model.GroupName("dev"),
+		},
+		{
+			ID:    model.DeviceID("8"),
+			Group: model.GroupName("dev"),
+		},
+	}
+	prodDevices := []model.Device{
+		{
+			ID:    model.DeviceID("2"),
+			Group: model.GroupName("prod"),
+		},
+		{
+			ID:    model.DeviceID("4"),
+			Group: model.GroupName("prod"),
+		},
+		{
+			ID:    model.DeviceID("5"),
+			Group: model.GroupName("prod"),
+		},
+	}
+	testDevices := []model.Device{
+		{
+			ID:    model.DeviceID("3"),
+			Group: model.GroupName("test"),
+		},
+		{
+			ID:    model.DeviceID("7"),
+			Group: model.GroupName("test"),
+		},
+	}
+
+	inputDevices := make([]model.Device, 0, len(devDevices)+len(prodDevices)+len(testDevices))
+	inputDevices = append(inputDevices, devDevices...)
+	inputDevices = append(inputDevices, prodDevices...)
+	inputDevices = append(inputDevices, testDevices...)
+
+	testCases := map[string]struct {
+		InputGroupName    model.GroupName
+		InputSkip         int
+		InputLimit        int
+		OutputDevices     []model.DeviceID
+		OutputDeviceCount int
+		OutputError       error
+	}{
+		"no skip, no limit": {
+			InputGroupName: "dev",
+			InputSkip:      0,
+			InputLimit:     0,
+			OutputDevices: []model.DeviceID{
+				model.DeviceID("1"),
+				model.DeviceID("6"),
+				model.DeviceID("8"),
+			},
+			OutputDeviceCount: len(devDevices),
+			OutputError:       nil,
+		},
+		"no skip, limit": {
+			InputGroupName: "prod",
+			InputSkip:      0,
+			InputLimit:     2,
+			OutputDevices: []model.DeviceID{
+				model.DeviceID("2"),
+				model.DeviceID("4"),
+			},
+			OutputDeviceCount: len(prodDevices),
+			OutputError:       nil,
+		},
+		"skip, no limit": {
+			InputGroupName: "dev",
+			InputSkip:      2,
+			InputLimit:     0,
+			OutputDevices: []model.DeviceID{
+				model.DeviceID("8"),
+			},
+			OutputDeviceCount: len(devDevices),
+			OutputError:       nil,
+		},
+		"skip + limit": {
+			InputGroupName: "prod",
+			InputSkip:      1,
+			InputLimit:     1,
+			OutputDevices: []model.DeviceID{
+				model.DeviceID("4"),
+			},
+			OutputDeviceCount: len(prodDevices),
+			OutputError:       nil,
+		},
+		"no results (past last page)": {
+			InputGroupName:    "dev",
+			InputSkip:         10,
+			InputLimit:        1,
+			OutputDevices:     []model.DeviceID{},
+			OutputDeviceCount: len(devDevices),
+			OutputError:       nil,
+		},
+		"group doesn't exist": {
+			InputGroupName:    "unknown",
+			InputSkip:         0,
+			InputLimit:        0,
+			OutputDevices:     nil,
+			OutputDeviceCount: -1,
+			OutputError:       store.ErrGroupNotFound,
+		},
+		"dev group": {
+			InputGroupName: "dev",
+			InputSkip:      0,
+			InputLimit:     10,
+			OutputDevices: []model.DeviceID{
+				model.DeviceID("1"),
+				model.DeviceID("6"),
+				model.DeviceID("8"),
+			},
+			OutputDeviceCount: len(devDevices),
+			OutputError:       nil,
+		},
+		"prod group": {
+			InputGroupName: "prod",
+			InputSkip:      0,
+			InputLimit:     10,
+			OutputDevices: []model.DeviceID{
+				model.DeviceID("2"),
+				model.DeviceID("4"),
+				model.DeviceID("5"),
+			},
+			OutputDeviceCount: len(prodDevices),
+			OutputError:       nil,
+		},
+		"test group": {
+			InputGroupName: "test",
+			InputSkip:      0,
+			InputLimit:     10,
+			OutputDevices: []model.DeviceID{
+				model.DeviceID("3"),
+				model.DeviceID("7"),
+			},
+			OutputDeviceCount: len(testDevices),
+			OutputError:       nil,
+		},
+	}
+
+	db.Wipe()
+	client := db.Client()
+
+	for _, d := range inputDevices {
+		_, err := client.Database(DbName).Collection(DbDevicesColl).InsertOne(db.CTX(), d)
+		assert.NoError(t, err, "failed to setup input data")
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+
+		store := NewDataStoreMongoWithSession(client)
+
+		devs, totalCount, err := store.GetDevicesByGroup(db.CTX(), tc.InputGroupName, tc.InputSkip, tc.InputLimit)
+
+		if tc.OutputError != nil {
+			assert.EqualError(t, err, tc.OutputError.Error())
+		} else {
+			assert.NoError(t, err, "expected no error")
+			if !reflect.DeepEqual(tc.OutputDevices, devs) {
+				assert.Fail(t, "expected outputDevices to match", fmt.Sprintf("Expected: %v but\n have:%v", tc.OutputDevices, devs))
+			}
+			if !reflect.DeepEqual(tc.OutputDeviceCount, totalCount) {
+				assert.Fail(t, "expected outputDeviceCount to match", fmt.Sprintf("Expected: %v but\n have:%v", tc.OutputDeviceCount, totalCount))
+			}
+		}
+	}
+}
+
+func TestGetDevicesByGroupWithAttributes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestGetDevicesByGroupWithAttributes in short mode.")
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+
+	for _, dev := range []model.Device{
+		{ID: "1", Group: "prod"},
+		{ID: "2", Group: "prod"},
+		{ID: "3", Group: "dev"},
+	} {
+		dev.Attributes = model.DeviceAttributes{
+			{Name: "mac", Value: "mac-" + string(dev.ID), Scope: model.AttrScopeIdentity},
+			{Name: "os.name", Value: "linux", Scope: model.AttrScopeInventory},
+			{Name: "kernel", Value: "6.1", Scope: model.AttrScopeInventory},
+			{Name: "room", Value: "1", Scope: model.AttrScopeTags},
+		}
+		err := mongoStore.AddDevice(ctx, &dev)
+		require.NoError(t, err, "failed to setup input data")
+	}
+
+	devs, totalCount, err := mongoStore.GetDevicesByGroupWithAttributes(
+		ctx, "prod", 0, 10, []model.SelectAttribute{
+			{Scope: model.AttrScopeIdentity, Attribute: "mac"},
+			{Scope: model.AttrScopeInventory, Attribute: "os.name"},
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, totalCount)
+	if assert.Len(t, devs, 2) {
+		for _, dev := range devs {
+			assert.Contains(t, []model.DeviceID{"1", "2"}, dev.ID)
+			names := make(map[string]bool)
+			for _, attr := range dev.Attributes {
+				names[attr.Scope+"/"+attr.Name] = true
+			}
+			assert.Equal(t, map[string]bool{
+				model.AttrScopeIdentity + "/mac":                    true,
+				model.AttrScopeInventory + "/os.name":               true,
+				model.AttrScopeSystem + "/" + model.AttrNameCreated: true,
+				model.AttrScopeSystem + "/" + model.AttrNameUpdated: true,
+			}, names)
+			assert.False(t, dev.CreatedTs.IsZero())
+			assert.NotNil(t, dev.UpdatedTs)
+		}
+	}
+
+	_, _, err = mongoStore.GetDevicesByGroupWithAttributes(
+		ctx, "test", 0, 10, []model.SelectAttribute{
+			{Scope: model.AttrScopeIdentity, Attribute: "mac"},
+		})
+	assert.EqualError(t, err, store.ErrGroupNotFound.Error())
+}
+
+func TestGetDevicesByGroupWithTenant(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestGetDevicesByGroupWithTenant in short mode.")
+	}
+
+	inputDevices := []model.Device{
+		{
+			ID:    model.DeviceID("1"),
+			Group: model.GroupName("dev"),
+		},
+		{
+			ID:    model.DeviceID("2"),
+			Group: model.GroupName("prod"),
+		},
+		{
+			ID:    model.DeviceID("3"),
+			Group: model.GroupName("test"),
+		},
+		{
+			ID:    model.DeviceID("4"),
+			Group: model.GroupName("prod"),
+		},
+		{
+			ID:    model.DeviceID("5"),
+			Group: model.GroupName("prod"),
+		},
+		{
+			ID:    model.DeviceID("6"),
+			Group: model.GroupName("dev"),
+		},
+		{
+			ID:    model.DeviceID("7"),
+			Group: model.GroupName("test"),
+		},
+		{
+			ID:    model.DeviceID("8"),
+			Group: model.GroupName("dev"),
+		},
+	}
+
+	testCases := map[string]struct {
+		InputGroupName    model.GroupName
+		InputSkip         int
+		InputLimit        int
+		OutputDevices     []model.DeviceID
+		OutputDeviceCount int
+		OutputError       error
+	}{
+		"no skip, no limit": {
+			InputGroupName: "dev",
+			InputSkip:      0,
+			InputLimit:     0,
+			OutputDevices: []model.DeviceID{
+				model.DeviceID("1"),
+				model.DeviceID("6"),
+				model.DeviceID("8"),
+			},
+			OutputDeviceCount: 3,
+			OutputError:       nil,
+		},
+		"no skip, limit": {
+			InputGroupName: "prod",
+			InputSkip:      0,
+			InputLimit:     2,
+			OutputDevices: []model.DeviceID{
+				model.DeviceID("2"),
+				model.DeviceID("4"),
+			},
+			OutputDeviceCount: 3,
+			OutputError:       nil,
+		},
+		"skip, no limit": {
+			InputGroupName: "dev",
+			InputSkip:      2,
+			InputLimit:     0,
+			OutputDevices: []model.DeviceID{
+				model.DeviceID("8"),
+			},
+			OutputDeviceCount: 3,
+			OutputError:       nil,
+		},
+		"skip + limit": {
+			InputGroupName: "prod",
+			InputSkip:      1,
+			InputLimit:     1,
+			OutputDevices: []model.DeviceID{
+				model.DeviceID("4"),
+			},
+			OutputDeviceCount: 3,
+			OutputError:       nil,
+		},
+		"no results (past last page)": {
+			InputGroupName:    "dev",
+			InputSkip:         10,
+			InputLimit:        1,
+			OutputDevices:     []model.DeviceID{},
+			OutputDeviceCount: 3,
+			OutputError:       nil,
+		},
+		"group doesn't exist": {
+			InputGroupName:    "unknown",
+			InputSkip:         0,
+			InputLimit:        0,
+			OutputDevices:     nil,
+			OutputDeviceCount: -1,
+			OutputError:       store.ErrGroupNotFound,
+		},
+	}
+
+	db.Wipe()
+	client := db.Client()
+
+	for _, d := range inputDevices {
+		_, err := client.Database(DbName+"-foo").Collection(DbDevicesColl).InsertOne(db.CTX(), d)
+		assert.NoError(t, err, "failed to setup input data")
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+
+		store := NewDataStoreMongoWithSession(client)
+
+		ctx := identity.WithContext(db.CTX(), &identity.Identity{
+			Tenant: "foo",
+		})
+		devs, totalCount, err := store.GetDevicesByGroup(ctx, tc.InputGroupName, tc.InputSkip, tc.InputLimit)
+
+		if tc.OutputError != nil {
+			assert.EqualError(t, err, tc.OutputError.Error())
+		} else {
+			assert.NoError(t, err, "expected no error")
+			if !reflect.DeepEqual(tc.OutputDevices, devs) {
+				assert.Fail(t, "expected outputDevices to match", fmt.Sprintf("Expected: %v but\n have:%v", tc.OutputDevices, devs))
+			}
+			if !reflect.DeepEqual(tc.OutputDeviceCount, totalCount) {
+				assert.Fail(t, "expected outputDeviceCount to match", fmt.Sprintf("Expected: %v but\n have:%v", tc.OutputDeviceCount, totalCount))
+			}
+		}
+	}
+}
+
+func TestGetDeviceGroup(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestGetDeviceGroup in short mode.")
+	}
+
+	inputDevices := []model.Device{
+		{
+			ID:    model.DeviceID("1"),
+			Group: model.GroupName("dev"),
+		},
+		{
+			ID: model.DeviceID("2"),
+		},
+	}
+
+	testCases := map[string]struct {
+		InputDeviceID model.DeviceID
+		OutputGroup   model.GroupName
+		OutputError   error
+	}{
+		"dev has group": {
+			InputDeviceID: model.DeviceID("1"),
+			OutputGroup:   model.GroupName("dev"),
+			OutputError:   nil,
+		},
+		"dev has no group": {
+			InputDeviceID: model.DeviceID("2"),
+			OutputGroup:   "",
+			OutputError:   nil,
+		},
+		"dev doesn't exist": {
+			InputDeviceID: model.DeviceID("3"),
+			OutputGroup:   "",
+			OutputError:   store.ErrDevNotFound,
+		},
+	}
+
+	db.Wipe()
+	client := db.Client()
+	store := NewDataStoreMongoWithSession(client)
+	for _, dev := range inputDevices {
+		err := store.AddDevice(db.CTX(), &dev)
+		assert.NoError(t, err, "failed to setup input data")
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			group, err := store.GetDeviceGroup(
+				db.CTX(), tc.InputDeviceID,
+			)
+			if tc.OutputError != nil {
+				assert.EqualError(t, err, tc.OutputError.Error())
+			} else {
+				assert.NoError(t, err, "expected no error")
+				if !assert.Equal(t, tc.OutputGroup, group) {
+					time.Sleep(time.Minute * 5)
+				}
+			}
+		})
+	}
+}
+
+func TestMongoGetGroupSiblings(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoGetGroupSiblings in short mode.")
+	}
+
+	inputDevices := []model.Device{
+		{ID: model.DeviceID("1"), Group: model.GroupName("dev")},
+		{ID: model.DeviceID("2"), Group: model.GroupName("prod")},
+		{ID: model.DeviceID("3"), Group: model.GroupName("dev")},
+		{ID: model.DeviceID("4")},
+		{ID: model.DeviceID("5"), Group: model.GroupName("dev")},
+	}
+
+	testCases := map[string]struct {
+		InputDeviceID model.DeviceID
+		OutputIDs     []model.DeviceID
+		OutputError   error
+	}{
+		"grouped": {
+			InputDeviceID: model.DeviceID("3"),
+			OutputIDs:     []model.DeviceID{"1", "5"},
+		},
+		"alone in the group": {
+			InputDeviceID: model.DeviceID("2"),
+			OutputIDs:     []model.DeviceID{},
+		},
+		"ungrouped": {
+			InputDeviceID: model.DeviceID("4"),
+			OutputIDs:     []model.DeviceID{},
+		},
+		"dev doesn't exist": {
+			InputDeviceID: model.DeviceID("6"),
+			OutputError:   store.ErrDevNotFound,
+		},
+	}
+
+	db.Wipe()
+	store := NewDataStoreMongoWithSession(db.Client())
+	for _, dev := range inputDevices {
+		err := store.AddDevice(db.CTX(), &dev)
+		require.NoError(t, err, "failed to setup input data")
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			devices, err := store.GetGroupSiblings(db.CTX(), tc.InputDeviceID)
+			if tc.OutputError != nil {
+				assert.EqualError(t, err, tc.OutputError.Error())
+				return
+			}
+			require.NoError(t, err)
+			ids := []model.DeviceID{}
+			for _, dev := range devices {
+				ids = append(ids, dev.ID)
+			}
+			assert.Equal(t, tc.OutputIDs, ids)
+		})
+	}
+}
+
+func TestGetDeviceGroupWithTenant(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestGetDeviceGroupWithTenant in short mode.")
+	}
+
+	inputDevices := []model.Device{
+		{
+			ID:    model.DeviceID("1"),
+			Group: model.GroupName("dev"),
+		},
+		{
+			ID: model.DeviceID("2"),
+		},
+	}
+
+	testCases := map[string]struct {
+		InputDeviceID model.DeviceID
+		OutputGroup   model.GroupName
+		OutputError   error
+	}{
+		"dev has group": {
+			InputDeviceID: model.DeviceID("1"),
+			OutputGroup:   model.GroupName("dev"),
+			OutputError:   nil,
+		},
+		"dev has no group": {
+			InputDeviceID: model.DeviceID("2"),
+			OutputGroup:   "",
+			OutputError:   nil,
+		},
+		"dev doesn't exist": {
+			InputDeviceID: model.DeviceID("3"),
+			OutputGroup:   "",
+			OutputError:   store.ErrDevNotFound,
+		},
+	}
+
+	db.Wipe()
+	client := db.Client()
+
+	for _, d := range inputDevices {
+		_, err := client.Database(DbName+"-foo").Collection(DbDevicesColl).InsertOne(db.CTX(), d)
+		assert.NoError(t, err, "failed to setup input data")
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+
+		store := NewDataStoreMongoWithSession(client)
+
+		ctx := identity.WithContext(db.CTX(), &identity.Identity{
+			Tenant: "foo",
+		})
+		group, err := store.GetDeviceGroup(ctx, tc.InputDeviceID)
+
+		if tc.OutputError != nil {
+			assert.EqualError(t, err, tc.OutputError.Error())
+		} else {
+			assert.NoError(t, err, "expected no error")
+			assert.Equal(t, tc.OutputGroup, group)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMigrate in short mode.")
+	}
+
+	someDevs := []model.Device{
+		{
+			ID: model.DeviceID("0"),
+			Attributes: model.DeviceAttributes{
+				{Name: "mac", Value: "foo", Description: strPtr("desc"), Scope: model.AttrScopeInventory},
+				{Name: "sn", Value: "bar", Description: strPtr("desc"), Scope: model.AttrScopeInventory},
+			},
+		},
+		{
+			ID: model.DeviceID("1"),
+			Attributes: model.DeviceAttributes{
+				{Name: "mac", Value: "foo", Description: strPtr("desc"), Scope: model.AttrScopeInventory},
+				{Name: "foo", Value: "foo", Description: strPtr("desc"), Scope: model.AttrScopeInventory},
+				{Name: "bar", Value: "bar", Description: strPtr("desc"), Scope: model.AttrScopeInventory},
+			},
+		},
+		{
+			ID: model.DeviceID("2"),
+			Attributes: model.DeviceAttributes{
+				{Name: "baz", Value: "baz", Description: strPtr("desc"), Scope: model.AttrScopeInventory},
+			},
+		},
+	}
+
+	testCases := map[string]struct {
+		versionFrom     string
+		inDevs          []model.Device
+		automigrate     bool
+		tenant          string
+		indexAttributes []string
+
+		outVers    []string
+		outIndexes []string
+		err        error
+	}{
+		"from no version (fresh db)": {
+			versionFrom: "",
+			automigrate: true,
+
+			outVers: []string{
+				"0.2.0",
+				"1.0.0",
+				"1.0.1",
+				"1.0.2",
+				DbVersion,
+			},
+		},
+		"from 0.1.0 (first, dummy migration)": {
+			versionFrom: "0.1.0",
+			automigrate: true,
+
+			outVers: []string{
+				"0.1.0",
+				"0.2.0",
+				"1.0.0",
+				"1.0.1",
+				"1.0.2",
+				DbVersion,
+			},
+		},
+		"from 0.1.0, no-automigrate": {
+			versionFrom: "0.0.0",
+
+			err: errors.New("failed to apply migrations: db needs migration: inventory has version 0.0.0, needs version " + DbVersion),
+		},
+		"with devices, from 0.1.0": {
+			versionFrom: "0.1.0",
+			inDevs:      someDevs,
+			automigrate: true,
+
+			outVers: []string{
+				"0.1.0",
+				"0.2.0",
+				"1.0.0",
+				"1.0.1",
+				"1.0.2",
+				DbVersion,
+			},
+		},
+		"with devices, from 0.1.0, with tenant": {
+			versionFrom: "",
+			inDevs:      someDevs,
+			automigrate: true,
+			tenant:      "tenant",
+
+			outVers: []string{
+				"0.2.0",
+				"1.0.0",
+				"1.0.1",
+				"1.0.2",
+				DbVersion,
+			},
+		},
+		"with devices, indexed attributes": {
+			versionFrom:     "",
+			inDevs:          someDevs,
+			automigrate:     true,
+			tenant:          "tenant",
+			indexAttributes: []string{"inventory/mac", "identity/status"},
+
+			outVers: []string{
+				"0.2.0",
+				"1.0.0",
+				"1.0.1",
+				"1.0.2",
+				DbVersion,
+			},
+			outIndexes: []string{
+				"attributes.inventory-mac.value",
+				"attributes.identity-status.value",
+			},
+		},
+		"with devices, from 0.1.0, with tenant, other devs": {
+			versionFrom: "0.1.0",
+			inDevs:      []model.Device{someDevs[0], someDevs[2]},
+			automigrate: true,
+			tenant:      "tenant",
+
+			outVers: []string{
+				"0.1.0",
+				"0.2.0",
+				"1.0.0",
+				"1.0.1",
+				"1.0.2",
+				DbVersion,
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db.Wipe()
+
+			client := db.Client()
+
+			var ctx context.Context
+			if tc.tenant != "" {
+				ctx = identity.WithContext(db.CTX(), &identity.Identity{
+					Tenant: tc.tenant,
+				})
+			} else {
+				ctx = identity.WithContext(db.CTX(), &identity.Identity{
+					Tenant: "",
+				})
+			}
+
+			store := NewDataStoreMongoWithSession(client)
+			indexAttributes, err := parseIndexAttributes(tc.indexAttributes)
+			require.NoError(t, err)
+			store.(*DataStoreMongo).indexAttributes = indexAttributes
+
+			if tc.automigrate {
+				store = store.WithAutomigrate()
+			}
+
+			// prep input data
+			// input migrations
+			if tc.versionFrom != "" {
+				v, err := migrate.NewVersion(tc.versionFrom)
+				assert.NoError(t, err)
+
+				entry := migrate.MigrationEntry{
+					Version: *v,
+				}
+				assert.NoError(t, err)
+
+				_, err = client.
+					Database(mstore.DbFromContext(ctx, DbName)).
+					Collection(migrate.DbMigrationsColl).
+					InsertOne(ctx, entry)
+				assert.NoError(t, err)
+			}
+
+			// input devices
+			for _, d := range tc.inDevs {
+				err := store.AddDevice(ctx, &d)
+				assert.NoError(t, err)
+			}
+
+			err = store.Migrate(ctx, DbVersion)
+			if tc.err == nil {
+				assert.NoError(t, err)
+
+				// verify the attribute indexes; migrating again is a no-op
+				assert.NoError(t, store.Migrate(ctx, DbVersion))
+				cur, err := client.
+					Database(mstore.DbFromContext(ctx, DbName)).
+					Collection(DbDevicesColl).
+					Indexes().
+					List(ctx)
+				require.NoError(t, err)
+				var indexes []struct {
+					Name string `bson:"name"`
+				}
+				require.NoError(t, cur.All(ctx, &indexes))
+				names := make([]string, len(indexes))
+				for i, idx := range indexes {
+					names[i] = idx.Name
+				}
+				for _, name := range tc.outIndexes {
+					assert.Contains(t, names, name)
+				}
+
+				// verify migration entries
+				var out []migrate.MigrationEntry
+				cursor, _ := client.
+					Database(mstore.DbFromContext(ctx, DbName)).
+					Collection(migrate.DbMigrationsColl).
+					Find(ctx, bson.M{})
+
+				count := 0
+				for cursor.Next(db.CTX()) {
+					var res migrate.MigrationEntry
+					count++
+					err = cursor.Decode(&res)
+					out = append(out, res)
+				}
+
+				assert.Equal(t, len(tc.outVers), count)
+				for i, v := range tc.outVers {
+					assert.Equal(t, v, out[i].Version.String())
+				}
+			} else {
+				assert.EqualError(t, err, tc.err.Error())
+			}
+		})
+	}
+}
+
+func TestMakeSearchQueryRange(t *testing.T) {
+	t.Parallel()
+
+	updated := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	testCases := map[string]struct {
+		filters []model.FilterPredicate
+
+		query bson.M
+	}{
+		"bounds merged": {
+			filters: []model.FilterPredicate{
+				{Scope: "inventory", Attribute: "disk", Type: "$gte", Value: 10.0},
+				{Scope: "inventory", Attribute: "mac", Type: "$eq", Value: "00"},
+				{Scope: "inventory", Attribute: "disk", Type: "$lt", Value: 20.0},
+			},
+			query: bson.M{"$and": []bson.M{
+				{"attributes.inventory-disk.value": bson.M{"$gte": 10.0, "$lt": 20.0}},
+				{"attributes.inventory-mac.value": bson.M{"$eq": "00"}},
+			}},
+		},
+		"same bound kept apart": {
+			filters: []model.FilterPredicate{
+				{Scope: "inventory", Attribute: "disk", Type: "$gt", Value: 10.0},
+				{Scope: "inventory", Attribute: "disk", Type: "$gt", Value: 15.0},
+			},
+			query: bson.M{"$and": []bson.M{
+				{"attributes.inventory-disk.value": bson.M{"$gt": 10.0}},
+				{"attributes.inventory-disk.value": bson.M{"$gt": 15.0}},
+			}},
+		},
+		"system timestamp": {
+			filters: []model.FilterPredicate{{
+				Scope:     model.AttrScopeSystem,
+				Attribute: model.AttrNameUpdated,
+				Type:      "$lte",
+				Value:     "2026-01-01T10:00:00Z",
+			}},
+			query: bson.M{"$and": []bson.M{
+				{"attributes.system-updated_ts.value": bson.M{"$lte": updated}},
+			}},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			query, err := makeSearchQuery(model.SearchParams{Filters: tc.filters}, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.query, query)
+		})
+	}
+}
+
+func TestParseIndexAttributes(t *testing.T) {
+	testCases := map[string]struct {
+		keys []string
+
+		attrs []string
+		err   string
+	}{
+		"ok": {
+			keys:  []string{"identity/status", "inventory/device_type"},
+			attrs: []string{"identity-status", "inventory-device_type"},
+		},
+		"ok, none": {
+			attrs: []string{},
+		},
+		"error, no scope": {
+			keys: []string{"device_type"},
+			err:  `invalid key "device_type": ` + ErrInvalidIndexAttribute.Error(),
+		},
+		"error, empty name": {
+			keys: []string{"inventory/"},
+			err:  `invalid key "inventory/": ` + ErrInvalidIndexAttribute.Error(),
+		},
+		"error, dotted name": {
+			keys: []string{"inventory/os.version"},
+			err:  `invalid key "inventory/os.version": ` + ErrInvalidIndexAttribute.Error(),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			attrs, err := parseIndexAttributes(tc.keys)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.attrs, attrs)
+			}
+		})
+	}
+}
+
+func TestMongoDeleteDevices(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoDeleteDevice in short mode.")
+	}
+
+	inputDevs := []model.Device{
+		{ID: model.DeviceID("0")},
+		{ID: model.DeviceID("1")},
+	}
+
+	testCases := map[string]struct {
+		inputIDs []model.DeviceID
+		expected []model.Device
+		err      error
+		result   model.UpdateResult
+	}{
+		"existing 1": {
+			inputIDs: []model.DeviceID{"0"},
+			expected: []model.Device{
+				{ID: model.DeviceID("1")},
+			},
+			err: nil,
+			result: model.UpdateResult{
+				DeletedCount: 1,
+			},
+		},
+		"delete all": {
+			inputIDs: []model.DeviceID{"0", "1"},
+			expected: []model.Device(nil),
+			err:      nil,
+			result: model.UpdateResult{
+				DeletedCount: 2,
+			},
+		},
+		"doesn't exist": {
+			inputIDs: []model.DeviceID{"3"},
+			expected: []model.Device{
+				{ID: model.DeviceID("0")},
+				{ID: model.DeviceID("1")},
+			},
+			result: model.UpdateResult{
+				DeletedCount: 0,
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+		t.Run(name, func(t *testing.T) {
+
+			// Make sure we start test with empty database
+			db.Wipe()
+
+			client := db.Client()
+
+			for _, d := range inputDevs {
+				_, err := client.Database(DbName).
+					Collection(DbDevicesColl).
+					InsertOne(db.CTX(), d)
+				assert.NoError(t, err, "failed to setup input data")
+			}
+
+			store := NewDataStoreMongoWithSession(client)
+
+			//test
+			result, err := store.DeleteDevices(db.CTX(), tc.inputIDs)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err, "failed to delete device")
+				if assert.NotNil(t, result) {
+					assert.Equal(t, tc.result, *result)
+				}
+
+				var outDevs []model.Device
+				cursor, err := client.Database(DbName).
+					Collection(DbDevicesColl).
+					Find(db.CTX(), bson.M{})
+				assert.NoError(t, err, "failed to verify devices")
+				cursor.All(nil, &outDevs)
+				assert.Equal(t, tc.expected, outDevs)
+			}
+		})
+	}
+}
+
+func TestMongoExplainSearchDevices(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoExplainSearchDevices in short mode.")
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+	err := mongoStore.AddDevice(ctx, &model.Device{
+		ID: model.DeviceID("1"),
+		Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "secret-mac", Scope: model.AttrScopeIdentity},
+		},
+	})
+	require.NoError(t, err, "failed to setup input data")
+
+	plan, err := mongoStore.ExplainSearchDevices(ctx, model.SearchParams{
+		Page:    1,
+		PerPage: 20,
+		Filters: []model.FilterPredicate{{
+			Scope:     model.AttrScopeIdentity,
+			Attribute: "mac",
+			Type:      "$eq",
+			Value:     "secret-mac",
+		}},
+		Sort: []model.SortCriteria{{
+			Scope:     model.AttrScopeIdentity,
+			Attribute: "mac",
+			Order:     "asc",
+		}},
+	})
+	require.NoError(t, err)
+
+	out, err := json.Marshal(plan)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "."+DbDevicesColl+`"`)
+	assert.Contains(t, string(out), utils.RedactedValue)
+	assert.NotContains(t, string(out), "secret-mac")
+}
+
+func TestMongoSearchDevices(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoSearchDevices in short mode.")
+	}
+
+	now := time.Now()
+	before := now.Add(-time.Hour)
+	inputDevs := []model.Device{
+		{
+			ID: model.DeviceID("0"),
+			Attributes: model.DeviceAttributes{
+				{Name: "MAC", Value: "000", Description: strPtr("MAC"), Scope: model.AttrScopeInventory},
+				{Name: "SN", Value: float64(100), Description: strPtr("SN"), Scope: model.AttrScopeInventory},
+				{Name: "group", Value: "foo", Description: strPtr("group"), Scope: model.AttrScopeInventory},
+				{Name: "ip.address", Value: "1.2.3.4", Scope: model.AttrScopeInventory},
+				{Name: "geo", Value: map[string]interface{}{
+					"region": "EU", "city": "Oslo",
+				}, Scope: model.AttrScopeInventory},
+				{Name: "name", Value: "device0", Scope: model.AttrScopeTags, Timestamp: &now},
+				{Name: "reported_version", Value: "1.0", Scope: model.AttrScopeInventory},
+				{Name: "desired_version", Value: "2.0", Scope: model.AttrScopeInventory},
+			},
+			Group:     "foo",
+			CreatedTs: now,
+			UpdatedTs: &now,
+		},
+		{
+			ID: model.DeviceID("1"),
+			Attributes: model.DeviceAttributes{
+				{Name: "MAC", Value: "001", Description: strPtr("MAC"), Scope: model.AttrScopeInventory},
+				{Name: "SN", Value: float64(111), Description: strPtr("SN"), Scope: model.AttrScopeInventory},
+				{Name: "group", Value: "foo", Description: strPtr("group"), Scope: model.AttrScopeInventory},
+				{Name: "geo", Value: map[string]interface{}{
+					"region": "US",
+				}, Scope: model.AttrScopeInventory},
+				{Name: "name", Value: "device1", Scope: model.AttrScopeTags, Timestamp: &before},
+				{Name: "reported_version", Value: "2.0", Scope: model.AttrScopeInventory},
+				{Name: "desired_version", Value: "2.0", Scope: model.AttrScopeInventory},
+			},
+			Group:     "foo",
+			CreatedTs: now,
+			UpdatedTs: &now,
+		},
+		{
+			ID: model.DeviceID("2"),
+			Attributes: model.DeviceAttributes{
+				{Name: "MAC", Value: "002", Description: strPtr("MAC"), Scope: model.AttrScopeInventory},
+				{Name: "SN", Value: float64(122), Description: strPtr("SN"), Scope: model.AttrScopeInventory},
+				{Name: "group", Value: "foo", Description: strPtr("group"), Scope: model.AttrScopeInventory},
+				{Name: "name", Value: "device2", Scope: model.AttrScopeTags, Timestamp: &now},
+				{Name: "desired_version", Value: "2.0", Scope: model.AttrScopeInventory},
+			},
+			Group:     "foo",
+			CreatedTs: now,
+			UpdatedTs: &now,
+		},
+		{
+			ID: model.DeviceID("3"),
+			Attributes: model.DeviceAttributes{
+				{Name: "MAC", Value: "003", Description: strPtr("MAC"), Scope: model.AttrScopeInventory},
+				{Name: "SN", Value: float64(133), Description: strPtr("SN"), Scope: model.AttrScopeInventory},
+				{Name: "group", Value: "bar", Description: strPtr("group"), Scope: model.AttrScopeInventory},
+				{Name: "name", Value: "device3", Scope: model.AttrScopeTags, Timestamp: &now},
+				{Name: "reported_version", Value: "1.0", Scope: model.AttrScopeInventory},
+			},
+			Group:     "bar",
+			CreatedTs: now,
+			UpdatedTs: &now,
+		},
+		{
+			ID: model.DeviceID("4"),
+			Attributes: model.DeviceAttributes{
+				{Name: "MAC", Value: "003", Description: strPtr("MAC"), Scope: model.AttrScopeInventory},
+				{Name: "SN", Value: float64(144), Description: strPtr("SN"), Scope: model.AttrScopeInventory},
+				{Name: "group", Value: "bar", Description: strPtr("group"), Scope: model.AttrScopeInventory},
+				{Name: "text", Value: "this is a free-text searchable attribute", Scope: model.AttrScopeInventory},
+				{Name: "name", Value: "device4", Scope: model.AttrScopeTags, Timestamp: &now},
+			},
+			Group:     "bar",
+			CreatedTs: now,
+			UpdatedTs: &now,
+		},
+	}
+
+	testCases := map[string]struct {
+		expected           []model.Device
+		expectedAttributes model.DeviceAttributes
+		devTotal           int
+		searchParams       model.SearchParams
+		tenant             string
+		dbError            error
+
+		caseInsensitiveNames bool
+	}{
+		"case-insensitive names, filter on lowercase name": {
+			expected: []model.Device{inputDevs[0]},
+			devTotal: 1,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "mac",
+						Type:      "$eq",
+						Value:     "000",
+					},
+				},
+				Sort: []model.SortCriteria{},
+			},
+			caseInsensitiveNames: true,
+		},
+		"case-insensitive names, negative filter on lowercase name": {
+			expected: []model.Device{inputDevs[0], inputDevs[1], inputDevs[2]},
+			devTotal: 3,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "mac",
+						Type:      "$nin",
+						Value:     []interface{}{"003"},
+					},
+				},
+				Sort: []model.SortCriteria{},
+			},
+			caseInsensitiveNames: true,
+		},
+		"case-sensitive names, filter on lowercase name": {
+			expected: []model.Device{},
+			devTotal: 0,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "mac",
+						Type:      "$eq",
+						Value:     "000",
+					},
+				},
+				Sort: []model.SortCriteria{},
+			},
+		},
+		"single filter, single device": {
+			expected: []model.Device{inputDevs[0]},
+			devTotal: 1,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "MAC",
+						Type:      "$eq",
+						Value:     "000",
+					},
+				},
+				Sort: []model.SortCriteria{},
+			},
+		},
+		"single filter, single device, select single attribute": {
+			expected: []model.Device{inputDevs[0]},
+			expectedAttributes: []model.DeviceAttribute{
+				inputDevs[0].Attributes[0],
+			},
+			devTotal: 1,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "MAC",
+						Type:      "$eq",
+						Value:     "000",
+					},
+				},
+				Attributes: []model.SelectAttribute{
+					{
+						Scope:     "inventory",
+						Attribute: "MAC",
+					},
+				},
+				Sort: []model.SortCriteria{},
+			},
+		},
+		"single filter, single device, select single two attributes": {
+			expected: []model.Device{inputDevs[0]},
+			expectedAttributes: []model.DeviceAttribute{
+				inputDevs[0].Attributes[0],
+				inputDevs[0].Attributes[1],
+			},
+			devTotal: 1,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "MAC",
+						Type:      "$eq",
+						Value:     "000",
+					},
+				},
+				Attributes: []model.SelectAttribute{
+					{
+						Scope:     "inventory",
+						Attribute: "MAC",
+					},
+					{
+						Scope:     "inventory",
+						Attribute: "SN",
+					},
+				},
+				Sort: []model.SortCriteria{},
+			},
+		},
+		"single filter, single device, with dots": {
+			expected: []model.Device{inputDevs[0]},
+			devTotal: 1,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "ip.address",
+						Type:      "$eq",
+						Value:     "1.2.3.4",
+					},
+				},
+				Sort: []model.SortCriteria{},
+			},
+		},
+		"two filters, single device": {
+			expected: []model.Device{inputDevs[0]},
+			devTotal: 1,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "MAC",
+						Type:      "$eq",
+						Value:     "000",
+					},
+					{
+						Scope:     "inventory",
+						Attribute: "SN",
+						Type:      "$eq",
+						Value:     100,
+					},
+				},
+				Sort: []model.SortCriteria{},
+			},
+		},
+		"two filters, three devices, sorted": {
+			expected: []model.Device{inputDevs[2], inputDevs[1], inputDevs[0]},
+			devTotal: 3,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "MAC",
+						Type:      "$in",
+						Value:     []interface{}{"000", "001", "002"},
+					},
+					{
+						Scope:     "inventory",
+						Attribute: "SN",
+						Type:      "$ne",
+						Value:     200,
+					},
+				},
+				Sort: []model.SortCriteria{
+					{
+						Scope:     "inventory",
+						Attribute: "MAC",
+						Order:     "desc",
+					},
+				},
+			},
+		},
+		"one filter, two devices, sorted by two attrs": {
+			expected: []model.Device{inputDevs[4], inputDevs[3]},
+			devTotal: 2,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "MAC",
+						Type:      "$in",
+						Value:     []interface{}{"003", "004"},
+					},
+				},
+				Sort: []model.SortCriteria{
+					{
+						Scope:     "inventory",
+						Attribute: "MAC",
+						Order:     "asc",
+					},
+					{
+						Scope:     "inventory",
+						Attribute: "SN",
+						Order:     "desc",
+					},
+				},
+			},
+		},
+		"one filter, all devices, page and perPage": {
+			expected: []model.Device{inputDevs[2], inputDevs[3]},
+			devTotal: 5,
+			searchParams: model.SearchParams{
+				Page:    2,
+				PerPage: 2,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "MAC",
+						Type:      "$ne",
+						Value:     "foo",
+					},
+				},
+				Sort: []model.SortCriteria{
+					{
+						Scope:     "inventory",
+						Attribute: "MAC",
+						Order:     "asc",
+					},
+				},
+			},
+		},
+		"one filter, device IDs param": {
+			expected: []model.Device{inputDevs[0], inputDevs[2]},
+			devTotal: 2,
+			searchParams: model.SearchParams{
+				Page:      1,
+				PerPage:   5,
+				DeviceIDs: []string{"0", "2"},
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "SN",
+						Type:      "$ne",
+						Value:     200,
+					},
+				},
+			},
+		},
+		"one filter, id": {
+			expected: []model.Device{inputDevs[0]},
+			devTotal: 1,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "identity",
+						Attribute: "id",
+						Type:      "$eq",
+						Value:     "0",
+					},
+				},
+			},
+		},
+		"one filter, id not found": {
+			expected: []model.Device{},
+			devTotal: 0,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "identity",
+						Attribute: "id",
+						Type:      "$eq",
+						Value:     "not found",
+					},
+				},
+			},
+		},
+		"prefix filter, device ID": {
+			expected: []model.Device{inputDevs[3]},
+			devTotal: 1,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "identity",
+						Attribute: "id",
+						Type:      model.FilterTypePrefix,
+						Value:     "3",
+					},
+				},
+			},
+		},
+		"prefix filter, device ID not matching": {
+			expected: []model.Device{},
+			devTotal: 0,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "identity",
+						Attribute: "id",
+						Type:      model.FilterTypePrefix,
+						Value:     "03",
+					},
+				},
+			},
+		},
+		"prefix filter, attribute": {
+			expected: []model.Device{inputDevs[0], inputDevs[1], inputDevs[2]},
+			devTotal: 3,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
 				Filters: []model.FilterPredicate{
+					{
+						Scope:     "tags",
+						Attribute: "name",
+						Type:      model.FilterTypePrefix,
+						Value:     "device",
+					},
 					{
 						Scope:     "inventory",
-						Attribute: "MAC",
+						Attribute: "group",
 						Type:      "$eq",
-						Value:     "000",
+						Value:     "foo",
 					},
 				},
-				Sort: []model.SortCriteria{},
 			},
 		},
-		"single filter, single device, select single attribute": {
-			expected: []model.Device{inputDevs[0]},
-			expectedAttributes: []model.DeviceAttribute{
-				inputDevs[0].Attributes[0],
+		"prefix filter, regular expression characters are literal": {
+			expected: []model.Device{},
+			devTotal: 0,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "MAC",
+						Type:      model.FilterTypePrefix,
+						Value:     "00.",
+					},
+				},
 			},
+		},
+		"path filter, nested field": {
+			expected: []model.Device{inputDevs[0]},
 			devTotal: 1,
 			searchParams: model.SearchParams{
 				Page:    1,
@@ -4231,53 +7293,199 @@ func TestMongoSearchDevices(t *testing.T) {
 				Filters: []model.FilterPredicate{
 					{
 						Scope:     "inventory",
-						Attribute: "MAC",
+						Attribute: "geo",
 						Type:      "$eq",
-						Value:     "000",
+						Value:     "EU",
+						Path:      "region",
 					},
 				},
-				Attributes: []model.SelectAttribute{
+			},
+		},
+		"path filter, nested field differs or is absent": {
+			expected: []model.Device{},
+			devTotal: 0,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
 					{
 						Scope:     "inventory",
-						Attribute: "MAC",
+						Attribute: "geo",
+						Type:      "$eq",
+						Value:     "Oslo",
+						Path:      "country",
 					},
 				},
-				Sort: []model.SortCriteria{},
 			},
 		},
-		"single filter, single device, select single two attributes": {
-			expected: []model.Device{inputDevs[0]},
-			expectedAttributes: []model.DeviceAttribute{
-				inputDevs[0].Attributes[0],
-				inputDevs[0].Attributes[1],
+		"path filter, excluding the other values": {
+			expected: []model.Device{inputDevs[1], inputDevs[2], inputDevs[3], inputDevs[4]},
+			devTotal: 4,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "geo",
+						Type:      "$nin",
+						Value:     []string{"EU"},
+						Path:      "region",
+					},
+				},
 			},
-			devTotal: 1,
+		},
+		"range filter, inclusive bounds": {
+			expected: []model.Device{inputDevs[1], inputDevs[2], inputDevs[3]},
+			devTotal: 3,
 			searchParams: model.SearchParams{
 				Page:    1,
 				PerPage: 5,
 				Filters: []model.FilterPredicate{
 					{
 						Scope:     "inventory",
-						Attribute: "MAC",
-						Type:      "$eq",
-						Value:     "000",
+						Attribute: "SN",
+						Type:      "$gte",
+						Value:     111,
+					},
+					{
+						Scope:     "inventory",
+						Attribute: "SN",
+						Type:      "$lte",
+						Value:     133,
 					},
 				},
-				Attributes: []model.SelectAttribute{
+			},
+		},
+		"range filter, exclusive bounds": {
+			expected: []model.Device{inputDevs[2]},
+			devTotal: 1,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
 					{
 						Scope:     "inventory",
-						Attribute: "MAC",
+						Attribute: "SN",
+						Type:      "$gt",
+						Value:     111,
 					},
 					{
 						Scope:     "inventory",
 						Attribute: "SN",
+						Type:      "$lt",
+						Value:     133,
 					},
 				},
-				Sort: []model.SortCriteria{},
 			},
 		},
-		"single filter, single device, with dots": {
-			expected: []model.Device{inputDevs[0]},
+		"range filter, time values": {
+			expected: inputDevs,
+			devTotal: 5,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     model.AttrScopeSystem,
+						Attribute: model.AttrNameUpdated,
+						Type:      "$gte",
+						Value:     now.Add(-time.Hour).Format(time.RFC3339),
+					},
+					{
+						Scope:     model.AttrScopeSystem,
+						Attribute: model.AttrNameUpdated,
+						Type:      "$lt",
+						Value:     now.Add(time.Hour).Format(time.RFC3339),
+					},
+				},
+			},
+		},
+		"range filter, time values out of range": {
+			expected: []model.Device{},
+			devTotal: 0,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     model.AttrScopeSystem,
+						Attribute: model.AttrNameCreated,
+						Type:      "$gt",
+						Value:     now.Add(time.Hour).Format(time.RFC3339),
+					},
+				},
+			},
+		},
+		"exists filter": {
+			expected: []model.Device{inputDevs[0], inputDevs[1], inputDevs[3]},
+			devTotal: 3,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "reported_version",
+						Type:      model.FilterTypeExists,
+						Value:     true,
+					},
+				},
+			},
+		},
+		"exists filter, missing attribute": {
+			expected: []model.Device{inputDevs[2], inputDevs[4]},
+			devTotal: 2,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "reported_version",
+						Type:      model.FilterTypeExists,
+						Value:     false,
+					},
+				},
+			},
+		},
+		"exists filter, missing attribute, tenant": {
+			expected: []model.Device{inputDevs[2], inputDevs[4]},
+			devTotal: 2,
+			tenant:   "foo",
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "reported_version",
+						Type:      model.FilterTypeExists,
+						Value:     false,
+					},
+				},
+			},
+		},
+		"exists filter, missing attribute, case-insensitive names": {
+			expected: []model.Device{inputDevs[2], inputDevs[4]},
+			devTotal: 2,
+
+			caseInsensitiveNames: true,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "Reported_Version",
+						Type:      model.FilterTypeExists,
+						Value:     false,
+					},
+				},
+			},
+		},
+		"exclude filter": {
+			expected: []model.Device{inputDevs[1]},
 			devTotal: 1,
 			searchParams: model.SearchParams{
 				Page:    1,
@@ -4285,17 +7493,50 @@ func TestMongoSearchDevices(t *testing.T) {
 				Filters: []model.FilterPredicate{
 					{
 						Scope:     "inventory",
-						Attribute: "ip.address",
-						Type:      "$eq",
-						Value:     "1.2.3.4",
+						Attribute: "reported_version",
+						Type:      model.FilterTypeExclude,
+						Value:     []interface{}{"1.0"},
 					},
 				},
-				Sort: []model.SortCriteria{},
 			},
 		},
-		"two filters, single device": {
-			expected: []model.Device{inputDevs[0]},
+		"nin filter, missing attribute": {
+			expected: []model.Device{inputDevs[1], inputDevs[2], inputDevs[4]},
+			devTotal: 3,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "reported_version",
+						Type:      "$nin",
+						Value:     []interface{}{"1.0"},
+					},
+				},
+			},
+		},
+		"exclude filter, case-insensitive names": {
+			expected: []model.Device{inputDevs[1]},
 			devTotal: 1,
+
+			caseInsensitiveNames: true,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "Reported_Version",
+						Type:      model.FilterTypeExclude,
+						Value:     []interface{}{"1.0"},
+					},
+				},
+			},
+		},
+		"regex filter": {
+			expected: []model.Device{inputDevs[3], inputDevs[4]},
+			devTotal: 2,
 			searchParams: model.SearchParams{
 				Page:    1,
 				PerPage: 5,
@@ -4303,117 +7544,186 @@ func TestMongoSearchDevices(t *testing.T) {
 					{
 						Scope:     "inventory",
 						Attribute: "MAC",
-						Type:      "$eq",
-						Value:     "000",
+						Type:      model.FilterTypeRegex,
+						Value:     "3$",
+					},
+				},
+			},
+		},
+		"regex filter, case-insensitive": {
+			expected: []model.Device{inputDevs[1]},
+			devTotal: 1,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "tags",
+						Attribute: "name",
+						Type:      model.FilterTypeRegex,
+						Value:     "^DEVICE1",
+						Options:   "i",
 					},
+				},
+			},
+		},
+		"regex filter, numeric attribute": {
+			expected: []model.Device{},
+			devTotal: 0,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
 					{
 						Scope:     "inventory",
 						Attribute: "SN",
-						Type:      "$eq",
-						Value:     100,
+						Type:      model.FilterTypeRegex,
+						Value:     "^1",
 					},
 				},
-				Sort: []model.SortCriteria{},
 			},
 		},
-		"two filters, three devices, sorted": {
-			expected: []model.Device{inputDevs[2], inputDevs[1], inputDevs[0]},
-			devTotal: 3,
+		"regex filter, system timestamp": {
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     model.AttrScopeSystem,
+						Attribute: model.AttrNameUpdated,
+						Type:      model.FilterTypeRegex,
+						Value:     "^2",
+					},
+				},
+			},
+			dbError: store.ErrRegexNonString,
+		},
+		"$in, bad value": {
+			expected: []model.Device{inputDevs[2], inputDevs[3]},
+			devTotal: 5,
+			searchParams: model.SearchParams{
+				Page:    2,
+				PerPage: 2,
+				Filters: []model.FilterPredicate{
+					{
+						Scope:     "inventory",
+						Attribute: "MAC",
+						Type:      "$in",
+						Value:     "foo",
+					},
+				},
+			},
+			dbError: errors.New("(BadValue) $in needs an array"),
+		},
+		"no filter": {
+			expected: inputDevs,
+			devTotal: 5,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+			},
+		},
+		"no filter, sort by ID desc": {
+			expected: []model.Device{
+				inputDevs[4],
+				inputDevs[3],
+				inputDevs[2],
+				inputDevs[1],
+				inputDevs[0],
+			},
+			devTotal: 5,
 			searchParams: model.SearchParams{
 				Page:    1,
 				PerPage: 5,
-				Filters: []model.FilterPredicate{
-					{
-						Scope:     "inventory",
-						Attribute: "MAC",
-						Type:      "$in",
-						Value:     []interface{}{"000", "001", "002"},
-					},
-					{
-						Scope:     "inventory",
-						Attribute: "SN",
-						Type:      "$ne",
-						Value:     200,
-					},
-				},
 				Sort: []model.SortCriteria{
 					{
-						Scope:     "inventory",
-						Attribute: "MAC",
+						Scope:     "identity",
+						Attribute: "id",
 						Order:     "desc",
 					},
 				},
 			},
 		},
-		"one filter, two devices, sorted by two attrs": {
-			expected: []model.Device{inputDevs[4], inputDevs[3]},
-			devTotal: 2,
+		"no filter, sort by name desc": {
+			expected: []model.Device{
+				inputDevs[4],
+				inputDevs[3],
+				inputDevs[2],
+				inputDevs[1],
+				inputDevs[0],
+			},
+			devTotal: 5,
 			searchParams: model.SearchParams{
 				Page:    1,
 				PerPage: 5,
-				Filters: []model.FilterPredicate{
-					{
-						Scope:     "inventory",
-						Attribute: "MAC",
-						Type:      "$in",
-						Value:     []interface{}{"003", "004"},
-					},
-				},
 				Sort: []model.SortCriteria{
 					{
-						Scope:     "inventory",
-						Attribute: "MAC",
-						Order:     "asc",
-					},
-					{
-						Scope:     "inventory",
-						Attribute: "SN",
+						Scope:     "tags",
+						Attribute: "name",
 						Order:     "desc",
 					},
 				},
 			},
 		},
-		"one filter, all devices, page and perPage": {
-			expected: []model.Device{inputDevs[2], inputDevs[3]},
-			devTotal: 5,
+		"attribute reference, attributes differ": {
+			expected: []model.Device{inputDevs[0]},
+			devTotal: 1,
 			searchParams: model.SearchParams{
-				Page:    2,
-				PerPage: 2,
+				Page:    1,
+				PerPage: 5,
 				Filters: []model.FilterPredicate{
 					{
 						Scope:     "inventory",
-						Attribute: "MAC",
+						Attribute: "reported_version",
 						Type:      "$ne",
-						Value:     "foo",
+						Ref: &model.SelectAttribute{
+							Scope:     "inventory",
+							Attribute: "desired_version",
+						},
 					},
 				},
-				Sort: []model.SortCriteria{
+			},
+		},
+		"attribute reference, attributes equal": {
+			expected: []model.Device{},
+			devTotal: 0,
+			searchParams: model.SearchParams{
+				Page:      1,
+				PerPage:   5,
+				DeviceIDs: []string{"1"},
+				Filters: []model.FilterPredicate{
 					{
 						Scope:     "inventory",
-						Attribute: "MAC",
-						Order:     "asc",
+						Attribute: "reported_version",
+						Type:      "$ne",
+						Ref: &model.SelectAttribute{
+							Scope:     "inventory",
+							Attribute: "desired_version",
+						},
 					},
 				},
 			},
 		},
-		"one filter, device IDs param": {
-			expected: []model.Device{inputDevs[0], inputDevs[2]},
-			devTotal: 2,
+		"attribute reference, $eq": {
+			expected: []model.Device{inputDevs[1]},
+			devTotal: 1,
 			searchParams: model.SearchParams{
-				Page:      1,
-				PerPage:   5,
-				DeviceIDs: []string{"0", "2"},
+				Page:    1,
+				PerPage: 5,
 				Filters: []model.FilterPredicate{
 					{
 						Scope:     "inventory",
-						Attribute: "SN",
-						Type:      "$ne",
-						Value:     200,
+						Attribute: "reported_version",
+						Type:      "$eq",
+						Ref: &model.SelectAttribute{
+							Scope:     "inventory",
+							Attribute: "desired_version",
+						},
 					},
 				},
 			},
 		},
-		"one filter, id": {
+		"attribute reference, $lt": {
 			expected: []model.Device{inputDevs[0]},
 			devTotal: 1,
 			searchParams: model.SearchParams{
@@ -4421,15 +7731,18 @@ func TestMongoSearchDevices(t *testing.T) {
 				PerPage: 5,
 				Filters: []model.FilterPredicate{
 					{
-						Scope:     "identity",
-						Attribute: "id",
-						Type:      "$eq",
-						Value:     "0",
+						Scope:     "inventory",
+						Attribute: "reported_version",
+						Type:      "$lt",
+						Ref: &model.SelectAttribute{
+							Scope:     "inventory",
+							Attribute: "desired_version",
+						},
 					},
 				},
 			},
 		},
-		"one filter, id not found": {
+		"attribute reference, $gt": {
 			expected: []model.Device{},
 			devTotal: 0,
 			searchParams: model.SearchParams{
@@ -4437,148 +7750,886 @@ func TestMongoSearchDevices(t *testing.T) {
 				PerPage: 5,
 				Filters: []model.FilterPredicate{
 					{
-						Scope:     "identity",
-						Attribute: "id",
-						Type:      "$eq",
-						Value:     "not found",
+						Scope:     "inventory",
+						Attribute: "reported_version",
+						Type:      "$gt",
+						Ref: &model.SelectAttribute{
+							Scope:     "inventory",
+							Attribute: "desired_version",
+						},
 					},
 				},
 			},
 		},
-		"$in, bad value": {
-			expected: []model.Device{inputDevs[2], inputDevs[3]},
-			devTotal: 5,
+		"attribute reference, unsupported operator": {
 			searchParams: model.SearchParams{
-				Page:    2,
-				PerPage: 2,
+				Page:    1,
+				PerPage: 5,
 				Filters: []model.FilterPredicate{
 					{
 						Scope:     "inventory",
-						Attribute: "MAC",
-						Type:      "$in",
-						Value:     "foo",
+						Attribute: "reported_version",
+						Type:      "$concat",
+						Ref: &model.SelectAttribute{
+							Scope:     "inventory",
+							Attribute: "desired_version",
+						},
 					},
 				},
 			},
-			dbError: errors.New("(BadValue) $in needs an array"),
+			dbError: ErrInvalidAttributeRef,
+		},
+		"free text search": {
+			expected: []model.Device{inputDevs[4]},
+			devTotal: 1,
+			searchParams: model.SearchParams{
+				Page:    1,
+				PerPage: 5,
+				Text:    utils.TextToKeywords("free-text attribute"),
+				Sort:    []model.SortCriteria{},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+
+		// Make sure we start test with empty database
+		db.Wipe()
+
+		client := db.Client()
+
+		var ctx context.Context
+		if tc.tenant != "" {
+			ctx = identity.WithContext(db.CTX(), &identity.Identity{
+				Tenant: tc.tenant,
+			})
+		} else {
+			ctx = identity.WithContext(db.CTX(), &identity.Identity{
+				Tenant: "",
+			})
+		}
+
+		mongoStore := store.DataStore(&DataStoreMongo{
+			client:               client,
+			caseInsensitiveNames: tc.caseInsensitiveNames,
+		})
+
+		for _, d := range inputDevs {
+			err := mongoStore.AddDevice(ctx, &d)
+			assert.NoError(t, err, "failed to setup input data")
+		}
+
+		//we need the $text index when testing the full-text search; apply migrations
+		if tc.searchParams.Text != "" {
+			mongoStore = mongoStore.WithAutomigrate()
+			err := mongoStore.Migrate(ctx, DbVersion)
+			assert.NoError(t, err)
+		}
+
+		//test
+		devs, totalCount, err := mongoStore.SearchDevices(ctx, tc.searchParams)
+
+		if tc.dbError != nil {
+			assert.Error(t, tc.dbError, err)
+		} else {
+			assert.NoError(t, err, "failed to get devices")
+			assert.Equal(t, len(tc.expected), len(devs))
+			assert.Equal(t, tc.devTotal, totalCount)
+			if len(tc.searchParams.Sort) > 0 {
+				for i, dev := range devs {
+					assert.Equal(t, tc.expected[i].ID, dev.ID)
+				}
+			}
+			if len(tc.searchParams.Attributes) > 0 {
+				for _, dev := range devs {
+					assert.Equal(t, len(tc.expectedAttributes), len(dev.Attributes))
+					assert.Equal(t, tc.expectedAttributes, dev.Attributes[:len(tc.expectedAttributes)])
+				}
+			}
+		}
+
+	}
+}
+
+func TestMongoSearchDevicesSortTieBreaker(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoSearchDevicesSortTieBreaker in short mode.")
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+	// low-cardinality attribute: many devices share the same value
+	inputDevs := map[model.DeviceID]string{
+		"5": "beta",
+		"2": "alpha",
+		"8": "beta",
+		"0": "alpha",
+		"7": "alpha",
+		"3": "beta",
+		"1": "alpha",
+		"6": "beta",
+		"4": "alpha",
+	}
+	for id, value := range inputDevs {
+		err := mongoStore.AddDevice(ctx, &model.Device{
+			ID: id,
+			Attributes: model.DeviceAttributes{{
+				Name:  "channel",
+				Value: value,
+				Scope: model.AttrScopeInventory,
+			}},
+		})
+		assert.NoError(t, err, "failed to setup input data")
+	}
+
+	search := func(order string, page, perPage int) []model.DeviceID {
+		devs, total, err := mongoStore.SearchDevices(ctx, model.SearchParams{
+			Page:    page,
+			PerPage: perPage,
+			Sort: []model.SortCriteria{{
+				Scope:     model.AttrScopeInventory,
+				Attribute: "channel",
+				Order:     order,
+			}},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, len(inputDevs), total)
+		ids := make([]model.DeviceID, len(devs))
+		for i, dev := range devs {
+			ids[i] = dev.ID
+		}
+		return ids
+	}
+
+	expectedAsc := []model.DeviceID{"0", "1", "2", "4", "7", "3", "5", "6", "8"}
+	expectedDesc := []model.DeviceID{"3", "5", "6", "8", "0", "1", "2", "4", "7"}
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, expectedAsc, search("asc", 1, 20))
+		assert.Equal(t, expectedDesc, search("desc", 1, 20))
+
+		// paging through the results yields the same order
+		var paged []model.DeviceID
+		for page := 1; page <= 3; page++ {
+			paged = append(paged, search("asc", page, 3)...)
+		}
+		assert.Equal(t, expectedAsc, paged)
+	}
+
+	// without a sort the results are ordered by the device ID
+	devs, _, err := mongoStore.SearchDevices(ctx, model.SearchParams{
+		Page:    2,
+		PerPage: 3,
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, devs, 3) {
+		assert.Equal(t, model.DeviceID("3"), devs[0].ID)
+		assert.Equal(t, model.DeviceID("5"), devs[2].ID)
+	}
+
+	// with the tie-breaker disabled the primary order still holds
+	mongoStore = &DataStoreMongo{
+		client:                db.Client(),
+		disableSortTieBreaker: true,
+	}
+	ids := search("asc", 1, 20)
+	assert.ElementsMatch(t, expectedAsc[:5], ids[:5])
+	assert.ElementsMatch(t, expectedAsc[5:], ids[5:])
+}
+
+func TestMongoSearchDevicesSortTieBreakerPages(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoSearchDevicesSortTieBreakerPages in short mode.")
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	inputIDs := []model.DeviceID{"6", "3", "9", "1", "7", "4", "0", "8", "2", "5"}
+	for _, id := range inputIDs {
+		err := NewDataStoreMongoWithSession(db.Client()).AddDevice(ctx, &model.Device{
+			ID: id,
+			Attributes: model.DeviceAttributes{
+				{Name: "status", Value: "accepted", Scope: model.AttrScopeIdentity},
+				{Name: "channel", Value: "stable", Scope: model.AttrScopeInventory},
+			},
+		})
+		require.NoError(t, err, "failed to setup input data")
+	}
+
+	testCases := map[string]*DataStoreMongo{
+		"find": {client: db.Client()},
+		"aggregation": {
+			client:             db.Client(),
+			maxAttributesBytes: 1000,
+		},
+	}
+
+	for name, mongoStore := range testCases {
+		t.Run(name, func(t *testing.T) {
+			// the devices tie on all the sort attributes, of two scopes
+			var ids []model.DeviceID
+			for page := 1; page <= 2; page++ {
+				devs, _, err := mongoStore.SearchDevices(ctx, model.SearchParams{
+					Page:    page,
+					PerPage: len(inputIDs) / 2,
+					Sort: []model.SortCriteria{{
+						Scope:     model.AttrScopeIdentity,
+						Attribute: "status",
+						Order:     "asc",
+					}, {
+						Scope:     model.AttrScopeInventory,
+						Attribute: "channel",
+						Order:     "desc",
+					}},
+				})
+				require.NoError(t, err)
+				for _, dev := range devs {
+					ids = append(ids, dev.ID)
+				}
+			}
+			assert.Equal(t, []model.DeviceID{
+				"0", "1", "2", "3", "4", "5", "6", "7", "8", "9",
+			}, ids)
+		})
+	}
+}
+
+func TestMongoSearchDevicesSortByID(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoSearchDevicesSortByID in short mode.")
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+	inputDevs := map[model.DeviceID]string{
+		"1": "beta",
+		"2": "alpha",
+		"3": "beta",
+		"4": "alpha",
+	}
+	for id, value := range inputDevs {
+		err := mongoStore.AddDevice(ctx, &model.Device{
+			ID: id,
+			Attributes: model.DeviceAttributes{{
+				Name:  "channel",
+				Value: value,
+				Scope: model.AttrScopeInventory,
+			}},
+		})
+		assert.NoError(t, err, "failed to setup input data")
+	}
+
+	sortByID := func(order string) model.SortCriteria {
+		return model.SortCriteria{
+			Scope:     model.AttrScopeIdentity,
+			Attribute: model.AttrNameID,
+			Order:     order,
+		}
+	}
+	sortByChannel := model.SortCriteria{
+		Scope:     model.AttrScopeInventory,
+		Attribute: "channel",
+		Order:     "asc",
+	}
+
+	testCases := map[string]struct {
+		sortIDLast bool
+		sort       []model.SortCriteria
+
+		outIDs []model.DeviceID
+	}{
+		"id only": {
+			sort:   []model.SortCriteria{sortByID("desc")},
+			outIDs: []model.DeviceID{"4", "3", "2", "1"},
 		},
-		"no filter": {
-			expected: inputDevs,
-			devTotal: 5,
-			searchParams: model.SearchParams{
-				Page:    1,
-				PerPage: 5,
-			},
+		"id first": {
+			sort:   []model.SortCriteria{sortByID("desc"), sortByChannel},
+			outIDs: []model.DeviceID{"4", "3", "2", "1"},
 		},
-		"no filter, sort by ID desc": {
-			expected: []model.Device{
-				inputDevs[4],
-				inputDevs[3],
-				inputDevs[2],
-				inputDevs[1],
-				inputDevs[0],
-			},
-			devTotal: 5,
-			searchParams: model.SearchParams{
-				Page:    1,
-				PerPage: 5,
-				Sort: []model.SortCriteria{
-					{
-						Scope:     "identity",
-						Attribute: "id",
-						Order:     "desc",
-					},
-				},
-			},
+		"id last": {
+			sort:   []model.SortCriteria{sortByChannel, sortByID("desc")},
+			outIDs: []model.DeviceID{"4", "2", "3", "1"},
 		},
-		"no filter, sort by name desc": {
-			expected: []model.Device{
-				inputDevs[4],
-				inputDevs[3],
-				inputDevs[2],
-				inputDevs[1],
-				inputDevs[0],
+		"id repeated": {
+			sort: []model.SortCriteria{
+				sortByChannel, sortByID("desc"), sortByID("asc"),
 			},
-			devTotal: 5,
-			searchParams: model.SearchParams{
+			outIDs: []model.DeviceID{"4", "2", "3", "1"},
+		},
+		"id first, sort id last": {
+			sortIDLast: true,
+			sort:       []model.SortCriteria{sortByID("desc"), sortByChannel},
+			outIDs:     []model.DeviceID{"4", "2", "3", "1"},
+		},
+		"id last, sort id last": {
+			sortIDLast: true,
+			sort:       []model.SortCriteria{sortByChannel, sortByID("asc")},
+			outIDs:     []model.DeviceID{"2", "4", "1", "3"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mongoStore := &DataStoreMongo{
+				client:     db.Client(),
+				sortIDLast: tc.sortIDLast,
+			}
+			devs, _, err := mongoStore.SearchDevices(ctx, model.SearchParams{
 				Page:    1,
-				PerPage: 5,
-				Sort: []model.SortCriteria{
-					{
-						Scope:     "tags",
-						Attribute: "name",
-						Order:     "desc",
-					},
-				},
+				PerPage: 20,
+				Sort:    tc.sort,
+			})
+			assert.NoError(t, err)
+			ids := make([]model.DeviceID, len(devs))
+			for i, dev := range devs {
+				ids[i] = dev.ID
+			}
+			assert.Equal(t, tc.outIDs, ids)
+		})
+	}
+}
+
+func TestMongoSearchDevicesCountLimit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoSearchDevicesCountLimit in short mode.")
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	for _, id := range []model.DeviceID{"1", "2", "3", "4", "5"} {
+		err := NewDataStoreMongoWithSession(db.Client()).AddDevice(ctx, &model.Device{
+			ID: id,
+			Attributes: model.DeviceAttributes{
+				{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
 			},
+		})
+		require.NoError(t, err, "failed to setup input data")
+	}
+
+	testCases := map[string]struct {
+		store      store.DataStore
+		countLimit int
+
+		count int
+	}{
+		"exact": {
+			store: NewDataStoreMongoWithSession(db.Client()),
+			count: 5,
 		},
-		"free text search": {
-			expected: []model.Device{inputDevs[4]},
-			devTotal: 1,
-			searchParams: model.SearchParams{
-				Page:    1,
-				PerPage: 5,
-				Text:    utils.TextToKeywords("free-text attribute"),
-				Sort:    []model.SortCriteria{},
+		"estimated": {
+			store:      NewDataStoreMongoWithSession(db.Client()),
+			countLimit: 3,
+			count:      3,
+		},
+		"estimated, below the limit": {
+			store:      NewDataStoreMongoWithSession(db.Client()),
+			countLimit: 10,
+			count:      5,
+		},
+		"estimated, aggregation": {
+			store: &DataStoreMongo{
+				client:             db.Client(),
+				maxAttributesBytes: 1000,
 			},
+			countLimit: 3,
+			count:      3,
 		},
 	}
 
 	for name, tc := range testCases {
-		t.Logf("test case: %s", name)
+		t.Run(name, func(t *testing.T) {
+			devs, count, err := tc.store.SearchDevices(ctx, model.SearchParams{
+				Page:          1,
+				PerPage:       2,
+				EstimateCount: tc.countLimit > 0,
+				CountLimit:    tc.countLimit,
+			})
+			require.NoError(t, err)
+			assert.Len(t, devs, 2)
+			assert.Equal(t, tc.count, count)
+		})
+	}
+}
 
-		// Make sure we start test with empty database
-		db.Wipe()
+func TestMongoCountDevices(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoCountDevices in short mode.")
+	}
 
-		client := db.Client()
+	db.Wipe()
+	ctx := db.CTX()
+	tenantCtx := identity.WithContext(db.CTX(), &identity.Identity{Tenant: "foo"})
+	naiveStore := NewDataStoreMongoWithSession(db.Client())
+	for i, id := range []model.DeviceID{"1", "2", "3", "4", "5"} {
+		err := naiveStore.AddDevice(ctx, &model.Device{
+			ID: id,
+			Attributes: model.DeviceAttributes{
+				{Name: "channel", Value: []string{"stable", "beta"}[i%2],
+					Scope: model.AttrScopeInventory},
+			},
+		})
+		require.NoError(t, err, "failed to setup input data")
+	}
+	err := naiveStore.AddDevice(tenantCtx, &model.Device{
+		ID: "6",
+		Attributes: model.DeviceAttributes{
+			{Name: "channel", Value: "beta", Scope: model.AttrScopeInventory},
+		},
+	})
+	require.NoError(t, err, "failed to setup input data")
 
-		var ctx context.Context
-		if tc.tenant != "" {
-			ctx = identity.WithContext(db.CTX(), &identity.Identity{
-				Tenant: tc.tenant,
-			})
-		} else {
-			ctx = identity.WithContext(db.CTX(), &identity.Identity{
-				Tenant: "",
+	beta := []model.FilterPredicate{{
+		Scope:     model.AttrScopeInventory,
+		Attribute: "channel",
+		Type:      "$eq",
+		Value:     "beta",
+	}}
+	ids := []model.FilterPredicate{{
+		Scope:     model.AttrScopeIdentity,
+		Attribute: model.AttrNameID,
+		Type:      "$in",
+		Value:     []interface{}{"1", "2", "3", "unknown"},
+	}}
+
+	testCases := map[string]struct {
+		ctx     context.Context
+		store   store.DataStore
+		filters []model.FilterPredicate
+
+		count int
+	}{
+		"all": {
+			ctx:   ctx,
+			store: naiveStore,
+			count: 5,
+		},
+		"filtered": {
+			ctx:     ctx,
+			store:   naiveStore,
+			filters: beta,
+			count:   2,
+		},
+		"large $in": {
+			ctx: ctx,
+			store: &DataStoreMongo{
+				client:           db.Client(),
+				largeInThreshold: 2,
+			},
+			filters: ids,
+			count:   3,
+		},
+		"no match": {
+			ctx:   ctx,
+			store: naiveStore,
+			filters: []model.FilterPredicate{{
+				Scope:     model.AttrScopeInventory,
+				Attribute: "channel",
+				Type:      "$eq",
+				Value:     "nightly",
+			}},
+			count: 0,
+		},
+		"tenant": {
+			ctx:     tenantCtx,
+			store:   naiveStore,
+			filters: beta,
+			count:   1,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			count, err := tc.store.CountDevices(tc.ctx, model.SearchParams{
+				Filters: tc.filters,
 			})
-		}
+			require.NoError(t, err)
+			assert.Equal(t, tc.count, count)
+		})
+	}
+}
 
-		mongoStore := NewDataStoreMongoWithSession(client)
+func TestMongoSearchDevicesMaxAttributesBytes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoSearchDevicesMaxAttributesBytes in short mode.")
+	}
 
-		for _, d := range inputDevs {
-			err := mongoStore.AddDevice(ctx, &d)
-			assert.NoError(t, err, "failed to setup input data")
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := &DataStoreMongo{
+		client:             db.Client(),
+		maxAttributesBytes: 1000,
+	}
+	inputDevs := []model.Device{{
+		ID: model.DeviceID("large"),
+		Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+			{Name: "blob", Value: strings.Repeat("x", 2000), Scope: model.AttrScopeInventory},
+			{Name: "sn", Value: "123", Scope: model.AttrScopeInventory},
+		},
+	}, {
+		ID: model.DeviceID("small"),
+		Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:22", Scope: model.AttrScopeIdentity},
+			{Name: "sn", Value: "456", Scope: model.AttrScopeInventory},
+		},
+	}}
+	for _, d := range inputDevs {
+		err := mongoStore.AddDevice(ctx, &d)
+		require.NoError(t, err, "failed to setup input data")
+	}
+
+	devs, count, err := mongoStore.SearchDevices(ctx, model.SearchParams{
+		Page:    1,
+		PerPage: 10,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	require.Len(t, devs, 2)
+
+	names := func(dev model.Device) []string {
+		var res []string
+		for _, attr := range dev.Attributes {
+			res = append(res, attr.Scope+"/"+attr.Name)
 		}
+		return res
+	}
 
-		//we need the $text index when testing the full-text search; apply migrations
-		if tc.searchParams.Text != "" {
-			mongoStore = mongoStore.WithAutomigrate()
-			err := mongoStore.Migrate(ctx, DbVersion)
-			assert.NoError(t, err)
+	// the attributes past the limit are left out, the others are kept
+	large := devs[0]
+	assert.Equal(t, model.DeviceID("large"), large.ID)
+	assert.True(t, large.Truncated)
+	assert.NotContains(t, names(large), "inventory/blob")
+	assert.Contains(t, names(large), "identity/mac")
+	assert.Contains(t, names(large), "inventory/sn")
+
+	small := devs[1]
+	assert.Equal(t, model.DeviceID("small"), small.ID)
+	assert.False(t, small.Truncated)
+	assert.Contains(t, names(small), "identity/mac")
+	assert.Contains(t, names(small), "inventory/sn")
+}
+
+func TestMongoSearchDevicesLargeIn(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoSearchDevicesLargeIn in short mode.")
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	naiveStore := NewDataStoreMongoWithSession(db.Client())
+	largeInStore := &DataStoreMongo{
+		client:           db.Client(),
+		largeInThreshold: 10,
+	}
+	for i := 0; i < 100; i++ {
+		attrs := model.DeviceAttributes{{
+			Name:  "serial",
+			Value: fmt.Sprintf("sn-%02d", i),
+			Scope: model.AttrScopeInventory,
+		}, {
+			Name:  "channel",
+			Value: []interface{}{"stable", "beta"}[i%2],
+			Scope: model.AttrScopeInventory,
+		}}
+		if i%3 == 0 {
+			attrs = append(attrs, model.DeviceAttribute{
+				Name:  "tags",
+				Value: []interface{}{fmt.Sprintf("t-%02d", i), "common"},
+				Scope: model.AttrScopeInventory,
+			})
 		}
+		err := naiveStore.AddDevice(ctx, &model.Device{
+			ID:         model.DeviceID(fmt.Sprintf("%03d", i)),
+			Attributes: attrs,
+		})
+		assert.NoError(t, err, "failed to setup input data")
+	}
 
-		//test
-		devs, totalCount, err := mongoStore.SearchDevices(ctx, tc.searchParams)
+	serials := []interface{}{"sn-99", "unknown", "sn-01"}
+	tags := []interface{}{}
+	ids := []interface{}{}
+	for i := 0; i < 100; i += 4 {
+		serials = append(serials, fmt.Sprintf("sn-%02d", i), fmt.Sprintf("sn-%02d", i))
+		tags = append(tags, fmt.Sprintf("t-%02d", i))
+		ids = append(ids, fmt.Sprintf("%03d", i+1))
+	}
 
-		if tc.dbError != nil {
-			assert.Error(t, tc.dbError, err)
-		} else {
-			assert.NoError(t, err, "failed to get devices")
-			assert.Equal(t, len(tc.expected), len(devs))
-			assert.Equal(t, tc.devTotal, totalCount)
-			if len(tc.searchParams.Sort) > 0 {
-				for i, dev := range devs {
-					assert.Equal(t, tc.expected[i].ID, dev.ID)
-				}
-			}
-			if len(tc.searchParams.Attributes) > 0 {
-				for _, dev := range devs {
-					assert.Equal(t, len(tc.expectedAttributes), len(dev.Attributes))
-					assert.Equal(t, tc.expectedAttributes, dev.Attributes[:len(tc.expectedAttributes)])
-				}
+	testCases := map[string]model.SearchParams{
+		"attribute": {
+			Filters: []model.FilterPredicate{{
+				Scope:     model.AttrScopeInventory,
+				Attribute: "serial",
+				Type:      "$in",
+				Value:     serials,
+			}},
+		},
+		"array attribute": {
+			Filters: []model.FilterPredicate{{
+				Scope:     model.AttrScopeInventory,
+				Attribute: "tags",
+				Type:      "$in",
+				Value:     tags,
+			}},
+		},
+		"device ID, with other filters": {
+			Filters: []model.FilterPredicate{{
+				Scope:     model.AttrScopeIdentity,
+				Attribute: model.AttrNameID,
+				Type:      "$in",
+				Value:     ids,
+			}, {
+				Scope:     model.AttrScopeInventory,
+				Attribute: "channel",
+				Type:      "$eq",
+				Value:     "beta",
+			}},
+		},
+		"two large filters, sorted, projected": {
+			Filters: []model.FilterPredicate{{
+				Scope:     model.AttrScopeInventory,
+				Attribute: "serial",
+				Type:      "$in",
+				Value:     serials,
+			}, {
+				Scope:     model.AttrScopeIdentity,
+				Attribute: model.AttrNameID,
+				Type:      "$in",
+				Value:     append(ids, "000", "004", "008", "012"),
+			}},
+			Sort: []model.SortCriteria{{
+				Scope:     model.AttrScopeInventory,
+				Attribute: "channel",
+				Order:     "desc",
+			}},
+			Attributes: []model.SelectAttribute{{
+				Scope:     model.AttrScopeInventory,
+				Attribute: "serial",
+			}},
+		},
+	}
+	for name, params := range testCases {
+		t.Run(name, func(t *testing.T) {
+			for page := 1; page <= 3; page++ {
+				params.Page = page
+				params.PerPage = 5
+				expected, expectedCount, err := naiveStore.SearchDevices(ctx, params)
+				require.NoError(t, err)
+				devs, count, err := largeInStore.SearchDevices(ctx, params)
+				require.NoError(t, err)
+				assert.Equal(t, expectedCount, count)
+				assert.Equal(t, expected, devs)
 			}
+		})
+	}
+
+	// the temporary collections of the values are dropped
+	names, err := db.Client().Database(DbName).ListCollectionNames(ctx, bson.M{
+		"name": bson.M{"$regex": "^" + DbSearchInValuesPrefix},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+}
+
+func TestMongoAttributeNames(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoAttributeNames in short mode.")
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	database := db.Client().Database(DbName)
+	mongoStore := &DataStoreMongo{
+		client:               db.Client(),
+		caseInsensitiveNames: true,
+	}
+	filters := []model.FilterPredicate{{
+		Scope:     model.AttrScopeInventory,
+		Attribute: "mac",
+		Type:      "$eq",
+		Value:     "00:00:00:01",
+	}}
+	key := attributeNameKey(model.AttrScopeInventory, "mac")
+
+	// the names are recorded as the attributes are updated
+	err := mongoStore.AddDevice(ctx, &model.Device{
+		ID: "1",
+		Attributes: model.DeviceAttributes{
+			{Name: "MAC", Value: "00:00:00:01", Scope: model.AttrScopeInventory},
+		},
+	})
+	require.NoError(t, err)
+	names, err := resolveAttributeNames(ctx, database, filters)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{key: {"MAC"}}, names)
+
+	// the names of the devices stored otherwise are recorded when
+	// indexing the names of all the devices
+	_, err = database.Collection(DbDevicesColl).InsertOne(ctx, model.Device{
+		ID: "2",
+		Attributes: model.DeviceAttributes{
+			{Name: "Mac", Value: "00:00:00:02", Scope: model.AttrScopeInventory},
+		},
+	})
+	require.NoError(t, err)
+	err = mongoStore.indexAttributeNames(ctx)
+	require.NoError(t, err)
+	names, err = resolveAttributeNames(ctx, database, filters)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"MAC", "Mac"}, names[key])
+
+	// the names are not recorded with the case-insensitive names disabled
+	err = (&DataStoreMongo{client: db.Client()}).AddDevice(ctx, &model.Device{
+		ID: "3",
+		Attributes: model.DeviceAttributes{
+			{Name: "mAC", Value: "00:00:00:03", Scope: model.AttrScopeInventory},
+		},
+	})
+	require.NoError(t, err)
+	names, err = resolveAttributeNames(ctx, database, filters)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"MAC", "Mac"}, names[key])
+}
+
+func TestMongoDropInValues(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoDropInValues in short mode.")
+	}
+
+	listInValues := func(t *testing.T) []string {
+		names, err := db.Client().Database(DbName).ListCollectionNames(db.CTX(), bson.M{
+			"name": bson.M{"$regex": "^" + DbSearchInValuesPrefix},
+		})
+		require.NoError(t, err)
+		sort.Strings(names)
+		return names
+	}
+
+	t.Run("cancelled request", func(t *testing.T) {
+		db.Wipe()
+		database := db.Client().Database(DbName)
+		coll, err := loadInValues(db.CTX(), database, []interface{}{"a", "b"})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(db.CTX())
+		cancel()
+		dropInValues(ctx, coll)
+		assert.Empty(t, listInValues(t))
+	})
+
+	t.Run("stale collections", func(t *testing.T) {
+		db.Wipe()
+		ctx := db.CTX()
+		database := db.Client().Database(DbName)
+		fresh, err := loadInValues(ctx, database, []interface{}{"a"})
+		require.NoError(t, err)
+		for _, name := range []string{
+			fmt.Sprintf("%s%d_stale", DbSearchInValuesPrefix,
+				time.Now().Add(-2*inValuesStaleAge).Unix()),
+			DbSearchInValuesPrefix + "legacy",
+		} {
+			_, err := database.Collection(name).InsertOne(ctx, bson.M{DbDevId: "a"})
+			require.NoError(t, err)
 		}
 
+		err = dropStaleInValues(ctx, database)
+		require.NoError(t, err)
+		assert.Equal(t, []string{fresh.Name()}, listInValues(t))
+	})
+}
+
+func TestMongoSearchDevicesStale(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoSearchDevicesStale in short mode.")
+	}
+
+	now := time.Now()
+	updated := map[model.DeviceID]time.Time{
+		"0": now.Add(-time.Hour),
+		"1": now.Add(-3 * 24 * time.Hour),
+		"2": now.Add(-2 * 24 * time.Hour),
+		"3": now.Add(-10 * 24 * time.Hour),
+		"4": now,
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+	for id, ts := range updated {
+		err := mongoStore.AddDevice(ctx, &model.Device{
+			ID: id,
+			Attributes: model.DeviceAttributes{{
+				Name:  model.AttrNameUpdated,
+				Value: ts,
+				Scope: model.AttrScopeSystem,
+			}},
+		})
+		assert.NoError(t, err, "failed to setup input data")
+	}
+
+	testCases := map[string]struct {
+		olderThan time.Duration
+		page      int
+		perPage   int
+		expected  []model.DeviceID
+		total     int
+	}{
+		"older than a day": {
+			olderThan: 24 * time.Hour,
+			page:      1,
+			perPage:   20,
+			expected:  []model.DeviceID{"3", "1", "2"},
+			total:     3,
+		},
+		"older than a day, second page": {
+			olderThan: 24 * time.Hour,
+			page:      2,
+			perPage:   2,
+			expected:  []model.DeviceID{"2"},
+			total:     3,
+		},
+		"older than a minute": {
+			olderThan: time.Minute,
+			page:      1,
+			perPage:   20,
+			expected:  []model.DeviceID{"3", "1", "2", "0"},
+			total:     4,
+		},
+		"older than a month": {
+			olderThan: 30 * 24 * time.Hour,
+			page:      1,
+			perPage:   20,
+			expected:  []model.DeviceID{},
+			total:     0,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			devs, total, err := mongoStore.SearchDevices(ctx, model.SearchParams{
+				Page:    tc.page,
+				PerPage: tc.perPage,
+				Filters: []model.FilterPredicate{{
+					Scope:     model.AttrScopeSystem,
+					Attribute: model.AttrNameUpdated,
+					Type:      "$lt",
+					Value:     now.Add(-tc.olderThan),
+				}},
+				Sort: []model.SortCriteria{{
+					Scope:     model.AttrScopeSystem,
+					Attribute: model.AttrNameUpdated,
+					Order:     "asc",
+				}},
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.total, total)
+			ids := make([]model.DeviceID, len(devs))
+			for i, dev := range devs {
+				ids[i] = dev.ID
+			}
+			assert.Equal(t, tc.expected, ids)
+		})
 	}
 }
 
@@ -5078,3 +9129,604 @@ func TestMongoUpsertDevicesAttributesWithRevision(t *testing.T) {
 		})
 	}
 }
+
+func TestMongoReplaceAllAttributes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoReplaceAllAttributes in short mode.")
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+
+	err := mongoStore.AddDevice(ctx, &model.Device{
+		ID:    model.DeviceID("1"),
+		Group: model.GroupName("grp"),
+		Attributes: model.DeviceAttributes{
+			{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+			{Name: "sn", Value: "0001", Scope: model.AttrScopeIdentity},
+			{Name: "os", Value: "linux", Scope: model.AttrScopeInventory},
+			{Name: "uptime", Value: float64(10), Scope: model.AttrScopeInventory},
+			{Name: "room", Value: "1", Scope: model.AttrScopeTags},
+		},
+	})
+	assert.NoError(t, err)
+	before, err := mongoStore.GetDevice(ctx, model.DeviceID("1"))
+	assert.NoError(t, err)
+
+	err = mongoStore.ReplaceAllAttributes(ctx, model.DeviceID("1"), model.DeviceAttributes{
+		{Name: "mac", Value: "00:22", Scope: model.AttrScopeIdentity},
+		{Name: "kernel", Value: "6.1", Scope: model.AttrScopeInventory},
+		{Name: "floor.level", Value: "$2", Scope: model.AttrScopeTags},
+	})
+	assert.NoError(t, err)
+
+	dev, err := mongoStore.GetDevice(ctx, model.DeviceID("1"))
+	assert.NoError(t, err)
+	if assert.NotNil(t, dev) {
+		values := make(map[string]interface{})
+		for _, attr := range dev.Attributes {
+			if attr.Scope != model.AttrScopeSystem {
+				values[attr.Scope+"/"+attr.Name] = attr.Value
+			}
+		}
+		assert.Equal(t, map[string]interface{}{
+			model.AttrScopeIdentity + "/mac":     "00:22",
+			model.AttrScopeInventory + "/kernel": "6.1",
+			model.AttrScopeTags + "/floor.level": "$2",
+		}, values)
+		assert.Equal(t, model.GroupName("grp"), dev.Group)
+		assert.WithinDuration(t, before.CreatedTs, dev.CreatedTs, time.Millisecond)
+		if assert.NotNil(t, dev.UpdatedTs) && assert.NotNil(t, before.UpdatedTs) {
+			assert.False(t, dev.UpdatedTs.Before(*before.UpdatedTs))
+		}
+	}
+
+	err = mongoStore.ReplaceAllAttributes(ctx, model.DeviceID("2"), model.DeviceAttributes{
+		{Name: "mac", Value: "00:33", Scope: model.AttrScopeIdentity},
+	})
+	assert.EqualError(t, err, store.ErrDevNotFound.Error())
+}
+
+func TestMongoMoveAttributesBetweenScopes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoMoveAttributesBetweenScopes in short mode.")
+	}
+
+	testCases := map[string]struct {
+		policy   string
+		expected map[string]interface{}
+	}{
+		"overwrite": {
+			policy: model.MergePolicyOverwrite,
+			expected: map[string]interface{}{
+				"inventory/cpu":      "arm64",
+				"inventory/mem.free": float64(512),
+				"inventory/fw":       "1.0",
+			},
+		},
+		"keep": {
+			policy: model.MergePolicyKeep,
+			expected: map[string]interface{}{
+				"inventory/cpu":      "arm",
+				"inventory/mem.free": float64(512),
+				"inventory/fw":       "1.0",
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db.Wipe()
+			ctx := db.CTX()
+			mongoStore := NewDataStoreMongoWithSession(db.Client())
+
+			err := mongoStore.AddDevice(ctx, &model.Device{
+				ID: "1",
+				Attributes: model.DeviceAttributes{
+					{Name: "cpu", Value: "arm64", Scope: model.AttrScopeMonitor},
+					{Name: "mem.free", Value: float64(512), Scope: model.AttrScopeMonitor},
+					{Name: "cpu", Value: "arm", Scope: model.AttrScopeInventory},
+					{Name: "fw", Value: "1.0", Scope: model.AttrScopeInventory},
+				},
+			})
+			require.NoError(t, err, "failed to setup input data")
+
+			dev, err := mongoStore.MoveAttributesBetweenScopes(ctx, "1",
+				model.AttrScopeMonitor, model.AttrScopeInventory, tc.policy)
+			require.NoError(t, err)
+			require.NotNil(t, dev)
+
+			stored, err := mongoStore.GetDevice(ctx, "1")
+			require.NoError(t, err)
+			for _, d := range []*model.Device{dev, stored} {
+				actual := map[string]interface{}{}
+				for _, attr := range d.Attributes {
+					if attr.Scope != model.AttrScopeSystem {
+						actual[attr.Scope+"/"+attr.Name] = attr.Value
+					}
+				}
+				assert.Equal(t, tc.expected, actual)
+			}
+
+			// the moved attributes can be searched in the target scope
+			devs, _, err := mongoStore.SearchDevices(ctx, model.SearchParams{
+				Page:    1,
+				PerPage: 10,
+				Filters: []model.FilterPredicate{{
+					Scope:     model.AttrScopeInventory,
+					Attribute: "mem.free",
+					Type:      "$eq",
+					Value:     float64(512),
+				}},
+			})
+			require.NoError(t, err)
+			assert.Len(t, devs, 1)
+		})
+	}
+
+	t.Run("device not found", func(t *testing.T) {
+		db.Wipe()
+		mongoStore := NewDataStoreMongoWithSession(db.Client())
+
+		_, err := mongoStore.MoveAttributesBetweenScopes(db.CTX(), "1",
+			model.AttrScopeMonitor, model.AttrScopeInventory, model.MergePolicyOverwrite)
+		assert.ErrorIs(t, err, store.ErrDevNotFound)
+	})
+}
+
+func TestMongoToggleAttribute(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoToggleAttribute in short mode.")
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+
+	err := mongoStore.AddDevice(ctx, &model.Device{
+		ID: model.DeviceID("1"),
+		Attributes: model.DeviceAttributes{
+			{Name: "maintenance", Value: true, Scope: model.AttrScopeTags},
+			{Name: "online", Value: false, Scope: model.AttrScopeInventory},
+			{Name: "os", Value: "linux", Scope: model.AttrScopeInventory},
+		},
+	})
+	require.NoError(t, err, "failed to setup input data")
+
+	attrValue := func(dev *model.Device, scope, name string) interface{} {
+		for _, attr := range dev.Attributes {
+			if attr.Scope == scope && attr.Name == name {
+				return attr.Value
+			}
+		}
+		return nil
+	}
+
+	testCases := []struct {
+		name         string
+		id           model.DeviceID
+		scope        string
+		attrName     string
+		defaultValue bool
+
+		outValue interface{}
+		outError error
+	}{
+		{
+			name:     "ok, true to false",
+			id:       "1",
+			scope:    model.AttrScopeTags,
+			attrName: "maintenance",
+			outValue: false,
+		},
+		{
+			name:     "ok, false to true",
+			id:       "1",
+			scope:    model.AttrScopeInventory,
+			attrName: "online",
+			outValue: true,
+		},
+		{
+			name:         "ok, set from absent",
+			id:           "1",
+			scope:        model.AttrScopeTags,
+			attrName:     "locked",
+			defaultValue: true,
+			outValue:     true,
+		},
+		{
+			name:         "ok, toggle after set from absent",
+			id:           "1",
+			scope:        model.AttrScopeTags,
+			attrName:     "locked",
+			defaultValue: true,
+			outValue:     false,
+		},
+		{
+			name:     "ko, not a boolean",
+			id:       "1",
+			scope:    model.AttrScopeInventory,
+			attrName: "os",
+			outError: store.ErrAttributeTypeConflict,
+		},
+		{
+			name:     "ko, device not found",
+			id:       "2",
+			scope:    model.AttrScopeTags,
+			attrName: "maintenance",
+			outError: store.ErrDevNotFound,
+		},
+	}
+
+	// the cases run in order as they build on each other
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dev, err := mongoStore.ToggleAttribute(
+				ctx, tc.id, tc.scope, tc.attrName, tc.defaultValue,
+			)
+			if tc.outError != nil {
+				assert.Equal(t, tc.outError, errors.Cause(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.outValue, attrValue(dev, tc.scope, tc.attrName))
+
+			stored, err := mongoStore.GetDevice(ctx, tc.id)
+			require.NoError(t, err)
+			assert.Equal(t, tc.outValue, attrValue(stored, tc.scope, tc.attrName))
+		})
+	}
+}
+
+func TestMongoGetDevicesWithStaleScope(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoGetDevicesWithStaleScope in short mode.")
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+
+	for _, id := range []model.DeviceID{"1", "2", "3", "4"} {
+		err := mongoStore.AddDevice(ctx, &model.Device{
+			ID: id,
+			Attributes: model.DeviceAttributes{
+				{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+			},
+		})
+		require.NoError(t, err, "failed to setup input data")
+	}
+	_, err := mongoStore.UpsertDevicesAttributesWithUpdated(ctx,
+		[]model.DeviceID{"1", "2", "3"},
+		model.DeviceAttributes{
+			{Name: "alerts", Value: true, Scope: model.AttrScopeMonitor},
+		},
+		model.AttrScopeMonitor, "",
+	)
+	require.NoError(t, err, "failed to setup input data")
+
+	// backdate the monitor scope of the devices 1 and 2
+	c := db.Client().Database(DbName).Collection(DbDevicesColl)
+	for id, age := range map[model.DeviceID]time.Duration{
+		"1": 2 * time.Hour,
+		"2": 3 * time.Hour,
+	} {
+		_, err := c.UpdateOne(ctx,
+			bson.M{DbDevId: id},
+			bson.M{"$set": bson.M{
+				DbDevScopesUpdatedTs + "." + model.AttrScopeMonitor: time.Now().Add(-age),
+			}},
+		)
+		require.NoError(t, err, "failed to setup input data")
+	}
+
+	testCases := map[string]struct {
+		scope     string
+		olderThan time.Duration
+
+		outIDs []model.DeviceID
+	}{
+		"ok, oldest first": {
+			scope:     model.AttrScopeMonitor,
+			olderThan: time.Hour,
+			outIDs:    []model.DeviceID{"2", "1"},
+		},
+		"ok, longer threshold": {
+			scope:     model.AttrScopeMonitor,
+			olderThan: 150 * time.Minute,
+			outIDs:    []model.DeviceID{"2"},
+		},
+		"ok, fresh scope": {
+			scope:     model.AttrScopeInventory,
+			olderThan: time.Hour,
+			outIDs:    []model.DeviceID{},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			devices, err := mongoStore.GetDevicesWithStaleScope(ctx, tc.scope, tc.olderThan)
+			assert.NoError(t, err)
+			ids := make([]model.DeviceID, len(devices))
+			for i, dev := range devices {
+				ids[i] = dev.ID
+			}
+			assert.Equal(t, tc.outIDs, ids)
+		})
+	}
+}
+
+func TestMongoGetDevicesUpdatedByScopeSince(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoGetDevicesUpdatedByScopeSince in short mode.")
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+
+	for _, id := range []model.DeviceID{"1", "2", "3", "4"} {
+		err := mongoStore.AddDevice(ctx, &model.Device{
+			ID: id,
+			Attributes: model.DeviceAttributes{
+				{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+			},
+		})
+		require.NoError(t, err, "failed to setup input data")
+	}
+	_, err := mongoStore.UpsertDevicesAttributesWithUpdated(ctx,
+		[]model.DeviceID{"1", "2", "3"},
+		model.DeviceAttributes{
+			{Name: "alerts", Value: true, Scope: model.AttrScopeMonitor},
+		},
+		model.AttrScopeMonitor, "",
+	)
+	require.NoError(t, err, "failed to setup input data")
+	// a recent write to another scope does not count for the monitor scope
+	_, err = mongoStore.UpsertDevicesAttributesWithUpdated(ctx,
+		[]model.DeviceID{"4"},
+		model.DeviceAttributes{
+			{Name: "kernel", Value: "6.1", Scope: model.AttrScopeInventory},
+		},
+		model.AttrScopeInventory, "",
+	)
+	require.NoError(t, err, "failed to setup input data")
+
+	// backdate the monitor scope of the devices 1 and 2
+	c := db.Client().Database(DbName).Collection(DbDevicesColl)
+	for id, age := range map[model.DeviceID]time.Duration{
+		"1": 2 * time.Hour,
+		"2": 3 * time.Hour,
+	} {
+		_, err := c.UpdateOne(ctx,
+			bson.M{DbDevId: id},
+			bson.M{"$set": bson.M{
+				DbDevScopesUpdatedTs + "." + model.AttrScopeMonitor: time.Now().Add(-age),
+			}},
+		)
+		require.NoError(t, err, "failed to setup input data")
+	}
+
+	testCases := map[string]struct {
+		scope string
+		since time.Time
+
+		outIDs []model.DeviceID
+	}{
+		"ok, oldest first": {
+			scope:  model.AttrScopeMonitor,
+			since:  time.Now().Add(-150 * time.Minute),
+			outIDs: []model.DeviceID{"1", "3"},
+		},
+		"ok, recent writes only": {
+			scope:  model.AttrScopeMonitor,
+			since:  time.Now().Add(-time.Hour),
+			outIDs: []model.DeviceID{"3"},
+		},
+		"ok, other scope": {
+			scope:  model.AttrScopeInventory,
+			since:  time.Now().Add(-time.Hour),
+			outIDs: []model.DeviceID{"4"},
+		},
+		"ok, no writes": {
+			scope:  model.AttrScopeTags,
+			since:  time.Now().Add(-time.Hour),
+			outIDs: []model.DeviceID{},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			devices, err := mongoStore.GetDevicesUpdatedByScopeSince(ctx, tc.scope, tc.since)
+			assert.NoError(t, err)
+			ids := make([]model.DeviceID, len(devices))
+			for i, dev := range devices {
+				ids[i] = dev.ID
+			}
+			assert.Equal(t, tc.outIDs, ids)
+		})
+	}
+}
+
+func TestMongoFindDevicesByAttributeSet(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoFindDevicesByAttributeSet in short mode.")
+	}
+
+	inputDevs := []model.Device{
+		{
+			ID: model.DeviceID("1"),
+			Attributes: model.DeviceAttributes{
+				{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+				{Name: "sn", Value: "0001", Scope: model.AttrScopeIdentity},
+				{Name: "os", Value: "linux", Scope: model.AttrScopeInventory},
+			},
+		},
+		{
+			ID: model.DeviceID("2"),
+			Attributes: model.DeviceAttributes{
+				{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+				{Name: "sn", Value: "0001", Scope: model.AttrScopeIdentity},
+				{Name: "cpu", Value: float64(4), Scope: model.AttrScopeIdentity},
+			},
+		},
+		{
+			ID: model.DeviceID("3"),
+			Attributes: model.DeviceAttributes{
+				{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+				{Name: "sn", Value: "0001", Scope: model.AttrScopeIdentity},
+				{Name: "os", Value: "windows", Scope: model.AttrScopeInventory},
+			},
+		},
+		{
+			ID: model.DeviceID("4"),
+			Attributes: model.DeviceAttributes{
+				{Name: "mac", Value: "00:22", Scope: model.AttrScopeIdentity},
+				{Name: "sn", Value: "0001", Scope: model.AttrScopeIdentity},
+			},
+		},
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+	for i := range inputDevs {
+		err := mongoStore.AddDevice(ctx, &inputDevs[i])
+		require.NoError(t, err, "failed to setup input data")
+	}
+
+	testCases := map[string]struct {
+		scope string
+		attrs model.DeviceAttributes
+
+		outIDs []model.DeviceID
+	}{
+		"ok, exact match": {
+			scope: model.AttrScopeIdentity,
+			attrs: model.DeviceAttributes{
+				{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+				{Name: "sn", Value: "0001", Scope: model.AttrScopeIdentity},
+			},
+			// device 2 has an extra identity attribute; the attributes
+			// of the other scopes don't count
+			outIDs: []model.DeviceID{"1", "3"},
+		},
+		"ok, exact match with the extra attribute": {
+			scope: model.AttrScopeIdentity,
+			attrs: model.DeviceAttributes{
+				{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+				{Name: "sn", Value: "0001", Scope: model.AttrScopeIdentity},
+				{Name: "cpu", Value: float64(4), Scope: model.AttrScopeIdentity},
+			},
+			outIDs: []model.DeviceID{"2"},
+		},
+		"ok, subset doesn't match": {
+			scope: model.AttrScopeIdentity,
+			attrs: model.DeviceAttributes{
+				{Name: "sn", Value: "0001", Scope: model.AttrScopeIdentity},
+			},
+			outIDs: []model.DeviceID{},
+		},
+		"ok, different value": {
+			scope: model.AttrScopeInventory,
+			attrs: model.DeviceAttributes{
+				{Name: "os", Value: "macos", Scope: model.AttrScopeInventory},
+			},
+			outIDs: []model.DeviceID{},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			devices, err := mongoStore.FindDevicesByAttributeSet(ctx, tc.scope, tc.attrs)
+			assert.NoError(t, err)
+			ids := make([]model.DeviceID, len(devices))
+			for i, dev := range devices {
+				ids[i] = dev.ID
+			}
+			assert.Equal(t, tc.outIDs, ids)
+		})
+	}
+}
+
+func TestMongoGetAttributesPresence(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMongoGetAttributesPresence in short mode.")
+	}
+
+	inputDevs := []model.Device{
+		{
+			ID: model.DeviceID("1"),
+			Attributes: model.DeviceAttributes{
+				{Name: "os", Value: "linux", Scope: model.AttrScopeInventory},
+				{Name: "room", Value: "1", Scope: model.AttrScopeTags},
+			},
+		},
+		{
+			ID: model.DeviceID("2"),
+			Attributes: model.DeviceAttributes{
+				{Name: "os", Value: "linux", Scope: model.AttrScopeInventory},
+				{Name: "kernel", Value: "6.1", Scope: model.AttrScopeInventory},
+			},
+		},
+		{
+			ID: model.DeviceID("3"),
+			Attributes: model.DeviceAttributes{
+				{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+			},
+		},
+	}
+
+	db.Wipe()
+	ctx := db.CTX()
+	mongoStore := NewDataStoreMongoWithSession(db.Client())
+	for i := range inputDevs {
+		err := mongoStore.AddDevice(ctx, &inputDevs[i])
+		require.NoError(t, err, "failed to setup input data")
+	}
+
+	attributes := []model.SelectAttribute{
+		{Scope: model.AttrScopeInventory, Attribute: "os"},
+		{Scope: model.AttrScopeTags, Attribute: "room"},
+		{Scope: model.AttrScopeInventory, Attribute: "kernel"},
+		{Scope: model.AttrScopeIdentity, Attribute: "mac"},
+		{Scope: model.AttrScopeTags, Attribute: "os"},
+	}
+
+	testCases := map[string]struct {
+		ids        []model.DeviceID
+		attributes []model.SelectAttribute
+
+		outPresence map[model.DeviceID][]bool
+	}{
+		"ok": {
+			ids:        []model.DeviceID{"1", "2", "3", "4"},
+			attributes: attributes,
+			outPresence: map[model.DeviceID][]bool{
+				"1": {true, true, false, false, false},
+				"2": {true, false, true, false, false},
+				"3": {false, false, false, true, false},
+			},
+		},
+		"ok, single device": {
+			ids:        []model.DeviceID{"2"},
+			attributes: attributes[:2],
+			outPresence: map[model.DeviceID][]bool{
+				"2": {true, false},
+			},
+		},
+		"ok, no devices": {
+			attributes:  attributes,
+			outPresence: map[model.DeviceID][]bool{},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			presence, err := mongoStore.GetAttributesPresence(ctx, tc.ids, tc.attributes)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.outPresence, presence)
+		})
+	}
+}
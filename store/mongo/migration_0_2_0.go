@@ -32,7 +32,7 @@ type migration_0_2_0 struct {
 
 func (m *migration_0_2_0) Up(from migrate.Version) error {
 	// get all attribute names
-	names, err := m.ms.GetAllAttributeNames(m.ctx)
+	names, err := m.ms.GetAllAttributeNames(m.ctx, false)
 	if err != nil {
 		return errors.Wrap(err, "failed to get attribute names")
 	}
@@ -16,6 +16,8 @@ package mongo
 
 import (
 	"context"
+	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 
@@ -30,10 +32,9 @@ import (
 // WithAutomigrate enables automatic migration and returns a new datastore based
 // on current one
 func (db *DataStoreMongo) WithAutomigrate() store.DataStore {
-	return &DataStoreMongo{
-		client:      db.client,
-		automigrate: true,
-	}
+	dup := *db
+	dup.automigrate = true
+	return &dup
 }
 
 func (db *DataStoreMongo) MigrateTenant(
@@ -83,6 +84,10 @@ func (db *DataStoreMongo) MigrateTenant(
 			ms:  db,
 			ctx: ctx,
 		},
+		&migration_1_2_0{
+			ms:  db,
+			ctx: ctx,
+		},
 	}
 
 	err = m.Apply(ctx, *ver, migrations)
@@ -90,6 +95,18 @@ func (db *DataStoreMongo) MigrateTenant(
 		return errors.Wrap(err, "failed to apply migrations")
 	}
 
+	if db.automigrate {
+		err = dropStaleInValues(ctx, db.client.Database(database))
+		if err != nil {
+			return err
+		}
+		if db.caseInsensitiveNames {
+			if err := db.indexAttributeNames(ctx); err != nil {
+				return err
+			}
+		}
+		return db.indexAttributesValues(ctx)
+	}
 	return nil
 }
 
@@ -111,15 +128,59 @@ func (db *DataStoreMongo) Migrate(ctx context.Context, version string) error {
 		l.Infof("automigrate is OFF, will check db version compatibility")
 	}
 
-	for _, d := range dbs {
-		l.Infof("migrating %s", d)
+	return migrateTenants(ctx, dbs, db.migrationConcurrency,
+		func(ctx context.Context, tenantId string) error {
+			return db.MigrateTenant(ctx, version, tenantId)
+		})
+}
 
-		tenantId := mstore.TenantFromDbName(d, DbName)
+// migrateTenants migrates the databases with up to concurrency migrations
+// running at the same time; a failed migration doesn't stop the others,
+// and the errors of all the failed migrations are returned together
+func migrateTenants(
+	ctx context.Context,
+	dbs []string,
+	concurrency int,
+	migrateTenant func(ctx context.Context, tenantId string) error,
+) error {
+	l := log.FromContext(ctx)
 
-		if err := db.MigrateTenant(ctx, version, tenantId); err != nil {
-			return err
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	errs := make([]error, len(dbs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				l.Infof("migrating %s", dbs[i])
+				tenantId := mstore.TenantFromDbName(dbs[i], DbName)
+				if err := migrateTenant(ctx, tenantId); err != nil {
+					l.Errorf("failed to migrate %s: %s", dbs[i], err.Error())
+					errs[i] = err
+				}
+			}
+		}()
+	}
+	for i := range dbs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var msgs []string
+	for i, err := range errs {
+		if err != nil {
+			msgs = append(msgs, dbs[i]+": "+err.Error())
 		}
 	}
+	if len(msgs) > 0 {
+		return errors.Errorf("failed to migrate %d of %d databases: %s",
+			len(msgs), len(dbs), strings.Join(msgs, "; "))
+	}
 	return nil
 }
 
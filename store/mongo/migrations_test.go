@@ -0,0 +1,99 @@
+// Copyright 2026 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	mstore "github.com/mendersoftware/go-lib-micro/store"
+)
+
+func TestMigrateTenants(t *testing.T) {
+	const concurrency = 2
+
+	tenants := []string{"t1", "t2", "t3", "t4", "t5"}
+	dbs := make([]string, len(tenants))
+	for i, tenant := range tenants {
+		dbs[i] = mstore.DbNameForTenant(tenant, DbName)
+	}
+
+	started := make(chan string)
+	release := make(chan struct{})
+	var (
+		mu       sync.Mutex
+		migrated []string
+	)
+	migrateTenant := func(ctx context.Context, tenantId string) error {
+		started <- tenantId
+		<-release
+		mu.Lock()
+		migrated = append(migrated, tenantId)
+		mu.Unlock()
+		if tenantId == "t2" || tenantId == "t4" {
+			return errors.New("migration failed")
+		}
+		return nil
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- migrateTenants(context.Background(), dbs, concurrency, migrateTenant)
+	}()
+
+	// the migrations run concurrently up to the limit
+	for i := 0; i < concurrency; i++ {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for the migrations to start")
+		}
+	}
+	select {
+	case tenant := <-started:
+		t.Fatalf("migration of %s started above the concurrency limit", tenant)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	for i := concurrency; i < len(tenants); i++ {
+		<-started
+	}
+	err := <-done
+
+	// the failed migrations don't stop the others
+	sort.Strings(migrated)
+	assert.Equal(t, tenants, migrated)
+	assert.EqualError(t, err, "failed to migrate 2 of 5 databases: "+
+		"inventory-t2: migration failed; inventory-t4: migration failed")
+}
+
+func TestMigrateTenantsSequential(t *testing.T) {
+	dbs := []string{DbName}
+	var migrated []string
+	err := migrateTenants(context.Background(), dbs, 0,
+		func(ctx context.Context, tenantId string) error {
+			migrated = append(migrated, tenantId)
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, migrated)
+}
@@ -13,7 +13,11 @@
 //	limitations under the License.
 package store
 
-import "time"
+import (
+	"time"
+
+	"github.com/mendersoftware/inventory/model"
+)
 
 type ComparisonOperator int
 
@@ -43,4 +47,17 @@ type ListQuery struct {
 	Sort      *Sort
 	HasGroup  *bool
 	GroupName string
+	// AnyTags, if set, matches devices having at least one of the named
+	// tags, regardless of the tag value
+	AnyTags []string
+	// Attributes, if set, limits the attributes of the returned devices
+	// to the listed ones and the system timestamps
+	Attributes []model.SelectAttribute
+}
+
+// Unfiltered returns true if the query matches all the devices, in which
+// case the total count of the devices may be an estimate.
+func (q ListQuery) Unfiltered() bool {
+	return len(q.Filters) == 0 && q.HasGroup == nil &&
+		q.GroupName == "" && len(q.AnyTags) == 0
 }
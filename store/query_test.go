@@ -0,0 +1,52 @@
+// Copyright 2023 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListQueryUnfiltered(t *testing.T) {
+	hasGroup := false
+
+	testCases := map[string]struct {
+		query      ListQuery
+		unfiltered bool
+	}{
+		"unfiltered": {
+			query:      ListQuery{Skip: 10, Limit: 5, Sort: &Sort{AttrName: "mac"}},
+			unfiltered: true,
+		},
+		"filters": {
+			query: ListQuery{Filters: []Filter{{AttrName: "mac", Value: "foo"}}},
+		},
+		"group": {
+			query: ListQuery{GroupName: "foo"},
+		},
+		"has group": {
+			query: ListQuery{HasGroup: &hasGroup},
+		},
+		"tags": {
+			query: ListQuery{AnyTags: []string{"foo"}},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.unfiltered, tc.query.Unfiltered())
+		})
+	}
+}
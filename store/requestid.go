@@ -0,0 +1,666 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/requestid"
+
+	"github.com/mendersoftware/inventory/model"
+)
+
+// RequestIDError is an error of the data store annotated with the ID of
+// the request it occurred in; errors.Is and errors.Cause see through it.
+type RequestIDError struct {
+	RequestID string
+	Err       error
+}
+
+func (e *RequestIDError) Error() string {
+	return e.Err.Error() + " (request_id: " + e.RequestID + ")"
+}
+
+func (e *RequestIDError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RequestIDError) Cause() error {
+	return e.Err
+}
+
+// withRequestID annotates the error with the request ID of the context, if
+// any
+func withRequestID(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	reqID := requestid.FromContext(ctx)
+	if reqID == "" {
+		return err
+	}
+	return &RequestIDError{RequestID: reqID, Err: err}
+}
+
+// requestIDDataStore annotates the errors of the wrapped data store with
+// the request ID; it overrides each method returning an error, the methods
+// added to DataStore need to be overridden too
+type requestIDDataStore struct {
+	DataStore
+}
+
+// WithRequestIDErrors returns the data store annotating the errors
+// returned by ds with the ID of the request, so that they can be
+// correlated across the logs of the layers
+func WithRequestIDErrors(ds DataStore) DataStore {
+	return &requestIDDataStore{DataStore: ds}
+}
+
+func (ds *requestIDDataStore) WithAutomigrate() DataStore {
+	return WithRequestIDErrors(ds.DataStore.WithAutomigrate())
+}
+
+func (ds *requestIDDataStore) WithAdminAccess() DataStore {
+	return WithRequestIDErrors(ds.DataStore.WithAdminAccess())
+}
+
+func (ds *requestIDDataStore) Ping(ctx context.Context) error {
+	err := ds.DataStore.Ping(ctx)
+	return withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) Close(ctx context.Context) error {
+	err := ds.DataStore.Close(ctx)
+	return withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetDevices(
+	ctx context.Context,
+	q ListQuery,
+) ([]model.Device, int, error) {
+	r0, r1, err := ds.DataStore.GetDevices(ctx, q)
+	return r0, r1, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetDevicesPartitionedByGroup(
+	ctx context.Context,
+	q ListQuery,
+	perGroup int,
+) (map[model.GroupName][]model.DeviceID, error) {
+	r0, err := ds.DataStore.GetDevicesPartitionedByGroup(ctx, q, perGroup)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetDevice(
+	ctx context.Context,
+	id model.DeviceID,
+) (*model.Device, error) {
+	r0, err := ds.DataStore.GetDevice(ctx, id)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetDevicesMap(
+	ctx context.Context,
+	ids []model.DeviceID,
+) (map[model.DeviceID]*model.Device, error) {
+	r0, err := ds.DataStore.GetDevicesMap(ctx, ids)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetDevicesByIDs(
+	ctx context.Context,
+	ids []model.DeviceID,
+) ([]model.Device, error) {
+	r0, err := ds.DataStore.GetDevicesByIDs(ctx, ids)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) AddDevice(ctx context.Context, dev *model.Device) error {
+	err := ds.DataStore.AddDevice(ctx, dev)
+	return withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) CreateDevice(ctx context.Context, dev *model.Device) error {
+	err := ds.DataStore.CreateDevice(ctx, dev)
+	return withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) ReplaceDevice(ctx context.Context, dev *model.Device) error {
+	err := ds.DataStore.ReplaceDevice(ctx, dev)
+	return withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) DeleteDevices(
+	ctx context.Context,
+	ids []model.DeviceID,
+) (*model.UpdateResult, error) {
+	r0, err := ds.DataStore.DeleteDevices(ctx, ids)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) UpsertDevicesAttributesWithUpdated(
+	ctx context.Context,
+	ids []model.DeviceID,
+	attrs model.DeviceAttributes,
+	scope string,
+	etag string,
+) (*model.UpdateResult, error) {
+	r0, err := ds.DataStore.UpsertDevicesAttributesWithUpdated(ctx, ids, attrs, scope, etag)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) UpsertDevicesAttributes(
+	ctx context.Context,
+	ids []model.DeviceID,
+	attrs model.DeviceAttributes,
+) (*model.UpdateResult, error) {
+	r0, err := ds.DataStore.UpsertDevicesAttributes(ctx, ids, attrs)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) UpsertRemoveDeviceAttributes(
+	ctx context.Context,
+	id model.DeviceID,
+	updateAttrs model.DeviceAttributes,
+	removeAttrs model.DeviceAttributes,
+	scope string,
+	etag string,
+) (*model.UpdateResult, error) {
+	r0, err := ds.DataStore.UpsertRemoveDeviceAttributes(ctx, id, updateAttrs, removeAttrs, scope, etag)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) ReplaceAllAttributes(
+	ctx context.Context,
+	id model.DeviceID,
+	attrs model.DeviceAttributes,
+) error {
+	err := ds.DataStore.ReplaceAllAttributes(ctx, id, attrs)
+	return withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) ToggleAttribute(
+	ctx context.Context,
+	id model.DeviceID,
+	scope string,
+	name string,
+	defaultValue bool,
+) (*model.Device, error) {
+	r0, err := ds.DataStore.ToggleAttribute(ctx, id, scope, name, defaultValue)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) MoveAttributesBetweenScopes(
+	ctx context.Context,
+	id model.DeviceID,
+	fromScope string,
+	toScope string,
+	policy string,
+) (*model.Device, error) {
+	r0, err := ds.DataStore.MoveAttributesBetweenScopes(ctx, id, fromScope, toScope, policy)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) UpsertDevicesAttributesWithRevision(
+	ctx context.Context,
+	ids []model.DeviceUpdate,
+	attrs model.DeviceAttributes,
+) (*model.UpdateResult, error) {
+	r0, err := ds.DataStore.UpsertDevicesAttributesWithRevision(ctx, ids, attrs)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) UpdateDeviceText(
+	ctx context.Context,
+	id model.DeviceID,
+	text string,
+) error {
+	err := ds.DataStore.UpdateDeviceText(ctx, id, text)
+	return withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetFiltersAttributes(
+	ctx context.Context,
+) ([]model.FilterAttribute, error) {
+	r0, err := ds.DataStore.GetFiltersAttributes(ctx)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetDescribedAttributes(
+	ctx context.Context,
+) ([]model.DescribedAttribute, error) {
+	r0, err := ds.DataStore.GetDescribedAttributes(ctx)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetGroupSchema(
+	ctx context.Context,
+	group model.GroupName,
+) ([]model.SchemaAttribute, error) {
+	r0, err := ds.DataStore.GetGroupSchema(ctx, group)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) FacetByAttributeFiltered(
+	ctx context.Context,
+	scope string,
+	name string,
+	filters []model.FilterPredicate,
+) ([]model.AttributeValueCount, error) {
+	r0, err := ds.DataStore.FacetByAttributeFiltered(ctx, scope, name, filters)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) TopAttributeValues(
+	ctx context.Context,
+	scope string,
+	name string,
+	limit int,
+) ([]model.AttributeValueCount, error) {
+	r0, err := ds.DataStore.TopAttributeValues(ctx, scope, name, limit)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) AttributeCardinality(
+	ctx context.Context,
+	scope string,
+	name string,
+) (int, error) {
+	r0, err := ds.DataStore.AttributeCardinality(ctx, scope, name)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) CountDevicesByAttribute(
+	ctx context.Context,
+) ([]model.AttributeCoverage, int, error) {
+	r0, r1, err := ds.DataStore.CountDevicesByAttribute(ctx)
+	return r0, r1, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetAttributeScopes(ctx context.Context) ([]string, error) {
+	r0, err := ds.DataStore.GetAttributeScopes(ctx)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) IncrementAttributesChurn(
+	ctx context.Context,
+	attrs model.DeviceAttributes,
+) error {
+	err := ds.DataStore.IncrementAttributesChurn(ctx, attrs)
+	return withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetAttributesChurn(
+	ctx context.Context,
+) ([]model.AttributeChurn, error) {
+	r0, err := ds.DataStore.GetAttributesChurn(ctx)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetIngestHash(
+	ctx context.Context,
+	id model.DeviceID,
+) (string, error) {
+	r0, err := ds.DataStore.GetIngestHash(ctx, id)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) SetIngestHash(
+	ctx context.Context,
+	id model.DeviceID,
+	hash string,
+	expire time.Time,
+) error {
+	err := ds.DataStore.SetIngestHash(ctx, id, hash, expire)
+	return withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) FindDevicesByAttributeValues(
+	ctx context.Context,
+	scope string,
+	name string,
+	values []interface{},
+) ([]model.Device, error) {
+	r0, err := ds.DataStore.FindDevicesByAttributeValues(ctx, scope, name, values)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) FindDevicesWithAttributeDrift(
+	ctx context.Context,
+	scope string,
+	name string,
+	value interface{},
+) ([]model.Device, error) {
+	r0, err := ds.DataStore.FindDevicesWithAttributeDrift(ctx, scope, name, value)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) FindDevicesByAttributeSet(
+	ctx context.Context,
+	scope string,
+	attrs model.DeviceAttributes,
+) ([]model.Device, error) {
+	r0, err := ds.DataStore.FindDevicesByAttributeSet(ctx, scope, attrs)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetDevicesWithStaleScope(
+	ctx context.Context,
+	scope string,
+	olderThan time.Duration,
+) ([]model.Device, error) {
+	r0, err := ds.DataStore.GetDevicesWithStaleScope(ctx, scope, olderThan)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetDevicesUpdatedByScopeSince(
+	ctx context.Context,
+	scope string,
+	since time.Time,
+) ([]model.Device, error) {
+	r0, err := ds.DataStore.GetDevicesUpdatedByScopeSince(ctx, scope, since)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) SampleDevices(
+	ctx context.Context,
+	n int,
+	filters []model.FilterPredicate,
+) ([]model.Device, error) {
+	r0, err := ds.DataStore.SampleDevices(ctx, n, filters)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetAttributesPresence(
+	ctx context.Context,
+	ids []model.DeviceID,
+	attributes []model.SelectAttribute,
+) (map[model.DeviceID][]bool, error) {
+	r0, err := ds.DataStore.GetAttributesPresence(ctx, ids, attributes)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetDevicesAttributesCount(
+	ctx context.Context,
+	ids []model.DeviceID,
+) (map[model.DeviceID]int, error) {
+	r0, err := ds.DataStore.GetDevicesAttributesCount(ctx, ids)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetDevicesStatuses(
+	ctx context.Context,
+	ids []model.DeviceID,
+) (map[model.DeviceID]*string, error) {
+	r0, err := ds.DataStore.GetDevicesStatuses(ctx, ids)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) ExplainSearchDevices(
+	ctx context.Context,
+	searchParams model.SearchParams,
+) (map[string]interface{}, error) {
+	r0, err := ds.DataStore.ExplainSearchDevices(ctx, searchParams)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) CountDevicesCreatedPerDay(
+	ctx context.Context,
+	from, to time.Time,
+) (map[time.Time]int, error) {
+	r0, err := ds.DataStore.CountDevicesCreatedPerDay(ctx, from, to)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) CountDevicesByAlertCount(
+	ctx context.Context,
+	scope string,
+) (map[string]int, error) {
+	r0, err := ds.DataStore.CountDevicesByAlertCount(ctx, scope)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetFeatureFlags(ctx context.Context) (model.FeatureFlags, error) {
+	r0, err := ds.DataStore.GetFeatureFlags(ctx)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) SetFeatureFlags(ctx context.Context, flags model.FeatureFlags) error {
+	err := ds.DataStore.SetFeatureFlags(ctx, flags)
+	return withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) CreateSavedFilter(
+	ctx context.Context,
+	filter *model.SavedFilter,
+) error {
+	err := ds.DataStore.CreateSavedFilter(ctx, filter)
+	return withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetSavedFilter(
+	ctx context.Context,
+	id string,
+) (*model.SavedFilter, error) {
+	r0, err := ds.DataStore.GetSavedFilter(ctx, id)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) ListSavedFilters(ctx context.Context) ([]model.SavedFilter, error) {
+	r0, err := ds.DataStore.ListSavedFilters(ctx)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) UpdateSavedFilter(
+	ctx context.Context,
+	filter *model.SavedFilter,
+) error {
+	err := ds.DataStore.UpdateSavedFilter(ctx, filter)
+	return withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) DeleteSavedFilter(ctx context.Context, id string) error {
+	err := ds.DataStore.DeleteSavedFilter(ctx, id)
+	return withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) FindDevicesWithDuplicateAttributes(
+	ctx context.Context,
+	skip int,
+	limit int,
+) ([]model.DeviceDuplicateAttributes, error) {
+	r0, err := ds.DataStore.FindDevicesWithDuplicateAttributes(ctx, skip, limit)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) RepairDuplicateAttributes(
+	ctx context.Context,
+	id model.DeviceID,
+) (int, error) {
+	r0, err := ds.DataStore.RepairDuplicateAttributes(ctx, id)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) VerifyDeviceAttributes(
+	ctx context.Context,
+	id model.DeviceID,
+) (*model.DeviceAttributesReport, error) {
+	r0, err := ds.DataStore.VerifyDeviceAttributes(ctx, id)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) DeleteGroup(
+	ctx context.Context,
+	group model.GroupName,
+) (chan model.DeviceID, error) {
+	r0, err := ds.DataStore.DeleteGroup(ctx, group)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) UnsetDevicesGroup(
+	ctx context.Context,
+	deviceIDs []model.DeviceID,
+	group model.GroupName,
+) (*model.UpdateResult, error) {
+	r0, err := ds.DataStore.UnsetDevicesGroup(ctx, deviceIDs, group)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) CountDevicesInGroup(
+	ctx context.Context,
+	deviceIDs []model.DeviceID,
+	group model.GroupName,
+) (int64, error) {
+	r0, err := ds.DataStore.CountDevicesInGroup(ctx, deviceIDs, group)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) UpdateDevicesGroup(
+	ctx context.Context,
+	devIDs []model.DeviceID,
+	group model.GroupName,
+) (*model.UpdateResult, error) {
+	r0, err := ds.DataStore.UpdateDevicesGroup(ctx, devIDs, group)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) UpdateDeviceGroupIf(
+	ctx context.Context,
+	id model.DeviceID,
+	expected model.GroupName,
+	newGroup model.GroupName,
+) (bool, error) {
+	r0, err := ds.DataStore.UpdateDeviceGroupIf(ctx, id, expected, newGroup)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) ListGroups(
+	ctx context.Context,
+	filters []model.FilterPredicate,
+	skip int,
+	limit int,
+) ([]model.GroupName, int, error) {
+	r0, r1, err := ds.DataStore.ListGroups(ctx, filters, skip, limit)
+	return r0, r1, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetDevicesDistinctGroups(
+	ctx context.Context,
+	ids []model.DeviceID,
+) ([]model.GroupName, error) {
+	r0, err := ds.DataStore.GetDevicesDistinctGroups(ctx, ids)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetDevicesByGroup(
+	ctx context.Context,
+	group model.GroupName,
+	skip, limit int,
+) ([]model.DeviceID, int, error) {
+	r0, r1, err := ds.DataStore.GetDevicesByGroup(ctx, group, skip, limit)
+	return r0, r1, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetDevicesByGroupWithAttributes(
+	ctx context.Context,
+	group model.GroupName,
+	skip, limit int,
+	attributes []model.SelectAttribute,
+) ([]model.Device, int, error) {
+	r0, r1, err := ds.DataStore.GetDevicesByGroupWithAttributes(ctx, group, skip, limit, attributes)
+	return r0, r1, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetDeviceGroup(
+	ctx context.Context,
+	id model.DeviceID,
+) (model.GroupName, error) {
+	r0, err := ds.DataStore.GetDeviceGroup(ctx, id)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetGroupSiblings(
+	ctx context.Context,
+	id model.DeviceID,
+) ([]model.Device, error) {
+	r0, err := ds.DataStore.GetGroupSiblings(ctx, id)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) GetAllAttributeNames(
+	ctx context.Context,
+	excludeSystem bool,
+) ([]string, error) {
+	r0, err := ds.DataStore.GetAllAttributeNames(ctx, excludeSystem)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) SearchDevices(
+	ctx context.Context,
+	searchParams model.SearchParams,
+) ([]model.Device, int, error) {
+	r0, r1, err := ds.DataStore.SearchDevices(ctx, searchParams)
+	return r0, r1, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) CountDevices(
+	ctx context.Context,
+	searchParams model.SearchParams,
+) (int, error) {
+	r0, err := ds.DataStore.CountDevices(ctx, searchParams)
+	return r0, withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) MigrateTenant(
+	ctx context.Context,
+	version string,
+	tenantId string,
+) error {
+	err := ds.DataStore.MigrateTenant(ctx, version, tenantId)
+	return withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) Migrate(ctx context.Context, version string) error {
+	err := ds.DataStore.Migrate(ctx, version)
+	return withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) StreamAllDevicesAcrossTenants(
+	ctx context.Context,
+	fn func(model.TenantDevice) error,
+) error {
+	err := ds.DataStore.StreamAllDevicesAcrossTenants(ctx, fn)
+	return withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) Maintenance(
+	ctx context.Context,
+	version string,
+	tenantIDs ...string,
+) error {
+	err := ds.DataStore.Maintenance(ctx, version, tenantIDs...)
+	return withRequestID(ctx, err)
+}
+
+func (ds *requestIDDataStore) PurgeScopeByRetention(
+	ctx context.Context,
+	scope string,
+	retention time.Duration,
+	tenantIDs ...string,
+) (int, error) {
+	r0, err := ds.DataStore.PurgeScopeByRetention(ctx, scope, retention, tenantIDs...)
+	return r0, withRequestID(ctx, err)
+}
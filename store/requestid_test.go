@@ -0,0 +1,98 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/inventory/model"
+)
+
+type fakeDataStore struct {
+	DataStore
+	err error
+}
+
+func (ds *fakeDataStore) GetDevice(
+	ctx context.Context,
+	id model.DeviceID,
+) (*model.Device, error) {
+	return nil, ds.err
+}
+
+func (ds *fakeDataStore) WithAdminAccess() DataStore {
+	return ds
+}
+
+func TestWithRequestIDErrors(t *testing.T) {
+	testCases := map[string]struct {
+		requestID string
+		err       error
+
+		outErr string
+	}{
+		"sentinel error": {
+			requestID: "abc",
+			err:       ErrDevNotFound,
+			outErr:    "Device not found (request_id: abc)",
+		},
+		"wrapped sentinel error": {
+			requestID: "abc",
+			err:       errors.Wrap(ErrDevNotFound, "failed to get the device"),
+			outErr:    "failed to get the device: Device not found (request_id: abc)",
+		},
+		"no request ID": {
+			err:    ErrDevNotFound,
+			outErr: "Device not found",
+		},
+		"no error": {
+			requestID: "abc",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.requestID != "" {
+				ctx = requestid.WithContext(ctx, tc.requestID)
+			}
+			ds := WithRequestIDErrors(&fakeDataStore{err: tc.err})
+
+			for _, ds := range []DataStore{ds, ds.WithAdminAccess()} {
+				_, err := ds.GetDevice(ctx, "1")
+				if tc.err == nil {
+					assert.NoError(t, err)
+					continue
+				}
+				assert.EqualError(t, err, tc.outErr)
+				assert.ErrorIs(t, err, ErrDevNotFound)
+				assert.Equal(t, ErrDevNotFound, errors.Cause(err))
+
+				var reqErr *RequestIDError
+				if tc.requestID != "" {
+					assert.True(t, errors.As(err, &reqErr))
+					assert.Equal(t, tc.requestID, reqErr.RequestID)
+				} else {
+					assert.False(t, errors.As(err, &reqErr))
+				}
+			}
+		})
+	}
+}
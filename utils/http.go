@@ -158,17 +158,28 @@ func ParsePagination(r *rest.Request) (uint64, uint64, error) {
 }
 
 func MakePageLinkHdrs(r *rest.Request, page, per_page uint64, has_next bool) []string {
+	return MakePageLinkHdrsCapped(r, page, per_page, has_next, 0)
+}
+
+// MakePageLinkHdrsCapped returns the Link headers of the page, leaving out
+// the prev and next links pointing past max_page; zero means no limit
+func MakePageLinkHdrsCapped(
+	r *rest.Request,
+	page, per_page uint64,
+	has_next bool,
+	max_page uint64,
+) []string {
 	var links []string
 
 	pathitems := strings.Split(r.URL.Path, "/")
 	resource := pathitems[len(pathitems)-1]
 	query := r.URL.Query()
 
-	if page > 1 {
+	if page > 1 && (max_page == 0 || page-1 <= max_page) {
 		links = append(links, MakeLink(LinkPrev, resource, query, page-1, per_page))
 	}
 
-	if has_next {
+	if has_next && (max_page == 0 || page+1 <= max_page) {
 		links = append(links, MakeLink(LinkNext, resource, query, page+1, per_page))
 	}
 
@@ -78,6 +78,28 @@ func TestMakePageLinkHdrs(t *testing.T) {
 	assert.Len(t, links, 3)
 }
 
+func TestMakePageLinkHdrsCapped(t *testing.T) {
+	url := "https://localhost:8080/base/url/resource?page=2&per_page=10"
+	req := mockRequest(url, true)
+
+	// within the cap
+	links := MakePageLinkHdrsCapped(req, 2, 10, true, 3)
+	assert.Len(t, links, 3)
+
+	// next page past the cap
+	links = MakePageLinkHdrsCapped(req, 3, 10, true, 3)
+	assert.Equal(t, []string{
+		"<resource?page=2&per_page=10>; rel=\"prev\"",
+		"<resource?page=1&per_page=10>; rel=\"first\"",
+	}, links)
+
+	// prev and next pages past the cap
+	links = MakePageLinkHdrsCapped(req, 5, 10, true, 3)
+	assert.Equal(t, []string{
+		"<resource?page=1&per_page=10>; rel=\"first\"",
+	}, links)
+}
+
 func TestParseQueryParmUInt(t *testing.T) {
 	url := "https://localhost:8080/resource?test=10"
 	req := mockRequest(url, true)
@@ -0,0 +1,53 @@
+// Copyright 2023 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mendersoftware/inventory/model"
+)
+
+// RedactedValue replaces the values of the redacted attributes in the logs
+const RedactedValue = "[REDACTED]"
+
+// AttributesRedactor formats device attributes for the logs, hiding the
+// values of the attributes with the given names, in any scope.
+type AttributesRedactor map[string]struct{}
+
+func NewAttributesRedactor(names []string) AttributesRedactor {
+	r := make(AttributesRedactor, len(names))
+	for _, name := range names {
+		r[name] = struct{}{}
+	}
+	return r
+}
+
+// Format returns the attributes as a comma-separated list of
+// scope/name=value pairs.
+func (r AttributesRedactor) Format(attrs model.DeviceAttributes) string {
+	var s strings.Builder
+	for i, attr := range attrs {
+		if i > 0 {
+			s.WriteString(", ")
+		}
+		var value interface{} = RedactedValue
+		if _, redacted := r[attr.Name]; !redacted {
+			value = attr.Value
+		}
+		fmt.Fprintf(&s, "%s/%s=%v", attr.Scope, attr.Name, value)
+	}
+	return s.String()
+}
@@ -0,0 +1,51 @@
+// Copyright 2023 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/inventory/model"
+)
+
+func TestAttributesRedactorFormat(t *testing.T) {
+	attrs := model.DeviceAttributes{
+		{Name: "mac", Value: "00:11", Scope: model.AttrScopeIdentity},
+		{Name: "token", Value: "s3cr3t", Scope: model.AttrScopeInventory},
+		{Name: "keys", Value: []interface{}{"k1", "k2"}, Scope: model.AttrScopeTags},
+	}
+
+	testCases := map[string]struct {
+		names []string
+		out   string
+	}{
+		"none redacted": {
+			out: "identity/mac=00:11, inventory/token=s3cr3t, tags/keys=[k1 k2]",
+		},
+		"redacted in any scope": {
+			names: []string{"token", "keys", "other"},
+			out: "identity/mac=00:11, inventory/token=[REDACTED], " +
+				"tags/keys=[REDACTED]",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			out := NewAttributesRedactor(tc.names).Format(attrs)
+			assert.Equal(t, tc.out, out)
+		})
+	}
+	assert.Empty(t, NewAttributesRedactor(nil).Format(nil))
+}